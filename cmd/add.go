@@ -11,8 +11,22 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// addWhitespace is the --whitespace action for added content
+var addWhitespace string
+
 // AddHandler handles the 'add' command for staging files or directories.
 func AddHandler(repo *core.Repository, args []string) error {
+	if _, err := core.ParseWhitespaceAction(addWhitespace); err != nil {
+		return err
+	}
+	if addWhitespace == core.WhitespaceFix {
+		return fmt.Errorf("--whitespace=fix is only supported by apply")
+	}
+	rules, err := core.WhitespaceRulesFor(repo.Root)
+	if err != nil {
+		return err
+	}
+
 	// Load the current index (staging area)
 	index, err := staging.LoadIndex(repo.Root)
 	if err != nil {
@@ -42,7 +56,7 @@ func AddHandler(repo *core.Repository, args []string) error {
 			}
 			// Add each file matched by the glob pattern
 			for _, file := range files {
-				if err := addFileOrDir(repo, index, file); err != nil {
+				if err := addFileOrDir(repo, index, file, rules); err != nil {
 					return err
 				}
 			}
@@ -50,7 +64,7 @@ func AddHandler(repo *core.Repository, args []string) error {
 			return core.FSError(fmt.Sprintf("failed to stat '%s'", arg), err)
 		} else {
 			// Path exists, add it directly
-			if err := addFileOrDir(repo, index, absPath); err != nil {
+			if err := addFileOrDir(repo, index, absPath, rules); err != nil {
 				return err
 			}
 		}
@@ -64,7 +78,7 @@ func AddHandler(repo *core.Repository, args []string) error {
 }
 
 // addFileOrDir adds a file or directory (recursively) to the index.
-func addFileOrDir(repo *core.Repository, index *staging.Index, absPath string) error {
+func addFileOrDir(repo *core.Repository, index *staging.Index, absPath string, rules core.WhitespaceRules) error {
 	// Convert absolute path to relative path for index storage
 	relPath, err := filepath.Rel(repo.Root, absPath)
 	if err != nil {
@@ -92,7 +106,7 @@ func addFileOrDir(repo *core.Repository, index *staging.Index, absPath string) e
 			if info.IsDir() {
 				return nil
 			}
-			return addFileOrDir(repo, index, path)
+			return addFileOrDir(repo, index, path, rules)
 		})
 		if err != nil {
 			return core.FSError(fmt.Sprintf("failed to walk directory '%s'", absPath), err)
@@ -104,6 +118,10 @@ func addFileOrDir(repo *core.Repository, index *staging.Index, absPath string) e
 			return core.FSError(fmt.Sprintf("failed to read file '%s'", absPath), err)
 		}
 
+		if err := checkAddedWhitespace(repo, index, relPath, content, rules); err != nil {
+			return err
+		}
+
 		// Create a blob object and get its hash
 		hash, err := objects.CreateBlob(repo.Root, content)
 		if err != nil {
@@ -114,10 +132,31 @@ func addFileOrDir(repo *core.Repository, index *staging.Index, absPath string) e
 		if err := index.Add(repo.Root, relPath, hash); err != nil {
 			return core.IndexError(fmt.Sprintf("failed to add '%s' to index", relPath), err)
 		}
+		// Staging a conflicted path marks it resolved
+		for stage := 1; stage <= 3; stage++ {
+			index.RemoveEntry(relPath, stage)
+		}
 	}
 	return nil
 }
 
+// checkAddedWhitespace reports whitespace problems in the lines of content
+// that the staged version of relPath doesn't have
+func checkAddedWhitespace(repo *core.Repository, index *staging.Index, relPath string, content []byte, rules core.WhitespaceRules) error {
+	if addWhitespace == core.WhitespaceNoWarn {
+		return nil
+	}
+	var staged []byte
+	if entry, ok := index.GetEntry(relPath, 0); ok {
+		var err error
+		if staged, err = objects.GetBlobRepo(repo, entry.SHA256); err != nil {
+			return core.ObjectError(fmt.Sprintf("failed to read staged '%s'", relPath), err)
+		}
+	}
+	problems := core.CheckWhitespace(content, rules, core.NewLinesOnly(staged))
+	return core.ReportWhitespace(relPath, problems, addWhitespace)
+}
+
 // init registers the add command with the root command.
 func init() {
 	addCmd := NewRepoCommand(
@@ -134,5 +173,14 @@ func init() {
 		return nil
 	}
 
+	addCmd.Long = `Add file contents to the index.
+
+With --whitespace=warn or error, lines new since the staged version are
+checked for the problems listed in core.whitespace (trailing-space,
+space-before-tab and eof-newline by default; "-rule" disables one), and
+error refuses to stage a file that has any. The default action can be set
+with add.whitespace.`
+	addCmd.Flags().StringVar(&addWhitespace, "whitespace", core.WhitespaceNoWarn, "Whitespace check for added lines: nowarn, warn or error")
+
 	rootCmd.AddCommand(addCmd)
 }
@@ -0,0 +1,366 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+var (
+	applyCheck      bool   // Only check that the patch applies
+	applyWhitespace string // --whitespace action for added lines
+)
+
+// patchHunk is one @@ section of a unified diff
+type patchHunk struct {
+	oldStart, newStart int
+	lines              []string // Lines with their ' ', '-' or '+' prefix
+	// noNewline marks lines followed by "\ No newline at end of file"
+	noNewline map[int]bool
+}
+
+// filePatch is the change a unified diff makes to one file
+type filePatch struct {
+	oldPath, newPath string // "" for /dev/null
+	hunks            []*patchHunk
+}
+
+// path returns the file the patch applies to
+func (p *filePatch) path() string {
+	if p.newPath != "" {
+		return p.newPath
+	}
+	return p.oldPath
+}
+
+// ApplyHandler applies unified diffs read from the given files, or from
+// standard input, to the working tree
+func ApplyHandler(repo *core.Repository, args []string) error {
+	action, err := core.ParseWhitespaceAction(applyWhitespace)
+	if err != nil {
+		return err
+	}
+	rules, err := core.WhitespaceRulesFor(repo.Root)
+	if err != nil {
+		return err
+	}
+
+	var patches []*filePatch
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+	for _, arg := range args {
+		var r io.Reader = os.Stdin
+		if arg != "-" {
+			f, err := os.Open(arg)
+			if err != nil {
+				return core.FSError(fmt.Sprintf("failed to open patch '%s'", arg), err)
+			}
+			defer f.Close()
+			r = f
+		}
+		parsed, err := parsePatch(r)
+		if err != nil {
+			return fmt.Errorf("%s: %w", arg, err)
+		}
+		patches = append(patches, parsed...)
+	}
+
+	// Apply everything in memory first so a failing hunk leaves no file changed
+	results := make(map[string][]byte, len(patches))
+	whitespaceErrors := 0
+	for _, patch := range patches {
+		var old []byte
+		if patch.oldPath != "" {
+			if old, err = os.ReadFile(filepath.Join(repo.Root, patch.oldPath)); err != nil {
+				return core.FSError(fmt.Sprintf("failed to read '%s'", patch.oldPath), err)
+			}
+		} else if _, err := os.Stat(filepath.Join(repo.Root, patch.newPath)); err == nil {
+			return fmt.Errorf("%s: already exists in working directory", patch.newPath)
+		}
+
+		problems := patchWhitespaceProblems(patch, rules)
+		whitespaceErrors += len(problems)
+		if action == core.WhitespaceFix {
+			if len(problems) > 0 {
+				fmt.Fprintf(os.Stderr, "%s: fixed %d whitespace error(s)\n", patch.path(), len(problems))
+			}
+			fixPatchWhitespace(patch, rules)
+		} else if err := core.ReportWhitespace(patch.path(), problems, action); err != nil {
+			return err
+		}
+
+		content, err := applyHunks(old, patch.hunks)
+		if err != nil {
+			return fmt.Errorf("%s: %w", patch.path(), err)
+		}
+		if patch.newPath == "" && len(content) > 0 {
+			return fmt.Errorf("%s: patch deletes the file but leaves content", patch.oldPath)
+		}
+		results[patch.path()] = content
+	}
+	if action == core.WhitespaceWarn && whitespaceErrors > 0 {
+		fmt.Fprintf(os.Stderr, "warning: %d line(s) add whitespace errors\n", whitespaceErrors)
+	}
+	if applyCheck {
+		return nil
+	}
+
+	for _, patch := range patches {
+		absPath := filepath.Join(repo.Root, patch.path())
+		if patch.newPath == "" {
+			if err := os.Remove(absPath); err != nil {
+				return core.FSError(fmt.Sprintf("failed to remove '%s'", patch.oldPath), err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+			return core.FSError(fmt.Sprintf("failed to create directory for '%s'", patch.newPath), err)
+		}
+		perm := os.FileMode(0644)
+		if info, err := os.Stat(absPath); err == nil {
+			perm = info.Mode().Perm()
+		}
+		if err := os.WriteFile(absPath, results[patch.path()], perm); err != nil {
+			return core.FSError(fmt.Sprintf("failed to write '%s'", patch.newPath), err)
+		}
+	}
+	return nil
+}
+
+// parsePatch reads the file patches of a unified diff; anything before a
+// "--- " header, such as a commit message or diff line, is skipped
+func parsePatch(r io.Reader) ([]*filePatch, error) {
+	var patches []*filePatch
+	var current *filePatch
+	var hunk *patchHunk
+	remaining := 0 // Old and new lines the current hunk still expects
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNo++
+		switch {
+		case hunk != nil && remaining > 0 && line != "" && strings.ContainsRune(" -+", rune(line[0])):
+			hunk.lines = append(hunk.lines, line)
+			if line[0] == ' ' {
+				remaining -= 2
+			} else {
+				remaining--
+			}
+		case hunk != nil && remaining > 0 && line == "":
+			hunk.lines = append(hunk.lines, " ") // Context line whose space was stripped
+			remaining -= 2
+		case hunk != nil && len(hunk.lines) > 0 && strings.HasPrefix(line, `\`):
+			hunk.noNewline[len(hunk.lines)-1] = true
+		case strings.HasPrefix(line, "--- "):
+			if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), "+++ ") {
+				return nil, fmt.Errorf("line %d: '---' header without '+++'", lineNo)
+			}
+			lineNo++
+			current = &filePatch{
+				oldPath: patchHeaderPath(line[4:], "a/"),
+				newPath: patchHeaderPath(scanner.Text()[4:], "b/"),
+			}
+			if current.oldPath == "" && current.newPath == "" {
+				return nil, fmt.Errorf("line %d: patch has no file name", lineNo)
+			}
+			patches = append(patches, current)
+			hunk = nil
+		case strings.HasPrefix(line, "@@ "):
+			if current == nil {
+				return nil, fmt.Errorf("line %d: hunk before any file header", lineNo)
+			}
+			oldStart, oldCount, newStart, newCount, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			hunk = &patchHunk{oldStart: oldStart, newStart: newStart, noNewline: make(map[int]bool)}
+			current.hunks = append(current.hunks, hunk)
+			remaining = oldCount + newCount
+		default:
+			hunk = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read patch: %w", err)
+	}
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no valid patches in input")
+	}
+	return patches, nil
+}
+
+// patchHeaderPath returns the file named by a ---/+++ header, without the
+// a/ or b/ prefix, a timestamp, or "" for /dev/null
+func patchHeaderPath(header, prefix string) string {
+	if i := strings.IndexByte(header, '\t'); i >= 0 {
+		header = header[:i]
+	}
+	if header == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(header, prefix)
+}
+
+// parseHunkHeader parses "@@ -l[,s] +l[,s] @@"
+func parseHunkHeader(line string) (oldStart, oldCount, newStart, newCount int, err error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, 0, 0, fmt.Errorf("malformed hunk header '%s'", line)
+	}
+	parseRange := func(s string) (int, int, error) {
+		start, count, found := strings.Cut(s[1:], ",")
+		n := 1
+		if found {
+			var err error
+			if n, err = strconv.Atoi(count); err != nil {
+				return 0, 0, err
+			}
+		}
+		l, err := strconv.Atoi(start)
+		return l, n, err
+	}
+	if oldStart, oldCount, err = parseRange(fields[1]); err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("malformed hunk header '%s'", line)
+	}
+	if newStart, newCount, err = parseRange(fields[2]); err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("malformed hunk header '%s'", line)
+	}
+	return oldStart, oldCount, newStart, newCount, nil
+}
+
+// patchWhitespaceProblems checks the lines a patch adds
+func patchWhitespaceProblems(patch *filePatch, rules core.WhitespaceRules) []core.WhitespaceProblem {
+	var problems []core.WhitespaceProblem
+	for _, hunk := range patch.hunks {
+		newLine := hunk.newStart
+		for i, line := range hunk.lines {
+			if line[0] == '-' {
+				continue
+			}
+			if line[0] == '+' {
+				for _, rule := range core.CheckWhitespaceLine(line[1:], rules) {
+					problems = append(problems, core.WhitespaceProblem{Line: newLine, Rule: rule, Text: line[1:]})
+				}
+				if hunk.noNewline[i] && rules&core.WhitespaceEOFNewline != 0 {
+					problems = append(problems, core.WhitespaceProblem{Line: newLine, Rule: "no newline at end of file", Text: line[1:]})
+				}
+			}
+			newLine++
+		}
+	}
+	return problems
+}
+
+// fixPatchWhitespace corrects the lines a patch adds, and gives an added last
+// line its missing newline
+func fixPatchWhitespace(patch *filePatch, rules core.WhitespaceRules) {
+	for _, hunk := range patch.hunks {
+		for i, line := range hunk.lines {
+			if line[0] != '+' {
+				continue
+			}
+			hunk.lines[i] = "+" + core.FixWhitespaceLine(line[1:], rules)
+			if rules&core.WhitespaceEOFNewline != 0 {
+				delete(hunk.noNewline, i)
+			}
+		}
+	}
+}
+
+// applyHunks applies hunks to old. A hunk whose context isn't at its stated
+// line is looked for nearby, as patches made against a slightly different
+// version often still apply.
+func applyHunks(old []byte, hunks []*patchHunk) ([]byte, error) {
+	lines := strings.SplitAfter(string(old), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var result []string
+	pos, offset := 0, 0
+	for n, hunk := range hunks {
+		var before, after []string
+		for i, line := range hunk.lines {
+			text := line[1:]
+			if !hunk.noNewline[i] {
+				text += "\n"
+			}
+			if line[0] != '+' {
+				before = append(before, text)
+			}
+			if line[0] != '-' {
+				after = append(after, text)
+			}
+		}
+
+		start := hunk.oldStart - 1 + offset
+		if len(before) == 0 {
+			start++ // "-l,0" inserts after line l
+		}
+		at := findHunk(lines, before, start, pos)
+		if at < 0 {
+			return nil, fmt.Errorf("patch does not apply (hunk #%d at line %d)", n+1, hunk.oldStart)
+		}
+		result = append(result, lines[pos:at]...)
+		result = append(result, after...)
+		offset += at - start
+		pos = at + len(before)
+	}
+	result = append(result, lines[pos:]...)
+	return []byte(strings.Join(result, "")), nil
+}
+
+// findHunk returns where before occurs in lines at or after min, searching
+// outward from want, or -1
+func findHunk(lines, before []string, want, min int) int {
+	matches := func(at int) bool {
+		if at < min || at+len(before) > len(lines) {
+			return false
+		}
+		for i, line := range before {
+			if lines[at+i] != line {
+				return false
+			}
+		}
+		return true
+	}
+	for delta := 0; want-delta >= min || want+delta <= len(lines); delta++ {
+		if matches(want - delta) {
+			return want - delta
+		}
+		if matches(want + delta) {
+			return want + delta
+		}
+	}
+	return -1
+}
+
+func init() {
+	applyCmd := NewRepoCommand(
+		"apply [<patch>...]",
+		"Apply a unified diff to the working tree",
+		ApplyHandler,
+	)
+	applyCmd.Long = `Apply unified diffs (with @@ hunks, as made by diff -u) read from the given
+files, or from standard input, to the working tree. Nothing is written unless
+every hunk of every file applies.
+
+Lines the patch adds are checked for the problems listed in core.whitespace.
+--whitespace chooses what happens when they have any: nowarn ignores them,
+warn (the default, also settable with apply.whitespace) reports them, error
+refuses the patch and fix corrects the added lines while applying.`
+	applyCmd.Flags().BoolVar(&applyCheck, "check", false, "Check that the patch applies without changing any file")
+	applyCmd.Flags().StringVar(&applyWhitespace, "whitespace", core.WhitespaceWarn, "Whitespace errors in added lines: nowarn, warn, error or fix")
+
+	rootCmd.AddCommand(applyCmd)
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/maintenance"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditOps    []string
+	auditTarget string
+	auditUser   string
+	auditSince  string
+	auditUntil  string
+	auditMax    int
+	auditJSON   bool
+)
+
+// auditCmd groups the audit log commands
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspect the audit log of repository changes",
+	Long: `With ` + core.AuditLogKey + ` set to true, every ref update, local config change and
+fetch, push, pull or clone is appended to .vec/` + core.AuditLogFile + ` with the time,
+the user.name and user.email of whoever made it, the command line and the
+old and new values. The log is only ever appended to; credentials in config
+values are redacted.`,
+}
+
+// auditFilter selects audit entries
+type auditFilter struct {
+	ops    map[string]bool
+	target string
+	user   string
+	since  time.Time
+	until  time.Time
+}
+
+func (f auditFilter) matches(entry core.AuditEntry) bool {
+	if len(f.ops) > 0 && !f.ops[entry.Op] {
+		return false
+	}
+	if f.target != "" {
+		if ok, _ := path.Match(f.target, entry.Target); !ok && !strings.HasPrefix(entry.Target, f.target) {
+			return false
+		}
+	}
+	if f.user != "" && !strings.Contains(strings.ToLower(entry.User), strings.ToLower(f.user)) {
+		return false
+	}
+	if !f.since.IsZero() && entry.Time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && entry.Time.After(f.until) {
+		return false
+	}
+	return true
+}
+
+// newAuditFilter builds the filter from the show flags
+func newAuditFilter() (auditFilter, error) {
+	filter := auditFilter{target: auditTarget, user: auditUser}
+	if len(auditOps) > 0 {
+		filter.ops = make(map[string]bool)
+		for _, op := range auditOps {
+			filter.ops[op] = true
+		}
+	}
+	now := time.Now()
+	for _, bound := range []struct {
+		flag, value string
+		t           *time.Time
+	}{{"--since", auditSince, &filter.since}, {"--until", auditUntil, &filter.until}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := maintenance.ParsePruneExpire(bound.value, now)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s: %w", bound.flag, err)
+		}
+		*bound.t = t
+	}
+	return filter, nil
+}
+
+// formatAuditEntry renders an entry as one line
+func formatAuditEntry(entry core.AuditEntry) string {
+	line := fmt.Sprintf("%s %-12s %s", entry.Time.Format(time.RFC3339), entry.Op, entry.Target)
+	if entry.Old != "" || entry.New != "" {
+		oldValue, newValue := entry.Old, entry.New
+		if oldValue == "" {
+			oldValue = "(none)"
+		}
+		if newValue == "" {
+			newValue = "(none)"
+		}
+		line += fmt.Sprintf(" %s -> %s", oldValue, newValue)
+	}
+	line += " by " + entry.User
+	if entry.Command != "" {
+		line += fmt.Sprintf(" (%s)", entry.Command)
+	}
+	return line
+}
+
+// AuditShowHandler prints the audit entries matching the filters
+func AuditShowHandler(repo *core.Repository, args []string) error {
+	filter, err := newAuditFilter()
+	if err != nil {
+		return err
+	}
+	entries, err := core.ReadAuditLog(repo.Root)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 && !core.AuditEnabled(repo.Root) {
+		fmt.Fprintf(os.Stderr, "hint: the audit log is off; enable it with 'vec config set %s true'\n", core.AuditLogKey)
+	}
+
+	var matched []core.AuditEntry
+	for _, entry := range entries {
+		if filter.matches(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	// -n keeps the most recent entries
+	if auditMax > 0 && len(matched) > auditMax {
+		matched = matched[len(matched)-auditMax:]
+	}
+
+	if auditJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, entry := range matched {
+			if err := encoder.Encode(entry); err != nil {
+				return fmt.Errorf("failed to write entry: %w", err)
+			}
+		}
+		return nil
+	}
+	for _, entry := range matched {
+		fmt.Println(formatAuditEntry(entry))
+	}
+	return nil
+}
+
+func init() {
+	showCmd := NewRepoCommand("show", "Show audit log entries, oldest first", AuditShowHandler)
+	showCmd.Args = cobra.NoArgs
+	showCmd.Long = `Show the entries of the audit log, oldest first.
+
+Operations are ` + strings.Join([]string{core.AuditRefUpdate, core.AuditRefDelete, core.AuditConfigSet,
+		core.AuditConfigUnset, core.AuditFetch, core.AuditPush, core.AuditPull, core.AuditClone}, ", ") + `.
+Targets are ref names, config keys, or remote names; push and pull targets
+are <remote>:<ref>.
+
+Example:
+  vec audit show --since 2.weeks.ago --op ref-update --target 'refs/heads/*'
+  vec audit show --user alice --json`
+	showCmd.Flags().StringArrayVar(&auditOps, "op", nil, "Only show this operation; repeatable")
+	showCmd.Flags().StringVar(&auditTarget, "target", "", "Only show targets matching this glob or prefix")
+	showCmd.Flags().StringVar(&auditUser, "user", "", "Only show entries whose user contains this text")
+	showCmd.Flags().StringVar(&auditSince, "since", "", "Only show entries from this time on, e.g. 2.weeks.ago or 2026-01-31")
+	showCmd.Flags().StringVar(&auditUntil, "until", "", "Only show entries up to this time")
+	showCmd.Flags().IntVarP(&auditMax, "max-count", "n", 0, "Show at most this many of the most recent entries")
+	showCmd.Flags().BoolVar(&auditJSON, "json", false, "Print the entries as JSON lines")
+
+	auditCmd.AddCommand(showCmd)
+	rootCmd.AddCommand(auditCmd)
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/config"
+	"github.com/NahomAnteneh/vec/internal/remote"
+	vechttp "github.com/NahomAnteneh/vec/internal/remote/http"
+	"github.com/spf13/cobra"
+)
+
+var (
+	authLoginURL      string
+	authLoginClientID string
+	authLoginScope    string
+)
+
+// AuthLoginHandler signs in to a remote with the OAuth2 device authorization
+// flow and stores the refresh token with the credential helper
+func AuthLoginHandler(repo *core.Repository, args []string) error {
+	name := ""
+	if len(args) > 0 {
+		name = args[0]
+	}
+	name, err := remote.ResolvePushRemoteRepo(repo, name)
+	if err != nil {
+		return core.RemoteError("failed to determine the remote", err)
+	}
+
+	cfg, err := config.LoadConfigRepo(repo)
+	if err != nil {
+		return core.ConfigError("failed to load config", err)
+	}
+	rc, ok := cfg.Remotes[name]
+	if !ok {
+		return core.RemoteError(fmt.Sprintf("remote '%s' not found", name), nil)
+	}
+	if authLoginURL != "" || authLoginClientID != "" {
+		if authLoginURL != "" {
+			rc.AuthURL = authLoginURL
+		}
+		if authLoginClientID != "" {
+			rc.AuthClientID = authLoginClientID
+		}
+		cfg.Remotes[name] = rc
+		if err := cfg.Write(); err != nil {
+			return core.ConfigError("failed to save config", err)
+		}
+	}
+
+	authURL, clientID, err := vechttp.OAuthSettings(cfg, name)
+	if err != nil {
+		return core.ConfigError("pass --auth-url to name the authorization server", err)
+	}
+	endpoints, err := vechttp.DiscoverOAuthEndpoints(authURL)
+	if err != nil {
+		return core.RemoteError("failed to read the authorization server metadata", err)
+	}
+	auth, err := vechttp.RequestDeviceAuthorization(endpoints, clientID, authLoginScope)
+	if err != nil {
+		return core.RemoteError("failed to start the device authorization", err)
+	}
+
+	if auth.VerificationURIComplete != "" {
+		fmt.Printf("To sign in to '%s', open %s\n", name, auth.VerificationURIComplete)
+		fmt.Printf("and confirm the code %s\n", auth.UserCode)
+	} else {
+		fmt.Printf("To sign in to '%s', open %s\n", name, auth.VerificationURI)
+		fmt.Printf("and enter the code %s\n", auth.UserCode)
+	}
+	fmt.Println("Waiting for authorization...")
+
+	token, err := vechttp.PollDeviceToken(endpoints, clientID, auth)
+	if err != nil {
+		return core.RemoteError("login failed", err)
+	}
+
+	// Without a refresh token the access token is all there is to keep
+	cred := vechttp.Credential{RefreshToken: token.RefreshToken}
+	if cred.RefreshToken == "" {
+		cred.Token = token.AccessToken
+	}
+	helper, err := vechttp.OpenCredentialHelper(cfg, name)
+	if err != nil {
+		return core.ConfigError("failed to open the credential helper", err)
+	}
+	remoteURL, _ := cfg.GetRemoteURL(name)
+	if err := helper.Store(remoteURL, cred); err != nil {
+		return core.ConfigError("failed to store the credentials", err)
+	}
+
+	fmt.Printf("Logged in to '%s'\n", name)
+	return nil
+}
+
+func init() {
+	authCmd := &cobra.Command{
+		Use:   "auth",
+		Short: "Manage authentication with remotes",
+	}
+
+	loginCmd := NewRepoCommand("login [<remote>]", "Sign in to a remote through its OAuth2 authorization server", AuthLoginHandler)
+	loginCmd.Long = `Sign in to a remote with the OAuth2 device authorization flow: vec prints
+a URL and a code to confirm in a browser, then waits until the sign-in is
+approved. The refresh token the authorization server issues is kept by the
+credential helper (see credential.helper); access tokens are obtained with
+it when needed and refreshed when they expire, so requests don't fail with
+401 once the first access token runs out.
+
+The authorization server is remote.<name>.authurl; its endpoints are read
+from its RFC 8414 metadata, falling back to <authurl>/device/code and
+<authurl>/token. --auth-url and --client-id save the server and client ID
+in the remote's config. The remote defaults to the one the current branch
+tracks, then origin.
+
+Examples:
+  vec auth login
+  vec auth login origin --auth-url https://auth.example.com
+  vec auth login upstream --scope "repo:read repo:write"`
+	loginCmd.Args = cobra.MaximumNArgs(1)
+	loginCmd.Flags().StringVar(&authLoginURL, "auth-url", "", "Authorization server of the remote, saved as remote.<name>.authurl")
+	loginCmd.Flags().StringVar(&authLoginClientID, "client-id", "", "OAuth2 client ID, saved as remote.<name>.authclientid (default \"vec\")")
+	loginCmd.Flags().StringVar(&authLoginScope, "scope", "", "Scope to request")
+
+	authCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(authCmd)
+}
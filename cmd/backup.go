@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/maintenance"
+	"github.com/spf13/cobra"
+)
+
+// backupPassphraseEnv holds the backup passphrase when no file is given
+const backupPassphraseEnv = "VEC_BACKUP_PASSPHRASE"
+
+var (
+	backupEncrypt        bool
+	backupSince          string
+	backupPassphraseFile string
+	backupRestoreInto    string
+)
+
+// backupCmd groups the backup commands
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Create and restore single-file repository backups",
+	Long: `Export the repository's refs, HEAD, local config and objects to a single
+archive file, optionally encrypted with AES-256-GCM under a passphrase, and
+restore repositories from such archives.
+
+Incremental backups (--since) only pack the objects that the previous backup
+chain doesn't already hold. A restore takes the full backup followed by its
+incremental backups in the order they were made.
+
+The passphrase is read from --passphrase-file, or from ` + backupPassphraseEnv + `.
+
+Example:
+  vec backup create full.vecbackup
+  vec backup create --since full.vecbackup monday.vecbackup
+  vec backup restore --into restored full.vecbackup monday.vecbackup`,
+}
+
+// backupPassphrase returns the passphrase from --passphrase-file or the
+// environment, "" when neither gives one
+func backupPassphrase() (string, error) {
+	if backupPassphraseFile != "" {
+		content, err := os.ReadFile(backupPassphraseFile)
+		if err != nil {
+			return "", core.FSError(fmt.Sprintf("failed to read passphrase file '%s'", backupPassphraseFile), err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+	return os.Getenv(backupPassphraseEnv), nil
+}
+
+// BackupCreateHandler writes a backup archive of the repository
+func BackupCreateHandler(repo *core.Repository, args []string) error {
+	passphrase, err := backupPassphrase()
+	if err != nil {
+		return err
+	}
+	if backupEncrypt && passphrase == "" {
+		return fmt.Errorf("--encrypt needs a passphrase from --passphrase-file or %s", backupPassphraseEnv)
+	}
+
+	options := maintenance.BackupOptions{
+		RepoRoot:   repo.Root,
+		OutputPath: args[0],
+		Since:      backupSince,
+	}
+	if backupEncrypt {
+		options.Passphrase = passphrase
+	} else if backupSince != "" {
+		// The previous backup may be encrypted even when this one isn't
+		if encrypted, err := maintenance.IsBackupEncrypted(backupSince); err != nil {
+			return err
+		} else if encrypted {
+			return fmt.Errorf("'%s' is encrypted; incremental backups of it must use --encrypt", backupSince)
+		}
+	}
+
+	manifest, err := maintenance.CreateBackup(options)
+	if err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	kind := "Full"
+	if manifest.Base != "" {
+		kind = "Incremental"
+	}
+	fmt.Printf("%s backup %s written to %s: %d refs, %d of %d objects packed\n",
+		kind, manifest.ID, args[0], len(manifest.Refs), manifest.Packed, len(manifest.Objects))
+	return nil
+}
+
+// backupRestoreHandler creates a repository from a backup chain
+func backupRestoreHandler(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("requires at least 1 argument")
+	}
+	passphrase, err := backupPassphrase()
+	if err != nil {
+		return err
+	}
+	target, err := filepath.Abs(backupRestoreInto)
+	if err != nil {
+		return core.FSError("failed to get absolute path", err)
+	}
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return core.FSError(fmt.Sprintf("failed to create '%s'", target), err)
+	}
+
+	manifest, err := maintenance.RestoreBackup(target, args, passphrase)
+	if err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+	fmt.Printf("Restored %d refs from backup %s into %s\n", len(manifest.Refs), manifest.ID, target)
+	fmt.Println("The working tree is empty; check out a branch to populate it.")
+	return nil
+}
+
+func init() {
+	createCmd := NewCommand("create <file>", "Write a backup archive of the repository", BackupCreateHandler, 1)
+	createCmd.Flags().BoolVar(&backupEncrypt, "encrypt", false, "Encrypt the archive with the backup passphrase")
+	createCmd.Flags().StringVar(&backupSince, "since", "", "Only pack objects newer than this previous backup")
+	createCmd.Flags().StringVar(&backupPassphraseFile, "passphrase-file", "", "Read the passphrase from this file")
+
+	restoreCmd := NewInitCommand("restore <file>...", "Create a repository from a backup and its incremental backups", backupRestoreHandler)
+	restoreCmd.Flags().StringVar(&backupRestoreInto, "into", ".", "Directory to restore the repository into")
+	restoreCmd.Flags().StringVar(&backupPassphraseFile, "passphrase-file", "", "Read the passphrase from this file")
+
+	backupCmd.AddCommand(createCmd, restoreCmd)
+	rootCmd.AddCommand(backupCmd)
+}
@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/bisect"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/rebase"
+	"github.com/spf13/cobra"
+)
+
+// bisectSkipCode is the exit code with which a bisect run script says the
+// commit can't be tested
+const bisectSkipCode = 125
+
+// BisectStartHandler starts a bisection, optionally with a bad commit and
+// good ones
+func BisectStartHandler(repo *core.Repository, args []string) error {
+	if bisect.InProgress(repo) {
+		return core.RepositoryError("already bisecting; finish with vec bisect reset first", nil)
+	}
+	if rebase.InProgress(repo) {
+		return core.RepositoryError("cannot bisect during a rebase; finish it with vec rebase --continue or --abort", nil)
+	}
+	hashes, err := resolveBisectRevs(repo, args)
+	if err != nil {
+		return err
+	}
+
+	start, err := repo.GetCurrentBranch()
+	if err != nil {
+		return core.RefError("failed to read HEAD", err)
+	}
+	if start == "(HEAD detached)" {
+		if start, err = repo.ReadHead(); err != nil {
+			return core.RefError("failed to read HEAD", err)
+		}
+	}
+	state := &bisect.State{Start: start}
+	if len(hashes) > 0 {
+		state.Bad, state.Good = hashes[0], hashes[1:]
+	}
+	if err := state.Save(repo); err != nil {
+		return err
+	}
+	if err := bisect.AppendLog(repo, strings.TrimSpace("vec bisect start "+strings.Join(args, " "))); err != nil {
+		return err
+	}
+	_, err = bisectNextRepo(repo, state)
+	return err
+}
+
+// BisectBadHandler marks a commit, HEAD by default, as bad
+func BisectBadHandler(repo *core.Repository, args []string) error {
+	return bisectMarkRepo(repo, "bad", args)
+}
+
+// BisectGoodHandler marks commits, HEAD by default, as good
+func BisectGoodHandler(repo *core.Repository, args []string) error {
+	return bisectMarkRepo(repo, "good", args)
+}
+
+// BisectSkipHandler marks commits, HEAD by default, as untestable
+func BisectSkipHandler(repo *core.Repository, args []string) error {
+	return bisectMarkRepo(repo, "skip", args)
+}
+
+// bisectMarkRepo records the mark of the given commits and moves on to the
+// next commit to test
+func bisectMarkRepo(repo *core.Repository, mark string, args []string) error {
+	state, err := bisect.LoadState(repo)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		args = []string{core.HeadFile}
+	}
+	if mark == "bad" && len(args) > 1 {
+		return core.RepositoryError("only one commit can be marked bad", nil)
+	}
+	hashes, err := resolveBisectRevs(repo, args)
+	if err != nil {
+		return err
+	}
+	if err := markBisectState(state, mark, hashes); err != nil {
+		return err
+	}
+	if err := state.Save(repo); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if err := bisect.AppendLog(repo, fmt.Sprintf("vec bisect %s %s", mark, hash)); err != nil {
+			return err
+		}
+	}
+	_, err = bisectNextRepo(repo, state)
+	return err
+}
+
+// markBisectState adds hashes to the list mark names
+func markBisectState(state *bisect.State, mark string, hashes []string) error {
+	switch mark {
+	case "bad":
+		state.Bad = hashes[0]
+	case "good", "skip":
+		list := &state.Good
+		if mark == "skip" {
+			list = &state.Skipped
+		}
+		for _, hash := range hashes {
+			if !slices.Contains(*list, hash) {
+				*list = append(*list, hash)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown bisect mark '%s'", mark)
+	}
+	return nil
+}
+
+// bisectNextRepo checks out the next commit to test, or reports the first
+// bad commit once it is known, and says whether the bisection is over
+func bisectNextRepo(repo *core.Repository, state *bisect.State) (bool, error) {
+	result, err := bisect.NextRepo(repo, state)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case state.Bad == "" && len(state.Good) == 0:
+		fmt.Println("Mark a bad commit with vec bisect bad and a good one with vec bisect good")
+		return false, nil
+	case state.Bad == "":
+		fmt.Println("Mark a bad commit with vec bisect bad")
+		return false, nil
+	case len(state.Good) == 0:
+		fmt.Println("Mark a good commit with vec bisect good")
+		return false, nil
+	case result.FirstBad != "":
+		commit, err := objects.GetCommitRepo(repo, result.FirstBad)
+		if err != nil {
+			return false, core.ObjectError("failed to load the first bad commit", err)
+		}
+		fmt.Printf("%s is the first bad commit\n", result.FirstBad)
+		fmt.Println(formatCommit(commit, commitFormatMedium, objects.DateDefault))
+		return true, bisect.AppendLog(repo, "# first bad commit: "+result.FirstBad)
+	case result.Next == "":
+		fmt.Println("There are only skipped commits left to test.")
+		fmt.Println("The first bad commit could be any of:")
+		for _, hash := range result.Suspects {
+			fmt.Println(hash)
+		}
+		return true, nil
+	}
+
+	if err := checkoutRepo(repo, result.Next); err != nil {
+		return false, err
+	}
+	commit, err := objects.GetCommitRepo(repo, result.Next)
+	if err != nil {
+		return false, core.ObjectError("failed to load commit to test", err)
+	}
+	steps := bits.Len(uint(result.Remaining))
+	fmt.Printf("Bisecting: %d revision%s left to test after this (roughly %d step%s)\n",
+		result.Remaining, plural(result.Remaining), steps, plural(steps))
+	fmt.Printf("[%s] %s\n", result.Next, commit.Subject())
+	return false, nil
+}
+
+// BisectResetHandler ends the bisection and returns to where it started,
+// or to the given commit
+func BisectResetHandler(repo *core.Repository, args []string) error {
+	state, err := bisect.LoadState(repo)
+	if err != nil {
+		return err
+	}
+	target := state.Start
+	if len(args) > 0 {
+		if target, err = repo.ResolveRevision(args[0]); err != nil {
+			return core.RefError(fmt.Sprintf("unknown revision '%s'", args[0]), err)
+		}
+	}
+	if err := checkoutRepo(repo, target); err != nil {
+		return err
+	}
+	return bisect.Remove(repo)
+}
+
+// BisectRunHandler tests each commit with a command until the first bad
+// commit is found: exit code 0 marks it good, 125 skips it, and any other
+// code below 128 marks it bad
+func BisectRunHandler(repo *core.Repository, args []string) error {
+	state, err := bisect.LoadState(repo)
+	if err != nil {
+		return err
+	}
+	if state.Bad == "" || len(state.Good) == 0 {
+		return core.RepositoryError("vec bisect run needs a bad and a good commit; mark them first", nil)
+	}
+
+	for {
+		head, err := repo.ReadHead()
+		if err != nil {
+			return core.RefError("failed to read HEAD", err)
+		}
+		fmt.Printf("running '%s'\n", strings.Join(args, " "))
+		run := exec.Command(args[0], args[1:]...)
+		run.Dir = repo.Root
+		run.Stdin, run.Stdout, run.Stderr = os.Stdin, os.Stdout, os.Stderr
+		code := 0
+		if err := run.Run(); err != nil {
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				return fmt.Errorf("bisect run failed to start '%s': %w", args[0], err)
+			}
+			code = exitErr.ExitCode()
+		}
+
+		mark := "bad"
+		switch {
+		case code == 0:
+			mark = "good"
+		case code == bisectSkipCode:
+			mark = "skip"
+		case code < 0 || code >= 128:
+			return fmt.Errorf("bisect run stopped: '%s' exited with code %d on %s", args[0], code, shortCommitHash(head))
+		}
+		if err := markBisectState(state, mark, []string{head}); err != nil {
+			return err
+		}
+		if err := state.Save(repo); err != nil {
+			return err
+		}
+		if err := bisect.AppendLog(repo, fmt.Sprintf("vec bisect %s %s", mark, head)); err != nil {
+			return err
+		}
+		done, err := bisectNextRepo(repo, state)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// resolveBisectRevs resolves revisions to commits
+func resolveBisectRevs(repo *core.Repository, revs []string) ([]string, error) {
+	hashes := make([]string, len(revs))
+	for i, rev := range revs {
+		hash, err := repo.ResolveRevision(rev)
+		if err != nil {
+			return nil, core.RefError(fmt.Sprintf("unknown revision '%s'", rev), err)
+		}
+		hashes[i] = hash
+	}
+	return hashes, nil
+}
+
+func init() {
+	bisectCmd := &cobra.Command{
+		Use:   "bisect",
+		Short: "Find the commit that introduced a bug by binary search",
+		Long: `Find the commit that introduced a change, such as a bug, by binary search.
+
+Start with "vec bisect start", then mark a commit that has the bug as bad
+and one that doesn't as good. vec checks out a commit halfway between them;
+test it and mark it good or bad, or skip it when it can't be tested, until
+the first bad commit is found. "vec bisect reset" returns to the branch the
+bisection started from. The state is kept in .vec/BISECT_* files.
+
+"vec bisect run <command>" tests the commits automatically: the command is
+run on each, from the repository root, and its exit code marks the commit
+good (0), skipped (125) or bad (any other code below 128). Codes of 128 and
+above, such as from a signal, stop the run.
+
+Examples:
+  vec bisect start HEAD v1.0       # HEAD is bad and v1.0 good
+  vec bisect good                  # The checked out commit works
+  vec bisect bad                   # The checked out commit has the bug
+  vec bisect run make test         # Let the tests decide
+  vec bisect reset                 # Go back to where the bisection started`,
+	}
+
+	startCmd := NewRepoCommand("start [<bad> [<good>...]]", "Start bisecting", BisectStartHandler)
+	badCmd := NewRepoCommand("bad [<commit>]", "Mark a commit, HEAD by default, as bad", BisectBadHandler)
+	badCmd.Args = cobra.MaximumNArgs(1)
+	goodCmd := NewRepoCommand("good [<commit>...]", "Mark commits, HEAD by default, as good", BisectGoodHandler)
+	skipCmd := NewRepoCommand("skip [<commit>...]", "Mark commits, HEAD by default, as untestable", BisectSkipHandler)
+	resetCmd := NewRepoCommand("reset [<commit>]", "End the bisection and return to where it started", BisectResetHandler)
+	resetCmd.Args = cobra.MaximumNArgs(1)
+	runCmd := NewRepoCommand("run <command> [<arg>...]", "Test commits with a command until the first bad one is found", BisectRunHandler)
+	runCmd.Args = cobra.MinimumNArgs(1)
+	runCmd.Flags().SetInterspersed(false) // Flags after the command are its own
+
+	bisectCmd.AddCommand(startCmd, badCmd, goodCmd, skipCmd, resetCmd, runCmd)
+	rootCmd.AddCommand(bisectCmd)
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/blame"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/spf13/cobra"
+)
+
+var blameLines string
+
+// BlameHandler shows the commit that last changed each line of a file
+func BlameHandler(repo *core.Repository, args []string) error {
+	rev, file := core.HeadFile, args[len(args)-1]
+	if len(args) == 2 {
+		rev = args[0]
+	}
+	commit, err := repo.ResolveRevision(rev)
+	if err != nil {
+		return core.RefError(fmt.Sprintf("unknown revision '%s'", rev), err)
+	}
+	path, err := repoRelativePath(repo, file)
+	if err != nil {
+		return err
+	}
+
+	var options blame.Options
+	if blameLines != "" {
+		if options, err = parseBlameRange(blameLines); err != nil {
+			return err
+		}
+	}
+	lines, err := blame.BlameRepo(repo, commit, path, options)
+	if err != nil {
+		return err
+	}
+
+	nameWidth, numberWidth := 0, 1
+	for _, line := range lines {
+		nameWidth = max(nameWidth, len(line.Commit.AuthorName()))
+		numberWidth = max(numberWidth, len(strconv.Itoa(line.Number)))
+	}
+	for _, line := range lines {
+		fmt.Printf("%s (%-*s %s %*d) %s\n", shortCommitHash(line.Commit.CommitID), nameWidth, line.Commit.AuthorName(),
+			objects.FormatDate(line.Commit.AuthorTime(), objects.DateShort), numberWidth, line.Number, line.Text)
+	}
+	return nil
+}
+
+// parseBlameRange reads -L as <start>,<end> or <start>,+<count>; either
+// side may be left out to mean the first or last line
+func parseBlameRange(value string) (blame.Options, error) {
+	invalid := fmt.Errorf("invalid -L range '%s' (expected <start>,<end> or <start>,+<count>)", value)
+	startText, endText, _ := strings.Cut(value, ",")
+	var options blame.Options
+	var err error
+	if startText != "" {
+		if options.Start, err = strconv.Atoi(startText); err != nil || options.Start < 1 {
+			return options, invalid
+		}
+	}
+	if count, ok := strings.CutPrefix(endText, "+"); ok {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 1 {
+			return options, invalid
+		}
+		options.End = max(options.Start, 1) + n - 1
+	} else if endText != "" {
+		if options.End, err = strconv.Atoi(endText); err != nil || options.End < max(options.Start, 1) {
+			return options, invalid
+		}
+	}
+	return options, nil
+}
+
+func init() {
+	blameCmd := NewRepoCommand(
+		"blame [-L <start>,<end>] [<revision>] [--] <file>",
+		"Show the commit that last changed each line of a file",
+		BlameHandler,
+	)
+	blameCmd.Long = `Show each line of a file as of the given revision, HEAD by default, with
+the short hash, author and date of the commit that introduced it.
+
+History is walked back from the revision, passing each line unchanged in a
+parent on to that parent, so after a merge a line is blamed on the commit
+that wrote it on either side. Renames are not followed: the lines of a file
+that was renamed are blamed on the commit that renamed it.
+
+-L limits the output to a range of lines, as <start>,<end> or
+<start>,+<count>.
+
+Examples:
+  vec blame main.go                 # Blame every line at HEAD
+  vec blame -L 10,20 main.go        # Only lines 10 to 20
+  vec blame -L 40,+5 v1.0 main.go   # Five lines from 40, as of v1.0`
+	blameCmd.Args = cobra.RangeArgs(1, 2)
+	blameCmd.Flags().StringVarP(&blameLines, "lines", "L", "", "Only blame the lines <start>,<end> or <start>,+<count>")
+
+	rootCmd.AddCommand(blameCmd)
+}
@@ -4,6 +4,8 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -17,16 +19,20 @@ func BranchHandler(repo *core.Repository, args []string) error {
 	// Retrieve the command through the closure in the factory function
 	cmd := branchCmd
 
-	// If no arguments, list branches.
-	if len(args) == 0 {
-		return listBranches(repo, cmd)
+	if editDescription, _ := cmd.Flags().GetBool("edit-description"); editDescription {
+		return editBranchDescription(repo, args)
 	}
 
-	// If there is flag but no other arguments, return error
+	// If no arguments, list branches; with --list, the arguments are patterns
 	list, _ := cmd.Flags().GetBool("list")
+	if len(args) == 0 || list {
+		return listBranches(repo, cmd, args)
+	}
+
+	// If there is flag but no other arguments, return error
 	deleteBranch, _ := cmd.Flags().GetString("delete")
 	renameBranch, _ := cmd.Flags().GetString("rename")
-	if list || deleteBranch != "" || renameBranch != "" {
+	if deleteBranch != "" || renameBranch != "" {
 		return core.RepositoryError("no argument for the defined flag", nil)
 	}
 
@@ -34,8 +40,9 @@ func BranchHandler(repo *core.Repository, args []string) error {
 	return CreateBranch(repo, args[0])
 }
 
-// listBranches lists all branches or performs branch operations based on flags
-func listBranches(repo *core.Repository, cmd *cobra.Command) error {
+// listBranches lists the branches matching patterns (all if none) or
+// performs branch operations based on flags
+func listBranches(repo *core.Repository, cmd *cobra.Command, patterns []string) error {
 	// Get flag values
 	deleteBranch, _ := cmd.Flags().GetString("delete")
 	renameBranch, _ := cmd.Flags().GetString("rename")
@@ -54,27 +61,7 @@ func listBranches(repo *core.Repository, cmd *cobra.Command) error {
 			return err
 		}
 	} else { // List branches (default behavior)
-		branchDir := filepath.Join(repo.RefsDir, "heads")
-		entries, err := os.ReadDir(branchDir)
-		if err != nil {
-			return core.RefError("failed to read branch directory", err)
-		}
-
-		currentBranch, err := repo.GetCurrentBranch()
-		if err != nil {
-			return err
-		}
-
-		for _, entry := range entries {
-			if entry.IsDir() {
-				continue // Skip subdirectories.
-			}
-			if entry.Name() == currentBranch {
-				fmt.Printf("* %s\n", entry.Name()) // Mark the current branch.
-			} else {
-				fmt.Println(" ", entry.Name())
-			}
-		}
+		return listBranchRefs(repo, cmd, patterns)
 	}
 
 	return nil
@@ -132,15 +119,15 @@ func deleteBranchOp(repo *core.Repository, branchName string, force bool) error
 		return core.RepositoryError(fmt.Sprintf("cannot delete the currently checked-out branch '%s'", branchName), nil)
 	}
 
+	// Get the commit hash that the branch points to
+	branchCommitBytes, err := core.ReadFileContent(branchPath)
+	if err != nil {
+		return core.RefError("failed to read branch file", err)
+	}
+	branchCommit := strings.TrimSpace(string(branchCommitBytes))
+
 	// Check if the branch is fully merged
 	if !force {
-		// Get the commit hash that the branch points to
-		branchCommitBytes, err := core.ReadFileContent(branchPath)
-		if err != nil {
-			return core.RefError("failed to read branch file", err)
-		}
-		branchCommit := strings.TrimSpace(string(branchCommitBytes))
-
 		// Get the commit hash of the current branch
 		currentCommit, err := repo.ReadHead()
 		if err != nil {
@@ -158,11 +145,22 @@ func deleteBranchOp(repo *core.Repository, branchName string, force bool) error
 		}
 	}
 
+	// Keep a recovery path: refs/original/ and the undo journal remember the tip
+	refName := "refs/heads/" + branchName
+	message := fmt.Sprintf("branch: deleted %s", branchName)
+	if err := repo.BackupRef(refName, branchCommit, message); err != nil {
+		return err
+	}
+
 	// Delete the branch file
 	if err := os.Remove(branchPath); err != nil {
 		return core.RefError(fmt.Sprintf("failed to delete the branch '%s'", branchName), err)
 	}
-	return nil
+	core.RecordAudit(repo.Root, core.AuditRefDelete, refName, branchCommit, "")
+	if err := repo.RecordRefMove(refName, branchCommit, "", message); err != nil {
+		return err
+	}
+	return repo.SetBranchDescription(branchName, "")
 }
 
 // renameBranchOp renames a branch
@@ -189,40 +187,211 @@ func renameBranchOp(repo *core.Repository, oldName, newName string) error {
 	if err := os.Rename(oldBranchPath, newBranchPath); err != nil {
 		return core.RefError(fmt.Sprintf("failed to rename branch '%s' to '%s'", oldName, newName), err)
 	}
-	return nil
+
+	// The description follows the branch
+	description, err := repo.GetBranchDescription(oldName)
+	if err != nil || description == "" {
+		return err
+	}
+	if err := repo.SetBranchDescription(newName, description); err != nil {
+		return err
+	}
+	return repo.SetBranchDescription(oldName, "")
+}
+
+// editBranchDescription opens the description of the named branch, or the
+// current one, in $EDITOR and stores the result in branch.<name>.description
+func editBranchDescription(repo *core.Repository, args []string) error {
+	if len(args) > 1 {
+		return core.RepositoryError("--edit-description takes at most one branch", nil)
+	}
+	branchName := ""
+	if len(args) == 1 {
+		branchName = args[0]
+	} else {
+		current, err := repo.GetCurrentBranch()
+		if err != nil {
+			return err
+		}
+		branchName = current
+	}
+	if !core.FileExists(filepath.Join(repo.RefsDir, "heads", branchName)) {
+		return core.NotFoundError(core.ErrCategoryRef, fmt.Sprintf("branch '%s'", branchName))
+	}
+
+	description, err := repo.GetBranchDescription(branchName)
+	if err != nil {
+		return err
+	}
+
+	file, err := core.CreateTempFile(repo.Root, "BRANCH_DESCRIPTION", "")
+	if err != nil {
+		return err
+	}
+	defer core.RemoveTempFile(file.Name())
+	template := fmt.Sprintf("%s\n# Please edit the description for the branch\n#   %s\n# Lines starting with '#' will be stripped.\n",
+		description, branchName)
+	_, err = file.WriteString(template)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write description template: %w", err)
+	}
+
+	editor, err := core.ResolveEditor(repo.Root)
+	if err != nil {
+		return err
+	}
+	execCmd := exec.Command(editor.Value, file.Name())
+	execCmd.Stdin = os.Stdin
+	execCmd.Stdout = os.Stdout
+	execCmd.Stderr = os.Stderr
+	if err := execCmd.Run(); err != nil {
+		return fmt.Errorf("editor failed: %w", err)
+	}
+
+	edited, err := os.ReadFile(file.Name())
+	if err != nil {
+		return fmt.Errorf("failed to read edited description: %w", err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(edited), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, strings.TrimRight(line, " \t\r"))
+		}
+	}
+	return repo.SetBranchDescription(branchName, strings.Join(lines, "\n"))
 }
 
 // isAncestor checks if potentialAncestor is an ancestor of potentialDescendant
 // Returns true if potentialAncestor is an ancestor of potentialDescendant, false otherwise
 func isAncestor(repo *core.Repository, potentialAncestor, potentialDescendant string) (bool, error) {
-	// If they're the same commit, return true
-	if potentialAncestor == potentialDescendant {
-		return true, nil
+	isAnc, err := objects.IsAncestorRepo(repo, potentialAncestor, potentialDescendant)
+	if err != nil {
+		return false, core.ObjectError("failed to walk commit history", err)
 	}
+	return isAnc, nil
+}
 
-	// Get the descendant commit
-	commit, err := objects.GetCommit(repo.Root, potentialDescendant)
+// newContainsFilter returns a test for ref tips that contain the commit named
+// by contains and don't contain the one named by noContains, or nil when
+// both are empty. Each query shares one memoized history walk across refs.
+func newContainsFilter(repo *core.Repository, contains, noContains string) (func(commit string) (bool, error), error) {
+	if contains == "" && noContains == "" {
+		return nil, nil
+	}
+	query := func(rev string) (*objects.ContainsQuery, error) {
+		if rev == "" {
+			return nil, nil
+		}
+		commit, err := repo.ResolveRevision(rev)
+		if err != nil {
+			return nil, err
+		}
+		return objects.NewContainsQueryRepo(repo, commit), nil
+	}
+	want, err := query(contains)
+	if err != nil {
+		return nil, err
+	}
+	reject, err := query(noContains)
 	if err != nil {
-		return false, core.ObjectError("failed to get descendant commit", err)
+		return nil, err
 	}
 
-	// Check if any parent of the descendant is the potential ancestor
-	for _, parent := range commit.Parents {
-		if parent == potentialAncestor {
-			return true, nil
+	return func(commit string) (bool, error) {
+		if commit == "" {
+			return false, nil
 		}
+		if want != nil {
+			ok, err := want.Contains(commit)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		if reject != nil {
+			found, err := reject.Contains(commit)
+			if err != nil || found {
+				return false, err
+			}
+		}
+		return true, nil
+	}, nil
+}
 
-		// Recursively check the parent's ancestors
-		isAnc, err := isAncestor(repo, potentialAncestor, parent)
-		if err != nil {
-			return false, err
+// matchBranchPattern reports whether the branch, given by its short name,
+// matches one of the --list patterns (every branch if there are none)
+func matchBranchPattern(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
 		}
-		if isAnc {
-			return true, nil
+	}
+	return false
+}
+
+// listBranchRefs prints the branches matching patterns, filtered by
+// --contains and --no-contains, ordered by --sort and formatted with
+// --format like for-each-ref
+func listBranchRefs(repo *core.Repository, cmd *cobra.Command, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid branch pattern '%s': %w", pattern, err)
 		}
 	}
+	refs, err := loadRefInfos(repo, []string{"refs/heads"})
+	if err != nil {
+		return core.RefError("failed to list branches", err)
+	}
 
-	return false, nil
+	contains, _ := cmd.Flags().GetString("contains")
+	noContains, _ := cmd.Flags().GetString("no-contains")
+	keep, err := newContainsFilter(repo, contains, noContains)
+	if err != nil {
+		return err
+	}
+	matched := refs[:0]
+	for _, ref := range refs {
+		if !matchBranchPattern(shortenRefName(ref.ref.Name), patterns) {
+			continue
+		}
+		if keep != nil {
+			if ok, err := keep(ref.ref.Hash); err != nil {
+				return err
+			} else if !ok {
+				continue
+			}
+		}
+		matched = append(matched, ref)
+	}
+
+	keys, _ := cmd.Flags().GetStringArray("sort")
+	if len(keys) == 0 {
+		keys = []string{"refname"}
+	}
+	if err := sortRefs(matched, keys); err != nil {
+		return err
+	}
+
+	format, _ := cmd.Flags().GetString("format")
+	for _, ref := range matched {
+		if format != "" {
+			line, err := expandRefFormat(format, ref)
+			if err != nil {
+				return err
+			}
+			fmt.Println(line)
+		} else if ref.ref.Name == ref.head {
+			fmt.Printf("* %s\n", shortenRefName(ref.ref.Name)) // Mark the current branch.
+		} else {
+			fmt.Println(" ", shortenRefName(ref.ref.Name))
+		}
+	}
+	return nil
 }
 
 // Store the command reference for use by the handler
@@ -235,12 +404,25 @@ func init() {
 		"List, create, or delete branches",
 		BranchHandler,
 	)
+	branchCmd.Long = `List, create, or delete branches.
+
+With --list, only the branches whose names match one of the given glob
+patterns are listed. --sort and --format take the same fields as
+for-each-ref; the default order is by refname.
+
+Example:
+  vec branch --list 'feature/*' --sort=-committerdate --format='%(refname:short) %(upstream:track)'`
 
 	// Add flags
-	branchCmd.Flags().BoolP("list", "l", false, "List branches")
+	branchCmd.Flags().BoolP("list", "l", false, "List branches, only those matching the given patterns if any")
 	branchCmd.Flags().StringP("delete", "d", "", "Delete a branch")
 	branchCmd.Flags().BoolP("force", "f", false, "Force delete a branch even if not merged")
 	branchCmd.Flags().StringP("rename", "m", "", "Rename a branch with format 'oldname newname'")
+	branchCmd.Flags().String("contains", "", "Only list branches whose history contains the commit")
+	branchCmd.Flags().String("no-contains", "", "Only list branches whose history doesn't contain the commit")
+	branchCmd.Flags().StringArray("sort", nil, "Sort the listed branches by a field such as refname, committerdate or authordate, '-' prefix for descending; repeat for secondary keys (last is primary)")
+	branchCmd.Flags().String("format", "", "Print the listed branches with a for-each-ref format template, e.g. '%(refname:short) %(upstream:track)'")
+	branchCmd.Flags().Bool("edit-description", false, "Edit the description of a branch (default: current) in $EDITOR")
 
 	rootCmd.AddCommand(branchCmd)
 }
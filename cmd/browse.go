@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/browse"
+	"github.com/spf13/cobra"
+)
+
+var (
+	browsePort int
+	browseBind string
+)
+
+// BrowseHandler serves the repository history as HTML until interrupted
+func BrowseHandler(repo *core.Repository, args []string) error {
+	srv, err := browse.NewServer(repo)
+	if err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(browseBind, strconv.Itoa(browsePort))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	server := &http.Server{
+		Handler:           srv.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      time.Minute,
+	}
+	fmt.Printf("Browsing %s at http://%s/ (Ctrl-C to stop)\n", repo.Root, listener.Addr())
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("browse server failed: %w", err)
+	}
+	return nil
+}
+
+var browseCmd *cobra.Command
+
+func init() {
+	browseCmd = NewRepoCommand(
+		"browse [--port <port>] [--bind <address>]",
+		"Browse the repository history in a web browser",
+		BrowseHandler,
+	)
+	browseCmd.Long = `Start a local HTTP server rendering the repository as HTML: the log of
+each branch, commits with their diffs, file trees at any commit, and blame.
+Pages are read straight from the object store, so the working tree and
+index are never consulted, and nothing is ever written.
+
+The server listens on 127.0.0.1 by default; use --bind to expose it on
+another address. --port 0 picks a free port.
+
+Examples:
+  vec browse                    # Serve on http://127.0.0.1:1234/
+  vec browse --port 8080        # Serve on another port`
+
+	browseCmd.Flags().IntVar(&browsePort, "port", 1234, "Port to listen on")
+	browseCmd.Flags().StringVar(&browseBind, "bind", "127.0.0.1", "Address to listen on")
+
+	rootCmd.AddCommand(browseCmd)
+}
@@ -3,9 +3,9 @@ package cmd
 import (
 	"bytes"
 	"fmt"
-	"os"
 	"strings"
 
+	"github.com/NahomAnteneh/vec/core"
 	"github.com/NahomAnteneh/vec/internal/objects"
 	"github.com/NahomAnteneh/vec/utils"
 	"github.com/spf13/cobra"
@@ -65,7 +65,7 @@ func catFilePrettyPrint(repoRoot, objectHash string) error {
 	}
 
 	// Read object content
-	objectContent, err := os.ReadFile(objectPath)
+	objectContent, err := core.ReadObjectFile(repoRoot, objectPath)
 	if err != nil {
 		return fmt.Errorf("failed to read object file: %w", err)
 	}
@@ -108,6 +108,9 @@ func catFilePrettyPrint(repoRoot, objectHash string) error {
 			return fmt.Errorf("failed to get commit: %w", err)
 		}
 		printCommit(commit)
+	case "tag":
+		// Tag objects are text already
+		fmt.Print(string(content))
 	default:
 		return fmt.Errorf("invalid object type: %s", objectType)
 	}
@@ -122,7 +125,7 @@ func catFileType(repoRoot, objectHash string) error {
 	}
 
 	// Read object content
-	objectContent, err := os.ReadFile(objectPath)
+	objectContent, err := core.ReadObjectFile(repoRoot, objectPath)
 	if err != nil {
 		return fmt.Errorf("failed to read object file: %w", err)
 	}
@@ -144,7 +147,7 @@ func catFileSize(repoRoot, objectHash string) error {
 	}
 
 	// Read object content
-	objectContent, err := os.ReadFile(objectPath)
+	objectContent, err := core.ReadObjectFile(repoRoot, objectPath)
 	if err != nil {
 		return fmt.Errorf("failed to read object file: %w", err)
 	}
@@ -184,8 +187,8 @@ func printCommit(commit *objects.Commit) {
 	for _, parent := range commit.Parents {
 		fmt.Printf("parent:    %s\n", parent)
 	}
-	fmt.Printf("author:    %s %d\n", commit.Author, commit.Timestamp)
-	fmt.Printf("commiter:  %s %d\n", commit.Committer, commit.Timestamp)
+	fmt.Printf("author:    %s %s\n", commit.Author, objects.FormatDate(commit.AuthorTime(), objects.DateRaw))
+	fmt.Printf("commiter:  %s %s\n", commit.Committer, objects.FormatDate(commit.CommitterTime(), objects.DateRaw))
 	fmt.Println() // Extra newline before message
 	fmt.Println(commit.Message)
 }
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkAttrAll     bool
+	checkAttrVerbose bool
+)
+
+// repoRelativePath converts a path given on the command line to a path
+// relative to the repository root
+func repoRelativePath(repo *core.Repository, arg string) (string, error) {
+	absPath, err := filepath.Abs(arg)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path '%s': %w", arg, err)
+	}
+	relPath, err := filepath.Rel(repo.Root, absPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", core.RepositoryError(fmt.Sprintf("'%s' is outside repository", arg), err)
+	}
+	return filepath.ToSlash(relPath), nil
+}
+
+// printAttribute prints one "<path>: <attr>: <value>" line
+func printAttribute(path string, attr core.Attribute) {
+	if checkAttrVerbose && attr.Source != "" {
+		fmt.Printf("%s: %s: %s\t(%s:%d: %s)\n", path, attr.Name, attr.Value, attr.Source, attr.Line, attr.Pattern)
+		return
+	}
+	fmt.Printf("%s: %s: %s\n", path, attr.Name, attr.Value)
+}
+
+// CheckAttrHandler prints the attributes that apply to each path
+func CheckAttrHandler(repo *core.Repository, args []string) error {
+	// Attributes come before "--" and paths after it. Without "--" the
+	// first argument is the attribute; with --all every argument is a path.
+	var names, paths []string
+	switch dash := checkAttrCmd.ArgsLenAtDash(); {
+	case checkAttrAll:
+		if dash > 0 {
+			return core.RepositoryError("--all takes no attribute names", nil)
+		}
+		paths = args
+	case dash >= 0:
+		names, paths = args[:dash], args[dash:]
+	case len(args) > 0:
+		names, paths = args[:1], args[1:]
+	}
+	if !checkAttrAll && len(names) == 0 {
+		return core.RepositoryError("no attribute specified", nil)
+	}
+	if len(paths) == 0 {
+		return core.RepositoryError("no path specified", nil)
+	}
+
+	for _, arg := range paths {
+		relPath, err := repoRelativePath(repo, arg)
+		if err != nil {
+			return err
+		}
+		attrs, err := repo.GetAttributes(relPath)
+		if err != nil {
+			return err
+		}
+
+		if checkAttrAll {
+			sorted := make([]string, 0, len(attrs))
+			for name := range attrs {
+				sorted = append(sorted, name)
+			}
+			sort.Strings(sorted)
+			for _, name := range sorted {
+				printAttribute(arg, attrs[name])
+			}
+			continue
+		}
+		for _, name := range names {
+			attr, ok := attrs[name]
+			if !ok {
+				attr = core.Attribute{Name: name, Value: core.AttrUnspecified}
+			}
+			printAttribute(arg, attr)
+		}
+	}
+	return nil
+}
+
+var checkAttrCmd *cobra.Command
+
+func init() {
+	checkAttrCmd = NewRepoCommand(
+		"check-attr <attr>... -- <path>...",
+		"Show the attributes that apply to paths",
+		CheckAttrHandler,
+	)
+	checkAttrCmd.Long = `Print the value of attributes from .vecattributes for each path, as
+"<path>: <attr>: <value>". A value is "set", "unset", "unspecified" or the
+string given with attr=value. Later lines of .vecattributes override earlier
+ones, and the binary macro expands to -diff -merge -text.
+
+Examples:
+  vec check-attr diff -- image.png        # One attribute, one path
+  vec check-attr diff merge -- a.txt b.c  # Several attributes and paths
+  vec check-attr -a -v image.png          # Every attribute and the line setting it`
+
+	checkAttrCmd.Flags().BoolVarP(&checkAttrAll, "all", "a", false, "Show every attribute set on the paths")
+	checkAttrCmd.Flags().BoolVarP(&checkAttrVerbose, "verbose", "v", false, "Show the file, line and pattern each value comes from")
+
+	rootCmd.AddCommand(checkAttrCmd)
+}
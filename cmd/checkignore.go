@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkIgnoreVerbose     bool
+	checkIgnoreNonMatching bool
+	checkIgnoreQuiet       bool
+)
+
+// CheckIgnoreHandler reports which paths are ignored and by which rule
+func CheckIgnoreHandler(repo *core.Repository, args []string) error {
+	if len(args) == 0 {
+		return core.RepositoryError("no path specified", nil)
+	}
+	if checkIgnoreNonMatching && !checkIgnoreVerbose {
+		return core.RepositoryError("--non-matching is only valid with --verbose", nil)
+	}
+
+	ignored := 0
+	for _, arg := range args {
+		if _, err := repoRelativePath(repo, arg); err != nil {
+			return err
+		}
+		rule, err := core.MatchIgnoreRule(repo.Root, arg)
+		if err != nil {
+			return err
+		}
+		if rule != nil {
+			ignored++
+		}
+		if checkIgnoreQuiet {
+			continue
+		}
+
+		switch {
+		case rule != nil && checkIgnoreVerbose:
+			fmt.Printf("%s:%d:%s\t%s\n", rule.Source, rule.Line, rule.Pattern, arg)
+		case rule != nil:
+			fmt.Println(arg)
+		case checkIgnoreNonMatching:
+			fmt.Printf("::\t%s\n", arg)
+		}
+	}
+
+	if ignored == 0 {
+		return core.NotFoundError(core.ErrCategoryRepository, "ignored paths")
+	}
+	return nil
+}
+
+var checkIgnoreCmd *cobra.Command
+
+func init() {
+	checkIgnoreCmd = NewRepoCommand(
+		"check-ignore <path>...",
+		"Show which paths are ignored and why",
+		CheckIgnoreHandler,
+	)
+	checkIgnoreCmd.Long = `Print each given path that is ignored. With --verbose each line also names
+the rule responsible as "<source>:<line>:<pattern>", and with --non-matching
+paths that are not ignored are listed too, with empty rule fields. The
+command fails when none of the paths are ignored.
+
+Rules are read from .vecignore, then .vec/info/exclude (not versioned), then
+the global excludes file (core.excludesFile, default ~/.config/vec/ignore);
+the first matching rule wins.
+
+Examples:
+  vec check-ignore build/out.o
+  vec check-ignore -v build/out.o src/main.go
+  vec check-ignore -q tmp.log && echo ignored`
+
+	checkIgnoreCmd.Flags().BoolVarP(&checkIgnoreVerbose, "verbose", "v", false, "Show the matching rule for each path")
+	checkIgnoreCmd.Flags().BoolVarP(&checkIgnoreNonMatching, "non-matching", "n", false, "Also show paths that are not ignored (with --verbose)")
+	checkIgnoreCmd.Flags().BoolVarP(&checkIgnoreQuiet, "quiet", "q", false, "Print nothing; only report whether any path is ignored")
+
+	rootCmd.AddCommand(checkIgnoreCmd)
+}
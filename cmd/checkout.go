@@ -19,11 +19,28 @@ import (
 var (
 	createBranch  bool
 	forceCheckout bool
+
+	checkoutCmd *cobra.Command
 )
 
 // CheckoutHandler handles the checkout command logic using the repository context
 func CheckoutHandler(repo *core.Repository, args []string) error {
-	return checkoutRepo(repo, args[0])
+	// Paths come after "--"; without it a second argument is a path too
+	dash := checkoutCmd.ArgsLenAtDash()
+	if dash < 0 && len(args) == 1 {
+		return checkoutRepo(repo, args[0])
+	}
+	switch {
+	case dash == 0:
+		return core.RepositoryError("checkout -- <paths> needs a branch or commit to take them from; use vec restore to discard local changes", nil)
+	case dash > 1:
+		return core.RepositoryError("only one branch or commit can be checked out", nil)
+	case len(args) == 1:
+		return core.RepositoryError("no paths given after --", nil)
+	case createBranch:
+		return core.RepositoryError("-b cannot be used when checking out paths", nil)
+	}
+	return checkoutPathsRepo(repo, args[0], args[1:])
 }
 
 // checkoutRepo switches the working directory and index to the specified branch or commit.
@@ -36,11 +53,10 @@ func checkoutRepo(repo *core.Repository, target string) error {
 		return core.IndexError("failed to load index", err)
 	}
 	if !index.IsClean(repo) && !forceCheckout {
-		return core.RepositoryError("your local changes would be overwritten by checkout; please commit or stash them first (or use --force to discard changes)", nil)
+		return core.RepositoryError("your local changes would be overwritten by checkout; please commit them or save them with 'vec stash' first (or use --force to discard changes)", nil)
 	}
 
 	branchPath := filepath.Join(repo.VecDir, "refs", "heads", target)
-	headFile := filepath.Join(repo.VecDir, "HEAD")
 	var targetCommitID string
 	var isBranch bool
 
@@ -50,7 +66,7 @@ func checkoutRepo(repo *core.Repository, target string) error {
 			return core.RefError(fmt.Sprintf("failed to create branch '%s'", target), err)
 		}
 		// Update HEAD to reference the new branch.
-		if err := os.WriteFile(headFile, []byte("ref: refs/heads/"+target), 0644); err != nil {
+		if err := repo.UpdateHead("refs/heads/"+target, true); err != nil {
 			return core.RefError(fmt.Sprintf("failed to update HEAD to branch '%s'", target), err)
 		}
 		// Get the current commit (the branch is created at current HEAD).
@@ -71,7 +87,7 @@ func checkoutRepo(repo *core.Repository, target string) error {
 			}
 			targetCommitID = strings.TrimSpace(string(commitIDBytes))
 			// Update HEAD to reference the branch.
-			if err := os.WriteFile(headFile, []byte("ref: refs/heads/"+target), 0644); err != nil {
+			if err := repo.UpdateHead("refs/heads/"+target, true); err != nil {
 				return core.RefError(fmt.Sprintf("failed to update HEAD to branch '%s'", target), err)
 			}
 		} else {
@@ -100,7 +116,7 @@ func checkoutRepo(repo *core.Repository, target string) error {
 
 				targetCommitID = fullHash
 				// Update HEAD to point directly to the commit (detached state)
-				if err := os.WriteFile(headFile, []byte(targetCommitID), 0644); err != nil {
+				if err := repo.UpdateHead(targetCommitID, false); err != nil {
 					return core.RefError(fmt.Sprintf("failed to update HEAD to commit '%s'", target), err)
 				}
 			} else {
@@ -148,6 +164,110 @@ func checkoutRepo(repo *core.Repository, target string) error {
 	return nil
 }
 
+// checkoutPathsRepo copies the files under paths in source into the working
+// tree and stages them, resolving any conflicts on them; HEAD stays where it
+// is. Local changes the copy would lose are confirmed first unless --force.
+func checkoutPathsRepo(repo *core.Repository, source string, paths []string) error {
+	commitID, err := repo.ResolveRevision(source)
+	if err != nil {
+		return core.RefError(fmt.Sprintf("unknown revision '%s'", source), err)
+	}
+	commit, err := objects.GetCommitRepo(repo, commitID)
+	if err != nil {
+		return core.ObjectError(fmt.Sprintf("'%s' is not a commit", source), err)
+	}
+	sourceFiles, err := staging.IndexFromTreeRepo(repo, commit.Tree)
+	if err != nil {
+		return core.ObjectError(fmt.Sprintf("failed to read tree of %s", source), err)
+	}
+	index, err := staging.LoadIndex(repo)
+	if err != nil {
+		return core.IndexError("failed to load index", err)
+	}
+
+	var selected []staging.IndexEntry
+	seen := make(map[string]bool)
+	for _, arg := range paths {
+		relPath, err := repoRelativePath(repo, arg)
+		if err != nil {
+			return err
+		}
+		matched := false
+		for _, entry := range sourceFiles.Entries {
+			filePath := filepath.ToSlash(entry.FilePath)
+			if relPath != "." && filePath != relPath && !strings.HasPrefix(filePath, relPath+"/") {
+				continue
+			}
+			matched = true
+			if !seen[entry.FilePath] {
+				seen[entry.FilePath] = true
+				selected = append(selected, entry)
+			}
+		}
+		if !matched {
+			return core.RepositoryError(fmt.Sprintf("pathspec '%s' did not match any file in '%s'", arg, source), nil)
+		}
+	}
+
+	// A file is lost when its content is neither the source's nor staged,
+	// as for unstaged edits, untracked files and unresolved conflicts
+	var modified []string
+	for _, entry := range selected {
+		content, err := os.ReadFile(filepath.Join(repo.Root, entry.FilePath))
+		if err != nil {
+			continue
+		}
+		hash := utils.HashBytes("blob", content)
+		if hash == entry.SHA256 {
+			continue
+		}
+		if staged, ok := index.GetEntry(entry.FilePath, 0); !ok || staged.SHA256 != hash {
+			modified = append(modified, entry.FilePath)
+		}
+	}
+	if len(modified) > 0 && !forceCheckout {
+		fmt.Printf("Local changes to %d file%s would be overwritten by checkout:\n", len(modified), plural(len(modified)))
+		for _, relPath := range modified {
+			fmt.Printf("  %s\n", relPath)
+		}
+		fmt.Printf("Overwrite them? [y/N] ")
+		var response string
+		fmt.Scanln(&response)
+		if strings.ToLower(response) != "y" && strings.ToLower(response) != "yes" {
+			return core.RepositoryError("checkout canceled; commit or stash your changes first (or use --force to overwrite them)", nil)
+		}
+	}
+
+	perms, err := repo.Permissions()
+	if err != nil {
+		return err
+	}
+	for _, entry := range selected {
+		absPath := filepath.Join(repo.Root, entry.FilePath)
+		if err := perms.MkdirAll(filepath.Dir(absPath)); err != nil {
+			return core.FSError(fmt.Sprintf("failed to create directory for %s", entry.FilePath), err)
+		}
+		if err := objects.WriteBlobFileRepo(repo, entry.SHA256, absPath, entry.Mode == objects.ModeExecutable); err != nil {
+			return core.FSError(fmt.Sprintf("failed to write file %s", entry.FilePath), err)
+		}
+		info, err := os.Stat(absPath)
+		if err != nil {
+			return core.FSError(fmt.Sprintf("failed to stat '%s'", entry.FilePath), err)
+		}
+		for stage := 1; stage <= 3; stage++ {
+			index.RemoveEntry(entry.FilePath, stage)
+		}
+		entry.Size, entry.Mtime = info.Size(), info.ModTime()
+		index.AddEntry(entry)
+	}
+	if err := index.Write(); err != nil {
+		return core.FSError("failed to write index", err)
+	}
+
+	fmt.Printf("Updated %d path%s from %s\n", len(selected), plural(len(selected)), shortCommitHash(commitID))
+	return nil
+}
+
 
 
 // updateWorkingDirectory updates the working directory to match the given tree using Repository context
@@ -156,29 +276,50 @@ func updateWorkingDirectory(repo *core.Repository, tree *objects.TreeObject, bas
 	if err != nil {
 		return fmt.Errorf("failed to scan working directory: %w", err)
 	}
+	perms, err := repo.Permissions()
+	if err != nil {
+		return err
+	}
 
 	treeFiles := make(map[string]objects.TreeEntry)
 	collectTreeEntries(repo, tree, basePath, treeFiles)
 
+	// Existing files are matched by folded, NFC path under core.ignoreCase
+	// and core.precomposeUnicode, so a file spelled differently in the tree
+	// isn't removed after being written
+	ignoreCase, precompose := repo.IgnoreCase(), repo.PrecomposeUnicode()
+	fileKey := func(relPath string) string {
+		return core.PathKey(core.NormalizePath(relPath, precompose), ignoreCase)
+	}
+	if ignoreCase {
+		var blobPaths []string
+		for relPath, entry := range treeFiles {
+			if entry.Type == "blob" {
+				blobPaths = append(blobPaths, relPath)
+			}
+		}
+		core.WarnCaseCollisions(os.Stderr, blobPaths)
+	}
+	staleFiles := make(map[string]string, len(currentFiles))
+	for relPath := range currentFiles {
+		staleFiles[fileKey(relPath)] = relPath
+	}
+
 	for relPath, entry := range treeFiles {
 		if entry.Type != "blob" {
 			continue
 		}
 		absPath := filepath.Join(repo.Root, relPath)
-		blobContent, err := objects.GetBlob(repo.Root, entry.Hash)
-		if err != nil {
-			return fmt.Errorf("failed to get blob %s: %w", entry.Hash, err)
-		}
-		if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+		if err := perms.MkdirAll(filepath.Dir(absPath)); err != nil {
 			return fmt.Errorf("failed to create directory for %s: %w", relPath, err)
 		}
-		if err := os.WriteFile(absPath, blobContent, 0644); err != nil {
+		if err := objects.WriteBlobFileRepo(repo, entry.Hash, absPath, entry.Mode == objects.ModeExecutable); err != nil {
 			return fmt.Errorf("failed to write file %s: %w", relPath, err)
 		}
-		delete(currentFiles, relPath)
+		delete(staleFiles, fileKey(relPath))
 	}
 
-	for relPath := range currentFiles {
+	for _, relPath := range staleFiles {
 		absPath := filepath.Join(repo.Root, relPath)
 		if err := os.RemoveAll(absPath); err != nil {
 			return fmt.Errorf("failed to remove file %s: %w", relPath, err)
@@ -196,6 +337,61 @@ func updateWorkingDirectory(repo *core.Repository, tree *objects.TreeObject, bas
 
 
 
+// checkoutTrackedFilesRepo makes the files tracked by index or in tree match
+// tree and writes tree as the index. Unlike updateWorkingDirectory it leaves
+// untracked files alone, as stash needs when clearing what it saved.
+func checkoutTrackedFilesRepo(repo *core.Repository, index *staging.Index, tree *objects.TreeObject) error {
+	treeFiles := make(map[string]objects.TreeEntry)
+	collectTreeEntries(repo, tree, "", treeFiles)
+
+	for _, entry := range index.Entries {
+		if _, ok := treeFiles[entry.FilePath]; ok {
+			continue
+		}
+		absPath := filepath.Join(repo.Root, entry.FilePath)
+		if err := os.Remove(absPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove file %s: %w", entry.FilePath, err)
+		}
+		// Drop directories the file leaves empty
+		for dir := filepath.Dir(absPath); dir != repo.Root && strings.HasPrefix(dir, repo.Root); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+
+	perms, err := repo.Permissions()
+	if err != nil {
+		return err
+	}
+	for relPath, entry := range treeFiles {
+		if entry.Type != "blob" {
+			continue
+		}
+		absPath := filepath.Join(repo.Root, relPath)
+		if content, err := os.ReadFile(absPath); err == nil && utils.HashBytes("blob", content) == entry.Hash {
+			continue
+		}
+		if err := perms.MkdirAll(filepath.Dir(absPath)); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", relPath, err)
+		}
+		if err := objects.WriteBlobFileRepo(repo, entry.Hash, absPath, entry.Mode == objects.ModeExecutable); err != nil {
+			return fmt.Errorf("failed to write file %s: %w", relPath, err)
+		}
+	}
+
+	newIndex, err := createIndexFromTree(repo, tree, "")
+	if err != nil {
+		return core.IndexError("failed to update index", err)
+	}
+	if err := newIndex.Write(); err != nil {
+		return core.FSError("failed to write index", err)
+	}
+	return nil
+}
+
+
+
 // getWorkingDirFiles scans the working directory and returns a map of files (excluding .vec directory)
 func getWorkingDirFiles(repo *core.Repository) (map[string]struct{}, error) {
 	files := make(map[string]struct{})
@@ -317,6 +513,10 @@ func removeExtraDirectories(repo *core.Repository, validDirs map[string]struct{}
 // createIndexFromTree creates a new index from a tree using Repository context
 func createIndexFromTree(repo *core.Repository, tree *objects.TreeObject, basePath string) (*staging.Index, error) {
 	index := staging.NewIndex(repo)
+	perms, err := repo.Permissions()
+	if err != nil {
+		return nil, err
+	}
 
 	// Collect all blob entries
 	entries := make(map[string]objects.TreeEntry)
@@ -328,15 +528,11 @@ func createIndexFromTree(repo *core.Repository, tree *objects.TreeObject, basePa
 			absPath := filepath.Join(repo.Root, path)
 			// If the file doesn't exist yet, we'll create it
 			if !utils.FileExists(absPath) {
-				blobContent, err := objects.GetBlob(repo.Root, entry.Hash)
-				if err != nil {
-					return nil, fmt.Errorf("failed to get blob %s: %w", entry.Hash, err)
-				}
 				dir := filepath.Dir(absPath)
-				if err := os.MkdirAll(dir, 0755); err != nil {
+				if err := perms.MkdirAll(dir); err != nil {
 					return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
 				}
-				if err := os.WriteFile(absPath, blobContent, 0644); err != nil {
+				if err := objects.WriteBlobFileRepo(repo, entry.Hash, absPath, entry.Mode == objects.ModeExecutable); err != nil {
 					return nil, fmt.Errorf("failed to write file %s: %w", path, err)
 				}
 			}
@@ -381,9 +577,9 @@ func updateReflogForCheckout(repo *core.Repository, prevCommitID, newCommitID, r
 	}
 	email := username + "@" + hostname
 
-	entry := fmt.Sprintf("%s %s %s <%s> %d +0000\t%s: %s\n",
+	entry := fmt.Sprintf("%s %s %s <%s> %s\t%s: %s\n",
 		prevCommitID, newCommitID, username, email,
-		now.Unix(), action, details)
+		objects.FormatDate(now, objects.DateRaw), action, details)
 
 	// Update HEAD reflog
 	if utils.FileExists(headReflogPath) {
@@ -436,8 +632,8 @@ func updateReflogForCheckout(repo *core.Repository, prevCommitID, newCommitID, r
 
 
 func init() {
-	checkoutCmd := NewRepoCommand(
-		"checkout <branch-or-commit>",
+	checkoutCmd = NewRepoCommand(
+		"checkout <branch-or-commit> [--] [<paths>...]",
 		"Switch branches or restore working tree files",
 		CheckoutHandler,
 	)
@@ -446,13 +642,20 @@ func init() {
 For branch operations, this updates the index and working tree to match
 the branch, and points HEAD at the branch head.
 
+With paths, the files under them are copied from the branch or commit into
+the working tree and the index instead, without moving HEAD; conflicts on
+them are resolved with that version. Unlike vec restore --source this also
+stages the files. You are asked before local changes not saved in the index
+are overwritten, unless --force is given.
+
 Examples:
   vec checkout main           # Switch to branch 'main'
   vec checkout -b feature     # Create and switch to branch 'feature'
   vec checkout e12f109        # Detach HEAD at commit e12f109
-  vec checkout --force main   # Discard local changes and checkout 'main'`
+  vec checkout --force main   # Discard local changes and checkout 'main'
+  vec checkout main -- docs   # Take the files under docs from 'main'`
 
-	checkoutCmd.Args = cobra.ExactArgs(1)
+	checkoutCmd.Args = cobra.MinimumNArgs(1)
 
 	checkoutCmd.Flags().BoolVarP(&createBranch, "create-branch", "b", false, "Create a new branch at the target and switch to it")
 	checkoutCmd.Flags().BoolVarP(&forceCheckout, "force", "f", false, "Force checkout (discard local changes)")
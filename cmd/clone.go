@@ -21,6 +21,7 @@ var (
 	cloneNoCheckout bool
 	cloneProgress   bool
 	cloneBareBool   bool
+	cloneDryRun     bool
 )
 
 // Note: Clone doesn't use the Repository context pattern because it creates a new repository
@@ -31,8 +32,16 @@ var cloneCmd = &cobra.Command{
 	Short: "Clone a repository into a new directory",
 	Long: `Clone a repository into a new directory.
 
-The repository can be a remote URL or a local path. If no directory 
-is specified, the repository name will be used as the target directory.
+The repository can be a remote URL, a file:// URL or a local path. If no
+directory is specified, the repository name will be used as the target
+directory.
+
+The new repository gets the source as its remote 'origin', with a
+remote-tracking branch for each of its branches. The default branch of the
+remote, or the one --branch names, is created locally, set to track its
+origin counterpart and checked out, unless --no-checkout is given. --depth
+limits the history fetched, as it does for fetch. A bare clone has no working
+tree: the branches of the remote become its own branches.
 
 Examples:
   vec clone https://example.com/repo.vec           # Clone to folder named "repo"
@@ -41,13 +50,15 @@ Examples:
   vec clone https://example.com/repo.vec --depth=1    # Shallow clone (only latest commit)
   vec clone https://example.com/repo.vec --bare       # Create a bare repository
   vec clone https://example.com/repo.vec --no-checkout # Don't checkout working tree
+  vec clone https://example.com/repo.vec --dry-run     # Show what would be cloned
+  vec clone ../repo copy                               # Clone a repository on this machine
 `,
 	Args: cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		url := args[0]
 
 		// Determine if URL needs normalization
-		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		if !strings.Contains(url, "://") {
 			// Check if it's a local path
 			if utils.FileExists(url) {
 				absPath, err := filepath.Abs(url)
@@ -91,6 +102,21 @@ Examples:
 			return core.RemoteError(fmt.Sprintf("invalid depth value: %d (must be >= 0)", cloneDepth), nil)
 		}
 
+		if cloneDryRun {
+			if err := remote.CloneWithOptions(remote.CloneOptions{
+				URL:        url,
+				DestPath:   destPath,
+				Branch:     cloneBranch,
+				Depth:      cloneDepth,
+				NoCheckout: cloneNoCheckout,
+				Bare:       cloneBareBool,
+				DryRun:     true,
+			}); err != nil {
+				return core.RemoteError("clone dry run failed", err)
+			}
+			return nil
+		}
+
 		// Show initial message
 		if !cloneQuiet {
 			fmt.Printf("Cloning into '%s'...\n", destPath)
@@ -114,6 +140,9 @@ Examples:
 		}); err != nil {
 			return core.RemoteError("clone failed", err)
 		}
+		if absDest, err := filepath.Abs(destPath); err == nil && !cloneBareBool {
+			core.RecordAudit(absDest, core.AuditClone, "origin", "", url)
+		}
 
 		// Show completion message with timing
 		if !cloneQuiet {
@@ -150,15 +179,17 @@ func init() {
 	cloneCmd.Flags().BoolVar(&cloneNoCheckout, "no-checkout", false, "Don't checkout HEAD after cloning")
 	cloneCmd.Flags().BoolVar(&cloneProgress, "progress", true, "Show progress during clone")
 	cloneCmd.Flags().BoolVar(&cloneBareBool, "bare", false, "Create a bare repository")
+	cloneCmd.Flags().BoolVar(&cloneDryRun, "dry-run", false, "Show what would be cloned without creating anything or contacting the network")
 }
 
 // extractRepoName derives a directory name from the remote URL
 func extractRepoName(remoteURL string) string {
 	// Handle URL schemes
 	url := remoteURL
-	for _, prefix := range []string{"http://", "https://", "ssh://", "git://"} {
+	for _, prefix := range []string{"http://", "https://", "ssh://", "git://", "file://"} {
 		url = strings.TrimPrefix(url, prefix)
 	}
+	url = strings.TrimSuffix(strings.TrimRight(url, "/"), "/"+core.VecDirName)
 
 	// Split on slashes and take the last part
 	parts := strings.Split(url, "/")
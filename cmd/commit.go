@@ -9,16 +9,53 @@ import (
 	"time"
 
 	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/merge"
 	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/secrets"
 	"github.com/NahomAnteneh/vec/internal/staging"
 	"github.com/spf13/cobra"
 )
 
+// commitNoVerify skips the pre-commit and commit-msg hooks
+var commitNoVerify bool
+
+// commitSign signs the commit with user.signingKey
+var commitSign bool
+
+// commitAmend replaces HEAD instead of adding a commit on top of it
+var commitAmend bool
+
 // commitCmd defines the "commit" command with its usage and flags.
 var commitCmd = &cobra.Command{
-	Use:   "commit",
+	Use:   "commit [--] [<path>...]",
 	Short: "Record changes to the repository",
-	Args:  cobra.NoArgs,
+	Long: `Record the staged changes in a new commit.
+
+With paths, only those paths are committed: their current working tree
+content is staged and committed on top of HEAD, while changes staged for
+other paths stay in the index for a later commit.
+
+The pre-commit and commit-msg hooks run unless --no-verify is given, as does
+the secret scan: the lines the commit adds are checked against built-in
+patterns of credentials such as cloud and API keys, tokens and private keys,
+plus any secrets.rule.<name> regexps. With secrets.entropy set, long tokens
+with more bits of entropy per character than it are reported too, and
+secrets.scanner names a command run on a copy of the staged files, which
+rejects the commit by exiting non-zero. Findings are let through by adding
+their fingerprint, rule:<name> or a path glob to .vecsecrets, or by marking
+the line with vec:allow-secret; secrets.scan=false turns the scan off.
+
+With -S the commit is signed with ssh-keygen using the key in user.signingKey.
+
+With --amend the commit replaces HEAD, on HEAD's parents and with HEAD's
+message unless -m is given. The author and author date are kept; the
+committer and commit date are those of the amend.
+
+Examples:
+  vec commit -m "Fix parser"                  # Commit everything staged
+  vec commit -m "Update docs" -- docs README  # Commit only docs/ and README
+  vec commit -n -m "WIP"                      # Skip the pre-commit and commit-msg hooks
+  vec commit --amend                          # Add the staged changes to HEAD`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Find the repository
 		repo, err := core.FindRepository()
@@ -27,36 +64,81 @@ var commitCmd = &cobra.Command{
 		}
 
 		message, _ := cmd.Flags().GetString("message")
-		return CommitHandler(repo, message)
+		return CommitHandler(repo, message, args)
 	},
 }
 
-// CommitHandler creates a new commit in the repository.
-func CommitHandler(repo *core.Repository, message string) error {
+// CommitHandler creates a new commit in the repository. With pathspecs only
+// the matching paths are committed.
+func CommitHandler(repo *core.Repository, message string, pathspecs []string) error {
 	// Load the index to check for staged changes
 	index, err := staging.LoadIndex(repo.Root)
 	if err != nil {
 		return fmt.Errorf("failed to load index: %w", err)
 	}
+	if index.HasConflicts() {
+		return fmt.Errorf("cannot commit with unresolved conflicts; fix them and mark them resolved with vec add")
+	}
 
-	// Verify there are changes to commit
-	if index.IsClean(repo.Root) {
+	// Verify there are changes to commit; an amend may only reword
+	if !commitAmend && len(pathspecs) == 0 && index.IsClean(repo.Root) {
 		return fmt.Errorf("nothing to commit, working tree clean")
 	}
 
-	// Retrieve author and committer info from config
-	authorName, err := repo.GetConfig("user.name")
-	if err != nil || authorName == "" {
-		return fmt.Errorf("author name not configured; set it with 'vec config user.name <n>'")
+	// The commit an amend replaces
+	var amended *objects.Commit
+	if commitAmend {
+		head, err := repo.ReadHead()
+		if err != nil {
+			return fmt.Errorf("failed to read HEAD: %w", err)
+		}
+		if head == "" {
+			return fmt.Errorf("nothing to amend: there are no commits yet")
+		}
+		if amended, err = objects.GetCommitRepo(repo, head); err != nil {
+			return fmt.Errorf("failed to load HEAD commit: %w", err)
+		}
+		if len(amended.StoredParents()) > 1 {
+			return fmt.Errorf("cannot amend a merge commit")
+		}
+		if message == "" {
+			message = amended.Message
+		}
+	}
+
+	// Retrieve author and committer info; VEC_AUTHOR_* and VEC_COMMITTER_*
+	// override user.name and user.email
+	authorName, authorEmail, err := core.ResolveIdentity(repo.Root, core.IdentityAuthor)
+	if err != nil {
+		return err
+	}
+	committerName, committerEmail, err := core.ResolveIdentity(repo.Root, core.IdentityCommitter)
+	if err != nil {
+		return err
 	}
 
-	authorEmail, err := repo.GetConfig("user.email")
-	if err != nil || authorEmail == "" {
-		return fmt.Errorf("author email not configured; set it with 'vec config user.email <email>'")
+	author := fmt.Sprintf("%s <%s>", authorName.Value, authorEmail.Value)
+	committer := fmt.Sprintf("%s <%s>", committerName.Value, committerEmail.Value)
+	hookEnv := map[string]string{"VEC_AUTHOR_NAME": authorName.Value, "VEC_AUTHOR_EMAIL": authorEmail.Value}
+
+	if !commitNoVerify {
+		if err := repo.RunHook(core.HookPreCommit, core.HookOptions{Env: hookEnv}); err != nil {
+			return fmt.Errorf("pre-commit hook declined the commit: %w", err)
+		}
+		// The hook may have staged changes
+		if index, err = staging.LoadIndex(repo); err != nil {
+			return fmt.Errorf("failed to load index: %w", err)
+		}
 	}
 
-	author := fmt.Sprintf("%s <%s>", authorName, authorEmail)
-	committer := author // For simplicity, assume committer is the same as author
+	// After merge --squash the prepared summary is the default message
+	squashMessage, err := merge.ReadSquashMessage(repo)
+	if err != nil {
+		return err
+	}
+	if message == "" {
+		message = squashMessage
+	}
 
 	// Prompt for commit message if not provided
 	if message == "" {
@@ -90,8 +172,14 @@ func CommitHandler(repo *core.Repository, message string) error {
 	}
 	message = strings.TrimSpace(message)
 
-	// Get current timestamp
-	timestamp := time.Now().Unix()
+	if !commitNoVerify {
+		if message, err = runCommitMsgHookRepo(repo, message, hookEnv); err != nil {
+			return err
+		}
+	}
+
+	// Zero means now, unless VEC_AUTHOR_DATE or VEC_COMMITTER_DATE is set
+	var timestamp int64
 
 	// Determine parent commit from HEAD
 	parent, err := repo.ReadHead()
@@ -100,18 +188,41 @@ func CommitHandler(repo *core.Repository, message string) error {
 	}
 
 	parents := []string{}
-	if parent != "" {
+	if amended != nil {
+		parents = append(parents, amended.StoredParents()...)
+	} else if parent != "" {
 		parents = append(parents, parent)
 	}
 
 	// Create tree object from the index
-	treeHash, err := staging.CreateTreeFromIndex(repo.Root, index)
-	if err != nil {
-		return fmt.Errorf("failed to create tree from index: %w", err)
+	var treeHash string
+	if len(pathspecs) > 0 {
+		treeHash, err = partialCommitTreeRepo(repo, index, parent, pathspecs)
+		if err != nil {
+			return err
+		}
+	} else {
+		treeHash, err = staging.CreateTreeFromIndex(repo.Root, index)
+		if err != nil {
+			return fmt.Errorf("failed to create tree from index: %w", err)
+		}
+	}
+
+	if !commitNoVerify && secrets.Enabled(repo) {
+		if err := scanCommitSecretsRepo(repo, parent, treeHash); err != nil {
+			return err
+		}
 	}
 
 	// Create the commit object
-	commitHash, err := objects.CreateCommit(repo.Root, treeHash, parents, author, committer, message, timestamp)
+	var commitHash string
+	if amended != nil {
+		commitHash, err = objects.RewriteCommitRepo(repo, amended, treeHash, parents, committer, message, commitSign)
+	} else if commitSign {
+		commitHash, err = objects.CreateSignedCommitRepo(repo, treeHash, parents, author, committer, message, timestamp)
+	} else {
+		commitHash, err = objects.CreateCommit(repo.Root, treeHash, parents, author, committer, message, timestamp)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create commit: %w", err)
 	}
@@ -136,15 +247,145 @@ func CommitHandler(repo *core.Repository, message string) error {
 	}
 
 	// Update reflog
-	if err := updateReflogRepo(repo, parent, commitHash, branch, "commit", message); err != nil {
+	action := "commit"
+	if amended != nil {
+		action = "commit (amend)"
+	}
+	if err := updateReflogRepo(repo, parent, commitHash, branch, action, message); err != nil {
 		return fmt.Errorf("failed to update reflog: %w", err)
 	}
+	movedRef := core.HeadFile
+	if branch != "(HEAD detached)" {
+		movedRef = "refs/heads/" + branch
+	}
+	subject, _, _ := strings.Cut(message, "\n")
+	if err := repo.RecordRefMove(movedRef, parent, commitHash, action+": "+subject); err != nil {
+		return err
+	}
+	if squashMessage != "" {
+		if err := merge.ClearSquashMessage(repo); err != nil {
+			return err
+		}
+	}
 
 	// Display success message with short commit hash
 	fmt.Printf("[(%s) %s] %s\n", branch, commitHash[:7], message)
+
+	// post-commit can't affect the outcome, so it also runs with --no-verify
+	hookEnv["VEC_COMMIT"] = commitHash
+	if err := repo.RunHook(core.HookPostCommit, core.HookOptions{Env: hookEnv}); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
 	return nil
 }
 
+// scanCommitSecretsRepo blocks the commit when the files it adds or changes
+// relative to parent contain likely credentials
+func scanCommitSecretsRepo(repo *core.Repository, parent, treeHash string) error {
+	headTree := ""
+	if parent != "" {
+		commit, err := objects.GetCommitRepo(repo, parent)
+		if err != nil {
+			return fmt.Errorf("failed to load HEAD commit: %w", err)
+		}
+		headTree = commit.Tree
+	}
+	findings, err := secrets.ScanCommitRepo(repo, headTree, treeHash)
+	if len(findings) > 0 {
+		for _, f := range findings {
+			fmt.Fprintf(os.Stderr, "%s:%d: %s %s (%s)\n", f.Path, f.Line, f.Rule, f.Redacted(), f.Fingerprint)
+		}
+		fmt.Fprintf(os.Stderr, "hint: add a fingerprint, rule:<name> or a path to %s to allow it, or commit with --no-verify\n", secrets.AllowlistFile)
+		return fmt.Errorf("commit blocked: %d likely secret(s) found in the staged changes", len(findings))
+	}
+	return err
+}
+
+// runCommitMsgHookRepo writes message to .vec/COMMIT_EDITMSG, runs the
+// commit-msg hook on it and returns the message as the hook left it
+func runCommitMsgHookRepo(repo *core.Repository, message string, env map[string]string) (string, error) {
+	msgPath := filepath.Join(repo.VecDir, "COMMIT_EDITMSG")
+	if err := os.WriteFile(msgPath, []byte(message+"\n"), 0644); err != nil {
+		return "", core.FSError("failed to write COMMIT_EDITMSG", err)
+	}
+	if err := repo.RunHook(core.HookCommitMsg, core.HookOptions{Args: []string{msgPath}, Env: env}); err != nil {
+		return "", fmt.Errorf("commit-msg hook declined the commit: %w", err)
+	}
+	edited, err := os.ReadFile(msgPath)
+	if err != nil {
+		return "", core.FSError("failed to read COMMIT_EDITMSG", err)
+	}
+	if message = strings.TrimSpace(string(edited)); message == "" {
+		return "", fmt.Errorf("aborting commit due to empty message")
+	}
+	return message, nil
+}
+
+// partialCommitTreeRepo stages the working tree content of the tracked paths
+// matching pathspecs and returns the tree of HEAD with only those paths
+// changed. The index is written with the refreshed paths and keeps every
+// other staged change.
+func partialCommitTreeRepo(repo *core.Repository, index *staging.Index, parent string, pathspecs []string) (string, error) {
+	headTree := ""
+	if parent != "" {
+		commit, err := objects.GetCommitRepo(repo, parent)
+		if err != nil {
+			return "", fmt.Errorf("failed to load HEAD commit: %w", err)
+		}
+		headTree = commit.Tree
+	}
+	headIndex, err := staging.IndexFromTreeRepo(repo, headTree)
+	if err != nil {
+		return "", err
+	}
+
+	// Tracked means staged or in HEAD; untracked files are never picked up
+	tracked := make(map[string]bool)
+	for _, entries := range [][]staging.IndexEntry{index.Entries, headIndex.Entries} {
+		for _, entry := range entries {
+			if entry.Stage == 0 && staging.MatchesPathspec(entry.FilePath, pathspecs) {
+				tracked[entry.FilePath] = true
+			}
+		}
+	}
+	for relPath := range tracked {
+		absPath := filepath.Join(repo.Root, relPath)
+		content, err := os.ReadFile(absPath)
+		if os.IsNotExist(err) {
+			if err := index.Remove(repo, relPath); err != nil {
+				return "", err
+			}
+			continue
+		} else if err != nil {
+			return "", core.FSError(fmt.Sprintf("failed to read file '%s'", relPath), err)
+		}
+		hash, err := objects.CreateBlobRepo(repo, content)
+		if err != nil {
+			return "", core.ObjectError(fmt.Sprintf("failed to create blob for '%s'", relPath), err)
+		}
+		if err := index.Add(repo, relPath, hash); err != nil {
+			return "", core.IndexError(fmt.Sprintf("failed to add '%s' to index", relPath), err)
+		}
+	}
+
+	partial, err := index.PartialCommitIndex(repo, headTree, pathspecs)
+	if err != nil {
+		return "", err
+	}
+	treeHash, err := staging.CreateTreeFromIndex(repo, partial)
+	if err != nil {
+		return "", fmt.Errorf("failed to create tree from index: %w", err)
+	}
+	if treeHash == headTree {
+		return "", fmt.Errorf("nothing to commit for the given paths")
+	}
+
+	if err := index.Write(); err != nil {
+		return "", core.IndexError("failed to write index", err)
+	}
+	return treeHash, nil
+}
+
 // updateReflogRepo updates the reflog with the given commit information
 func updateReflogRepo(repo *core.Repository, oldCommit, newCommit, branch, action, message string) error {
 	// Implementation details for updating reflog
@@ -157,7 +398,10 @@ func updateReflogRepo(repo *core.Repository, oldCommit, newCommit, branch, actio
 	}
 
 	// Format the reflog entry
-	timestamp := time.Now().Unix()
+	now, err := objects.DateFromEnv(objects.CommitterDateEnv, time.Now())
+	if err != nil {
+		return err
+	}
 	userName, err := repo.GetConfig("user.name")
 	if err != nil || userName == "" {
 		userName = "unknown"
@@ -168,12 +412,12 @@ func updateReflogRepo(repo *core.Repository, oldCommit, newCommit, branch, actio
 	}
 
 	// Format: <old-sha> <new-sha> <author> <timestamp> <timezone> <message>
-	logEntry := fmt.Sprintf("%s %s %s <%s> %d +0000 %s: %s\n",
+	logEntry := fmt.Sprintf("%s %s %s <%s> %s %s: %s\n",
 		oldCommit,
 		newCommit,
 		userName,
 		userEmail,
-		timestamp,
+		objects.FormatDate(now, objects.DateRaw),
 		action,
 		message)
 
@@ -214,5 +458,8 @@ func updateReflogRepo(repo *core.Repository, oldCommit, newCommit, branch, actio
 // init registers the commit command and its flags.
 func init() {
 	commitCmd.Flags().StringP("message", "m", "", "Commit message")
+	commitCmd.Flags().BoolVarP(&commitNoVerify, "no-verify", "n", false, "Bypass the pre-commit and commit-msg hooks and the secret scan")
+	commitCmd.Flags().BoolVarP(&commitSign, "gpg-sign", "S", false, "Sign the commit with user.signingKey")
+	commitCmd.Flags().BoolVar(&commitAmend, "amend", false, "Replace HEAD, keeping its author and, without -m, its message")
 	rootCmd.AddCommand(commitCmd)
 }
@@ -8,9 +8,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/NahomAnteneh/vec/core"
 	"github.com/NahomAnteneh/vec/internal/config"
 	"github.com/NahomAnteneh/vec/internal/remote"
 	"github.com/NahomAnteneh/vec/utils"
@@ -44,6 +46,20 @@ Configuration values can be set using the following syntax:
   section.key=value
   section.subsection.key=value
 
+Use --show-origin with list or get to see the file and line each value
+is read from, and 'vec var' to see the values vec actually uses after
+environment overrides.
+
+Any command flag can be given a default as <command>.<flag>, with the flag
+name in camelCase (status.short=true, fetch.prune=true, push.noSizeCheck=true;
+subcommands use their full path, as in remote.show.noQuery). Flags given on
+the command line always take precedence. Only flags a command actually has
+take defaults: diff.context or log.decorate configure nothing, since diff has
+no --context and log no --decorate, and setting such a key warns that it is
+unknown. Keys the command reads as settings of their own, such as merge.ff,
+pull.rebase and fetch.negotiationTip, keep that meaning and are not applied
+as flag defaults.
+
 Example:
   vec config user.name "John Doe"
   vec config --global user.email "john@example.com"
@@ -55,10 +71,28 @@ var listCmd = &cobra.Command{
 	Short: "List all configuration settings",
 	Long: `List all configuration settings in the specified scope.
 If no scope is specified, defaults to local configuration.
-Valid scopes are: local, global, system`,
+Valid scopes are: local, global, system
+
+With --only-known only the keys vec reads are listed, from every scope
+unless one is given, each marked when its value is invalid, the key is
+deprecated, or a scope read before it overrides it.`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		scope := getConfigScope(cmd, args)
+		if onlyKnown, _ := cmd.Flags().GetBool("only-known"); onlyKnown {
+			return auditConfig(cmd, args)
+		}
+		if showOrigin, _ := cmd.Parent().PersistentFlags().GetBool("show-origin"); showOrigin {
+			entries, err := getConfigEntriesForScope(scope)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				fmt.Printf("%s\t%s=%s\n", entry.Origin(), entry.Key, entry.Value)
+			}
+			return nil
+		}
+
 		config, err := getConfigForScope(scope)
 		if err != nil {
 			return err
@@ -102,10 +136,32 @@ Valid scopes are: local, global, system`,
 		key := args[0]
 		scope := getConfigScope(cmd, args[1:])
 
+		if showOrigin, _ := cmd.Parent().PersistentFlags().GetBool("show-origin"); showOrigin {
+			entries, err := getConfigEntriesForScope(scope)
+			if err != nil {
+				return err
+			}
+			for i := len(entries) - 1; i >= 0; i-- {
+				if entries[i].Key == key {
+					fmt.Printf("%s\t%s\n", entries[i].Origin(), entries[i].Value)
+					return nil
+				}
+			}
+			return fmt.Errorf("key '%s' not found in %s config", key, scope)
+		}
+
 		value, err := getConfigValue(key, scope)
 		if err != nil {
 			return err
 		}
+		if typ, _ := cmd.Parent().PersistentFlags().GetString("type"); typ != "" {
+			if value, err = core.NormalizeConfigValue(core.ConfigType(typ), value); err != nil {
+				return core.ConfigError(fmt.Sprintf("invalid value for %s", key), err)
+			}
+			if core.ConfigType(typ) == core.ConfigPath {
+				value = core.ExpandConfigPath(value)
+			}
+		}
 
 		fmt.Println(value)
 		return nil
@@ -118,12 +174,19 @@ var setCmd = &cobra.Command{
 	Long: `Set a configuration value for the specified key.
 The key can be specified in the format section.key or section.subsection.key.
 If no scope is specified, defaults to local configuration.
-Valid scopes are: local, global, system`,
+Valid scopes are: local, global, system
+
+Values of the keys vec reads are checked and stored in canonical form, so
+"core.autocrlf yes" stores true; --type checks any key against a type
+instead. Setting a key vec doesn't read, or a deprecated one, warns.`,
 	Args: cobra.RangeArgs(2, 3),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		key := args[0]
-		value := args[1]
 		scope := getConfigScope(cmd, args[2:])
+		value, err := normalizeConfigSetting(cmd, key, args[1])
+		if err != nil {
+			return err
+		}
 
 		if err := setConfigValue(key, value, scope); err != nil {
 			return err
@@ -169,12 +232,13 @@ Valid scopes are: local, global, system`,
 			return err
 		}
 
-		editor := os.Getenv("EDITOR")
-		if editor == "" {
-			editor = "vim" // Default to vim if no editor is set
+		repoRoot, _ := utils.GetVecRoot()
+		editor, err := core.ResolveEditor(repoRoot)
+		if err != nil {
+			return err
 		}
 
-		execCmd := exec.Command(editor, configPath)
+		execCmd := exec.Command(editor.Value, configPath)
 		execCmd.Stdin = os.Stdin
 		execCmd.Stdout = os.Stdout
 		execCmd.Stderr = os.Stderr
@@ -182,6 +246,98 @@ Valid scopes are: local, global, system`,
 	},
 }
 
+// normalizeConfigSetting checks value for key, against --type when given
+// and otherwise against the key's spec, and returns it in canonical form.
+// Unknown and deprecated keys are warned about.
+func normalizeConfigSetting(cmd *cobra.Command, key, value string) (string, error) {
+	spec := core.LookupConfigKey(key)
+	if spec == nil {
+		spec = flagDefaultSpec(key)
+	}
+	switch {
+	case spec == nil:
+		fmt.Fprintf(os.Stderr, "warning: unknown config key '%s'\n", key)
+	case spec.Deprecated != "":
+		fmt.Fprintf(os.Stderr, "warning: %s is deprecated: %s\n", key, spec.Deprecated)
+	}
+
+	if typ, _ := cmd.Parent().PersistentFlags().GetString("type"); typ != "" {
+		normalized, err := core.NormalizeConfigValue(core.ConfigType(typ), value)
+		if err != nil {
+			return "", core.ConfigError(fmt.Sprintf("invalid value for %s", key), err)
+		}
+		return normalized, nil
+	}
+	if spec == nil {
+		return value, nil
+	}
+	return spec.Normalize(value)
+}
+
+// auditConfig lists the known keys set in the scope named by args, or in
+// every scope, with what is wrong with each
+func auditConfig(cmd *cobra.Command, args []string) error {
+	global, _ := cmd.Parent().PersistentFlags().GetBool("global")
+	scopes := []ConfigScope{ScopeLocal, ScopeGlobal, ScopeSystem} // In the order values are looked up
+	if len(args) > 0 || global {
+		scopes = []ConfigScope{getConfigScope(cmd, args)}
+	}
+
+	winner := make(map[string]ConfigScope) // By lowercased key
+	unknown := 0
+	for _, scope := range scopes {
+		values, err := getConfigForScope(scope)
+		if err != nil {
+			if scope == ScopeLocal && len(scopes) > 1 {
+				continue // Outside a repository
+			}
+			return err
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			spec := core.LookupConfigKey(key)
+			if spec == nil {
+				spec = flagDefaultSpec(key)
+			}
+			if spec == nil {
+				unknown++
+				continue
+			}
+			var notes []string
+			if _, err := spec.Normalize(values[key]); err != nil {
+				expected := string(spec.Type)
+				if len(spec.Values) > 0 {
+					expected += " or " + strings.Join(spec.Values, ", ")
+				}
+				notes = append(notes, "invalid: expected "+expected)
+			}
+			if spec.Deprecated != "" {
+				notes = append(notes, "deprecated: "+spec.Deprecated)
+			}
+			if first, ok := winner[strings.ToLower(key)]; ok {
+				notes = append(notes, "overridden by "+string(first))
+			} else {
+				winner[strings.ToLower(key)] = scope
+			}
+
+			line := fmt.Sprintf("%s\t%s=%s", scope, key, values[key])
+			if len(notes) > 0 {
+				line += "\t(" + strings.Join(notes, "; ") + ")"
+			}
+			fmt.Println(line)
+		}
+	}
+	if unknown > 0 {
+		fmt.Fprintf(os.Stderr, "%d unknown key%s not shown\n", unknown, plural(unknown))
+	}
+	return nil
+}
+
 // Helper functions
 func getConfigScope(cmd *cobra.Command, args []string) ConfigScope {
 	if len(args) > 0 {
@@ -240,6 +396,16 @@ func getConfigForScope(scope ConfigScope) (map[string]string, error) {
 	return utils.ReadConfig(configPath)
 }
 
+// getConfigEntriesForScope reads the settings of scope in file order with
+// their line numbers
+func getConfigEntriesForScope(scope ConfigScope) ([]core.ConfigEntry, error) {
+	configPath, err := getConfigPath(scope)
+	if err != nil {
+		return nil, err
+	}
+	return core.ReadConfigEntries(configPath)
+}
+
 func getConfigValue(key string, scope ConfigScope) (string, error) {
 	config, err := getConfigForScope(scope)
 	if err != nil {
@@ -300,8 +466,17 @@ func setConfigValue(key, value string, scope ConfigScope) error {
 		return err
 	}
 
+	// Only the local config belongs to the repository and its audit log
+	repoRoot := filepath.Dir(filepath.Dir(configPath))
+	oldValue, wasAudited := config[key], scope == ScopeLocal && core.AuditEnabled(repoRoot)
 	config[key] = value
-	return utils.WriteConfig(configPath, config)
+	if err := utils.WriteConfig(configPath, config); err != nil {
+		return err
+	}
+	if scope == ScopeLocal {
+		core.RecordConfigAudit(repoRoot, key, oldValue, value, wasAudited)
+	}
+	return nil
 }
 
 func unsetConfigValue(key string, scope ConfigScope) error {
@@ -315,8 +490,16 @@ func unsetConfigValue(key string, scope ConfigScope) error {
 		return err
 	}
 
+	repoRoot := filepath.Dir(filepath.Dir(configPath))
+	oldValue, wasAudited := config[key], scope == ScopeLocal && core.AuditEnabled(repoRoot)
 	delete(config, key)
-	return utils.WriteConfig(configPath, config)
+	if err := utils.WriteConfig(configPath, config); err != nil {
+		return err
+	}
+	if scope == ScopeLocal {
+		core.RecordConfigAudit(repoRoot, key, oldValue, "", wasAudited)
+	}
+	return nil
 }
 
 // remoteAuthCmd adds authentication token to a remote repository
@@ -747,6 +930,15 @@ var jwtClearCmd = &cobra.Command{
 	},
 }
 
+// joinConfigTypes lists the --type values for help
+func joinConfigTypes() string {
+	names := make([]string, len(core.ConfigTypes))
+	for i, t := range core.ConfigTypes {
+		names[i] = string(t)
+	}
+	return strings.Join(names, ", ")
+}
+
 func init() {
 	rootCmd.AddCommand(configCmd)
 
@@ -771,6 +963,9 @@ func init() {
 	// Add scope flag to configCmd
 	configCmd.PersistentFlags().BoolP("global", "g", false, "Use global config file")
 	configCmd.PersistentFlags().BoolP("system", "s", false, "Use system config file")
+	configCmd.PersistentFlags().Bool("show-origin", false, "Show the file and line each value comes from")
+	configCmd.PersistentFlags().String("type", "", "Check and convert values as one of: "+joinConfigTypes())
+	listCmd.Flags().Bool("only-known", false, "Only list the keys vec reads, marking invalid, deprecated and overridden ones")
 
 	// Add user configuration commands
 	configCmd.AddCommand(&cobra.Command{
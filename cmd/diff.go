@@ -7,6 +7,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/NahomAnteneh/vec/core"
 	"github.com/NahomAnteneh/vec/internal/objects"
 	"github.com/NahomAnteneh/vec/internal/staging"
 	"github.com/NahomAnteneh/vec/utils"
@@ -15,9 +16,13 @@ import (
 )
 
 var (
-	cached   bool
-	nameOnly bool
-	color    bool
+	cached       bool
+	nameOnly     bool
+	color        bool
+	diffCheck    bool
+	diffNoIndex  bool
+	diffStat     bool
+	diffExitCode bool
 )
 
 // diffCmd represents the diff command
@@ -31,59 +36,82 @@ Example:
   vec diff             # Show unstaged changes in the working tree
   vec diff --cached    # Show staged changes
   vec diff HEAD~1 HEAD # Show changes between the previous commit and HEAD
-  vec diff branch1..branch2  # Show changes between two branches`,
+  vec diff branch1..branch2  # Show changes between two branches
+  vec diff --check     # Report whitespace errors in unstaged changes
+  vec diff --stat      # Summarize the changes per file
+  vec diff --no-index a.txt b.txt  # Compare two files, in a repository or not
+
+With --no-index the two paths given, files or directories, are compared
+directly. No repository is needed, and the command exits with status 1 when
+they differ, as --exit-code does for the other forms.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if diffNoIndex {
+			return diffNoIndexPaths(cmd, args)
+		}
 		repoRoot, err := utils.GetVecRoot()
 		if err != nil {
 			return err
 		}
 
-		// Parse the diff type based on arguments and flags
-		var src, dst string
-		var paths []string
+		src, dst, paths := diffSources(repoRoot, args, cached)
+		if diffCheck {
+			return checkDiffWhitespace(cmd, repoRoot, src, dst, paths)
+		}
+		found, err := showDiff(repoRoot, src, dst, paths)
+		if err != nil {
+			return err
+		}
+		if found && diffExitCode {
+			return silentExit(cmd, 1)
+		}
+		return nil
+	},
+}
 
-		if len(args) > 0 {
-			// Check if the argument has the form of branch1..branch2
-			if strings.Contains(args[0], "..") {
-				parts := strings.Split(args[0], "..")
-				if len(parts) == 2 {
-					src = parts[0]
-					dst = parts[1]
-					paths = args[1:]
-				}
-			} else if len(args) >= 2 && isCommitOrBranch(repoRoot, args[0]) && isCommitOrBranch(repoRoot, args[1]) {
-				// Two commits/branches specified
-				src = args[0]
-				dst = args[1]
-				paths = args[2:]
-			} else if len(args) >= 1 && isCommitOrBranch(repoRoot, args[0]) {
-				// One commit/branch specified
-				src = "HEAD"
-				dst = args[0]
+// diffSources resolves diff and difftool arguments to the two sides compared
+// (a commit, INDEX or WORKTREE) and the paths the comparison is limited to
+func diffSources(repoRoot string, args []string, cached bool) (src, dst string, paths []string) {
+	if len(args) > 0 {
+		// Check if the argument has the form of branch1..branch2
+		if strings.Contains(args[0], "..") {
+			parts := strings.Split(args[0], "..")
+			if len(parts) == 2 {
+				src = parts[0]
+				dst = parts[1]
 				paths = args[1:]
-			} else {
-				// No commits, just paths
-				paths = args
 			}
+		} else if len(args) >= 2 && isCommitOrBranch(repoRoot, args[0]) && isCommitOrBranch(repoRoot, args[1]) {
+			// Two commits/branches specified
+			src = args[0]
+			dst = args[1]
+			paths = args[2:]
+		} else if len(args) >= 1 && isCommitOrBranch(repoRoot, args[0]) {
+			// One commit/branch specified
+			src = "HEAD"
+			dst = args[0]
+			paths = args[1:]
+		} else {
+			// No commits, just paths
+			paths = args
 		}
+	}
 
-		// Adjust source and destination based on flags
-		if cached {
-			// Compare staging area (index) to HEAD
-			if src == "" && dst == "" {
-				src = "HEAD"
-				dst = "INDEX"
-			}
-		} else {
-			// Compare working directory to staging area
-			if src == "" && dst == "" {
-				src = "INDEX"
-				dst = "WORKTREE"
-			}
+	// Adjust source and destination based on flags
+	if cached {
+		// Compare staging area (index) to HEAD
+		if src == "" && dst == "" {
+			src = "HEAD"
+			dst = "INDEX"
+		}
+	} else {
+		// Compare working directory to staging area
+		if src == "" && dst == "" {
+			src = "INDEX"
+			dst = "WORKTREE"
 		}
+	}
 
-		return showDiff(repoRoot, src, dst, paths)
-	},
+	return src, dst, paths
 }
 
 // isCommitOrBranch checks if the given string is a valid commit hash or branch name
@@ -119,17 +147,18 @@ func isCommitOrBranch(repoRoot, ref string) bool {
 	return false
 }
 
-// showDiff displays the differences between the two specified sources
-func showDiff(repoRoot, src, dst string, paths []string) error {
+// showDiff displays the differences between the two specified sources and
+// reports whether there were any
+func showDiff(repoRoot, src, dst string, paths []string) (bool, error) {
 	// Get the files from both sources
 	srcFiles, err := getFilesFromRef(repoRoot, src)
 	if err != nil {
-		return fmt.Errorf("failed to get files from source: %w", err)
+		return false, fmt.Errorf("failed to get files from source: %w", err)
 	}
 
 	dstFiles, err := getFilesFromRef(repoRoot, dst)
 	if err != nil {
-		return fmt.Errorf("failed to get files from destination: %w", err)
+		return false, fmt.Errorf("failed to get files from destination: %w", err)
 	}
 
 	// Filter by paths if specified
@@ -138,6 +167,17 @@ func showDiff(repoRoot, src, dst string, paths []string) error {
 		dstFiles = filterFilesByPaths(dstFiles, paths)
 	}
 
+	diffFound := printDiffPairs(diffFilePairs(srcFiles, dstFiles))
+	if !diffFound && !diffStat {
+		fmt.Println("No changes.")
+	}
+
+	return diffFound, nil
+}
+
+// diffFilePairs pairs up, by path and in path order, the files that exist
+// in either source
+func diffFilePairs(srcFiles, dstFiles map[string]string) []diffPair {
 	// Find files that exist in either source
 	allFiles := make(map[string]struct{})
 	for file := range srcFiles {
@@ -154,57 +194,223 @@ func showDiff(repoRoot, src, dst string, paths []string) error {
 	}
 	sort.Strings(sortedFiles)
 
-	dmp := diffmatchpatch.New()
-	diffFound := false
-
-	// Display diffs for each file
+	pairs := make([]diffPair, 0, len(sortedFiles))
 	for _, file := range sortedFiles {
-		srcContent, srcExists := srcFiles[file]
-		dstContent, dstExists := dstFiles[file]
+		pair := diffPair{srcName: file, dstName: file}
+		pair.srcContent, pair.srcExists = srcFiles[file]
+		pair.dstContent, pair.dstExists = dstFiles[file]
+		pairs = append(pairs, pair)
+	}
+	return pairs
+}
+
+// diffPair is one file compared by diff; a side that doesn't exist shows
+// as /dev/null
+type diffPair struct {
+	srcName, dstName       string
+	srcContent, dstContent string
+	srcExists, dstExists   bool
+}
+
+// changed reports whether the two sides of the pair differ
+func (p diffPair) changed() bool {
+	return p.srcExists != p.dstExists || p.srcContent != p.dstContent
+}
 
-		if !srcExists {
+// printDiffPairs prints the changed pairs as names, a stat or a diff,
+// following --name-only and --stat, and reports whether any changed
+func printDiffPairs(pairs []diffPair) bool {
+	var changed []diffPair
+	for _, pair := range pairs {
+		if pair.changed() {
+			changed = append(changed, pair)
+		}
+	}
+	if diffStat {
+		printDiffStat(changed)
+		return len(changed) > 0
+	}
+
+	colors := newDiffColors()
+	dmp := diffmatchpatch.New()
+	for _, pair := range changed {
+		if !pair.srcExists {
 			// File added
 			if nameOnly {
-				fmt.Printf("added: %s\n", file)
+				fmt.Printf("added: %s\n", pair.dstName)
 			} else {
-				fmt.Printf("diff --vec a/%s b/%s\n", file, file)
-				fmt.Printf("--- /dev/null\n")
-				fmt.Printf("+++ b/%s\n", file)
-				printNewFileContent(dstContent)
+				colors.header("diff --vec a/%s b/%s", pair.srcName, pair.dstName)
+				colors.header("--- /dev/null")
+				colors.header("+++ b/%s", pair.dstName)
+				printNewFileContent(colors, pair.dstContent)
 			}
-			diffFound = true
-		} else if !dstExists {
+		} else if !pair.dstExists {
 			// File removed
 			if nameOnly {
-				fmt.Printf("deleted: %s\n", file)
+				fmt.Printf("deleted: %s\n", pair.srcName)
 			} else {
-				fmt.Printf("diff --vec a/%s b/%s\n", file, file)
-				fmt.Printf("--- a/%s\n", file)
-				fmt.Printf("+++ /dev/null\n")
-				printDeletedFileContent(srcContent)
+				colors.header("diff --vec a/%s b/%s", pair.srcName, pair.dstName)
+				colors.header("--- a/%s", pair.srcName)
+				colors.header("+++ /dev/null")
+				printDeletedFileContent(colors, pair.srcContent)
 			}
-			diffFound = true
-		} else if srcContent != dstContent {
+		} else {
 			// File modified
 			if nameOnly {
-				fmt.Printf("modified: %s\n", file)
+				fmt.Printf("modified: %s\n", pair.dstName)
 			} else {
-				diffs := dmp.DiffMain(srcContent, dstContent, false)
+				diffs := dmp.DiffMain(pair.srcContent, pair.dstContent, false)
 				if len(diffs) > 1 { // If there are actual differences
-					fmt.Printf("diff --vec a/%s b/%s\n", file, file)
-					fmt.Printf("--- a/%s\n", file)
-					fmt.Printf("+++ b/%s\n", file)
-					printUnifiedDiff(diffs)
+					colors.header("diff --vec a/%s b/%s", pair.srcName, pair.dstName)
+					colors.header("--- a/%s", pair.srcName)
+					colors.header("+++ b/%s", pair.dstName)
+					printUnifiedDiff(colors, diffs)
 				}
 			}
-			diffFound = true
 		}
 	}
+	return len(changed) > 0
+}
 
-	if !diffFound {
-		fmt.Println("No changes.")
+// printDiffStat prints a line per changed pair with its count of changed
+// lines, and a summary
+func printDiffStat(pairs []diffPair) {
+	type statLine struct {
+		name           string
+		added, deleted int
+	}
+	var lines []statLine
+	nameWidth, maxCount := 0, 0
+	totalAdded, totalDeleted := 0, 0
+	for _, pair := range pairs {
+		name := pair.dstName
+		if pair.srcName != pair.dstName {
+			name = pair.srcName + " => " + pair.dstName
+		}
+		line := statLine{name: name}
+		for _, change := range diffLineChanges(pair.srcContent, pair.dstContent) {
+			line.added += len(change.added)
+			line.deleted += len(change.removed)
+		}
+		lines = append(lines, line)
+		nameWidth = max(nameWidth, len(name))
+		maxCount = max(maxCount, line.added+line.deleted)
+		totalAdded += line.added
+		totalDeleted += line.deleted
 	}
+	if len(lines) == 0 {
+		return
+	}
+
+	colors := newDiffColors()
+	const graphWidth = 50
+	countWidth := len(fmt.Sprint(maxCount))
+	for _, line := range lines {
+		plus, minus := line.added, line.deleted
+		if maxCount > graphWidth {
+			// Scale, keeping at least one mark for any change
+			plus = (line.added*graphWidth + maxCount - 1) / maxCount
+			minus = (line.deleted*graphWidth + maxCount - 1) / maxCount
+		}
+		fmt.Printf(" %-*s | %*d %s%s\n", nameWidth, line.name, countWidth, line.added+line.deleted,
+			colors.paint(colors.add, strings.Repeat("+", plus)), colors.paint(colors.del, strings.Repeat("-", minus)))
+	}
+	fmt.Printf(" %d file%s changed, %d insertion%s(+), %d deletion%s(-)\n",
+		len(lines), plural(len(lines)), totalAdded, plural(totalAdded), totalDeleted, plural(totalDeleted))
+}
+
+// plural returns "s" unless n is one
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// diffColors prints diff lines in color when --color is on and the output
+// is a terminal
+type diffColors struct {
+	enabled               bool
+	bold, add, del, reset string
+}
+
+func newDiffColors() diffColors {
+	info, err := os.Stdout.Stat()
+	terminal := err == nil && info.Mode()&os.ModeCharDevice != 0
+	return diffColors{
+		enabled: color && terminal,
+		bold:    "\x1b[1m",
+		add:     "\x1b[32m",
+		del:     "\x1b[31m",
+		reset:   "\x1b[m",
+	}
+}
+
+// paint wraps text in the escape code when colors are on
+func (c diffColors) paint(code, text string) string {
+	if !c.enabled || text == "" {
+		return text
+	}
+	return code + text + c.reset
+}
+
+// header prints a file header line
+func (c diffColors) header(format string, args ...any) {
+	fmt.Println(c.paint(c.bold, fmt.Sprintf(format, args...)))
+}
+
+// line prints a diff line with its +, - or space marker
+func (c diffColors) line(marker byte, text string) {
+	line := string(marker) + text
+	switch marker {
+	case '+':
+		line = c.paint(c.add, line)
+	case '-':
+		line = c.paint(c.del, line)
+	}
+	fmt.Println(line)
+}
 
+// checkDiffWhitespace reports the core.whitespace problems of the lines dst
+// adds over src, as path:line: problem, and exits with status 2 if any
+func checkDiffWhitespace(cmd *cobra.Command, repoRoot, src, dst string, paths []string) error {
+	rules, err := core.WhitespaceRulesFor(repoRoot)
+	if err != nil {
+		return err
+	}
+	srcFiles, err := getFilesFromRef(repoRoot, src)
+	if err != nil {
+		return fmt.Errorf("failed to get files from source: %w", err)
+	}
+	dstFiles, err := getFilesFromRef(repoRoot, dst)
+	if err != nil {
+		return fmt.Errorf("failed to get files from destination: %w", err)
+	}
+	if len(paths) > 0 {
+		srcFiles = filterFilesByPaths(srcFiles, paths)
+		dstFiles = filterFilesByPaths(dstFiles, paths)
+	}
+
+	files := make([]string, 0, len(dstFiles))
+	for file := range dstFiles {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	found := false
+	for _, file := range files {
+		if dstFiles[file] == srcFiles[file] {
+			continue
+		}
+		problems := core.CheckWhitespace([]byte(dstFiles[file]), rules, core.NewLinesOnly([]byte(srcFiles[file])))
+		for _, p := range problems {
+			fmt.Printf("%s:%s\n", file, p)
+		}
+		found = found || len(problems) > 0
+	}
+	if found {
+		return silentExit(cmd, 2)
+	}
 	return nil
 }
 
@@ -445,23 +651,23 @@ func filterFilesByPaths(files map[string]string, paths []string) map[string]stri
 }
 
 // printNewFileContent prints the content of a new file in diff format
-func printNewFileContent(content string) {
+func printNewFileContent(colors diffColors, content string) {
 	lines := strings.Split(content, "\n")
 	for _, line := range lines {
-		fmt.Printf("+%s\n", line)
+		colors.line('+', line)
 	}
 }
 
 // printDeletedFileContent prints the content of a deleted file in diff format
-func printDeletedFileContent(content string) {
+func printDeletedFileContent(colors diffColors, content string) {
 	lines := strings.Split(content, "\n")
 	for _, line := range lines {
-		fmt.Printf("-%s\n", line)
+		colors.line('-', line)
 	}
 }
 
 // printUnifiedDiff prints the differences in unified diff format
-func printUnifiedDiff(diffs []diffmatchpatch.Diff) {
+func printUnifiedDiff(colors diffColors, diffs []diffmatchpatch.Diff) {
 	lineNum := 1
 	for _, diff := range diffs {
 		text := diff.Text
@@ -470,16 +676,16 @@ func printUnifiedDiff(diffs []diffmatchpatch.Diff) {
 		switch diff.Type {
 		case diffmatchpatch.DiffEqual:
 			for _, line := range lines {
-				fmt.Printf(" %s\n", line)
+				colors.line(' ', line)
 				lineNum++
 			}
 		case diffmatchpatch.DiffInsert:
 			for _, line := range lines {
-				fmt.Printf("+%s\n", line)
+				colors.line('+', line)
 			}
 		case diffmatchpatch.DiffDelete:
 			for _, line := range lines {
-				fmt.Printf("-%s\n", line)
+				colors.line('-', line)
 				lineNum++
 			}
 		}
@@ -493,4 +699,8 @@ func init() {
 	diffCmd.Flags().BoolVar(&cached, "cached", false, "View the changes you staged for the next commit")
 	diffCmd.Flags().BoolVar(&nameOnly, "name-only", false, "Show only names of changed files")
 	diffCmd.Flags().BoolVar(&color, "color", true, "Show colored diff")
+	diffCmd.Flags().BoolVar(&diffCheck, "check", false, "Report whitespace errors (see core.whitespace) in added lines instead of the diff")
+	diffCmd.Flags().BoolVar(&diffNoIndex, "no-index", false, "Compare two paths on the filesystem, outside of any repository")
+	diffCmd.Flags().BoolVar(&diffStat, "stat", false, "Show the number of changed lines per file instead of the diff")
+	diffCmd.Flags().BoolVar(&diffExitCode, "exit-code", false, "Exit with status 1 if there were differences")
 }
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+// diffNoIndexPaths compares two files or directories of the filesystem for
+// diff --no-index. It exits with status 1 when they differ.
+func diffNoIndexPaths(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: vec diff --no-index <path> <path>")
+	}
+	src, dst := args[0], args[1]
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to read '%s': %w", src, err)
+	}
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		return fmt.Errorf("failed to read '%s': %w", dst, err)
+	}
+
+	// A file compared with a directory is compared with the file of the
+	// same name in it
+	if srcInfo.IsDir() && !dstInfo.IsDir() {
+		src = filepath.Join(src, filepath.Base(dst))
+	} else if !srcInfo.IsDir() && dstInfo.IsDir() {
+		dst = filepath.Join(dst, filepath.Base(src))
+	}
+
+	var pairs []diffPair
+	if srcInfo.IsDir() && dstInfo.IsDir() {
+		pairs, err = noIndexDirPairs(src, dst)
+	} else {
+		var pair diffPair
+		pair, err = noIndexFilePair(src, dst)
+		pairs = []diffPair{pair}
+	}
+	if err != nil {
+		return err
+	}
+
+	if printDiffPairs(pairs) {
+		return silentExit(cmd, 1)
+	}
+	return nil
+}
+
+// readNoIndexFile returns the content of a file, and false if it doesn't exist
+func readNoIndexFile(name string) (string, bool, error) {
+	content, err := os.ReadFile(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed to read '%s': %w", name, err)
+	}
+	return string(content), true, nil
+}
+
+// noIndexFilePair compares two files
+func noIndexFilePair(src, dst string) (diffPair, error) {
+	pair := diffPair{srcName: filepath.ToSlash(src), dstName: filepath.ToSlash(dst)}
+	var err error
+	if pair.srcContent, pair.srcExists, err = readNoIndexFile(src); err != nil {
+		return pair, err
+	}
+	if pair.dstContent, pair.dstExists, err = readNoIndexFile(dst); err != nil {
+		return pair, err
+	}
+	return pair, nil
+}
+
+// noIndexDirPairs compares the files below two directories by their path
+// relative to them
+func noIndexDirPairs(src, dst string) ([]diffPair, error) {
+	files := make(map[string]bool)
+	for _, root := range []string{src, dst} {
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			files[filepath.ToSlash(rel)] = true
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", root, err)
+		}
+	}
+
+	sorted := make([]string, 0, len(files))
+	for rel := range files {
+		sorted = append(sorted, rel)
+	}
+	sort.Strings(sorted)
+
+	pairs := make([]diffPair, 0, len(sorted))
+	for _, rel := range sorted {
+		pair, err := noIndexFilePair(filepath.Join(src, filepath.FromSlash(rel)), filepath.Join(dst, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
@@ -0,0 +1,296 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/spf13/cobra"
+)
+
+// diffToolKey names the tool difftool launches; difftool.<tool>.cmd
+// overrides how it is invoked
+const diffToolKey = "diff.tool"
+
+var (
+	difftoolDirDiff bool
+	difftoolTool    string
+	difftoolCached  bool
+)
+
+// DifftoolHandler shows the changes diff would print in an external tool,
+// once per file or once for the whole tree with --dir-diff
+func DifftoolHandler(repo *core.Repository, args []string) error {
+	toolCmd, err := resolveDiffTool(repo)
+	if err != nil {
+		return err
+	}
+
+	src, dst, paths := diffSources(repo.Root, args, difftoolCached)
+	srcFiles, err := getFilesFromRef(repo.Root, src)
+	if err != nil {
+		return fmt.Errorf("failed to get files from source: %w", err)
+	}
+	dstFiles, err := getFilesFromRef(repo.Root, dst)
+	if err != nil {
+		return fmt.Errorf("failed to get files from destination: %w", err)
+	}
+	if len(paths) > 0 {
+		srcFiles = filterFilesByPaths(srcFiles, paths)
+		dstFiles = filterFilesByPaths(dstFiles, paths)
+	}
+
+	changed := changedFiles(srcFiles, dstFiles)
+	if len(changed) == 0 {
+		fmt.Println("No changes.")
+		return nil
+	}
+	if difftoolDirDiff {
+		return runDirDiff(repo, toolCmd, srcFiles, dstFiles, changed, dst == "WORKTREE")
+	}
+	return runFileDiffs(repo, toolCmd, srcFiles, dstFiles, changed, dst == "WORKTREE")
+}
+
+// resolveDiffTool returns the shell command launching the tool from --tool
+// or diff.tool. It reads the compared paths from $LOCAL and $REMOTE.
+func resolveDiffTool(repo *core.Repository) (string, error) {
+	tool := difftoolTool
+	if tool == "" {
+		value, err := repo.GetConfig(diffToolKey)
+		if err != nil {
+			return "", core.ConfigError("failed to read "+diffToolKey, err)
+		}
+		tool = value
+	}
+	if tool == "" {
+		return "", core.ConfigError("no diff tool configured; set "+diffToolKey+" or use --tool", nil)
+	}
+
+	key := fmt.Sprintf("difftool.%s.cmd", tool)
+	command, err := repo.GetConfig(key)
+	if err != nil {
+		return "", core.ConfigError("failed to read "+key, err)
+	}
+	if command == "" {
+		command = tool + ` "$LOCAL" "$REMOTE"`
+	}
+	return command, nil
+}
+
+// changedFiles lists, sorted, the paths whose content differs between the
+// two sides, including paths present on only one of them
+func changedFiles(src, dst map[string]string) []string {
+	var changed []string
+	for path, content := range src {
+		if other, ok := dst[path]; !ok || other != content {
+			changed = append(changed, path)
+		}
+	}
+	for path := range dst {
+		if _, ok := src[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// runDiffTool runs toolCmd through the shell with LOCAL and REMOTE set
+func runDiffTool(toolCmd, local, remote string) error {
+	execCmd := exec.Command("sh", "-c", toolCmd)
+	execCmd.Env = append(os.Environ(), "LOCAL="+local, "REMOTE="+remote)
+	execCmd.Stdin = os.Stdin
+	execCmd.Stdout = os.Stdout
+	execCmd.Stderr = os.Stderr
+	if err := execCmd.Run(); err != nil {
+		return fmt.Errorf("diff tool failed: %w", err)
+	}
+	return nil
+}
+
+// runFileDiffs launches the tool once per changed file. Files missing on a
+// side compare against the null device; working tree files are passed
+// directly so edits land in place.
+func runFileDiffs(repo *core.Repository, toolCmd string, src, dst map[string]string, changed []string, worktree bool) error {
+	for _, path := range changed {
+		local, err := diffSideFile(repo, path, src)
+		if err != nil {
+			return err
+		}
+		remote := filepath.Join(repo.Root, path)
+		if _, ok := dst[path]; !ok || !worktree {
+			if remote, err = diffSideFile(repo, path, dst); err != nil {
+				core.RemoveTempFile(local)
+				return err
+			}
+		}
+
+		err = runDiffTool(toolCmd, local, remote)
+		for _, file := range []string{local, remote} {
+			if file != os.DevNull && file != filepath.Join(repo.Root, path) {
+				core.RemoveTempFile(file)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// diffSideFile writes the content of path on one side to a temporary file,
+// or returns the null device when the side doesn't have it
+func diffSideFile(repo *core.Repository, path string, files map[string]string) (string, error) {
+	content, ok := files[path]
+	if !ok {
+		return os.DevNull, nil
+	}
+	file, err := core.CreateTempFile(repo.Root, "difftool", "_"+filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+	_, err = file.WriteString(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		core.RemoveTempFile(file.Name())
+		return "", fmt.Errorf("failed to write temporary copy of %s: %w", path, err)
+	}
+	return file.Name(), nil
+}
+
+// runDirDiff writes the changed files of each side into left/ and right/
+// of a temporary directory and launches the tool once on the two trees.
+// When the right side is the working tree, edits made to right/ are copied
+// back to files that haven't changed meanwhile.
+func runDirDiff(repo *core.Repository, toolCmd string, src, dst map[string]string, changed []string, worktree bool) error {
+	tmpDir, err := core.CreateTempDir(repo.Root, "difftool")
+	if err != nil {
+		return err
+	}
+	leftDir, rightDir := filepath.Join(tmpDir, "left"), filepath.Join(tmpDir, "right")
+	if err := writeDiffTree(leftDir, src, changed); err != nil {
+		core.RemoveTempFile(tmpDir)
+		return err
+	}
+	if err := writeDiffTree(rightDir, dst, changed); err != nil {
+		core.RemoveTempFile(tmpDir)
+		return err
+	}
+
+	toolErr := runDiffTool(toolCmd, leftDir, rightDir)
+	keep := false
+	if worktree {
+		if keep, err = copyBackDirDiffEdits(repo, rightDir, dst, changed); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			keep = true
+		}
+	}
+	if keep {
+		fmt.Fprintf(os.Stderr, "Temporary files kept in %s\n", tmpDir)
+	} else {
+		core.RemoveTempFile(tmpDir)
+	}
+	return toolErr
+}
+
+// writeDiffTree writes the content of each path present in files under dir
+func writeDiffTree(dir string, files map[string]string, paths []string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	for _, path := range paths {
+		content, ok := files[path]
+		if !ok {
+			continue
+		}
+		target := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", path, err)
+		}
+		if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write temporary copy of %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// copyBackDirDiffEdits writes files edited in rightDir back to the working
+// tree. A file changed in the working tree while the tool ran isn't
+// overwritten; it is reported and keep is set so the edited copy survives.
+func copyBackDirDiffEdits(repo *core.Repository, rightDir string, written map[string]string, changed []string) (keep bool, err error) {
+	for _, path := range changed {
+		original, ok := written[path]
+		if !ok {
+			continue
+		}
+		edited, err := os.ReadFile(filepath.Join(rightDir, path))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return keep, fmt.Errorf("failed to read edited %s: %w", path, err)
+		}
+		if bytes.Equal(edited, []byte(original)) {
+			continue
+		}
+
+		target := filepath.Join(repo.Root, path)
+		current, err := os.ReadFile(target)
+		if err != nil && !os.IsNotExist(err) {
+			return keep, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if err != nil || string(current) != original {
+			fmt.Fprintf(os.Stderr, "warning: %s changed in both the working tree and the diff tool; not copied back\n", path)
+			keep = true
+			continue
+		}
+
+		mode := os.FileMode(0644)
+		if info, err := os.Stat(target); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := os.WriteFile(target, edited, mode); err != nil {
+			return keep, fmt.Errorf("failed to copy back %s: %w", path, err)
+		}
+	}
+	return keep, nil
+}
+
+var difftoolCmd *cobra.Command
+
+func init() {
+	difftoolCmd = NewRepoCommand(
+		"difftool [<options>] [<commit> [<commit>]] [--] [<path>...]",
+		"Show changes using an external diff tool",
+		DifftoolHandler,
+	)
+	difftoolCmd.Long = `Show the changes 'vec diff' would print in an external tool. The tool is
+taken from --tool or diff.tool and launched as difftool.<tool>.cmd, or as
+'<tool> "$LOCAL" "$REMOTE"' when that isn't set; $LOCAL and $REMOTE hold
+the paths of the two sides.
+
+By default the tool runs once per changed file. With --dir-diff both sides
+are written into temporary directory trees holding the changed files and
+the tool runs once to compare them. When the right side is the working
+tree, edits made there are copied back to the working tree afterwards; a
+file that also changed in the working tree meanwhile is left alone and the
+temporary directory is kept.
+
+Examples:
+  vec difftool                      # Compare the working tree with the index, file by file
+  vec difftool -d -t meld           # Compare the whole tree at once in meld
+  vec difftool -d --cached          # Compare the index with HEAD
+  vec difftool -d HEAD~1 HEAD       # Compare two commits`
+
+	difftoolCmd.Flags().BoolVarP(&difftoolDirDiff, "dir-diff", "d", false, "Compare whole directory trees with one tool invocation")
+	difftoolCmd.Flags().StringVarP(&difftoolTool, "tool", "t", "", "Diff tool to use instead of diff.tool")
+	difftoolCmd.Flags().BoolVar(&difftoolCached, "cached", false, "Compare the index with HEAD")
+
+	rootCmd.AddCommand(difftoolCmd)
+}
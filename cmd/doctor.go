@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/doctor"
+	"github.com/spf13/cobra"
+)
+
+var doctorList bool
+
+var doctorCmd *cobra.Command
+
+// DoctorHandler runs the repository checks and suggests a fix for each
+// problem found
+func DoctorHandler(repo *core.Repository, args []string) error {
+	if doctorList {
+		for _, check := range doctor.Checks {
+			fmt.Printf("%-12s %s\n", check.Name, check.Description)
+		}
+		return nil
+	}
+
+	findings, err := doctor.RunRepo(repo, args)
+	if err != nil {
+		return err
+	}
+	if len(findings) == 0 {
+		fmt.Println("No problems found")
+		return nil
+	}
+	for _, f := range findings {
+		fmt.Printf("%s: %s\n", f.Check, f.Problem)
+		if f.Fix != "" {
+			fmt.Printf("  fix: %s\n", f.Fix)
+		}
+	}
+	fmt.Printf("%d problem%s found\n", len(findings), plural(len(findings)))
+	return silentExit(doctorCmd, 1)
+}
+
+func init() {
+	doctorCmd = NewRepoCommand(
+		"doctor [<check>...]",
+		"Check the repository for common problems",
+		DoctorHandler,
+	)
+	doctorCmd.Long = `Look for common problems in the repository and print, for each one found,
+the command that fixes it. Nothing is changed.
+
+The checks cover lock files left by interrupted commands, a HEAD or index
+naming missing objects, conflicts left in the index, branches that could
+track a remote branch but don't, upstreams on removed remotes, more loose
+objects than gc.auto (6700 by default) allows, expired tokens stored for
+remotes, and hooks that can't run. Name checks to run only those; --list
+shows them all.
+
+Exits with status 1 when a problem is found.
+
+Examples:
+  vec doctor                             # Run every check
+  vec doctor hooks credentials           # Run only these checks
+  vec doctor --list                      # Show the available checks`
+
+	doctorCmd.Flags().BoolVar(&doctorList, "list", false, "List the available checks")
+
+	rootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,396 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/packfile"
+	"github.com/spf13/cobra"
+)
+
+var (
+	encryptionPassphraseFile string
+	encryptionKeychain       bool
+)
+
+// encryptionCmd groups the object store encryption commands
+var encryptionCmd = &cobra.Command{
+	Use:   "encryption",
+	Short: "Manage encryption of the object store at rest",
+	Long: `With ` + core.EncryptObjectsKey + ` on, loose objects are written encrypted with
+AES-256-GCM under a random repository key. The key is kept in .vec/` + core.ObjectKeyFile + `,
+wrapped with a passphrase, and is unlocked with the passphrase from
+` + core.ObjectPassphraseEnv + ` or, failing that, from the OS keychain.
+
+Objects are decrypted transparently when read, and plain and encrypted
+objects can live side by side. Packfiles can't be encrypted, so while
+encryption is on gc keeps objects loose instead of packing them, and
+'vec encryption apply' unpacks the existing packs into encrypted loose
+objects. Unreachable objects gc keeps in cruft packs are encrypted like
+loose ones. The index and refs are not encrypted.`,
+}
+
+// encryptionPassphrase returns the passphrase from --passphrase-file or the
+// environment
+func encryptionPassphrase() (string, error) {
+	if encryptionPassphraseFile != "" {
+		content, err := os.ReadFile(encryptionPassphraseFile)
+		if err != nil {
+			return "", core.FSError(fmt.Sprintf("failed to read passphrase file '%s'", encryptionPassphraseFile), err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+	return os.Getenv(core.ObjectPassphraseEnv), nil
+}
+
+// EncryptionInitHandler creates the repository key and turns encryption on
+func EncryptionInitHandler(repo *core.Repository, args []string) error {
+	passphrase, err := encryptionPassphrase()
+	if err != nil {
+		return err
+	}
+	if passphrase == "" {
+		return fmt.Errorf("a passphrase is required from --passphrase-file or %s", core.ObjectPassphraseEnv)
+	}
+	id, err := core.InitObjectEncryption(repo.Root, passphrase)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created object key %s; new objects are now encrypted\n", id)
+	if encryptionKeychain {
+		if err := core.StoreKeychainPassphrase(id, passphrase); err != nil {
+			return err
+		}
+		fmt.Println("Stored the passphrase in the OS keychain")
+	}
+	fmt.Println("Run 'vec encryption apply' to encrypt the existing objects")
+	return nil
+}
+
+// EncryptionKeychainHandler stores the passphrase in the OS keychain once
+// it is checked against the repository key
+func EncryptionKeychainHandler(repo *core.Repository, args []string) error {
+	passphrase, err := encryptionPassphrase()
+	if err != nil {
+		return err
+	}
+	if passphrase == "" {
+		return fmt.Errorf("a passphrase is required from --passphrase-file or %s", core.ObjectPassphraseEnv)
+	}
+	if err := core.UnlockObjectStore(repo.Root, passphrase); err != nil {
+		return err
+	}
+	id, err := core.ObjectKeyID(repo.Root)
+	if err != nil {
+		return err
+	}
+	if err := core.StoreKeychainPassphrase(id, passphrase); err != nil {
+		return err
+	}
+	fmt.Printf("Stored the passphrase for object key %s in the OS keychain\n", id)
+	return nil
+}
+
+// looseObjectFiles returns the paths of the loose objects of the repository
+func looseObjectFiles(repo *core.Repository) ([]string, error) {
+	dirs, err := os.ReadDir(filepath.Join(repo.VecDir, "objects"))
+	if err != nil {
+		return nil, core.FSError("failed to read the object store", err)
+	}
+	var paths []string
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(repo.VecDir, "objects", dir.Name()))
+		if err != nil {
+			return nil, core.FSError("failed to read the object store", err)
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), "tmp") {
+				paths = append(paths, filepath.Join(repo.VecDir, "objects", dir.Name(), entry.Name()))
+			}
+		}
+	}
+	return paths, nil
+}
+
+// isEncryptedObjectFile reads enough of path to tell whether it is encrypted
+func isEncryptedObjectFile(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	head := make([]byte, 16)
+	n, _ := f.Read(head)
+	return core.IsEncryptedObject(head[:n]), nil
+}
+
+// packDir returns the directory holding the packs and cruft packs
+func packDir(repo *core.Repository) string {
+	return filepath.Join(repo.ObjectsDir, "pack")
+}
+
+// packedObjectCounts returns how many objects the packs hold encrypted and
+// plain. Packfiles are always plain; cruft packs hold loose object files,
+// each of which may be either.
+func packedObjectCounts(repo *core.Repository) (encrypted, plain int, err error) {
+	packs, err := filepath.Glob(filepath.Join(packDir(repo), "*.pack"))
+	if err != nil {
+		return 0, 0, core.FSError("failed to list packs", err)
+	}
+	for _, packPath := range packs {
+		ids, err := packfile.PackObjectIDs(packPath)
+		if err != nil {
+			return 0, 0, core.ObjectError(fmt.Sprintf("failed to read pack %s", filepath.Base(packPath)), err)
+		}
+		plain += len(ids)
+	}
+	cruftPacks, err := packfile.CruftPackPaths(packDir(repo))
+	if err != nil {
+		return 0, 0, core.FSError("failed to list cruft packs", err)
+	}
+	for _, packPath := range cruftPacks {
+		objects, err := packfile.ReadCruftPack(packPath)
+		if err != nil {
+			return 0, 0, core.ObjectError(fmt.Sprintf("failed to read cruft pack %s", filepath.Base(packPath)), err)
+		}
+		for _, obj := range objects {
+			if core.IsEncryptedObject(obj.Data) {
+				encrypted++
+			} else {
+				plain++
+			}
+		}
+	}
+	return encrypted, plain, nil
+}
+
+// EncryptionStatusHandler reports whether encryption is on and how many
+// loose and packed objects are encrypted
+func EncryptionStatusHandler(repo *core.Repository, args []string) error {
+	id, err := core.ObjectKeyID(repo.Root)
+	if err != nil {
+		return err
+	}
+	paths, err := looseObjectFiles(repo)
+	if err != nil {
+		return err
+	}
+	encrypted := 0
+	for _, path := range paths {
+		if ok, err := isEncryptedObjectFile(path); err == nil && ok {
+			encrypted++
+		}
+	}
+	packedEncrypted, packedPlain, err := packedObjectCounts(repo)
+	if err != nil {
+		return err
+	}
+
+	state := "off"
+	if core.ObjectEncryptionEnabled(repo.Root) {
+		state = "on"
+	}
+	fmt.Printf("Encryption: %s\n", state)
+	if id != "" {
+		fmt.Printf("Object key: %s\n", id)
+	}
+	fmt.Printf("Loose objects: %d encrypted, %d plain\n", encrypted, len(paths)-encrypted)
+	fmt.Printf("Packed objects: %d encrypted, %d plain\n", packedEncrypted, packedPlain)
+	return nil
+}
+
+// replaceObjectFile writes stored to path through a temporary file, so an
+// interrupted run leaves every object either whole or absent
+func replaceObjectFile(path string, stored []byte, perm os.FileMode) error {
+	tmpPath := filepath.Join(filepath.Dir(path), "tmp_"+filepath.Base(path))
+	if err := os.WriteFile(tmpPath, stored, perm); err != nil {
+		os.Remove(tmpPath)
+		return core.FSError(fmt.Sprintf("failed to write object %s", path), err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return core.FSError(fmt.Sprintf("failed to replace object %s", path), err)
+	}
+	return nil
+}
+
+// unpackPacksEncrypted writes the objects of every pack that aren't loose
+// yet as encrypted loose objects, then removes the packs. It returns how
+// many objects it wrote and how many packs it removed.
+func unpackPacksEncrypted(repo *core.Repository) (int, int, error) {
+	packs, err := filepath.Glob(filepath.Join(packDir(repo), "*.pack"))
+	if err != nil {
+		return 0, 0, core.FSError("failed to list packs", err)
+	}
+	written := 0
+	for _, packPath := range packs {
+		ids, err := packfile.PackObjectIDs(packPath)
+		if err != nil {
+			return written, 0, core.ObjectError(fmt.Sprintf("failed to read pack %s", filepath.Base(packPath)), err)
+		}
+		for _, id := range ids {
+			objectPath := filepath.Join(repo.ObjectsDir, id[:2], id[2:])
+			if core.FileExists(objectPath) {
+				continue
+			}
+			content, err := packfile.ReadObjectRepo(repo, id)
+			if err != nil {
+				return written, 0, core.ObjectError(fmt.Sprintf("failed to read object %s", id), err)
+			}
+			stored, err := core.EncodeObjectFile(repo.Root, content)
+			if err != nil {
+				return written, 0, err
+			}
+			if err := core.EnsureDirExists(filepath.Dir(objectPath)); err != nil {
+				return written, 0, core.FSError("failed to create object directory", err)
+			}
+			if err := replaceObjectFile(objectPath, stored, 0444); err != nil {
+				return written, 0, err
+			}
+			written++
+		}
+	}
+
+	// Only once every object is loose do the packs go, the index first as
+	// it is what makes readers trust a pack
+	for _, packPath := range packs {
+		base := strings.TrimSuffix(packPath, ".pack")
+		if err := os.Remove(base + ".idx"); err != nil && !os.IsNotExist(err) {
+			return written, 0, core.FSError(fmt.Sprintf("failed to remove %s", filepath.Base(base+".idx")), err)
+		}
+		if err := os.Remove(packPath); err != nil {
+			return written, 0, core.FSError(fmt.Sprintf("failed to remove %s", filepath.Base(packPath)), err)
+		}
+	}
+	if len(packs) > 0 {
+		// Drops the multi-pack-index layers of the removed packs
+		if _, err := packfile.WriteMultiPackIndexRepo(repo); err != nil {
+			return written, len(packs), err
+		}
+	}
+	return written, len(packs), nil
+}
+
+// encryptCruftPacks rewrites the cruft packs holding plain objects with
+// those objects encrypted and returns how many objects it encrypted
+func encryptCruftPacks(repo *core.Repository) (int, error) {
+	cruftPacks, err := packfile.CruftPackPaths(packDir(repo))
+	if err != nil {
+		return 0, core.FSError("failed to list cruft packs", err)
+	}
+	count := 0
+	for _, packPath := range cruftPacks {
+		objects, err := packfile.ReadCruftPack(packPath)
+		if err != nil {
+			return count, core.ObjectError(fmt.Sprintf("failed to read cruft pack %s", filepath.Base(packPath)), err)
+		}
+		sealed := 0
+		for i := range objects {
+			if core.IsEncryptedObject(objects[i].Data) {
+				continue
+			}
+			if objects[i].Data, err = core.EncodeObjectFile(repo.Root, objects[i].Data); err != nil {
+				return count, err
+			}
+			sealed++
+		}
+		if sealed == 0 {
+			continue
+		}
+		newPath, err := packfile.WriteCruftPack(packDir(repo), objects, time.Now())
+		if err != nil {
+			return count, err
+		}
+		if newPath != packPath {
+			if err := os.Remove(packPath); err != nil {
+				return count, core.FSError(fmt.Sprintf("failed to remove %s", filepath.Base(packPath)), err)
+			}
+		}
+		count += sealed
+	}
+	return count, nil
+}
+
+// EncryptionApplyHandler rewrites the plain loose objects encrypted, unpacks
+// the packs into encrypted loose objects and encrypts the cruft packs
+func EncryptionApplyHandler(repo *core.Repository, args []string) error {
+	if !core.ObjectEncryptionEnabled(repo.Root) {
+		return fmt.Errorf("%s is off; run 'vec encryption init' first", core.EncryptObjectsKey)
+	}
+	if err := core.CheckObjectStoreUnlocked(repo.Root); err != nil {
+		return err
+	}
+	paths, err := looseObjectFiles(repo)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return core.FSError(fmt.Sprintf("failed to read object %s", path), err)
+		}
+		if core.IsEncryptedObject(raw) {
+			continue
+		}
+		stored, err := core.EncodeObjectFile(repo.Root, raw)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return core.FSError(fmt.Sprintf("failed to stat object %s", path), err)
+		}
+		// Replace the object atomically so an interrupted run leaves every
+		// object either plain or encrypted
+		if err := replaceObjectFile(path, stored, info.Mode().Perm()); err != nil {
+			return err
+		}
+		count++
+	}
+	fmt.Printf("Encrypted %d loose object(s)\n", count)
+
+	unpacked, removed, err := unpackPacksEncrypted(repo)
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		fmt.Printf("Unpacked %d object(s) from %d pack(s) as encrypted loose objects\n", unpacked, removed)
+	}
+	crufted, err := encryptCruftPacks(repo)
+	if err != nil {
+		return err
+	}
+	if crufted > 0 {
+		fmt.Printf("Encrypted %d object(s) in cruft packs\n", crufted)
+	}
+	return nil
+}
+
+func init() {
+	initCmd := NewRepoCommand("init", "Create the repository key and encrypt new objects", EncryptionInitHandler)
+	initCmd.Args = cobra.NoArgs
+	initCmd.Flags().StringVar(&encryptionPassphraseFile, "passphrase-file", "", "Read the passphrase from this file")
+	initCmd.Flags().BoolVar(&encryptionKeychain, "keychain", false, "Also store the passphrase in the OS keychain")
+
+	keychainCmd := NewRepoCommand("keychain", "Store the passphrase in the OS keychain", EncryptionKeychainHandler)
+	keychainCmd.Args = cobra.NoArgs
+	keychainCmd.Flags().StringVar(&encryptionPassphraseFile, "passphrase-file", "", "Read the passphrase from this file")
+
+	statusCmd := NewRepoCommand("status", "Show whether objects are encrypted", EncryptionStatusHandler)
+	statusCmd.Args = cobra.NoArgs
+
+	applyCmd := NewRepoCommand("apply", "Encrypt the existing plain objects, unpacking the packs", EncryptionApplyHandler)
+	applyCmd.Args = cobra.NoArgs
+
+	encryptionCmd.AddCommand(initCmd, keychainCmd, statusCmd, applyCmd)
+	rootCmd.AddCommand(encryptionCmd)
+}
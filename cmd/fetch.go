@@ -8,22 +8,27 @@ import (
 
 	"github.com/NahomAnteneh/vec/core"
 	"github.com/NahomAnteneh/vec/internal/config"
+	"github.com/NahomAnteneh/vec/internal/maintenance"
 	"github.com/NahomAnteneh/vec/internal/remote"
 	"github.com/spf13/cobra"
 )
 
 var (
 	// Fetch command options
-	fetchAllRemotes bool
-	fetchPrune      bool
-	fetchQuiet      bool
-	fetchVerbose    bool
-	fetchForce      bool
-	fetchDepth      int
-	fetchTags       bool
-	fetchBranch     string
-	fetchDryRun     bool
-	fetchProgress   bool
+	fetchAllRemotes      bool
+	fetchPrune           bool
+	fetchQuiet           bool
+	fetchVerbose         bool
+	fetchForce           bool
+	fetchDepth           int
+	fetchDeepen          int
+	fetchUnshallow       bool
+	fetchTags            bool
+	fetchNoTags          bool
+	fetchBranch          string
+	fetchDryRun          bool
+	fetchProgress        bool
+	fetchNegotiationTips []string
 )
 
 // FetchHandler handles the fetch command logic using the repository context
@@ -31,6 +36,16 @@ func FetchHandler(repo *core.Repository, args []string) error {
 	// Start time measurement for performance reporting
 	startTime := time.Now()
 
+	if fetchTags && fetchNoTags {
+		return core.RemoteError("--tags and --no-tags cannot be used together", nil)
+	}
+	if fetchDepth < 0 || fetchDeepen < 0 {
+		return core.RemoteError("depth must be a positive number", nil)
+	}
+	if (fetchDepth > 0 && fetchDeepen > 0) || (fetchUnshallow && (fetchDepth > 0 || fetchDeepen > 0)) {
+		return core.RemoteError("--depth, --deepen and --unshallow cannot be used together", nil)
+	}
+
 	// Load configuration
 	cfg, err := config.LoadConfigRepo(repo)
 	if err != nil {
@@ -71,11 +86,16 @@ func FetchHandler(repo *core.Repository, args []string) error {
 		Verbose:   fetchVerbose,
 		Force:     fetchForce,
 		Depth:     fetchDepth,
+		Deepen:    fetchDeepen,
+		Unshallow: fetchUnshallow,
 		FetchTags: fetchTags,
+		NoTags:    fetchNoTags,
 		Branch:    fetchBranch,
 		DryRun:    fetchDryRun,
 		Progress:  fetchProgress,
 		Prune:     fetchPrune,
+
+		NegotiationTips: fetchNegotiationTips,
 	}
 
 	// Fetch from each remote
@@ -110,6 +130,9 @@ func FetchHandler(repo *core.Repository, args []string) error {
 		} else {
 			result.Success = true
 			anySuccess = true
+			if !fetchDryRun {
+				core.RecordAudit(repo.Root, core.AuditFetch, remoteName, "", "")
+			}
 			if !fetchQuiet {
 				fmt.Printf("Successfully fetched from '%s'\n", remoteName)
 			}
@@ -134,6 +157,13 @@ func FetchHandler(repo *core.Repository, args []string) error {
 		return core.RemoteError("failed to fetch from any remote", nil)
 	}
 
+	// Keep the commit-graph and multi-pack-index in step with the new objects
+	if !fetchDryRun {
+		if err := maintenance.AfterFetchRepo(repo); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: post-fetch maintenance failed: %v\n", err)
+		}
+	}
+
 	return nil
 }
 
@@ -186,7 +216,38 @@ Examples:
   vec fetch --prune             # Remove deleted remote branches
   vec fetch --verbose           # Show detailed fetch information
   vec fetch --depth=1           # Shallow fetch with depth 1
+  vec fetch --deepen=10         # Fetch 10 more commits of a shallow history
+  vec fetch --unshallow         # Fetch all the history left out
   vec fetch --tags              # Fetch all tags
+  vec fetch --no-tags           # Fetch branches only
+
+By default, tags pointing into the fetched history are fetched too. Set
+remote.<name>.tagOpt to --tags or --no-tags to change the default per remote.
+
+--depth=<n> fetches only the last n commits of each branch. The commits
+whose parents were left out are listed in .vec/shallow, and history
+commands such as log stop at them as if they had no parents. --deepen=<n>
+fetches n more commits below them, and --unshallow the rest of the history,
+after which the repository is complete again.
+
+The packfile is downloaded into .vec/tmp. An interrupted download is retried
+up to transfer.resumeAttempts times in all (default 3), each retry asking the
+server only for the rest of the pack; a download that still fails is kept,
+and the next fetch of the same objects resumes it. The pack's trailing
+checksum is verified before it is unpacked.
+
+The ref advertisement is cached in .vec/cache/refs with the server's ETag and
+Last-Modified headers. When the server reports it unchanged since a completed
+fetch, the fetch ends without negotiating.
+
+Negotiation offers the tips of all local refs as objects the repository has.
+In large repositories, --negotiation-tip or fetch.negotiationTip (a comma
+separated list) restrict them to refs matching the given names or glob
+patterns, e.g. 'main,origin/*'.
+
+Branches prefetched into refs/prefetch/ by vec maintenance (see the prefetch
+task) are offered too, so a fetch after a prefetch transfers little or
+nothing and only moves the remote-tracking refs.
 `
 	fetchCmd.Args = cobra.MaximumNArgs(1)
 
@@ -197,10 +258,14 @@ Examples:
 	fetchCmd.Flags().BoolVar(&fetchVerbose, "verbose", false, "Be verbose")
 	fetchCmd.Flags().BoolVar(&fetchForce, "force", false, "Force update of local branches")
 	fetchCmd.Flags().IntVar(&fetchDepth, "depth", 0, "Create a shallow clone with a history truncated to the specified number of commits")
+	fetchCmd.Flags().IntVar(&fetchDeepen, "deepen", 0, "Fetch this many more commits below the shallow boundary")
+	fetchCmd.Flags().BoolVar(&fetchUnshallow, "unshallow", false, "Fetch the history a shallow fetch left out")
 	fetchCmd.Flags().BoolVar(&fetchTags, "tags", false, "Fetch all tags and associated objects")
+	fetchCmd.Flags().BoolVar(&fetchNoTags, "no-tags", false, "Don't fetch tags, not even those pointing into fetched history")
 	fetchCmd.Flags().StringVar(&fetchBranch, "branch", "", "Fetch a specific branch")
 	fetchCmd.Flags().BoolVar(&fetchDryRun, "dry-run", false, "Show what would be done, without making actual changes")
 	fetchCmd.Flags().BoolVar(&fetchProgress, "progress", true, "Show progress during fetch")
+	fetchCmd.Flags().StringArrayVar(&fetchNegotiationTips, "negotiation-tip", nil, "Only offer local refs matching this name or glob during negotiation; repeatable")
 
 	rootCmd.AddCommand(fetchCmd)
 }
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// reservedFlagDefaultKeys are <command>.<flag> keys that already configure
+// something else, with values the flag of the same name doesn't take
+var reservedFlagDefaultKeys = map[string]bool{
+	"merge.ff":             true, // true, false or only; see mergeFastForwardMode
+	"pull.rebase":          true, // Read by pull itself, so --no-rebase can override it
+	"fetch.negotiationTip": true, // A comma or space separated list, split by fetch
+}
+
+// flagDefaultKey returns the config key holding the default of flag on cmd:
+// the command path below vec joined with dots, then the flag name in
+// camelCase, e.g. status.short or push.noSizeCheck
+func flagDefaultKey(cmd *cobra.Command, flag *pflag.Flag) string {
+	path := strings.Fields(cmd.CommandPath())[1:]
+	words := strings.Split(flag.Name, "-")
+	for i := 1; i < len(words); i++ {
+		if words[i] != "" {
+			words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+		}
+	}
+	return strings.Join(append(path, strings.Join(words, "")), ".")
+}
+
+// flagDefaultSpec returns the spec of key if it holds a flag default,
+// typed after the flag, or nil
+func flagDefaultSpec(key string) *core.ConfigKeySpec {
+	var found *core.ConfigKeySpec
+	var visit func(cmd *cobra.Command)
+	visit = func(cmd *cobra.Command) {
+		for _, sub := range cmd.Commands() {
+			if found != nil {
+				return
+			}
+			sub.Flags().VisitAll(func(flag *pflag.Flag) {
+				name := flagDefaultKey(sub, flag)
+				if found != nil || flag.Name == "help" || reservedFlagDefaultKeys[name] || !strings.EqualFold(name, key) {
+					return
+				}
+				spec := &core.ConfigKeySpec{Name: name, Type: core.ConfigString}
+				switch flag.Value.Type() {
+				case "bool":
+					spec.Type = core.ConfigBool
+				case "int", "int64", "uint", "uint64":
+					spec.Type = core.ConfigInt
+				case "duration":
+					spec.Type = core.ConfigDuration
+				}
+				found = spec
+			})
+			visit(sub)
+		}
+	}
+	visit(rootCmd)
+	return found
+}
+
+// applyFlagDefaults sets each flag of cmd not given on the command line from
+// its config key, so command-line flags always win. Flags set this way
+// aren't marked as changed; commands still see them as defaults.
+func applyFlagDefaults(cmd *cobra.Command) error {
+	if !cmd.HasParent() || cmd.DisableFlagParsing {
+		return nil
+	}
+	repoRoot, err := core.GetVecRoot()
+	if err != nil {
+		repoRoot = "" // Outside a repository only global config applies
+	}
+
+	var applyErr error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if applyErr != nil || flag.Changed || flag.Name == "help" {
+			return
+		}
+		key := flagDefaultKey(cmd, flag)
+		if reservedFlagDefaultKeys[key] {
+			return
+		}
+		value, err := core.GetConfigValue(repoRoot, key)
+		if err != nil {
+			applyErr = core.ConfigError("failed to read "+key, err)
+			return
+		}
+		if value == "" {
+			return
+		}
+		if flag.Value.Type() == "bool" {
+			switch strings.ToLower(strings.TrimSpace(value)) {
+			case "true", "yes", "on", "1":
+				value = "true"
+			case "false", "no", "off", "0":
+				value = "false"
+			}
+		}
+		if err := flag.Value.Set(value); err != nil {
+			applyErr = core.ConfigError(fmt.Sprintf("invalid value '%s' for %s", value, key), err)
+		}
+	})
+	return applyErr
+}
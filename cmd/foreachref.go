@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/spf13/cobra"
+)
+
+// defaultRefFormat matches the output of git for-each-ref
+const defaultRefFormat = "%(objectname) %(objecttype)\t%(refname)"
+
+var (
+	forEachRefFormat string
+	forEachRefSort   []string
+	forEachRefCount  int
+)
+
+// refFields lists the atoms a format may use; each accepts :short
+var refFields = []string{"refname", "objectname", "objecttype", "upstream", "committerdate", "authordate", "subject", "HEAD"}
+
+// refInfo is a ref with the details format atoms read, loaded on demand
+type refInfo struct {
+	repo   *core.Repository
+	ref    core.Ref
+	head   string
+	loaded bool
+	kind   string
+	commit *objects.Commit
+}
+
+// object loads the type, and for commits the commit, the ref points to
+func (r *refInfo) object() (string, *objects.Commit) {
+	if !r.loaded {
+		r.loaded = true
+		if objType, _, err := r.repo.ReadObject(r.ref.Hash); err == nil {
+			r.kind = objType
+		}
+		if r.kind == "commit" {
+			r.commit, _ = objects.GetCommitRepo(r.repo, r.ref.Hash)
+		}
+	}
+	return r.kind, r.commit
+}
+
+// field returns the value of a format atom such as refname or
+// committerdate:iso for the ref
+func (r *refInfo) field(atom string) (string, error) {
+	name, modifier, _ := strings.Cut(atom, ":")
+	switch name {
+	case "refname":
+		if modifier == "short" {
+			return shortenRefName(r.ref.Name), nil
+		}
+		return r.ref.Name, nil
+	case "objectname":
+		if modifier == "short" {
+			return shortCommitHash(r.ref.Hash), nil
+		}
+		return r.ref.Hash, nil
+	case "objecttype":
+		kind, _ := r.object()
+		return kind, nil
+	case "upstream":
+		if !strings.HasPrefix(r.ref.Name, "refs/heads/") {
+			return "", nil
+		}
+		if modifier == "track" || modifier == "trackshort" {
+			return r.upstreamTrack(modifier == "trackshort")
+		}
+		upstream, err := r.repo.GetBranchUpstream(strings.TrimPrefix(r.ref.Name, "refs/heads/"))
+		if err != nil || upstream == nil {
+			return "", err
+		}
+		if modifier == "short" {
+			return upstream.String(), nil
+		}
+		return upstream.TrackingRef(), nil
+	case "committerdate", "authordate":
+		_, commit := r.object()
+		if commit == nil {
+			return "", nil
+		}
+		if modifier == "" {
+			modifier = objects.DateDefault
+		} else if !objects.IsDateMode(modifier) {
+			return "", fmt.Errorf("unknown date format '%s'", modifier)
+		}
+		if name == "authordate" {
+			return objects.FormatDate(commit.AuthorTime(), modifier), nil
+		}
+		return objects.FormatDate(commit.CommitterTime(), modifier), nil
+	case "subject":
+		_, commit := r.object()
+		if commit == nil {
+			return "", nil
+		}
+		return commit.Subject(), nil
+	case "HEAD":
+		if r.ref.Name == r.head {
+			return "*", nil
+		}
+		return " ", nil
+	}
+	return "", fmt.Errorf("unknown field name: %s", name)
+}
+
+// upstreamTrack describes how the branch compares with its upstream:
+// "[ahead 1, behind 2]" or "[gone]", empty when in sync or without an
+// upstream. short gives ">", "<", "<>" or "=" instead.
+func (r *refInfo) upstreamTrack(short bool) (string, error) {
+	tracking, err := getTrackingInfo(r.repo, strings.TrimPrefix(r.ref.Name, "refs/heads/"), r.ref.Hash)
+	if err != nil || tracking == nil {
+		return "", err
+	}
+	if short {
+		switch {
+		case tracking.Gone:
+			return "", nil
+		case tracking.Ahead > 0 && tracking.Behind > 0:
+			return "<>", nil
+		case tracking.Ahead > 0:
+			return ">", nil
+		case tracking.Behind > 0:
+			return "<", nil
+		}
+		return "=", nil
+	}
+	switch {
+	case tracking.Gone:
+		return "[gone]", nil
+	case tracking.Ahead > 0 && tracking.Behind > 0:
+		return fmt.Sprintf("[ahead %d, behind %d]", tracking.Ahead, tracking.Behind), nil
+	case tracking.Ahead > 0:
+		return fmt.Sprintf("[ahead %d]", tracking.Ahead), nil
+	case tracking.Behind > 0:
+		return fmt.Sprintf("[behind %d]", tracking.Behind), nil
+	}
+	return "", nil
+}
+
+// expandRefFormat replaces each %(atom) in format with its value for ref.
+// %% is a literal percent sign.
+func expandRefFormat(format string, ref *refInfo) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' || i+1 >= len(format) {
+			out.WriteByte(c)
+			continue
+		}
+		switch format[i+1] {
+		case '%':
+			out.WriteByte('%')
+			i++
+		case '(':
+			end := strings.IndexByte(format[i:], ')')
+			if end < 0 {
+				return "", fmt.Errorf("malformed format string %s", format[i:])
+			}
+			value, err := ref.field(format[i+2 : i+end])
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(value)
+			i += end
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String(), nil
+}
+
+// sortRefs orders refs by the given keys, the last key being the primary one
+// as with git. A leading '-' reverses a key; dates compare chronologically.
+func sortRefs(refs []*refInfo, keys []string) error {
+	for _, key := range keys {
+		descending := strings.HasPrefix(key, "-")
+		key = strings.TrimPrefix(key, "-")
+		name, _, _ := strings.Cut(key, ":")
+
+		values := make(map[*refInfo]string, len(refs))
+		times := make(map[*refInfo]int64, len(refs))
+		for _, ref := range refs {
+			switch name {
+			case "committerdate", "authordate":
+				if _, commit := ref.object(); commit != nil {
+					times[ref] = commit.CommitterTime().Unix()
+					if name == "authordate" {
+						times[ref] = commit.AuthorTime().Unix()
+					}
+				}
+			default:
+				value, err := ref.field(key)
+				if err != nil {
+					return err
+				}
+				values[ref] = value
+			}
+		}
+
+		sort.SliceStable(refs, func(i, j int) bool {
+			a, b := refs[i], refs[j]
+			if descending {
+				a, b = b, a
+			}
+			if name == "committerdate" || name == "authordate" {
+				return times[a] < times[b]
+			}
+			return values[a] < values[b]
+		})
+	}
+	return nil
+}
+
+// matchRefPattern reports whether refName matches a for-each-ref pattern:
+// a glob, or a prefix ending at a path component boundary
+func matchRefPattern(refName, pattern string) bool {
+	if strings.ContainsAny(pattern, "*?[") {
+		ok, _ := path.Match(pattern, refName)
+		return ok
+	}
+	pattern = strings.TrimSuffix(pattern, "/")
+	return refName == pattern || strings.HasPrefix(refName, pattern+"/")
+}
+
+// shortenRefName strips the namespace from a full ref name
+func shortenRefName(name string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+		if strings.HasPrefix(name, prefix) {
+			return strings.TrimPrefix(name, prefix)
+		}
+	}
+	return strings.TrimPrefix(name, "refs/")
+}
+
+// shortCommitHash abbreviates an object ID for display
+func shortCommitHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
+
+// loadRefInfos lists the refs matching any of patterns (all refs if none)
+func loadRefInfos(repo *core.Repository, patterns []string) ([]*refInfo, error) {
+	refs, err := repo.ListRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+	head, err := core.ReadHEADFile(repo.Root)
+	if err != nil {
+		return nil, err
+	}
+	head = strings.TrimPrefix(head, "ref: ")
+
+	var infos []*refInfo
+	for _, ref := range refs {
+		matched := len(patterns) == 0
+		for _, pattern := range patterns {
+			if matchRefPattern(ref.Name, pattern) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			infos = append(infos, &refInfo{repo: repo, ref: ref, head: head})
+		}
+	}
+	return infos, nil
+}
+
+// ForEachRefHandler prints the refs matching the given patterns using a format template
+func ForEachRefHandler(repo *core.Repository, args []string) error {
+	refs, err := loadRefInfos(repo, args)
+	if err != nil {
+		return err
+	}
+	keys := forEachRefSort
+	if len(keys) == 0 {
+		keys = []string{"refname"}
+	}
+	if err := sortRefs(refs, keys); err != nil {
+		return err
+	}
+	if forEachRefCount > 0 && len(refs) > forEachRefCount {
+		refs = refs[:forEachRefCount]
+	}
+
+	for _, ref := range refs {
+		line, err := expandRefFormat(forEachRefFormat, ref)
+		if err != nil {
+			return err
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+var forEachRefCmd *cobra.Command
+
+func init() {
+	forEachRefCmd = NewRepoCommand(
+		"for-each-ref [pattern...]",
+		"Print information about each ref",
+		ForEachRefHandler,
+	)
+	forEachRefCmd.Long = fmt.Sprintf(`List refs matching the given patterns (all refs if none), one line each.
+A pattern is a ref prefix such as refs/heads or a glob such as refs/tags/v*.
+
+The format replaces %%(<field>) with a value of the ref. Fields: %s.
+Each accepts :short; committerdate and authordate also accept a --date mode
+(e.g. %%(committerdate:iso)), and upstream accepts :track, such as
+[ahead 1, behind 2], or :trackshort, one of >, <, <> or =. %%%% prints a
+percent sign.
+
+Examples:
+  vec for-each-ref refs/heads
+  vec for-each-ref --format='%%(refname:short) %%(upstream:short)' refs/heads
+  vec for-each-ref --sort=-committerdate --count=5 --format='%%(committerdate:relative) %%(refname:short)'`,
+		strings.Join(refFields, ", "))
+
+	forEachRefCmd.Flags().StringVar(&forEachRefFormat, "format", defaultRefFormat, "Format template with %(field) placeholders")
+	forEachRefCmd.Flags().StringArrayVar(&forEachRefSort, "sort", nil, "Sort by a field, '-' prefix for descending; repeat for secondary keys (last is primary)")
+	forEachRefCmd.Flags().IntVar(&forEachRefCount, "count", 0, "Stop after printing this many refs")
+
+	rootCmd.AddCommand(forEachRefCmd)
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/fsck"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fsckJSON       bool
+	fsckNoDangling bool
+)
+
+var fsckCmd *cobra.Command
+
+// FsckHandler verifies the objects of the repository and the links between
+// them
+func FsckHandler(repo *core.Repository, args []string) error {
+	report, err := fsck.CheckRepo(repo, fsck.Options{Dangling: !fsckNoDangling})
+	if err != nil {
+		return err
+	}
+
+	if fsckJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	} else {
+		for _, p := range report.Problems {
+			fmt.Println(formatFsckProblem(p))
+		}
+		fmt.Fprintf(os.Stderr, "Checked %d loose object%s and %d packed in %d pack%s: %d error%s\n",
+			report.LooseObjects, plural(report.LooseObjects), report.PackedObjects,
+			report.Packs, plural(report.Packs), report.Errors(), plural(report.Errors()))
+	}
+	if report.Errors() > 0 {
+		return silentExit(fsckCmd, 1)
+	}
+	return nil
+}
+
+// formatFsckProblem renders a problem as "<kind> <type> <object>", followed
+// by where it was found and the details
+func formatFsckProblem(p fsck.Problem) string {
+	line := p.Kind
+	if p.Kind == fsck.KindBadPack {
+		line = "bad pack " + p.Pack
+	}
+	if p.Type != "" {
+		line += " " + p.Type
+	}
+	if p.Object != "" {
+		line += " " + p.Object
+	}
+	if p.From != "" {
+		line += " (" + p.From + ")"
+	} else if p.Pack != "" && p.Kind != fsck.KindBadPack {
+		line += " (in " + p.Pack + ")"
+	}
+	if p.Detail != "" {
+		line += ": " + p.Detail
+	}
+	return line
+}
+
+func init() {
+	fsckCmd = NewRepoCommand("fsck", "Verify the objects of the repository", FsckHandler)
+	fsckCmd.Args = cobra.NoArgs
+	fsckCmd.Long = `Verify the integrity of the object store. Nothing is changed.
+
+Every loose and packed object is hashed and checked against its name, and
+commits, trees and tags are checked to be well formed. Each pack must end
+with the checksum of its content and agree with its index: the same
+objects, and the pack checksum the index records. Then every tree, parent
+and tagged object a commit, tree or tag refers to, and every object HEAD,
+a ref, a reflog or the index names, must be in the store with the right
+type. Parents of the commits a shallow fetch cut off are not expected.
+
+Objects nothing refers to are reported as dangling; they are left over by
+amends, resets and the like, and removed by vec gc once they expire. They
+are not errors.
+
+Problems are printed one per line as "<kind> <type> <object>": corrupt,
+malformed, missing, wrong-type, bad pack or dangling. --json prints the
+whole report as one JSON document instead, with the counts of objects and
+packs checked and a list of problems, each with kind, object, type, pack,
+from and detail fields as they apply.
+
+Exits with status 1 when a problem other than a dangling object is found.
+
+Examples:
+  vec fsck                      # Check everything
+  vec fsck --no-dangling        # Leave out dangling objects
+  vec fsck --json | jq '.problems[] | select(.kind == "missing")'`
+
+	fsckCmd.Flags().BoolVar(&fsckJSON, "json", false, "Print the report as JSON")
+	fsckCmd.Flags().BoolVar(&fsckNoDangling, "no-dangling", false, "Don't report objects nothing refers to")
+
+	rootCmd.AddCommand(fsckCmd)
+}
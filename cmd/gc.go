@@ -15,13 +15,24 @@ var gcCmd = &cobra.Command{
 	Long: `Garbage collection cleans up unnecessary files from the repository.
 
 This command performs the following task:
-1. Finds and removes unreferenced objects that are not pointed to by any commit or branch
-2. With the --dry-run option, shows what would be done without making changes
+1. Finds unreferenced objects that are not reachable from HEAD, any ref or any reflog. Those
+   modified within gc.pruneExpire (default 2.weeks.ago, overridden by --prune) are moved
+   into a cruft pack, so operations running concurrently can still use them; older ones
+   are deleted, and cruft objects that became reachable again are restored
+2. Packs the remaining loose objects into a new pack in .vec/objects/pack, with its
+   index, and removes the loose objects that are then stored in a pack (see
+   'vec prune-packed')
+3. Writes the reachability bitmap index, which push and fetch use to find the objects to
+   send without walking both histories, unless repack.writeBitmaps is false
+4. Removes temporary files in .vec/tmp older than a day, left behind by crashed operations
+5. Prunes the metadata of deleted, unlocked worktrees (see 'vec worktree prune')
+6. With the --dry-run option, shows what would be done without making changes
 
 Example:
   vec gc                     # Run garbage collection with default settings
   vec gc -v                  # Run with verbose output
   vec gc -n                  # Dry run (show what would happen without making changes)
+  vec gc --prune=now         # Delete all unreferenced objects right away
 `,
 	RunE: runGC,
 }
@@ -29,6 +40,7 @@ Example:
 var (
 	gcDryRun  bool
 	gcVerbose bool
+	gcPrune   string
 )
 
 func init() {
@@ -36,6 +48,7 @@ func init() {
 
 	// Add flags
 	gcCmd.Flags().BoolVarP(&gcDryRun, "dry-run", "n", false, "Show what would be done without actually removing anything")
+	gcCmd.Flags().StringVar(&gcPrune, "prune", "", "Delete unreferenced objects older than this (e.g. 2.weeks.ago, now, never)")
 	gcCmd.Flags().BoolVarP(&gcVerbose, "verbose", "v", false, "Show detailed information about the garbage collection process")
 }
 
@@ -48,9 +61,10 @@ func runGC(cmd *cobra.Command, args []string) error {
 
 	// Create options for garbage collection
 	options := maintenance.GarbageCollectOptions{
-		RepoRoot: repoRoot,
-		DryRun:   gcDryRun,
-		Verbose:  gcVerbose,
+		RepoRoot:    repoRoot,
+		DryRun:      gcDryRun,
+		Verbose:     gcVerbose,
+		PruneExpire: gcPrune,
 	}
 
 	// Run garbage collection
@@ -68,29 +82,61 @@ func runGC(cmd *cobra.Command, args []string) error {
 	fmt.Printf("- Examined %d objects\n", stats.ObjectsExamined)
 
 	if stats.ObjectsRemoved > 0 || gcDryRun {
-		fmt.Printf("- Removed %d unreferenced objects\n", stats.ObjectsRemoved)
+		fmt.Printf("- Removed %d expired unreferenced objects\n", stats.ObjectsRemoved)
+	}
+
+	if stats.ObjectsCrufted > 0 {
+		fmt.Printf("- Kept %d unreferenced objects in a cruft pack until they expire\n", stats.ObjectsCrufted)
+	}
+
+	if stats.ObjectsRescued > 0 {
+		fmt.Printf("- Restored %d cruft objects that are referenced again\n", stats.ObjectsRescued)
+	}
+
+	if stats.ObjectsPacked > 0 {
+		fmt.Printf("- Packed %d loose objects\n", stats.ObjectsPacked)
+	}
+
+	if stats.PackedObjectsRemoved > 0 {
+		fmt.Printf("- Removed %d loose objects already in packs\n", stats.PackedObjectsRemoved)
+	}
+
+	if stats.BitmapsWritten > 0 {
+		fmt.Printf("- Wrote %d reachability bitmaps\n", stats.BitmapsWritten)
+	}
+
+	if stats.TempFilesRemoved > 0 {
+		fmt.Printf("- Removed %d stale temporary files\n", stats.TempFilesRemoved)
+	}
+
+	if stats.WorktreesPruned > 0 {
+		fmt.Printf("- Pruned %d deleted worktrees\n", stats.WorktreesPruned)
 	}
 
 	if stats.SpaceSaved > 0 {
-		// Convert bytes to a human-readable format
-		var unit string
-		spaceSaved := float64(stats.SpaceSaved)
-
-		if spaceSaved < 1024 {
-			unit = "bytes"
-		} else if spaceSaved < 1024*1024 {
-			spaceSaved /= 1024
-			unit = "KB"
-		} else if spaceSaved < 1024*1024*1024 {
-			spaceSaved /= (1024 * 1024)
-			unit = "MB"
-		} else {
-			spaceSaved /= (1024 * 1024 * 1024)
-			unit = "GB"
-		}
-
-		fmt.Printf("- Saved %.2f %s of disk space\n", spaceSaved, unit)
+		fmt.Printf("- Saved %s of disk space\n", formatDiskSize(stats.SpaceSaved))
 	}
 
 	return nil
 }
+
+// formatDiskSize converts a size in bytes to a human-readable format
+func formatDiskSize(bytes int64) string {
+	var unit string
+	size := float64(bytes)
+
+	if size < 1024 {
+		unit = "bytes"
+	} else if size < 1024*1024 {
+		size /= 1024
+		unit = "KB"
+	} else if size < 1024*1024*1024 {
+		size /= (1024 * 1024)
+		unit = "MB"
+	} else {
+		size /= (1024 * 1024 * 1024)
+		unit = "GB"
+	}
+
+	return fmt.Sprintf("%.2f %s", size, unit)
+}
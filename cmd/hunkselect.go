@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// hunkContext is the number of unchanged lines shown around a hunk; changes
+// closer together than twice this are offered as one hunk
+const hunkContext = 3
+
+// lineChange is one run of changed lines: removed replaces the old lines
+// from oldStart, added the new lines from newStart. Lines keep their
+// newline, so a missing newline at the end of a file survives.
+type lineChange struct {
+	oldStart, newStart int
+	removed, added     []string
+}
+
+// splitLinesKeepEnds splits content after each newline
+func splitLinesKeepEnds(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLineChanges returns the changes that turn oldContent into newContent.
+// Each distinct line is diffed as one rune.
+func diffLineChanges(oldContent, newContent string) []lineChange {
+	oldLines, newLines := splitLinesKeepEnds(oldContent), splitLinesKeepEnds(newContent)
+	ids := make(map[string]rune)
+	encode := func(lines []string) []rune {
+		runes := make([]rune, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = rune(len(ids) + 1)
+				if id >= 0xD800 {
+					id += 0x800 // Skip the surrogates, which aren't valid runes
+				}
+				ids[line] = id
+			}
+			runes[i] = id
+		}
+		return runes
+	}
+	diffs := diffmatchpatch.New().DiffMainRunes(encode(oldLines), encode(newLines), false)
+
+	var changes []lineChange
+	var current *lineChange
+	oldPos, newPos := 0, 0
+	for _, diff := range diffs {
+		count := utf8.RuneCountInString(diff.Text)
+		if diff.Type == diffmatchpatch.DiffEqual {
+			if current != nil {
+				changes = append(changes, *current)
+				current = nil
+			}
+			oldPos += count
+			newPos += count
+			continue
+		}
+		if current == nil {
+			current = &lineChange{oldStart: oldPos, newStart: newPos}
+		}
+		if diff.Type == diffmatchpatch.DiffDelete {
+			current.removed = append(current.removed, oldLines[oldPos:oldPos+count]...)
+			oldPos += count
+		} else {
+			current.added = append(current.added, newLines[newPos:newPos+count]...)
+			newPos += count
+		}
+	}
+	if current != nil {
+		changes = append(changes, *current)
+	}
+	return changes
+}
+
+// applyLineChanges returns oldLines with the changes keep selects applied
+func applyLineChanges(oldLines []string, changes []lineChange, keep func(i int) bool) string {
+	var b strings.Builder
+	pos := 0
+	for i, change := range changes {
+		if !keep(i) {
+			continue
+		}
+		for _, line := range oldLines[pos:change.oldStart] {
+			b.WriteString(line)
+		}
+		for _, line := range change.added {
+			b.WriteString(line)
+		}
+		pos = change.oldStart + len(change.removed)
+	}
+	for _, line := range oldLines[pos:] {
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// promptHunk is a hunk offered for selection: changes[lo:hi]
+type promptHunk struct {
+	lo, hi int
+}
+
+// groupHunks joins changes separated by few unchanged lines into hunks
+func groupHunks(changes []lineChange) []promptHunk {
+	var hunks []promptHunk
+	for i := range changes {
+		if len(hunks) > 0 {
+			last := &hunks[len(hunks)-1]
+			prev := changes[last.hi-1]
+			if changes[i].oldStart-(prev.oldStart+len(prev.removed)) <= 2*hunkContext {
+				last.hi = i + 1
+				continue
+			}
+		}
+		hunks = append(hunks, promptHunk{i, i + 1})
+	}
+	return hunks
+}
+
+// printHunk writes a hunk of changes against oldLines as a unified diff
+func printHunk(w io.Writer, oldLines []string, changes []lineChange, hunk promptHunk) {
+	first, last := changes[hunk.lo], changes[hunk.hi-1]
+	start := max(0, first.oldStart-hunkContext)
+	end := min(len(oldLines), last.oldStart+len(last.removed)+hunkContext)
+
+	var body []string
+	oldCount, newCount := 0, 0
+	context := func(lines []string) {
+		for _, line := range lines {
+			body = append(body, " "+line)
+		}
+		oldCount += len(lines)
+		newCount += len(lines)
+	}
+	pos := start
+	for _, change := range changes[hunk.lo:hunk.hi] {
+		context(oldLines[pos:change.oldStart])
+		for _, line := range change.removed {
+			body = append(body, "-"+line)
+		}
+		for _, line := range change.added {
+			body = append(body, "+"+line)
+		}
+		oldCount += len(change.removed)
+		newCount += len(change.added)
+		pos = change.oldStart + len(change.removed)
+	}
+	context(oldLines[pos:end])
+
+	newStart := first.newStart - (first.oldStart - start)
+	fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", start+1, oldCount, newStart+1, newCount)
+	for _, line := range body {
+		if strings.HasSuffix(line, "\n") {
+			fmt.Fprint(w, line)
+		} else {
+			fmt.Fprintf(w, "%s\n\\ No newline at end of file\n", line)
+		}
+	}
+}
+
+// hunkSelectHelp explains the answers of the hunk prompt
+const hunkSelectHelp = `y - %[1]s
+n - do not %[1]s
+q - quit; do not %[1]s or any of the remaining ones
+a - %[1]s and all later hunks in the file
+d - do not %[1]s or any of the later hunks in the file
+s - split the current hunk into smaller hunks
+? - print help
+`
+
+// selectHunks asks, hunk by hunk, whether to act on the changes of filePath,
+// the action being described by question, e.g. "Discard this hunk from
+// worktree". It returns which changes were chosen, and quit when the user
+// asked to stop altogether; end of input counts as quit.
+func selectHunks(in *bufio.Reader, out io.Writer, filePath string, oldLines []string, changes []lineChange, question, action string) (selected []bool, quit bool, err error) {
+	selected = make([]bool, len(changes))
+	hunks := groupHunks(changes)
+	fmt.Fprintf(out, "--- a/%s\n+++ b/%s\n", filePath, filePath)
+
+	for i := 0; i < len(hunks); i++ {
+		hunk := hunks[i]
+		printHunk(out, oldLines, changes, hunk)
+		options := "y,n,q,a,d"
+		if hunk.hi-hunk.lo > 1 {
+			options += ",s"
+		}
+		fmt.Fprintf(out, "(%d/%d) %s [%s,?]? ", i+1, len(hunks), question, options)
+
+		answer, readErr := in.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, false, fmt.Errorf("failed to read answer: %w", readErr)
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer == "" && readErr == io.EOF {
+			fmt.Fprintln(out)
+			return selected, true, nil
+		}
+
+		switch {
+		case strings.HasPrefix(answer, "y"):
+			markHunk(selected, hunk)
+		case strings.HasPrefix(answer, "n"):
+		case strings.HasPrefix(answer, "q"):
+			return selected, true, nil
+		case strings.HasPrefix(answer, "a"):
+			for _, rest := range hunks[i:] {
+				markHunk(selected, rest)
+			}
+			return selected, false, nil
+		case strings.HasPrefix(answer, "d"):
+			return selected, false, nil
+		case strings.HasPrefix(answer, "s") && hunk.hi-hunk.lo > 1:
+			split := make([]promptHunk, 0, hunk.hi-hunk.lo)
+			for j := hunk.lo; j < hunk.hi; j++ {
+				split = append(split, promptHunk{j, j + 1})
+			}
+			hunks = append(hunks[:i], append(split, hunks[i+1:]...)...)
+			fmt.Fprintf(out, "Split into %d hunks.\n", len(split))
+			i--
+		default:
+			fmt.Fprintf(out, hunkSelectHelp, action)
+			i--
+		}
+	}
+	return selected, false, nil
+}
+
+func markHunk(selected []bool, hunk promptHunk) {
+	for j := hunk.lo; j < hunk.hi; j++ {
+		selected[j] = true
+	}
+}
@@ -1,53 +1,296 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/NahomAnteneh/vec/core"
 	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/spf13/cobra"
 )
 
+// logDateMode selects how commit dates are shown (--date)
+var logDateMode string
+
+// logFormat selects how commits are shown (--format)
+var logFormat string
+
+var (
+	logOneline     bool
+	logGraph       bool
+	logJSON        bool
+	logAll         bool
+	logFirstParent bool
+	logMaxCount    int
+	logSince       string
+	logUntil       string
+	logAuthor      string
+)
+
+// logDateRange holds the --since and --until bounds; zero when unset
+type logDateRange struct {
+	since, until time.Time
+	skewWarned   bool
+}
+
+// parseLogDateRange reads --since and --until
+func parseLogDateRange() (*logDateRange, error) {
+	r := &logDateRange{}
+	now := time.Now()
+	var err error
+	if logSince != "" {
+		if r.since, err = core.ParseApproxDate(logSince, now); err != nil {
+			return nil, fmt.Errorf("invalid --since: %w", err)
+		}
+	}
+	if logUntil != "" {
+		if r.until, err = core.ParseApproxDate(logUntil, now); err != nil {
+			return nil, fmt.Errorf("invalid --until: %w", err)
+		}
+	}
+	return r, nil
+}
+
+func (r *logDateRange) active() bool {
+	return !r.since.IsZero() || !r.until.IsZero()
+}
+
+// checkOrder warns, once, when a parent was committed after its child: the
+// filters assume dates only grow along history, so commits can be missed
+func (r *logDateRange) checkOrder(child, parent *objects.Commit) {
+	if r.skewWarned || !r.active() || !parent.CommitterTime().After(child.CommitterTime()) {
+		return
+	}
+	r.skewWarned = true
+	fmt.Fprintf(os.Stderr, "warning: history is not in chronological order (%s is newer than its child %s); --since/--until may miss commits\n",
+		parent.CommitID[:min(len(parent.CommitID), 10)], child.CommitID[:min(len(child.CommitID), 10)])
+}
+
 // LogHandler handles the 'log' command for showing commit history
 func LogHandler(repo *core.Repository, args []string) error {
-	currentCommit, err := repo.ReadHead()
-	if err != nil {
-		return core.RefError("failed to get current commit", err)
+	if !objects.IsDateMode(logDateMode) {
+		return fmt.Errorf("unknown --date format '%s' (expected one of %s)",
+			logDateMode, strings.Join(objects.DateModes, ", "))
+	}
+	if logOneline {
+		logFormat = commitFormatOneline
 	}
 
-	// Iterate through the commit history.
-	for currentCommit != "" {
-		commit, err := objects.GetCommit(repo.Root, currentCommit)
+	dates, err := parseLogDateRange()
+	if err != nil {
+		return err
+	}
+	// Revisions come before "--" and paths after it
+	var paths []string
+	if dash := logCmd.ArgsLenAtDash(); dash >= 0 {
+		for _, arg := range args[dash:] {
+			path, err := repoRelativePath(repo, arg)
+			if err != nil {
+				return err
+			}
+			if path == "." {
+				path = "" // The whole tree
+			}
+			paths = append(paths, path)
+		}
+		args = args[:dash]
+	}
+	include, exclude, err := parseRevRangesRepo(repo, args)
+	if err != nil {
+		return err
+	}
+	if logAll {
+		for _, prefix := range []string{"refs/heads/", "refs/remotes/"} {
+			refs, err := repo.ListRefs(prefix)
+			if err != nil {
+				return core.RefError("failed to list refs", err)
+			}
+			for _, ref := range refs {
+				include = append(include, ref.Hash)
+			}
+		}
+	}
+	if len(include) == 0 && !logAll {
+		head, err := repo.ReadHead()
 		if err != nil {
-			return core.ObjectError(fmt.Sprintf("failed to get commit %s", currentCommit), err)
+			return core.RefError("failed to get current commit", err)
 		}
+		if head != "" {
+			include = append(include, head)
+		}
+	}
+
+	graph := logGraph || logJSON
+	walker, err := objects.NewCommitWalkerRepo(repo, objects.WalkOptions{
+		Include:        include,
+		Exclude:        exclude,
+		FirstParent:    logFirstParent,
+		Topo:           graph,
+		RewriteParents: graph,
+		Since:          dates.since,
+		Until:          dates.until,
+		Author:         logAuthor,
+		Paths:          paths,
+		OnSkew:         dates.checkOrder,
+	})
+	if err != nil {
+		return core.ObjectError("failed to walk history", err)
+	}
 
-		fmt.Printf("commit:  %s\n", currentCommit)
-		if len(commit.Parents) > 1 {
-			fmt.Printf("Merge:  %s\n", strings.Join(commit.Parents, " "))
+	var commits []*objects.Commit
+	for logMaxCount <= 0 || len(commits) < logMaxCount {
+		commit, err := walker.Next()
+		if err != nil {
+			return core.ObjectError("failed to walk history", err)
+		}
+		if commit == nil {
+			break
 		}
-		fmt.Printf("Author:  %s\n", commit.Author)
-		fmt.Printf("Date:    %s\n", time.Unix(commit.Timestamp, 0).Format(time.RFC1123)) // Format the timestamp
-		fmt.Println()
-		fmt.Printf("    %s\n", commit.Message) // Indent the message
-		fmt.Println()
+		if !graph {
+			fmt.Println(formatCommit(commit, logFormat, logDateMode))
+		}
+		commits = append(commits, commit)
+	}
+	if graph {
+		return printLogGraph(commits)
+	}
+	return nil
+}
 
-		currentCommit = ""
-		if len(commit.Parents) > 0 {
-			currentCommit = commit.Parents[0] // Simple linear history for now.
+// printLogGraph lays out commits, children before parents, and prints them
+// as a graph or, with --json, as the layout itself
+func printLogGraph(commits []*objects.Commit) error {
+	layout := objects.LayoutGraph(commits)
+	if logJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(layout); err != nil {
+			return fmt.Errorf("failed to write graph: %w", err)
 		}
+		return nil
 	}
 
+	for _, row := range layout.Rows {
+		node, connector := renderGraphRow(row)
+		short := row.Hash
+		if len(short) > 7 {
+			short = short[:7]
+		}
+		fmt.Printf("%s %s %s\n", node, short, row.Subject)
+		if connector != "" {
+			fmt.Println(connector)
+		}
+	}
 	return nil
 }
 
+// renderGraphRow draws the lanes of a graph row as text: the line holding
+// the commit, and the line to the next row when any edge changes lanes
+func renderGraphRow(row objects.GraphRow) (node, connector string) {
+	width := row.Lane + 1
+	bent := false
+	for _, edge := range row.Edges {
+		width = max(width, edge.From+1, edge.To+1)
+		bent = bent || edge.From != edge.To
+	}
+
+	nodeLine := []rune(strings.Repeat(" ", 2*width-1))
+	for _, edge := range row.Edges {
+		if edge.From != row.Lane {
+			nodeLine[2*edge.From] = '|'
+		}
+	}
+	nodeLine[2*row.Lane] = '*'
+	node = string(nodeLine)
+	if !bent {
+		return node, ""
+	}
+
+	line := []rune(strings.Repeat(" ", 2*width-1))
+	// Horizontal runs first so lanes they cross stay visible
+	for _, edge := range row.Edges {
+		switch {
+		case edge.To > edge.From:
+			for i := 2*edge.From + 1; i < 2*edge.To-1; i++ {
+				line[i] = '-'
+			}
+			line[2*edge.To-1] = '\\'
+		case edge.To < edge.From:
+			for i := 2*edge.To + 2; i < 2*edge.From; i++ {
+				line[i] = '-'
+			}
+			line[2*edge.To+1] = '/'
+		}
+	}
+	for _, edge := range row.Edges {
+		if edge.From == edge.To {
+			line[2*edge.From] = '|'
+		}
+	}
+	return node, strings.TrimRight(string(line), " ")
+}
+
+var logCmd *cobra.Command
+
 func init() {
-	logCmd := NewRepoCommand(
-		"log",
+	logCmd = NewRepoCommand(
+		"log [<options>] [<revision>...] [-- <path>...]",
 		"Show commit logs",
 		LogHandler,
 	)
+	logCmd.Long = `Show the commits reachable from the given revisions, or HEAD, newest
+first. ^<rev> leaves out the commits reachable from <rev>, <a>..<b> shows
+those in <b> but not in <a>, and <a>...<b> those in either but not in both.
+--first-parent follows only the first parent of merges. Revisions may name
+an earlier value of a ref from its reflog: main@{1} is where main was before
+its last update, main@{yesterday} where it was a day ago, and @{2.hours.ago}
+reads the current branch.
+
+Paths after "--" keep the commits changing a file at or below one of them.
+A merge is only shown when it differs there from every parent, since
+otherwise the change came from the side it matches.
+
+--since and --until keep the commits committed within the given dates,
+written as "2024-05-01", "yesterday", "2.weeks.ago" and the like. The walk
+stops at the first commit older than --since, so a history whose dates
+don't grow towards its tip, which is warned about, may lose commits.
+--author keeps the commits whose author matches a regular expression,
+ignoring case.
+
+With --graph the commits are drawn as a graph, one commit per line,
+children always above their parents. When filters leave commits out, each
+one shown is drawn joined to its nearest shown ancestors.
+--json prints the computed layout instead, for clients drawing graphs of
+their own: a "lanes" width and one row per commit, in display order, with
+its "lane", its "parents", whether it is a "merge" or "fork" point, and the
+"edges" from this row to the next as {"from", "to", "parent"} lane pairs.
+
+`+commitFormatHelp+`
+
+Examples:
+  vec log --oneline main..feature  # Commits feature adds to main
+  vec log --oneline main...feature # Commits on only one of the two
+  vec log --author=alice -- docs/  # Alice's changes to the docs
+  vec log --graph --all            # Draw every branch
+  vec log --graph -n 20 main       # Draw the last 20 commits of main
+  vec log --json --all             # Export the layout for a GUI
+  vec log --since=2.weeks.ago      # Show the commits of the last two weeks
+  vec log main@{yesterday}         # Start from where main was a day ago
+  vec log --format='%h %an, %ad: %s' --date=short
+  vec log --format=fuller          # Show committers next to authors`
+	logCmd.Flags().StringVar(&logDateMode, "date", objects.DateDefault,
+		"Date format: "+strings.Join(objects.DateModes, ", "))
+	logCmd.Flags().StringVar(&logFormat, "format", commitFormatMedium, "Commit format: medium, fuller, oneline or a %-placeholder template")
+	logCmd.Flags().BoolVar(&logOneline, "oneline", false, "Show each commit on one line, short for --format=oneline")
+	logCmd.Flags().BoolVar(&logGraph, "graph", false, "Draw the history as a graph")
+	logCmd.Flags().BoolVar(&logJSON, "json", false, "Print the graph layout as JSON")
+	logCmd.Flags().BoolVar(&logAll, "all", false, "Include every branch and remote-tracking branch")
+	logCmd.Flags().BoolVar(&logFirstParent, "first-parent", false, "Follow only the first parent of merges")
+	logCmd.Flags().IntVarP(&logMaxCount, "max-count", "n", 0, "Limit the output to this many commits")
+	logCmd.Flags().StringVar(&logSince, "since", "", "Show commits more recent than a date")
+	logCmd.Flags().StringVar(&logUntil, "until", "", "Show commits older than a date")
+	logCmd.Flags().StringVar(&logAuthor, "author", "", "Show commits whose author matches a regular expression")
 
 	rootCmd.AddCommand(logCmd)
 }
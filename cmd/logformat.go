@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/internal/objects"
+)
+
+// Named commit formats for log and show --format; anything else is a
+// template of placeholders
+const (
+	commitFormatMedium  = "medium"
+	commitFormatFuller  = "fuller"
+	commitFormatOneline = "oneline"
+)
+
+// commitFormatHelp describes --format for log and show
+const commitFormatHelp = `--format takes medium (the default), fuller, which also shows the
+committer and both dates, oneline, or a template: %H and %h the commit,
+%T and %t its tree, %P and %p its parents, %an, %ae and %ad the author's
+name, email and date, %cn, %ce and %cd the committer's, %s the subject,
+%b the body, %B the whole message, %n a newline and %% a percent sign.
+Dates follow --date.`
+
+// formatCommit renders commit in format, a named format or a template,
+// with dates in dateMode
+func formatCommit(commit *objects.Commit, format, dateMode string) string {
+	switch format {
+	case "", commitFormatMedium:
+		format = "commit:  %H%n%mAuthor:  %an <%ae>%nDate:    %ad%n%n%w"
+	case commitFormatFuller:
+		format = "commit:     %H%n%mAuthor:     %an <%ae>%nAuthorDate: %ad%nCommit:     %cn <%ce>%nCommitDate: %cd%n%n%w"
+	case commitFormatOneline:
+		format = "%h %s"
+	default:
+		format = strings.TrimPrefix(strings.TrimPrefix(format, "format:"), "tformat:")
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			out.WriteByte(format[i])
+			continue
+		}
+		placeholder := format[i+1 : i+2]
+		if i+2 < len(format) && (format[i+1] == 'a' || format[i+1] == 'c') {
+			placeholder = format[i+1 : i+3]
+		}
+		value, ok := commitPlaceholder(commit, placeholder, dateMode)
+		if !ok {
+			out.WriteByte('%') // Unknown placeholders are printed as is
+			continue
+		}
+		out.WriteString(value)
+		i += len(placeholder)
+	}
+	return out.String()
+}
+
+// commitPlaceholder expands one placeholder of a --format template; %m and
+// %w are the Merge line and the indented message of the named formats
+func commitPlaceholder(commit *objects.Commit, placeholder, dateMode string) (string, bool) {
+	subject, body, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n")
+	switch placeholder {
+	case "H":
+		return commit.CommitID, true
+	case "h":
+		return shortCommitHash(commit.CommitID), true
+	case "T":
+		return commit.Tree, true
+	case "t":
+		return shortCommitHash(commit.Tree), true
+	case "P":
+		return strings.Join(commit.Parents, " "), true
+	case "p":
+		short := make([]string, len(commit.Parents))
+		for i, parent := range commit.Parents {
+			short[i] = shortCommitHash(parent)
+		}
+		return strings.Join(short, " "), true
+	case "an":
+		return commit.AuthorName(), true
+	case "ae":
+		return commit.AuthorEmail(), true
+	case "ad":
+		return objects.FormatDate(commit.AuthorTime(), dateMode), true
+	case "cn":
+		return commit.CommitterName(), true
+	case "ce":
+		return commit.CommitterEmail(), true
+	case "cd":
+		return objects.FormatDate(commit.CommitterTime(), dateMode), true
+	case "s":
+		return strings.TrimSpace(subject), true
+	case "b":
+		return strings.TrimSpace(body), true
+	case "B":
+		return commit.Message, true
+	case "n":
+		return "\n", true
+	case "%":
+		return "%", true
+	case "m":
+		if len(commit.Parents) > 1 {
+			return fmt.Sprintf("Merge:  %s\n", strings.Join(commit.Parents, " ")), true
+		}
+		return "", true
+	case "w":
+		return "    " + strings.ReplaceAll(strings.TrimSpace(commit.Message), "\n", "\n    ") + "\n", true
+	}
+	return "", false
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/maintenance"
+	"github.com/spf13/cobra"
+)
+
+var (
+	maintenanceTasks    []string
+	maintenanceQuiet    bool
+	maintenanceInterval time.Duration
+)
+
+// maintenanceCmd groups the repository maintenance commands
+var maintenanceCmd = &cobra.Command{
+	Use:   "maintenance",
+	Short: "Keep the commit-graph and multi-pack-index up to date",
+	Long:  "Run the maintenance tasks that keep lookup structures fresh. They also run after every fetch unless maintenance.auto is set to false.",
+}
+
+// MaintenanceRunHandler runs the selected maintenance tasks
+func MaintenanceRunHandler(repo *core.Repository, args []string) error {
+	results, err := maintenance.RunTasksRepo(repo, maintenanceTasks)
+	if err != nil {
+		return err
+	}
+	printMaintenanceResults(results)
+	return nil
+}
+
+// MaintenanceDaemonHandler runs the selected maintenance tasks, prefetch by
+// default, every --interval until interrupted. A failed run is reported and
+// retried at the next interval.
+func MaintenanceDaemonHandler(repo *core.Repository, args []string) error {
+	if maintenanceInterval <= 0 {
+		return core.ConfigError(fmt.Sprintf("invalid --interval %s: must be positive", maintenanceInterval), nil)
+	}
+	tasks := maintenanceTasks
+	if len(tasks) == 0 {
+		tasks = []string{maintenance.TaskPrefetch}
+	}
+	for _, task := range tasks {
+		if !slices.Contains(maintenance.KnownTasks, task) {
+			return core.ConfigError(fmt.Sprintf("unknown maintenance task '%s'", task), nil)
+		}
+	}
+
+	for {
+		results, err := maintenance.RunTasksRepo(repo, tasks)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+		printMaintenanceResults(results)
+		time.Sleep(maintenanceInterval)
+	}
+}
+
+// printMaintenanceResults reports what each task did, unless --quiet
+func printMaintenanceResults(results []maintenance.TaskResult) {
+	if maintenanceQuiet {
+		return
+	}
+	for _, result := range results {
+		switch result.Task {
+		case maintenance.TaskCommitGraph:
+			fmt.Printf("commit-graph: added %d commits\n", result.Added)
+		case maintenance.TaskMultiPackIndex:
+			fmt.Printf("multi-pack-index: indexed %d new packs\n", result.Added)
+		case maintenance.TaskPrefetch:
+			fmt.Printf("prefetch: updated %d prefetch refs\n", result.Added)
+		}
+	}
+}
+
+func init() {
+	runCmd := NewRepoCommand("run", "Run maintenance tasks", MaintenanceRunHandler)
+	runCmd.Long = `Append the commits not yet in the commit-graph as a new layer of
+.vec/objects/info/commit-graphs, and index the packs the multi-pack-index
+doesn't cover in a new layer of .vec/objects/pack. Small layers are merged
+into the ones below them, so a run only writes what changed.
+
+The prefetch task downloads the branches of every remote into
+refs/prefetch/<remote>/ without touching the remote-tracking refs, so a
+later fetch or pull only transfers what changed since. Prefetch refs of
+branches and remotes that are gone are removed. Set remote.<name>.prefetch
+to false to leave a remote out, or maintenance.prefetch to false to turn
+prefetching off.
+
+Tasks: commit-graph, multi-pack-index (default: both), prefetch
+
+Examples:
+  vec maintenance run
+  vec maintenance run --task commit-graph
+  vec maintenance run --task prefetch`
+	runCmd.Args = cobra.NoArgs
+	runCmd.Flags().StringSliceVar(&maintenanceTasks, "task", nil, "Run only the given task (repeatable)")
+	runCmd.Flags().BoolVarP(&maintenanceQuiet, "quiet", "q", false, "Don't report what was done")
+
+	daemonCmd := NewRepoCommand("daemon", "Run maintenance tasks periodically", MaintenanceDaemonHandler)
+	daemonCmd.Long = `Run the maintenance tasks, prefetch unless --task says otherwise, right
+away and then every --interval, until interrupted. Run it in the background
+to keep refs/prefetch/ fresh, so fetches and pulls stay small.
+
+Examples:
+  vec maintenance daemon &
+  vec maintenance daemon --interval 15m --task prefetch --task commit-graph`
+	daemonCmd.Args = cobra.NoArgs
+	daemonCmd.Flags().StringSliceVar(&maintenanceTasks, "task", nil, "Run only the given task (repeatable; default: prefetch)")
+	daemonCmd.Flags().BoolVarP(&maintenanceQuiet, "quiet", "q", false, "Don't report what was done")
+	daemonCmd.Flags().DurationVar(&maintenanceInterval, "interval", time.Hour, "Time between runs")
+
+	maintenanceCmd.AddCommand(runCmd, daemonCmd)
+	rootCmd.AddCommand(maintenanceCmd)
+}
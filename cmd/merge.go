@@ -14,13 +14,70 @@ var (
 	mergeStrategy    string
 	mergeInteractive bool
 	mergeNoCommit    bool
+	mergeFF          bool
+	mergeNoFF        bool
+	mergeFFOnly      bool
+	mergeSquash      bool
+	mergeStrategyOpt []string
+
+	mergeNoVerifySignatures bool
+
+	mergePlan bool
+	mergeJSON bool
 )
 
+// mergeFastForwardMode maps --ff, --no-ff and --ff-only to a policy; without
+// any of them merge.ff decides
+func mergeFastForwardMode() (merge.FastForwardMode, error) {
+	mode := merge.FastForwardDefault
+	set := 0
+	for _, flag := range []struct {
+		on   bool
+		mode merge.FastForwardMode
+	}{{mergeFF, merge.FastForwardAllow}, {mergeNoFF, merge.FastForwardNever}, {mergeFFOnly, merge.FastForwardOnly}} {
+		if flag.on {
+			mode = flag.mode
+			set++
+		}
+	}
+	if set > 1 {
+		return mode, fmt.Errorf("--ff, --no-ff and --ff-only are mutually exclusive")
+	}
+	return mode, nil
+}
+
+// mergeAlgorithm maps -X options to a text merge algorithm: patience,
+// histogram, union, myers or diff-algorithm=<algorithm>
+func mergeAlgorithm() (merge.MergeAlgorithm, error) {
+	algorithm := merge.MergeAlgorithmDefault
+	for _, opt := range mergeStrategyOpt {
+		name := strings.TrimPrefix(opt, "diff-algorithm=")
+		parsed, err := merge.ParseMergeAlgorithm(name)
+		if err != nil {
+			return algorithm, fmt.Errorf("unknown strategy option '-X %s'", opt)
+		}
+		algorithm = parsed
+	}
+	return algorithm, nil
+}
+
 // MergeHandler handles the 'merge' command logic
 func MergeHandler(repo *core.Repository, args []string) error {
 	// Get the branch to merge
 	branchName := args[0]
 
+	if mergePlan {
+		ffMode, err := mergeFastForwardMode()
+		if err != nil {
+			return err
+		}
+		plan, err := merge.PlanRepo(repo, branchName, &merge.MergeConfig{FastForward: ffMode, Squash: mergeSquash})
+		if err != nil {
+			return core.MergeError(fmt.Sprintf("failed to plan the merge of '%s'", branchName), err)
+		}
+		return printPlan(plan, mergeJSON)
+	}
+
 	// Check if this is a remote branch
 	if strings.Contains(branchName, "/") {
 		parts := strings.SplitN(branchName, "/", 2)
@@ -28,10 +85,19 @@ func MergeHandler(repo *core.Repository, args []string) error {
 			remoteName := parts[0]
 			remoteBranch := parts[1]
 
-			return remote.MergeRemoteBranchRepo(repo, remoteName, remoteBranch, mergeInteractive)
+			return remote.MergeRemoteBranchRepo(repo, remoteName, remoteBranch, mergeInteractive, mergeNoVerifySignatures)
 		}
 	}
 
+	ffMode, err := mergeFastForwardMode()
+	if err != nil {
+		return err
+	}
+	algorithm, err := mergeAlgorithm()
+	if err != nil {
+		return err
+	}
+
 	// Otherwise, treat as a local branch
 	var strategy merge.MergeStrategy
 	switch mergeStrategy {
@@ -46,6 +112,11 @@ func MergeHandler(repo *core.Repository, args []string) error {
 	config := &merge.MergeConfig{
 		Strategy:    strategy,
 		Interactive: mergeInteractive,
+		FastForward: ffMode,
+		Squash:      mergeSquash,
+		Algorithm:   algorithm,
+
+		NoVerifySignatures: mergeNoVerifySignatures,
 	}
 
 	hasConflicts, err := merge.MergeRepo(repo, branchName, config)
@@ -73,13 +144,56 @@ This combines the specified branch's history with the current branch.
 Examples:
   vec merge feature-branch         # Merge local branch 'feature-branch' into current branch
   vec merge origin/main            # Merge remote branch 'main' from remote 'origin'
-  vec merge --strategy=ours topic  # Merge branch 'topic' using the 'ours' strategy`
+  vec merge FETCH_HEAD             # Merge the branch recorded by the last fetch
+  vec merge --strategy=ours topic  # Merge branch 'topic' using the 'ours' strategy
+  vec merge --no-ff feature        # Always record a merge commit
+  vec merge --ff-only origin/main  # Only update the branch if it can fast-forward
+  vec merge --squash feature       # Stage feature's changes as one commit to make
+  vec merge -X patience feature    # Merge text with the patience algorithm
+
+Without --ff, --no-ff or --ff-only the merge.ff setting (true, false or only)
+decides whether a fast-forward is allowed.
+
+Merge commit messages include the description of the merged branch (see
+'vec branch --edit-description'). Set merge.log to true, or to a number of
+commits, to also list the subjects of the merged commits.
+
+Text conflicts are merged with the myers algorithm unless -X or the
+merge-algorithm attribute in .vecattributes picks another: patience and
+histogram line the versions up on lines they share, giving fewer spurious
+conflicts on moved code, and union works like patience but keeps both sides
+of conflicting lines.
+
+The merge attribute in .vecattributes picks how conflicting changes to a path
+are combined: merge=union keeps the lines of both sides, merge=ours keeps our
+version, -merge or merge=binary keeps our version and leaves the path
+conflicted. Any other merge=<driver> runs merge.<driver>.driver through the
+shell with %O, %A and %B replaced by files holding the base, our and their
+versions (%P is the path); the driver leaves the result in %A and exits
+non-zero if it left conflicts.
+
+With merge.verifySignatures set, every commit being merged must carry a good
+signature by a key gpg.ssh.allowedSignersFile allows for its committer's
+email; --no-verify-signatures skips the check for one merge.
+
+With --plan nothing is merged: the commits that would be merged, the paths
+predicted to conflict and the refs that would move are printed instead, as
+JSON with --json. Predictions come from an in-memory merge of the trees that
+ignores merge drivers and attributes.`
 
 	mergeCmd.Args = cobra.ExactArgs(1)
 
 	mergeCmd.Flags().StringVar(&mergeStrategy, "strategy", "recursive", "Merge strategy: recursive, ours, or theirs")
 	mergeCmd.Flags().BoolVar(&mergeInteractive, "interactive", false, "Resolve conflicts interactively")
 	mergeCmd.Flags().BoolVar(&mergeNoCommit, "no-commit", false, "Don't automatically commit the merge")
+	mergeCmd.Flags().BoolVar(&mergeFF, "ff", false, "Fast-forward when possible (default)")
+	mergeCmd.Flags().BoolVar(&mergeNoFF, "no-ff", false, "Create a merge commit even when a fast-forward is possible")
+	mergeCmd.Flags().BoolVar(&mergeFFOnly, "ff-only", false, "Refuse to merge unless the branch can be fast-forwarded")
+	mergeCmd.Flags().BoolVar(&mergeSquash, "squash", false, "Stage the merged changes without committing; the next commit uses a generated message")
+	mergeCmd.Flags().StringArrayVarP(&mergeStrategyOpt, "strategy-option", "X", nil, "Text merge algorithm: patience, histogram, union or myers")
+	mergeCmd.Flags().BoolVar(&mergeNoVerifySignatures, "no-verify-signatures", false, "Don't check the signatures of the merged commits (overrides merge.verifySignatures)")
+	mergeCmd.Flags().BoolVar(&mergePlan, "plan", false, "Show what the merge would do without changing anything")
+	mergeCmd.Flags().BoolVar(&mergeJSON, "json", false, "With --plan, print the plan as JSON")
 
 	rootCmd.AddCommand(mergeCmd)
 }
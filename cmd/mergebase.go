@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mergeBaseAll        bool
+	mergeBaseIsAncestor bool
+	mergeBaseOctopus    bool
+)
+
+// MergeBaseHandler prints the best common ancestors of the given commits
+func MergeBaseHandler(repo *core.Repository, args []string) error {
+	commits := make([]string, len(args))
+	for i, arg := range args {
+		commit, err := repo.ResolveRevision(arg)
+		if err != nil {
+			return err
+		}
+		commits[i] = commit
+	}
+
+	if mergeBaseIsAncestor {
+		if len(commits) != 2 {
+			return core.RefError("--is-ancestor takes exactly two commits", nil)
+		}
+		ok, err := objects.IsAncestorRepo(repo, commits[0], commits[1])
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return silentExit(mergeBaseCmd, 1)
+		}
+		return nil
+	}
+
+	var bases []string
+	var err error
+	if mergeBaseOctopus {
+		bases, err = objects.OctopusMergeBasesRepo(repo, commits)
+	} else {
+		if len(commits) < 2 {
+			return core.RefError("merge-base needs at least two commits", nil)
+		}
+		bases, err = objects.MergeBasesManyRepo(repo, commits[0], commits[1:])
+	}
+	if err != nil {
+		return err
+	}
+	if len(bases) == 0 {
+		return silentExit(mergeBaseCmd, 1)
+	}
+
+	if !mergeBaseAll {
+		bases = bases[:1]
+	}
+	for _, base := range bases {
+		fmt.Println(base)
+	}
+	return nil
+}
+
+var mergeBaseCmd *cobra.Command
+
+func init() {
+	mergeBaseCmd = NewRepoCommand(
+		"merge-base <commit> <commit>...",
+		"Find the best common ancestors of commits",
+		MergeBaseHandler,
+	)
+	mergeBaseCmd.Long = `Print the best common ancestor of two commits: a common ancestor that is
+not an ancestor of any other common ancestor. With more than two commits the
+result is the merge base of the first and a hypothetical merge of the rest.
+After criss-cross merges there can be several best ancestors; --all prints
+them all, newest first.
+
+With --octopus the result is the common ancestor of all the commits, as
+used when merging more than two heads.
+
+With --is-ancestor nothing is printed: the exit status is 0 if the first
+commit is an ancestor of (or equal to) the second and 1 otherwise.
+
+Exits with status 1 when the commits have no common ancestor.
+
+Examples:
+  vec merge-base main feature
+  vec merge-base --all main feature
+  vec merge-base --octopus main topic-a topic-b
+  vec merge-base --is-ancestor v1.0 main && echo "v1.0 is in main"`
+	mergeBaseCmd.Args = cobra.MinimumNArgs(1)
+
+	mergeBaseCmd.Flags().BoolVarP(&mergeBaseAll, "all", "a", false, "Print all best common ancestors")
+	mergeBaseCmd.Flags().BoolVar(&mergeBaseIsAncestor, "is-ancestor", false, "Exit 0 if the first commit is an ancestor of the second, 1 otherwise")
+	mergeBaseCmd.Flags().BoolVar(&mergeBaseOctopus, "octopus", false, "Find the common ancestors of all commits for an n-way merge")
+
+	rootCmd.AddCommand(mergeBaseCmd)
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/internal/merge"
+)
+
+// printPlan shows what a merge or rebase would do, as JSON or for reading
+func printPlan(plan *merge.Plan, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(plan); err != nil {
+			return fmt.Errorf("failed to write plan: %w", err)
+		}
+		return nil
+	}
+
+	switch plan.Operation {
+	case "merge":
+		fmt.Printf("Merge %s into %s (merge base %s): %s\n", shortCommitHash(plan.Target), shortCommitHash(plan.Head), shortCommitHash(plan.Base), plan.Outcome)
+	default:
+		fmt.Printf("Rebase %s onto %s: %s\n", shortCommitHash(plan.Head), shortCommitHash(plan.Target), plan.Outcome)
+	}
+	if plan.Reason != "" {
+		fmt.Printf("  %s\n", plan.Reason)
+	}
+
+	if len(plan.Steps) > 0 {
+		fmt.Printf("\n%d commit%s:\n", len(plan.Steps), plural(len(plan.Steps)))
+		for _, step := range plan.Steps {
+			note := ""
+			switch {
+			case len(step.Conflicts) > 0:
+				note = "  (conflicts in " + strings.Join(step.Conflicts, ", ") + ")"
+			case step.Empty:
+				note = "  (already applied, would be dropped)"
+			}
+			fmt.Printf("  %-6s %s %s%s\n", step.Action, shortCommitHash(step.Commit), step.Subject, note)
+		}
+	}
+	if len(plan.Conflicts) > 0 {
+		fmt.Println("\nPredicted conflicts:")
+		for _, path := range plan.Conflicts {
+			fmt.Printf("  %s\n", path)
+		}
+	}
+	if len(plan.RefUpdates) > 0 {
+		fmt.Println("\nRef updates:")
+		for _, update := range plan.RefUpdates {
+			to := "(new commit)"
+			if update.New != "" {
+				to = shortCommitHash(update.New)
+			}
+			fmt.Printf("  %s: %s -> %s\n", update.Ref, shortCommitHash(update.Old), to)
+		}
+	}
+	return nil
+}
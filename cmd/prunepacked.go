@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/maintenance"
+	"github.com/spf13/cobra"
+)
+
+var (
+	prunePackedDryRun  bool
+	prunePackedVerbose bool
+)
+
+// PrunePackedHandler removes loose objects that are already stored in packs
+func PrunePackedHandler(repo *core.Repository, args []string) error {
+	stats, err := maintenance.PrunePackedRepo(repo, maintenance.PrunePackedOptions{
+		DryRun:  prunePackedDryRun,
+		Verbose: prunePackedVerbose,
+	})
+	if err != nil {
+		return err
+	}
+
+	if prunePackedDryRun {
+		fmt.Printf("Would remove %d loose objects, reclaiming %s\n",
+			stats.ObjectsRemoved, formatDiskSize(stats.SpaceSaved))
+		return nil
+	}
+	fmt.Printf("Removed %d loose objects, reclaimed %s\n",
+		stats.ObjectsRemoved, formatDiskSize(stats.SpaceSaved))
+	return nil
+}
+
+var prunePackedCmd *cobra.Command
+
+func init() {
+	prunePackedCmd = NewRepoCommand(
+		"prune-packed",
+		"Remove loose objects that are already in packs",
+		PrunePackedHandler,
+	)
+	prunePackedCmd.Long = `Delete loose objects in .vec/objects that are also stored in a pack under
+.vec/objects/pack. An object is only removed when a pack index lists it and
+that index checks out against its pack.
+
+Examples:
+  vec prune-packed       # Remove redundant loose objects
+  vec prune-packed -n    # Report how many objects and bytes would be reclaimed`
+	prunePackedCmd.Args = cobra.NoArgs
+
+	prunePackedCmd.Flags().BoolVarP(&prunePackedDryRun, "dry-run", "n", false, "Show what would be removed without removing anything")
+	prunePackedCmd.Flags().BoolVarP(&prunePackedVerbose, "verbose", "v", false, "List each object as it is removed")
+
+	rootCmd.AddCommand(prunePackedCmd)
+}
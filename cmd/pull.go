@@ -5,14 +5,25 @@ import (
 	"fmt"
 
 	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/rebase"
 	"github.com/NahomAnteneh/vec/internal/remote"
+	"github.com/spf13/cobra"
 )
 
+var (
+	pullDryRun             bool
+	pullRebase             bool
+	pullNoRebase           bool
+	pullNoVerifySignatures bool
+)
+
+var pullCmd *cobra.Command
+
 // PullHandler handles the 'pull' command for fetching and integrating changes
 func PullHandler(repo *core.Repository, args []string) error {
 	// Determine remote and branch
-	remoteName := "origin"
-	var branchName string
+	// Empty values are resolved from the current branch's upstream
+	var remoteName, branchName string
 
 	if len(args) >= 1 {
 		remoteName = args[0]
@@ -23,7 +34,22 @@ func PullHandler(repo *core.Repository, args []string) error {
 	}
 
 	// Pull from remote
-	if err := remote.PullRepo(repo, remoteName, branchName, false); err != nil {
+	opts := remote.PullOptions{
+		DryRun:             pullDryRun,
+		Rebase:             pullRebase,
+		NoRebase:           pullNoRebase,
+		NoVerifySignatures: pullNoVerifySignatures,
+		Rebased: func(result *rebase.Result) error {
+			if err := reportRebase(repo, result); err != nil {
+				return silentExit(pullCmd, 1)
+			}
+			return nil
+		},
+	}
+	if err := remote.PullWithOptionsRepo(repo, remoteName, branchName, opts); err != nil {
+		if remoteName == "" {
+			return core.RemoteError("pull failed", err)
+		}
 		return core.RemoteError(fmt.Sprintf("failed to pull from remote '%s'", remoteName), err)
 	}
 
@@ -31,7 +57,7 @@ func PullHandler(repo *core.Repository, args []string) error {
 }
 
 func init() {
-	pullCmd := NewRepoCommand(
+	pullCmd = NewRepoCommand(
 		"pull [<remote>] [<branch>]",
 		"Fetch from and integrate with another repository or branch",
 		PullHandler,
@@ -39,8 +65,24 @@ func init() {
 
 	// Update help text
 	pullCmd.Long = `Fetch from and integrate with another repository or branch.
-If no remote is specified, 'origin' is used.
-If no branch is specified, the current branch is used.`
+If no remote or branch is specified, the upstream of the current branch
+(branch.<name>.remote and branch.<name>.merge) is used. Without an upstream,
+'origin' and the current branch name are used.
+
+The fetched branch is integrated into the current branch: a fast-forward
+when the current branch has no commits of its own, a merge otherwise. With
+--rebase, or pull.rebase set to true, the commits of the current branch are
+replayed on top of the fetched branch instead; --no-rebase merges whatever
+pull.rebase says. A rebase stopped at a conflict is finished with
+'vec rebase --continue'.
+
+With merge.verifySignatures set, the pulled commits must be signed by an
+allowed signer; --no-verify-signatures skips the check.`
+
+	pullCmd.Flags().BoolVar(&pullDryRun, "dry-run", false, "Show what would be updated without fetching or changing anything")
+	pullCmd.Flags().BoolVar(&pullRebase, "rebase", false, "Rebase the current branch onto the fetched branch instead of merging (overrides pull.rebase)")
+	pullCmd.Flags().BoolVar(&pullNoRebase, "no-rebase", false, "Merge the fetched branch even when pull.rebase is set")
+	pullCmd.Flags().BoolVar(&pullNoVerifySignatures, "no-verify-signatures", false, "Don't check the signatures of the pulled commits (overrides merge.verifySignatures)")
 
 	rootCmd.AddCommand(pullCmd)
 }
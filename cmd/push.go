@@ -4,6 +4,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/NahomAnteneh/vec/core"
@@ -19,133 +20,120 @@ var (
 	pushQuiet       bool
 	pushVerbose     bool
 	pushAll         bool
-	pushUpstream    bool
+	pushTags        bool
+	pushAtomic      bool
 	pushProgress    bool
 	pushTimeout     int
 	pushSetUpstream bool
+	pushLease       string
+	pushMirror      bool
+	pushPrune       bool
+	pushDelete      bool
+	pushNoVerify    bool
+	pushNoSizeCheck bool
 )
 
+// pushLeaseAll is the --force-with-lease value used when no ref is given
+const pushLeaseAll = "*"
+
+// pushLeaseOption parses --force-with-lease into a lease, or nil if it was not given
+func pushLeaseOption() (*remote.PushLease, error) {
+	if pushLease == "" {
+		return nil, nil
+	}
+	spec := pushLease
+	if spec == pushLeaseAll {
+		spec = ""
+	}
+	lease, err := remote.ParsePushLease(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
 // PushHandler handles the push command logic using the repository context
 func PushHandler(repo *core.Repository, args []string) error {
 	// Start time measurement for performance reporting
 	startTime := time.Now()
 
-	// Determine remote and branch
-	remoteName := "origin"
-	var branchName string
-
+	// Determine remote and refspecs
+	var remoteName string
+	var refArgs []string
 	if len(args) >= 1 {
 		remoteName = args[0]
+		refArgs = args[1:]
 	}
-
-	if len(args) >= 2 {
-		branchName = args[1]
+	if pushDelete && len(refArgs) == 0 {
+		return core.RemoteError("--delete requires a remote and at least one branch or tag", nil)
 	}
 
-	// If no branch specified but --all flag is set, push all branches
-	if branchName == "" && pushAll {
-		if pushVerbose && !pushQuiet {
-			fmt.Printf("Pushing all branches to remote '%s'...\n", remoteName)
-		}
-
-		// We'll implement this by calling Push for each branch in the repository
-		// Get all local branches
-		localBranches, err := utils.GetAllBranches(repo.Root)
-		if err != nil {
-			return core.RemoteError("failed to get local branches", err)
-		}
-
-		if len(localBranches) == 0 {
-			return core.RemoteError("no local branches found to push", nil)
-		}
-
-		// Track results for summary
-		results := make(map[string]pushResult)
-		anySuccess := false
-
-		// Create push options
-		pushOptions := remote.PushOptions{
-			Force:    pushForce,
-			Verbose:  pushVerbose,
-			Timeout:  time.Duration(pushTimeout) * time.Second,
-			DryRun:   pushDryRun,
-			Progress: pushProgress,
-		}
-
-		// Push each branch
-		for _, branch := range localBranches {
-			result := pushResult{
-				BranchName: branch,
-				Success:    false,
-			}
-
-			if !pushQuiet && pushVerbose {
-				fmt.Printf("Pushing branch '%s' to '%s'...\n", branch, remoteName)
-			}
+	// Without a remote, push to the one the current branch tracks
+	remoteName, err := remote.ResolvePushRemoteRepo(repo, remoteName)
+	if err != nil {
+		return core.RemoteError("failed to determine remote", err)
+	}
 
-			err := remote.PushWithOptionsRepo(repo, remoteName, branch, pushOptions)
-			if err != nil {
-				result.Error = err
-				if !pushQuiet {
-					fmt.Fprintf(os.Stderr, "Error pushing branch '%s': %v\n", branch, err)
-				}
-			} else {
-				result.Success = true
-				anySuccess = true
-			}
+	lease, err := pushLeaseOption()
+	if err != nil {
+		return err
+	}
 
-			results[branch] = result
-		}
+	if pushDelete {
+		return pushDeleteRefs(repo, remoteName, refArgs, lease, startTime)
+	}
 
-		// Display summary if verbose
-		if pushVerbose && !pushQuiet {
-			displayPushSummary(results)
-		}
+	if pushMirror || pushPrune {
+		return pushAndPrune(repo, remoteName, refArgs, lease, startTime)
+	}
 
-		// Show completion timing info
-		if !pushQuiet {
-			duration := time.Since(startTime).Round(time.Millisecond)
-			fmt.Printf("Push completed in %v\n", duration)
+	// A lone branch name is pushed on its own; refspecs, --all and --tags
+	// update several refs in one request
+	var branchName string
+	if len(refArgs) == 1 && !pushAll && !pushTags && !strings.ContainsAny(refArgs[0], ":+") && refArgs[0] != "tag" {
+		branchName = refArgs[0]
+	} else if len(refArgs) > 0 || pushAll || pushTags {
+		if pushAll && len(refArgs) > 0 {
+			return core.RemoteError("--all cannot be combined with refspecs", nil)
 		}
-
-		// If no push operations succeeded, return error
-		if !anySuccess {
-			return core.RemoteError("failed to push any branches", nil)
+		refspecs, err := parsePushRefspecArgs(refArgs)
+		if err != nil {
+			return err
 		}
-
-		return nil
+		return pushRefspecs(repo, remoteName, refspecs, lease, startTime)
 	}
 
-	// Handle --set-upstream flag
-	if pushSetUpstream && branchName == "" {
-		// Get current branch if not specified
-		currentBranch, err := utils.GetCurrentBranch(repo.Root)
+	// Without a branch, push.default decides what is pushed
+	var remoteBranch string
+	if branchName == "" {
+		targets, err := remote.ResolvePushTargetsRepo(repo, remoteName)
 		if err != nil {
-			return core.RemoteError("failed to get current branch", err)
+			return core.RemoteError("nothing pushed", err)
 		}
-
-		branchName = currentBranch
-
-		// Set upstream tracking after push
-		defer func() {
-			if err := utils.SetBranchUpstream(repo.Root, branchName, remoteName); err != nil {
-				if !pushQuiet {
-					fmt.Fprintf(os.Stderr, "Warning: Failed to set upstream tracking: %v\n", err)
-				}
-			} else if !pushQuiet {
-				fmt.Printf("Branch '%s' set up to track remote branch '%s' from '%s'.\n",
-					branchName, branchName, remoteName)
+		if len(targets) > 1 {
+			refspecs := make([]remote.PushRefspec, len(targets))
+			for i, target := range targets {
+				refspecs[i] = remote.PushRefspec{Src: "refs/heads/" + target.Local, Dst: "refs/heads/" + target.Remote}
 			}
-		}()
+			return pushRefspecs(repo, remoteName, refspecs, lease, startTime)
+		}
+		if len(targets) == 1 {
+			branchName, remoteBranch = targets[0].Local, targets[0].Remote
+		}
 	}
 
-	// Create push options
+	// Create push options; the upstream is recorded by the push itself, only on success
 	pushOptions := remote.PushOptions{
-		Force:    pushForce,
-		Verbose:  pushVerbose,
-		Timeout:  time.Duration(pushTimeout) * time.Second,
-		DryRun:   pushDryRun,
-		Progress: pushProgress,
+		Force:        pushForce,
+		Verbose:      pushVerbose,
+		Timeout:      time.Duration(pushTimeout) * time.Second,
+		DryRun:       pushDryRun,
+		Progress:     pushProgress,
+		SetUpstream:  pushSetUpstream,
+		RemoteBranch: remoteBranch,
+		Lease:        lease,
+		NoVerify:     pushNoVerify,
+		NoSizeCheck:  pushNoSizeCheck,
 	}
 
 	// Push to remote with options
@@ -163,7 +151,11 @@ func PushHandler(repo *core.Repository, args []string) error {
 		}
 	}
 
-	if err := remote.PushWithOptionsRepo(repo, remoteName, branchName, pushOptions); err != nil {
+	update, err := remote.PushBranchRepo(repo, remoteName, branchName, pushOptions)
+	if update != nil && !pushQuiet && !pushOptions.DryRun {
+		displayPushSummary(remoteName, []*remote.RefUpdate{update})
+	}
+	if err != nil {
 		return core.RemoteError("push failed", err)
 	}
 
@@ -181,41 +173,185 @@ func PushHandler(repo *core.Repository, args []string) error {
 	return nil
 }
 
-// Result type for tracking push operations
-type pushResult struct {
-	BranchName string
-	Success    bool
-	Error      error
+// parsePushRefspecArgs parses refspec arguments, reading "tag <name>" as
+// refs/tags/<name>
+func parsePushRefspecArgs(args []string) ([]remote.PushRefspec, error) {
+	var refspecs []remote.PushRefspec
+	for i := 0; i < len(args); i++ {
+		spec := args[i]
+		if spec == "tag" {
+			if i+1 == len(args) {
+				return nil, core.RemoteError("'tag' must be followed by a tag name", nil)
+			}
+			i++
+			spec = "refs/tags/" + args[i]
+		}
+		refspec, err := remote.ParsePushRefspec(spec)
+		if err != nil {
+			return nil, core.RemoteError("invalid refspec", err)
+		}
+		refspecs = append(refspecs, refspec)
+	}
+	return refspecs, nil
+}
+
+// pushRefspecs pushes refspecs, plus every branch with --all and every tag
+// with --tags, in one request
+func pushRefspecs(repo *core.Repository, remoteName string, refspecs []remote.PushRefspec, lease *remote.PushLease, startTime time.Time) error {
+	if pushAll {
+		branches, err := remote.BranchRefspecsRepo(repo)
+		if err != nil {
+			return core.RemoteError("failed to get local branches", err)
+		}
+		if len(branches) == 0 {
+			return core.RemoteError("no local branches found to push", nil)
+		}
+		refspecs = append(refspecs, branches...)
+	}
+	if pushTags {
+		tags, err := remote.TagRefspecsRepo(repo)
+		if err != nil {
+			return core.RemoteError("failed to get local tags", err)
+		}
+		refspecs = append(refspecs, tags...)
+	}
+	if len(refspecs) == 0 {
+		if !pushQuiet {
+			fmt.Println("Everything up-to-date")
+		}
+		return nil
+	}
+	if pushVerbose && !pushQuiet {
+		fmt.Printf("Pushing %d refs to remote '%s'...\n", len(refspecs), remoteName)
+	}
+
+	pushOptions := remote.PushOptions{
+		Force:       pushForce,
+		Verbose:     pushVerbose,
+		Timeout:     time.Duration(pushTimeout) * time.Second,
+		DryRun:      pushDryRun,
+		Progress:    pushProgress,
+		SetUpstream: pushSetUpstream,
+		Lease:       lease,
+		NoVerify:    pushNoVerify,
+		NoSizeCheck: pushNoSizeCheck,
+		Atomic:      pushAtomic,
+	}
+
+	updates, err := remote.PushRefspecsRepo(repo, remoteName, refspecs, pushOptions)
+	if !pushQuiet && !pushDryRun {
+		displayPushSummary(remoteName, updates)
+	}
+	if err != nil {
+		return core.RemoteError("push failed", err)
+	}
+
+	if !pushQuiet {
+		fmt.Printf("Push completed in %v\n", time.Since(startTime).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// pushDeleteRefs deletes the named remote branches or tags
+func pushDeleteRefs(repo *core.Repository, remoteName string, refs []string, lease *remote.PushLease, startTime time.Time) error {
+	if pushAll || pushTags || pushMirror || pushPrune || pushSetUpstream {
+		return core.RemoteError("deleting refs cannot be combined with --all, --tags, --mirror, --prune or --set-upstream", nil)
+	}
+
+	pushOptions := remote.PushOptions{
+		Verbose:     pushVerbose,
+		Timeout:     time.Duration(pushTimeout) * time.Second,
+		DryRun:      pushDryRun,
+		Lease:       lease,
+		NoVerify:    pushNoVerify,
+		NoSizeCheck: pushNoSizeCheck,
+		Atomic:      pushAtomic,
+	}
+
+	updates, err := remote.DeleteRemoteRefsRepo(repo, remoteName, refs, pushOptions)
+	if !pushQuiet && !pushDryRun {
+		displayPushSummary(remoteName, updates)
+	}
+	if err != nil {
+		return core.RemoteError("push failed", err)
+	}
+
+	if !pushQuiet {
+		fmt.Printf("Push completed in %v\n", time.Since(startTime).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// pushAndPrune handles --mirror and --all --prune, which push every local ref
+// and delete remote refs that no longer exist locally
+func pushAndPrune(repo *core.Repository, remoteName string, refArgs []string, lease *remote.PushLease, startTime time.Time) error {
+	switch {
+	case len(refArgs) > 0:
+		return core.RemoteError("--mirror and --prune cannot be combined with a branch", nil)
+	case pushMirror && (pushAll || pushTags || pushSetUpstream):
+		return core.RemoteError("--mirror cannot be combined with --all, --tags or --set-upstream", nil)
+	case pushPrune && !pushMirror && !pushAll:
+		return core.RemoteError("--prune requires --all or --mirror", nil)
+	}
+
+	pushOptions := remote.PushOptions{
+		Force:       pushForce,
+		Verbose:     pushVerbose,
+		Timeout:     time.Duration(pushTimeout) * time.Second,
+		DryRun:      pushDryRun,
+		Progress:    pushProgress,
+		SetUpstream: pushSetUpstream,
+		Lease:       lease,
+		NoVerify:    pushNoVerify,
+		NoSizeCheck: pushNoSizeCheck,
+		Atomic:      pushAtomic,
+	}
+
+	var updates []*remote.RefUpdate
+	var err error
+	if pushMirror {
+		updates, err = remote.MirrorPushRepo(repo, remoteName, pushOptions)
+	} else {
+		updates, err = remote.PushPruneRepo(repo, remoteName, pushOptions)
+	}
+	if !pushQuiet && !pushDryRun {
+		displayPushSummary(remoteName, updates)
+	}
+	if err != nil {
+		return core.RemoteError("push failed", err)
+	}
+
+	if !pushQuiet {
+		fmt.Printf("Push completed in %v\n", time.Since(startTime).Round(time.Millisecond))
+	}
+	return nil
 }
 
-// Display a summary of push operations
-func displayPushSummary(results map[string]pushResult) {
-	fmt.Println("\nPush Summary:")
-	fmt.Println("------------------------------------")
-
-	successCount := 0
-	failureCount := 0
-
-	for _, result := range results {
-		status := "SUCCESS"
-		details := ""
-		if !result.Success {
-			status = "FAILED"
-			details = fmt.Sprintf(" - %v", result.Error)
-			failureCount++
+// displayPushSummary prints one line per ref update, rejected ones to stderr
+func displayPushSummary(remoteName string, updates []*remote.RefUpdate) {
+	if len(updates) == 0 {
+		return
+	}
+	fmt.Printf("To %s\n", remoteName)
+
+	rejected := 0
+	for _, update := range updates {
+		if update.Rejected() {
+			rejected++
+			fmt.Fprintln(os.Stderr, update.Summary())
 		} else {
-			successCount++
+			fmt.Println(update.Summary())
 		}
-		fmt.Printf("  %s: %s%s\n", result.BranchName, status, details)
 	}
 
-	fmt.Println("------------------------------------")
-	fmt.Printf("Total: %d successful, %d failed\n", successCount, failureCount)
+	if rejected > 0 {
+		fmt.Fprintf(os.Stderr, "error: failed to push %d of %d refs to '%s'\n", rejected, len(updates), remoteName)
+	}
 }
 
 func init() {
 	pushCmd := NewRepoCommand(
-		"push [<remote>] [<branch>]",
+		"push [<remote>] [<refspec>... | --delete <ref>...]",
 		"Update remote refs along with associated objects",
 		PushHandler,
 	)
@@ -226,27 +362,72 @@ Examples:
   vec push                   # Push current branch to default remote (origin)
   vec push upstream          # Push current branch to upstream remote
   vec push origin main       # Push main branch to origin remote
+  vec push origin main topic # Push main and topic in one request
+  vec push origin main:release # Push local main to the remote branch release
+  vec push origin tag v1.0   # Push tag v1.0 to origin
+  vec push --tags            # Push all tags to default remote
+  vec push --atomic origin main v1.0 # Update both refs or neither
   vec push --all             # Push all branches to default remote
+  vec push --all --prune     # Also delete remote branches that no longer exist locally
+  vec push --mirror backup   # Make 'backup' an exact copy of all local branches and tags
+  vec push origin :topic     # Delete branch 'topic' on origin
+  vec push -d origin v1 v2   # Delete the branches or tags 'v1' and 'v2' on origin
   vec push --force           # Force push (allow non-fast-forward updates)
+  vec push --force-with-lease # Force push only if the remote branch hasn't moved since the last fetch
   vec push --verbose         # Show detailed progress information
   vec push --dry-run         # Simulate push without making changes
-  vec push --set-upstream    # Set upstream for current branch
-
-If no remote is specified, 'origin' is used.
-If no branch is specified, the current branch is used.`
-
-	pushCmd.Args = cobra.RangeArgs(0, 2)
+  vec push -u origin topic   # Push 'topic' and make origin/topic its upstream
+
+--force-with-lease=<ref> leases only that remote branch, against its
+remote-tracking ref; --force-with-lease=<ref>:<commit> expects it to be at
+<commit>, and an empty <commit> expects the ref not to exist yet. Tags and
+other refs have no remote-tracking ref, so they are leased only with an
+explicit <commit>. The server applies the update as a compare-and-swap, so
+a push that races with the lease check is still refused.
+
+A refspec is [+]<src>[:<dst>]: the local branch or tag <src> is pushed to
+<dst> on the remote, or to the ref of the same name without one, and a
+leading '+' allows that ref to be updated without a fast-forward. ":<dst>"
+deletes <dst>. A tag that already exists on the remote is only replaced
+with --force or '+'. All refs given, and those of --all and --tags, are
+updated in one request and each is reported on its own line. With --atomic
+the remote applies all of the updates or none of them; nothing is sent when
+one is already refused locally.
+
+Set push.autoSetupRemote to true to record the upstream automatically the
+first time a branch without one is pushed.
+
+If no remote is specified, the remote tracked by the current branch is used,
+or 'origin' if it has none.
+
+If no branch is specified, push.default decides what is pushed:
+  simple    the current branch to a branch of the same name (default); refuses
+            if the branch's upstream on that remote has a different name
+  current   the current branch to a branch of the same name
+  upstream  the current branch to its configured upstream branch
+  matching  every local branch that also exists on the remote
+  nothing   nothing; a branch must be named`
+
+	pushCmd.Args = cobra.ArbitraryArgs
 
 	// Add push options
 	pushCmd.Flags().BoolVarP(&pushForce, "force", "f", false, "Force push even when it results in a non-fast-forward update")
+	pushCmd.Flags().StringVar(&pushLease, "force-with-lease", "", "Force push only if the remote ref is at the expected value (`ref[:expected]`, default: last fetched)")
+	pushCmd.Flags().Lookup("force-with-lease").NoOptDefVal = pushLeaseAll
 	pushCmd.Flags().BoolVar(&pushDryRun, "dry-run", false, "Simulate push without making changes")
 	pushCmd.Flags().BoolVarP(&pushQuiet, "quiet", "q", false, "Suppress all output")
 	pushCmd.Flags().BoolVarP(&pushVerbose, "verbose", "v", false, "Be verbose")
 	pushCmd.Flags().BoolVar(&pushAll, "all", false, "Push all branches")
-	pushCmd.Flags().BoolVarP(&pushUpstream, "upstream", "u", false, "Push to upstream branch instead of remote")
+	pushCmd.Flags().BoolVar(&pushTags, "tags", false, "Push all tags, in addition to any refspecs given")
+	pushCmd.Flags().BoolVar(&pushAtomic, "atomic", false, "Update all refs on the remote or none of them")
+	pushCmd.Flags().BoolVar(&pushMirror, "mirror", false, "Push all branches and tags, force-updating them and deleting remote refs absent locally")
+	pushCmd.Flags().BoolVarP(&pushDelete, "delete", "d", false, "Delete the named branches or tags on the remote")
+	pushCmd.Flags().BoolVar(&pushPrune, "prune", false, "Delete remote branches that no longer exist locally (with --all)")
 	pushCmd.Flags().BoolVar(&pushProgress, "progress", true, "Show progress during push")
 	pushCmd.Flags().IntVar(&pushTimeout, "timeout", 30, "Push timeout in seconds")
-	pushCmd.Flags().BoolVar(&pushSetUpstream, "set-upstream", false, "Set upstream for the current branch")
+	pushCmd.Flags().BoolVarP(&pushSetUpstream, "set-upstream", "u", false, "Record the pushed branch as upstream after a successful push")
+	pushCmd.Flags().BoolVar(&pushNoVerify, "no-verify", false, "Bypass the pre-push hook")
+	pushCmd.Flags().BoolVar(&pushNoSizeCheck, "no-size-check", false, "Skip the push.maxObjectSize and push.maxPackSize checks")
 
 	rootCmd.AddCommand(pushCmd)
 }
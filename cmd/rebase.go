@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/rebase"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rebaseInteractive bool
+	rebaseOnto        string
+	rebaseContinue    bool
+	rebaseSkip        bool
+	rebaseAbort       bool
+	rebasePlan        bool
+	rebaseJSON        bool
+)
+
+var rebaseCmd *cobra.Command
+
+// RebaseHandler starts, continues, skips a step of or aborts a rebase
+func RebaseHandler(repo *core.Repository, args []string) error {
+	actions := 0
+	for _, set := range []bool{rebaseContinue, rebaseSkip, rebaseAbort} {
+		if set {
+			actions++
+		}
+	}
+	if actions > 1 || actions == 1 && (len(args) > 0 || rebaseInteractive || rebaseOnto != "" || rebasePlan) {
+		return core.RepositoryError("--continue, --skip and --abort take no other arguments", nil)
+	}
+
+	edit := func(message string) (string, error) {
+		edited, err := editTextRepo(repo, "COMMIT_EDITMSG", message+"\n\n# Please enter the commit message for the rebased commit. Lines starting\n# with '#' will be ignored, and an empty message stops the rebase.\n")
+		if err == nil && edited == "" {
+			err = fmt.Errorf("aborting commit due to empty message; run 'vec rebase --continue' to try again")
+		}
+		return edited, err
+	}
+	var result *rebase.Result
+	var err error
+	switch {
+	case rebaseAbort:
+		if err := rebase.AbortRepo(repo); err != nil {
+			return err
+		}
+		fmt.Println("Rebase aborted.")
+		return nil
+	case rebaseContinue:
+		result, err = rebase.ContinueRepo(repo, edit)
+	case rebaseSkip:
+		result, err = rebase.SkipRepo(repo, edit)
+	default:
+		result, err = startRebaseRepo(repo, args, edit)
+	}
+	if err != nil || result == nil {
+		return err
+	}
+	return reportRebase(repo, result)
+}
+
+// startRebaseRepo begins a rebase of HEAD onto the upstream in args, or the
+// upstream of the current branch, letting the user edit the todo list with -i
+func startRebaseRepo(repo *core.Repository, args []string, edit rebase.Editor) (*rebase.Result, error) {
+	if len(args) > 1 {
+		return nil, core.RepositoryError("rebase takes at most one upstream", nil)
+	}
+	upstreamRev := ""
+	if len(args) == 1 {
+		upstreamRev = args[0]
+	} else {
+		branch, err := repo.GetCurrentBranch()
+		if err != nil {
+			return nil, err
+		}
+		upstream, err := repo.GetBranchUpstream(branch)
+		if err != nil {
+			return nil, err
+		}
+		if upstream == nil {
+			return nil, core.RepositoryError("there is no upstream to rebase onto; name one: vec rebase <upstream>", nil)
+		}
+		upstreamRev = upstream.TrackingRef()
+	}
+	options := rebase.Options{}
+	var err error
+	if options.Upstream, err = repo.ResolveRevision(upstreamRev); err != nil {
+		return nil, core.RefError(fmt.Sprintf("unknown revision '%s'", upstreamRev), err)
+	}
+	if rebaseOnto != "" {
+		if options.Onto, err = repo.ResolveRevision(rebaseOnto); err != nil {
+			return nil, core.RefError(fmt.Sprintf("unknown revision '%s'", rebaseOnto), err)
+		}
+	}
+
+	if rebasePlan {
+		plan, err := rebase.PreviewRepo(repo, options)
+		if err != nil {
+			return nil, err
+		}
+		return nil, printPlan(plan, rebaseJSON)
+	}
+	if rebaseInteractive {
+		head, err := repo.ReadHead()
+		if err != nil {
+			return nil, core.RefError("failed to read HEAD", err)
+		}
+		steps, err := rebase.PlanRepo(repo, head, options.Upstream)
+		if err != nil {
+			return nil, err
+		}
+		onto := options.Onto
+		if onto == "" {
+			onto = options.Upstream
+		}
+		edited, err := editTextRepo(repo, "rebase-todo", rebase.FormatTodo(steps, onto))
+		if err != nil {
+			return nil, err
+		}
+		if options.Todo, err = rebase.ParseTodo(repo, edited); err != nil {
+			return nil, err
+		}
+		if len(options.Todo) == 0 {
+			fmt.Println("Nothing to do")
+			return nil, nil
+		}
+	}
+	return rebase.StartRepo(repo, options, edit)
+}
+
+// reportRebase prints where a rebase run ended; a stop on conflicts exits
+// with status 1
+func reportRebase(repo *core.Repository, result *rebase.Result) error {
+	for _, step := range result.Empty {
+		fmt.Printf("dropping %s %s -- patch contents already upstream\n", shortCommitHash(step.Commit), step.Subject)
+	}
+	if result.Stopped != nil {
+		fmt.Printf("Could not apply %s... %s\n", shortCommitHash(result.Stopped.Commit), result.Stopped.Subject)
+		for _, path := range result.Conflicts {
+			fmt.Printf("CONFLICT: Merge conflict in %s\n", path)
+		}
+		fmt.Println(`Resolve the conflicts, mark them as resolved with "vec add <paths>", then
+run "vec rebase --continue". Use "vec rebase --skip" to leave this commit
+out, or "vec rebase --abort" to go back to where you started.`)
+		return silentExit(rebaseCmd, 1)
+	}
+
+	branch, err := repo.GetCurrentBranch()
+	if err != nil || branch == "(HEAD detached)" {
+		branch = "HEAD"
+	}
+	if result.UpToDate {
+		fmt.Printf("Current branch %s is up to date.\n", branch)
+	} else {
+		fmt.Printf("Successfully rebased and updated %s.\n", branch)
+	}
+	return nil
+}
+
+// editTextRepo opens text in the editor as .vec/<name> and returns it
+// without '#' lines and surrounding blank space
+func editTextRepo(repo *core.Repository, name, text string) (string, error) {
+	path := filepath.Join(repo.VecDir, name)
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		return "", core.FSError("failed to write "+name, err)
+	}
+	editor, err := core.ResolveEditor(repo.Root)
+	if err != nil {
+		return "", err
+	}
+	execCmd := exec.Command(editor.Value, path)
+	execCmd.Stdin = os.Stdin
+	execCmd.Stdout = os.Stdout
+	execCmd.Stderr = os.Stderr
+	if err := execCmd.Run(); err != nil {
+		return "", fmt.Errorf("editor failed: %w", err)
+	}
+
+	edited, err := os.ReadFile(path)
+	if err != nil {
+		return "", core.FSError("failed to read "+name, err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(edited), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+func init() {
+	rebaseCmd = NewRepoCommand(
+		"rebase [-i] [--onto <newbase>] [<upstream>]",
+		"Replay commits on top of another base",
+		RebaseHandler,
+	)
+	rebaseCmd.Long = `Replay the commits of the current branch that are not in <upstream>, the
+branch's upstream by default, on top of it, or of <newbase> with --onto,
+then move the branch to the result. Merge commits are not replayed: the
+rebased history is linear. Each replayed commit keeps its author and date
+and is committed anew by you.
+
+With -i the list of commits to replay opens in the editor first. Each line
+is a command and a commit: pick uses the commit, reword uses it but edits
+its message, squash melds it into the commit before, joining the messages,
+and drop leaves it out. Lines can be reordered or removed.
+
+When a commit doesn't apply cleanly the rebase stops with the conflicts in
+the working tree and the index. Resolve them, stage the files with vec add
+and run vec rebase --continue; --skip leaves the commit out and --abort
+returns to the branch as it was. The state of a stopped rebase is kept in
+.vec/rebase-merge.
+
+With --plan nothing is rebased: the commits that would be replayed, those
+predicted to conflict or to become empty, and the ref that would move are
+printed instead, as JSON with --json.
+
+Examples:
+  vec rebase main                        # Replay the current branch on main
+  vec rebase -i HEAD~3                   # Reorder, reword or squash the last 3 commits
+  vec rebase --onto main feature         # Move the commits since feature onto main
+  vec rebase --continue                  # Go on after resolving conflicts
+  vec rebase --plan main                 # See what rebasing on main would do`
+	rebaseCmd.Flags().BoolVarP(&rebaseInteractive, "interactive", "i", false, "Edit the list of commits to replay before starting")
+	rebaseCmd.Flags().StringVar(&rebaseOnto, "onto", "", "Replay onto this commit instead of <upstream>")
+	rebaseCmd.Flags().BoolVar(&rebaseContinue, "continue", false, "Commit the resolved conflicts and go on with the rebase")
+	rebaseCmd.Flags().BoolVar(&rebaseSkip, "skip", false, "Leave out the commit that stopped the rebase and go on")
+	rebaseCmd.Flags().BoolVar(&rebaseAbort, "abort", false, "Stop rebasing and return to where the rebase started")
+	rebaseCmd.Flags().BoolVar(&rebasePlan, "plan", false, "Show what the rebase would do without changing anything")
+	rebaseCmd.Flags().BoolVar(&rebaseJSON, "json", false, "With --plan, print the plan as JSON")
+
+	rootCmd.AddCommand(rebaseCmd)
+}
@@ -1,19 +1,24 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 
+	"github.com/NahomAnteneh/vec/internal/packfile"
 	"github.com/NahomAnteneh/vec/internal/remote"
+	vechttp "github.com/NahomAnteneh/vec/internal/remote/http"
 	"github.com/NahomAnteneh/vec/utils"
 	"github.com/spf13/cobra"
 )
 
 var (
 	// Remote command options
-	remoteVerbose bool
-	remotePrune   bool
+	remoteVerbose     bool
+	remotePrune       bool
+	remoteShowDryRun  bool
+	remoteShowNoQuery bool
 )
 
 // remoteCmd represents the remote command
@@ -52,7 +57,13 @@ var addRemoteCmd = &cobra.Command{
 	
 The command 'vec fetch <name>' can then be used to create and update
 remote-tracking branches <name>/<branch> for each branch in the
-remote repository.`,
+remote repository.
+
+<url> may also be a file:// URL or a path of a repository on the same
+machine. Fetches and pushes then read and write that repository directly,
+without a server; relative paths are resolved against the current directory.
+Pushing to the branch checked out there is refused unless that repository
+sets receive.denyCurrentBranch to false.`,
 	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		name := args[0]
@@ -122,7 +133,7 @@ configuration settings for the remote are removed.`,
 var showRemoteCmd = &cobra.Command{
 	Use:   "show <name>",
 	Short: "Show information about a remote",
-	Long:  `Display information about the remote <name>.`,
+	Long:  `Display information about the remote <name>, with the statistics its server reports unless --no-query is given.`,
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		name := args[0]
@@ -144,6 +155,12 @@ var showRemoteCmd = &cobra.Command{
 		// Display remote info
 		fmt.Printf("* remote %s\n", name)
 		fmt.Printf("  URL: %s\n", remoteInfo.URL)
+		if remoteInfo.FetchURL != remoteInfo.URL {
+			fmt.Printf("  Fetch URL: %s\n", remoteInfo.FetchURL)
+		}
+		if remoteInfo.PushURL != remoteInfo.FetchURL {
+			fmt.Printf("  Push URL: %s\n", remoteInfo.PushURL)
+		}
 		
 		if len(remoteInfo.Branches) > 0 {
 			fmt.Printf("  Tracked branches:\n")
@@ -159,9 +176,46 @@ var showRemoteCmd = &cobra.Command{
 			lastFetchedTime := utils.FormatTimestamp(remoteInfo.LastFetched)
 			fmt.Printf("  Last fetched: %s\n", lastFetchedTime)
 		}
+
+		// Repository statistics come from the server; dry runs stay offline
+		if !remoteShowNoQuery && !remoteShowDryRun {
+			printRemoteServerInfo(repoRoot, name)
+		}
+
+		// Describe what a fetch from this remote would do, without contacting it
+		if remoteShowDryRun {
+			fmt.Printf("  Dry run: would request %s/info/refs\n", strings.TrimRight(remoteInfo.FetchURL, "/"))
+			fmt.Printf("  Dry run: would update refs/remotes/%s/* (%d tracked)\n", name, len(remoteInfo.Branches))
+		}
 	},
 }
 
+// printRemoteServerInfo prints what the remote's info endpoint reports, or
+// why it couldn't be read
+func printRemoteServerInfo(repoRoot, name string) {
+	info, err := remote.GetRemoteServerInfo(repoRoot, name)
+	if errors.Is(err, vechttp.ErrNotFound) {
+		fmt.Printf("  Repository info: not provided by the server\n")
+		return
+	}
+	if err != nil {
+		fmt.Printf("  Repository info: unavailable (%v)\n", err)
+		return
+	}
+
+	if info.DefaultBranch != "" {
+		fmt.Printf("  HEAD branch: %s\n", info.DefaultBranch)
+	}
+	fmt.Printf("  Branches: %d, tags: %d\n", info.Branches, info.Tags)
+	fmt.Printf("  Repository size: %s\n", packfile.FormatBytes(info.Size))
+	if len(info.Capabilities) > 0 {
+		fmt.Printf("  Capabilities: %s\n", strings.Join(info.Capabilities, ", "))
+	}
+	if info.Archived {
+		fmt.Printf("  Archived: yes (pushes are refused)\n")
+	}
+}
+
 // setUrlCmd represents the 'remote set-url' command
 var setUrlCmd = &cobra.Command{
 	Use:   "set-url <name> <url>",
@@ -240,7 +294,8 @@ func listRemotes(verbose bool) error {
 	// Display remotes
 	for name, info := range remotes {
 		if verbose {
-			fmt.Printf("%s\t%s\n", name, info.URL)
+			fmt.Printf("%s\t%s (fetch)\n", name, info.FetchURL)
+			fmt.Printf("%s\t%s (push)\n", name, info.PushURL)
 		} else {
 			fmt.Println(name)
 		}
@@ -281,5 +336,7 @@ func init() {
 	remoteCmd.AddCommand(setCredentialsCmd)
 
 	// Add flags
-	remoteCmd.Flags().BoolVarP(&remoteVerbose, "verbose", "v", false, "Show remote URL after name")
+	remoteCmd.Flags().BoolVarP(&remoteVerbose, "verbose", "v", false, "Show effective fetch and push URLs after name")
+	showRemoteCmd.Flags().BoolVarP(&remoteShowNoQuery, "no-query", "n", false, "Don't ask the remote for repository statistics")
+	showRemoteCmd.Flags().BoolVar(&remoteShowDryRun, "dry-run", false, "Also show the requests a fetch would make, without contacting the remote")
 }
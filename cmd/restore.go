@@ -1,11 +1,16 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 
+	"github.com/NahomAnteneh/vec/core"
 	"github.com/NahomAnteneh/vec/internal/objects"
 	"github.com/NahomAnteneh/vec/internal/staging"
 	"github.com/NahomAnteneh/vec/utils"
@@ -17,6 +22,7 @@ var (
 	restoreStaged  bool
 	restoreWorking bool
 	restoreQuiet   bool
+	restorePatch   bool
 )
 
 // restoreCmd represents the restore command
@@ -30,12 +36,18 @@ With --source, restore files from the specified commit or branch (defaults to HE
 With --staged, restore files in the staging area from the HEAD commit.
 If no paths are specified, it works on all tracked files.
 
+With -p, the differences are shown hunk by hunk and only the chosen hunks
+are restored: discarded from the working tree, or with --staged unstaged.
+At each hunk, y restores it, n keeps it, a and d restore or keep the rest of
+the file, s splits it into smaller hunks and q stops.
+
 Examples:
   vec restore file.txt            # Restore file.txt from index to working tree
   vec restore --staged file.txt   # Unstage file.txt (restore from HEAD to index)
   vec restore --source=HEAD~1 file.txt  # Restore file from previous commit
   vec restore --source=main file.txt    # Restore file from main branch
-  vec restore .                   # Restore all files in current directory`,
+  vec restore .                   # Restore all files in current directory
+  vec restore -p file.txt         # Choose which changes to file.txt to discard`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Get repository root
 		repoRoot, err := utils.GetVecRoot()
@@ -112,6 +124,10 @@ Examples:
 			return fmt.Errorf("no paths specified for restoration")
 		}
 
+		if restorePatch {
+			return restorePatchRepo(core.NewRepository(repoRoot), index, sourceTree, filesToRestore)
+		}
+
 		// Handle operations based on flags
 		if restoreStaged {
 			// Restore staging area from source
@@ -190,6 +206,8 @@ func expandPath(repoRoot, path string) ([]string, error) {
 
 // restoreStageArea restores files in the staging area from the source tree
 func restoreStageArea(repoRoot string, index *staging.Index, sourceTree *objects.TreeObject, paths []string) error {
+	repo := core.NewRepository(repoRoot)
+
 	// Collect all files from source tree
 	treeFiles := make(map[string]objects.TreeEntry)
 	collectTreeEntries(repoRoot, sourceTree, "", treeFiles)
@@ -266,20 +284,15 @@ func restoreStageArea(repoRoot string, index *staging.Index, sourceTree *objects
 				// This is needed to properly add the entry to the index
 				// In a real implementation, you might want to extract the file from the blob
 				// and stat it
-				blobContent, err := objects.GetBlob(repoRoot, entry.Hash)
-				if err != nil {
-					return fmt.Errorf("failed to get blob '%s': %w", entry.Hash, err)
-				}
-
 				// Create the file temporarily just to get file info
-				tempDir, err := os.MkdirTemp("", "vec-restore")
+				tempDir, err := core.CreateTempDir(repoRoot, "vec-restore")
 				if err != nil {
 					return fmt.Errorf("failed to create temp directory: %w", err)
 				}
-				defer os.RemoveAll(tempDir)
+				defer core.RemoveTempFile(tempDir)
 
 				tempFile := filepath.Join(tempDir, "temp")
-				if err := os.WriteFile(tempFile, blobContent, 0644); err != nil {
+				if err := objects.WriteBlobFileRepo(repo, entry.Hash, tempFile, false); err != nil {
 					return fmt.Errorf("failed to write temp file: %w", err)
 				}
 
@@ -348,6 +361,12 @@ func restoreStageArea(repoRoot string, index *staging.Index, sourceTree *objects
 
 // restoreWorkingTree restores files in the working tree from index or source tree
 func restoreWorkingTree(repoRoot string, index *staging.Index, sourceTree *objects.TreeObject, paths []string) error {
+	repo := core.NewRepository(repoRoot)
+	perms, err := repo.Permissions()
+	if err != nil {
+		return err
+	}
+
 	// Decide source: index (default) or source tree
 	useSource := sourceTree != nil && restoreSource != ""
 
@@ -400,18 +419,12 @@ func restoreWorkingTree(repoRoot string, index *staging.Index, sourceTree *objec
 			dirPath := filepath.Dir(absPath)
 
 			// Create directory if needed
-			if err := os.MkdirAll(dirPath, 0755); err != nil {
+			if err := perms.MkdirAll(dirPath); err != nil {
 				return fmt.Errorf("failed to create directory '%s': %w", dirPath, err)
 			}
 
-			// Get blob content
-			blobContent, err := objects.GetBlob(repoRoot, entry.Hash)
-			if err != nil {
-				return fmt.Errorf("failed to get blob '%s': %w", entry.Hash, err)
-			}
-
-			// Write to file
-			if err := os.WriteFile(absPath, blobContent, os.FileMode(entry.Mode)); err != nil {
+			// Stream the blob into the file
+			if err := objects.WriteBlobFileRepo(repo, entry.Hash, absPath, entry.Mode == objects.ModeExecutable); err != nil {
 				return fmt.Errorf("failed to write file '%s': %w", treePath, err)
 			}
 
@@ -456,18 +469,12 @@ func restoreWorkingTree(repoRoot string, index *staging.Index, sourceTree *objec
 			dirPath := filepath.Dir(absPath)
 
 			// Create directory if needed
-			if err := os.MkdirAll(dirPath, 0755); err != nil {
+			if err := perms.MkdirAll(dirPath); err != nil {
 				return fmt.Errorf("failed to create directory '%s': %w", dirPath, err)
 			}
 
-			// Get blob content
-			blobContent, err := objects.GetBlob(repoRoot, entry.SHA256)
-			if err != nil {
-				return fmt.Errorf("failed to get blob '%s': %w", entry.SHA256, err)
-			}
-
-			// Write to file
-			if err := os.WriteFile(absPath, blobContent, os.FileMode(entry.Mode)); err != nil {
+			// Stream the blob into the file
+			if err := objects.WriteBlobFileRepo(repo, entry.SHA256, absPath, entry.Mode == objects.ModeExecutable); err != nil {
 				return fmt.Errorf("failed to write file '%s': %w", entry.FilePath, err)
 			}
 
@@ -485,6 +492,135 @@ func restoreWorkingTree(repoRoot string, index *staging.Index, sourceTree *objec
 	return nil
 }
 
+// restorePathSelected reports whether relPath is one of paths, below one
+// of them, or paths is "."
+func restorePathSelected(paths map[string]bool, relPath string) bool {
+	for pattern := range paths {
+		if pattern == "." || pattern == relPath || (strings.HasSuffix(pattern, "/") && strings.HasPrefix(relPath, pattern)) {
+			return true
+		}
+	}
+	return false
+}
+
+// restorePatchRepo restores the hunks the user chooses: in the index from
+// the source tree with --staged, else in the working tree from the index or
+// --source. Only files present on both sides are offered.
+func restorePatchRepo(repo *core.Repository, index *staging.Index, sourceTree *objects.TreeObject, paths []string) error {
+	selectedPaths := make(map[string]bool)
+	for _, p := range paths {
+		selectedPaths[filepath.ToSlash(p)] = true
+	}
+
+	// The version each file is restored to
+	sources := make(map[string]string)
+	if restoreStaged || restoreSource != "" {
+		if sourceTree == nil {
+			return fmt.Errorf("no commit to restore from")
+		}
+		treeFiles := make(map[string]objects.TreeEntry)
+		collectTreeEntries(repo, sourceTree, "", treeFiles)
+		for treePath, entry := range treeFiles {
+			if entry.Type == "blob" {
+				sources[filepath.ToSlash(treePath)] = entry.Hash
+			}
+		}
+	} else {
+		for _, entry := range index.Entries {
+			if entry.Stage == 0 {
+				sources[filepath.ToSlash(entry.FilePath)] = entry.SHA256
+			}
+		}
+	}
+	filePaths := make([]string, 0, len(sources))
+	for filePath := range sources {
+		if restorePathSelected(selectedPaths, filePath) {
+			filePaths = append(filePaths, filePath)
+		}
+	}
+	sort.Strings(filePaths)
+
+	question, action := "Discard this hunk from worktree", "discard this hunk from worktree"
+	if restoreStaged {
+		question, action = "Unstage this hunk", "unstage this hunk"
+	}
+	in := bufio.NewReader(os.Stdin)
+	indexChanged := false
+	for _, filePath := range filePaths {
+		var current []byte
+		var entry *staging.IndexEntry
+		absPath := filepath.Join(repo.Root, filepath.FromSlash(filePath))
+		if restoreStaged {
+			var ok bool
+			if entry, ok = index.GetEntry(filePath, 0); !ok || entry.SHA256 == sources[filePath] {
+				continue
+			}
+			content, err := objects.GetBlobRepo(repo, entry.SHA256)
+			if err != nil {
+				return fmt.Errorf("failed to get blob '%s': %w", entry.SHA256, err)
+			}
+			current = content
+		} else {
+			content, err := os.ReadFile(absPath)
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("failed to read '%s': %w", filePath, err)
+			}
+			current = content
+		}
+
+		original, err := objects.GetBlobRepo(repo, sources[filePath])
+		if err != nil {
+			return fmt.Errorf("failed to get blob '%s': %w", sources[filePath], err)
+		}
+		if bytes.Equal(original, current) {
+			continue
+		}
+		if bytes.IndexByte(original, 0) >= 0 || bytes.IndexByte(current, 0) >= 0 {
+			fmt.Printf("Skipping binary file '%s'\n", filePath)
+			continue
+		}
+
+		oldLines := splitLinesKeepEnds(string(original))
+		changes := diffLineChanges(string(original), string(current))
+		selected, quit, err := selectHunks(in, os.Stdout, filePath, oldLines, changes, question, action)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(selected, true) {
+			restored := []byte(applyLineChanges(oldLines, changes, func(i int) bool { return !selected[i] }))
+			if restoreStaged {
+				hash, err := objects.CreateBlobRepo(repo, restored)
+				if err != nil {
+					return fmt.Errorf("failed to write blob for '%s': %w", filePath, err)
+				}
+				entry.SHA256 = hash
+				entry.Size = int64(len(restored))
+				indexChanged = true
+			} else {
+				mode := os.FileMode(0644)
+				if info, err := os.Stat(absPath); err == nil {
+					mode = info.Mode().Perm()
+				}
+				if err := os.WriteFile(absPath, restored, mode); err != nil {
+					return fmt.Errorf("failed to write file '%s': %w", filePath, err)
+				}
+			}
+		}
+		if quit {
+			break
+		}
+	}
+
+	if indexChanged {
+		if err := index.Write(); err != nil {
+			return fmt.Errorf("failed to write index: %w", err)
+		}
+	}
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(restoreCmd)
 
@@ -493,4 +629,5 @@ func init() {
 	restoreCmd.Flags().BoolVar(&restoreStaged, "staged", false, "Restore the content in the staging area (unstage)")
 	restoreCmd.Flags().BoolVarP(&restoreWorking, "working", "w", false, "Restore the working tree (default behavior)")
 	restoreCmd.Flags().BoolVarP(&restoreQuiet, "quiet", "q", false, "Suppress output")
+	restoreCmd.Flags().BoolVarP(&restorePatch, "patch", "p", false, "Interactively choose the hunks to restore")
 }
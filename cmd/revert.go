@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/merge"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/rebase"
+	"github.com/NahomAnteneh/vec/internal/staging"
+	"github.com/spf13/cobra"
+)
+
+var (
+	revertNoCommit bool
+	revertMainline int
+)
+
+var revertCmd *cobra.Command
+
+// RevertHandler undoes the changes of a commit in a new commit on top of HEAD
+func RevertHandler(repo *core.Repository, args []string) error {
+	if rebase.InProgress(repo) {
+		return core.RepositoryError("cannot revert during a rebase; finish it with vec rebase --continue or --abort", nil)
+	}
+	head, err := repo.ReadHead()
+	if err != nil {
+		return core.RefError("failed to read HEAD", err)
+	}
+	if head == "" {
+		return core.RepositoryError("cannot revert before the first commit", nil)
+	}
+	index, err := staging.LoadIndex(repo)
+	if err != nil {
+		return core.IndexError("failed to load index", err)
+	}
+	if index.HasConflicts() || index.HasUncommittedChanges(repo) {
+		return core.RepositoryError("cannot revert: you have uncommitted changes; commit or stash them", nil)
+	}
+
+	hash, err := repo.ResolveRevision(args[0])
+	if err != nil {
+		return core.RefError(fmt.Sprintf("unknown revision '%s'", args[0]), err)
+	}
+	commit, err := objects.GetCommitRepo(repo, hash)
+	if err != nil {
+		return core.ObjectError(fmt.Sprintf("failed to load commit %s", args[0]), err)
+	}
+	parentTree, err := revertParentTreeRepo(repo, commit)
+	if err != nil {
+		return err
+	}
+
+	// Undoing the commit is applying the change from its tree back to its parent's
+	conflicts, err := rebase.ApplyRepo(repo, commit.Tree, parentTree)
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s.", commit.Subject(), commit.CommitID)
+	if len(conflicts) > 0 || revertNoCommit {
+		if err := merge.PrepareCommitMessage(repo, message); err != nil {
+			return err
+		}
+	}
+	if len(conflicts) > 0 {
+		fmt.Printf("Could not revert %s... %s\n", shortCommitHash(commit.CommitID), commit.Subject())
+		for _, path := range conflicts {
+			fmt.Printf("CONFLICT: Merge conflict in %s\n", path)
+		}
+		fmt.Println(`Resolve the conflicts, mark them as resolved with "vec add <paths>", then
+run "vec commit" to record the revert.`)
+		return silentExit(revertCmd, 1)
+	}
+	if revertNoCommit {
+		fmt.Printf("Reverted %s; the changes are staged for the next commit\n", shortCommitHash(commit.CommitID))
+		return nil
+	}
+	return commitRevertRepo(repo, head, message)
+}
+
+// revertParentTreeRepo returns the tree of the parent commit is reverted
+// against: its only parent, or the one -m names for a merge
+func revertParentTreeRepo(repo *core.Repository, commit *objects.Commit) (string, error) {
+	switch {
+	case len(commit.Parents) > 1 && revertMainline == 0:
+		return "", core.RepositoryError(fmt.Sprintf("commit %s is a merge; choose the parent to revert to with -m", shortCommitHash(commit.CommitID)), nil)
+	case len(commit.Parents) <= 1 && revertMainline > 0:
+		return "", core.RepositoryError(fmt.Sprintf("commit %s is not a merge; -m is only for merges", shortCommitHash(commit.CommitID)), nil)
+	case revertMainline > len(commit.Parents):
+		return "", core.RepositoryError(fmt.Sprintf("commit %s has no parent %d", shortCommitHash(commit.CommitID), revertMainline), nil)
+	case len(commit.Parents) == 0:
+		return "", nil // Reverting the root commit removes everything it added
+	}
+	parentIndex := 0
+	if revertMainline > 0 {
+		parentIndex = revertMainline - 1
+	}
+	parent, err := objects.GetCommitRepo(repo, commit.Parents[parentIndex])
+	if err != nil {
+		return "", core.ObjectError("failed to load parent commit", err)
+	}
+	return parent.Tree, nil
+}
+
+// commitRevertRepo commits the staged revert on top of head and moves the
+// current branch, or the detached HEAD, to it
+func commitRevertRepo(repo *core.Repository, head, message string) error {
+	index, err := staging.LoadIndex(repo)
+	if err != nil {
+		return core.IndexError("failed to load index", err)
+	}
+	tree, err := staging.CreateTreeFromIndex(repo, index)
+	if err != nil {
+		return core.ObjectError("failed to write tree", err)
+	}
+	headCommit, err := objects.GetCommitRepo(repo, head)
+	if err != nil {
+		return core.ObjectError("failed to load HEAD commit", err)
+	}
+	if tree == headCommit.Tree {
+		return core.RepositoryError("nothing to commit: the changes are already undone in HEAD", nil)
+	}
+
+	authorName, authorEmail, err := core.ResolveIdentity(repo.Root, core.IdentityAuthor)
+	if err != nil {
+		return err
+	}
+	committerName, committerEmail, err := core.ResolveIdentity(repo.Root, core.IdentityCommitter)
+	if err != nil {
+		return err
+	}
+	author := fmt.Sprintf("%s <%s>", authorName.Value, authorEmail.Value)
+	committer := fmt.Sprintf("%s <%s>", committerName.Value, committerEmail.Value)
+	reverted, err := objects.CreateCommitRepo(repo, tree, []string{head}, author, committer, message, 0)
+	if err != nil {
+		return core.ObjectError("failed to create commit", err)
+	}
+
+	branch, err := repo.GetCurrentBranch()
+	if err != nil {
+		return core.RefError("failed to determine current branch", err)
+	}
+	subject, _, _ := strings.Cut(message, "\n")
+	logMessage := "revert: " + subject
+	movedRef := core.HeadFile
+	if branch != "(HEAD detached)" {
+		movedRef = "refs/heads/" + branch
+		if err := repo.UpdateRefCAS(movedRef, head, reverted); err != nil {
+			return core.RefError(fmt.Sprintf("failed to update %s", movedRef), err)
+		}
+		if err := repo.AppendReflog(branch, head, reverted, logMessage); err != nil {
+			return err
+		}
+	} else {
+		if err := repo.UpdateHead(reverted, false); err != nil {
+			return err
+		}
+		if err := repo.AppendReflog("", head, reverted, logMessage); err != nil {
+			return err
+		}
+	}
+	if err := repo.RecordRefMove(movedRef, head, reverted, logMessage); err != nil {
+		return err
+	}
+
+	fmt.Printf("[(%s) %s] %s\n", branch, shortCommitHash(reverted), subject)
+	return nil
+}
+
+func init() {
+	revertCmd = NewRepoCommand(
+		"revert [-n] [-m <parent>] <commit>",
+		"Undo the changes of a commit in a new commit",
+		RevertHandler,
+	)
+	revertCmd.Long = `Create a commit on top of HEAD that undoes the changes <commit> made,
+leaving the history before it as it is. The changes are undone with a
+three-way merge, so later commits that touched the same files are kept
+where they don't overlap.
+
+When the undo conflicts with later changes, the revert stops with the
+conflicts in the working tree and the index. Resolve them, stage the files
+with vec add and run vec commit, which offers the revert message. With -n
+the revert is only staged, to be committed the same way.
+
+A merge commit has more than one parent to go back to; -m picks which,
+counting from 1 for the branch that was merged into.
+
+Examples:
+  vec revert HEAD                        # Undo the last commit
+  vec revert -n a1b2c3d                  # Stage the undo of a1b2c3d without committing
+  vec revert -m 1 <merge>                # Undo what a merge brought in`
+	revertCmd.Args = cobra.ExactArgs(1)
+
+	revertCmd.Flags().BoolVarP(&revertNoCommit, "no-commit", "n", false, "Stage the revert without committing it")
+	revertCmd.Flags().IntVarP(&revertMainline, "mainline", "m", 0, "Parent number of a merge commit to revert to")
+
+	rootCmd.AddCommand(revertCmd)
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/spf13/cobra"
+)
+
+var (
+	revListCount       bool
+	revListMaxCount    int
+	revListFirstParent bool
+	revListObjects     bool
+)
+
+// RevListHandler lists the commits, and with --objects the other objects,
+// reachable from the given revisions but not from the excluded ones
+func RevListHandler(repo *core.Repository, args []string) error {
+	include, exclude, err := parseRevRangesRepo(repo, args)
+	if err != nil {
+		return err
+	}
+	if len(include) == 0 {
+		return core.RefError("rev-list needs at least one revision to list from", nil)
+	}
+
+	listed, err := objects.RevListRepo(repo, include, exclude, objects.RevListOptions{
+		FirstParent: revListFirstParent,
+		MaxCount:    revListMaxCount,
+		Objects:     revListObjects,
+	})
+	if err != nil {
+		return err
+	}
+
+	if revListCount {
+		fmt.Println(len(listed))
+		return nil
+	}
+	for _, obj := range listed {
+		if obj.Path != "" {
+			fmt.Printf("%s %s\n", obj.Hash, obj.Path)
+		} else {
+			fmt.Println(obj.Hash)
+		}
+	}
+	return nil
+}
+
+// parseRevRangesRepo resolves revision arguments into tips to include and
+// to exclude: ^<rev> excludes <rev>, <a>..<b> includes <b> but excludes <a>,
+// and <a>...<b> includes both but excludes their merge bases, either side
+// defaulting to HEAD
+func parseRevRangesRepo(repo *core.Repository, args []string) ([]string, []string, error) {
+	var include, exclude []string
+	resolve := func(rev string) (string, error) {
+		if rev == "" {
+			rev = core.HeadFile
+		}
+		hash, err := repo.ResolveRevision(rev)
+		if err != nil {
+			return "", core.RefError(fmt.Sprintf("unknown revision '%s'", rev), err)
+		}
+		return hash, nil
+	}
+
+	for _, arg := range args {
+		if left, right, ok := strings.Cut(arg, "..."); ok {
+			leftHash, err := resolve(left)
+			if err != nil {
+				return nil, nil, err
+			}
+			rightHash, err := resolve(right)
+			if err != nil {
+				return nil, nil, err
+			}
+			bases, err := objects.MergeBasesManyRepo(repo, leftHash, []string{rightHash})
+			if err != nil {
+				return nil, nil, core.ObjectError("failed to find merge base", err)
+			}
+			include = append(include, leftHash, rightHash)
+			exclude = append(exclude, bases...)
+			continue
+		}
+		if from, to, ok := strings.Cut(arg, ".."); ok {
+			fromHash, err := resolve(from)
+			if err != nil {
+				return nil, nil, err
+			}
+			toHash, err := resolve(to)
+			if err != nil {
+				return nil, nil, err
+			}
+			exclude = append(exclude, fromHash)
+			include = append(include, toHash)
+			continue
+		}
+		rev, excluded := strings.CutPrefix(arg, "^")
+		hash, err := resolve(rev)
+		if err != nil {
+			return nil, nil, err
+		}
+		if excluded {
+			exclude = append(exclude, hash)
+		} else {
+			include = append(include, hash)
+		}
+	}
+	return include, exclude, nil
+}
+
+func init() {
+	revListCmd := NewRepoCommand(
+		"rev-list [<options>] <revision>...",
+		"List commits and objects reachable from revisions",
+		RevListHandler,
+	)
+	revListCmd.Long = `List the commits reachable from the given revisions, excluding those
+reachable from any revision written as ^<rev>. <a>..<b> is short for ^<a> <b>,
+and <a>...<b> lists the commits on either side but not on both, leaving out
+those reachable from their merge bases; a missing side means HEAD. Commits are listed children before parents and
+otherwise newest first.
+
+With --objects the trees and blobs the listed commits need are listed after
+them, with the path they were first found at, along with any annotated tags
+named. Objects reachable from the excluded revisions are left out: this is
+the set of objects a push or fetch packs, found by the same traversal.
+
+Examples:
+  vec rev-list HEAD                      # Every commit in the history
+  vec rev-list origin/main..HEAD         # Commits not pushed yet
+  vec rev-list --count main ^v1.0        # Number of commits since v1.0
+  vec rev-list --objects main ^origin/main  # Objects a push of main would send`
+	revListCmd.Args = cobra.MinimumNArgs(1)
+
+	revListCmd.Flags().BoolVar(&revListCount, "count", false, "Print the number of listed objects instead of listing them")
+	revListCmd.Flags().IntVarP(&revListMaxCount, "max-count", "n", 0, "List at most this many commits")
+	revListCmd.Flags().BoolVar(&revListFirstParent, "first-parent", false, "Follow only the first parent of merge commits")
+	revListCmd.Flags().BoolVar(&revListObjects, "objects", false, "Also list the trees and blobs the commits need")
+
+	rootCmd.AddCommand(revListCmd)
+}
@@ -1,11 +1,20 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/NahomAnteneh/vec/core"
+	vechttp "github.com/NahomAnteneh/vec/internal/remote/http"
 	"github.com/spf13/cobra"
 )
 
+// offlineMode disables all network access for the invoked command
+var offlineMode bool
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "vec",
@@ -24,12 +33,65 @@ to quickly create a Cobra application.`,
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	// Temporary files must not outlive an interrupted command
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		core.CleanupTempFiles()
+		os.Exit(130)
+	}()
+
+	core.SetAuditCommand(os.Args)
 	err := rootCmd.Execute()
+	core.CleanupTempFiles()
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.code)
+	}
 	if err != nil {
 		os.Exit(1)
 	}
 }
 
+// exitCodeError ends a command with an exit status and no message, for
+// plumbing that answers through its exit status
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// silentExit returns an error that makes cmd exit with code without printing anything
+func silentExit(cmd *cobra.Command, code int) error {
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+	return &exitCodeError{code: code}
+}
+
 func init() {
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	rootCmd.PersistentFlags().BoolVar(&offlineMode, "offline", false,
+		"Fail any operation that needs the network (also enabled by "+vechttp.OfflineEnv+"=1)")
+
+	// Defaults from <command>.<flag> config keys, for every subcommand
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return applyFlagDefaults(cmd)
+	}
+
+	// Connection totals for the run, when tracing HTTP
+	rootCmd.PersistentPostRun = func(cmd *cobra.Command, args []string) {
+		if stats := vechttp.Stats(); vechttp.Tracing() && stats.Requests > 0 {
+			fmt.Fprintf(os.Stderr, "trace: http %d request%s, %d new connection%s, %d reused\n",
+				stats.Requests, plural(int(stats.Requests)), stats.NewConns, plural(int(stats.NewConns)), stats.ReusedConns)
+		}
+	}
+
+	cobra.OnInitialize(func() {
+		if offlineMode {
+			vechttp.SetOffline(true)
+		}
+	})
 }
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+)
+
+var (
+	showFormat   string
+	showDateMode string
+	showNoPatch  bool
+)
+
+// ShowHandler prints each given commit, HEAD by default, followed by its
+// changes against its first parent
+func ShowHandler(repo *core.Repository, args []string) error {
+	if !objects.IsDateMode(showDateMode) {
+		return fmt.Errorf("unknown --date format '%s' (expected one of %s)",
+			showDateMode, strings.Join(objects.DateModes, ", "))
+	}
+	if len(args) == 0 {
+		args = []string{"HEAD"}
+	}
+
+	for i, rev := range args {
+		hash, err := repo.ResolveRevision(rev)
+		if err != nil {
+			return core.RefError(fmt.Sprintf("unknown revision '%s'", rev), err)
+		}
+		commit, err := objects.GetCommitRepo(repo, hash)
+		if err != nil {
+			return core.ObjectError(fmt.Sprintf("failed to get commit %s", hash), err)
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Println(formatCommit(commit, showFormat, showDateMode))
+		if showNoPatch {
+			continue
+		}
+
+		parentFiles := map[string]string{}
+		if len(commit.Parents) > 0 {
+			if parentFiles, err = getCommitContents(repo.Root, commit.Parents[0]); err != nil {
+				return core.ObjectError("failed to read parent commit", err)
+			}
+		}
+		files, err := getCommitContents(repo.Root, hash)
+		if err != nil {
+			return core.ObjectError("failed to read commit", err)
+		}
+		printDiffPairs(diffFilePairs(parentFiles, files))
+	}
+	return nil
+}
+
+func init() {
+	showCmd := NewRepoCommand(
+		"show [<commit>...]",
+		"Show commits and their changes",
+		ShowHandler,
+	)
+	showCmd.Long = `Show each commit, HEAD by default, and the changes it made: the diff
+against its first parent, or everything it holds for a root commit.
+
+` + commitFormatHelp + `
+
+Examples:
+  vec show                            # The last commit and its diff
+  vec show --format=fuller -s HEAD~2  # Author and committer of HEAD~2
+  vec show --stat main                # Files changed by the tip of main`
+	showCmd.Flags().StringVar(&showFormat, "format", commitFormatMedium, "Commit format: medium, fuller, oneline or a %-placeholder template")
+	showCmd.Flags().StringVar(&showDateMode, "date", objects.DateDefault,
+		"Date format: "+strings.Join(objects.DateModes, ", "))
+	showCmd.Flags().BoolVarP(&showNoPatch, "no-patch", "s", false, "Show only the commit, not its changes")
+	showCmd.Flags().BoolVar(&diffStat, "stat", false, "Show the number of changed lines per file instead of the diff")
+	showCmd.Flags().BoolVar(&nameOnly, "name-only", false, "Show only names of changed files")
+
+	rootCmd.AddCommand(showCmd)
+}
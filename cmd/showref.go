@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/spf13/cobra"
+)
+
+var (
+	showRefHeads  bool
+	showRefTags   bool
+	showRefVerify bool
+	showRefHash   bool
+	showRefQuiet  bool
+)
+
+// matchShowRefPattern reports whether pattern names the trailing path
+// components of refName, so "main" matches refs/heads/main and
+// refs/remotes/origin/main
+func matchShowRefPattern(refName, pattern string) bool {
+	return refName == pattern || strings.HasSuffix(refName, "/"+pattern)
+}
+
+// printShowRef prints one line of show-ref output
+func printShowRef(ref core.Ref) {
+	if showRefQuiet {
+		return
+	}
+	if showRefHash {
+		fmt.Println(ref.Hash)
+		return
+	}
+	fmt.Printf("%s %s\n", ref.Hash, ref.Name)
+}
+
+// ShowRefHandler lists refs and the objects they point to
+func ShowRefHandler(repo *core.Repository, args []string) error {
+	if showRefVerify {
+		if len(args) == 0 {
+			return core.RefError("--verify requires a reference", nil)
+		}
+		for _, name := range args {
+			if !strings.HasPrefix(name, "refs/") {
+				return core.RefError(fmt.Sprintf("'%s' - not a valid ref", name), nil)
+			}
+			hash, err := repo.ReadRefValue(name)
+			if err != nil {
+				return err
+			}
+			if hash == "" {
+				return core.RefError(fmt.Sprintf("'%s' - not a valid ref", name), nil)
+			}
+			printShowRef(core.Ref{Name: name, Hash: hash})
+		}
+		return nil
+	}
+
+	refs, err := repo.ListRefs("refs/")
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, ref := range refs {
+		if showRefHeads || showRefTags {
+			isHead := showRefHeads && strings.HasPrefix(ref.Name, "refs/heads/")
+			isTag := showRefTags && strings.HasPrefix(ref.Name, "refs/tags/")
+			if !isHead && !isTag {
+				continue
+			}
+		}
+		matched := len(args) == 0
+		for _, pattern := range args {
+			if matchShowRefPattern(ref.Name, pattern) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			found = true
+			printShowRef(ref)
+		}
+	}
+	if !found {
+		return core.NotFoundError(core.ErrCategoryRef, "matching refs")
+	}
+	return nil
+}
+
+var showRefCmd *cobra.Command
+
+func init() {
+	showRefCmd = NewRepoCommand(
+		"show-ref [pattern...]",
+		"List references and the objects they point to",
+		ShowRefHandler,
+	)
+	showRefCmd.Long = `List refs as "<object id> <ref name>". A pattern matches refs ending in
+it, so 'vec show-ref main' lists refs/heads/main and refs/remotes/origin/main.
+The command fails when nothing matches, which makes it usable in scripts.
+
+Examples:
+  vec show-ref --heads                    # List branches
+  vec show-ref --tags                     # List tags
+  vec show-ref --verify refs/heads/main   # Require an exact ref name
+  vec show-ref -q --verify refs/tags/v1   # Only test whether the ref exists`
+
+	showRefCmd.Flags().BoolVar(&showRefHeads, "heads", false, "Only show branches (refs/heads)")
+	showRefCmd.Flags().BoolVar(&showRefTags, "tags", false, "Only show tags (refs/tags)")
+	showRefCmd.Flags().BoolVar(&showRefVerify, "verify", false, "Require each argument to be an exact, existing ref name")
+	showRefCmd.Flags().BoolVarP(&showRefHash, "hash", "s", false, "Only print object IDs")
+	showRefCmd.Flags().BoolVarP(&showRefQuiet, "quiet", "q", false, "Print nothing; only report success or failure")
+
+	rootCmd.AddCommand(showRefCmd)
+}
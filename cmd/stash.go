@@ -0,0 +1,361 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/staging"
+	"github.com/NahomAnteneh/vec/internal/stash"
+	"github.com/spf13/cobra"
+)
+
+var (
+	stashMessage   string
+	stashPatch     bool
+	stashIndex     bool
+	stashShowPatch bool
+)
+
+// StashPushHandler saves the local changes as a stash entry and resets the
+// tracked files to HEAD
+func StashPushHandler(repo *core.Repository, args []string) error {
+	if stashPatch {
+		return stashPatchRepo(repo)
+	}
+	commit, err := stash.PushRepo(repo, stash.PushOptions{Message: stashMessage})
+	if err != nil {
+		return err
+	}
+	if commit == "" {
+		fmt.Println("No local changes to save")
+		return nil
+	}
+
+	headTree, err := headTreeRepo(repo)
+	if err != nil {
+		return err
+	}
+	index, err := staging.LoadIndex(repo)
+	if err != nil {
+		return core.IndexError("failed to load index", err)
+	}
+	if err := checkoutTrackedFilesRepo(repo, index, headTree); err != nil {
+		return core.FSError("failed to reset the working tree after stashing (the changes are saved in stash@{0})", err)
+	}
+	return printSavedStash(repo)
+}
+
+// stashPatchRepo stashes the hunks the user selects of the changes to files
+// in HEAD, removing them from the working tree
+func stashPatchRepo(repo *core.Repository) error {
+	head, err := repo.ReadHead()
+	if err != nil || head == "" {
+		return core.RepositoryError("cannot stash before the first commit", err)
+	}
+	headTree, err := headTreeRepo(repo)
+	if err != nil {
+		return err
+	}
+	treeFiles := make(map[string]objects.TreeEntry)
+	collectTreeEntries(repo, headTree, "", treeFiles)
+	filePaths := make([]string, 0, len(treeFiles))
+	for filePath, entry := range treeFiles {
+		if entry.Type == "blob" {
+			filePaths = append(filePaths, filePath)
+		}
+	}
+	sort.Strings(filePaths)
+
+	in := bufio.NewReader(os.Stdin)
+	stashed := make(map[string][]byte)
+	kept := make(map[string][]byte)
+	for _, filePath := range filePaths {
+		current, err := os.ReadFile(filepath.Join(repo.Root, filePath))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return core.FSError(fmt.Sprintf("failed to read '%s'", filePath), err)
+		}
+		original, err := objects.GetBlobRepo(repo, treeFiles[filePath].Hash)
+		if err != nil {
+			return fmt.Errorf("failed to get blob '%s': %w", treeFiles[filePath].Hash, err)
+		}
+		if bytes.Equal(original, current) {
+			continue
+		}
+		if bytes.IndexByte(original, 0) >= 0 || bytes.IndexByte(current, 0) >= 0 {
+			fmt.Printf("Skipping binary file '%s'\n", filePath)
+			continue
+		}
+
+		oldLines := splitLinesKeepEnds(string(original))
+		changes := diffLineChanges(string(original), string(current))
+		selected, quit, err := selectHunks(in, os.Stdout, filepath.ToSlash(filePath), oldLines, changes, "Stash this hunk", "stash this hunk")
+		if err != nil {
+			return err
+		}
+		if slices.Contains(selected, true) {
+			stashed[filePath] = []byte(applyLineChanges(oldLines, changes, func(i int) bool { return selected[i] }))
+			kept[filePath] = []byte(applyLineChanges(oldLines, changes, func(i int) bool { return !selected[i] }))
+		}
+		if quit {
+			break
+		}
+	}
+	if len(stashed) == 0 {
+		fmt.Println("No changes selected")
+		return nil
+	}
+
+	commit, err := stash.PushRepo(repo, stash.PushOptions{Message: stashMessage, Worktree: stashed})
+	if err != nil {
+		return err
+	}
+	if commit == "" {
+		fmt.Println("No local changes to save")
+		return nil
+	}
+	perms, err := repo.Permissions()
+	if err != nil {
+		return err
+	}
+	for filePath, content := range kept {
+		if err := perms.WriteFile(filepath.Join(repo.Root, filePath), content); err != nil {
+			return core.FSError(fmt.Sprintf("failed to write '%s' (the selected hunks are saved in stash@{0})", filePath), err)
+		}
+	}
+	return printSavedStash(repo)
+}
+
+// headTreeRepo loads the tree of the HEAD commit
+func headTreeRepo(repo *core.Repository) (*objects.TreeObject, error) {
+	head, err := repo.ReadHead()
+	if err != nil {
+		return nil, core.RefError("failed to read HEAD", err)
+	}
+	commit, err := objects.GetCommitRepo(repo, head)
+	if err != nil {
+		return nil, core.ObjectError("failed to load HEAD commit", err)
+	}
+	tree, err := objects.GetTreeRepo(repo, commit.Tree)
+	if err != nil {
+		return nil, core.ObjectError("failed to load HEAD tree", err)
+	}
+	return tree, nil
+}
+
+// printSavedStash reports the entry just saved
+func printSavedStash(repo *core.Repository) error {
+	entry, err := stash.ResolveRepo(repo, "")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Saved working directory and index state %s\n", entry.Message)
+	return nil
+}
+
+// StashListHandler prints the stash entries, newest first
+func StashListHandler(repo *core.Repository, args []string) error {
+	entries, err := stash.ListRepo(repo)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fmt.Printf("%s: %s\n", entry.Name(), entry.Message)
+	}
+	return nil
+}
+
+// StashApplyHandler applies a stash entry, keeping it
+func StashApplyHandler(repo *core.Repository, args []string) error {
+	_, err := applyStashRepo(repo, args)
+	return err
+}
+
+// StashPopHandler applies a stash entry and drops it unless it conflicted
+func StashPopHandler(repo *core.Repository, args []string) error {
+	entry, err := applyStashRepo(repo, args)
+	if err != nil {
+		return err
+	}
+	if err := stash.DropRepo(repo, entry); err != nil {
+		return err
+	}
+	fmt.Printf("Dropped %s (%s)\n", entry.Name(), entry.Commit[:7])
+	return nil
+}
+
+// applyStashRepo applies the entry named by args and reports what changed.
+// Conflicts are an error, so pop keeps the entry.
+func applyStashRepo(repo *core.Repository, args []string) (stash.Entry, error) {
+	entry, err := stash.ResolveRepo(repo, stashEntryArg(args))
+	if err != nil {
+		return entry, err
+	}
+	result, err := stash.ApplyRepo(repo, entry, stashIndex)
+	if err != nil {
+		return entry, err
+	}
+	for _, relPath := range result.Updated {
+		fmt.Printf("Updated %s\n", filepath.ToSlash(relPath))
+	}
+	if len(result.Conflicts) > 0 {
+		for _, relPath := range result.Conflicts {
+			fmt.Printf("CONFLICT (content): Merge conflict in %s\n", filepath.ToSlash(relPath))
+		}
+		return entry, core.MergeError(fmt.Sprintf("conflicts applying %s; resolve them by hand. The stash entry is kept in case you need it again", entry.Name()), nil)
+	}
+	return entry, nil
+}
+
+// StashDropHandler removes a stash entry
+func StashDropHandler(repo *core.Repository, args []string) error {
+	entry, err := stash.ResolveRepo(repo, stashEntryArg(args))
+	if err != nil {
+		return err
+	}
+	if err := stash.DropRepo(repo, entry); err != nil {
+		return err
+	}
+	fmt.Printf("Dropped %s (%s)\n", entry.Name(), entry.Commit[:7])
+	return nil
+}
+
+// StashShowHandler prints the changes of a stash entry against the commit
+// it was made on, as a stat or with -p as a diff
+func StashShowHandler(repo *core.Repository, args []string) error {
+	entry, err := stash.ResolveRepo(repo, stashEntryArg(args))
+	if err != nil {
+		return err
+	}
+	baseTree, _, worktreeTree, err := stash.TreesRepo(repo, entry.Commit)
+	if err != nil {
+		return err
+	}
+	base, err := stash.FilesRepo(repo, baseTree)
+	if err != nil {
+		return err
+	}
+	stashed, err := stash.FilesRepo(repo, worktreeTree)
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(base)+len(stashed))
+	for p := range base {
+		paths = append(paths, p)
+	}
+	for p := range stashed {
+		if _, ok := base[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	var pairs []diffPair
+	for _, p := range paths {
+		baseEntry, inBase := base[p]
+		stashEntry, inStash := stashed[p]
+		if inBase == inStash && baseEntry.SHA256 == stashEntry.SHA256 {
+			continue
+		}
+		name := filepath.ToSlash(p)
+		pair := diffPair{srcName: name, dstName: name, srcExists: inBase, dstExists: inStash}
+		for _, side := range []struct {
+			exists  bool
+			hash    string
+			content *string
+		}{{inBase, baseEntry.SHA256, &pair.srcContent}, {inStash, stashEntry.SHA256, &pair.dstContent}} {
+			if !side.exists {
+				continue
+			}
+			content, err := objects.GetBlobRepo(repo, side.hash)
+			if err != nil {
+				return fmt.Errorf("failed to get blob '%s': %w", side.hash, err)
+			}
+			*side.content = string(content)
+		}
+		pairs = append(pairs, pair)
+	}
+
+	if stashShowPatch {
+		printDiffPairs(pairs)
+	} else {
+		printDiffStat(pairs)
+	}
+	return nil
+}
+
+// stashEntryArg returns the optional stash@{n} argument
+func stashEntryArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(args[0])
+}
+
+func init() {
+	stashCmd := NewRepoCommand("stash", "Shelve local changes to reapply them later", StashPushHandler)
+	stashCmd.Long = `Save the staged and unstaged changes to tracked files as a stash entry and
+reset them to HEAD, so you can switch branches and bring the changes back
+later. Entries are commits under refs/stash; its reflog lists them, stash@{0}
+being the newest. Untracked files are neither saved nor touched.
+
+Without a subcommand, vec stash is vec stash push.
+
+Examples:
+  vec stash                      # Save changes and clean the working tree
+  vec stash push -m "half done"  # Save with a description
+  vec stash push -p              # Choose the hunks to stash
+  vec stash list
+  vec stash show -p stash@{1}
+  vec stash pop                  # Reapply the newest entry and drop it
+  vec stash apply --index        # Reapply, staging what was staged`
+	stashCmd.Args = cobra.NoArgs
+	stashCmd.Flags().StringVarP(&stashMessage, "message", "m", "", "Describe the stash entry")
+	stashCmd.Flags().BoolVarP(&stashPatch, "patch", "p", false, "Interactively select the hunks to stash")
+
+	pushCmd := NewRepoCommand("push", "Save local changes as a new stash entry", StashPushHandler)
+	pushCmd.Long = `Save the changes to tracked files as a new stash entry, then reset the
+index and those files to HEAD.
+
+With --patch, the changes to files in HEAD are offered hunk by hunk; only
+the chosen hunks are stashed and removed from the working tree, while the
+index is left as it is.`
+	pushCmd.Args = cobra.NoArgs
+	pushCmd.Flags().StringVarP(&stashMessage, "message", "m", "", "Describe the stash entry")
+	pushCmd.Flags().BoolVarP(&stashPatch, "patch", "p", false, "Interactively select the hunks to stash")
+
+	listCmd := NewRepoCommand("list", "List the stash entries", StashListHandler)
+	listCmd.Args = cobra.NoArgs
+
+	applyCmd := NewRepoCommand("apply [<stash>]", "Reapply a stash entry, keeping it", StashApplyHandler)
+	applyCmd.Long = `Reapply the changes of a stash entry (default stash@{0}) to the working
+tree. Files changed since are merged with the stashed changes; conflicting
+regions are marked and the command fails. Files the stash added are staged.`
+	applyCmd.Args = cobra.MaximumNArgs(1)
+	applyCmd.Flags().BoolVar(&stashIndex, "index", false, "Also restore the staged changes")
+
+	popCmd := NewRepoCommand("pop [<stash>]", "Reapply a stash entry and drop it", StashPopHandler)
+	popCmd.Long = `Like vec stash apply, then drop the entry. On conflicts the entry is kept.`
+	popCmd.Args = cobra.MaximumNArgs(1)
+	popCmd.Flags().BoolVar(&stashIndex, "index", false, "Also restore the staged changes")
+
+	dropCmd := NewRepoCommand("drop [<stash>]", "Remove a stash entry", StashDropHandler)
+	dropCmd.Args = cobra.MaximumNArgs(1)
+
+	showCmd := NewRepoCommand("show [<stash>]", "Show the changes recorded in a stash entry", StashShowHandler)
+	showCmd.Args = cobra.MaximumNArgs(1)
+	showCmd.Flags().BoolVarP(&stashShowPatch, "patch", "p", false, "Show the changes as a diff instead of a stat")
+
+	stashCmd.AddCommand(pushCmd, listCmd, applyCmd, popCmd, dropCmd, showCmd)
+	rootCmd.AddCommand(stashCmd)
+}
@@ -59,16 +59,91 @@ func StatusHandler(repo *core.Repository, args []string) error {
 		return fmt.Errorf("failed to get current branch: %w", err)
 	}
 
+	// Compare against the upstream, if the branch has one
+	tracking, err := getTrackingInfo(repo, branchName, headCommitID)
+	if err != nil {
+		return fmt.Errorf("failed to compare with upstream: %w", err)
+	}
+
 	// Print status in the requested format
 	if statusShort {
-		printShortStatus(branchName, statusInfo)
+		printShortStatus(branchName, statusInfo, tracking)
 	} else {
-		printLongStatus(branchName, statusInfo, index)
+		printLongStatus(branchName, statusInfo, index, tracking)
 	}
 
 	return nil
 }
 
+// trackingInfo describes how the current branch relates to its upstream
+type trackingInfo struct {
+	Upstream *core.Upstream
+	Gone     bool // The upstream is configured but its remote-tracking ref is missing
+	Ahead    int
+	Behind   int
+}
+
+// getTrackingInfo returns nil when the branch has no upstream configured
+func getTrackingInfo(repo *core.Repository, branchName, headCommitID string) (*trackingInfo, error) {
+	if branchName == "(HEAD detached)" {
+		return nil, nil
+	}
+	upstream, err := repo.GetBranchUpstream(branchName)
+	if err != nil || upstream == nil {
+		return nil, err
+	}
+
+	info := &trackingInfo{Upstream: upstream}
+	refPath := filepath.Join(repo.VecDir, upstream.TrackingRef())
+	if !utils.FileExists(refPath) {
+		info.Gone = true
+		return info, nil
+	}
+	content, err := os.ReadFile(refPath)
+	if err != nil {
+		return nil, core.RefError(fmt.Sprintf("failed to read %s", upstream.TrackingRef()), err)
+	}
+
+	info.Ahead, info.Behind, err = objects.AheadBehindRepo(repo, headCommitID, strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// printTrackingInfo prints the long-format upstream summary
+func printTrackingInfo(t *trackingInfo) {
+	if t == nil {
+		return
+	}
+	name := t.Upstream.String()
+	switch {
+	case t.Gone:
+		fmt.Printf("Your branch is based on '%s', but the upstream is gone.\n", name)
+		fmt.Println("  (use \"vec push -u\" to publish it again)")
+	case t.Ahead > 0 && t.Behind > 0:
+		fmt.Printf("Your branch and '%s' have diverged,\n", name)
+		fmt.Printf("and have %d and %d different commits each, respectively.\n", t.Ahead, t.Behind)
+		fmt.Println("  (use \"vec pull\" to merge the remote branch into yours)")
+	case t.Ahead > 0:
+		fmt.Printf("Your branch is ahead of '%s' by %d %s.\n", name, t.Ahead, pluralCommits(t.Ahead))
+		fmt.Println("  (use \"vec push\" to publish your local commits)")
+	case t.Behind > 0:
+		fmt.Printf("Your branch is behind '%s' by %d %s, and can be fast-forwarded.\n", name, t.Behind, pluralCommits(t.Behind))
+		fmt.Println("  (use \"vec pull\" to update your local branch)")
+	default:
+		fmt.Printf("Your branch is up to date with '%s'.\n", name)
+	}
+	fmt.Println()
+}
+
+func pluralCommits(n int) string {
+	if n == 1 {
+		return "commit"
+	}
+	return "commits"
+}
+
 func init() {
 	statusCmd := NewRepoCommand(
 		"status",
@@ -93,8 +168,9 @@ type StatusInfo struct {
 }
 
 // printLongStatus outputs the status in the standard long format
-func printLongStatus(branchName string, info *StatusInfo, index *staging.Index) {
+func printLongStatus(branchName string, info *StatusInfo, index *staging.Index, tracking *trackingInfo) {
 	fmt.Printf("On branch %s\n", branchName)
+	printTrackingInfo(tracking)
 
 	// Check for merge conflicts
 	if len(info.Conflicts) > 0 {
@@ -171,9 +247,23 @@ func printLongStatus(branchName string, info *StatusInfo, index *staging.Index)
 }
 
 // printShortStatus outputs the status in the short format (similar to git status -s)
-func printShortStatus(branchName string, info *StatusInfo) {
+func printShortStatus(branchName string, info *StatusInfo, tracking *trackingInfo) {
 	if statusBranch {
-		fmt.Printf("## %s\n", branchName)
+		header := branchName
+		if tracking != nil {
+			header += "..." + tracking.Upstream.String()
+			switch {
+			case tracking.Gone:
+				header += " [gone]"
+			case tracking.Ahead > 0 && tracking.Behind > 0:
+				header += fmt.Sprintf(" [ahead %d, behind %d]", tracking.Ahead, tracking.Behind)
+			case tracking.Ahead > 0:
+				header += fmt.Sprintf(" [ahead %d]", tracking.Ahead)
+			case tracking.Behind > 0:
+				header += fmt.Sprintf(" [behind %d]", tracking.Behind)
+			}
+		}
+		fmt.Printf("## %s\n", header)
 	}
 
 	// Map of all files to their status codes
@@ -313,6 +403,9 @@ func compareStatus(repo *core.Repository, index *staging.Index, commitTree *obje
 
 	// Compare index with working directory
 	// Get a list of all files in the working directory
+	// Paths on disk are compared in NFC under core.precomposeUnicode, as the
+	// index stores them
+	precompose := repo.PrecomposeUnicode()
 	var workingDirFiles []string
 	err := filepath.Walk(repo.Root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -335,17 +428,24 @@ func compareStatus(repo *core.Repository, index *staging.Index, commitTree *obje
 		if err != nil {
 			return err
 		}
-		workingDirFiles = append(workingDirFiles, relPath)
+		workingDirFiles = append(workingDirFiles, core.NormalizePath(relPath, precompose))
 		return nil
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to walk working directory: %w", err)
 	}
 
-	// Create a map for easy lookup
+	// Create maps for easy lookup. With core.ignoreCase the working tree may
+	// spell a tracked path differently from the index, so both are keyed by
+	// the folded path.
+	ignoreCase := repo.IgnoreCase()
 	workingDirMap := make(map[string]bool)
 	for _, path := range workingDirFiles {
-		workingDirMap[path] = true
+		workingDirMap[core.PathKey(path, ignoreCase)] = true
+	}
+	stagedKeys := make(map[string]bool, len(stagedFiles))
+	for path := range stagedFiles {
+		stagedKeys[core.PathKey(path, ignoreCase)] = true
 	}
 
 	// Create a wait group for concurrent hash computation
@@ -357,7 +457,7 @@ func compareStatus(repo *core.Repository, index *staging.Index, commitTree *obje
 
 	// Process each file in the index
 	for path, entry := range stagedFiles {
-		if _, inWorkingDir := workingDirMap[path]; !inWorkingDir {
+		if _, inWorkingDir := workingDirMap[core.PathKey(path, ignoreCase)]; !inWorkingDir {
 			// File in index but not in working directory = deleted in working directory
 			status.DeletedNotStaged = append(status.DeletedNotStaged, path)
 			status.IsClean = false
@@ -387,8 +487,8 @@ func compareStatus(repo *core.Repository, index *staging.Index, commitTree *obje
 	}
 
 	// Process each file in the working directory
-	for path := range workingDirMap {
-		if _, inIndex := stagedFiles[path]; !inIndex {
+	for _, path := range workingDirFiles {
+		if _, inIndex := stagedKeys[core.PathKey(path, ignoreCase)]; !inIndex {
 			// File in working directory but not in index = untracked
 			status.Untracked = append(status.Untracked, path)
 			status.IsClean = false
@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tagList       bool
+	tagContains   string
+	tagNoContains string
+	tagAnnotate   bool
+	tagMessage    string
+	tagSign       bool
+	tagForce      bool
+	tagDelete     bool
+)
+
+// TagHandler creates, deletes or lists tags
+func TagHandler(repo *core.Repository, args []string) error {
+	switch {
+	case tagDelete:
+		if len(args) == 0 {
+			return core.RefError("name the tags to delete", nil)
+		}
+		return deleteTagsRepo(repo, args)
+	case tagList || len(args) == 0 || tagContains != "" || tagNoContains != "":
+		return listTagsRepo(repo, args)
+	case len(args) > 2:
+		return core.RefError("too many arguments: vec tag <name> [<object>]", nil)
+	}
+	target := core.HeadFile
+	if len(args) == 2 {
+		target = args[1]
+	}
+	return createTagRepo(repo, args[0], target)
+}
+
+// createTagRepo points refs/tags/<name> at target, through a new tag object
+// when annotating
+func createTagRepo(repo *core.Repository, name, target string) error {
+	if name == "" || strings.ContainsAny(name, " \\~^:?*[]") || strings.HasPrefix(name, "-") ||
+		strings.Contains(name, "..") || strings.HasSuffix(name, ".lock") {
+		return core.RefError(fmt.Sprintf("invalid tag name: %s", name), nil)
+	}
+	refPath := "refs/tags/" + name
+	old, err := repo.ReadRefValue(refPath)
+	if err != nil {
+		return err
+	}
+	if old != "" && !tagForce {
+		return core.RefError(fmt.Sprintf("tag '%s' already exists; use -f to replace it", name), nil)
+	}
+	hash, err := repo.ResolveRevision(target)
+	if err != nil {
+		return core.RefError(fmt.Sprintf("unknown revision '%s'", target), err)
+	}
+
+	if tagAnnotate || tagMessage != "" || tagSign {
+		if hash, err = writeTagObjectRepo(repo, name, hash); err != nil {
+			return err
+		}
+	}
+	if err := repo.UpdateRefCAS(refPath, old, hash); err != nil {
+		return err
+	}
+	if old != "" && old != hash {
+		fmt.Printf("Updated tag '%s' (was %s)\n", name, shortCommitHash(old))
+	}
+	return nil
+}
+
+// writeTagObjectRepo writes an annotated tag called name for the object
+// hash, with the -m message or one from the editor, and returns its hash
+func writeTagObjectRepo(repo *core.Repository, name, hash string) (string, error) {
+	objType, err := objects.ObjectTypeRepo(repo, hash)
+	if err != nil {
+		return "", core.ObjectError(fmt.Sprintf("failed to read object %s", hash), err)
+	}
+	message := strings.TrimSpace(tagMessage)
+	if message == "" {
+		if message, err = editTextRepo(repo, "TAG_EDITMSG", fmt.Sprintf("\n# Write a message for tag:\n#   %s\n# Lines starting with '#' will be ignored.\n", name)); err != nil {
+			return "", err
+		}
+		if message == "" {
+			return "", core.RefError("no tag message given", nil)
+		}
+	}
+
+	taggerName, taggerEmail, err := core.ResolveIdentity(repo.Root, core.IdentityCommitter)
+	if err != nil {
+		return "", err
+	}
+	now, err := objects.DateFromEnv(objects.CommitterDateEnv, time.Now())
+	if err != nil {
+		return "", err
+	}
+	_, offset := now.Zone()
+	tag := &objects.Tag{
+		Object:    hash,
+		Type:      objType,
+		Name:      name,
+		Tagger:    fmt.Sprintf("%s <%s>", taggerName.Value, taggerEmail.Value),
+		Timestamp: now.Unix(),
+		TaggerTZ:  offset,
+		Message:   message + "\n",
+	}
+	tagHash, err := objects.CreateTagRepo(repo, tag, tagSign)
+	if err != nil {
+		return "", core.ObjectError("failed to write tag", err)
+	}
+	return tagHash, nil
+}
+
+// deleteTagsRepo removes the named tags
+func deleteTagsRepo(repo *core.Repository, names []string) error {
+	for _, name := range names {
+		refPath := "refs/tags/" + name
+		old, err := repo.ReadRefValue(refPath)
+		if err != nil {
+			return err
+		}
+		if old == "" {
+			return core.NotFoundError(core.ErrCategoryRef, fmt.Sprintf("tag '%s'", name))
+		}
+		if err := repo.UpdateRefCAS(refPath, old, ""); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted tag '%s' (was %s)\n", name, shortCommitHash(old))
+	}
+	return nil
+}
+
+// listTagsRepo lists tags, optionally filtered by name patterns and history
+func listTagsRepo(repo *core.Repository, patterns []string) error {
+	refs, err := repo.ListRefs("refs/tags/")
+	if err != nil {
+		return err
+	}
+	keep, err := newContainsFilter(repo, tagContains, tagNoContains)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		name := strings.TrimPrefix(ref.Name, "refs/tags/")
+		if len(patterns) > 0 && !matchTagPattern(name, patterns) {
+			continue
+		}
+		if keep != nil {
+			// Annotated tags are filtered by the commit they tag
+			commit, objType, err := objects.PeelTagRepo(repo, ref.Hash)
+			if err != nil {
+				return err
+			}
+			if objType != "commit" {
+				continue
+			}
+			if ok, err := keep(commit); err != nil {
+				return err
+			} else if !ok {
+				continue
+			}
+		}
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// matchTagPattern reports whether name matches one of the glob patterns
+func matchTagPattern(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+var tagCmd *cobra.Command
+
+func init() {
+	tagCmd = NewRepoCommand(
+		"tag [-a] [-s] [-m <msg>] [-f] <name> [<object>] | -d <name>... | [-l] [<pattern>...]",
+		"Create, delete or list tags",
+		TagHandler,
+	)
+	tagCmd.Long = `Create a tag named <name> for <object>, HEAD by default. A lightweight tag
+is just the ref refs/tags/<name>; with -a, -m or -s it points at a tag
+object instead, which records the tagger, the date and a message, opened in
+the editor unless given with -m. -s also signs the tag object with
+user.signingKey, as commit -S does. An existing tag is only replaced with
+-f; -d deletes tags.
+
+Without a name, or with -l, list the tags under refs/tags in name order.
+Patterns are globs matched against the tag name.
+
+--contains and --no-contains select tags by history: the answers for all
+tags come from one shared walk of the commit graph, so each commit is read
+at most once whatever the number of tags.
+
+Examples:
+  vec tag v1.0                  # Tag HEAD
+  vec tag -a v1.0 -m "Release"  # Tag HEAD with an annotated tag
+  vec tag -s v1.0 abc1234       # Sign a tag for commit abc1234
+  vec tag -d v1.0               # Delete a tag
+  vec tag                       # List all tags
+  vec tag -l 'v1.*'             # List the v1 tags
+  vec tag --contains abc1234    # Tags whose history includes commit abc1234`
+
+	tagCmd.Flags().BoolVarP(&tagList, "list", "l", false, "List tags (the default)")
+	tagCmd.Flags().StringVar(&tagContains, "contains", "", "Only list tags whose history contains the commit")
+	tagCmd.Flags().StringVar(&tagNoContains, "no-contains", "", "Only list tags whose history doesn't contain the commit")
+	tagCmd.Flags().BoolVarP(&tagAnnotate, "annotate", "a", false, "Create an annotated tag object")
+	tagCmd.Flags().StringVarP(&tagMessage, "message", "m", "", "Message of an annotated tag")
+	tagCmd.Flags().BoolVarP(&tagSign, "sign", "s", false, "Create an annotated tag signed with user.signingKey")
+	tagCmd.Flags().BoolVarP(&tagForce, "force", "f", false, "Replace an existing tag")
+	tagCmd.Flags().BoolVarP(&tagDelete, "delete", "d", false, "Delete the named tags")
+
+	rootCmd.AddCommand(tagCmd)
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/merge"
+	"github.com/NahomAnteneh/vec/internal/staging"
+	"github.com/spf13/cobra"
+)
+
+var (
+	undoSoft   bool
+	undoForce  bool
+	undoDryRun bool
+)
+
+// UndoHandler reverts the most recent ref-moving operation recorded in the
+// undo journal
+func UndoHandler(repo *core.Repository, args []string) error {
+	move, err := repo.LastRefMove()
+	if err != nil {
+		return err
+	}
+	if move == nil {
+		return core.RefError("nothing to undo", nil)
+	}
+
+	current, err := repo.ReadRefValue(move.Ref)
+	if err != nil {
+		return err
+	}
+	if current != move.New {
+		return core.RefError(fmt.Sprintf("cannot undo '%s': %s has moved since (now %s)",
+			move.Message, move.Ref, shortCommitHash(current)), core.ErrRefChanged)
+	}
+
+	head, err := core.ReadHEADFile(repo.Root)
+	if err != nil {
+		return err
+	}
+	checkedOut := move.Ref == core.HeadFile || head == "ref: "+move.Ref
+
+	if undoDryRun {
+		fmt.Printf("Would undo '%s': %s %s -> %s\n", move.Message, move.Ref,
+			describeUndoTarget(move.New), describeUndoTarget(move.Old))
+		return nil
+	}
+
+	// The checked-out branch takes the working tree and index with it
+	if checkedOut && !undoSoft {
+		if move.Old == "" {
+			return core.RefError("cannot undo the first commit of a branch without --soft", nil)
+		}
+		index, err := staging.LoadIndex(repo)
+		if err != nil {
+			return fmt.Errorf("failed to load index: %w", err)
+		}
+		if !undoForce && !index.IsClean(repo) {
+			return core.RepositoryError("you have uncommitted changes; commit them, use --soft to keep the working tree, or --force to discard them", nil)
+		}
+		if err := repo.WriteOrigHead(current); err != nil {
+			return err
+		}
+		if err := merge.CheckoutCommit(repo, move.Old); err != nil {
+			return err
+		}
+	}
+
+	if err := repo.UndoRefMove(move); err != nil {
+		return err
+	}
+	fmt.Printf("Undid '%s': %s is back at %s\n", move.Message, move.Ref, describeUndoTarget(move.Old))
+	return nil
+}
+
+// describeUndoTarget abbreviates a ref value, naming a missing ref
+func describeUndoTarget(commit string) string {
+	if commit == "" {
+		return "(deleted)"
+	}
+	return shortCommitHash(commit)
+}
+
+var undoCmd *cobra.Command
+
+func init() {
+	undoCmd = NewRepoCommand(
+		"undo",
+		"Revert the last ref-moving operation",
+		UndoHandler,
+	)
+	undoCmd.Long = `Put back the ref moved by the most recent commit, merge or branch
+deletion. Each of these records the previous value in an undo journal, so
+running undo repeatedly steps further back.
+
+When the ref is the checked-out branch, the working tree and index are reset
+to the restored commit; this refuses to discard uncommitted changes unless
+--force is given. --soft only moves the ref, keeping the working tree and
+index as they are. The commit that was current before the undo is saved in
+ORIG_HEAD. Deleted branches are restored from the journal (their last tip is
+also kept under refs/original/).
+
+Undo refuses to run when the ref has moved since the recorded operation.
+
+Examples:
+  vec undo -n       # Show what would be undone
+  vec undo          # Undo the last commit, merge or branch deletion
+  vec undo --soft   # Undo the last commit, keeping its changes in the working tree`
+	undoCmd.Args = cobra.NoArgs
+
+	undoCmd.Flags().BoolVar(&undoSoft, "soft", false, "Only move the ref; keep the working tree and index")
+	undoCmd.Flags().BoolVarP(&undoForce, "force", "f", false, "Discard uncommitted changes when resetting the working tree")
+	undoCmd.Flags().BoolVarP(&undoDryRun, "dry-run", "n", false, "Show what would be undone without changing anything")
+
+	rootCmd.AddCommand(undoCmd)
+}
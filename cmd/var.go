@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/spf13/cobra"
+)
+
+var (
+	varList       bool
+	varShowOrigin bool
+)
+
+// VarHandler prints runtime values after environment and config resolution
+func VarHandler(repo *core.Repository, args []string) error {
+	if varList || len(args) == 0 {
+		vars, err := core.ListVars(repo.Root)
+		if err != nil {
+			return err
+		}
+		for _, v := range vars {
+			printVar(v, true)
+		}
+		return nil
+	}
+
+	v, err := core.LookupVar(repo.Root, args[0])
+	if err != nil {
+		return err
+	}
+	printVar(v, false)
+	return nil
+}
+
+// printVar prints v as NAME=value when named, or just its value
+func printVar(v core.Var, named bool) {
+	line := v.Value
+	if named {
+		line = fmt.Sprintf("%s=%s", v.Name, v.Value)
+	}
+	if varShowOrigin {
+		line = fmt.Sprintf("%s\t%s", v.Origin, line)
+	}
+	fmt.Println(line)
+}
+
+var varCmd *cobra.Command
+
+func init() {
+	varCmd = NewRepoCommand(
+		"var [<variable>]",
+		"Show the values vec uses after config and environment overrides",
+		VarHandler,
+	)
+	varCmd.Long = `Print the runtime values vec resolves from the environment, configuration
+and built-in defaults:
+
+  VEC_AUTHOR_IDENT     VEC_AUTHOR_NAME/EMAIL, then user.name/user.email
+  VEC_COMMITTER_IDENT  VEC_COMMITTER_NAME/EMAIL, then user.name/user.email
+  VEC_EDITOR           $VEC_EDITOR, core.editor, $VISUAL, $EDITOR, then vim
+  VEC_PAGER            $VEC_PAGER, core.pager, $PAGER, then less
+  VEC_DEFAULT_BRANCH   init.defaultBranch, then main
+
+Local configuration takes precedence over global configuration. Identities
+print as "Name <email> <unix time> <+hhmm>"; unconfigured ones are left out
+of the list.
+
+Examples:
+  vec var -l                  # List every variable
+  vec var VEC_EDITOR          # Print the editor vec launches
+  vec var --show-origin -l    # Also show where each value comes from`
+	varCmd.Args = cobra.MaximumNArgs(1)
+
+	varCmd.Flags().BoolVarP(&varList, "list", "l", false, "List all variables")
+	varCmd.Flags().BoolVar(&varShowOrigin, "show-origin", false, "Show the environment variable or file and line each value comes from")
+
+	rootCmd.AddCommand(varCmd)
+}
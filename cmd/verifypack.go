@@ -0,0 +1,292 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/packfile"
+)
+
+var (
+	verifyPackVerbose bool
+	verifyPackStatAll bool
+	verifyPackTop     int
+)
+
+// inspectedPack is a pack and its layout
+type inspectedPack struct {
+	name   string
+	layout *packfile.PackLayout
+}
+
+// VerifyPackHandler checks packs against their indexes and, with -v or
+// --stat-all, reports how their objects are stored
+func VerifyPackHandler(repo *core.Repository, args []string) error {
+	indexes := args
+	if len(indexes) == 0 {
+		var err error
+		indexes, err = filepath.Glob(filepath.Join(repo.ObjectsDir, "pack", "*.idx"))
+		if err != nil {
+			return fmt.Errorf("failed to list pack indexes: %w", err)
+		}
+		if len(indexes) == 0 {
+			fmt.Println("No packs found")
+			return nil
+		}
+	}
+
+	var packs []inspectedPack
+	failed := false
+	for _, indexPath := range indexes {
+		indexPath = strings.TrimSuffix(strings.TrimSuffix(indexPath, ".pack"), ".idx") + ".idx"
+		packPath := strings.TrimSuffix(indexPath, ".idx") + ".pack"
+		name := filepath.Base(packPath)
+		if err := packfile.VerifyPackIndex(indexPath, packPath); err != nil {
+			fmt.Printf("%s: bad: %v\n", name, err)
+			failed = true
+			continue
+		}
+		layout, err := packfile.InspectPack(packPath, indexPath)
+		if err != nil {
+			fmt.Printf("%s: bad: %v\n", name, err)
+			failed = true
+			continue
+		}
+		if verifyPackVerbose {
+			printPackEntries(layout)
+		}
+		fmt.Printf("%s: ok\n", name)
+		packs = append(packs, inspectedPack{name: name, layout: layout})
+	}
+
+	if verifyPackStatAll && len(packs) > 0 {
+		printPackStats(repo, packs, verifyPackTop)
+	}
+	if failed {
+		return core.ObjectError("some packs failed verification", nil)
+	}
+	return nil
+}
+
+// printPackEntries lists the entries of a pack: hash, type, size, stored
+// size, offset, and for deltas the chain depth and base offset
+func printPackEntries(layout *packfile.PackLayout) {
+	for _, e := range layout.Entries {
+		line := fmt.Sprintf("%s %-6s %d %d %d", packEntryName(e), packTypeName(e.Type), e.Size, e.StoredSize, e.Offset)
+		if e.Depth > 0 {
+			line += fmt.Sprintf(" %d %d", e.Depth, e.BaseOffset)
+		}
+		fmt.Println(line)
+	}
+}
+
+func packEntryName(e packfile.PackEntry) string {
+	if e.Hash == "" {
+		return fmt.Sprintf("(offset %d)", e.Offset)
+	}
+	return e.Hash
+}
+
+func packTypeName(t packfile.ObjectType) string {
+	switch t {
+	case packfile.OBJ_COMMIT:
+		return "commit"
+	case packfile.OBJ_TREE:
+		return "tree"
+	case packfile.OBJ_BLOB:
+		return "blob"
+	case packfile.OBJ_TAG:
+		return "tag"
+	}
+	return "delta" // Base outside the pack
+}
+
+// printPackStats reports, across packs, the compression of each object
+// type, the delta chain lengths, objects stored in more than one pack and
+// the largest objects with a path they appear at
+func printPackStats(repo *core.Repository, packs []inspectedPack, top int) {
+	type typeStat struct {
+		count, deltas int
+		size, stored  int64
+	}
+	byType := make(map[string]*typeStat)
+	chains := make(map[int]int)
+	copies := make(map[string][]int64) // Hash -> stored size in each pack holding it
+	var all []packfile.PackEntry
+	for _, pack := range packs {
+		for _, e := range pack.layout.Entries {
+			name := packTypeName(e.Type)
+			stat := byType[name]
+			if stat == nil {
+				stat = &typeStat{}
+				byType[name] = stat
+			}
+			stat.count++
+			stat.size += int64(e.Size)
+			stat.stored += e.StoredSize
+			if e.Depth > 0 {
+				stat.deltas++
+			}
+			chains[e.Depth]++
+			if e.Hash != "" {
+				copies[e.Hash] = append(copies[e.Hash], e.StoredSize)
+			}
+			all = append(all, e)
+		}
+	}
+
+	fmt.Println("\nObjects by type:")
+	fmt.Printf("  %-7s %8s %8s %12s %12s %7s\n", "type", "count", "deltas", "size", "stored", "ratio")
+	var totalSize, totalStored int64
+	for _, name := range []string{"commit", "tree", "blob", "tag", "delta"} {
+		stat := byType[name]
+		if stat == nil {
+			continue
+		}
+		totalSize += stat.size
+		totalStored += stat.stored
+		fmt.Printf("  %-7s %8d %8d %12s %12s %7s\n", name, stat.count, stat.deltas,
+			formatDiskSize(stat.size), formatDiskSize(stat.stored), compressionRatio(stat.size, stat.stored))
+	}
+	fmt.Printf("  %-7s %8d %8s %12s %12s %7s\n", "total", len(all), "",
+		formatDiskSize(totalSize), formatDiskSize(totalStored), compressionRatio(totalSize, totalStored))
+
+	fmt.Println("\nDelta chains:")
+	depths := make([]int, 0, len(chains))
+	for depth := range chains {
+		depths = append(depths, depth)
+	}
+	sort.Ints(depths)
+	for _, depth := range depths {
+		if depth == 0 {
+			fmt.Printf("  non delta: %d object%s\n", chains[depth], plural(chains[depth]))
+		} else {
+			fmt.Printf("  chain length = %d: %d object%s\n", depth, chains[depth], plural(chains[depth]))
+		}
+	}
+
+	var duplicates []string
+	var wasted int64
+	for hash, stored := range copies {
+		if len(stored) > 1 {
+			duplicates = append(duplicates, hash)
+			sort.Slice(stored, func(i, j int) bool { return stored[i] < stored[j] })
+			for _, s := range stored[1:] {
+				wasted += s
+			}
+		}
+	}
+	sort.Strings(duplicates)
+	fmt.Printf("\nDuplicate objects: %d, %s stored more than once\n", len(duplicates), formatDiskSize(wasted))
+	for _, hash := range duplicates {
+		fmt.Printf("  %s in %d packs\n", hash, len(copies[hash]))
+	}
+
+	if top <= 0 {
+		return
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Size != all[j].Size {
+			return all[i].Size > all[j].Size
+		}
+		return all[i].Hash < all[j].Hash
+	})
+	if len(all) > top {
+		all = all[:top]
+	}
+	paths := objectPathsRepo(repo)
+	fmt.Printf("\nLargest objects:\n")
+	for _, e := range all {
+		p := paths[e.Hash]
+		if p == "" {
+			p = "-"
+		}
+		fmt.Printf("  %s %-6s %12s %12s  %s\n", packEntryName(e), packTypeName(e.Type),
+			formatDiskSize(int64(e.Size)), formatDiskSize(e.StoredSize), p)
+	}
+}
+
+// compressionRatio formats how many times smaller the stored bytes are
+func compressionRatio(size, stored int64) string {
+	if stored == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2fx", float64(size)/float64(stored))
+}
+
+// objectPathsRepo maps the blobs and trees reachable from HEAD and the refs
+// to the first path they are found at, newest commits first. Objects that
+// can't be read are skipped.
+func objectPathsRepo(repo *core.Repository) map[string]string {
+	var starts []string
+	if head, err := repo.ReadHead(); err == nil && head != "" {
+		starts = append(starts, head)
+	}
+	if refs, err := repo.ListRefs("refs/"); err == nil {
+		for _, ref := range refs {
+			starts = append(starts, ref.Hash)
+		}
+	}
+
+	paths := make(map[string]string)
+	seenTrees := make(map[string]bool)
+	var walkTree func(hash, prefix string)
+	walkTree = func(hash, prefix string) {
+		if seenTrees[hash] {
+			return
+		}
+		seenTrees[hash] = true
+		tree, err := objects.GetTreeRepo(repo, hash)
+		if err != nil {
+			return
+		}
+		for _, entry := range tree.Entries {
+			entryPath := path.Join(prefix, entry.Name)
+			if _, ok := paths[entry.Hash]; !ok {
+				paths[entry.Hash] = entryPath
+			}
+			if entry.Type == "tree" {
+				walkTree(entry.Hash, entryPath)
+			}
+		}
+	}
+	_ = objects.WalkAncestorsRepo(repo, starts, func(c *objects.Commit) (bool, error) {
+		walkTree(c.Tree, "")
+		return false, nil
+	})
+	return paths
+}
+
+func init() {
+	verifyPackCmd := NewRepoCommand(
+		"verify-pack [<pack>.idx...]",
+		"Check packs and report how their objects are stored",
+		VerifyPackHandler,
+	)
+	verifyPackCmd.Long = `Check each pack against its index; without arguments every pack in
+.vec/objects/pack is checked.
+
+With -v each entry is listed as: hash, type, size, size in the pack, offset,
+and for deltas the chain length and the offset of the base.
+
+With --stat-all a report across the packs follows: the compression ratio of
+each object type (size over bytes stored), a histogram of delta chain
+lengths, objects stored in more than one pack, and the largest objects with
+a path they are reachable at.
+
+Examples:
+  vec verify-pack
+  vec verify-pack -v .vec/objects/pack/pack-1234.idx
+  vec verify-pack --stat-all --top 20`
+
+	verifyPackCmd.Flags().BoolVarP(&verifyPackVerbose, "verbose", "v", false, "List every entry of each pack")
+	verifyPackCmd.Flags().BoolVar(&verifyPackStatAll, "stat-all", false, "Report compression, delta chains, duplicates and the largest objects")
+	verifyPackCmd.Flags().IntVar(&verifyPackTop, "top", 10, "Number of largest objects listed by --stat-all")
+
+	rootCmd.AddCommand(verifyPackCmd)
+}
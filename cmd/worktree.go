@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/spf13/cobra"
+)
+
+var (
+	worktreePruneDryRun  bool
+	worktreePruneVerbose bool
+	worktreeLockReason   string
+)
+
+// worktreeCmd groups the worktree administration commands
+var worktreeCmd = &cobra.Command{
+	Use:   "worktree",
+	Short: "Manage linked worktrees",
+	Long:  "Manage the linked worktrees registered under .vec/worktrees: list them, prune the metadata of deleted ones, repair their .vec pointer files after a move, and lock them against pruning.",
+}
+
+// WorktreeListHandler prints each linked worktree with its state
+func WorktreeListHandler(repo *core.Repository, args []string) error {
+	worktrees, err := core.ListWorktrees(repo.Root)
+	if err != nil {
+		return err
+	}
+	fmt.Println(repo.Root)
+	for _, wt := range worktrees {
+		line := wt.Path
+		if line == "" {
+			line = wt.ID
+		}
+		if wt.Locked {
+			line += " locked"
+		}
+		if wt.Prunable != "" {
+			line += " prunable"
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+// WorktreePruneHandler removes the metadata of worktrees that no longer exist
+func WorktreePruneHandler(repo *core.Repository, args []string) error {
+	pruned, err := core.PruneWorktrees(repo.Root, worktreePruneDryRun)
+	for _, wt := range pruned {
+		if worktreePruneVerbose || worktreePruneDryRun {
+			fmt.Printf("Removing worktrees/%s: %s\n", wt.ID, wt.Prunable)
+		}
+	}
+	return err
+}
+
+// WorktreeRepairHandler fixes the links between worktrees and the repository
+func WorktreeRepairHandler(repo *core.Repository, args []string) error {
+	repaired, err := core.RepairWorktrees(repo.Root, args)
+	for _, fix := range repaired {
+		fmt.Printf("repair: %s\n", fix)
+	}
+	return err
+}
+
+// WorktreeLockHandler locks a worktree against pruning
+func WorktreeLockHandler(repo *core.Repository, args []string) error {
+	wt, err := core.FindWorktree(repo.Root, args[0])
+	if err != nil {
+		return err
+	}
+	return core.LockWorktree(repo.Root, wt, worktreeLockReason)
+}
+
+// WorktreeUnlockHandler lifts a worktree lock
+func WorktreeUnlockHandler(repo *core.Repository, args []string) error {
+	wt, err := core.FindWorktree(repo.Root, args[0])
+	if err != nil {
+		return err
+	}
+	return core.UnlockWorktree(repo.Root, wt)
+}
+
+func init() {
+	listCmd := NewRepoCommand("list", "List the main and linked worktrees", WorktreeListHandler)
+	listCmd.Args = cobra.NoArgs
+
+	pruneCmd := NewRepoCommand("prune", "Remove metadata of worktrees whose directory is gone", WorktreePruneHandler)
+	pruneCmd.Args = cobra.NoArgs
+	pruneCmd.Long = `Remove the .vec/worktrees entries of worktrees whose directory was deleted.
+Locked worktrees are kept even when their directory is missing.`
+	pruneCmd.Flags().BoolVarP(&worktreePruneDryRun, "dry-run", "n", false, "Only report what would be removed")
+	pruneCmd.Flags().BoolVarP(&worktreePruneVerbose, "verbose", "v", false, "Report each removal")
+
+	repairCmd := NewRepoCommand("repair [<path>...]", "Fix worktree links after the repository or a worktree moved", WorktreeRepairHandler)
+	repairCmd.Long = `Point the .vec file of every registered worktree back at this repository,
+as needed after moving the repository. Worktrees that were moved themselves
+are given as paths, and their new location is recorded.`
+
+	lockCmd := NewCommand("lock <worktree>", "Prevent a worktree from being pruned", WorktreeLockHandler, 1)
+	lockCmd.Long = `Lock a worktree so prune keeps its metadata while its directory is
+unavailable, e.g. on removable media or a network share.`
+	lockCmd.Flags().StringVar(&worktreeLockReason, "reason", "", "Why the worktree is locked")
+
+	unlockCmd := NewCommand("unlock <worktree>", "Allow a locked worktree to be pruned", WorktreeUnlockHandler, 1)
+
+	worktreeCmd.AddCommand(listCmd, pruneCmd, repairCmd, lockCmd, unlockCmd)
+	rootCmd.AddCommand(worktreeCmd)
+}
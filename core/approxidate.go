@@ -0,0 +1,87 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// approxUnits are the units of relative dates such as "2.weeks.ago"
+var approxUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+}
+
+// approxLayouts are the absolute dates ParseApproxDate accepts
+var approxLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	time.RFC1123Z,
+	"Mon Jan 2 15:04:05 2006 -0700",
+	"2006-01-02",
+}
+
+// ParseApproxDate parses the dates of revisions such as main@{yesterday}
+// and of --since/--until: "now", "today" (midnight), "yesterday", relative
+// dates like "2.days.ago" or "3 weeks ago", "@<unix timestamp>" and
+// absolute dates like "2024-05-01 12:00". Dates without a zone are local.
+func ParseApproxDate(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(value) {
+	case "now":
+		return now, nil
+	case "today", "midnight":
+		y, m, d := now.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, now.Location()), nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	}
+	if seconds, ok := strings.CutPrefix(value, "@"); ok {
+		if s, err := strconv.ParseInt(seconds, 10, 64); err == nil {
+			return time.Unix(s, 0), nil
+		}
+	}
+	if t, ok := parseRelativeDate(value, now); ok {
+		return t, nil
+	}
+	for _, layout := range approxLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date '%s'", value)
+}
+
+// parseRelativeDate parses "<n> <unit>[s] ago", words separated by dots,
+// spaces or underscores
+func parseRelativeDate(value string, now time.Time) (time.Time, bool) {
+	words := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return r == '.' || r == ' ' || r == '_'
+	})
+	if len(words) != 3 || words[2] != "ago" {
+		return time.Time{}, false
+	}
+	n, err := strconv.Atoi(words[0])
+	if err != nil || n < 0 {
+		return time.Time{}, false
+	}
+	unit := strings.TrimSuffix(words[1], "s")
+	switch unit {
+	case "month":
+		return now.AddDate(0, -n, 0), true
+	case "year":
+		return now.AddDate(-n, 0, 0), true
+	}
+	size, ok := approxUnits[unit]
+	if !ok {
+		return time.Time{}, false
+	}
+	return now.Add(-time.Duration(n) * size), true
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// AttributesFile assigns attributes to paths, one "<pattern> <attr>..." per line
+const AttributesFile = ".vecattributes"
+
+// Attribute states other than a string value
+const (
+	AttrSet         = "set"         // "attr"
+	AttrUnset       = "unset"       // "-attr"
+	AttrUnspecified = "unspecified" // "!attr", or not mentioned at all
+)
+
+// attributeMacros are expanded where they appear, like git's built-in
+// binary macro
+var attributeMacros = map[string][]string{
+	"binary": {"-diff", "-merge", "-text"},
+}
+
+// Attribute is the value of one attribute for a path and the rule that set it
+type Attribute struct {
+	Name    string
+	Value   string // AttrSet, AttrUnset, AttrUnspecified or a value from attr=value
+	Source  string // File the rule comes from; empty when unspecified
+	Line    int
+	Pattern string
+}
+
+// attributeRule is one line of an attributes file
+type attributeRule struct {
+	pattern string
+	attrs   []Attribute
+}
+
+// parseAttributeSpec turns "attr", "-attr", "!attr" or "attr=value" into an
+// attribute, expanding macros
+func parseAttributeSpec(spec string) []Attribute {
+	switch {
+	case strings.HasPrefix(spec, "-"):
+		return []Attribute{{Name: spec[1:], Value: AttrUnset}}
+	case strings.HasPrefix(spec, "!"):
+		return []Attribute{{Name: spec[1:], Value: AttrUnspecified}}
+	}
+	if name, value, ok := strings.Cut(spec, "="); ok {
+		return []Attribute{{Name: name, Value: value}}
+	}
+	attrs := []Attribute{{Name: spec, Value: AttrSet}}
+	for _, expanded := range attributeMacros[spec] {
+		attrs = append(attrs, parseAttributeSpec(expanded)...)
+	}
+	return attrs
+}
+
+// loadAttributeRules reads the attributes file at the repository root
+func loadAttributeRules(repoRoot string) ([]attributeRule, error) {
+	content, err := os.ReadFile(filepath.Join(repoRoot, AttributesFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", AttributesFile, err)
+	}
+
+	var rules []attributeRule
+	for i, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if _, err := path.Match(fields[0], "test-filename"); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: invalid pattern in %s: %s\n", AttributesFile, fields[0])
+			continue
+		}
+		rule := attributeRule{pattern: fields[0]}
+		for _, spec := range fields[1:] {
+			for _, attr := range parseAttributeSpec(spec) {
+				attr.Source, attr.Line, attr.Pattern = AttributesFile, i+1, fields[0]
+				rule.attrs = append(rule.attrs, attr)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// matchAttributePattern matches a pattern against a slash-separated path
+// relative to the repository root. Patterns without a slash match the base
+// name anywhere; others match the whole path.
+func matchAttributePattern(pattern, relPath string) bool {
+	if !strings.Contains(strings.TrimSuffix(pattern, "/"), "/") {
+		matched, _ := path.Match(pattern, path.Base(relPath))
+		return matched
+	}
+	matched, _ := path.Match(strings.TrimPrefix(pattern, "/"), relPath)
+	return matched
+}
+
+// GetAttributes returns every attribute assigned to relPath (relative to the
+// repository root). Later lines override earlier ones.
+func GetAttributes(repoRoot, relPath string) (map[string]Attribute, error) {
+	rules, err := loadAttributeRules(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	relPath = filepath.ToSlash(relPath)
+
+	attrs := make(map[string]Attribute)
+	for _, rule := range rules {
+		if !matchAttributePattern(rule.pattern, relPath) {
+			continue
+		}
+		for _, attr := range rule.attrs {
+			if attr.Value == AttrUnspecified {
+				delete(attrs, attr.Name)
+				continue
+			}
+			attrs[attr.Name] = attr
+		}
+	}
+	return attrs, nil
+}
+
+// GetAttribute returns attribute name of relPath, with Value AttrUnspecified
+// when no rule sets it
+func GetAttribute(repoRoot, relPath, name string) (Attribute, error) {
+	attrs, err := GetAttributes(repoRoot, relPath)
+	if err != nil {
+		return Attribute{}, err
+	}
+	if attr, ok := attrs[name]; ok {
+		return attr, nil
+	}
+	return Attribute{Name: name, Value: AttrUnspecified}, nil
+}
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AuditLogKey enables the audit log of repository-mutating operations
+const AuditLogKey = "core.auditLog"
+
+// AuditLogFile is the audit log, relative to the .vec directory
+const AuditLogFile = "logs/audit.jsonl"
+
+// Audited operations
+const (
+	AuditRefUpdate   = "ref-update"
+	AuditRefDelete   = "ref-delete"
+	AuditConfigSet   = "config-set"
+	AuditConfigUnset = "config-unset"
+	AuditFetch       = "fetch"
+	AuditPush        = "push"
+	AuditPull        = "pull"
+	AuditClone       = "clone"
+)
+
+// AuditEntry is one line of the audit log
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Command string    `json:"command,omitempty"`
+	Op      string    `json:"op"`
+	Target  string    `json:"target"` // Ref, config key or remote
+	Old     string    `json:"old,omitempty"`
+	New     string    `json:"new,omitempty"`
+}
+
+// auditCommand is the command line recorded with each audit entry
+var auditCommand string
+
+// SetAuditCommand sets the command line recorded in the audit log
+func SetAuditCommand(args []string) {
+	auditCommand = strings.Join(args, " ")
+}
+
+// AuditEnabled reports whether core.auditLog is on for the repository
+func AuditEnabled(repoRoot string) bool {
+	return configBool(repoRoot, AuditLogKey)
+}
+
+// auditSecretKey reports whether a config key holds a credential whose
+// value must not be written to the audit log
+func auditSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range []string{"password", "token", "auth", "secret"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordAudit appends an entry for op on target to the audit log when it
+// is enabled. The operation already happened, so failing to log it is
+// reported as a warning rather than failing the command.
+func RecordAudit(repoRoot, op, target, oldValue, newValue string) {
+	if AuditEnabled(repoRoot) {
+		recordAudit(repoRoot, op, target, oldValue, newValue)
+	}
+}
+
+// RecordConfigAudit logs a change of the local config key from oldValue to
+// newValue, an empty newValue meaning it was unset. wasEnabled is whether
+// the audit log was on before the change, so that turning it off is logged
+// too. Credential values are redacted.
+func RecordConfigAudit(repoRoot, key, oldValue, newValue string, wasEnabled bool) {
+	if oldValue == newValue || !(wasEnabled || AuditEnabled(repoRoot)) {
+		return
+	}
+	if auditSecretKey(key) {
+		if oldValue != "" {
+			oldValue = "<redacted>"
+		}
+		if newValue != "" {
+			newValue = "<redacted>"
+		}
+	}
+	op := AuditConfigSet
+	if newValue == "" {
+		op = AuditConfigUnset
+	}
+	recordAudit(repoRoot, op, key, oldValue, newValue)
+}
+
+// recordAudit appends an entry to the audit log
+func recordAudit(repoRoot, op, target, oldValue, newValue string) {
+	entry := AuditEntry{
+		Time:    time.Now(),
+		User:    reflogIdentity(repoRoot),
+		Command: auditCommand,
+		Op:      op,
+		Target:  target,
+		Old:     oldValue,
+		New:     newValue,
+	}
+	if err := appendAuditEntry(repoRoot, entry); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
+
+// appendAuditEntry writes entry as one line, in a single append so
+// concurrent commands don't interleave their entries
+func appendAuditEntry(repoRoot string, entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	path := filepath.Join(repoRoot, VecDirName, filepath.FromSlash(AuditLogFile))
+	if err := EnsureDirExists(filepath.Dir(path)); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// recordRefAudit logs a ref update, or its deletion when newHash is empty.
+// Callers check AuditEnabled before reading the old value.
+func recordRefAudit(repoRoot, refPath, oldHash, newHash string) {
+	if oldHash == newHash {
+		return
+	}
+	op := AuditRefUpdate
+	if newHash == "" {
+		op = AuditRefDelete
+	}
+	recordAudit(repoRoot, op, refPath, oldHash, newHash)
+}
+
+// ReadAuditLog returns the entries of the audit log, oldest first. A missing
+// log has no entries.
+func ReadAuditLog(repoRoot string) ([]AuditEntry, error) {
+	f, err := os.Open(filepath.Join(repoRoot, VecDirName, filepath.FromSlash(AuditLogFile)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, FSError("failed to open audit log", err)
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return entries, fmt.Errorf("audit log line %d is malformed: %w", lineNo, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return entries, FSError("failed to read audit log", err)
+	}
+	return entries, nil
+}
@@ -121,6 +121,20 @@ func GetConfigValue(repoRoot string, key string) (string, error) {
 	return "", nil
 }
 
+// configBool reports whether key is set to true, yes, on or 1. Unset,
+// unreadable and unrecognised values are false.
+func configBool(repoRoot, key string) bool {
+	value, err := GetConfigValue(repoRoot, key)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "yes", "on", "1":
+		return true
+	}
+	return false
+}
+
 // SetConfigValue sets a config value (either local or global).
 func SetConfigValue(repoRoot string, key string, value string, global bool) error {
 	var configPath string
@@ -144,12 +158,17 @@ func SetConfigValue(repoRoot string, key string, value string, global bool) erro
 		config = make(map[string]string)
 	}
 
+	oldValue, wasAudited := config[key], AuditEnabled(repoRoot)
 	config[key] = value // Set new value
 
 	if global {
 		return WriteGlobalConfig(config)
 	}
-	return WriteConfig(configPath, config)
+	if err := WriteConfig(configPath, config); err != nil {
+		return err
+	}
+	RecordConfigAudit(repoRoot, key, oldValue, value, wasAudited)
+	return nil
 }
 
 // UnsetConfigValue unsets (removes) a config value (either local or global).
@@ -177,10 +196,15 @@ func UnsetConfigValue(repoRoot string, key string, global bool) error {
 		return fmt.Errorf("config key '%s' not found", key)
 	}
 
+	oldValue, wasAudited := config[key], AuditEnabled(repoRoot)
 	delete(config, key)
 
 	if global {
 		return WriteGlobalConfig(config)
 	}
-	return WriteConfig(configPath, config)
+	if err := WriteConfig(configPath, config); err != nil {
+		return err
+	}
+	RecordConfigAudit(repoRoot, key, oldValue, "", wasAudited)
+	return nil
 }
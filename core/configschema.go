@@ -0,0 +1,257 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigType is the kind of value a config key holds
+type ConfigType string
+
+// Config types, as given to --type
+const (
+	ConfigString    ConfigType = "string"
+	ConfigBool      ConfigType = "bool"        // true or false; yes, on, 1 and the like are accepted
+	ConfigInt       ConfigType = "int"         // Decimal, with an optional k, m or g suffix
+	ConfigBoolOrInt ConfigType = "bool-or-int" // bool words, or a number
+	ConfigDuration  ConfigType = "duration"    // Go duration such as 30s or 1h30m
+	ConfigPath      ConfigType = "path"        // File path; ~/ stands for the home directory
+	ConfigExpiry    ConfigType = "expiry-date" // Date such as 2.weeks.ago, or now or never
+)
+
+// ConfigTypes lists the types --type accepts
+var ConfigTypes = []ConfigType{ConfigString, ConfigBool, ConfigInt, ConfigBoolOrInt, ConfigDuration, ConfigPath, ConfigExpiry}
+
+// ConfigKeySpec describes a config key vec reads
+type ConfigKeySpec struct {
+	Name       string     // Key; * stands for a subsection name, as in remote.*.url
+	Type       ConfigType // Type of the value
+	Values     []string   // Words accepted besides the values of Type; all that is accepted for a string
+	Deprecated string     // Why the key shouldn't be set any more, and what to use instead
+}
+
+// KnownConfigKeys describes every key vec reads. Keys holding
+// <command>.<flag> defaults are not listed; they take the flag's values.
+var KnownConfigKeys = []ConfigKeySpec{
+	{Name: "core.autocrlf", Type: ConfigBool, Values: []string{"input"}},
+	{Name: AuditLogKey, Type: ConfigBool},
+	{Name: BareKey, Type: ConfigBool},
+	{Name: "core.editor", Type: ConfigString},
+	{Name: EncryptObjectsKey, Type: ConfigBool},
+	{Name: ExcludesFileKey, Type: ConfigPath},
+	{Name: FileModeKey, Type: ConfigBool},
+	{Name: "core.hooksPath", Type: ConfigPath},
+	{Name: IgnoreCaseKey, Type: ConfigBool},
+	{Name: "core.pager", Type: ConfigString},
+	{Name: PrecomposeUnicodeKey, Type: ConfigBool},
+	{Name: SharedRepositoryKey, Type: ConfigString},
+	{Name: WhitespaceKey, Type: ConfigString},
+
+	{Name: "user.name", Type: ConfigString},
+	{Name: "user.email", Type: ConfigString},
+	{Name: "user.signingKey", Type: ConfigPath},
+	{Name: "gpg.ssh.allowedSignersFile", Type: ConfigPath},
+	{Name: "init.defaultBranch", Type: ConfigString},
+
+	{Name: "branch.*.remote", Type: ConfigString},
+	{Name: "branch.*.merge", Type: ConfigString},
+	{Name: "branch.*.description", Type: ConfigString},
+	{Name: "remote.*.url", Type: ConfigString},
+	{Name: "remote.*.pushurl", Type: ConfigString},
+	{Name: "remote.*.fetch", Type: ConfigString},
+	{Name: "remote.*.auth", Type: ConfigString},
+	{Name: "remote.*.authurl", Type: ConfigString},
+	{Name: "remote.*.authclientid", Type: ConfigString},
+	{Name: "remote.*.header.*", Type: ConfigString},
+	{Name: "remote.*.username", Type: ConfigString},
+	{Name: "remote.*.prefetch", Type: ConfigBool},
+	{Name: "remote.*.password", Type: ConfigString, Deprecated: "it is kept in plain text in the config file; store it with vec remote set-credentials instead"},
+	{Name: "url.*.insteadOf", Type: ConfigString},
+	{Name: "url.*.pushInsteadOf", Type: ConfigString},
+	{Name: "credential.helper", Type: ConfigString},
+
+	{Name: "merge.ff", Type: ConfigBool, Values: []string{"only"}},
+	{Name: "merge.log", Type: ConfigBoolOrInt},
+	{Name: "merge.verifySignatures", Type: ConfigBool},
+	{Name: "diff.tool", Type: ConfigString},
+
+	{Name: "pull.rebase", Type: ConfigBool},
+	{Name: "push.default", Type: ConfigString, Values: []string{"nothing", "current", "upstream", "simple", "matching"}},
+	{Name: "push.autoSetupRemote", Type: ConfigBool},
+	{Name: "push.maxPackSize", Type: ConfigInt},
+	{Name: "push.maxObjectSize", Type: ConfigInt},
+	{Name: "fetch.negotiationTip", Type: ConfigString},
+	{Name: "fetch.fsckObjects", Type: ConfigBool},
+	{Name: "receive.fsckObjects", Type: ConfigBool},
+	{Name: "receive.maxObjectSize", Type: ConfigInt},
+	{Name: "receive.archived", Type: ConfigBool},
+	{Name: "receive.denyCurrentBranch", Type: ConfigBool},
+	{Name: "transfer.fsckObjects", Type: ConfigBool},
+	{Name: "transfer.maxPackSize", Type: ConfigInt},
+	{Name: "transfer.resumeAttempts", Type: ConfigInt},
+
+	{Name: "http.maxIdleConns", Type: ConfigInt},
+	{Name: "http.maxIdleConnsPerHost", Type: ConfigInt},
+	{Name: "http.maxConnsPerHost", Type: ConfigInt},
+	{Name: "http.idleConnTimeout", Type: ConfigDuration},
+	{Name: "http.keepAlive", Type: ConfigDuration},
+	{Name: "http.version", Type: ConfigString, Values: []string{"HTTP/2", "HTTP/1.1"}},
+
+	{Name: "gc.auto", Type: ConfigInt},
+	{Name: "pack.depth", Type: ConfigInt},
+	{Name: "pack.offsetDeltas", Type: ConfigBool},
+	{Name: "repack.writeBitmaps", Type: ConfigBool},
+	{Name: "gc.pruneExpire", Type: ConfigExpiry},
+	{Name: "maintenance.auto", Type: ConfigBool},
+	{Name: "maintenance.prefetch", Type: ConfigBool},
+
+	{Name: "secrets.scan", Type: ConfigBool},
+	{Name: "secrets.entropy", Type: ConfigString},
+	{Name: "secrets.scanner", Type: ConfigString},
+	{Name: "secrets.rule.*", Type: ConfigString},
+}
+
+// LookupConfigKey returns the spec of key, or nil for keys vec doesn't
+// read. Section and key names are compared ignoring case.
+func LookupConfigKey(key string) *ConfigKeySpec {
+	for i := range KnownConfigKeys {
+		if matchConfigKey(strings.ToLower(KnownConfigKeys[i].Name), strings.ToLower(key)) {
+			return &KnownConfigKeys[i]
+		}
+	}
+	return nil
+}
+
+// matchConfigKey matches key against pattern, where each * stands for one
+// or more characters: subsection names such as URLs may hold dots
+func matchConfigKey(pattern, key string) bool {
+	literal, rest, wildcard := strings.Cut(pattern, "*")
+	if !strings.HasPrefix(key, literal) {
+		return false
+	}
+	key = key[len(literal):]
+	if !wildcard {
+		return key == ""
+	}
+	for i := 1; i <= len(key); i++ {
+		if matchConfigKey(rest, key[i:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize checks value against the spec and returns it in canonical form
+func (s *ConfigKeySpec) Normalize(value string) (string, error) {
+	trimmed := strings.TrimSpace(value)
+	for _, allowed := range s.Values {
+		if strings.EqualFold(trimmed, allowed) {
+			return allowed, nil
+		}
+	}
+	if s.Type == ConfigString && len(s.Values) > 0 {
+		return "", ConfigError(fmt.Sprintf("invalid value '%s' for %s (expected %s)", value, s.Name, strings.Join(s.Values, ", ")), nil)
+	}
+	normalized, err := NormalizeConfigValue(s.Type, value)
+	if err != nil {
+		expected := string(s.Type)
+		if len(s.Values) > 0 {
+			expected += " or " + strings.Join(s.Values, ", ")
+		}
+		return "", ConfigError(fmt.Sprintf("invalid value '%s' for %s (expected %s)", value, s.Name, expected), err)
+	}
+	return normalized, nil
+}
+
+// NormalizeConfigValue checks that value is of type t and returns it in
+// canonical form: bools as true or false, ints without suffix
+func NormalizeConfigValue(t ConfigType, value string) (string, error) {
+	trimmed := strings.TrimSpace(value)
+	switch t {
+	case ConfigString, ConfigPath:
+		return value, nil
+	case ConfigBool:
+		if b, ok := parseConfigBool(trimmed); ok {
+			return strconv.FormatBool(b), nil
+		}
+		return "", fmt.Errorf("'%s' is not a bool", value)
+	case ConfigInt:
+		n, err := parseConfigInt(trimmed)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(n, 10), nil
+	case ConfigBoolOrInt:
+		if b, ok := parseConfigBool(trimmed); ok && trimmed != "0" && trimmed != "1" {
+			return strconv.FormatBool(b), nil
+		}
+		n, err := parseConfigInt(trimmed)
+		if err != nil {
+			return "", fmt.Errorf("'%s' is neither a bool nor a number", value)
+		}
+		return strconv.FormatInt(n, 10), nil
+	case ConfigDuration:
+		if _, err := time.ParseDuration(trimmed); err != nil {
+			return "", fmt.Errorf("'%s' is not a duration", value)
+		}
+		return trimmed, nil
+	case ConfigExpiry:
+		switch strings.ToLower(trimmed) {
+		case "now", "never":
+			return strings.ToLower(trimmed), nil
+		}
+		if _, err := ParseApproxDate(trimmed, time.Now()); err != nil {
+			return "", fmt.Errorf("'%s' is not a date", value)
+		}
+		return trimmed, nil
+	}
+	return "", fmt.Errorf("unknown type '%s'", t)
+}
+
+// ExpandConfigPath replaces a leading ~/ in a path value with the home directory
+func ExpandConfigPath(value string) string {
+	if strings.HasPrefix(value, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, value[2:])
+		}
+	}
+	return value
+}
+
+// parseConfigBool reads the words git accepts for a bool
+func parseConfigBool(value string) (bool, bool) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, true
+	case "false", "no", "off", "0", "":
+		return false, true
+	}
+	return false, false
+}
+
+// parseConfigInt reads a number with an optional k, m or g suffix
+func parseConfigInt(value string) (int64, error) {
+	multiplier := int64(1)
+	if value != "" {
+		switch value[len(value)-1] {
+		case 'k', 'K':
+			multiplier = 1 << 10
+		case 'm', 'M':
+			multiplier = 1 << 20
+		case 'g', 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier != 1 {
+			value = value[:len(value)-1]
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a number", value)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,187 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// FetchHeadFile records the refs retrieved by the most recent fetch.
+	FetchHeadFile = "FETCH_HEAD"
+
+	// FetchHeadDir keeps a FETCH_HEAD per remote, outside refs/ so ref walks
+	// don't mistake them for refs.
+	FetchHeadDir = "FETCH_HEAD.d"
+
+	notForMerge       = "not-for-merge"
+	lastFetchedPrefix = "# last_fetched="
+)
+
+// FetchHeadEntry is one ref recorded in FETCH_HEAD.
+type FetchHeadEntry struct {
+	Hash     string // Commit the ref pointed to on the remote
+	Ref      string // Full remote ref name, e.g. refs/heads/main
+	URL      string // URL of the remote it was fetched from
+	ForMerge bool   // Whether a following merge should use this ref
+}
+
+// FetchHead is the parsed content of a FETCH_HEAD file.
+type FetchHead struct {
+	Entries     []FetchHeadEntry
+	LastFetched int64 // Unix time of the fetch, 0 if unknown
+}
+
+// describe renders the human readable part of a FETCH_HEAD line.
+func (e FetchHeadEntry) describe() string {
+	switch {
+	case strings.HasPrefix(e.Ref, "refs/heads/"):
+		return fmt.Sprintf("branch '%s' of %s", strings.TrimPrefix(e.Ref, "refs/heads/"), e.URL)
+	case strings.HasPrefix(e.Ref, "refs/tags/"):
+		return fmt.Sprintf("tag '%s' of %s", strings.TrimPrefix(e.Ref, "refs/tags/"), e.URL)
+	default:
+		return fmt.Sprintf("'%s' of %s", e.Ref, e.URL)
+	}
+}
+
+// parseFetchHeadDescription recovers the ref and URL from a FETCH_HEAD description.
+func parseFetchHeadDescription(desc string) (ref, url string) {
+	kind, prefix := "", ""
+	switch {
+	case strings.HasPrefix(desc, "branch '"):
+		kind, prefix = "branch '", "refs/heads/"
+	case strings.HasPrefix(desc, "tag '"):
+		kind, prefix = "tag '", "refs/tags/"
+	case strings.HasPrefix(desc, "'"):
+		kind = "'"
+	default:
+		return "", desc
+	}
+	rest := strings.TrimPrefix(desc, kind)
+	end := strings.Index(rest, "' of ")
+	if end == -1 {
+		return "", desc
+	}
+	return prefix + rest[:end], rest[end+len("' of "):]
+}
+
+// WriteFetchHead replaces FETCH_HEAD with entries fetched from remoteName,
+// stamped with the current time. Merge candidates are listed first, as readers
+// take the first one by default. A copy is kept in FETCH_HEAD.d/<remote> so
+// each remote remembers when it was last fetched.
+func WriteFetchHead(repoRoot, remoteName string, entries []FetchHeadEntry) error {
+	if err := writeFetchHead(filepath.Join(repoRoot, VecDirName, FetchHeadFile), entries); err != nil {
+		return err
+	}
+	return writeFetchHead(RemoteFetchHeadPath(repoRoot, remoteName), entries)
+}
+
+// RemoteFetchHeadPath returns the path of the FETCH_HEAD copy of remoteName.
+func RemoteFetchHeadPath(repoRoot, remoteName string) string {
+	return filepath.Join(repoRoot, VecDirName, FetchHeadDir, remoteName)
+}
+
+// writeFetchHead writes a FETCH_HEAD formatted file to path.
+func writeFetchHead(path string, entries []FetchHeadEntry) error {
+	var sb strings.Builder
+	for _, forMerge := range []bool{true, false} {
+		for _, e := range entries {
+			if e.ForMerge != forMerge {
+				continue
+			}
+			marker := ""
+			if !e.ForMerge {
+				marker = notForMerge
+			}
+			fmt.Fprintf(&sb, "%s\t%s\t%s\n", e.Hash, marker, e.describe())
+		}
+	}
+	fmt.Fprintf(&sb, "%s%d\n", lastFetchedPrefix, time.Now().Unix())
+
+	if err := EnsureDirExists(filepath.Dir(path)); err != nil {
+		return RefError("failed to create FETCH_HEAD directory", err)
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		return RefError("failed to write FETCH_HEAD", err)
+	}
+	return nil
+}
+
+// ReadFetchHead parses FETCH_HEAD. A missing file is reported as a not found error.
+func ReadFetchHead(repoRoot string) (*FetchHead, error) {
+	path := filepath.Join(repoRoot, VecDirName, FetchHeadFile)
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, NotFoundError(ErrCategoryRef, FetchHeadFile)
+		}
+		return nil, RefError("failed to read FETCH_HEAD", err)
+	}
+	defer file.Close()
+
+	head := &FetchHead{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, lastFetchedPrefix) {
+			head.LastFetched, _ = strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, lastFetchedPrefix)), 10, 64)
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 || !IsValidHex(fields[0]) {
+			return nil, RefError("malformed FETCH_HEAD line", fmt.Errorf("%q", line))
+		}
+		ref, url := parseFetchHeadDescription(fields[2])
+		head.Entries = append(head.Entries, FetchHeadEntry{
+			Hash:     fields[0],
+			Ref:      ref,
+			URL:      url,
+			ForMerge: fields[1] != notForMerge,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, RefError("failed to read FETCH_HEAD", err)
+	}
+	return head, nil
+}
+
+// MergeCandidate returns the first entry marked for merge, or nil if there is none.
+func (h *FetchHead) MergeCandidate() *FetchHeadEntry {
+	for i := range h.Entries {
+		if h.Entries[i].ForMerge {
+			return &h.Entries[i]
+		}
+	}
+	return nil
+}
+
+// ResolveFetchHead returns the commit a merge of FETCH_HEAD would use.
+func ResolveFetchHead(repoRoot string) (string, error) {
+	head, err := ReadFetchHead(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	candidate := head.MergeCandidate()
+	if candidate == nil {
+		return "", RefError("FETCH_HEAD has no ref marked for merge", nil)
+	}
+	return candidate.Hash, nil
+}
+
+// WriteFetchHead replaces FETCH_HEAD with entries fetched from remoteName
+func (r *Repository) WriteFetchHead(remoteName string, entries []FetchHeadEntry) error {
+	return WriteFetchHead(r.Root, remoteName, entries)
+}
+
+// ReadFetchHead parses FETCH_HEAD
+func (r *Repository) ReadFetchHead() (*FetchHead, error) {
+	return ReadFetchHead(r.Root)
+}
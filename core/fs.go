@@ -14,9 +14,9 @@ const (
 	VecDirName = ".vec"
 )
 
-// Global cache for ignore patterns to avoid reloading and reparsing .vecignore
+// Global cache for ignore patterns to avoid reloading and reparsing the ignore files
 var (
-	ignorePatternCache      = make(map[string][]string)
+	ignorePatternCache      = make(map[string][]IgnoreRule)
 	ignorePatternCacheMutex sync.RWMutex
 )
 
@@ -104,101 +104,173 @@ func GetVecRoot() (string, error) {
 	}
 }
 
+// IgnoreRule is a pattern from an ignore file, with where it was read from
+type IgnoreRule struct {
+	Pattern string
+	Source  string // File the rule comes from, relative to the repository root unless it is the global excludes file
+	Line    int    // 1-based line number in Source
+}
+
+// vecDirIgnoreRule is the built-in rule that always ignores .vec
+var vecDirIgnoreRule = IgnoreRule{Pattern: VecDirName, Source: "(built-in)"}
+
 // IsIgnored checks if a given path should be ignored by Vec.
 func IsIgnored(repoRoot, path string) (bool, error) {
+	rule, err := MatchIgnoreRule(repoRoot, path)
+	return rule != nil, err
+}
+
+// MatchIgnoreRule returns the rule that makes path ignored, or nil if it is
+// not ignored
+func MatchIgnoreRule(repoRoot, path string) (*IgnoreRule, error) {
 	// First ensure we're working with absolute paths
 	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return false, fmt.Errorf("failed to get absolute path: %w", err)
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
 	absRepoRoot, err := filepath.Abs(repoRoot)
 	if err != nil {
-		return false, fmt.Errorf("failed to get absolute repo root path: %w", err)
+		return nil, fmt.Errorf("failed to get absolute repo root path: %w", err)
 	}
 
 	// Get path relative to repository root
 	relPath, err := filepath.Rel(absRepoRoot, absPath)
 	if err != nil {
-		return false, fmt.Errorf("failed to get relative path: %w", err)
+		return nil, fmt.Errorf("failed to get relative path: %w", err)
 	}
 
 	// Ignore .vec directory and its contents
 	if strings.HasPrefix(relPath, VecDirName) {
-		return true, nil
+		return &vecDirIgnoreRule, nil
 	}
 
 	// Check for cached patterns first
 	ignorePatternCacheMutex.RLock()
-	patterns, ok := ignorePatternCache[absRepoRoot]
+	rules, ok := ignorePatternCache[absRepoRoot]
 	ignorePatternCacheMutex.RUnlock()
 
-	// If not in cache, load patterns from .vecignore
+	// If not in cache, load patterns from the ignore files
 	if !ok {
-		patterns = loadIgnorePatterns(absRepoRoot)
+		rules = loadIgnorePatterns(absRepoRoot)
 	}
 
 	// Match against patterns
-	return matchIgnorePatterns(patterns, relPath), nil
+	return matchIgnorePatterns(rules, relPath), nil
 }
 
-// loadIgnorePatterns loads and caches patterns from .vecignore file
-func loadIgnorePatterns(absRepoRoot string) []string {
-	vecignorePath := filepath.Join(absRepoRoot, ".vecignore")
-	patterns := []string{}
-
-	if FileExists(vecignorePath) {
-		vecignoreContent, err := ReadFileContent(vecignorePath)
-		if err == nil {
-			// Parse valid patterns
-			rawPatterns := strings.Split(string(vecignoreContent), "\n")
-			patterns = make([]string, 0, len(rawPatterns))
-
-			for _, pattern := range rawPatterns {
-				pattern = strings.TrimSpace(pattern)
-				if pattern == "" || strings.HasPrefix(pattern, "#") {
-					continue // Skip empty lines and comments
-				}
-
-				// Validate pattern before adding to cache
-				if _, err := filepath.Match(pattern, "test-filename"); err != nil {
-					// Log invalid pattern but don't fail
-					fmt.Fprintf(os.Stderr, "warning: invalid pattern in .vecignore: %s\n", pattern)
-					continue
-				}
-
-				patterns = append(patterns, filepath.Clean(pattern))
+// Ignore sources besides .vecignore
+const (
+	InfoExcludeFile     = "info/exclude"      // Per-repository, not versioned, under .vec
+	ExcludesFileKey     = "core.excludesFile" // User-global excludes file
+	defaultExcludesFile = "vec/ignore"        // Under $XDG_CONFIG_HOME or ~/.config
+)
+
+// ExcludesFilePath returns the user-global excludes file: core.excludesFile,
+// relative to the working tree unless absolute, or vec/ignore under
+// $XDG_CONFIG_HOME (~/.config when unset). It is empty if no home directory
+// can be found.
+func ExcludesFilePath(repoRoot string) (string, error) {
+	path, err := GetConfigValue(repoRoot, ExcludesFileKey)
+	if err != nil {
+		return "", ConfigError("failed to read "+ExcludesFileKey, err)
+	}
+	if path == "" {
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", nil
 			}
+			configHome = filepath.Join(home, ".config")
+		}
+		return filepath.Join(configHome, filepath.FromSlash(defaultExcludesFile)), nil
+	}
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
 		}
 	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(repoRoot, path)
+	}
+	return path, nil
+}
+
+// loadIgnorePatterns loads and caches the rules of every ignore source. The
+// first matching rule wins, so sources are read from highest precedence to
+// lowest: .vecignore, .vec/info/exclude, then the global excludes file.
+func loadIgnorePatterns(absRepoRoot string) []IgnoreRule {
+	rules := readIgnoreFile(filepath.Join(absRepoRoot, ".vecignore"), ".vecignore")
+	rules = append(rules, readIgnoreFile(filepath.Join(absRepoRoot, VecDirName, filepath.FromSlash(InfoExcludeFile)),
+		VecDirName+"/"+InfoExcludeFile)...)
+
+	excludesFile, err := ExcludesFilePath(absRepoRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	} else if excludesFile != "" {
+		rules = append(rules, readIgnoreFile(excludesFile, excludesFile)...)
+	}
 
 	// Cache the parsed patterns
 	ignorePatternCacheMutex.Lock()
-	ignorePatternCache[absRepoRoot] = patterns
+	ignorePatternCache[absRepoRoot] = rules
 	ignorePatternCacheMutex.Unlock()
 
-	return patterns
+	return rules
 }
 
-// matchIgnorePatterns checks if a path matches any ignore patterns
-func matchIgnorePatterns(patterns []string, relPath string) bool {
-	for _, pattern := range patterns {
+// readIgnoreFile parses the patterns of the ignore file at path, naming it
+// source in the rules. A missing or unreadable file has no rules.
+func readIgnoreFile(path, source string) []IgnoreRule {
+	if !FileExists(path) {
+		return nil
+	}
+	content, err := ReadFileContent(path)
+	if err != nil {
+		return nil
+	}
+
+	rawPatterns := strings.Split(string(content), "\n")
+	rules := make([]IgnoreRule, 0, len(rawPatterns))
+	for i, pattern := range rawPatterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue // Skip empty lines and comments
+		}
+
+		// Validate pattern before adding to cache
+		if _, err := filepath.Match(pattern, "test-filename"); err != nil {
+			// Log invalid pattern but don't fail
+			fmt.Fprintf(os.Stderr, "warning: invalid pattern in %s: %s\n", source, pattern)
+			continue
+		}
+
+		rules = append(rules, IgnoreRule{Pattern: filepath.Clean(pattern), Source: source, Line: i + 1})
+	}
+	return rules
+}
+
+// matchIgnorePatterns returns the first rule matching the path or one of its
+// parent directories
+func matchIgnorePatterns(rules []IgnoreRule, relPath string) *IgnoreRule {
+	relPathParts := strings.Split(relPath, string(filepath.Separator))
+	for i := range rules {
+		rule := &rules[i]
 		// Check for direct match first
-		matched, _ := filepath.Match(pattern, relPath) // Error already checked during parsing
+		matched, _ := filepath.Match(rule.Pattern, relPath) // Error already checked during parsing
 		if matched {
-			return true
+			return rule
 		}
 
 		// Check if pattern matches any parent directory
-		// Split path only once and reuse for all patterns
-		relPathParts := strings.Split(relPath, string(filepath.Separator))
-		for i := range relPathParts {
-			partialPath := filepath.Join(relPathParts[:i+1]...)
-			if matched, _ := filepath.Match(pattern, partialPath); matched {
-				return true
+		for j := range relPathParts {
+			partialPath := filepath.Join(relPathParts[:j+1]...)
+			if matched, _ := filepath.Match(rule.Pattern, partialPath); matched {
+				return rule
 			}
 		}
 	}
 
-	return false
+	return nil
 }
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Client-side hooks, run from the hooks directory when present and executable
+const (
+	HookPreCommit  = "pre-commit"  // Before the commit is created; non-zero exit aborts
+	HookCommitMsg  = "commit-msg"  // With the message file; may edit it, non-zero exit aborts
+	HookPostCommit = "post-commit" // After the commit; its exit status is ignored
+	HookPrePush    = "pre-push"    // With remote name and URL, ref updates on stdin; non-zero exit aborts
+)
+
+// Environment variables set for every hook
+const (
+	HookEnvVecDir   = "VEC_DIR"       // Absolute path of .vec
+	HookEnvWorkTree = "VEC_WORK_TREE" // Absolute path of the working tree
+	HookEnvIndex    = "VEC_INDEX_FILE"
+)
+
+// ErrHookFailed is returned when a hook exits with a non-zero status
+var ErrHookFailed = errors.New("hook failed")
+
+// HooksDir returns the directory hooks are run from: core.hooksPath, relative
+// to the working tree unless absolute, or .vec/hooks
+func (r *Repository) HooksDir() (string, error) {
+	hooksPath, err := r.GetConfig("core.hooksPath")
+	if err != nil {
+		return "", ConfigError("failed to read core.hooksPath", err)
+	}
+	if hooksPath == "" {
+		return filepath.Join(r.VecDir, "hooks"), nil
+	}
+	if strings.HasPrefix(hooksPath, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			hooksPath = filepath.Join(home, hooksPath[2:])
+		}
+	}
+	if !filepath.IsAbs(hooksPath) {
+		hooksPath = filepath.Join(r.Root, hooksPath)
+	}
+	return hooksPath, nil
+}
+
+// HookOptions is the input of one hook run
+type HookOptions struct {
+	Args  []string          // Command line arguments
+	Stdin io.Reader         // Standard input; empty if nil
+	Env   map[string]string // Operation specific variables, added to the standard ones
+}
+
+// RunHook runs hook name if it exists and is executable, in the working tree
+// with VEC_DIR, VEC_WORK_TREE and VEC_INDEX_FILE exported. Its output goes to
+// stderr. A missing hook succeeds; a non-zero exit returns ErrHookFailed.
+func (r *Repository) RunHook(name string, opts HookOptions) error {
+	dir, err := r.HooksDir()
+	if err != nil {
+		return err
+	}
+	hookPath := filepath.Join(dir, name)
+	info, err := os.Stat(hookPath)
+	if err != nil || info.IsDir() {
+		return nil
+	}
+	if info.Mode()&0111 == 0 {
+		fmt.Fprintf(os.Stderr, "hint: the '%s' hook was ignored because it's not set as executable\n", name)
+		return nil
+	}
+
+	root, err := filepath.Abs(r.Root)
+	if err != nil {
+		return FSError("failed to resolve repository root", err)
+	}
+	env := append(os.Environ(),
+		HookEnvVecDir+"="+filepath.Join(root, VecDirName),
+		HookEnvWorkTree+"="+root,
+		HookEnvIndex+"="+filepath.Join(root, VecDirName, "index"),
+	)
+	for key, value := range opts.Env {
+		env = append(env, key+"="+value)
+	}
+
+	cmd := exec.Command(hookPath, opts.Args...)
+	cmd.Dir = root
+	cmd.Env = env
+	cmd.Stdin = opts.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("%w: %s exited with status %d", ErrHookFailed, name, exitErr.ExitCode())
+		}
+		return fmt.Errorf("%w: failed to run %s: %v", ErrHookFailed, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// IgnoreCaseKey is set at init when the working tree's filesystem treats
+// names differing only in case as the same file
+const IgnoreCaseKey = "core.ignoreCase"
+
+// ProbeIgnoreCase reports whether the filesystem holding dir is case
+// insensitive, by creating a lowercase file and looking it up in uppercase
+func ProbeIgnoreCase(dir string) (bool, error) {
+	file, err := os.CreateTemp(dir, "casecheck-*")
+	if err != nil {
+		return false, fmt.Errorf("failed to probe filesystem case sensitivity: %w", err)
+	}
+	name := file.Name()
+	file.Close()
+	defer os.Remove(name)
+
+	upper := filepath.Join(filepath.Dir(name), strings.ToUpper(filepath.Base(name)))
+	_, err = os.Stat(upper)
+	return err == nil, nil
+}
+
+// IgnoreCase reports whether core.ignoreCase is set for repoRoot. Unset or
+// unreadable values mean a case-sensitive filesystem.
+func IgnoreCase(repoRoot string) bool {
+	return configBool(repoRoot, IgnoreCaseKey)
+}
+
+// IgnoreCase reports whether the working tree's filesystem is case insensitive
+func (r *Repository) IgnoreCase() bool {
+	return IgnoreCase(r.Root)
+}
+
+// PathKey returns the key under which path is looked up: the path itself, or
+// its case-folded form when ignoreCase is set
+func PathKey(path string, ignoreCase bool) string {
+	if ignoreCase {
+		return strings.ToLower(path)
+	}
+	return path
+}
+
+// CaseCollisions groups the paths that differ only in case. Each group and
+// the list of groups are sorted; paths without a collision are left out.
+func CaseCollisions(paths []string) [][]string {
+	byKey := make(map[string][]string)
+	for _, path := range paths {
+		key := PathKey(path, true)
+		byKey[key] = append(byKey[key], path)
+	}
+
+	var groups [][]string
+	for _, group := range byKey {
+		if len(group) > 1 {
+			sort.Strings(group)
+			groups = append(groups, group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i][0] < groups[j][0] })
+	return groups
+}
+
+// WarnCaseCollisions writes a warning to w naming the paths that collide on
+// a case-insensitive filesystem, where only one of each group survives
+func WarnCaseCollisions(w io.Writer, paths []string) {
+	groups := CaseCollisions(paths)
+	if len(groups) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "warning: the following paths differ only in case and collide on this")
+	fmt.Fprintln(w, "case-insensitive filesystem; only one of each group is in the working tree:")
+	for _, group := range groups {
+		fmt.Fprintf(w, "  '%s'\n", strings.Join(group, "', '"))
+	}
+}
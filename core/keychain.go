@@ -0,0 +1,90 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// keychainService names the object store passphrases in the OS keychain
+const keychainService = "vec-objects"
+
+// KeychainPassphrase returns the passphrase stored for keyID in the OS
+// keychain: the login keychain on macOS, or the Secret Service through
+// secret-tool elsewhere
+func KeychainPassphrase(keyID string) (string, error) {
+	var out []byte
+	var err error
+	switch runtime.GOOS {
+	case "darwin":
+		out, err = RunKeychainTool("security", nil, "find-generic-password", "-s", keychainService, "-a", keyID, "-w")
+	case "windows":
+		return "", fmt.Errorf("the OS keychain is not supported on %s", runtime.GOOS)
+	default:
+		out, err = RunKeychainTool("secret-tool", nil, "lookup", "service", keychainService, "key", keyID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the passphrase from the keychain: %w", err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// StoreKeychainPassphrase saves passphrase for keyID in the OS keychain,
+// replacing any stored before
+func StoreKeychainPassphrase(keyID, passphrase string) error {
+	var err error
+	switch runtime.GOOS {
+	case "darwin":
+		err = StoreMacKeychainPassword(keychainService, keyID, passphrase)
+	case "windows":
+		return fmt.Errorf("the OS keychain is not supported on %s", runtime.GOOS)
+	default:
+		_, err = RunKeychainTool("secret-tool", strings.NewReader(passphrase),
+			"store", "--label", "vec object store "+keyID, "service", keychainService, "key", keyID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store the passphrase in the keychain: %w", err)
+	}
+	return nil
+}
+
+// StoreMacKeychainPassword adds or replaces the generic password of service
+// and account in the macOS login keychain. The secret goes to security on
+// stdin, never in its arguments, where other users could read it.
+func StoreMacKeychainPassword(service, account, secret string) error {
+	if strings.ContainsAny(secret, "\r\n") {
+		return errors.New("keychain secrets cannot contain line breaks")
+	}
+	// Given last without a value, -w prompts for the password and its
+	// confirmation, which security reads from stdin
+	_, err := RunKeychainTool("security", strings.NewReader(secret+"\n"+secret+"\n"),
+		"add-generic-password", "-U", "-s", service, "-a", account, "-w")
+	return err
+}
+
+// RunKeychainTool runs a keychain command line tool, security or secret-tool,
+// and returns its output. A tool that ran and failed is reported with an error
+// wrapping its *exec.ExitError, see KeychainEntryMissing.
+func RunKeychainTool(tool string, stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.Command(tool, args...)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w: %s", tool, args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// KeychainEntryMissing reports whether err is from a keychain tool that ran
+// and failed, as it does when there is no such entry, rather than one that
+// couldn't run
+func KeychainEntryMissing(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr)
+}
@@ -0,0 +1,117 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The commit-graph and the multi-pack-index are each a chain of layer files:
+// a chain file lists the layer names oldest first, one per line, and each
+// layer file, named after the checksum that ends it, is replaced only by
+// writing a new one, so readers never see a layer change under them.
+
+// ReadLayerChain returns the layer names listed in a chain file; none if it
+// is missing
+func ReadLayerChain(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	var names []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			names = append(names, line)
+		}
+	}
+	return names, nil
+}
+
+// WriteLayerChain replaces a chain file with names
+func (r *Repository) WriteLayerChain(path string, names []string) error {
+	perms, err := r.Permissions()
+	if err != nil {
+		return err
+	}
+	tempPath := path + ".lock"
+	content := strings.Join(names, "\n")
+	if len(names) > 0 {
+		content += "\n"
+	}
+	if err := perms.WriteFile(tempPath, []byte(content)); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// WriteLayerFile stores data, followed by its checksum, in dir as
+// prefix-<checksum><ext> and returns the checksum
+func (r *Repository) WriteLayerFile(dir, prefix, ext string, data []byte) (string, error) {
+	perms, err := r.Permissions()
+	if err != nil {
+		return "", err
+	}
+	if err := perms.MkdirAll(dir); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:])
+	path := filepath.Join(dir, prefix+name+ext)
+	if err := perms.WriteFile(path+".tmp", append(data, sum[:]...)); err != nil {
+		os.Remove(path + ".tmp")
+		return "", fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		return "", fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return name, nil
+}
+
+// ReadLayerFile returns the content of a layer file after checking its
+// checksum
+func ReadLayerFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	if len(data) < sha256.Size {
+		return nil, fmt.Errorf("%s is truncated", filepath.Base(path))
+	}
+	body, sum := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	if expected := sha256.Sum256(body); !bytes.Equal(expected[:], sum) {
+		return nil, fmt.Errorf("%s is corrupt: checksum mismatch", filepath.Base(path))
+	}
+	return body, nil
+}
+
+// RemoveStaleLayerFiles deletes the layer files of dir that the chain no
+// longer lists
+func RemoveStaleLayerFiles(dir, prefix, ext string, names []string) {
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		keep[prefix+name+ext] = true
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, prefix) && strings.HasSuffix(name, ext) && !keep[name] {
+			os.Remove(filepath.Join(dir, name))
+		}
+	}
+}
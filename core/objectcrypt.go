@@ -0,0 +1,399 @@
+package core
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// EncryptObjectsKey turns on encryption of newly written loose objects
+const EncryptObjectsKey = "core.encryptObjects"
+
+// ObjectKeyFile holds the repository key, wrapped with the passphrase,
+// relative to the .vec directory
+const ObjectKeyFile = "objectkey"
+
+// ObjectPassphraseEnv supplies the passphrase that unlocks the repository key
+const ObjectPassphraseEnv = "VEC_OBJECT_PASSPHRASE"
+
+// An encrypted loose object is the magic, a random 12-byte nonce prefix and
+// the object file split into segments of objectSegmentSize bytes, each
+// sealed with AES-256-GCM under the repository key. A segment's nonce is
+// the prefix with its index added to the last four bytes, and its additional
+// data marks whether it is the final one, so segments can neither be
+// reordered nor dropped from the end. Plain object files never start with
+// the magic, so both kinds can live in one store.
+const (
+	encryptedObjectMagic = "VECENC1\n"
+	objectSegmentSize    = 64 << 10
+	objectKeyKDFRounds   = 600000
+)
+
+// Object encryption errors
+var (
+	ErrObjectStoreLocked  = errors.New("encrypted object store is locked")
+	ErrObjectPassphrase   = errors.New("wrong passphrase for the object store")
+	ErrCorruptObjectCrypt = errors.New("encrypted object is corrupt")
+)
+
+// objectKey is the on-disk form of the wrapped repository key
+type objectKey struct {
+	Version    int    `json:"version"`
+	ID         string `json:"id"` // Names the key in the OS keychain
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Wrapped    []byte `json:"wrapped"`
+}
+
+// unlockedKeys caches the repository key ciphers by repository root
+var unlockedKeys sync.Map
+
+func objectKeyPath(repoRoot string) string {
+	return filepath.Join(repoRoot, VecDirName, ObjectKeyFile)
+}
+
+// ObjectEncryptionEnabled reports whether new objects are written encrypted
+func ObjectEncryptionEnabled(repoRoot string) bool {
+	return configBool(repoRoot, EncryptObjectsKey)
+}
+
+// readObjectKey loads the wrapped repository key
+func readObjectKey(repoRoot string) (*objectKey, error) {
+	data, err := os.ReadFile(objectKeyPath(repoRoot))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ConfigError(fmt.Sprintf("%s is set but the repository has no object key; run 'vec encryption init'", EncryptObjectsKey), nil)
+		}
+		return nil, FSError("failed to read the object key", err)
+	}
+	var key objectKey
+	if err := json.Unmarshal(data, &key); err != nil || key.Version != 1 {
+		return nil, FSError("the object key file is corrupt", err)
+	}
+	return &key, nil
+}
+
+// wrapCipher returns the cipher that wraps the repository key
+func wrapCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	return newObjectCipher(PBKDF2SHA256([]byte(passphrase), salt, iterations, 32))
+}
+
+func newObjectCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// InitObjectEncryption creates a random repository key wrapped with
+// passphrase and turns on core.encryptObjects. It returns the key ID.
+func InitObjectEncryption(repoRoot, passphrase string) (string, error) {
+	if passphrase == "" {
+		return "", fmt.Errorf("a passphrase is required")
+	}
+	if FileExists(objectKeyPath(repoRoot)) {
+		return "", fmt.Errorf("the repository already has an object key")
+	}
+
+	secret := make([]byte, 32)
+	id := make([]byte, 8)
+	key := &objectKey{Version: 1, Iterations: objectKeyKDFRounds, Salt: make([]byte, 16), Nonce: make([]byte, 12)}
+	for _, b := range [][]byte{secret, id, key.Salt, key.Nonce} {
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("failed to generate the object key: %w", err)
+		}
+	}
+	key.ID = hex.EncodeToString(id)
+	wrap, err := wrapCipher(passphrase, key.Salt, key.Iterations)
+	if err != nil {
+		return "", err
+	}
+	key.Wrapped = wrap.Seal(nil, key.Nonce, secret, []byte(key.ID))
+
+	data, err := json.MarshalIndent(key, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode the object key: %w", err)
+	}
+	// The key is written before encryption is turned on, so no object is
+	// ever encrypted under a key that isn't on disk
+	if err := os.WriteFile(objectKeyPath(repoRoot), append(data, '\n'), 0600); err != nil {
+		return "", FSError("failed to write the object key", err)
+	}
+	aead, err := newObjectCipher(secret)
+	if err != nil {
+		return "", err
+	}
+	unlockedKeys.Store(repoRoot, aead)
+	if err := SetConfigValue(repoRoot, EncryptObjectsKey, "true", false); err != nil {
+		return "", err
+	}
+	return key.ID, nil
+}
+
+// ObjectKeyID returns the ID of the repository key, "" without one
+func ObjectKeyID(repoRoot string) (string, error) {
+	if !FileExists(objectKeyPath(repoRoot)) {
+		return "", nil
+	}
+	key, err := readObjectKey(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	return key.ID, nil
+}
+
+// UnlockObjectStore unwraps the repository key with passphrase and keeps it
+// for the rest of the process
+func UnlockObjectStore(repoRoot, passphrase string) error {
+	key, err := readObjectKey(repoRoot)
+	if err != nil {
+		return err
+	}
+	wrap, err := wrapCipher(passphrase, key.Salt, key.Iterations)
+	if err != nil {
+		return err
+	}
+	secret, err := wrap.Open(nil, key.Nonce, key.Wrapped, []byte(key.ID))
+	if err != nil {
+		return ErrObjectPassphrase
+	}
+	aead, err := newObjectCipher(secret)
+	if err != nil {
+		return err
+	}
+	unlockedKeys.Store(repoRoot, aead)
+	return nil
+}
+
+// objectCipher returns the repository key cipher, unlocking it with the
+// passphrase from VEC_OBJECT_PASSPHRASE or else the OS keychain
+func objectCipher(repoRoot string) (cipher.AEAD, error) {
+	if aead, ok := unlockedKeys.Load(repoRoot); ok {
+		return aead.(cipher.AEAD), nil
+	}
+	passphrase := os.Getenv(ObjectPassphraseEnv)
+	if passphrase == "" {
+		key, err := readObjectKey(repoRoot)
+		if err != nil {
+			return nil, err
+		}
+		if passphrase, err = KeychainPassphrase(key.ID); err != nil || passphrase == "" {
+			return nil, fmt.Errorf("%w: set %s or store the passphrase with 'vec encryption keychain'",
+				ErrObjectStoreLocked, ObjectPassphraseEnv)
+		}
+	}
+	if err := UnlockObjectStore(repoRoot, passphrase); err != nil {
+		return nil, err
+	}
+	aead, _ := unlockedKeys.Load(repoRoot)
+	return aead.(cipher.AEAD), nil
+}
+
+// CheckObjectStoreUnlocked returns an error wrapping ErrObjectStoreLocked when
+// new objects are encrypted but the key can't be unlocked. Writers call it
+// before creating any object file.
+func CheckObjectStoreUnlocked(repoRoot string) error {
+	if !ObjectEncryptionEnabled(repoRoot) {
+		return nil
+	}
+	_, err := objectCipher(repoRoot)
+	return err
+}
+
+// IsEncryptedObject reports whether a loose object file is encrypted
+func IsEncryptedObject(raw []byte) bool {
+	return bytes.HasPrefix(raw, []byte(encryptedObjectMagic))
+}
+
+// segmentNonce returns the nonce of segment index
+func segmentNonce(prefix []byte, index uint32) []byte {
+	nonce := append([]byte(nil), prefix...)
+	last := binary.BigEndian.Uint32(nonce[len(nonce)-4:])
+	binary.BigEndian.PutUint32(nonce[len(nonce)-4:], last+index)
+	return nonce
+}
+
+func segmentAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// DecodeObjectFile returns the content of a loose object file as read from
+// disk, decrypting it when it is encrypted. Plain files are returned as is.
+func DecodeObjectFile(repoRoot string, raw []byte) ([]byte, error) {
+	if !IsEncryptedObject(raw) {
+		return raw, nil
+	}
+	aead, err := objectCipher(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	body := raw[len(encryptedObjectMagic):]
+	if len(body) < aead.NonceSize() {
+		return nil, ErrCorruptObjectCrypt
+	}
+	prefix, body := body[:aead.NonceSize()], body[aead.NonceSize():]
+
+	sealedSize := objectSegmentSize + aead.Overhead()
+	var content []byte
+	for index := uint32(0); ; index++ {
+		n := len(body)
+		if n > sealedSize {
+			n = sealedSize
+		}
+		final := n == len(body)
+		plain, err := aead.Open(nil, segmentNonce(prefix, index), body[:n], segmentAD(final))
+		if err != nil {
+			return nil, ErrCorruptObjectCrypt
+		}
+		content = append(content, plain...)
+		body = body[n:]
+		if final {
+			return content, nil
+		}
+	}
+}
+
+// ReadObjectFile reads and, when needed, decrypts the loose object at path
+func ReadObjectFile(repoRoot, path string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeObjectFile(repoRoot, raw)
+}
+
+// OpenObjectFile opens the loose object at path for reading its stored
+// content, decrypted when it is encrypted
+func OpenObjectFile(repoRoot, path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, len(encryptedObjectMagic))
+	n, _ := io.ReadFull(file, magic)
+	if !IsEncryptedObject(magic[:n]) {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return file, nil
+	}
+
+	raw, err := io.ReadAll(io.MultiReader(bytes.NewReader(magic), file))
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+	content, err := DecodeObjectFile(repoRoot, raw)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// objectEncrypter seals what is written to it segment by segment
+type objectEncrypter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	index  uint32
+	buf    []byte
+}
+
+func (e *objectEncrypter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// A full segment is sealed only once more data follows, as the last
+		// segment is sealed as final by Close
+		if len(e.buf) == objectSegmentSize {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := objectSegmentSize - len(e.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		e.buf = append(e.buf, p[:n]...)
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (e *objectEncrypter) seal(final bool) error {
+	sealed := e.aead.Seal(nil, segmentNonce(e.prefix, e.index), e.buf, segmentAD(final))
+	e.index++
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+func (e *objectEncrypter) Close() error {
+	return e.seal(true)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// NewObjectFileWriter returns a writer for the content of a new loose object
+// file that is written to w encrypted when core.encryptObjects is on. Close
+// must be called to complete the file; it doesn't close w.
+func NewObjectFileWriter(repoRoot string, w io.Writer) (io.WriteCloser, error) {
+	if !ObjectEncryptionEnabled(repoRoot) {
+		return nopWriteCloser{w}, nil
+	}
+	aead, err := objectCipher(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	if _, err := io.WriteString(w, encryptedObjectMagic); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(prefix); err != nil {
+		return nil, err
+	}
+	return &objectEncrypter{w: w, aead: aead, prefix: prefix, buf: make([]byte, 0, objectSegmentSize)}, nil
+}
+
+// EncodeObjectFile returns the bytes to store for a loose object file with
+// the given content, encrypted when core.encryptObjects is on
+func EncodeObjectFile(repoRoot string, content []byte) ([]byte, error) {
+	if !ObjectEncryptionEnabled(repoRoot) {
+		return content, nil
+	}
+	var buf bytes.Buffer
+	w, err := NewObjectFileWriter(repoRoot, &buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(content); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
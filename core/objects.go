@@ -65,7 +65,10 @@ func WriteObject(repoRoot, objectType string, data []byte) (string, error) {
 
 	// Write object
 	header := fmt.Sprintf("%s %d\n", objectType, len(data))
-	content := append([]byte(header), data...)
+	content, err := EncodeObjectFile(repoRoot, append([]byte(header), data...))
+	if err != nil {
+		return "", err
+	}
 
 	if err := os.WriteFile(objectPath, content, 0444); err != nil {
 		return "", fmt.Errorf("failed to write object: %w", err)
@@ -85,7 +88,7 @@ func ReadObject(repoRoot, hash string) (string, []byte, error) {
 	objectPath := GetObjectPath(repoRoot, hash)
 
 	// Read object
-	content, err := ReadFileContent(objectPath)
+	content, err := ReadObjectFile(repoRoot, objectPath)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to read object %s: %w", hash, err)
 	}
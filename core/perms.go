@@ -0,0 +1,157 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Configuration of the permissions of new files
+const (
+	// SharedRepositoryKey sets the modes of repository and checked-out
+	// files: umask (the default) leaves them to the umask, group makes them
+	// readable and writable by the group only (0660), all also readable by
+	// everyone (0664), and an octal mode such as 0640 is used as given
+	SharedRepositoryKey = "core.sharedRepository"
+
+	// FileModeKey, true by default, checks out executable files as
+	// executable; false writes every file without the executable bit
+	FileModeKey = "core.fileMode"
+)
+
+// Permissions are the modes new files and directories of a repository and
+// its working tree are created with
+type Permissions struct {
+	File       os.FileMode
+	Dir        os.FileMode
+	Executable bool // Honor the executable bit of checked-out files
+
+	// shared modes are set as given, regardless of the umask
+	shared bool
+}
+
+// defaultPermissions leaves the final modes to the umask
+var defaultPermissions = Permissions{File: 0644, Dir: 0755, Executable: true}
+
+// Permissions are read once per config change, not for every file written
+var permissionCache struct {
+	sync.Mutex
+	root    string
+	modTime time.Time
+	perms   Permissions
+}
+
+// LoadPermissions returns the permissions core.sharedRepository and
+// core.fileMode give new files of the repository at repoRoot
+func LoadPermissions(repoRoot string) (Permissions, error) {
+	var modTime time.Time
+	if info, err := os.Stat(filepath.Join(repoRoot, VecDirName, "config")); err == nil {
+		modTime = info.ModTime()
+	}
+	permissionCache.Lock()
+	defer permissionCache.Unlock()
+	if permissionCache.root == repoRoot && permissionCache.modTime.Equal(modTime) && !modTime.IsZero() {
+		return permissionCache.perms, nil
+	}
+
+	perms := defaultPermissions
+	value, err := GetConfigValue(repoRoot, SharedRepositoryKey)
+	if err != nil {
+		return perms, ConfigError("failed to read "+SharedRepositoryKey, err)
+	}
+	if perms.File, perms.Dir, perms.shared, err = parseSharedRepository(value); err != nil {
+		return defaultPermissions, err
+	}
+	fileMode, err := GetConfigValue(repoRoot, FileModeKey)
+	if err != nil {
+		return perms, ConfigError("failed to read "+FileModeKey, err)
+	}
+	switch strings.ToLower(strings.TrimSpace(fileMode)) {
+	case "false", "no", "off", "0":
+		perms.Executable = false
+	}
+
+	permissionCache.root, permissionCache.modTime, permissionCache.perms = repoRoot, modTime, perms
+	return perms, nil
+}
+
+// Permissions returns the permissions of new files, see LoadPermissions
+func (r *Repository) Permissions() (Permissions, error) {
+	return LoadPermissions(r.Root)
+}
+
+// parseSharedRepository returns the file and directory modes a
+// core.sharedRepository value stands for
+func parseSharedRepository(value string) (file, dir os.FileMode, shared bool, err error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "umask", "false", "no", "off":
+		return defaultPermissions.File, defaultPermissions.Dir, false, nil
+	case "group", "true", "yes", "on", "1":
+		return 0660, 0770, true, nil
+	case "all", "world", "everybody", "2":
+		return 0664, 0775, true, nil
+	}
+	mode, parseErr := strconv.ParseUint(strings.TrimSpace(value), 8, 32)
+	if parseErr != nil || mode > 0777 || mode&0600 != 0600 {
+		return 0, 0, false, ConfigError(fmt.Sprintf("invalid %s '%s': expected umask, group, all or an octal mode the owner can read and write", SharedRepositoryKey, value), nil)
+	}
+	file = os.FileMode(mode)
+	return file, file | (file&0444)>>2, true, nil
+}
+
+// ExecutableFile returns the mode of a checked-out file: executable where
+// it is readable when the entry is executable and core.fileMode allows it
+func (p Permissions) ExecutableFile(executable bool) os.FileMode {
+	if executable && p.Executable {
+		return p.File | (p.File&0444)>>2
+	}
+	return p.File
+}
+
+// Apply gives an existing path the shared mode; under the default umask
+// policy the mode it was created with is left alone
+func (p Permissions) Apply(path string, mode os.FileMode) error {
+	if !p.shared {
+		return nil
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("failed to set permissions of %s: %w", path, err)
+	}
+	return nil
+}
+
+// WriteFile writes data to path with the repository file mode
+func (p Permissions) WriteFile(path string, data []byte) error {
+	if err := os.WriteFile(path, data, p.File); err != nil {
+		return err
+	}
+	return p.Apply(path, p.File)
+}
+
+// MkdirAll creates path and its missing parents with the directory mode
+func (p Permissions) MkdirAll(path string) error {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return nil
+	}
+	// Find the directories about to be created, to apply the mode to them
+	var created []string
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		created = append(created, dir)
+	}
+	if err := os.MkdirAll(path, p.Dir); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", path, err)
+	}
+	for _, dir := range created {
+		if err := p.Apply(dir, p.Dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// PrecomposeUnicodeKey makes paths read from the working tree be stored in
+// NFC, the form Linux and Windows use, even where the filesystem hands them
+// out decomposed (NFD) as macOS does
+const PrecomposeUnicodeKey = "core.precomposeUnicode"
+
+// ProbeDecomposesUnicode reports whether the filesystem holding dir should
+// set core.precomposeUnicode: always on macOS, elsewhere when a file created
+// with a precomposed name is listed decomposed
+func ProbeDecomposesUnicode(dir string) (bool, error) {
+	if runtime.GOOS == "darwin" {
+		return true, nil
+	}
+	probe, err := os.MkdirTemp(dir, "unicodecheck-*")
+	if err != nil {
+		return false, fmt.Errorf("failed to probe filesystem unicode handling: %w", err)
+	}
+	defer os.RemoveAll(probe)
+
+	name := "\u00e4" // a with diaeresis, precomposed
+	file, err := os.Create(filepath.Join(probe, name))
+	if err != nil {
+		return false, nil
+	}
+	file.Close()
+	entries, err := os.ReadDir(probe)
+	if err != nil || len(entries) != 1 {
+		return false, nil
+	}
+	return entries[0].Name() != name, nil
+}
+
+// PrecomposeUnicode reports whether core.precomposeUnicode is set for repoRoot
+func PrecomposeUnicode(repoRoot string) bool {
+	return configBool(repoRoot, PrecomposeUnicodeKey)
+}
+
+// PrecomposeUnicode reports whether working tree paths are normalized to NFC
+func (r *Repository) PrecomposeUnicode() bool {
+	return PrecomposeUnicode(r.Root)
+}
+
+// NormalizePath returns path in NFC when precompose is set, unchanged otherwise
+func NormalizePath(path string, precompose bool) string {
+	if precompose && !norm.NFC.IsNormalString(path) {
+		return norm.NFC.String(path)
+	}
+	return path
+}
+
+// IsNormalizedPath reports whether path is already in NFC
+func IsNormalizedPath(path string) bool {
+	return norm.NFC.IsNormalString(path)
+}
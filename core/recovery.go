@@ -0,0 +1,228 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Every command that moves or deletes a ref leaves a way back: the previous
+// HEAD commit in ORIG_HEAD, a copy of deleted or rewritten refs under
+// refs/original/, and an entry in the undo journal read by vec undo.
+const (
+	OrigHeadFile    = "ORIG_HEAD"
+	BackupRefPrefix = "refs/original/"
+	undoJournalFile = "undo" // In .vec/logs
+)
+
+// zeroID stands for a missing ref in the undo journal
+var zeroID = strings.Repeat("0", 64)
+
+// orZero writes a missing commit as the zero ID
+func orZero(id string) string {
+	if id == "" {
+		return zeroID
+	}
+	return id
+}
+
+// WriteOrigHead records commit as ORIG_HEAD, the HEAD before a ref-moving operation
+func WriteOrigHead(repoRoot, commit string) error {
+	if commit == "" {
+		return nil
+	}
+	path := filepath.Join(repoRoot, VecDirName, OrigHeadFile)
+	if err := os.WriteFile(path, []byte(commit+"\n"), 0644); err != nil {
+		return RefError("failed to write ORIG_HEAD", err)
+	}
+	return nil
+}
+
+// ReadOrigHead returns the commit in ORIG_HEAD, or "" if there is none
+func ReadOrigHead(repoRoot string) (string, error) {
+	return ReadRefValue(repoRoot, OrigHeadFile)
+}
+
+// BackupRef saves the value commit of ref (such as refs/heads/topic) as
+// refs/original/<ref> before the ref is deleted or rewritten, and notes it
+// in that backup's reflog
+func BackupRef(repoRoot, ref, commit, message string) error {
+	if commit == "" {
+		return nil
+	}
+	backup := BackupRefPrefix + ref
+	old, err := ReadRefValue(repoRoot, backup)
+	if err != nil {
+		return err
+	}
+	if old == "" {
+		old = zeroID
+	}
+	if err := WriteRef(repoRoot, backup, commit); err != nil {
+		return err
+	}
+	return appendReflogEntry(repoRoot, []string{backup}, old, commit, message)
+}
+
+// RefMove is one ref update in the undo journal. An empty Old means the ref
+// was created, an empty New that it was deleted.
+type RefMove struct {
+	Ref     string
+	Old     string
+	New     string
+	Time    time.Time
+	Message string
+}
+
+// undoJournalPath returns the location of the undo journal
+func undoJournalPath(repoRoot string) string {
+	return filepath.Join(repoRoot, VecDirName, "logs", undoJournalFile)
+}
+
+// RecordRefMove appends a ref update to the undo journal.
+// Format: <old-sha> <new-sha> <ref> <timestamp>\t<message>
+func RecordRefMove(repoRoot, ref, oldCommit, newCommit, message string) error {
+	if oldCommit == newCommit {
+		return nil
+	}
+	entry := fmt.Sprintf("%s %s %s %d\t%s\n", orZero(oldCommit), orZero(newCommit), ref,
+		time.Now().Unix(), strings.ReplaceAll(message, "\n", " "))
+
+	path := undoJournalPath(repoRoot)
+	if err := EnsureDirExists(filepath.Dir(path)); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open undo journal: %w", err)
+	}
+	_, err = f.WriteString(entry)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write undo journal: %w", err)
+	}
+	return nil
+}
+
+// readUndoJournal returns the journal's lines, oldest first
+func readUndoJournal(repoRoot string) ([]string, error) {
+	data, err := os.ReadFile(undoJournalPath(repoRoot))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read undo journal: %w", err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// parseRefMove parses one undo journal line
+func parseRefMove(line string) (*RefMove, error) {
+	head, message, _ := strings.Cut(line, "\t")
+	fields := strings.Fields(head)
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("malformed undo journal entry '%s'", line)
+	}
+	seconds, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed undo journal entry '%s'", line)
+	}
+	fromZero := func(id string) string {
+		if id == zeroID {
+			return ""
+		}
+		return id
+	}
+	return &RefMove{
+		Ref:     fields[2],
+		Old:     fromZero(fields[0]),
+		New:     fromZero(fields[1]),
+		Time:    time.Unix(seconds, 0),
+		Message: message,
+	}, nil
+}
+
+// LastRefMove returns the most recent entry of the undo journal, or nil if
+// it is empty
+func LastRefMove(repoRoot string) (*RefMove, error) {
+	lines, err := readUndoJournal(repoRoot)
+	if err != nil || len(lines) == 0 {
+		return nil, err
+	}
+	return parseRefMove(lines[len(lines)-1])
+}
+
+// DropLastRefMove removes the most recent entry of the undo journal once it
+// has been undone
+func DropLastRefMove(repoRoot string) error {
+	lines, err := readUndoJournal(repoRoot)
+	if err != nil || len(lines) == 0 {
+		return err
+	}
+	content := ""
+	if len(lines) > 1 {
+		content = strings.Join(lines[:len(lines)-1], "\n") + "\n"
+	}
+	if err := os.WriteFile(undoJournalPath(repoRoot), []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write undo journal: %w", err)
+	}
+	return nil
+}
+
+// UndoRefMove puts move.Ref back to move.Old, provided it still holds
+// move.New, logs the change in the reflog and drops move from the undo
+// journal. The working tree is left alone. A ref the move created is
+// deleted and a ref it deleted is restored.
+func UndoRefMove(repoRoot string, move *RefMove) error {
+	if move.Ref == HeadFile && move.Old == "" {
+		return RefError("cannot undo: HEAD had no commit before", nil)
+	}
+	if err := UpdateRefCAS(repoRoot, move.Ref, move.New, move.Old); err != nil {
+		return err
+	}
+
+	refs := []string{move.Ref}
+	if head, err := ReadHEADFile(repoRoot); err == nil && head == "ref: "+move.Ref {
+		refs = append(refs, HeadFile)
+	}
+	if err := appendReflogEntry(repoRoot, refs, orZero(move.New), orZero(move.Old), "undo: "+move.Message); err != nil {
+		return err
+	}
+	return DropLastRefMove(repoRoot)
+}
+
+// WriteOrigHead records commit as ORIG_HEAD
+func (r *Repository) WriteOrigHead(commit string) error {
+	return WriteOrigHead(r.Root, commit)
+}
+
+// BackupRef saves commit as refs/original/<ref>
+func (r *Repository) BackupRef(ref, commit, message string) error {
+	return BackupRef(r.Root, ref, commit, message)
+}
+
+// RecordRefMove appends a ref update to the undo journal
+func (r *Repository) RecordRefMove(ref, oldCommit, newCommit, message string) error {
+	return RecordRefMove(r.Root, ref, oldCommit, newCommit, message)
+}
+
+// LastRefMove returns the most recent entry of the undo journal
+func (r *Repository) LastRefMove() (*RefMove, error) {
+	return LastRefMove(r.Root)
+}
+
+// UndoRefMove reverts move, see UndoRefMove
+func (r *Repository) UndoRefMove(move *RefMove) error {
+	return UndoRefMove(r.Root, move)
+}
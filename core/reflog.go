@@ -0,0 +1,171 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reflogIdentity returns "name <email>" from the configuration for reflog entries
+func reflogIdentity(repoRoot string) string {
+	name, err := GetConfigValue(repoRoot, "user.name")
+	if err != nil || name == "" {
+		name = "unknown"
+	}
+	email, err := GetConfigValue(repoRoot, "user.email")
+	if err != nil || email == "" {
+		email = "unknown"
+	}
+	return fmt.Sprintf("%s <%s>", name, email)
+}
+
+// AppendReflog records a ref update in the reflog of HEAD and, unless branch
+// is empty, of refs/heads/<branch>.
+// Format: <old-sha> <new-sha> <name> <email> <timestamp> <timezone>\t<message>
+func AppendReflog(repoRoot, branch, oldCommit, newCommit, message string) error {
+	refs := []string{HeadFile}
+	if branch != "" {
+		refs = append(refs, "refs/heads/"+branch)
+	}
+	return appendReflogEntry(repoRoot, refs, oldCommit, newCommit, message)
+}
+
+// appendReflogEntry appends one entry to the reflog of each of refs
+func appendReflogEntry(repoRoot string, refs []string, oldCommit, newCommit, message string) error {
+	now := time.Now()
+	entry := fmt.Sprintf("%s %s %s %d %s\t%s\n", oldCommit, newCommit, reflogIdentity(repoRoot),
+		now.Unix(), now.Format("-0700"), message)
+
+	logsDir := filepath.Join(repoRoot, VecDirName, "logs")
+	for _, ref := range refs {
+		path := filepath.Join(logsDir, filepath.FromSlash(ref))
+		if err := EnsureDirExists(filepath.Dir(path)); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open reflog: %w", err)
+		}
+		_, err = f.WriteString(entry)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write reflog: %w", err)
+		}
+	}
+	return nil
+}
+
+// AppendReflog records a ref update in the reflogs of HEAD and branch
+func (r *Repository) AppendReflog(branch, oldCommit, newCommit, message string) error {
+	return AppendReflog(r.Root, branch, oldCommit, newCommit, message)
+}
+
+// AppendRefReflog records an update of ref, HEAD or a full ref name such as
+// refs/stash, in the reflog of that ref only
+func AppendRefReflog(repoRoot, ref, oldCommit, newCommit, message string) error {
+	return appendReflogEntry(repoRoot, []string{ref}, oldCommit, newCommit, message)
+}
+
+// WriteReflog replaces the reflog of ref with entries, oldest first. An
+// empty list removes the reflog.
+func WriteReflog(repoRoot, ref string, entries []ReflogEntry) error {
+	path := filepath.Join(repoRoot, VecDirName, "logs", filepath.FromSlash(ref))
+	if len(entries) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return RefError("failed to remove reflog of "+ref, err)
+		}
+		return nil
+	}
+	var b strings.Builder
+	for _, entry := range entries {
+		old := entry.Old
+		if old == "" {
+			old = strings.Repeat("0", len(entry.New))
+		}
+		fmt.Fprintf(&b, "%s %s %s %d %s\t%s\n", old, entry.New, entry.Identity,
+			entry.Time.Unix(), entry.Time.Format("-0700"), entry.Message)
+	}
+	tempPath := path + ".lock"
+	if err := os.WriteFile(tempPath, []byte(b.String()), 0644); err != nil {
+		os.Remove(tempPath)
+		return RefError("failed to write reflog of "+ref, err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return RefError("failed to write reflog of "+ref, err)
+	}
+	return nil
+}
+
+// ReflogEntry is one update of a ref. Old is empty when the ref was created.
+type ReflogEntry struct {
+	Old      string
+	New      string
+	Identity string
+	Time     time.Time
+	Message  string
+}
+
+// ReadReflog returns the reflog of ref (HEAD or a full ref name), oldest
+// first; nil if the ref has none. Lines that can't be parsed are skipped.
+func ReadReflog(repoRoot, ref string) ([]ReflogEntry, error) {
+	data, err := os.ReadFile(filepath.Join(repoRoot, VecDirName, "logs", filepath.FromSlash(ref)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, RefError("failed to read reflog of "+ref, err)
+	}
+	var entries []ReflogEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		if entry, ok := parseReflogLine(line); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// parseReflogLine parses "<old> <new> <name> <email> <timestamp> <zone>"
+// followed by the message. A created ref may have no or an all-zero old
+// ID; the message follows a tab or, in older entries, a space.
+func parseReflogLine(line string) (ReflogEntry, bool) {
+	open, end := strings.Index(line, " <"), strings.Index(line, "> ")
+	if open < 0 || end < open {
+		return ReflogEntry{}, false
+	}
+	ids := strings.Fields(line[:open])
+	var entry ReflogEntry
+	switch {
+	case len(ids) >= 3 && IsValidHex(ids[0]) && IsValidHex(ids[1]):
+		entry.Old, entry.New = ids[0], ids[1]
+		entry.Identity = strings.Join(ids[2:], " ") + line[open:end+1]
+	case len(ids) >= 2 && IsValidHex(ids[0]):
+		entry.New = ids[0]
+		entry.Identity = strings.Join(ids[1:], " ") + line[open:end+1]
+	default:
+		return ReflogEntry{}, false
+	}
+	if strings.Trim(entry.Old, "0") == "" {
+		entry.Old = ""
+	}
+
+	rest := strings.TrimLeft(line[end+2:], " ")
+	seconds, rest, _ := strings.Cut(rest, " ")
+	timestamp, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return ReflogEntry{}, false
+	}
+	entry.Time = time.Unix(timestamp, 0)
+	zone, message, _ := strings.Cut(rest, "\t")
+	if strings.Contains(zone, " ") {
+		// No tab before the message
+		zone, message, _ = strings.Cut(rest, " ")
+	}
+	entry.Message = message
+	return entry, true
+}
@@ -1,9 +1,11 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -81,23 +83,139 @@ func GetCurrentBranch(repoRoot string) (string, error) {
 // WriteRef writes a reference file.
 func WriteRef(repoRoot, refPath, commitHash string) error {
 	fullPath := filepath.Join(repoRoot, VecDirName, refPath)
+	perms, err := LoadPermissions(repoRoot)
+	if err != nil {
+		return err
+	}
 
 	// Ensure the directory exists
-	if err := EnsureDirExists(filepath.Dir(fullPath)); err != nil {
+	if err := perms.MkdirAll(filepath.Dir(fullPath)); err != nil {
 		return RefError("failed to create reference directory", err)
 	}
 
+	audit := AuditEnabled(repoRoot)
+	var oldHash string
+	if audit {
+		oldHash, _ = ReadRefValue(repoRoot, refPath)
+	}
+
 	// Write the reference file
-	if err := os.WriteFile(fullPath, []byte(commitHash), 0644); err != nil {
+	if err := perms.WriteFile(fullPath, []byte(commitHash)); err != nil {
 		return RefError("failed to write reference file", err)
 	}
 
+	if audit {
+		recordRefAudit(repoRoot, refPath, oldHash, commitHash)
+	}
+	return nil
+}
+
+// ErrRefChanged is returned by UpdateRefCAS when the ref no longer holds the
+// expected value.
+var ErrRefChanged = errors.New("reference changed since it was last read")
+
+// ReadRefValue returns the commit hash stored in refPath, or "" if the ref does not exist.
+func ReadRefValue(repoRoot, refPath string) (string, error) {
+	fullPath := filepath.Join(repoRoot, VecDirName, refPath)
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", RefError(fmt.Sprintf("failed to read reference '%s'", refPath), err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// UpdateRefCAS sets refPath to newHash only if it currently holds expectedOld.
+// An empty expectedOld requires the ref to not exist yet, and an empty newHash
+// deletes the ref. The ref is locked with a <ref>.lock file for the duration
+// of the compare and swap, so concurrent updates of the same ref cannot
+// interleave.
+func UpdateRefCAS(repoRoot, refPath, expectedOld, newHash string) error {
+	fullPath := filepath.Join(repoRoot, VecDirName, refPath)
+	perms, err := LoadPermissions(repoRoot)
+	if err != nil {
+		return err
+	}
+	if err := perms.MkdirAll(filepath.Dir(fullPath)); err != nil {
+		return RefError("failed to create reference directory", err)
+	}
+
+	lockPath := fullPath + ".lock"
+	lock, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perms.File)
+	if err != nil {
+		if os.IsExist(err) {
+			return RefError(fmt.Sprintf("reference '%s' is locked by another update", refPath), err)
+		}
+		return RefError(fmt.Sprintf("failed to lock reference '%s'", refPath), err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			lock.Close()
+			os.Remove(lockPath)
+		}
+	}()
+
+	current, err := ReadRefValue(repoRoot, refPath)
+	if err != nil {
+		return err
+	}
+	if current != expectedOld {
+		return RefError(fmt.Sprintf("cannot update '%s': expected %s, found %s",
+			refPath, describeRefValue(expectedOld), describeRefValue(current)), ErrRefChanged)
+	}
+
+	if newHash == "" {
+		if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+			return RefError(fmt.Sprintf("failed to delete reference '%s'", refPath), err)
+		}
+		if AuditEnabled(repoRoot) {
+			recordRefAudit(repoRoot, refPath, current, "")
+		}
+		return nil
+	}
+
+	if _, err := lock.WriteString(newHash); err != nil {
+		return RefError("failed to write reference lock", err)
+	}
+	if err := lock.Close(); err != nil {
+		return RefError("failed to write reference lock", err)
+	}
+	if err := perms.Apply(lockPath, perms.File); err != nil {
+		return RefError("failed to write reference lock", err)
+	}
+	committed = true
+	if err := os.Rename(lockPath, fullPath); err != nil {
+		os.Remove(lockPath)
+		return RefError("failed to update reference file", err)
+	}
+	if AuditEnabled(repoRoot) {
+		recordRefAudit(repoRoot, refPath, current, newHash)
+	}
 	return nil
 }
 
+// describeRefValue renders a ref value for error messages.
+func describeRefValue(hash string) string {
+	if hash == "" {
+		return "no ref"
+	}
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
+
 // UpdateHEAD updates the HEAD file to point to a reference or commit hash.
 func UpdateHEAD(repoRoot, target string, isRef bool) error {
 	headPath := filepath.Join(repoRoot, VecDirName, HeadFile)
+	audit := AuditEnabled(repoRoot)
+	var oldHead string
+	if audit {
+		oldHead, _ = ReadHEADFile(repoRoot)
+	}
 	var content string
 
 	if isRef {
@@ -106,10 +224,17 @@ func UpdateHEAD(repoRoot, target string, isRef bool) error {
 		content = target
 	}
 
-	if err := os.WriteFile(headPath, []byte(content), 0644); err != nil {
+	perms, err := LoadPermissions(repoRoot)
+	if err != nil {
+		return err
+	}
+	if err := perms.WriteFile(headPath, []byte(content)); err != nil {
 		return RefError("failed to update HEAD", err)
 	}
 
+	if audit {
+		recordRefAudit(repoRoot, HeadFile, oldHead, content)
+	}
 	return nil
 }
 
@@ -144,6 +269,100 @@ func GetAllBranches(repoRoot string) ([]string, error) {
 	return branches, nil
 }
 
+// Ref is a reference and the object it points to
+type Ref struct {
+	Name string // Full name, e.g. refs/heads/main
+	Hash string // Object ID the ref holds
+}
+
+// ListRefs returns every ref whose full name starts with prefix ("refs/" for
+// all), sorted by name. Lock files of in-progress updates, and files holding
+// neither a hash nor a symbolic ref, are skipped.
+func ListRefs(repoRoot, prefix string) ([]Ref, error) {
+	vecDir := filepath.Join(repoRoot, VecDirName)
+	refsDir := filepath.Join(vecDir, "refs")
+	if !FileExists(refsDir) {
+		return nil, nil
+	}
+
+	var refs []Ref
+	err := filepath.Walk(refsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(vecDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		hash, err := ReadRefValue(repoRoot, rel)
+		if err != nil {
+			return err
+		}
+		if isRefValue(hash) {
+			refs = append(refs, Ref{Name: name, Hash: hash})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, RefError("failed to list references", err)
+	}
+
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	return refs, nil
+}
+
+// isRefValue reports whether value is what a ref file holds: an object hash
+// or a "ref: " symbolic ref
+func isRefValue(value string) bool {
+	return (len(value) == 64 && IsValidHex(value)) || strings.HasPrefix(value, "ref: ")
+}
+
+// Upstream is the remote branch a local branch tracks, as recorded by
+// branch.<name>.remote and branch.<name>.merge.
+type Upstream struct {
+	Remote string // Remote name, e.g. origin
+	Merge  string // Full ref on the remote, e.g. refs/heads/main
+}
+
+// Branch returns the remote branch name without the refs/heads/ prefix.
+func (u *Upstream) Branch() string {
+	return strings.TrimPrefix(u.Merge, "refs/heads/")
+}
+
+// TrackingRef returns the local remote-tracking ref for the upstream.
+func (u *Upstream) TrackingRef() string {
+	return fmt.Sprintf("refs/remotes/%s/%s", u.Remote, u.Branch())
+}
+
+// String returns the short <remote>/<branch> form.
+func (u *Upstream) String() string {
+	return u.Remote + "/" + u.Branch()
+}
+
+// GetBranchUpstream returns the upstream configured for branchName, or nil if
+// the branch does not track anything.
+func GetBranchUpstream(repoRoot, branchName string) (*Upstream, error) {
+	remoteName, err := GetConfigValue(repoRoot, fmt.Sprintf("branch.%s.remote", branchName))
+	if err != nil {
+		return nil, ConfigError("failed to read upstream remote", err)
+	}
+	mergeRef, err := GetConfigValue(repoRoot, fmt.Sprintf("branch.%s.merge", branchName))
+	if err != nil {
+		return nil, ConfigError("failed to read upstream branch", err)
+	}
+	if remoteName == "" || mergeRef == "" {
+		return nil, nil
+	}
+	return &Upstream{Remote: remoteName, Merge: mergeRef}, nil
+}
+
 // SetBranchUpstream sets the upstream branch for a local branch
 func SetBranchUpstream(repoRoot, branchName, remoteName string) error {
 	// Ensure the branch exists
@@ -170,3 +389,36 @@ func SetBranchUpstream(repoRoot, branchName, remoteName string) error {
 	// Write the updated config
 	return WriteConfig(configPath, config)
 }
+
+// descriptionEscaper stores multi-line branch descriptions on one config line
+var (
+	descriptionEscaper   = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+	descriptionUnescaper = strings.NewReplacer("\\\\", "\\", "\\n", "\n")
+)
+
+// GetBranchDescription returns branch.<name>.description, or "" if unset
+func GetBranchDescription(repoRoot, branchName string) (string, error) {
+	value, err := GetConfigValue(repoRoot, fmt.Sprintf("branch.%s.description", branchName))
+	if err != nil {
+		return "", ConfigError("failed to read branch description", err)
+	}
+	return descriptionUnescaper.Replace(value), nil
+}
+
+// SetBranchDescription stores the description of branchName; an empty
+// description removes it
+func SetBranchDescription(repoRoot, branchName, description string) error {
+	key := fmt.Sprintf("branch.%s.description", branchName)
+	description = strings.TrimSpace(description)
+	if description == "" {
+		config, err := ReadConfig(filepath.Join(repoRoot, VecDirName, "config"))
+		if err != nil {
+			return ConfigError("failed to read config", err)
+		}
+		if _, ok := config[key]; !ok {
+			return nil
+		}
+		return UnsetConfigValue(repoRoot, key, false)
+	}
+	return SetConfigValue(repoRoot, key, descriptionEscaper.Replace(description), false)
+}
@@ -4,6 +4,10 @@ import (
 	"path/filepath"
 )
 
+// BareKey is set in repositories without a working tree, such as those
+// `vec clone --bare` creates
+const BareKey = "core.bare"
+
 // Repository represents a Vec repository context
 type Repository struct {
 	// Root directory of the repository
@@ -38,6 +42,9 @@ func FindRepository() (*Repository, error) {
 		return nil, err
 	}
 
+	// Best effort: leftovers of crashed operations must not block opening
+	_, _ = SweepStaleTempFiles(root, StaleTempAge, false)
+
 	return NewRepository(root), nil
 }
 
@@ -66,6 +73,11 @@ func (r *Repository) UpdateHead(target string, isRef bool) error {
 	return UpdateHEAD(r.Root, target, isRef)
 }
 
+// IsBare reports whether the repository has no working tree
+func (r *Repository) IsBare() bool {
+	return configBool(r.Root, BareKey)
+}
+
 // GetConfig reads a configuration value
 func (r *Repository) GetConfig(key string) (string, error) {
 	return GetConfigValue(r.Root, key)
@@ -86,16 +98,41 @@ func (r *Repository) GetAllBranches() ([]string, error) {
 	return GetAllBranches(r.Root)
 }
 
+// ListRefs returns the refs whose full name starts with prefix
+func (r *Repository) ListRefs(prefix string) ([]Ref, error) {
+	return ListRefs(r.Root, prefix)
+}
+
 // SetBranchUpstream sets the upstream branch for a local branch
 func (r *Repository) SetBranchUpstream(branchName, remoteName string) error {
 	return SetBranchUpstream(r.Root, branchName, remoteName)
 }
 
+// GetBranchUpstream returns the upstream of a local branch, or nil if it has none
+func (r *Repository) GetBranchUpstream(branchName string) (*Upstream, error) {
+	return GetBranchUpstream(r.Root, branchName)
+}
+
+// GetBranchDescription returns the description of a local branch
+func (r *Repository) GetBranchDescription(branchName string) (string, error) {
+	return GetBranchDescription(r.Root, branchName)
+}
+
+// SetBranchDescription sets or, when empty, removes a branch description
+func (r *Repository) SetBranchDescription(branchName, description string) error {
+	return SetBranchDescription(r.Root, branchName, description)
+}
+
 // IsPathIgnored checks if a given path should be ignored
 func (r *Repository) IsPathIgnored(path string) (bool, error) {
 	return IsIgnored(r.Root, path)
 }
 
+// GetAttributes returns the attributes assigned to a path relative to the root
+func (r *Repository) GetAttributes(relPath string) (map[string]Attribute, error) {
+	return GetAttributes(r.Root, relPath)
+}
+
 // HashFile calculates the SHA-256 hash of a file
 func (r *Repository) HashFile(path string) (string, error) {
 	return HashFile(path)
@@ -105,3 +142,13 @@ func (r *Repository) HashFile(path string) (string, error) {
 func (r *Repository) WriteRef(refPath, commitHash string) error {
 	return WriteRef(r.Root, refPath, commitHash)
 }
+
+// ReadRefValue returns the commit hash stored in refPath, or "" if it does not exist
+func (r *Repository) ReadRefValue(refPath string) (string, error) {
+	return ReadRefValue(r.Root, refPath)
+}
+
+// UpdateRefCAS sets refPath to newHash only if it still holds expectedOld
+func (r *Repository) UpdateRefCAS(refPath, expectedOld, newHash string) error {
+	return UpdateRefCAS(r.Root, refPath, expectedOld, newHash)
+}
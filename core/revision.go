@@ -0,0 +1,175 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MinAbbrevLength is the shortest object ID prefix ResolveRevision accepts
+const MinAbbrevLength = 4
+
+// revisionRefPatterns are tried in order to turn a short name into a ref
+var revisionRefPatterns = []string{
+	"%s",
+	"refs/%s",
+	"refs/tags/%s",
+	"refs/heads/%s",
+	"refs/remotes/%s",
+}
+
+// ResolveRevision returns the object ID rev names: HEAD, a full object ID, a
+// ref name (tried as given, then under refs/, refs/tags/, refs/heads/ and
+// refs/remotes/), or an unambiguous object ID prefix of at least
+// MinAbbrevLength characters. A ref followed by @{<n>} or @{<date>} names
+// an earlier value of it from its reflog, see ResolveReflogRevision.
+func ResolveRevision(repoRoot, rev string) (string, error) {
+	if rev == "" {
+		return "", RefError("empty revision", nil)
+	}
+	if at := strings.LastIndex(rev, "@{"); at >= 0 && strings.HasSuffix(rev, "}") {
+		return ResolveReflogRevision(repoRoot, rev[:at], rev[at+2:len(rev)-1], time.Now())
+	}
+	if rev == HeadFile {
+		commit, err := ReadHEAD(repoRoot)
+		if err != nil {
+			return "", err
+		}
+		if commit == "" {
+			return "", RefError("HEAD does not point to a commit yet", nil)
+		}
+		return commit, nil
+	}
+
+	hexRev := IsValidHex(rev)
+	if hexRev && len(rev) == 64 && ObjectExists(repoRoot, strings.ToLower(rev)) {
+		return strings.ToLower(rev), nil
+	}
+
+	if !strings.Contains(rev, "..") {
+		for _, pattern := range revisionRefPatterns {
+			refPath := fmt.Sprintf(pattern, rev)
+			if refPath == HeadFile || !strings.HasPrefix(refPath, "refs/") {
+				continue
+			}
+			hash, err := ReadRefValue(repoRoot, refPath)
+			if err != nil {
+				return "", err
+			}
+			if hash != "" {
+				return hash, nil
+			}
+		}
+	}
+
+	if hexRev && len(rev) >= MinAbbrevLength {
+		return resolveObjectPrefix(repoRoot, strings.ToLower(rev))
+	}
+	return "", NotFoundError(ErrCategoryRef, fmt.Sprintf("revision '%s'", rev))
+}
+
+// reflogRef returns the ref whose reflog name@{...} reads: the current
+// branch for an empty name, HEAD, or the first ref name expands to
+func reflogRef(repoRoot, name string) (string, error) {
+	if name == "" {
+		head, err := ReadHEADFile(repoRoot)
+		if err != nil {
+			return "", err
+		}
+		branch, ok := strings.CutPrefix(head, "ref: ")
+		if !ok {
+			return HeadFile, nil // Detached
+		}
+		return strings.TrimSpace(branch), nil
+	}
+	if name == HeadFile {
+		return HeadFile, nil
+	}
+	for _, pattern := range revisionRefPatterns {
+		refPath := fmt.Sprintf(pattern, name)
+		if !strings.HasPrefix(refPath, "refs/") {
+			continue
+		}
+		if FileExists(filepath.Join(repoRoot, VecDirName, "logs", filepath.FromSlash(refPath))) {
+			return refPath, nil
+		}
+		if hash, err := ReadRefValue(repoRoot, refPath); err == nil && hash != "" {
+			return refPath, nil
+		}
+	}
+	return "", NotFoundError(ErrCategoryRef, fmt.Sprintf("ref '%s'", name))
+}
+
+// ResolveReflogRevision returns the value ref name had according to its
+// reflog: spec is a count of updates back, @{0} being the current value, or
+// a date such as "yesterday" or "2.days.ago" (see ParseApproxDate). A date
+// older than the whole reflog gives its oldest value, with a warning.
+func ResolveReflogRevision(repoRoot, name, spec string, now time.Time) (string, error) {
+	ref, err := reflogRef(repoRoot, name)
+	if err != nil {
+		return "", err
+	}
+	entries, err := ReadReflog(repoRoot, ref)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", NotFoundError(ErrCategoryRef, fmt.Sprintf("reflog of '%s'", ref))
+	}
+
+	if n, err := strconv.Atoi(spec); err == nil && n >= 0 {
+		if n >= len(entries) {
+			return "", RefError(fmt.Sprintf("log for '%s' only has %d entries", ref, len(entries)), nil)
+		}
+		return entries[len(entries)-1-n].New, nil
+	}
+
+	at, err := ParseApproxDate(spec, now)
+	if err != nil {
+		return "", RefError(fmt.Sprintf("invalid reflog selector '@{%s}'", spec), err)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Time.After(at) {
+			return entries[i].New, nil
+		}
+	}
+	oldest := entries[0]
+	fmt.Fprintf(os.Stderr, "warning: log for '%s' only goes back to %s\n", ref, oldest.Time.Format("Mon Jan 2 15:04:05 2006 -0700"))
+	if oldest.Old != "" {
+		return oldest.Old, nil
+	}
+	return oldest.New, nil
+}
+
+// resolveObjectPrefix finds the single loose object whose ID starts with prefix
+func resolveObjectPrefix(repoRoot, prefix string) (string, error) {
+	dir := filepath.Join(repoRoot, VecDirName, "objects", prefix[:2])
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", ObjectError("failed to read object directory", err)
+	}
+
+	var match string
+	for _, entry := range entries {
+		hash := prefix[:2] + entry.Name()
+		if !strings.HasPrefix(hash, prefix) {
+			continue
+		}
+		if match != "" {
+			return "", RefError(fmt.Sprintf("short object ID '%s' is ambiguous", prefix), nil)
+		}
+		match = hash
+	}
+	if match == "" {
+		return "", NotFoundError(ErrCategoryRef, fmt.Sprintf("revision '%s'", prefix))
+	}
+	return match, nil
+}
+
+// ResolveRevision returns the object ID rev names, see ResolveRevision
+func (r *Repository) ResolveRevision(rev string) (string, error) {
+	return ResolveRevision(r.Root, rev)
+}
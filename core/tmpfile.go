@@ -0,0 +1,148 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Temporary files of an operation live in .vec/tmp so a crash leaves them
+// where gc and the next repository open can find them.
+const (
+	TmpDirName = "tmp"
+
+	// StaleTempAge is how old a temporary file must be before it is swept.
+	// Running operations keep their files well below this age.
+	StaleTempAge = 24 * time.Hour
+)
+
+// Temporary files and directories of this process, removed on exit
+var (
+	liveTempPaths      = make(map[string]bool)
+	liveTempPathsMutex sync.Mutex
+)
+
+// TempDir returns the repository's directory for temporary files
+func (r *Repository) TempDir() string {
+	return filepath.Join(r.VecDir, TmpDirName)
+}
+
+// tempDirFor returns .vec/tmp of repoRoot, creating it, or the system
+// temporary directory when there is no repository
+func tempDirFor(repoRoot string) (string, error) {
+	if repoRoot == "" {
+		return os.TempDir(), nil
+	}
+	dir := NewRepository(repoRoot).TempDir()
+	if err := EnsureDirExists(dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// tempPattern names temporary files <prefix>-<pid>-<unix time>-<random> so
+// their owner and age are visible
+func tempPattern(prefix, suffix string) string {
+	return fmt.Sprintf("%s-%d-%d-*%s", prefix, os.Getpid(), time.Now().Unix(), suffix)
+}
+
+// CreateTempFile creates a temporary file in .vec/tmp of repoRoot (the system
+// temporary directory if repoRoot is empty) and registers it for removal at
+// exit. Callers still remove it with RemoveTempFile when done.
+func CreateTempFile(repoRoot, prefix, suffix string) (*os.File, error) {
+	dir, err := tempDirFor(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(dir, tempPattern(prefix, suffix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	registerTempPath(file.Name())
+	return file, nil
+}
+
+// CreateTempDir creates a temporary directory like CreateTempFile
+func CreateTempDir(repoRoot, prefix string) (string, error) {
+	dir, err := tempDirFor(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	path, err := os.MkdirTemp(dir, tempPattern(prefix, ""))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	registerTempPath(path)
+	return path, nil
+}
+
+// RemoveTempFile removes a file or directory from CreateTempFile or CreateTempDir
+func RemoveTempFile(path string) error {
+	liveTempPathsMutex.Lock()
+	delete(liveTempPaths, path)
+	liveTempPathsMutex.Unlock()
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("failed to remove temporary file: %w", err)
+	}
+	return nil
+}
+
+func registerTempPath(path string) {
+	liveTempPathsMutex.Lock()
+	liveTempPaths[path] = true
+	liveTempPathsMutex.Unlock()
+}
+
+// CleanupTempFiles removes every temporary file this process still holds. It
+// runs at exit and on interrupt.
+func CleanupTempFiles() {
+	liveTempPathsMutex.Lock()
+	defer liveTempPathsMutex.Unlock()
+	for path := range liveTempPaths {
+		os.RemoveAll(path)
+		delete(liveTempPaths, path)
+	}
+}
+
+// SweepStaleTempFiles removes entries of .vec/tmp last modified more than
+// maxAge ago, left behind by crashed operations. It returns how many were
+// removed; with dryRun nothing is deleted.
+func SweepStaleTempFiles(repoRoot string, maxAge time.Duration, dryRun bool) (int, error) {
+	dir := NewRepository(repoRoot).TempDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if isLiveTempPath(path) {
+			continue
+		}
+		if !dryRun {
+			if err := os.RemoveAll(path); err != nil {
+				return removed, fmt.Errorf("failed to remove stale temporary file %s: %w", entry.Name(), err)
+			}
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// isLiveTempPath reports whether path is held by this process
+func isLiveTempPath(path string) bool {
+	liveTempPathsMutex.Lock()
+	defer liveTempPathsMutex.Unlock()
+	return liveTempPaths[path]
+}
@@ -0,0 +1,210 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultBranchName is used for new repositories when init.defaultBranch is unset
+const DefaultBranchName = "main"
+
+// ConfigEntry is a configuration value and where it was read from
+type ConfigEntry struct {
+	Key   string
+	Value string
+	File  string
+	Line  int // 1-based line number in File
+}
+
+// Origin renders where the entry comes from as file:<path>:<line>
+func (e ConfigEntry) Origin() string {
+	return fmt.Sprintf("file:%s:%d", e.File, e.Line)
+}
+
+// ReadConfigEntries reads a config file like ReadConfig, keeping line numbers.
+// Entries are in file order; for repeated keys the last one is effective.
+func ReadConfigEntries(filePath string) ([]ConfigEntry, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+
+	var entries []ConfigEntry
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if ok && key != "" && value != "" {
+			entries = append(entries, ConfigEntry{Key: key, Value: value, File: filePath, Line: i + 1})
+		}
+	}
+	return entries, nil
+}
+
+// LookupConfigEntry finds key like GetConfigValue, local config first and
+// then global, and reports the file and line it came from. It returns nil
+// when the key is unset.
+func LookupConfigEntry(repoRoot, key string) (*ConfigEntry, error) {
+	paths := []string{filepath.Join(repoRoot, VecDirName, "config")}
+	if globalPath, err := GetGlobalConfigPath(); err == nil {
+		paths = append(paths, globalPath)
+	}
+	for _, path := range paths {
+		entries, err := ReadConfigEntries(path)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(entries) - 1; i >= 0; i-- {
+			if entries[i].Key == key {
+				return &entries[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Var is a runtime value resolved from the environment, configuration and
+// built-in defaults
+type Var struct {
+	Name   string
+	Value  string
+	Origin string // "env:<NAME>", a config file origin, or "default"
+}
+
+// resolveVar returns the first of the environment variables set, then the
+// first config key set, then fallback
+func resolveVar(repoRoot, name string, envs, keys []string, fallback string) (Var, error) {
+	for _, env := range envs {
+		if value := os.Getenv(env); value != "" {
+			return Var{Name: name, Value: value, Origin: "env:" + env}, nil
+		}
+	}
+	for _, key := range keys {
+		entry, err := LookupConfigEntry(repoRoot, key)
+		if err != nil {
+			return Var{}, ConfigError(fmt.Sprintf("failed to read %s", key), err)
+		}
+		if entry != nil {
+			return Var{Name: name, Value: entry.Value, Origin: entry.Origin()}, nil
+		}
+	}
+	return Var{Name: name, Value: fallback, Origin: "default"}, nil
+}
+
+// ResolveEditor returns the editor to launch: $VEC_EDITOR, core.editor,
+// $VISUAL, $EDITOR, then vim
+func ResolveEditor(repoRoot string) (Var, error) {
+	v, err := resolveVar(repoRoot, "VEC_EDITOR", []string{"VEC_EDITOR"}, []string{"core.editor"}, "")
+	if err != nil || v.Origin != "default" {
+		return v, err
+	}
+	return resolveVar(repoRoot, "VEC_EDITOR", []string{"VISUAL", "EDITOR"}, nil, "vim")
+}
+
+// ResolvePager returns the pager for long output: $VEC_PAGER, core.pager,
+// $PAGER, then less
+func ResolvePager(repoRoot string) (Var, error) {
+	v, err := resolveVar(repoRoot, "VEC_PAGER", []string{"VEC_PAGER"}, []string{"core.pager"}, "")
+	if err != nil || v.Origin != "default" {
+		return v, err
+	}
+	return resolveVar(repoRoot, "VEC_PAGER", []string{"PAGER"}, nil, "less")
+}
+
+// ResolveDefaultBranch returns the initial branch of new repositories:
+// init.defaultBranch or main
+func ResolveDefaultBranch(repoRoot string) (Var, error) {
+	return resolveVar(repoRoot, "VEC_DEFAULT_BRANCH", nil, []string{"init.defaultBranch"}, DefaultBranchName)
+}
+
+// Identity roles accepted by ResolveIdentity
+const (
+	IdentityAuthor    = "AUTHOR"
+	IdentityCommitter = "COMMITTER"
+)
+
+// ResolveIdentity returns the name and email for role: VEC_<role>_NAME and
+// VEC_<role>_EMAIL override user.name and user.email. The identity is an
+// error when either part stays unset.
+func ResolveIdentity(repoRoot, role string) (name, email Var, err error) {
+	name, err = resolveVar(repoRoot, "VEC_"+role+"_NAME", []string{"VEC_" + role + "_NAME"}, []string{"user.name"}, "")
+	if err != nil {
+		return name, email, err
+	}
+	email, err = resolveVar(repoRoot, "VEC_"+role+"_EMAIL", []string{"VEC_" + role + "_EMAIL"}, []string{"user.email"}, "")
+	if err != nil {
+		return name, email, err
+	}
+	if name.Value == "" {
+		return name, email, ConfigError(fmt.Sprintf("%s name not configured; set it with 'vec config user.name <n>'", strings.ToLower(role)), nil)
+	}
+	if email.Value == "" {
+		return name, email, ConfigError(fmt.Sprintf("%s email not configured; set it with 'vec config user.email <email>'", strings.ToLower(role)), nil)
+	}
+	return name, email, nil
+}
+
+// identVar renders an identity as VEC_<role>_IDENT: "Name <email> <unix> <+hhmm>"
+func identVar(repoRoot, role string) (Var, error) {
+	name, email, err := ResolveIdentity(repoRoot, role)
+	if err != nil {
+		return Var{}, err
+	}
+	now := time.Now()
+	origin := name.Origin
+	if email.Origin != name.Origin {
+		origin += ", " + email.Origin
+	}
+	return Var{
+		Name:   "VEC_" + role + "_IDENT",
+		Value:  fmt.Sprintf("%s <%s> %d %s", name.Value, email.Value, now.Unix(), now.Format("-0700")),
+		Origin: origin,
+	}, nil
+}
+
+// ListVars resolves every runtime variable reported by vec var, sorted by
+// name. Identities that aren't configured are left out.
+func ListVars(repoRoot string) ([]Var, error) {
+	var vars []Var
+	for _, role := range []string{IdentityAuthor, IdentityCommitter} {
+		if v, err := identVar(repoRoot, role); err == nil {
+			vars = append(vars, v)
+		}
+	}
+	for _, resolve := range []func(string) (Var, error){ResolveEditor, ResolvePager, ResolveDefaultBranch} {
+		v, err := resolve(repoRoot)
+		if err != nil {
+			return nil, err
+		}
+		vars = append(vars, v)
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	return vars, nil
+}
+
+// LookupVar resolves one runtime variable by name
+func LookupVar(repoRoot, name string) (Var, error) {
+	switch name {
+	case "VEC_AUTHOR_IDENT":
+		return identVar(repoRoot, IdentityAuthor)
+	case "VEC_COMMITTER_IDENT":
+		return identVar(repoRoot, IdentityCommitter)
+	case "VEC_EDITOR":
+		return ResolveEditor(repoRoot)
+	case "VEC_PAGER":
+		return ResolvePager(repoRoot)
+	case "VEC_DEFAULT_BRANCH":
+		return ResolveDefaultBranch(repoRoot)
+	}
+	return Var{}, NotFoundError(ErrCategoryConfig, fmt.Sprintf("variable '%s'", name))
+}
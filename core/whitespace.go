@@ -0,0 +1,193 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// WhitespaceKey lists the whitespace problems add, apply and diff --check
+// look for, as a comma-separated list of rules; "-rule" turns a default
+// rule off
+const WhitespaceKey = "core.whitespace"
+
+// WhitespaceRules is a set of whitespace problems to detect
+type WhitespaceRules uint
+
+const (
+	WhitespaceTrailingSpace  WhitespaceRules = 1 << iota // Spaces or tabs at the end of a line
+	WhitespaceSpaceBeforeTab                             // A space before a tab in the indentation
+	WhitespaceEOFNewline                                 // No newline at the end of the file
+
+	DefaultWhitespaceRules = WhitespaceTrailingSpace | WhitespaceSpaceBeforeTab | WhitespaceEOFNewline
+)
+
+// whitespaceRuleNames maps the names used in core.whitespace to rules
+var whitespaceRuleNames = []struct {
+	name string
+	rule WhitespaceRules
+}{
+	{"trailing-space", WhitespaceTrailingSpace},
+	{"space-before-tab", WhitespaceSpaceBeforeTab},
+	{"eof-newline", WhitespaceEOFNewline},
+}
+
+// Whitespace actions chosen with --whitespace on add and apply
+const (
+	WhitespaceNoWarn = "nowarn" // Don't check
+	WhitespaceWarn   = "warn"   // Report problems and go on
+	WhitespaceError  = "error"  // Report problems and refuse the operation
+	WhitespaceFix    = "fix"    // Correct problems while applying
+)
+
+// ParseWhitespaceAction validates a --whitespace value
+func ParseWhitespaceAction(action string) (string, error) {
+	switch action {
+	case WhitespaceNoWarn, WhitespaceWarn, WhitespaceError, WhitespaceFix:
+		return action, nil
+	}
+	return "", fmt.Errorf("unrecognized whitespace option '%s' (expected nowarn, warn, error or fix)", action)
+}
+
+// ParseWhitespaceRules parses a core.whitespace value. Named rules are added
+// to the defaults and "-rule" removes one.
+func ParseWhitespaceRules(value string) (WhitespaceRules, error) {
+	rules := DefaultWhitespaceRules
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		negate := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		found := false
+		for _, known := range whitespaceRuleNames {
+			if known.name == name {
+				if negate {
+					rules &^= known.rule
+				} else {
+					rules |= known.rule
+				}
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown %s rule '%s'", WhitespaceKey, name)
+		}
+	}
+	return rules, nil
+}
+
+// WhitespaceRulesFor returns the core.whitespace rules of repoRoot
+func WhitespaceRulesFor(repoRoot string) (WhitespaceRules, error) {
+	value, err := GetConfigValue(repoRoot, WhitespaceKey)
+	if err != nil {
+		return 0, ConfigError("failed to read "+WhitespaceKey, err)
+	}
+	rules, err := ParseWhitespaceRules(value)
+	if err != nil {
+		return 0, ConfigError(err.Error(), nil)
+	}
+	return rules, nil
+}
+
+// WhitespaceProblem is one rule a line breaks
+type WhitespaceProblem struct {
+	Line int    // 1-based line number
+	Rule string // Description, e.g. "trailing whitespace"
+	Text string // The offending line
+}
+
+func (p WhitespaceProblem) String() string {
+	return fmt.Sprintf("%d: %s.\n+%s", p.Line, p.Rule, p.Text)
+}
+
+// CheckWhitespaceLine returns the descriptions of the rules line (without
+// its newline) breaks
+func CheckWhitespaceLine(line string, rules WhitespaceRules) []string {
+	var problems []string
+	if rules&WhitespaceTrailingSpace != 0 && strings.TrimRight(line, " \t") != line {
+		problems = append(problems, "trailing whitespace")
+	}
+	if rules&WhitespaceSpaceBeforeTab != 0 {
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if strings.Contains(indent, " \t") {
+			problems = append(problems, "space before tab in indent")
+		}
+	}
+	return problems
+}
+
+// CheckWhitespace returns the problems of the lines of content for which
+// include returns true (every line when include is nil). A missing final
+// newline is reported on the last line.
+func CheckWhitespace(content []byte, rules WhitespaceRules, include func(line string) bool) []WhitespaceProblem {
+	if len(content) == 0 || bytes.IndexByte(content, 0) >= 0 {
+		return nil // Empty and binary files have no lines to check
+	}
+	lines := strings.Split(string(content), "\n")
+	missingNewline := lines[len(lines)-1] != ""
+	if !missingNewline {
+		lines = lines[:len(lines)-1]
+	}
+
+	var problems []WhitespaceProblem
+	for i, line := range lines {
+		if include != nil && !include(line) {
+			continue
+		}
+		for _, rule := range CheckWhitespaceLine(line, rules) {
+			problems = append(problems, WhitespaceProblem{Line: i + 1, Rule: rule, Text: line})
+		}
+		if i == len(lines)-1 && missingNewline && rules&WhitespaceEOFNewline != 0 {
+			problems = append(problems, WhitespaceProblem{Line: i + 1, Rule: "no newline at end of file", Text: line})
+		}
+	}
+	return problems
+}
+
+// FixWhitespaceLine corrects line (without its newline): trailing blanks are
+// removed and spaces directly before a tab in the indentation dropped
+func FixWhitespaceLine(line string, rules WhitespaceRules) string {
+	if rules&WhitespaceTrailingSpace != 0 {
+		line = strings.TrimRight(line, " \t")
+	}
+	if rules&WhitespaceSpaceBeforeTab != 0 {
+		body := strings.TrimLeft(line, " \t")
+		indent := line[:len(line)-len(body)]
+		for strings.Contains(indent, " \t") {
+			indent = strings.ReplaceAll(indent, " \t", "\t")
+		}
+		line = indent + body
+	}
+	return line
+}
+
+// NewLinesOnly returns a CheckWhitespace filter passing the lines that don't
+// occur in old, so problems already present in an earlier version are left
+// alone
+func NewLinesOnly(old []byte) func(line string) bool {
+	existing := make(map[string]bool)
+	for _, line := range strings.Split(string(old), "\n") {
+		existing[line] = true
+	}
+	return func(line string) bool {
+		return !existing[line]
+	}
+}
+
+// ReportWhitespace prints problems found in path and, for the error action,
+// returns an error describing how many there were
+func ReportWhitespace(path string, problems []WhitespaceProblem, action string) error {
+	if action == WhitespaceNoWarn || len(problems) == 0 {
+		return nil
+	}
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", path, p)
+	}
+	if action == WhitespaceError {
+		return fmt.Errorf("%d whitespace error(s) in '%s'", len(problems), path)
+	}
+	return nil
+}
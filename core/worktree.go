@@ -0,0 +1,222 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Linked worktrees are registered under .vec/worktrees/<id>/ of the main
+// repository. The admin directory records where the worktree is in its
+// "vecdir" file, the path of the worktree's .vec file, and holds a "locked"
+// file, containing the reason, while the worktree is locked. The worktree's
+// .vec is a file pointing back at the admin directory.
+const (
+	WorktreesDir       = "worktrees"
+	worktreeVecDirFile = "vecdir"
+	worktreeLockedFile = "locked"
+	worktreePointer    = "vecdir: "
+)
+
+// Worktree is a linked worktree registered in a repository
+type Worktree struct {
+	ID         string // Name of the admin directory
+	Path       string // Root of the worktree
+	Locked     bool
+	LockReason string
+	// Prunable says why the worktree's metadata is stale, "" when it isn't
+	Prunable string
+}
+
+// worktreeAdminDir returns the admin directory of worktree id
+func worktreeAdminDir(repoRoot, id string) string {
+	return filepath.Join(repoRoot, VecDirName, WorktreesDir, id)
+}
+
+// ListWorktrees returns the linked worktrees of repoRoot sorted by path
+func ListWorktrees(repoRoot string) ([]Worktree, error) {
+	entries, err := os.ReadDir(filepath.Join(repoRoot, VecDirName, WorktreesDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, FSError("failed to read worktrees directory", err)
+	}
+
+	var worktrees []Worktree
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		wt, err := readWorktree(repoRoot, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		worktrees = append(worktrees, wt)
+	}
+	sort.Slice(worktrees, func(i, j int) bool { return worktrees[i].Path < worktrees[j].Path })
+	return worktrees, nil
+}
+
+// readWorktree loads the admin directory of worktree id
+func readWorktree(repoRoot, id string) (Worktree, error) {
+	adminDir := worktreeAdminDir(repoRoot, id)
+	wt := Worktree{ID: id}
+
+	content, err := os.ReadFile(filepath.Join(adminDir, worktreeVecDirFile))
+	switch {
+	case os.IsNotExist(err):
+		wt.Prunable = "vecdir file does not exist"
+	case err != nil:
+		return wt, FSError(fmt.Sprintf("failed to read worktree '%s'", id), err)
+	default:
+		pointerPath := strings.TrimSpace(string(content))
+		wt.Path = filepath.Dir(pointerPath)
+		if pointerPath == "" {
+			wt.Prunable = "invalid vecdir file"
+		} else if !FileExists(pointerPath) {
+			wt.Prunable = "vecdir file points to non-existent location"
+		}
+	}
+
+	reason, err := os.ReadFile(filepath.Join(adminDir, worktreeLockedFile))
+	if err == nil {
+		wt.Locked = true
+		wt.LockReason = strings.TrimSpace(string(reason))
+	} else if !os.IsNotExist(err) {
+		return wt, FSError(fmt.Sprintf("failed to read lock of worktree '%s'", id), err)
+	}
+	return wt, nil
+}
+
+// FindWorktree returns the registered worktree at path
+func FindWorktree(repoRoot, path string) (Worktree, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Worktree{}, FSError(fmt.Sprintf("failed to resolve '%s'", path), err)
+	}
+	worktrees, err := ListWorktrees(repoRoot)
+	if err != nil {
+		return Worktree{}, err
+	}
+	for _, wt := range worktrees {
+		if wt.Path == abs || wt.ID == path {
+			return wt, nil
+		}
+	}
+	return Worktree{}, fmt.Errorf("'%s' is not a working tree", path)
+}
+
+// LockWorktree keeps the worktree from being pruned while its path is
+// missing, e.g. on removable media
+func LockWorktree(repoRoot string, wt Worktree, reason string) error {
+	if wt.Locked {
+		if wt.LockReason != "" {
+			return fmt.Errorf("'%s' is already locked, reason: %s", wt.Path, wt.LockReason)
+		}
+		return fmt.Errorf("'%s' is already locked", wt.Path)
+	}
+	lockPath := filepath.Join(worktreeAdminDir(repoRoot, wt.ID), worktreeLockedFile)
+	if err := os.WriteFile(lockPath, []byte(reason), 0644); err != nil {
+		return FSError(fmt.Sprintf("failed to lock '%s'", wt.Path), err)
+	}
+	return nil
+}
+
+// UnlockWorktree allows the worktree to be pruned again
+func UnlockWorktree(repoRoot string, wt Worktree) error {
+	if !wt.Locked {
+		return fmt.Errorf("'%s' is not locked", wt.Path)
+	}
+	if err := os.Remove(filepath.Join(worktreeAdminDir(repoRoot, wt.ID), worktreeLockedFile)); err != nil {
+		return FSError(fmt.Sprintf("failed to unlock '%s'", wt.Path), err)
+	}
+	return nil
+}
+
+// PruneWorktrees removes the metadata of unlocked worktrees whose directory
+// is gone and returns them; with dryRun nothing is removed
+func PruneWorktrees(repoRoot string, dryRun bool) ([]Worktree, error) {
+	worktrees, err := ListWorktrees(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	var pruned []Worktree
+	for _, wt := range worktrees {
+		if wt.Prunable == "" || wt.Locked {
+			continue
+		}
+		if !dryRun {
+			if err := os.RemoveAll(worktreeAdminDir(repoRoot, wt.ID)); err != nil {
+				return pruned, FSError(fmt.Sprintf("failed to prune worktree '%s'", wt.ID), err)
+			}
+		}
+		pruned = append(pruned, wt)
+	}
+	if !dryRun {
+		// Drop the worktrees directory once nothing is registered
+		_ = os.Remove(filepath.Join(repoRoot, VecDirName, WorktreesDir))
+	}
+	return pruned, nil
+}
+
+// RepairWorktrees reconnects worktrees with the repository after either was
+// moved. The .vec file of every registered worktree still in place is
+// pointed at this repository again, and each of paths, a worktree moved by
+// hand, has its new location recorded. It returns a description of each fix.
+func RepairWorktrees(repoRoot string, paths []string) ([]string, error) {
+	var repaired []string
+
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return repaired, FSError(fmt.Sprintf("failed to resolve '%s'", path), err)
+		}
+		pointerPath := filepath.Join(abs, VecDirName)
+		content, err := os.ReadFile(pointerPath)
+		if err != nil || !strings.HasPrefix(string(content), worktreePointer) {
+			return repaired, fmt.Errorf("'%s' is not a linked worktree: no %s file", path, VecDirName)
+		}
+		id := filepath.Base(strings.TrimSpace(strings.TrimPrefix(string(content), worktreePointer)))
+		adminDir := worktreeAdminDir(repoRoot, id)
+		if !FileExists(adminDir) {
+			return repaired, fmt.Errorf("'%s' is not registered in this repository", path)
+		}
+		vecDirPath := filepath.Join(adminDir, worktreeVecDirFile)
+		if recorded, _ := os.ReadFile(vecDirPath); strings.TrimSpace(string(recorded)) != pointerPath {
+			if err := os.WriteFile(vecDirPath, []byte(pointerPath+"\n"), 0644); err != nil {
+				return repaired, FSError(fmt.Sprintf("failed to update worktree '%s'", id), err)
+			}
+			repaired = append(repaired, fmt.Sprintf("%s: vecdir incorrect, now %s", id, pointerPath))
+		}
+	}
+
+	worktrees, err := ListWorktrees(repoRoot)
+	if err != nil {
+		return repaired, err
+	}
+	absRoot, err := filepath.Abs(repoRoot)
+	if err != nil {
+		return repaired, FSError("failed to resolve repository path", err)
+	}
+	for _, wt := range worktrees {
+		if wt.Prunable != "" {
+			continue
+		}
+		pointerPath := filepath.Join(wt.Path, VecDirName)
+		if info, err := os.Stat(pointerPath); err == nil && info.IsDir() {
+			continue // A repository of its own now; never clobber it
+		}
+		want := worktreePointer + worktreeAdminDir(absRoot, wt.ID) + "\n"
+		if content, _ := os.ReadFile(pointerPath); string(content) == want {
+			continue
+		}
+		if err := os.WriteFile(pointerPath, []byte(want), 0644); err != nil {
+			return repaired, FSError(fmt.Sprintf("failed to repair '%s'", pointerPath), err)
+		}
+		repaired = append(repaired, fmt.Sprintf("%s: %s file incorrect, now points to %s", wt.Path, VecDirName, worktreeAdminDir(absRoot, wt.ID)))
+	}
+	return repaired, nil
+}
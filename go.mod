@@ -10,6 +10,7 @@ require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/sergi/go-diff v1.3.1
-	github.com/spf13/pflag v1.0.6 // indirect
+	github.com/spf13/pflag v1.0.6
 	golang.org/x/sys v0.25.0 // indirect
+	golang.org/x/text v0.21.0
 )
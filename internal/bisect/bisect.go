@@ -0,0 +1,190 @@
+// Package bisect finds the commit that introduced a change by binary search
+// over the commits between a good and a bad one
+package bisect
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+)
+
+// State files below .vec
+const (
+	StartFile = "BISECT_START" // Branch, or commit on a detached HEAD, to return to
+	BadFile   = "BISECT_BAD"   // Commit marked bad
+	GoodFile  = "BISECT_GOOD"  // Commits marked good, one per line
+	SkipFile  = "BISECT_SKIP"  // Commits that can't be tested, one per line
+	LogFile   = "BISECT_LOG"   // Marks made so far
+)
+
+// State is a bisection in progress
+type State struct {
+	Start   string
+	Bad     string
+	Good    []string
+	Skipped []string
+}
+
+// InProgress reports whether a bisection is in progress
+func InProgress(repo *core.Repository) bool {
+	return core.FileExists(filepath.Join(repo.VecDir, StartFile))
+}
+
+// LoadState reads the bisection in progress
+func LoadState(repo *core.Repository) (*State, error) {
+	if !InProgress(repo) {
+		return nil, core.RepositoryError("not bisecting; start with vec bisect start", nil)
+	}
+	read := func(name string) (string, error) {
+		data, err := os.ReadFile(filepath.Join(repo.VecDir, name))
+		if os.IsNotExist(err) {
+			return "", nil
+		} else if err != nil {
+			return "", core.FSError("failed to read bisect state", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	state := &State{}
+	var err error
+	if state.Start, err = read(StartFile); err != nil {
+		return nil, err
+	}
+	if state.Bad, err = read(BadFile); err != nil {
+		return nil, err
+	}
+	for name, list := range map[string]*[]string{GoodFile: &state.Good, SkipFile: &state.Skipped} {
+		text, err := read(name)
+		if err != nil {
+			return nil, err
+		}
+		*list = strings.Fields(text)
+	}
+	return state, nil
+}
+
+// Save writes the state below .vec
+func (s *State) Save(repo *core.Repository) error {
+	perms, err := repo.Permissions()
+	if err != nil {
+		return err
+	}
+	files := map[string]string{
+		StartFile: s.Start + "\n",
+		BadFile:   s.Bad,
+		GoodFile:  strings.Join(s.Good, "\n"),
+		SkipFile:  strings.Join(s.Skipped, "\n"),
+	}
+	for name, content := range files {
+		if err := perms.WriteFile(filepath.Join(repo.VecDir, name), []byte(content)); err != nil {
+			return core.FSError("failed to write bisect state", err)
+		}
+	}
+	return nil
+}
+
+// AppendLog records a line, such as the command that marked a commit
+func AppendLog(repo *core.Repository, line string) error {
+	f, err := os.OpenFile(filepath.Join(repo.VecDir, LogFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return core.FSError("failed to write bisect log", err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		return core.FSError("failed to write bisect log", err)
+	}
+	return nil
+}
+
+// Remove deletes the bisect state
+func Remove(repo *core.Repository) error {
+	for _, name := range []string{StartFile, BadFile, GoodFile, SkipFile, LogFile} {
+		if err := os.Remove(filepath.Join(repo.VecDir, name)); err != nil && !os.IsNotExist(err) {
+			return core.FSError("failed to remove bisect state", err)
+		}
+	}
+	return nil
+}
+
+// Result is where a bisection stands
+type Result struct {
+	Next      string   // Commit to test next; empty when done or stuck
+	Remaining int      // Commits that may still be the first bad one, besides Next
+	FirstBad  string   // The first bad commit, once found
+	Suspects  []string // With only skipped commits left, those that may be the first bad one
+}
+
+// NextRepo works out the commit to test next: of the commits reachable from
+// the bad one but from no good one, the one splitting them most evenly
+// between its ancestors and the rest, leaving out skipped commits
+func NextRepo(repo *core.Repository, state *State) (*Result, error) {
+	if state.Bad == "" || len(state.Good) == 0 {
+		return &Result{}, nil
+	}
+	listed, err := objects.RevListRepo(repo, []string{state.Bad}, state.Good, objects.RevListOptions{})
+	if err != nil {
+		return nil, core.ObjectError("failed to list commits to bisect", err)
+	}
+	if len(listed) == 0 {
+		return nil, core.RepositoryError(fmt.Sprintf("the bad commit %s is an ancestor of a good one; were good and bad swapped?", state.Bad), nil)
+	}
+
+	candidates := make(map[string]*objects.Commit, len(listed))
+	for _, obj := range listed {
+		commit, err := objects.GetCommitRepo(repo, obj.Hash)
+		if err != nil {
+			return nil, core.ObjectError(fmt.Sprintf("failed to load commit %s", obj.Hash), err)
+		}
+		candidates[obj.Hash] = commit
+	}
+	if len(candidates) == 1 {
+		return &Result{FirstBad: state.Bad}, nil
+	}
+	skipped := make(map[string]bool, len(state.Skipped))
+	for _, hash := range state.Skipped {
+		skipped[hash] = true
+	}
+
+	// The bad commit is known bad, so it is never worth testing
+	best, bestScore := "", -1
+	for _, obj := range listed {
+		hash := obj.Hash
+		if hash == state.Bad || skipped[hash] {
+			continue
+		}
+		below := countAncestors(candidates, hash)
+		score := min(below, len(candidates)-below)
+		if score > bestScore {
+			best, bestScore = hash, score
+		}
+	}
+	if best == "" {
+		result := &Result{}
+		for _, obj := range listed {
+			result.Suspects = append(result.Suspects, obj.Hash)
+		}
+		return result, nil
+	}
+	return &Result{Next: best, Remaining: len(candidates) / 2}, nil
+}
+
+// countAncestors counts hash and its ancestors among candidates
+func countAncestors(candidates map[string]*objects.Commit, hash string) int {
+	seen := map[string]bool{hash: true}
+	stack := []string{hash}
+	for len(stack) > 0 {
+		commit := candidates[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+		for _, parent := range commit.Parents {
+			if _, ok := candidates[parent]; ok && !seen[parent] {
+				seen[parent] = true
+				stack = append(stack, parent)
+			}
+		}
+	}
+	return len(seen)
+}
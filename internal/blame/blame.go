@@ -0,0 +1,204 @@
+// Package blame attributes the lines of a file to the commits that last
+// changed them
+package blame
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Line is one line of a blamed file
+type Line struct {
+	Number     int             // 1-based line number in the blamed version
+	OrigNumber int             // Line number in the version of Commit
+	Commit     *objects.Commit // Commit that introduced the line
+	Text       string          // Without the line ending
+}
+
+// Options restrict a blame to the lines Start to End, 1-based and
+// inclusive; zero values mean the first and last line
+type Options struct {
+	Start, End int
+}
+
+// pending is a commit with lines still to attribute: their index in the
+// commit's version of the file, mapped to their index in the result
+type pending struct {
+	commit *objects.Commit
+	hash   string // Blob of the file in commit
+	lines  map[int]int
+}
+
+// BlameRepo attributes each line of path, as of commitID, to the commit
+// that introduced it. Lines unchanged from a parent are passed on to it,
+// trying parents in order, so a line a merge took from its second parent
+// is blamed on the commit that wrote it there. Renames aren't followed:
+// lines of a file missing from every parent are blamed on the commit that
+// added it.
+func BlameRepo(repo *core.Repository, commitID, path string, options Options) ([]Line, error) {
+	commit, err := objects.GetCommitRepo(repo, commitID)
+	if err != nil {
+		return nil, core.ObjectError(fmt.Sprintf("failed to load commit %s", commitID), err)
+	}
+	hash, err := fileHashRepo(repo, commit, path)
+	if err != nil {
+		return nil, err
+	}
+	if hash == "" {
+		return nil, core.NotFoundError(core.ErrCategoryObject, fmt.Sprintf("path '%s' in %s", path, commitID))
+	}
+	content, err := objects.GetBlobRepo(repo, hash)
+	if err != nil {
+		return nil, core.ObjectError("failed to read file", err)
+	}
+	texts := splitLines(string(content))
+
+	start, end := options.Start, options.End
+	if start == 0 {
+		start = 1
+	}
+	if end == 0 || end > len(texts) {
+		end = len(texts)
+	}
+	if len(texts) > 0 && (start < 1 || start > end) {
+		return nil, fmt.Errorf("invalid line range %d,%d: file has %d lines", options.Start, options.End, len(texts))
+	}
+
+	result := make([]Line, 0, end-start+1)
+	first := &pending{commit: commit, hash: hash, lines: make(map[int]int)}
+	for i := start - 1; i < end; i++ {
+		first.lines[i] = len(result)
+		result = append(result, Line{Number: i + 1, Text: strings.TrimSuffix(strings.TrimSuffix(texts[i], "\n"), "\r")})
+	}
+
+	queue := map[string]*pending{commit.CommitID: first}
+	contents := map[string][]string{hash: texts} // Split blobs by hash
+	linesOf := func(hash string) ([]string, error) {
+		if texts, ok := contents[hash]; ok {
+			return texts, nil
+		}
+		content, err := objects.GetBlobRepo(repo, hash)
+		if err != nil {
+			return nil, core.ObjectError("failed to read file", err)
+		}
+		contents[hash] = splitLines(string(content))
+		return contents[hash], nil
+	}
+
+	for len(queue) > 0 {
+		// Newest commit first, so a commit reached along several paths
+		// is handled once with all the lines passed to it
+		var current *pending
+		for _, p := range queue {
+			if current == nil || p.commit.CommitterTime().After(current.commit.CommitterTime()) {
+				current = p
+			}
+		}
+		delete(queue, current.commit.CommitID)
+
+		ours, err := linesOf(current.hash)
+		if err != nil {
+			return nil, err
+		}
+		for _, parentID := range current.commit.Parents {
+			if len(current.lines) == 0 {
+				break
+			}
+			parent, err := objects.GetCommitRepo(repo, parentID)
+			if err != nil {
+				return nil, core.ObjectError(fmt.Sprintf("failed to load commit %s", parentID), err)
+			}
+			parentHash, err := fileHashRepo(repo, parent, path)
+			if err != nil {
+				return nil, err
+			}
+			if parentHash == "" {
+				continue
+			}
+
+			var unchanged map[int]int // Our line index to the parent's
+			if parentHash != current.hash {
+				theirs, err := linesOf(parentHash)
+				if err != nil {
+					return nil, err
+				}
+				unchanged = matchLines(theirs, ours)
+			}
+			target := queue[parentID]
+			for ourIndex, resultIndex := range current.lines {
+				theirIndex, ok := ourIndex, true
+				if unchanged != nil {
+					theirIndex, ok = unchanged[ourIndex]
+				}
+				if !ok {
+					continue
+				}
+				if target == nil {
+					target = &pending{commit: parent, hash: parentHash, lines: make(map[int]int)}
+					queue[parentID] = target
+				}
+				target.lines[theirIndex] = resultIndex
+				delete(current.lines, ourIndex)
+			}
+		}
+
+		for ourIndex, resultIndex := range current.lines {
+			result[resultIndex].Commit = current.commit
+			result[resultIndex].OrigNumber = ourIndex + 1
+		}
+	}
+	return result, nil
+}
+
+// fileHashRepo returns the blob of path in commit, "" when it isn't a file there
+func fileHashRepo(repo *core.Repository, commit *objects.Commit, path string) (string, error) {
+	entry, err := objects.FindTreeEntryRepo(repo, commit.Tree, path)
+	if err != nil {
+		return "", core.ObjectError(fmt.Sprintf("failed to read tree of %s", commit.CommitID), err)
+	}
+	if entry == nil || entry.Type != "blob" {
+		return "", nil
+	}
+	return entry.Hash, nil
+}
+
+// splitLines splits content into lines, keeping their endings, the way the
+// line diff does
+func splitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// matchLines diffs theirs against ours by line and maps the index of each
+// of our lines left unchanged to its index in theirs
+func matchLines(theirs, ours []string) map[int]int {
+	dmp := diffmatchpatch.New()
+	a, b, _ := dmp.DiffLinesToChars(strings.Join(theirs, ""), strings.Join(ours, ""))
+	diffs := dmp.DiffMain(a, b, false)
+
+	matched := make(map[int]int)
+	theirIndex, ourIndex := 0, 0
+	for _, d := range diffs {
+		n := len([]rune(d.Text)) // One rune per line
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			for i := 0; i < n; i++ {
+				matched[ourIndex+i] = theirIndex + i
+			}
+			theirIndex += n
+			ourIndex += n
+		case diffmatchpatch.DiffDelete:
+			theirIndex += n
+		case diffmatchpatch.DiffInsert:
+			ourIndex += n
+		}
+	}
+	return matched
+}
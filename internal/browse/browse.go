@@ -0,0 +1,384 @@
+package browse
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/blame"
+	"github.com/NahomAnteneh/vec/internal/objects"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+// Commits per page of the log
+const defaultLogPage = 50
+
+// pageNames are the templates rendered inside templates/layout.html
+var pageNames = []string{"log", "commit", "tree", "blob", "blame"}
+
+// Server renders the history of a repository as HTML, reading straight
+// from its object store. It never writes to the repository.
+type Server struct {
+	repo  *core.Repository
+	pages map[string]*template.Template
+}
+
+// NewServer parses the embedded templates for browsing repo
+func NewServer(repo *core.Repository) (*Server, error) {
+	funcs := template.FuncMap{
+		"short": func(hash string) string {
+			if len(hash) > 10 {
+				return hash[:10]
+			}
+			return hash
+		},
+		"date": func(t time.Time) string { return objects.FormatDate(t, objects.DateISO) },
+		"ago":  func(t time.Time) string { return objects.FormatDate(t, objects.DateRelative) },
+		"add1": func(i int) int { return i + 1 },
+	}
+	s := &Server{repo: repo, pages: make(map[string]*template.Template)}
+	for _, name := range pageNames {
+		t, err := template.New(name).Funcs(funcs).ParseFS(templateFS, "templates/layout.html", "templates/"+name+".html")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+		}
+		s.pages[name] = t
+	}
+	return s, nil
+}
+
+// Handler returns the routes of the browser
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleLog)
+	mux.HandleFunc("GET /log", s.handleLog)
+	mux.HandleFunc("GET /commit/{hash}", s.handleCommit)
+	mux.HandleFunc("GET /tree/{rev}/{path...}", s.handleTree)
+	mux.HandleFunc("GET /blob/{rev}/{path...}", s.handleBlob)
+	mux.HandleFunc("GET /blame/{rev}/{path...}", s.handleBlame)
+	mux.HandleFunc("GET /raw/{rev}/{path...}", s.handleRaw)
+	return mux
+}
+
+// page holds what every page shows
+type page struct {
+	Title    string
+	RepoName string
+}
+
+func (s *Server) newPage(title string) page {
+	return page{Title: title, RepoName: filepath.Base(s.repo.Root)}
+}
+
+// render writes the page template name with data
+func (s *Server) render(w http.ResponseWriter, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.pages[name].ExecuteTemplate(w, "layout", data); err != nil {
+		log.Printf("browse: failed to render %s: %v", name, err)
+	}
+}
+
+// errNotFound marks errors answered with 404
+var errNotFound = errors.New("not found")
+
+// fail answers a request with the error
+func (s *Server) fail(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, errNotFound) {
+		status = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// resolveCommit returns the commit rev names
+func (s *Server) resolveCommit(rev string) (string, *objects.Commit, error) {
+	hash, err := s.repo.ResolveRevision(rev)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: revision '%s'", errNotFound, rev)
+	}
+	commit, err := objects.GetCommitRepo(s.repo, hash)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: '%s' is not a commit", errNotFound, rev)
+	}
+	return hash, commit, nil
+}
+
+// logEntry is one commit of the log
+type logEntry struct {
+	Hash   string
+	Commit *objects.Commit
+}
+
+// branchLink is a branch in the log navigation
+type branchLink struct {
+	Name    string
+	Hash    string
+	Current bool
+}
+
+// handleLog lists commits from ?rev= (HEAD by default) along first parents
+func (s *Server) handleLog(w http.ResponseWriter, r *http.Request) {
+	rev := r.URL.Query().Get("rev")
+	if rev == "" {
+		rev = core.HeadFile
+	}
+	limit := defaultLogPage
+	if n, err := strconv.Atoi(r.URL.Query().Get("n")); err == nil && n > 0 {
+		limit = n
+	}
+
+	data := struct {
+		page
+		Rev      string
+		Branches []branchLink
+		Commits  []logEntry
+		Next     string
+	}{page: s.newPage("Log"), Rev: rev}
+
+	refs, err := s.repo.ListRefs("refs/heads/")
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	head, _ := core.ReadHEADFile(s.repo.Root)
+	for _, ref := range refs {
+		data.Branches = append(data.Branches, branchLink{
+			Name:    strings.TrimPrefix(ref.Name, "refs/heads/"),
+			Hash:    ref.Hash,
+			Current: strings.TrimPrefix(head, "ref: ") == ref.Name,
+		})
+	}
+
+	hash, err := s.repo.ResolveRevision(rev)
+	if err != nil {
+		// A repository without commits still shows its page
+		s.render(w, "log", data)
+		return
+	}
+	for hash != "" && len(data.Commits) < limit {
+		commit, err := objects.GetCommitRepo(s.repo, hash)
+		if err != nil {
+			s.fail(w, fmt.Errorf("failed to read commit %s: %w", hash, err))
+			return
+		}
+		data.Commits = append(data.Commits, logEntry{hash, commit})
+		hash = ""
+		if len(commit.Parents) > 0 {
+			hash = commit.Parents[0]
+		}
+	}
+	data.Next = hash
+	s.render(w, "log", data)
+}
+
+// handleCommit shows a commit and its diff against its first parent
+func (s *Server) handleCommit(w http.ResponseWriter, r *http.Request) {
+	hash, commit, err := s.resolveCommit(r.PathValue("hash"))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	diffs, err := commitDiffRepo(s.repo, commit)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	s.render(w, "commit", struct {
+		page
+		Hash   string
+		Commit *objects.Commit
+		Files  []fileDiff
+	}{s.newPage(commit.Subject()), hash, commit, diffs})
+}
+
+// crumb is a link to a directory on the way to the shown path
+type crumb struct {
+	Name, Path string
+}
+
+func breadcrumbs(filePath string) []crumb {
+	var crumbs []crumb
+	current := ""
+	for _, name := range strings.Split(filePath, "/") {
+		if name == "" {
+			continue
+		}
+		current = path.Join(current, name)
+		crumbs = append(crumbs, crumb{name, current})
+	}
+	return crumbs
+}
+
+// treeItem is an entry of a directory listing
+type treeItem struct {
+	Name, Path string
+	Dir        bool
+	Submodule  bool
+	Hash       string
+}
+
+// resolvePath returns the commit rev names and the entry at filePath in it
+func (s *Server) resolvePath(rev, filePath string) (string, objects.TreeEntry, error) {
+	hash, commit, err := s.resolveCommit(rev)
+	if err != nil {
+		return "", objects.TreeEntry{}, err
+	}
+	entry, ok, err := entryAtRepo(s.repo, commit.Tree, filePath)
+	if err != nil {
+		return "", entry, err
+	}
+	if !ok {
+		return "", entry, fmt.Errorf("%w: '%s' in %s", errNotFound, filePath, rev)
+	}
+	return hash, entry, nil
+}
+
+// handleTree lists a directory of a commit
+func (s *Server) handleTree(w http.ResponseWriter, r *http.Request) {
+	filePath := strings.Trim(r.PathValue("path"), "/")
+	hash, entry, err := s.resolvePath(r.PathValue("rev"), filePath)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	if entry.Type != "tree" {
+		http.Redirect(w, r, "/blob/"+hash+"/"+filePath, http.StatusFound)
+		return
+	}
+	tree, err := objects.GetTreeRepo(s.repo, entry.Hash)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	items := make([]treeItem, 0, len(tree.Entries))
+	for _, child := range tree.Entries {
+		items = append(items, treeItem{
+			Name:      child.Name,
+			Path:      path.Join(filePath, child.Name),
+			Dir:       child.Type == "tree",
+			Submodule: child.IsGitlink(),
+			Hash:      child.Hash,
+		})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Dir != items[j].Dir {
+			return items[i].Dir
+		}
+		return items[i].Name < items[j].Name
+	})
+
+	title := filePath
+	if title == "" {
+		title = "Files"
+	}
+	s.render(w, "tree", struct {
+		page
+		Rev    string
+		Path   string
+		Crumbs []crumb
+		Items  []treeItem
+	}{s.newPage(title), hash, filePath, breadcrumbs(filePath), items})
+}
+
+// readBlob returns the content of the file at filePath in rev
+func (s *Server) readBlob(rev, filePath string) (string, []byte, error) {
+	hash, entry, err := s.resolvePath(rev, filePath)
+	if err != nil {
+		return "", nil, err
+	}
+	if entry.Type != "blob" || entry.IsGitlink() {
+		return "", nil, fmt.Errorf("%w: '%s' is not a file", errNotFound, filePath)
+	}
+	content, err := objects.GetBlobRepo(s.repo, entry.Hash)
+	if err != nil {
+		return "", nil, err
+	}
+	return hash, content, nil
+}
+
+// handleBlob shows a file of a commit with line numbers
+func (s *Server) handleBlob(w http.ResponseWriter, r *http.Request) {
+	filePath := strings.Trim(r.PathValue("path"), "/")
+	hash, content, err := s.readBlob(r.PathValue("rev"), filePath)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	binary := isBinary(content) || len(content) > maxRenderSize
+	var lines []string
+	if !binary {
+		lines = splitLines(content)
+	}
+	s.render(w, "blob", struct {
+		page
+		Rev    string
+		Path   string
+		Crumbs []crumb
+		Size   int
+		Binary bool
+		Lines  []string
+	}{s.newPage(filePath), hash, filePath, breadcrumbs(filePath), len(content), binary, lines})
+}
+
+// handleBlame shows which commit last changed each line of a file
+func (s *Server) handleBlame(w http.ResponseWriter, r *http.Request) {
+	filePath := strings.Trim(r.PathValue("path"), "/")
+	hash, content, err := s.readBlob(r.PathValue("rev"), filePath)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	if len(content) > maxRenderSize || isBinary(content) {
+		s.fail(w, fmt.Errorf("'%s' is binary or too large to blame", filePath))
+		return
+	}
+	blamed, err := blame.BlameRepo(s.repo, hash, filePath, blame.Options{})
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	lines := make([]blameLine, len(blamed))
+	for i, line := range blamed {
+		lines[i] = blameLine{No: line.Number, Text: line.Text, Commit: line.Commit}
+		if line.Commit != nil {
+			lines[i].Hash = line.Commit.CommitID
+		}
+		lines[i].First = i == 0 || lines[i].Hash != lines[i-1].Hash
+	}
+	s.render(w, "blame", struct {
+		page
+		Rev    string
+		Path   string
+		Crumbs []crumb
+		Lines  []blameLine
+	}{s.newPage("Blame " + filePath), hash, filePath, breadcrumbs(filePath), lines})
+}
+
+// handleRaw serves the content of a file as is
+func (s *Server) handleRaw(w http.ResponseWriter, r *http.Request) {
+	_, content, err := s.readBlob(r.PathValue("rev"), strings.Trim(r.PathValue("path"), "/"))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	contentType := "application/octet-stream"
+	if !isBinary(content) {
+		contentType = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(content)
+}
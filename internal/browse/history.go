@@ -0,0 +1,259 @@
+package browse
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Files larger than this are not diffed or blamed
+const maxRenderSize = 512 << 10
+
+// Unchanged lines shown around each change of a diff
+const diffContext = 3
+
+// fileEntry is a file of a flattened tree
+type fileEntry struct {
+	hash string
+	mode int32
+}
+
+// flattenTreeRepo returns the files below treeID by slash-separated path
+func flattenTreeRepo(repo *core.Repository, treeID, prefix string, files map[string]fileEntry) error {
+	tree, err := objects.GetTreeRepo(repo, treeID)
+	if err != nil {
+		return fmt.Errorf("failed to read tree %s: %w", treeID, err)
+	}
+	for _, entry := range tree.Entries {
+		entryPath := path.Join(prefix, entry.Name)
+		if entry.Type == "tree" {
+			if err := flattenTreeRepo(repo, entry.Hash, entryPath, files); err != nil {
+				return err
+			}
+			continue
+		}
+		files[entryPath] = fileEntry{entry.Hash, entry.Mode}
+	}
+	return nil
+}
+
+// entryAtRepo returns the tree entry at filePath below treeID; the root
+// tree itself for an empty path
+func entryAtRepo(repo *core.Repository, treeID, filePath string) (objects.TreeEntry, bool, error) {
+	entry := objects.TreeEntry{Hash: treeID, Type: "tree", Mode: objects.ModeTree}
+	for _, name := range strings.Split(strings.Trim(filePath, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		if entry.Type != "tree" {
+			return entry, false, nil
+		}
+		tree, err := objects.GetTreeRepo(repo, entry.Hash)
+		if err != nil {
+			return entry, false, fmt.Errorf("failed to read tree %s: %w", entry.Hash, err)
+		}
+		found := false
+		for _, child := range tree.Entries {
+			if child.Name == name {
+				entry, found = child, true
+				break
+			}
+		}
+		if !found {
+			return entry, false, nil
+		}
+	}
+	return entry, true, nil
+}
+
+// fileAtRepo returns the blob hash of filePath in commit, "" if it has none
+func fileAtRepo(repo *core.Repository, commit *objects.Commit, filePath string) (string, error) {
+	entry, ok, err := entryAtRepo(repo, commit.Tree, filePath)
+	if err != nil || !ok || entry.Type != "blob" {
+		return "", err
+	}
+	return entry.Hash, nil
+}
+
+// isBinary reports whether content looks like binary data
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0
+}
+
+// splitLines splits content into lines without their newlines
+func splitLines(content []byte) []string {
+	text := strings.TrimSuffix(string(content), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// lineDiff returns the line-level diff of a and b, each distinct line
+// diffed as one rune
+func lineDiff(a, b []string) []diffmatchpatch.Diff {
+	ids := make(map[string]rune)
+	encode := func(lines []string) []rune {
+		runes := make([]rune, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = rune(len(ids) + 1)
+				if id >= 0xD800 {
+					id += 0x800 // Skip the surrogates, which aren't valid runes
+				}
+				ids[line] = id
+			}
+			runes[i] = id
+		}
+		return runes
+	}
+	return diffmatchpatch.New().DiffMainRunes(encode(a), encode(b), false)
+}
+
+// diffLine is one line of a rendered diff
+type diffLine struct {
+	Kind         string // "add", "del", "ctx", or "gap" between hunks
+	OldNo, NewNo int    // One-based; zero where the side has no line
+	Text         string
+}
+
+// fileDiff is the change to one file in a commit
+type fileDiff struct {
+	Path    string
+	Status  string // "added", "deleted" or "modified"
+	Binary  bool   // Or too large; no lines are rendered
+	Lines   []diffLine
+	Added   int
+	Deleted int
+}
+
+// renderDiff lists the lines of the diff from oldLines to newLines, keeping
+// diffContext unchanged lines around each change
+func renderDiff(oldLines, newLines []string) (lines []diffLine, added, deleted int) {
+	var all []diffLine
+	oldNo, newNo := 1, 1
+	for _, diff := range lineDiff(oldLines, newLines) {
+		count := utf8.RuneCountInString(diff.Text)
+		for k := 0; k < count; k++ {
+			switch diff.Type {
+			case diffmatchpatch.DiffEqual:
+				all = append(all, diffLine{"ctx", oldNo, newNo, oldLines[oldNo-1]})
+				oldNo++
+				newNo++
+			case diffmatchpatch.DiffDelete:
+				all = append(all, diffLine{"del", oldNo, 0, oldLines[oldNo-1]})
+				oldNo++
+				deleted++
+			case diffmatchpatch.DiffInsert:
+				all = append(all, diffLine{"add", 0, newNo, newLines[newNo-1]})
+				newNo++
+				added++
+			}
+		}
+	}
+
+	// Keep the unchanged lines near a change
+	keep := make([]bool, len(all))
+	for i, line := range all {
+		if line.Kind == "ctx" {
+			continue
+		}
+		for j := max(0, i-diffContext); j <= min(len(all)-1, i+diffContext); j++ {
+			keep[j] = true
+		}
+	}
+	for i, line := range all {
+		if !keep[i] {
+			continue
+		}
+		if i > 0 && !keep[i-1] && len(lines) > 0 {
+			lines = append(lines, diffLine{Kind: "gap"})
+		}
+		lines = append(lines, line)
+	}
+	return lines, added, deleted
+}
+
+// commitDiffRepo returns the changes commit made to its first parent, or
+// to nothing for a root commit, ordered by path
+func commitDiffRepo(repo *core.Repository, commit *objects.Commit) ([]fileDiff, error) {
+	oldFiles, newFiles := make(map[string]fileEntry), make(map[string]fileEntry)
+	if len(commit.Parents) > 0 {
+		parent, err := objects.GetCommitRepo(repo, commit.Parents[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read parent %s: %w", commit.Parents[0], err)
+		}
+		if err := flattenTreeRepo(repo, parent.Tree, "", oldFiles); err != nil {
+			return nil, err
+		}
+	}
+	if err := flattenTreeRepo(repo, commit.Tree, "", newFiles); err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]bool)
+	for p, entry := range newFiles {
+		if oldFiles[p] != entry {
+			paths[p] = true
+		}
+	}
+	for p := range oldFiles {
+		if _, ok := newFiles[p]; !ok {
+			paths[p] = true
+		}
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	diffs := make([]fileDiff, 0, len(sorted))
+	for _, p := range sorted {
+		oldEntry, hadOld := oldFiles[p]
+		newEntry, hasNew := newFiles[p]
+		d := fileDiff{Path: p, Status: "modified"}
+		if !hadOld {
+			d.Status = "added"
+		} else if !hasNew {
+			d.Status = "deleted"
+		}
+
+		var oldContent, newContent []byte
+		var err error
+		if hadOld && oldEntry.mode != objects.ModeGitlink {
+			if oldContent, err = objects.GetBlobRepo(repo, oldEntry.hash); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", p, err)
+			}
+		}
+		if hasNew && newEntry.mode != objects.ModeGitlink {
+			if newContent, err = objects.GetBlobRepo(repo, newEntry.hash); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", p, err)
+			}
+		}
+		if len(oldContent)+len(newContent) > maxRenderSize || isBinary(oldContent) || isBinary(newContent) {
+			d.Binary = true
+		} else {
+			d.Lines, d.Added, d.Deleted = renderDiff(splitLines(oldContent), splitLines(newContent))
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs, nil
+}
+
+// blameLine is a line of blame.BlameRepo's result as the blame page shows it
+type blameLine struct {
+	No     int
+	Text   string
+	Commit *objects.Commit
+	Hash   string
+	First  bool // The first of a run of lines from the same commit
+}
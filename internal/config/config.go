@@ -13,8 +13,11 @@ import (
 // Remote represents a remote repository entry.
 type Remote struct {
 	URL          string
+	PushURL      string // Optional separate URL for pushing (pushurl)
 	Fetch        string
 	Auth         string            // JWT token or other authentication info
+	AuthURL      string            // OAuth2 authorization server for vec auth login (authurl)
+	AuthClientID string            // OAuth2 client ID sent to AuthURL (authclientid)
 	ExtraHeaders map[string]string // Additional HTTP headers
 }
 
@@ -99,10 +102,16 @@ func LoadConfigRepo(repo *core.Repository) (*Config, error) {
 			switch key {
 			case "url":
 				remote.URL = value
+			case "pushurl":
+				remote.PushURL = value
 			case "fetch":
 				remote.Fetch = value
 			case "auth":
 				remote.Auth = value
+			case "authurl":
+				remote.AuthURL = value
+			case "authclientid":
+				remote.AuthClientID = value
 			}
 			// Handle custom headers with the prefix "header."
 			if strings.HasPrefix(key, "header.") {
@@ -124,6 +133,15 @@ func LoadConfigRepo(repo *core.Repository) (*Config, error) {
 func (c *Config) Write() error {
 	// No need for a repository instance in this case, as we already have the path
 	// The path is set during config creation either via NewConfig or NewConfigRepo
+	repoRoot := filepath.Dir(filepath.Dir(c.path))
+	var previous map[string]string
+	wasAudited := core.AuditEnabled(repoRoot)
+	if wasAudited {
+		if old, err := LoadConfig(repoRoot); err == nil {
+			previous = old.values()
+		}
+	}
+
 	var buf strings.Builder
 	for section, keys := range c.Settings {
 		buf.WriteString(fmt.Sprintf("[%s]\n", section))
@@ -134,10 +152,19 @@ func (c *Config) Write() error {
 	for name, remote := range c.Remotes {
 		buf.WriteString(fmt.Sprintf("[remote \"%s\"]\n", name))
 		buf.WriteString(fmt.Sprintf("    url = %s\n", remote.URL))
+		if remote.PushURL != "" {
+			buf.WriteString(fmt.Sprintf("    pushurl = %s\n", remote.PushURL))
+		}
 		buf.WriteString(fmt.Sprintf("    fetch = %s\n", remote.Fetch))
 		if remote.Auth != "" {
 			buf.WriteString(fmt.Sprintf("    auth = %s\n", remote.Auth))
 		}
+		if remote.AuthURL != "" {
+			buf.WriteString(fmt.Sprintf("    authurl = %s\n", remote.AuthURL))
+		}
+		if remote.AuthClientID != "" {
+			buf.WriteString(fmt.Sprintf("    authclientid = %s\n", remote.AuthClientID))
+		}
 		// Write any extra headers
 		for headerName, headerValue := range remote.ExtraHeaders {
 			buf.WriteString(fmt.Sprintf("    header.%s = %s\n", headerName, headerValue))
@@ -149,17 +176,66 @@ func (c *Config) Write() error {
 	if err := os.WriteFile(c.path, []byte(buf.String()), 0644); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
+
+	current := c.values()
+	for key, value := range current {
+		core.RecordConfigAudit(repoRoot, key, previous[key], value, wasAudited)
+	}
+	for key, value := range previous {
+		if _, ok := current[key]; !ok {
+			core.RecordConfigAudit(repoRoot, key, value, "", wasAudited)
+		}
+	}
 	return nil
 }
 
-// GetRemoteURL retrieves the URL for the specified remote.
+// values returns every setting as a section.key to value map, with remote
+// settings under remote.<name>.<key>
+func (c *Config) values() map[string]string {
+	values := make(map[string]string)
+	for section, keys := range c.Settings {
+		for key, value := range keys {
+			values[section+"."+key] = value
+		}
+	}
+	for name, remote := range c.Remotes {
+		prefix := "remote." + name + "."
+		for key, value := range map[string]string{"url": remote.URL, "pushurl": remote.PushURL, "fetch": remote.Fetch, "auth": remote.Auth,
+			"authurl": remote.AuthURL, "authclientid": remote.AuthClientID} {
+			if value != "" {
+				values[prefix+key] = value
+			}
+		}
+		for headerName, headerValue := range remote.ExtraHeaders {
+			values[prefix+"header."+headerName] = headerValue
+		}
+	}
+	return values
+}
+
+// GetRemoteURL retrieves the URL for the specified remote, with insteadOf
+// rewriting applied.
 func (c *Config) GetRemoteURL(name string) (string, error) {
 	if remote, exists := c.Remotes[name]; exists {
-		return remote.URL, nil
+		return c.RewriteURL(remote.URL), nil
 	}
 	return "", fmt.Errorf("remote '%s' not found", name)
 }
 
+// GetRemotePushURL retrieves the URL pushes to the specified remote go to. An
+// explicit pushurl wins and is only subject to insteadOf; otherwise the remote
+// URL is rewritten with pushInsteadOf, falling back to insteadOf.
+func (c *Config) GetRemotePushURL(name string) (string, error) {
+	remote, exists := c.Remotes[name]
+	if !exists {
+		return "", fmt.Errorf("remote '%s' not found", name)
+	}
+	if remote.PushURL != "" {
+		return c.RewriteURL(remote.PushURL), nil
+	}
+	return c.RewritePushURL(remote.URL), nil
+}
+
 // AddRemote adds or updates a remote with the provided URL and a default fetch refspec.
 func (c *Config) AddRemote(name, url string) error {
 	if name == "" || url == "" {
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// urlRewrite is one url.<base>.insteadOf or url.<base>.pushInsteadOf rule:
+// URLs starting with prefix are rewritten to start with base instead.
+type urlRewrite struct {
+	base   string
+	prefix string
+	push   bool
+}
+
+// urlRewrites collects the rewrite rules from [url "<base>"] sections of the
+// repository config followed by flat url.<base>.insteadOf keys of the global
+// config, so that on equal prefixes the repository rule wins.
+func (c *Config) urlRewrites() []urlRewrite {
+	var rules []urlRewrite
+	for section, keys := range c.Settings {
+		if !strings.HasPrefix(section, "url \"") {
+			continue
+		}
+		base := strings.Trim(strings.TrimPrefix(section, "url"), " \"")
+		for key, value := range keys {
+			rules = appendURLRewrite(rules, base, key, value)
+		}
+	}
+
+	global, err := core.ReadGlobalConfig()
+	if err != nil {
+		return rules
+	}
+	for key, value := range global {
+		rest, ok := strings.CutPrefix(key, "url.")
+		if !ok {
+			continue
+		}
+		dot := strings.LastIndex(rest, ".")
+		if dot <= 0 {
+			continue
+		}
+		rules = appendURLRewrite(rules, rest[:dot], rest[dot+1:], value)
+	}
+	return rules
+}
+
+// appendURLRewrite adds a rule for key = value if key is insteadOf or pushInsteadOf
+func appendURLRewrite(rules []urlRewrite, base, key, value string) []urlRewrite {
+	if value == "" {
+		return rules
+	}
+	switch strings.ToLower(key) {
+	case "insteadof":
+		return append(rules, urlRewrite{base: base, prefix: value})
+	case "pushinsteadof":
+		return append(rules, urlRewrite{base: base, prefix: value, push: true})
+	}
+	return rules
+}
+
+// rewriteURL applies the rule of the requested kind with the longest matching
+// prefix. ok is false if no rule matched.
+func rewriteURL(rules []urlRewrite, url string, push bool) (string, bool) {
+	var best *urlRewrite
+	for i := range rules {
+		rule := &rules[i]
+		if rule.push != push || !strings.HasPrefix(url, rule.prefix) {
+			continue
+		}
+		if best == nil || len(rule.prefix) > len(best.prefix) {
+			best = rule
+		}
+	}
+	if best == nil {
+		return url, false
+	}
+	return best.base + strings.TrimPrefix(url, best.prefix), true
+}
+
+// RewriteURL returns url after applying url.<base>.insteadOf rules.
+func (c *Config) RewriteURL(url string) string {
+	rewritten, _ := rewriteURL(c.urlRewrites(), url, false)
+	return rewritten
+}
+
+// RewritePushURL returns url as used for pushing: pushInsteadOf rules take
+// precedence, with insteadOf rules applying when none matches.
+func (c *Config) RewritePushURL(url string) string {
+	rules := c.urlRewrites()
+	if rewritten, ok := rewriteURL(rules, url, true); ok {
+		return rewritten
+	}
+	rewritten, _ := rewriteURL(rules, url, false)
+	return rewritten
+}
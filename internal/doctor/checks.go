@@ -0,0 +1,283 @@
+package doctor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/config"
+	"github.com/NahomAnteneh/vec/internal/rebase"
+	vechttp "github.com/NahomAnteneh/vec/internal/remote/http"
+	"github.com/NahomAnteneh/vec/internal/staging"
+)
+
+// Locks younger than this may belong to a command still running
+const staleLockAge = 10 * time.Minute
+
+// LooseObjectsKey sets how many loose objects are too many; 0 disables the check
+const LooseObjectsKey = "gc.auto"
+
+// defaultLooseObjectLimit applies when gc.auto isn't set
+const defaultLooseObjectLimit = 6700
+
+// checkLocksRepo reports lock files under .vec old enough that nothing
+// holds them any more. Until removed they make updates of the file they
+// lock fail.
+func checkLocksRepo(repo *core.Repository) ([]Finding, error) {
+	var findings []Finding
+	now := time.Now()
+	err := filepath.WalkDir(repo.VecDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || now.Sub(info.ModTime()) < staleLockAge {
+			return nil
+		}
+		rel, _ := filepath.Rel(repo.Root, path)
+		findings = append(findings, Finding{
+			Problem: fmt.Sprintf("%s was left behind %s ago", rel, now.Sub(info.ModTime()).Round(time.Minute)),
+			Fix:     fmt.Sprintf("rm %s  # once no other vec command is running", rel),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, core.FSError("failed to scan for lock files", err)
+	}
+	return findings, nil
+}
+
+// checkIndexRepo reports a HEAD naming a missing commit, index entries
+// whose objects are missing, and conflicts left in the index with no
+// rebase in progress to resolve them for
+func checkIndexRepo(repo *core.Repository) ([]Finding, error) {
+	var findings []Finding
+	head, err := repo.ReadHead()
+	if err != nil {
+		findings = append(findings, Finding{Problem: fmt.Sprintf("HEAD can't be read: %v", err), Fix: "vec undo"})
+	} else if head != "" && !core.ObjectExists(repo.Root, head) {
+		findings = append(findings, Finding{Problem: fmt.Sprintf("HEAD points at missing commit %s", head), Fix: "vec undo"})
+	}
+
+	index, err := staging.LoadIndex(repo)
+	if err != nil {
+		return append(findings, Finding{Problem: fmt.Sprintf("the index can't be read: %v", err), Fix: "rm .vec/index && vec add ."}), nil
+	}
+	conflicted := make(map[string]bool)
+	for _, entry := range index.Entries {
+		if entry.Stage > 0 {
+			conflicted[entry.FilePath] = true
+			continue
+		}
+		if !core.ObjectExists(repo.Root, entry.SHA256) {
+			findings = append(findings, Finding{
+				Problem: fmt.Sprintf("the index entry for %s names missing object %s", entry.FilePath, entry.SHA256),
+				Fix:     "vec add " + entry.FilePath,
+			})
+		}
+	}
+	if len(conflicted) > 0 && !rebase.InProgress(repo) {
+		paths := make([]string, 0, len(conflicted))
+		for path := range conflicted {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		findings = append(findings, Finding{
+			Problem: fmt.Sprintf("unresolved conflicts in %s", strings.Join(paths, ", ")),
+			Fix:     "resolve them, then vec add " + strings.Join(paths, " "),
+		})
+	}
+	return findings, nil
+}
+
+// checkUpstreamsRepo reports branches that track nothing although a remote
+// has a branch of the same name, and branches tracking a remote that no
+// longer exists
+func checkUpstreamsRepo(repo *core.Repository) ([]Finding, error) {
+	cfg, err := config.LoadConfigRepo(repo)
+	if err != nil {
+		return nil, core.ConfigError("failed to load config", err)
+	}
+	branches, err := repo.ListRefs("refs/heads/")
+	if err != nil {
+		return nil, err
+	}
+	remotes := make([]string, 0, len(cfg.Remotes))
+	for name := range cfg.Remotes {
+		remotes = append(remotes, name)
+	}
+	sort.Strings(remotes)
+
+	var findings []Finding
+	for _, ref := range branches {
+		branch := strings.TrimPrefix(ref.Name, "refs/heads/")
+		upstream, err := repo.GetBranchUpstream(branch)
+		if err != nil {
+			return nil, err
+		}
+		if upstream != nil {
+			if _, ok := cfg.Remotes[upstream.Remote]; !ok {
+				findings = append(findings, Finding{
+					Problem: fmt.Sprintf("branch %s tracks %s, but there is no remote '%s'", branch, upstream, upstream.Remote),
+					Fix:     fmt.Sprintf("vec config unset branch.%s.remote && vec config unset branch.%s.merge", branch, branch),
+				})
+			}
+			continue
+		}
+		for _, remote := range remotes {
+			tracking, err := repo.ReadRefValue(fmt.Sprintf("refs/remotes/%s/%s", remote, branch))
+			if err != nil || tracking == "" {
+				continue
+			}
+			findings = append(findings, Finding{
+				Problem: fmt.Sprintf("branch %s has no upstream, but %s/%s exists", branch, remote, branch),
+				Fix:     fmt.Sprintf("vec push -u %s %s", remote, branch),
+			})
+			break
+		}
+	}
+	return findings, nil
+}
+
+// checkLooseObjectsRepo reports more loose objects than gc.auto allows;
+// past that lookups slow down and a gc packs them
+func checkLooseObjectsRepo(repo *core.Repository) ([]Finding, error) {
+	limit := defaultLooseObjectLimit
+	if value, err := repo.GetConfig(LooseObjectsKey); err == nil && value != "" {
+		if limit, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+			return nil, core.ConfigError(fmt.Sprintf("invalid %s '%s'", LooseObjectsKey, value), err)
+		}
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	dirs, err := os.ReadDir(repo.ObjectsDir)
+	if err != nil {
+		return nil, core.FSError("failed to read objects directory", err)
+	}
+	count := 0
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 || !core.IsValidHex(dir.Name()) {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(repo.ObjectsDir, dir.Name()))
+		if err != nil {
+			return nil, core.FSError("failed to read objects directory", err)
+		}
+		count += len(entries)
+	}
+	if count <= limit {
+		return nil, nil
+	}
+	return []Finding{{
+		Problem: fmt.Sprintf("%d loose objects, more than the %d %s allows", count, limit, LooseObjectsKey),
+		Fix:     "vec gc",
+	}}, nil
+}
+
+// checkTokensRepo reports remotes whose stored token is a JWT past its
+// expiry, which the server will reject
+func checkTokensRepo(repo *core.Repository) ([]Finding, error) {
+	cfg, err := config.LoadConfigRepo(repo)
+	if err != nil {
+		return nil, core.ConfigError("failed to load config", err)
+	}
+	names := make([]string, 0, len(cfg.Remotes))
+	for name := range cfg.Remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var findings []Finding
+	now := time.Now()
+	for _, name := range names {
+		remote := cfg.Remotes[name]
+		token := remote.Auth
+		if cred, err := vechttp.LookupCredential(remote.URL, name); err == nil && cred.Token != "" {
+			token = cred.Token
+		}
+		expiry, ok := tokenExpiry(token)
+		if !ok || now.Before(expiry) {
+			continue
+		}
+		findings = append(findings, Finding{
+			Problem: fmt.Sprintf("the token for remote '%s' expired on %s", name, expiry.Format(time.RFC1123)),
+			Fix:     fmt.Sprintf("vec config jwt set %s <new-token>", name),
+		})
+	}
+	return findings, nil
+}
+
+// tokenExpiry returns the exp claim of a JWT; ok is false for tokens that
+// aren't JWTs or don't expire
+func tokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(claims.Exp), 0), true
+}
+
+// checkHooksRepo reports hooks that are skipped because they aren't
+// executable, or can't be read
+func checkHooksRepo(repo *core.Repository) ([]Finding, error) {
+	dir, err := repo.HooksDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return []Finding{{Problem: fmt.Sprintf("the hooks directory %s can't be read: %v", dir, err), Fix: "chmod u+rx " + dir}}, nil
+	}
+
+	var findings []Finding
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".sample") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		info, err := os.Stat(path)
+		if err != nil {
+			findings = append(findings, Finding{Problem: fmt.Sprintf("hook %s can't be read: %v", entry.Name(), err), Fix: "rm " + path})
+			continue
+		}
+		if info.Mode()&0111 == 0 {
+			findings = append(findings, Finding{
+				Problem: fmt.Sprintf("hook %s is not executable, so it never runs", entry.Name()),
+				Fix:     "chmod +x " + path,
+			})
+		} else if f, err := os.Open(path); err != nil {
+			findings = append(findings, Finding{Problem: fmt.Sprintf("hook %s can't be read: %v", entry.Name(), err), Fix: "chmod u+r " + path})
+		} else {
+			f.Close()
+		}
+	}
+	return findings, nil
+}
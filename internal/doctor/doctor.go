@@ -0,0 +1,76 @@
+// Package doctor looks for common problems in a repository.
+//
+// Each check inspects one subsystem, such as refs, the index, remotes or
+// hooks, and reports what it finds along with the command that fixes it.
+// Checks only read the repository; fixing is left to the user.
+package doctor
+
+import (
+	"fmt"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// Finding is one problem found by a check
+type Finding struct {
+	Check   string // Name of the check that found it
+	Problem string
+	Fix     string // Command or action that fixes it; empty if there is none to suggest
+}
+
+// Check is one diagnostic run by RunRepo
+type Check struct {
+	Name        string
+	Description string
+	run         func(repo *core.Repository) ([]Finding, error)
+}
+
+// Checks are run in this order
+var Checks = []Check{
+	{"locks", "Lock files left behind by interrupted commands", checkLocksRepo},
+	{"index", "HEAD and the index point at objects that exist and hold no stray conflicts", checkIndexRepo},
+	{"upstream", "Branches with a remote counterpart track it, and tracked remotes exist", checkUpstreamsRepo},
+	{"objects", "The number of loose objects stays below gc.auto", checkLooseObjectsRepo},
+	{"credentials", "Tokens stored for remotes have not expired", checkTokensRepo},
+	{"hooks", "Hooks in the hooks directory can be run", checkHooksRepo},
+}
+
+// RunRepo runs the named checks, or all of them, and returns what they
+// found. A check that fails to run is reported as a finding of its own, so
+// the others still run.
+func RunRepo(repo *core.Repository, names []string) ([]Finding, error) {
+	selected := Checks
+	if len(names) > 0 {
+		selected = nil
+		for _, name := range names {
+			check, ok := lookupCheck(name)
+			if !ok {
+				return nil, core.RepositoryError(fmt.Sprintf("unknown check '%s'", name), nil)
+			}
+			selected = append(selected, check)
+		}
+	}
+
+	var findings []Finding
+	for _, check := range selected {
+		found, err := check.run(repo)
+		if err != nil {
+			found = []Finding{{Problem: fmt.Sprintf("check failed: %v", err)}}
+		}
+		for _, f := range found {
+			f.Check = check.Name
+			findings = append(findings, f)
+		}
+	}
+	return findings, nil
+}
+
+// lookupCheck returns the check called name
+func lookupCheck(name string) (Check, bool) {
+	for _, check := range Checks {
+		if check.Name == name {
+			return check, true
+		}
+	}
+	return Check{}, false
+}
@@ -0,0 +1,461 @@
+// Package fsck verifies the object store of a repository: that every object
+// hashes to its name and is well formed, that packs match their checksums
+// and indexes, and that no object, ref or index entry refers to an object
+// that isn't there
+package fsck
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/packfile"
+	"github.com/NahomAnteneh/vec/internal/staging"
+)
+
+// Problem kinds
+const (
+	KindCorrupt   = "corrupt"    // Unreadable, or content that doesn't hash to the object's name
+	KindMalformed = "malformed"  // Fails structural validation
+	KindMissing   = "missing"    // Referred to but not in the store
+	KindWrongType = "wrong-type" // Referred to as one type but stored as another
+	KindBadPack   = "bad-pack"   // Pack that fails its checksum or doesn't match its index
+	KindDangling  = "dangling"   // In the store but referred to by nothing
+)
+
+// Problem is something wrong found in the repository
+type Problem struct {
+	Kind   string `json:"kind"`
+	Object string `json:"object,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Pack   string `json:"pack,omitempty"` // Pack file name, for problems found in a pack
+	From   string `json:"from,omitempty"` // Object, ref or index path referring to a missing object
+	Detail string `json:"detail,omitempty"`
+}
+
+// Options configure a check
+type Options struct {
+	Dangling bool // Report objects nothing refers to
+}
+
+// Report is the outcome of a check
+type Report struct {
+	LooseObjects  int       `json:"loose_objects"`
+	PackedObjects int       `json:"packed_objects"`
+	Packs         int       `json:"packs"`
+	Problems      []Problem `json:"problems"`
+}
+
+// Errors counts the problems other than dangling objects, which are
+// harmless leftovers that gc removes
+func (r *Report) Errors() int {
+	n := 0
+	for _, p := range r.Problems {
+		if p.Kind != KindDangling {
+			n++
+		}
+	}
+	return n
+}
+
+// checker holds what a check has learned so far
+type checker struct {
+	repo       *core.Repository
+	report     *Report
+	types      map[string]string // Object ID -> type, for every object found
+	links      map[string][]objects.ObjectLink
+	referenced map[string]bool
+	shallow    map[string]bool // Commits whose parents a shallow fetch left out
+}
+
+// CheckRepo verifies every loose and packed object of the repository and
+// the links between them
+func CheckRepo(repo *core.Repository, options Options) (*Report, error) {
+	c := &checker{
+		repo:       repo,
+		report:     &Report{Problems: []Problem{}},
+		types:      make(map[string]string),
+		links:      make(map[string][]objects.ObjectLink),
+		referenced: make(map[string]bool),
+		shallow:    make(map[string]bool),
+	}
+	shallow, err := objects.ReadShallowRepo(repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, commit := range shallow {
+		c.shallow[commit] = true
+	}
+	if err := c.checkLoose(); err != nil {
+		return nil, err
+	}
+	if err := c.checkPacks(); err != nil {
+		return nil, err
+	}
+	if err := c.checkRoots(); err != nil {
+		return nil, err
+	}
+	c.checkLinks()
+	if options.Dangling {
+		c.findDangling()
+	}
+	return c.report, nil
+}
+
+func (c *checker) add(p Problem) {
+	c.report.Problems = append(c.report.Problems, p)
+}
+
+// checkLoose verifies the loose objects in .vec/objects/<xx>/
+func (c *checker) checkLoose() error {
+	err := filepath.WalkDir(c.repo.ObjectsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(c.repo.ObjectsDir, path)
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if d.IsDir() {
+			if rel != "." && (len(parts[0]) != 2 || !core.IsValidHex(parts[0])) {
+				return filepath.SkipDir // pack/, info/ and the like
+			}
+			return nil
+		}
+		if len(parts) != 2 || !core.IsValidHex(parts[1]) || strings.HasPrefix(d.Name(), "tmp") {
+			return nil
+		}
+		c.report.LooseObjects++
+		c.checkLooseObject(parts[0]+parts[1], path)
+		return nil
+	})
+	if err != nil {
+		return core.FSError("failed to walk the object store", err)
+	}
+	return nil
+}
+
+// checkLooseObject verifies one loose object. Blobs are hashed as they are
+// read; other objects are small and kept for validation.
+func (c *checker) checkLooseObject(id, path string) {
+	file, err := core.OpenObjectFile(c.repo.Root, path)
+	if err != nil {
+		c.add(Problem{Kind: KindCorrupt, Object: id, Detail: fmt.Sprintf("cannot be read: %v", err)})
+		return
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	header, err := r.ReadString(0)
+	if err != nil {
+		c.add(Problem{Kind: KindCorrupt, Object: id, Detail: "missing header"})
+		return
+	}
+	objType, sizeText, _ := strings.Cut(strings.TrimSuffix(header, "\x00"), " ")
+	size, err := strconv.ParseInt(sizeText, 10, 64)
+	if err != nil || size < 0 {
+		c.add(Problem{Kind: KindCorrupt, Object: id, Detail: fmt.Sprintf("invalid header '%s'", strings.TrimSuffix(header, "\x00"))})
+		return
+	}
+
+	h := sha256.New()
+	h.Write([]byte(header))
+	var data []byte
+	var n int64
+	if objType == "blob" {
+		n, err = io.Copy(h, r)
+	} else {
+		data, err = io.ReadAll(r)
+		n = int64(len(data))
+		h.Write(data)
+	}
+	switch {
+	case err != nil:
+		c.add(Problem{Kind: KindCorrupt, Object: id, Type: objType, Detail: fmt.Sprintf("cannot be read: %v", err)})
+		return
+	case n != size:
+		c.add(Problem{Kind: KindCorrupt, Object: id, Type: objType, Detail: fmt.Sprintf("header gives %d bytes, content has %d", size, n)})
+		return
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != id {
+		c.add(Problem{Kind: KindCorrupt, Object: id, Type: objType, Detail: "content hashes to " + sum})
+		return
+	}
+	c.record(id, objType, data, "")
+}
+
+// record validates an object whose ID is known to be right and notes its
+// type and links. Blobs need no data.
+func (c *checker) record(id, objType string, data []byte, pack string) {
+	if _, seen := c.types[id]; seen {
+		return // Loose and packed, or in several packs
+	}
+	c.types[id] = objType
+	if objType == "blob" {
+		return
+	}
+	if err := objects.CheckObject(id, objType, data); err != nil {
+		c.add(Problem{Kind: KindMalformed, Object: id, Type: objType, Pack: pack, Detail: err.Error()})
+	}
+	if links, err := objects.ObjectLinks(objType, data); err == nil {
+		c.links[id] = links
+	}
+}
+
+// checkPacks verifies each pack in .vec/objects/pack against its trailing
+// checksum and its index, then the objects it holds
+func (c *checker) checkPacks() error {
+	packs, err := filepath.Glob(filepath.Join(c.repo.ObjectsDir, "pack", "*.pack"))
+	if err != nil {
+		return core.FSError("failed to list packs", err)
+	}
+	for _, packPath := range packs {
+		c.report.Packs++
+		c.checkPack(packPath)
+	}
+	return nil
+}
+
+func (c *checker) checkPack(packPath string) {
+	name := filepath.Base(packPath)
+	bad := func(format string, args ...interface{}) {
+		c.add(Problem{Kind: KindBadPack, Pack: name, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	trailer, err := checksumFile(packPath, sha1.New())
+	if err != nil {
+		bad("%v", err)
+		return
+	}
+	indexPath := strings.TrimSuffix(packPath, ".pack") + ".idx"
+	indexData, err := os.ReadFile(indexPath)
+	if err != nil {
+		bad("cannot read index: %v", err)
+		return
+	}
+	// Indexes end with the checksum of their pack, then their own. Either
+	// may be left as zeros, meaning not recorded, and is then not checked.
+	if len(indexData) < 2*sha1.Size {
+		bad("index is truncated")
+		return
+	}
+	recordedPack := indexData[len(indexData)-2*sha1.Size : len(indexData)-sha1.Size]
+	recordedIndex := indexData[len(indexData)-sha1.Size:]
+	if !isZero(recordedPack) && !bytes.Equal(recordedPack, trailer) {
+		bad("checksum %x does not match %x recorded in its index", trailer, recordedPack)
+	}
+	if sum := sha1.Sum(indexData[:len(indexData)-sha1.Size]); !isZero(recordedIndex) && !bytes.Equal(recordedIndex, sum[:]) {
+		bad("index checksum mismatch")
+	}
+
+	if err := packfile.VerifyPackIndex(indexPath, packPath); err != nil {
+		bad("%v", err)
+		return
+	}
+	index, err := packfile.ReadPackIndex(indexPath)
+	if err != nil {
+		bad("%v", err)
+		return
+	}
+	packed, err := packfile.ParseModernPackfile(packPath, false)
+	if err != nil {
+		bad("cannot be read: %v", err)
+		return
+	}
+	defer packfile.ReleaseObjects(packed)
+
+	if len(packed) != len(index.Entries) {
+		bad("index lists %d objects, the pack holds %d", len(index.Entries), len(packed))
+	}
+	for i := range packed {
+		obj := &packed[i]
+		c.report.PackedObjects++
+		id, err := c.checkPackedObject(obj, name)
+		if err != nil {
+			bad("%v", err)
+			continue
+		}
+		// Indexes written by vec are keyed by object ID, older ones by the
+		// pack's own names
+		_, byID := index.Entries[id]
+		if _, byName := index.Entries[obj.Hash]; !byID && !byName {
+			bad("object %s is missing from the index", id)
+		}
+	}
+}
+
+// checkPackedObject works out the ID of an object read from a pack,
+// records it and returns it
+func (c *checker) checkPackedObject(obj *packfile.Object, pack string) (string, error) {
+	objType := obj.TypeName()
+	reader, err := packfile.OpenObjectData(obj)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	var data bytes.Buffer
+	var content io.Reader = reader
+	if objType != "blob" {
+		content = io.TeeReader(reader, &data)
+	}
+	size := int64(len(obj.Data))
+	if obj.SpillPath != "" {
+		size = obj.Size
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %d\x00", objType, size)
+	if _, err := io.Copy(h, content); err != nil {
+		return "", fmt.Errorf("failed to read object %s: %w", obj.Hash, err)
+	}
+	id := hex.EncodeToString(h.Sum(nil))
+	c.record(id, objType, data.Bytes(), pack)
+	return id, nil
+}
+
+// checkRoots checks that HEAD, the refs, the reflogs and the index only
+// name objects in the store, and marks those objects referenced
+func (c *checker) checkRoots() error {
+	root := func(hash, from string) {
+		if hash == "" || strings.Trim(hash, "0") == "" {
+			return
+		}
+		c.referenced[hash] = true
+		if _, ok := c.types[hash]; !ok {
+			c.add(Problem{Kind: KindMissing, Object: hash, From: from})
+		}
+	}
+
+	head, err := c.repo.ReadHead()
+	if err != nil {
+		return core.RefError("failed to read HEAD", err)
+	}
+	root(head, core.HeadFile)
+	refs, err := c.repo.ListRefs("refs/")
+	if err != nil {
+		return core.RefError("failed to list refs", err)
+	}
+	for _, ref := range refs {
+		root(ref.Hash, ref.Name)
+	}
+
+	logsDir := filepath.Join(c.repo.VecDir, "logs")
+	err = filepath.WalkDir(logsDir, func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return filepath.SkipDir
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(logsDir, path)
+		name := filepath.ToSlash(rel)
+		entries, err := core.ReadReflog(c.repo.Root, name)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			root(entry.Old, "reflog of "+name)
+			root(entry.New, "reflog of "+name)
+		}
+		return nil
+	})
+	if err != nil {
+		return core.RefError("failed to read reflogs", err)
+	}
+
+	index, err := staging.LoadIndex(c.repo)
+	if err != nil {
+		return err
+	}
+	for _, entry := range index.Entries {
+		if entry.Mode != objects.ModeGitlink {
+			root(entry.SHA256, "index entry "+entry.FilePath)
+		}
+	}
+	return nil
+}
+
+// checkLinks checks that what each object refers to is in the store, with
+// the type it is referred to as
+func (c *checker) checkLinks() {
+	for _, id := range sortedKeys(c.links) {
+		for _, link := range c.links[id] {
+			c.referenced[link.Hash] = true
+			from := fmt.Sprintf("%s of %s %s", link.Name, c.types[id], id)
+			actual, ok := c.types[link.Hash]
+			switch {
+			case !ok && link.Name == "parent" && c.shallow[id]:
+			case !ok:
+				c.add(Problem{Kind: KindMissing, Object: link.Hash, Type: link.Type, From: from})
+			case link.Type != "" && actual != link.Type:
+				c.add(Problem{Kind: KindWrongType, Object: link.Hash, Type: actual, From: from,
+					Detail: fmt.Sprintf("referred to as a %s", link.Type)})
+			}
+		}
+	}
+}
+
+// findDangling reports the objects nothing refers to
+func (c *checker) findDangling() {
+	for _, id := range sortedKeys(c.types) {
+		if !c.referenced[id] {
+			c.add(Problem{Kind: KindDangling, Object: id, Type: c.types[id]})
+		}
+	}
+}
+
+// checksumFile checks that a file ends with the checksum of what precedes
+// it and returns the checksum
+func checksumFile(path string, h hash.Hash) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot be read: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("cannot be read: %w", err)
+	}
+	if info.Size() < int64(h.Size()) {
+		return nil, fmt.Errorf("is truncated")
+	}
+	if _, err := io.CopyN(h, file, info.Size()-int64(h.Size())); err != nil {
+		return nil, fmt.Errorf("cannot be read: %w", err)
+	}
+	trailer := make([]byte, h.Size())
+	if _, err := io.ReadFull(file, trailer); err != nil {
+		return nil, fmt.Errorf("cannot be read: %w", err)
+	}
+	if sum := h.Sum(nil); !bytes.Equal(sum, trailer) {
+		return nil, fmt.Errorf("checksum mismatch: content hashes to %x, trailer is %x", sum, trailer)
+	}
+	return trailer, nil
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,472 @@
+package maintenance
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/packfile"
+	"github.com/NahomAnteneh/vec/internal/remote"
+	"github.com/NahomAnteneh/vec/internal/repository"
+)
+
+// A backup archive is a magic line followed by a tar stream holding the
+// manifest, the local config, HEAD and, unless nothing was new, a pack. An
+// encrypted archive has its own magic line, then a salt, a nonce and the tar
+// stream sealed with AES-256-GCM under a key derived from the passphrase.
+const (
+	backupMagic          = "VECBACKUP 1\n"
+	backupEncryptedMagic = "VECBACKUP 1 aes-256-gcm\n"
+	backupManifestHeader = "vec-backup 1"
+	backupSaltSize       = 16
+	backupKDFIterations  = 600000
+
+	backupManifestEntry = "manifest"
+	backupConfigEntry   = "config"
+	backupHeadEntry     = "HEAD"
+	backupPackEntry     = "pack"
+)
+
+// ErrBackupPassphrase is returned when an encrypted backup can't be opened
+// with the passphrase given
+var ErrBackupPassphrase = errors.New("wrong passphrase or corrupted backup")
+
+// BackupOptions defines options for creating a backup
+type BackupOptions struct {
+	// Root path of the repository
+	RepoRoot string
+	// File the archive is written to
+	OutputPath string
+	// Encrypt the archive with this passphrase when non-empty
+	Passphrase string
+	// Previous backup; only objects it doesn't cover are packed
+	Since string
+}
+
+// BackupManifest describes a backup
+type BackupManifest struct {
+	ID      string
+	Base    string // ID of the backup this one is incremental to, "" for a full one
+	Created time.Time
+	Refs    []core.Ref
+	// Every object reachable when the backup was made; the pack holds the
+	// ones Base doesn't cover
+	Objects []string
+	// Number of objects in this backup's pack
+	Packed int
+}
+
+// backupArchive is the decoded contents of a backup file
+type backupArchive struct {
+	manifest *BackupManifest
+	config   []byte
+	head     []byte
+	pack     []byte
+}
+
+// CreateBackup writes refs, config and a pack of every reachable object of
+// the repository to a single archive. With Since, only objects the previous
+// backup chain doesn't hold are packed.
+func CreateBackup(options BackupOptions) (*BackupManifest, error) {
+	repo := core.NewRepository(options.RepoRoot)
+
+	reachable, err := findReachableObjectsRepo(repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find reachable objects: %w", err)
+	}
+	refs, err := core.ListRefs(repo.Root, "refs/")
+	if err != nil {
+		return nil, err
+	}
+	head, err := os.ReadFile(repo.HeadPath)
+	if err != nil {
+		return nil, core.RefError("failed to read HEAD", err)
+	}
+	config, err := os.ReadFile(repo.ConfigFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, core.ConfigError("failed to read config", err)
+	}
+
+	manifest := &BackupManifest{Created: time.Now(), Refs: refs}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate backup id: %w", err)
+	}
+	manifest.ID = hex.EncodeToString(id)
+
+	covered := make(map[string]bool)
+	if options.Since != "" {
+		previous, err := readBackupArchive(options.Since, options.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read previous backup '%s': %w", options.Since, err)
+		}
+		manifest.Base = previous.manifest.ID
+		for _, hash := range previous.manifest.Objects {
+			covered[hash] = true
+		}
+	}
+
+	var packHashes []string
+	for hash := range reachable {
+		manifest.Objects = append(manifest.Objects, hash)
+		if !covered[hash] {
+			packHashes = append(packHashes, hash)
+		}
+	}
+	sort.Strings(manifest.Objects)
+	sort.Strings(packHashes)
+	manifest.Packed = len(packHashes)
+
+	archive := &backupArchive{manifest: manifest, config: config, head: head}
+	if len(packHashes) > 0 {
+		pack, err := packfile.CreateTempPack(repo.Root, packHashes, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer pack.Remove()
+		if archive.pack, err = os.ReadFile(pack.Path); err != nil {
+			return nil, fmt.Errorf("failed to read packfile: %w", err)
+		}
+	}
+
+	if err := writeBackupArchive(options.OutputPath, archive, options.Passphrase); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// ReadBackupManifest returns the manifest of a backup archive
+func ReadBackupManifest(path, passphrase string) (*BackupManifest, error) {
+	archive, err := readBackupArchive(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return archive.manifest, nil
+}
+
+// IsBackupEncrypted reports whether the archive at path needs a passphrase
+func IsBackupEncrypted(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, core.FSError(fmt.Sprintf("failed to open backup '%s'", path), err)
+	}
+	defer file.Close()
+	magic, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("'%s' is not a vec backup", path)
+	}
+	return magic == backupEncryptedMagic, nil
+}
+
+// RestoreBackup creates a repository in repoRoot from a full backup followed
+// by the incremental backups made on top of it, in order. The objects of
+// every archive are unpacked; refs, HEAD and config come from the last one.
+func RestoreBackup(repoRoot string, archives []string, passphrase string) (*BackupManifest, error) {
+	if len(archives) == 0 {
+		return nil, fmt.Errorf("no backup to restore")
+	}
+	repo := core.NewRepository(repoRoot)
+	if core.FileExists(repo.VecDir) {
+		return nil, core.AlreadyExistsError(core.ErrCategoryRepository, repo.VecDir)
+	}
+
+	// Check the whole chain before touching the disk
+	chain := make([]*backupArchive, len(archives))
+	for i, path := range archives {
+		archive, err := readBackupArchive(path, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup '%s': %w", path, err)
+		}
+		switch {
+		case i == 0 && archive.manifest.Base != "":
+			return nil, fmt.Errorf("'%s' is incremental to backup %s; restore that one first", path, archive.manifest.Base)
+		case i > 0 && archive.manifest.Base != chain[i-1].manifest.ID:
+			return nil, fmt.Errorf("'%s' is not incremental to '%s'", path, archives[i-1])
+		}
+		chain[i] = archive
+	}
+	for _, ref := range chain[len(chain)-1].manifest.Refs {
+		if !strings.HasPrefix(ref.Name, "refs/") || strings.Contains(ref.Name, "..") {
+			return nil, fmt.Errorf("backup manifest has invalid ref name '%s'", ref.Name)
+		}
+		if len(ref.Hash) != 64 || !core.IsValidHex(ref.Hash) {
+			return nil, fmt.Errorf("backup manifest has invalid hash '%s' for %s", ref.Hash, ref.Name)
+		}
+	}
+
+	if err := repository.CreateRepo(repo); err != nil {
+		return nil, core.RepositoryError(fmt.Sprintf("failed to initialize repository in '%s'", repoRoot), err)
+	}
+	for i, archive := range chain {
+		if len(archive.pack) == 0 {
+			continue
+		}
+		if err := unpackBackupPack(repo, archive.pack); err != nil {
+			return nil, fmt.Errorf("failed to unpack '%s': %w", archives[i], err)
+		}
+	}
+
+	last := chain[len(chain)-1]
+	for _, ref := range last.manifest.Refs {
+		if !core.ObjectExists(repo.Root, ref.Hash) {
+			return nil, fmt.Errorf("backup chain is incomplete: %s points to missing object %s", ref.Name, ref.Hash)
+		}
+		if err := core.WriteRef(repo.Root, ref.Name, ref.Hash); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.WriteFile(repo.HeadPath, last.head, 0644); err != nil {
+		return nil, core.RefError("failed to write HEAD", err)
+	}
+	if last.config != nil {
+		if err := os.WriteFile(repo.ConfigFile, last.config, 0644); err != nil {
+			return nil, core.ConfigError("failed to write config", err)
+		}
+	}
+	return last.manifest, nil
+}
+
+// unpackBackupPack stores the objects of a pack held in memory
+func unpackBackupPack(repo *core.Repository, pack []byte) error {
+	file, err := core.CreateTempFile(repo.Root, "backup", ".pack")
+	if err != nil {
+		return err
+	}
+	defer core.RemoveTempFile(file.Name())
+	_, err = file.Write(pack)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write packfile: %w", err)
+	}
+	return remote.UnpackPackfileRepo(repo, file.Name())
+}
+
+// writeBackupArchive writes archive to path, replacing it only once complete
+func writeBackupArchive(path string, archive *backupArchive, passphrase string) error {
+	var payload bytes.Buffer
+	tw := tar.NewWriter(&payload)
+	entries := []struct {
+		name string
+		data []byte
+	}{
+		{backupManifestEntry, archive.manifest.encode()},
+		{backupConfigEntry, archive.config},
+		{backupHeadEntry, archive.head},
+		{backupPackEntry, archive.pack},
+	}
+	for _, entry := range entries {
+		if entry.data == nil {
+			continue
+		}
+		header := &tar.Header{Name: entry.name, Mode: 0600, Size: int64(len(entry.data)), ModTime: archive.manifest.Created}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write backup: %w", err)
+		}
+		if _, err := tw.Write(entry.data); err != nil {
+			return fmt.Errorf("failed to write backup: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	content := append([]byte(backupMagic), payload.Bytes()...)
+	if passphrase != "" {
+		sealed, err := sealBackup(payload.Bytes(), passphrase)
+		if err != nil {
+			return err
+		}
+		content = append([]byte(backupEncryptedMagic), sealed...)
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0600); err != nil {
+		os.Remove(tmpPath)
+		return core.FSError(fmt.Sprintf("failed to write backup '%s'", path), err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return core.FSError(fmt.Sprintf("failed to write backup '%s'", path), err)
+	}
+	return nil
+}
+
+// readBackupArchive reads and, if needed, decrypts the archive at path
+func readBackupArchive(path, passphrase string) (*backupArchive, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, core.FSError(fmt.Sprintf("failed to read backup '%s'", path), err)
+	}
+
+	var payload []byte
+	switch {
+	case bytes.HasPrefix(content, []byte(backupMagic)):
+		payload = content[len(backupMagic):]
+	case bytes.HasPrefix(content, []byte(backupEncryptedMagic)):
+		if passphrase == "" {
+			return nil, fmt.Errorf("backup is encrypted; a passphrase is required")
+		}
+		if payload, err = openBackup(content[len(backupEncryptedMagic):], passphrase); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("'%s' is not a vec backup", filepath.Base(path))
+	}
+
+	archive := &backupArchive{}
+	tr := tar.NewReader(bytes.NewReader(payload))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("corrupted backup: %w", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("corrupted backup: %w", err)
+		}
+		switch header.Name {
+		case backupManifestEntry:
+			if archive.manifest, err = decodeBackupManifest(data); err != nil {
+				return nil, err
+			}
+		case backupConfigEntry:
+			archive.config = data
+		case backupHeadEntry:
+			archive.head = data
+		case backupPackEntry:
+			archive.pack = data
+		}
+	}
+	if archive.manifest == nil || archive.head == nil {
+		return nil, fmt.Errorf("corrupted backup: missing %s or %s", backupManifestEntry, backupHeadEntry)
+	}
+	return archive, nil
+}
+
+// encode serializes the manifest, one "key value" line per field
+func (m *BackupManifest) encode() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s\n", backupManifestHeader)
+	fmt.Fprintf(&buf, "id %s\n", m.ID)
+	if m.Base != "" {
+		fmt.Fprintf(&buf, "base %s\n", m.Base)
+	}
+	fmt.Fprintf(&buf, "created %d\n", m.Created.Unix())
+	fmt.Fprintf(&buf, "packed %d\n", m.Packed)
+	for _, ref := range m.Refs {
+		fmt.Fprintf(&buf, "ref %s %s\n", ref.Hash, ref.Name)
+	}
+	for _, hash := range m.Objects {
+		fmt.Fprintf(&buf, "object %s\n", hash)
+	}
+	return buf.Bytes()
+}
+
+// decodeBackupManifest parses a manifest written by encode
+func decodeBackupManifest(data []byte) (*BackupManifest, error) {
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) == 0 || lines[0] != backupManifestHeader {
+		return nil, fmt.Errorf("corrupted backup: unsupported manifest")
+	}
+	m := &BackupManifest{}
+	for _, line := range lines[1:] {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "id":
+			m.ID = value
+		case "base":
+			m.Base = value
+		case "created":
+			secs, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("corrupted backup: invalid created time '%s'", value)
+			}
+			m.Created = time.Unix(secs, 0)
+		case "packed":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("corrupted backup: invalid packed count '%s'", value)
+			}
+			m.Packed = n
+		case "ref":
+			hash, name, ok := strings.Cut(value, " ")
+			if !ok {
+				return nil, fmt.Errorf("corrupted backup: invalid ref line '%s'", line)
+			}
+			m.Refs = append(m.Refs, core.Ref{Name: name, Hash: hash})
+		case "object":
+			m.Objects = append(m.Objects, value)
+		}
+	}
+	if m.ID == "" {
+		return nil, fmt.Errorf("corrupted backup: manifest has no id")
+	}
+	return m, nil
+}
+
+// sealBackup encrypts payload as salt || nonce || AES-256-GCM ciphertext
+func sealBackup(payload []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, backupSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	gcm, err := backupCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := append(salt, nonce...)
+	return gcm.Seal(sealed, nonce, payload, []byte(backupEncryptedMagic)), nil
+}
+
+// openBackup decrypts what sealBackup produced
+func openBackup(sealed []byte, passphrase string) ([]byte, error) {
+	if len(sealed) < backupSaltSize {
+		return nil, ErrBackupPassphrase
+	}
+	gcm, err := backupCipher(passphrase, sealed[:backupSaltSize])
+	if err != nil {
+		return nil, err
+	}
+	sealed = sealed[backupSaltSize:]
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrBackupPassphrase
+	}
+	payload, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(backupEncryptedMagic))
+	if err != nil {
+		return nil, ErrBackupPassphrase
+	}
+	return payload, nil
+}
+
+// backupCipher returns the AES-256-GCM cipher keyed from passphrase and salt
+func backupCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key := core.PBKDF2SHA256([]byte(passphrase), salt, backupKDFIterations, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
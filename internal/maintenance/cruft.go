@@ -0,0 +1,233 @@
+package maintenance
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/packfile"
+)
+
+// PruneExpireKey sets how long gc keeps unreachable objects in cruft packs
+const PruneExpireKey = "gc.pruneExpire"
+
+// DefaultPruneExpire is used when gc.pruneExpire is unset
+const DefaultPruneExpire = "2.weeks.ago"
+
+// cruftResult summarizes what handling the unreachable objects did
+type cruftResult struct {
+	crufted  int   // Objects kept in the new cruft pack
+	rescued  int   // Cruft objects reachable again, written back as loose objects
+	expired  int   // Objects deleted for good
+	freed    int64 // Bytes of expired objects
+	packPath string
+}
+
+// ParsePruneExpire returns the cutoff for a gc.pruneExpire value: objects
+// last modified before it may be deleted. "never" returns the zero time,
+// "now" returns now; otherwise the value is "<n>.<unit>.ago" (units seconds
+// to years, singular or plural), a Go duration such as 72h, or a date.
+func ParsePruneExpire(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	switch value {
+	case "never", "false":
+		return time.Time{}, nil
+	case "now", "all":
+		return now, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	parts := strings.Split(value, ".")
+	if len(parts) == 3 && parts[2] == "ago" {
+		n, err := strconv.Atoi(parts[0])
+		if err == nil && n >= 0 {
+			unit := strings.TrimSuffix(parts[1], "s")
+			switch unit {
+			case "second":
+				return now.Add(-time.Duration(n) * time.Second), nil
+			case "minute":
+				return now.Add(-time.Duration(n) * time.Minute), nil
+			case "hour":
+				return now.Add(-time.Duration(n) * time.Hour), nil
+			case "day":
+				return now.AddDate(0, 0, -n), nil
+			case "week":
+				return now.AddDate(0, 0, -7*n), nil
+			case "month":
+				return now.AddDate(0, -n, 0), nil
+			case "year":
+				return now.AddDate(-n, 0, 0), nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry '%s' (expected e.g. 2.weeks.ago, 72h, a date, now or never)", value)
+}
+
+// pruneExpireRepo returns the cutoff for unreachable objects: override when
+// given, else gc.pruneExpire, else the default
+func pruneExpireRepo(repo *core.Repository, override string, now time.Time) (time.Time, error) {
+	value := override
+	if value == "" {
+		configured, err := repo.GetConfig(PruneExpireKey)
+		if err != nil {
+			return time.Time{}, core.ConfigError("failed to read "+PruneExpireKey, err)
+		}
+		value = configured
+	}
+	if value == "" {
+		value = DefaultPruneExpire
+	}
+	cutoff, err := ParsePruneExpire(value, now)
+	if err != nil {
+		return time.Time{}, core.ConfigError(err.Error(), nil)
+	}
+	return cutoff, nil
+}
+
+// expired reports whether an object last modified at mtime is past cutoff
+func expired(mtime, cutoff time.Time) bool {
+	return !cutoff.IsZero() && mtime.Before(cutoff)
+}
+
+// cruftUnreachableRepo moves the unreferenced loose objects still within
+// the expiry, and the unexpired objects of earlier cruft packs, into one new
+// cruft pack. Expired objects are deleted, and cruft objects that became
+// reachable again are restored as loose objects. Before the new pack is in
+// place nothing is removed, so an interrupted gc loses no object.
+func cruftUnreachableRepo(repo *core.Repository, unreferenced []ObjectInfo, reachable map[string]bool, cutoff time.Time, dryRun, verbose bool) (*cruftResult, error) {
+	result := &cruftResult{}
+	now := time.Now()
+	packDir := filepath.Join(repo.VecDir, "objects", "pack")
+
+	oldPacks, err := packfile.CruftPackPaths(packDir)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make(map[string]packfile.CruftObject)
+	keep := func(obj packfile.CruftObject) {
+		if prev, ok := kept[obj.Hash]; !ok || obj.Mtime.After(prev.Mtime) {
+			kept[obj.Hash] = obj
+		}
+	}
+
+	for _, packPath := range oldPacks {
+		cruft, err := packfile.ReadCruftPack(packPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range cruft {
+			objectPath := filepath.Join(repo.VecDir, "objects", obj.Hash[:2], obj.Hash[2:])
+			switch {
+			case reachable[obj.Hash]:
+				if core.FileExists(objectPath) {
+					continue
+				}
+				if verbose {
+					fmt.Printf("Restoring object reachable again: %s\n", obj.Hash)
+				}
+				if !dryRun {
+					if err := core.EnsureDirExists(filepath.Dir(objectPath)); err != nil {
+						return nil, err
+					}
+					if err := os.WriteFile(objectPath, obj.Data, 0444); err != nil {
+						return nil, fmt.Errorf("failed to restore object %s: %w", obj.Hash, err)
+					}
+				}
+				result.rescued++
+			case expired(obj.Mtime, cutoff):
+				if verbose {
+					fmt.Printf("Expiring unreachable object: %s\n", obj.Hash)
+				}
+				result.expired++
+				result.freed += int64(len(obj.Data))
+			default:
+				keep(obj)
+			}
+		}
+	}
+
+	var crufted []ObjectInfo
+	for _, obj := range unreferenced {
+		if expired(obj.ModTime, cutoff) {
+			continue // Deleted below with the rest of the expired loose objects
+		}
+		data, err := os.ReadFile(obj.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read object %s: %w", obj.Hash, err)
+		}
+		keep(packfile.CruftObject{Hash: obj.Hash, Mtime: obj.ModTime, Data: data})
+		crufted = append(crufted, obj)
+	}
+	result.crufted = len(kept)
+
+	if dryRun {
+		for _, obj := range unreferenced {
+			if expired(obj.ModTime, cutoff) {
+				result.expired++
+				result.freed += obj.Size
+			}
+		}
+		return result, nil
+	}
+
+	if len(kept) > 0 {
+		// Cruft objects are loose files, so with encryption on the plain ones
+		// from before it was turned on are sealed as they move
+		encrypt := core.ObjectEncryptionEnabled(repo.Root)
+		objects := make([]packfile.CruftObject, 0, len(kept))
+		for _, obj := range kept {
+			if encrypt && !core.IsEncryptedObject(obj.Data) {
+				if obj.Data, err = core.EncodeObjectFile(repo.Root, obj.Data); err != nil {
+					return nil, err
+				}
+			}
+			objects = append(objects, obj)
+		}
+		sort.Slice(objects, func(i, j int) bool { return objects[i].Hash < objects[j].Hash })
+		if result.packPath, err = packfile.WriteCruftPack(packDir, objects, now); err != nil {
+			return nil, err
+		}
+		if verbose {
+			fmt.Printf("Kept %d unreachable objects in %s\n", len(objects), filepath.Base(result.packPath))
+		}
+	}
+
+	for _, packPath := range oldPacks {
+		if packPath == result.packPath {
+			continue
+		}
+		if err := os.Remove(packPath); err != nil {
+			return result, fmt.Errorf("failed to remove old cruft pack: %w", err)
+		}
+	}
+
+	var expiredLoose []ObjectInfo
+	for _, obj := range unreferenced {
+		if expired(obj.ModTime, cutoff) {
+			expiredLoose = append(expiredLoose, obj)
+			result.expired++
+			result.freed += obj.Size
+		}
+	}
+	if err := removeUnreferencedObjectsRepo(repo, expiredLoose, verbose); err != nil {
+		return result, err
+	}
+	// Their content lives in the cruft pack now
+	if err := removeUnreferencedObjectsRepo(repo, crufted, false); err != nil {
+		return result, err
+	}
+	return result, nil
+}
@@ -1,14 +1,17 @@
 package maintenance
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/NahomAnteneh/vec/core"
 	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/packfile"
 	"github.com/NahomAnteneh/vec/utils"
 )
 
@@ -20,18 +23,39 @@ type GarbageCollectOptions struct {
 	DryRun bool
 	// Verbose output
 	Verbose bool
+	// Expiry of unreachable objects, overriding gc.pruneExpire
+	PruneExpire string
 }
 
 // GCStats contains statistics from the garbage collection operation
 type GCStats struct {
 	// Number of objects examined
 	ObjectsExamined int
-	// Number of objects removed
+	// Number of unreachable objects removed for good, being past the expiry
 	ObjectsRemoved int
+	// Number of unreachable objects kept in the cruft pack until they expire
+	ObjectsCrufted int
+	// Number of cruft objects restored because they are reachable again
+	ObjectsRescued int
+	// Number of reachable loose objects written to a new pack
+	ObjectsPacked int
+	// Path of the new pack, if one was written
+	PackPath string
 	// Space saved in bytes
 	SpaceSaved int64
+	// Number of stale temporary files removed from .vec/tmp
+	TempFilesRemoved int
+	// Number of loose objects removed because a pack holds them
+	PackedObjectsRemoved int
+	// Number of deleted worktrees whose metadata was pruned
+	WorktreesPruned int
+	// Number of commits given a reachability bitmap
+	BitmapsWritten int
 }
 
+// WriteBitmapsKey, true by default, writes the reachability bitmap index on gc
+const WriteBitmapsKey = "repack.writeBitmaps"
+
 // DefaultGCOptions returns default garbage collection options
 func DefaultGCOptions() GarbageCollectOptions {
 	return GarbageCollectOptions{
@@ -60,6 +84,25 @@ func GarbageCollect(options GarbageCollectOptions) (*GCStats, error) {
 func GarbageCollectRepo(repo *core.Repository, options GarbageCollectOptions) (*GCStats, error) {
 	stats := &GCStats{}
 
+	// Sweep temporary files left behind by crashed operations
+	tempRemoved, err := core.SweepStaleTempFiles(repo.Root, core.StaleTempAge, options.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	stats.TempFilesRemoved = tempRemoved
+
+	// Forget worktrees that were deleted, unless locked
+	prunedWorktrees, err := core.PruneWorktrees(repo.Root, options.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	stats.WorktreesPruned = len(prunedWorktrees)
+
+	cutoff, err := pruneExpireRepo(repo, options.PruneExpire, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
 	// Find all reachable objects
 	reachable, err := findReachableObjectsRepo(repo)
 	if err != nil {
@@ -94,36 +137,87 @@ func GarbageCollectRepo(repo *core.Repository, options GarbageCollectOptions) (*
 			len(reachable), len(unreferenced), totalSize)
 	}
 
-	// If it's a dry run, just report what would be done
-	if options.DryRun {
-		if options.Verbose {
-			fmt.Println("Dry run - no changes will be made")
-			for _, obj := range unreferenced {
-				fmt.Printf("Would remove object: %s (%d bytes)\n", obj.Hash, obj.Size)
-			}
+	if options.DryRun && options.Verbose {
+		fmt.Println("Dry run - no changes will be made")
+	}
+
+	// Unreachable objects may still be wanted by an operation in flight, such
+	// as a push whose refs aren't updated yet, so they go to a cruft pack and
+	// are only deleted once older than the expiry
+	cruft, err := cruftUnreachableRepo(repo, unreferenced, reachable, cutoff, options.DryRun, options.Verbose)
+	if err != nil {
+		return stats, fmt.Errorf("failed to handle unreferenced objects: %w", err)
+	}
+	stats.ObjectsRemoved = cruft.expired
+	stats.ObjectsCrufted = cruft.crufted
+	stats.ObjectsRescued = cruft.rescued
+
+	// Reachable loose objects go to a pack, and their loose copies, like
+	// those of objects packed before, are then redundant. Packs aren't
+	// encrypted, so with encryption on objects stay loose.
+	repacked, pruned := &repackResult{}, &PrunePackedStats{}
+	if !core.ObjectEncryptionEnabled(repo.Root) {
+		repacked, err = repackLooseRepo(repo, allObjects, reachable, options.DryRun, options.Verbose)
+		if err != nil {
+			return stats, fmt.Errorf("failed to repack loose objects: %w", err)
+		}
+		pruned, err = prunePackedRepo(repo, PrunePackedOptions{DryRun: options.DryRun, Verbose: options.Verbose},
+			unreferencedSet(unreferenced))
+		if err != nil {
+			return stats, fmt.Errorf("failed to prune packed objects: %w", err)
+		}
+	}
+	stats.ObjectsPacked = repacked.packed
+	stats.PackPath = repacked.packPath
+	stats.PackedObjectsRemoved = pruned.ObjectsRemoved
+	stats.SpaceSaved = cruft.freed + pruned.SpaceSaved
+
+	// Keep the multi-pack-index covering the new pack
+	if repacked.packPath != "" && AutoEnabled(repo) {
+		if _, err := packfile.WriteMultiPackIndexRepo(repo); err != nil {
+			return stats, fmt.Errorf("failed to update multi-pack-index: %w", err)
 		}
-		stats.ObjectsRemoved = len(unreferenced)
-		stats.SpaceSaved = totalSize
-		return stats, nil
 	}
 
-	// Remove unreferenced objects
-	if len(unreferenced) > 0 {
-		if err := removeUnreferencedObjectsRepo(repo, unreferenced, options.Verbose); err != nil {
-			return stats, fmt.Errorf("failed to remove unreferenced objects: %w", err)
+	if !options.DryRun && writeBitmapsEnabled(repo) {
+		tips, err := objects.GraphTipsRepo(repo)
+		if err != nil {
+			return stats, err
+		}
+		if stats.BitmapsWritten, err = objects.WriteBitmapIndexRepo(repo, tips); err != nil {
+			return stats, fmt.Errorf("failed to write bitmap index: %w", err)
 		}
-		stats.ObjectsRemoved = len(unreferenced)
-		stats.SpaceSaved = totalSize
 	}
 
 	return stats, nil
 }
 
+// writeBitmapsEnabled reports whether repack.writeBitmaps leaves the bitmap
+// index on
+func writeBitmapsEnabled(repo *core.Repository) bool {
+	value, err := repo.GetConfig(WriteBitmapsKey)
+	if err != nil {
+		return true
+	}
+	enabled, err := core.NormalizeConfigValue(core.ConfigBool, value)
+	return err != nil || enabled == "true"
+}
+
+// unreferencedSet returns the hashes of objs as a set
+func unreferencedSet(objs []ObjectInfo) map[string]bool {
+	set := make(map[string]bool, len(objs))
+	for _, obj := range objs {
+		set[obj.Hash] = true
+	}
+	return set
+}
+
 // ObjectInfo stores information about an object
 type ObjectInfo struct {
-	Hash string
-	Path string
-	Size int64
+	Hash    string
+	Path    string
+	Size    int64
+	ModTime time.Time
 }
 
 // findReachableObjectsRepo finds all objects that are reachable from refs using Repository context
@@ -175,6 +269,9 @@ func findReachableObjectsRepo(repo *core.Repository) (map[string]bool, error) {
 
 				refHash := strings.TrimSpace(string(refData))
 				if err := markReachableFromObjectRepo(repo, refHash, reachable); err != nil {
+					if errors.Is(err, objects.ErrCorruptGraph) {
+						return fmt.Errorf("ref %s: %w", path, err)
+					}
 					return nil // Skip objects we can't mark
 				}
 			}
@@ -187,9 +284,56 @@ func findReachableObjectsRepo(repo *core.Repository) (map[string]bool, error) {
 		}
 	}
 
+	// Reflogs keep what refs pointed at before, so it can be gone back to;
+	// stash entries below the newest are only recorded in the stash reflog
+	reflogs, err := reflogNamesRepo(repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range reflogs {
+		entries, err := core.ReadReflog(repo.Root, ref)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			for _, hash := range []string{entry.Old, entry.New} {
+				if strings.Trim(hash, "0") == "" {
+					continue
+				}
+				if err := markReachableFromObjectRepo(repo, hash, reachable); errors.Is(err, objects.ErrCorruptGraph) {
+					return nil, fmt.Errorf("reflog of %s, %s: %w", ref, hash, err)
+				}
+			}
+		}
+	}
+
 	return reachable, nil
 }
 
+// reflogNamesRepo returns the refs, HEAD included, that have a reflog
+func reflogNamesRepo(repo *core.Repository) ([]string, error) {
+	logsDir := filepath.Join(repo.VecDir, "logs")
+	if !dirExists(logsDir) {
+		return nil, nil
+	}
+	var names []string
+	err := filepath.WalkDir(logsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(logsDir, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reflogs: %w", err)
+	}
+	return names, nil
+}
+
 // markReachableFromObjectRepo recursively marks an object and its referenced objects as reachable
 func markReachableFromObjectRepo(repo *core.Repository, hash string, reachable map[string]bool) error {
 	if hash == "" || len(hash) < 4 {
@@ -204,45 +348,16 @@ func markReachableFromObjectRepo(repo *core.Repository, hash string, reachable m
 	// Mark this object
 	reachable[hash] = true
 
-	// Get object type
-	objPath := filepath.Join(repo.VecDir, "objects", hash[:2], hash[2:])
-	if !fileExists(objPath) {
-		return nil // Object doesn't exist
-	}
-
-	// Read a small portion of the object to determine its type
-	f, err := os.Open(objPath)
+	// Get object type, loose or packed; objects not in the store are skipped.
+	// A packed commit still needs walking: the objects it reaches may be loose.
+	objType, err := objects.ObjectTypeRepo(repo, hash)
 	if err != nil {
-		return nil // Skip objects we can't open
-	}
-	defer f.Close()
-
-	// Read the first few bytes to determine the type
-	header := make([]byte, 10)
-	_, err = f.Read(header)
-	if err != nil {
-		return nil // Skip objects we can't read
-	}
-
-	// Parse the header to extract the type
-	headerStr := string(header)
-	var objType string
-
-	if strings.HasPrefix(headerStr, "commit ") {
-		objType = "commit"
-	} else if strings.HasPrefix(headerStr, "tree ") {
-		objType = "tree"
-	} else if strings.HasPrefix(headerStr, "blob ") {
-		objType = "blob"
-	} else if strings.HasPrefix(headerStr, "tag ") {
-		objType = "tag"
-	} else {
-		return nil // Unknown object type
+		return nil
 	}
 
 	switch objType {
 	case "commit":
-		commit, err := objects.GetCommit(repo.Root, hash)
+		commit, err := objects.GetCommitRepo(repo, hash)
 		if err != nil {
 			return nil // Skip commits we can't parse
 		}
@@ -252,8 +367,12 @@ func markReachableFromObjectRepo(repo *core.Repository, hash string, reachable m
 			return err
 		}
 
-		// Mark parent commits
+		// Mark parent commits. A missing parent means history is truncated, and
+		// pruning on top of a broken graph could delete objects still in use.
 		for _, parent := range commit.Parents {
+			if len(parent) < 4 || !objects.HasObjectRepo(repo, parent) {
+				return fmt.Errorf("%w: parent %s of commit %s is missing", objects.ErrCorruptGraph, parent, hash)
+			}
 			if err := markReachableFromObjectRepo(repo, parent, reachable); err != nil {
 				return err
 			}
@@ -263,6 +382,15 @@ func markReachableFromObjectRepo(repo *core.Repository, hash string, reachable m
 		if err := markReachableFromTreeRepo(repo, hash, reachable); err != nil {
 			return err
 		}
+
+	case "tag":
+		tag, err := objects.GetTagRepo(repo, hash)
+		if err != nil {
+			return nil // Skip tags we can't parse
+		}
+		if err := markReachableFromObjectRepo(repo, tag.Object, reachable); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -280,6 +408,9 @@ func markReachableFromTreeRepo(repo *core.Repository, treeHash string, reachable
 
 	// Mark each entry
 	for _, entry := range tree.Entries {
+		if entry.IsGitlink() {
+			continue
+		}
 		reachable[entry.Hash] = true
 
 		// Recursively mark subtrees
@@ -339,9 +470,10 @@ func findAllObjectsRepo(repo *core.Repository) ([]ObjectInfo, error) {
 		}
 
 		objects = append(objects, ObjectInfo{
-			Hash: hash,
-			Path: path,
-			Size: info.Size(),
+			Hash:    hash,
+			Path:    path,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
 		})
 
 		return nil
@@ -0,0 +1,66 @@
+package maintenance
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/config"
+	"github.com/NahomAnteneh/vec/internal/remote"
+)
+
+// PrefetchKey, true by default, lets the prefetch task run; false turns it
+// off for every remote, remote.<name>.prefetch = false for one
+const PrefetchKey = "maintenance.prefetch"
+
+// PrefetchEnabled reports whether maintenance.prefetch leaves the prefetch
+// task on
+func PrefetchEnabled(repo *core.Repository) bool {
+	value, err := repo.GetConfig(PrefetchKey)
+	if err != nil {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "false", "no", "off", "0":
+		return false
+	}
+	return true
+}
+
+// PrefetchRemotesRepo prefetches every configured remote not opted out
+// into refs/prefetch/ and drops the prefetch refs of removed remotes. A
+// remote that fails doesn't stop the others; their errors are returned
+// together. Returns the number of prefetch refs written.
+func PrefetchRemotesRepo(repo *core.Repository) (int, error) {
+	if !PrefetchEnabled(repo) {
+		return 0, nil
+	}
+	cfg, err := config.LoadConfigRepo(repo)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load config: %w", err)
+	}
+	names := make([]string, 0, len(cfg.Remotes))
+	for name := range cfg.Remotes {
+		if remote.PrefetchEnabledRepo(repo, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	updated := 0
+	var errs []error
+	for _, name := range names {
+		result, err := remote.PrefetchRepo(repo, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("remote '%s': %w", name, err))
+			continue
+		}
+		updated += result.Updated
+	}
+	if _, err := remote.PrunePrefetchRefsRepo(repo); err != nil {
+		errs = append(errs, err)
+	}
+	return updated, errors.Join(errs...)
+}
@@ -0,0 +1,107 @@
+package maintenance
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/packfile"
+)
+
+// PrunePackedOptions defines options for removing loose copies of packed objects
+type PrunePackedOptions struct {
+	// Whether to only report what would be removed
+	DryRun bool
+	// Verbose output
+	Verbose bool
+}
+
+// PrunePackedStats contains statistics from a prune-packed run
+type PrunePackedStats struct {
+	// Number of loose objects found in a pack
+	ObjectsRemoved int
+	// Size of those loose objects in bytes
+	SpaceSaved int64
+}
+
+// PrunePackedRepo deletes loose objects that are also stored in a pack. An
+// object counts as packed only when a pack index lists it and the index
+// checks out against its pack, so a damaged pack never costs the loose copy.
+func PrunePackedRepo(repo *core.Repository, options PrunePackedOptions) (*PrunePackedStats, error) {
+	return prunePackedRepo(repo, options, nil)
+}
+
+// prunePackedRepo is PrunePackedRepo ignoring the objects in skip, which gc
+// is already removing as unreferenced
+func prunePackedRepo(repo *core.Repository, options PrunePackedOptions, skip map[string]bool) (*PrunePackedStats, error) {
+	stats := &PrunePackedStats{}
+
+	packed, err := packedObjectsRepo(repo, options.Verbose)
+	if err != nil {
+		return nil, err
+	}
+	if len(packed) == 0 {
+		return stats, nil
+	}
+
+	loose, err := findAllObjectsRepo(repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find loose objects: %w", err)
+	}
+
+	for _, obj := range loose {
+		if skip[obj.Hash] || !packed[obj.Hash] {
+			continue
+		}
+		if options.DryRun {
+			if options.Verbose {
+				fmt.Printf("Would remove packed object: %s (%d bytes)\n", obj.Hash, obj.Size)
+			}
+		} else {
+			if options.Verbose {
+				fmt.Printf("Removing packed object: %s\n", obj.Hash)
+			}
+			if err := os.Remove(obj.Path); err != nil {
+				return stats, fmt.Errorf("failed to remove object %s: %w", obj.Hash, err)
+			}
+			removeEmptyDir(filepath.Dir(obj.Path))
+		}
+		stats.ObjectsRemoved++
+		stats.SpaceSaved += obj.Size
+	}
+	return stats, nil
+}
+
+// packedObjectsRepo returns the IDs of all objects in valid packs under
+// .vec/objects/pack. Packs whose index is unreadable or doesn't match the
+// pack are skipped.
+func packedObjectsRepo(repo *core.Repository, verbose bool) (map[string]bool, error) {
+	indexes, err := filepath.Glob(filepath.Join(repo.VecDir, "objects", "pack", "*.idx"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pack indexes: %w", err)
+	}
+
+	packed := make(map[string]bool)
+	for _, indexPath := range indexes {
+		packPath := strings.TrimSuffix(indexPath, ".idx") + ".pack"
+		if !fileExists(packPath) {
+			continue
+		}
+		if err := packfile.VerifyPackIndex(indexPath, packPath); err != nil {
+			if verbose {
+				fmt.Printf("Skipping %s: %v\n", filepath.Base(packPath), err)
+			}
+			continue
+		}
+		index, err := packfile.ReadPackIndex(indexPath)
+		if err != nil {
+			continue
+		}
+		for hash := range index.Entries {
+			packed[hash] = true
+		}
+	}
+	return packed, nil
+}
@@ -0,0 +1,97 @@
+package maintenance
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/packfile"
+)
+
+// repackResult summarizes what packing the loose objects did
+type repackResult struct {
+	packed   int
+	packPath string
+}
+
+// repackLooseRepo writes the reachable loose objects no pack holds yet to
+// a new pack in .vec/objects/pack, named pack-<checksum>.pack, next to its
+// index. The loose copies stay; prunePackedRepo removes them once the new
+// index checks out against the pack.
+func repackLooseRepo(repo *core.Repository, loose []ObjectInfo, reachable map[string]bool, dryRun, verbose bool) (*repackResult, error) {
+	packed, err := packedObjectsRepo(repo, false)
+	if err != nil {
+		return nil, err
+	}
+	var hashes []string
+	for _, obj := range loose {
+		if reachable[obj.Hash] && !packed[obj.Hash] {
+			hashes = append(hashes, obj.Hash)
+		}
+	}
+	sort.Strings(hashes)
+	result := &repackResult{packed: len(hashes)}
+	if dryRun || len(hashes) == 0 {
+		return result, nil
+	}
+
+	tmpFile, err := core.CreateTempFile(repo.Root, "vec-repack", ".pack")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary pack: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	tmpFile.Close() // Reopened by the pack writer
+	defer core.RemoveTempFile(tmpPath + ".idx")
+	defer core.RemoveTempFile(tmpPath)
+	if err := packfile.CreatePackfileFromHashesRepo(repo, hashes, tmpPath, true); err != nil {
+		return nil, fmt.Errorf("failed to write pack: %w", err)
+	}
+	checksum, err := packChecksum(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	perms, err := repo.Permissions()
+	if err != nil {
+		return nil, err
+	}
+	packDir := filepath.Join(repo.VecDir, "objects", "pack")
+	if err := perms.MkdirAll(packDir); err != nil {
+		return nil, fmt.Errorf("failed to create pack directory: %w", err)
+	}
+	// The pack goes first: an index is what makes readers look at a pack
+	base := filepath.Join(packDir, "pack-"+checksum)
+	if err := os.Rename(tmpPath, base+".pack"); err != nil {
+		return nil, fmt.Errorf("failed to install pack: %w", err)
+	}
+	if err := os.Rename(tmpPath+".idx", base+".idx"); err != nil {
+		os.Remove(base + ".pack")
+		return nil, fmt.Errorf("failed to install pack index: %w", err)
+	}
+	result.packPath = base + ".pack"
+	if verbose {
+		fmt.Printf("Packed %d loose objects into %s\n", len(hashes), filepath.Base(result.packPath))
+	}
+	return result, nil
+}
+
+// packChecksum returns the trailing checksum of the pack at path in hex
+func packChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open pack: %w", err)
+	}
+	defer file.Close()
+	trailer := make([]byte, 20)
+	if _, err := file.Seek(-int64(len(trailer)), io.SeekEnd); err != nil {
+		return "", fmt.Errorf("failed to read pack checksum: %w", err)
+	}
+	if _, err := io.ReadFull(file, trailer); err != nil {
+		return "", fmt.Errorf("failed to read pack checksum: %w", err)
+	}
+	return hex.EncodeToString(trailer), nil
+}
@@ -0,0 +1,85 @@
+package maintenance
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/packfile"
+)
+
+// Maintenance tasks
+const (
+	TaskCommitGraph    = "commit-graph"
+	TaskMultiPackIndex = "multi-pack-index"
+	TaskPrefetch       = "prefetch"
+)
+
+// AutoKey, true by default, runs the maintenance tasks after each fetch
+const AutoKey = "maintenance.auto"
+
+// Tasks are the tasks run when none are named, in order
+var Tasks = []string{TaskCommitGraph, TaskMultiPackIndex}
+
+// KnownTasks are all the tasks that can be named. Prefetch talks to the
+// network, so it only runs when asked for, as the maintenance daemon does.
+var KnownTasks = []string{TaskCommitGraph, TaskMultiPackIndex, TaskPrefetch}
+
+// TaskResult reports what a task did
+type TaskResult struct {
+	Task  string
+	Added int // Commits added to the commit-graph, packs to the multi-pack-index, refs prefetched
+}
+
+// RunTasksRepo runs the named maintenance tasks, or all of them when none
+// are given, stopping at the first failure
+func RunTasksRepo(repo *core.Repository, tasks []string) ([]TaskResult, error) {
+	if len(tasks) == 0 {
+		tasks = Tasks
+	}
+	results := make([]TaskResult, 0, len(tasks))
+	for _, task := range tasks {
+		var added int
+		var err error
+		switch task {
+		case TaskCommitGraph:
+			added, err = objects.WriteCommitGraphRepo(repo)
+		case TaskMultiPackIndex:
+			added, err = packfile.WriteMultiPackIndexRepo(repo)
+		case TaskPrefetch:
+			added, err = PrefetchRemotesRepo(repo)
+		default:
+			return results, fmt.Errorf("unknown maintenance task '%s': expected %s", task, strings.Join(KnownTasks, ", "))
+		}
+		if err != nil {
+			return results, fmt.Errorf("%s task failed: %w", task, err)
+		}
+		results = append(results, TaskResult{Task: task, Added: added})
+	}
+	return results, nil
+}
+
+// AutoEnabled reports whether maintenance.auto leaves post-fetch
+// maintenance on
+func AutoEnabled(repo *core.Repository) bool {
+	value, err := repo.GetConfig(AutoKey)
+	if err != nil {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "false", "no", "off", "0":
+		return false
+	}
+	return true
+}
+
+// AfterFetchRepo brings the commit-graph and multi-pack-index up to date
+// with what a fetch brought in, unless maintenance.auto is off
+func AfterFetchRepo(repo *core.Repository) error {
+	if !AutoEnabled(repo) {
+		return nil
+	}
+	_, err := RunTasksRepo(repo, nil)
+	return err
+}
@@ -0,0 +1,249 @@
+package merge
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// MergeAlgorithm selects how the text merge lines up the three versions of
+// a file.
+type MergeAlgorithm string
+
+const (
+	MergeAlgorithmDefault   MergeAlgorithm = ""          // the merge-algorithm attribute, else myers
+	MergeAlgorithmMyers     MergeAlgorithm = "myers"     // patch ours onto theirs, positional conflicts
+	MergeAlgorithmPatience  MergeAlgorithm = "patience"  // anchor on lines unique to both sides
+	MergeAlgorithmHistogram MergeAlgorithm = "histogram" // patience, falling back to the rarest common line
+	MergeAlgorithmUnion     MergeAlgorithm = "union"     // patience, keeping both sides of conflicts
+)
+
+// MergeAlgorithmAttr chooses the algorithm per path in .vecattributes
+const MergeAlgorithmAttr = "merge-algorithm"
+
+// ParseMergeAlgorithm validates an algorithm name from -X or an attribute
+func ParseMergeAlgorithm(name string) (MergeAlgorithm, error) {
+	switch algorithm := MergeAlgorithm(name); algorithm {
+	case MergeAlgorithmMyers, MergeAlgorithmPatience, MergeAlgorithmHistogram, MergeAlgorithmUnion:
+		return algorithm, nil
+	}
+	return "", fmt.Errorf("unknown merge algorithm '%s' (expected myers, patience, histogram or union)", name)
+}
+
+// resolveMergeAlgorithm returns algorithm, or the merge-algorithm attribute
+// of filePath when algorithm is the default
+func resolveMergeAlgorithm(repoRoot, filePath string, algorithm MergeAlgorithm) (MergeAlgorithm, error) {
+	if algorithm != MergeAlgorithmDefault {
+		return algorithm, nil
+	}
+	attr, err := core.GetAttribute(repoRoot, filePath, MergeAlgorithmAttr)
+	if err != nil {
+		return "", err
+	}
+	switch attr.Value {
+	case core.AttrUnspecified, core.AttrSet, core.AttrUnset:
+		return MergeAlgorithmMyers, nil
+	}
+	algorithm, err = ParseMergeAlgorithm(attr.Value)
+	if err != nil {
+		return "", fmt.Errorf("%s:%d: %w", attr.Source, attr.Line, err)
+	}
+	return algorithm, nil
+}
+
+// lineMatch pairs a line of one version with an equal line of another
+type lineMatch struct {
+	a, b int
+}
+
+// matchLines returns increasing pairs of equal lines of a and b. Common
+// prefixes and suffixes match first; in between, lines occurring once in
+// each side anchor the match, found with a longest increasing subsequence,
+// and each gap is matched recursively. With histogram, a gap without unique
+// lines is split on its least frequent common line.
+func matchLines(a, b []string, histogram bool) []lineMatch {
+	var matches []lineMatch
+	matchLineRange(a, b, 0, len(a), 0, len(b), histogram, &matches)
+	return matches
+}
+
+func matchLineRange(a, b []string, aLo, aHi, bLo, bHi int, histogram bool, matches *[]lineMatch) {
+	for aLo < aHi && bLo < bHi && a[aLo] == b[bLo] {
+		*matches = append(*matches, lineMatch{aLo, bLo})
+		aLo++
+		bLo++
+	}
+	var suffix []lineMatch
+	for aLo < aHi && bLo < bHi && a[aHi-1] == b[bHi-1] {
+		aHi--
+		bHi--
+		suffix = append(suffix, lineMatch{aHi, bHi})
+	}
+	defer func() {
+		for i := len(suffix) - 1; i >= 0; i-- {
+			*matches = append(*matches, suffix[i])
+		}
+	}()
+	if aLo == aHi || bLo == bHi {
+		return
+	}
+
+	countA, countB := make(map[string]int), make(map[string]int)
+	posB := make(map[string]int)
+	for i := aLo; i < aHi; i++ {
+		countA[a[i]]++
+	}
+	for j := bLo; j < bHi; j++ {
+		if countB[b[j]] == 0 {
+			posB[b[j]] = j
+		}
+		countB[b[j]]++
+	}
+
+	var unique []lineMatch
+	for i := aLo; i < aHi; i++ {
+		if countA[a[i]] == 1 && countB[a[i]] == 1 {
+			unique = append(unique, lineMatch{i, posB[a[i]]})
+		}
+	}
+	anchors := longestIncreasingMatches(unique)
+
+	if len(anchors) == 0 && histogram {
+		// Split on the first occurrence of the rarest line both sides share
+		best := -1
+		for i := aLo; i < aHi; i++ {
+			if countB[a[i]] == 0 {
+				continue
+			}
+			if best < 0 || countA[a[i]]+countB[a[i]] < countA[a[best]]+countB[a[best]] {
+				best = i
+			}
+		}
+		if best >= 0 {
+			anchors = []lineMatch{{best, posB[a[best]]}}
+		}
+	}
+
+	prevA, prevB := aLo, bLo
+	for _, anchor := range anchors {
+		matchLineRange(a, b, prevA, anchor.a, prevB, anchor.b, histogram, matches)
+		*matches = append(*matches, anchor)
+		prevA, prevB = anchor.a+1, anchor.b+1
+	}
+	if len(anchors) > 0 {
+		matchLineRange(a, b, prevA, aHi, prevB, bHi, histogram, matches)
+	}
+}
+
+// longestIncreasingMatches returns the longest subsequence of matches, which
+// are sorted by a, that is also increasing in b (patience sorting)
+func longestIncreasingMatches(matches []lineMatch) []lineMatch {
+	if len(matches) == 0 {
+		return nil
+	}
+	var piles []int // Index into matches of the top of each pile
+	prev := make([]int, len(matches))
+	for i, m := range matches {
+		lo, hi := 0, len(piles)
+		for lo < hi {
+			mid := (lo + hi) / 2
+			if matches[piles[mid]].b < m.b {
+				lo = mid + 1
+			} else {
+				hi = mid
+			}
+		}
+		prev[i] = -1
+		if lo > 0 {
+			prev[i] = piles[lo-1]
+		}
+		if lo == len(piles) {
+			piles = append(piles, i)
+		} else {
+			piles[lo] = i
+		}
+	}
+
+	result := make([]lineMatch, len(piles))
+	for i, k := len(piles)-1, piles[len(piles)-1]; i >= 0; i, k = i-1, prev[k] {
+		result[i] = matches[k]
+	}
+	return result
+}
+
+// mergeLinesThreeWay merges ours and theirs against base using lines all
+// three share as sync points. Between them a region changed on one side
+// takes that side, and one changed identically on both takes either;
+// otherwise it conflicts, written with markers or, with union, as our lines
+// followed by theirs.
+func mergeLinesThreeWay(baseText, oursText, theirsText string, histogram, union bool) (string, bool) {
+	base := strings.Split(baseText, "\n")
+	ours := strings.Split(oursText, "\n")
+	theirs := strings.Split(theirsText, "\n")
+
+	inOurs := make(map[int]int)
+	for _, m := range matchLines(base, ours, histogram) {
+		inOurs[m.a] = m.b
+	}
+	inTheirs := make(map[int]int)
+	for _, m := range matchLines(base, theirs, histogram) {
+		inTheirs[m.a] = m.b
+	}
+
+	var merged []string
+	conflicts := false
+	mergeRegion := func(b, o, t []string) {
+		switch {
+		case equalLines(o, b):
+			merged = append(merged, t...)
+		case equalLines(t, b), equalLines(o, t):
+			merged = append(merged, o...)
+		case union:
+			merged = append(merged, o...)
+			merged = append(merged, t...)
+		default:
+			conflicts = true
+			merged = append(merged, ConflictMarkerStart+"ours")
+			merged = append(merged, o...)
+			merged = append(merged, ConflictMarkerSeparator)
+			merged = append(merged, t...)
+			merged = append(merged, ConflictMarkerEnd+"theirs")
+		}
+	}
+
+	i, o, t := 0, 0, 0
+	for j := range base {
+		oj, okOurs := inOurs[j]
+		tj, okTheirs := inTheirs[j]
+		if !okOurs || !okTheirs || oj < o || tj < t {
+			continue
+		}
+		mergeRegion(base[i:j], ours[o:oj], theirs[t:tj])
+		merged = append(merged, base[j])
+		i, o, t = j+1, oj+1, tj+1
+	}
+	mergeRegion(base[i:], ours[o:], theirs[t:])
+
+	return strings.Join(merged, "\n"), conflicts
+}
+
+// MergeText merges ours and theirs against base with the patience line
+// matching merges use, marking conflicting regions, and reports whether any
+// region conflicted
+func MergeText(baseText, oursText, theirsText string) (string, bool) {
+	return mergeLinesThreeWay(baseText, oursText, theirsText, false, false)
+}
+
+// equalLines reports whether a and b hold the same lines
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -44,8 +44,18 @@ func resolveConflict(repoRoot string, index *staging.Index, filePath, baseHash,
 		// For recursive, fall through for interactive/manual merge.
 	}
 
+	// A merge driver assigned in .vecattributes takes over from the text merge
+	handled, err := runMergeDriver(repoRoot, index, filePath, baseHash, ourHash, theirHash, baseMode, ourMode, theirMode)
+	if err != nil || handled {
+		return err
+	}
+
 	// Attempt content-based merge using mergeFiles
-	mergeResult, err := mergeFiles(baseHash, ourHash, theirHash, filePath, repoRoot, config.Strategy)
+	algorithm, err := resolveMergeAlgorithm(repoRoot, filePath, config.Algorithm)
+	if err != nil {
+		return err
+	}
+	mergeResult, err := mergeFiles(baseHash, ourHash, theirHash, filePath, repoRoot, config.Strategy, algorithm)
 	if err != nil {
 		return fmt.Errorf("failed to merge file contents: %w", err)
 	}
@@ -167,8 +177,12 @@ func writeConflictFile(repoRoot string, index *staging.Index, filePath, baseHash
 	if err := os.WriteFile(absPath, conflictContent.Bytes(), os.FileMode(mode)); err != nil {
 		return fmt.Errorf("failed to write conflict file '%s': %w", filePath, err)
 	}
+	return addConflictEntries(repoRoot, index, filePath, baseHash, ourHash, theirHash, baseMode, ourMode, theirMode)
+}
 
-	// Update index conflict entries.
+// addConflictEntries replaces the stage 0 entry of filePath with its base,
+// our and their versions as stages 1 to 3.
+func addConflictEntries(repoRoot string, index *staging.Index, filePath, baseHash, ourHash, theirHash string, baseMode, ourMode, theirMode int32) error {
 	if err := index.Remove(repoRoot, filePath); err != nil {
 		return fmt.Errorf("failed to remove stage 0 entry for '%s': %w", filePath, err)
 	}
@@ -10,7 +10,7 @@ import (
 )
 
 // mergeFiles merges the content of two files against a common base version.
-func mergeFiles(baseSha, oursSha, theirsSha, path string, repoRoot string, strategy MergeStrategy) (MergeResult, error) {
+func mergeFiles(baseSha, oursSha, theirsSha, path string, repoRoot string, strategy MergeStrategy, algorithm MergeAlgorithm) (MergeResult, error) {
 	// Initialize result with known file identifiers
 	result := MergeResult{
 		Path:      path,
@@ -76,16 +76,22 @@ func mergeFiles(baseSha, oursSha, theirsSha, path string, repoRoot string, strat
 		return result, nil
 	}
 
-	// Use diffmatchpatch library for text merging
-	dmp := diffmatchpatch.New()
-
 	// Convert byte arrays to strings
 	baseText := string(baseContent)
 	oursText := string(oursContent)
 	theirsText := string(theirsContent)
 
-	// Perform the merge using the diffmatchpatch library
-	mergedText, hasConflicts := performThreeWayMerge(dmp, baseText, oursText, theirsText)
+	var mergedText string
+	var hasConflicts bool
+	switch algorithm {
+	case MergeAlgorithmPatience, MergeAlgorithmHistogram, MergeAlgorithmUnion:
+		mergedText, hasConflicts = mergeLinesThreeWay(baseText, oursText, theirsText,
+			algorithm == MergeAlgorithmHistogram, algorithm == MergeAlgorithmUnion)
+	default:
+		// Use diffmatchpatch library for text merging
+		dmp := diffmatchpatch.New()
+		mergedText, hasConflicts = performThreeWayMerge(dmp, baseText, oursText, theirsText)
+	}
 
 	if hasConflicts {
 		result.HasConflicts = true
@@ -0,0 +1,213 @@
+package merge
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/staging"
+)
+
+// Built-in merge drivers, chosen with merge=<driver> in .vecattributes.
+// Any other name runs the command in merge.<driver>.driver.
+const (
+	MergeDriverText   = "text"   // Line-based three-way merge with conflict markers
+	MergeDriverBinary = "binary" // Keep our version and leave the path conflicted; also -merge
+	MergeDriverUnion  = "union"  // Keep both sides of conflicting lines, without markers
+	MergeDriverOurs   = "ours"   // Keep our version and resolve the path
+)
+
+// mergeDriverVersions holds the three versions of a path being merged
+type mergeDriverVersions struct {
+	base, ours, theirs []byte
+}
+
+// runMergeDriver merges filePath with the driver its merge attribute names.
+// handled is false when the generic text merge should run: the attribute is
+// unset, set, text, or names a driver without a configured command.
+func runMergeDriver(repoRoot string, index *staging.Index, filePath, baseHash, ourHash, theirHash string, baseMode, ourMode, theirMode int32) (handled bool, err error) {
+	if ourHash == "" || theirHash == "" {
+		return false, nil // Modify/delete conflicts have nothing to merge
+	}
+	attr, err := core.GetAttribute(repoRoot, filePath, "merge")
+	if err != nil {
+		return false, err
+	}
+	driver := attr.Value
+	switch driver {
+	case core.AttrUnspecified, core.AttrSet, MergeDriverText:
+		return false, nil
+	case core.AttrUnset:
+		driver = MergeDriverBinary
+	}
+
+	var command string
+	if !isBuiltinMergeDriver(driver) {
+		key := fmt.Sprintf("merge.%s.driver", driver)
+		if command, err = core.GetConfigValue(repoRoot, key); err != nil {
+			return false, core.ConfigError("failed to read "+key, err)
+		}
+		if command == "" {
+			return false, nil
+		}
+	}
+
+	versions, err := loadMergeDriverVersions(repoRoot, baseHash, ourHash, theirHash)
+	if err != nil {
+		return false, err
+	}
+	mode := ourMode
+	if mode == 0 {
+		mode = theirMode
+	}
+
+	switch driver {
+	case MergeDriverOurs:
+		return true, stageMergedContent(repoRoot, index, filePath, versions.ours, mode)
+	case MergeDriverBinary:
+		if err := writeWorkingFile(repoRoot, filePath, versions.ours, mode); err != nil {
+			return true, err
+		}
+		fmt.Printf("warning: cannot merge binary file %s, keeping our version\n", filePath)
+		return true, addConflictEntries(repoRoot, index, filePath, baseHash, ourHash, theirHash, baseMode, ourMode, theirMode)
+	case MergeDriverUnion:
+		merged, _ := mergeLinesThreeWay(string(versions.base), string(versions.ours), string(versions.theirs), false, true)
+		return true, stageMergedContent(repoRoot, index, filePath, []byte(merged), mode)
+	}
+
+	merged, clean, err := runExternalMergeDriver(repoRoot, filePath, command, versions)
+	if err != nil {
+		return true, err
+	}
+	if clean {
+		return true, stageMergedContent(repoRoot, index, filePath, merged, mode)
+	}
+	if err := writeWorkingFile(repoRoot, filePath, merged, mode); err != nil {
+		return true, err
+	}
+	return true, addConflictEntries(repoRoot, index, filePath, baseHash, ourHash, theirHash, baseMode, ourMode, theirMode)
+}
+
+// isBuiltinMergeDriver reports whether driver is implemented by vec itself
+func isBuiltinMergeDriver(driver string) bool {
+	switch driver {
+	case MergeDriverText, MergeDriverBinary, MergeDriverUnion, MergeDriverOurs:
+		return true
+	}
+	return false
+}
+
+// loadMergeDriverVersions reads the blobs of the three versions; a missing
+// base (both sides added the path) is empty
+func loadMergeDriverVersions(repoRoot, baseHash, ourHash, theirHash string) (*mergeDriverVersions, error) {
+	repo := core.NewRepository(repoRoot)
+	versions := &mergeDriverVersions{}
+	for _, v := range []struct {
+		hash string
+		dst  *[]byte
+	}{{baseHash, &versions.base}, {ourHash, &versions.ours}, {theirHash, &versions.theirs}} {
+		if v.hash == "" {
+			continue
+		}
+		content, err := objects.GetBlobRepo(repo, v.hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get blob '%s': %w", v.hash, err)
+		}
+		*v.dst = content
+	}
+	return versions, nil
+}
+
+// runExternalMergeDriver runs command with %O, %A and %B replaced by files
+// holding the base, our and their versions, %P by the path and %L by the
+// conflict marker size. The driver leaves its result in the %A file; a zero
+// exit status means it merged cleanly.
+func runExternalMergeDriver(repoRoot, filePath, command string, versions *mergeDriverVersions) ([]byte, bool, error) {
+	files := make(map[string]string, 3)
+	defer func() {
+		for _, name := range files {
+			core.RemoveTempFile(name)
+		}
+	}()
+	for _, v := range []struct {
+		placeholder string
+		content     []byte
+	}{{"%O", versions.base}, {"%A", versions.ours}, {"%B", versions.theirs}} {
+		file, err := core.CreateTempFile(repoRoot, "merge-driver", "_"+filepath.Base(filePath))
+		if err != nil {
+			return nil, false, err
+		}
+		files[v.placeholder] = file.Name()
+		_, err = file.Write(v.content)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to write merge driver input: %w", err)
+		}
+	}
+
+	expanded := strings.NewReplacer(
+		"%O", shellQuote(files["%O"]),
+		"%A", shellQuote(files["%A"]),
+		"%B", shellQuote(files["%B"]),
+		"%P", shellQuote(filePath),
+		"%L", fmt.Sprint(len(ConflictMarkerSeparator)),
+		"%%", "%",
+	).Replace(command)
+
+	execCmd := exec.Command("sh", "-c", expanded)
+	execCmd.Dir = repoRoot
+	execCmd.Stdout = os.Stdout
+	execCmd.Stderr = os.Stderr
+	runErr := execCmd.Run()
+	var exitErr *exec.ExitError
+	if runErr != nil && !errors.As(runErr, &exitErr) {
+		return nil, false, fmt.Errorf("failed to run merge driver for '%s': %w", filePath, runErr)
+	}
+
+	merged, err := os.ReadFile(files["%A"])
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read merge driver result for '%s': %w", filePath, err)
+	}
+	return merged, runErr == nil, nil
+}
+
+// shellQuote quotes s as a single sh word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// writeWorkingFile writes content to filePath in the working tree
+func writeWorkingFile(repoRoot, filePath string, content []byte, mode int32) error {
+	perm := os.FileMode(0644)
+	if mode == objects.ModeExecutable {
+		perm = 0755
+	}
+	if err := os.WriteFile(filepath.Join(repoRoot, filePath), content, perm); err != nil {
+		return fmt.Errorf("failed to write merged file '%s': %w", filePath, err)
+	}
+	return nil
+}
+
+// stageMergedContent writes a cleanly merged result to the working tree and
+// the index
+func stageMergedContent(repoRoot string, index *staging.Index, filePath string, content []byte, mode int32) error {
+	if err := writeWorkingFile(repoRoot, filePath, content, mode); err != nil {
+		return err
+	}
+	repo := core.NewRepository(repoRoot)
+	blobHash, err := objects.CreateBlobRepo(repo, content)
+	if err != nil {
+		return fmt.Errorf("failed to create blob for '%s': %w", filePath, err)
+	}
+	if err := index.Add(repo, filePath, blobHash); err != nil {
+		return fmt.Errorf("failed to update index for '%s': %w", filePath, err)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package merge
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -22,10 +23,48 @@ const (
 	MergeStrategyTheirs    MergeStrategy = "theirs"    // always use their changes
 )
 
+// FastForwardMode decides between fast-forwarding and creating a merge commit.
+type FastForwardMode string
+
+const (
+	FastForwardDefault FastForwardMode = ""        // use merge.ff, allowing fast-forwards if unset
+	FastForwardAllow   FastForwardMode = "ff"      // fast-forward when possible (--ff, merge.ff=true)
+	FastForwardNever   FastForwardMode = "no-ff"   // always create a merge commit (--no-ff, merge.ff=false)
+	FastForwardOnly    FastForwardMode = "ff-only" // refuse to merge unless fast-forwarding (--ff-only, merge.ff=only)
+)
+
 // MergeConfig holds options to influence merge behavior.
 type MergeConfig struct {
-	Strategy    MergeStrategy // Strategy for conflict resolution
-	Interactive bool          // Whether to prompt user interactively on conflicts
+	Strategy    MergeStrategy   // Strategy for conflict resolution
+	Interactive bool            // Whether to prompt user interactively on conflicts
+	FastForward FastForwardMode // Fast-forward policy
+	Squash      bool            // Stage the merged tree without committing or moving HEAD
+	Algorithm   MergeAlgorithm  // Text merge algorithm; the merge-algorithm attribute if unset
+
+	NoVerifySignatures bool // Skip merge.verifySignatures for this merge
+}
+
+// ErrNotFastForward is returned with FastForwardOnly when the histories have diverged
+var ErrNotFastForward = errors.New("not possible to fast-forward, aborting")
+
+// resolveFastForwardMode returns mode, or the merge.ff setting when mode is the default
+func resolveFastForwardMode(repo *core.Repository, mode FastForwardMode) (FastForwardMode, error) {
+	if mode != FastForwardDefault {
+		return mode, nil
+	}
+	value, err := repo.GetConfig("merge.ff")
+	if err != nil {
+		return mode, core.ConfigError("failed to read merge.ff", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "true":
+		return FastForwardAllow, nil
+	case "false":
+		return FastForwardNever, nil
+	case "only":
+		return FastForwardOnly, nil
+	}
+	return mode, core.ConfigError(fmt.Sprintf("invalid merge.ff '%s' (expected true, false or only)", value), nil)
 }
 
 // MergeResult captures the outcome of the merge operation.
@@ -39,6 +78,30 @@ type MergeResult struct {
 	Content      []byte
 }
 
+// resolveMergeSource returns the commit to merge for source, which is either a
+// local branch name, a remote-tracking branch such as origin/main, or
+// FETCH_HEAD (the ref marked for merge by the last fetch).
+func resolveMergeSource(repo *core.Repository, source string) (string, error) {
+	if source == core.FetchHeadFile {
+		commitID, err := core.ResolveFetchHead(repo.Root)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve FETCH_HEAD: %w", err)
+		}
+		return commitID, nil
+	}
+
+	sourceBranchFile := filepath.Join(repo.VecDir, "refs", "heads", source)
+	sourceCommitIDBytes, err := os.ReadFile(sourceBranchFile)
+	if os.IsNotExist(err) {
+		// A remote-tracking branch, as pull merges
+		sourceCommitIDBytes, err = os.ReadFile(filepath.Join(repo.VecDir, "refs", "remotes", source))
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read source branch '%s': %w", source, err)
+	}
+	return strings.TrimSpace(string(sourceCommitIDBytes)), nil
+}
+
 // Merge performs a merge of the sourceBranch into the current branch.
 // Legacy function that calls MergeRepo with a repository context.
 func Merge(repoRoot, sourceBranch string, config *MergeConfig) (bool, error) {
@@ -53,6 +116,13 @@ func MergeRepo(repo *core.Repository, sourceBranch string, config *MergeConfig)
 		// Default to recursive (normal three-way merge with conflict markers) and non-interactive.
 		config = &MergeConfig{Strategy: MergeStrategyRecursive, Interactive: false}
 	}
+	ffMode, err := resolveFastForwardMode(repo, config.FastForward)
+	if err != nil {
+		return false, err
+	}
+	if config.Squash && config.FastForward == FastForwardNever {
+		return false, fmt.Errorf("cannot combine --squash with --no-ff")
+	}
 
 	// Validate repository and load index.
 	vecDir := repo.VecDir
@@ -83,40 +153,72 @@ func MergeRepo(repo *core.Repository, sourceBranch string, config *MergeConfig)
 	}
 
 	// Load source branch commit.
-	sourceBranchFile := filepath.Join(vecDir, "refs", "heads", sourceBranch)
-	sourceCommitIDBytes, err := os.ReadFile(sourceBranchFile)
+	sourceCommitID, err := resolveMergeSource(repo, sourceBranch)
 	if err != nil {
-		return false, fmt.Errorf("failed to read source branch '%s': %w", sourceBranch, err)
+		return false, err
 	}
-	sourceCommitID := strings.TrimSpace(string(sourceCommitIDBytes))
 
 	// Prevent self-merge.
 	if currentBranch == sourceBranch {
 		return false, fmt.Errorf("cannot merge a branch with itself")
 	}
 
-	// Find merge base.
-	baseCommitID, err := findMergeBase(repo.Root, headCommitID, sourceCommitID)
+	// Find merge base; several are possible after criss-cross merges, take the newest
+	bases, err := objects.MergeBasesRepo(repo, headCommitID, sourceCommitID)
 	if err != nil {
 		return false, fmt.Errorf("failed to find merge base: %w", err)
 	}
+	if len(bases) == 0 {
+		return false, fmt.Errorf("refusing to merge unrelated histories")
+	}
+	baseCommitID := bases[0]
+	if baseCommitID != sourceCommitID && !config.NoVerifySignatures {
+		if err := VerifyIncomingSignaturesRepo(repo, headCommitID, sourceCommitID); err != nil {
+			return false, err
+		}
+	}
 
 	// Handle fast-forward or already up-to-date cases.
+	if baseCommitID == headCommitID && config.Squash {
+		// The squashed result is the source tree, staged on top of HEAD.
+		theirCommit, err := objects.GetCommitRepo(repo, sourceCommitID)
+		if err != nil {
+			return false, fmt.Errorf("failed to load their commit: %w", err)
+		}
+		if err := checkoutTreeRepo(repo, theirCommit.Tree); err != nil {
+			return false, err
+		}
+		if err := writeSquashMessageRepo(repo, sourceBranch, headCommitID, sourceCommitID); err != nil {
+			return false, err
+		}
+		fmt.Println("Squash commit -- not updating HEAD")
+		return false, nil
+	}
+	if baseCommitID == headCommitID && ffMode == FastForwardNever {
+		// Forced merge commit: the result is exactly the source tree.
+		return false, mergeWithoutFastForwardRepo(repo, currentBranch, sourceBranch, headCommitID, sourceCommitID)
+	}
 	if baseCommitID == headCommitID {
 		// Fast-forward: current branch is behind source branch.
 		if err := CheckoutCommitRepo(repo, sourceCommitID); err != nil {
 			return false, fmt.Errorf("failed to checkout source commit for fast-forward: %w", err)
 		}
-		branchFile := filepath.Join(vecDir, "refs", "heads", currentBranch)
-		if err := os.WriteFile(branchFile, []byte(sourceCommitID), 0644); err != nil {
+		if err := repo.WriteRef("refs/heads/"+currentBranch, sourceCommitID); err != nil {
 			return false, fmt.Errorf("failed to update branch pointer: %w", err)
 		}
+		if err := recordMergeRepo(repo, currentBranch, headCommitID, sourceCommitID,
+			fmt.Sprintf("merge %s: Fast-forward", sourceBranch)); err != nil {
+			return false, err
+		}
 		fmt.Println("Fast-forward merge completed.")
 		return true, nil
 	} else if baseCommitID == sourceCommitID {
 		// Already up-to-date.
 		return false, fmt.Errorf("already up-to-date")
 	}
+	if ffMode == FastForwardOnly {
+		return false, ErrNotFastForward
+	}
 
 	// Load commit objects.
 	baseCommit, err := objects.GetCommit(repo.Root, baseCommitID)
@@ -157,11 +259,22 @@ func MergeRepo(repo *core.Repository, sourceBranch string, config *MergeConfig)
 		return false, fmt.Errorf("failed to write index: %w", err)
 	}
 
+	if config.Squash {
+		if err := writeSquashMessageRepo(repo, sourceBranch, headCommitID, sourceCommitID); err != nil {
+			return false, err
+		}
+	}
+
 	if result.HasConflicts {
 		fmt.Println("Merge conflicts detected. Please resolve them and commit the result.")
 		return true, nil
 	}
 
+	if config.Squash {
+		fmt.Println("Squash commit -- not updating HEAD")
+		return false, nil
+	}
+
 	// Create tree from merged index.
 	treeID, err := staging.CreateTreeFromIndex(repo.Root, index)
 	if err != nil {
@@ -174,7 +287,10 @@ func MergeRepo(repo *core.Repository, sourceBranch string, config *MergeConfig)
 	if committer == "" {
 		committer = author
 	}
-	message := fmt.Sprintf("Merge branch '%s' into %s", sourceBranch, currentBranch)
+	message, err := MergeMessageRepo(repo, sourceBranch, currentBranch, headCommitID, sourceCommitID)
+	if err != nil {
+		return false, err
+	}
 	timestamp := time.Now().Unix()
 	commitHash, err := objects.CreateCommit(repo.Root, treeID, []string{headCommitID, sourceCommitID}, author, committer, message, timestamp)
 	if err != nil {
@@ -182,11 +298,70 @@ func MergeRepo(repo *core.Repository, sourceBranch string, config *MergeConfig)
 	}
 
 	// Update branch pointer.
-	branchFile := filepath.Join(vecDir, "refs", "heads", currentBranch)
-	if err := os.WriteFile(branchFile, []byte(commitHash), 0644); err != nil {
+	if err := repo.WriteRef("refs/heads/"+currentBranch, commitHash); err != nil {
 		return false, fmt.Errorf("failed to update branch pointer: %w", err)
 	}
+	if err := recordMergeRepo(repo, currentBranch, headCommitID, commitHash,
+		fmt.Sprintf("merge %s: Merge made by the '%s' strategy.", sourceBranch, config.Strategy)); err != nil {
+		return false, err
+	}
 
 	fmt.Println("Merge completed successfully.")
 	return false, nil
 }
+
+// mergeWithoutFastForwardRepo records a merge commit for a source that could
+// have been fast-forwarded (--no-ff). Its tree is the source tree and its
+// parents are, in order, HEAD and the merged tip.
+func mergeWithoutFastForwardRepo(repo *core.Repository, currentBranch, sourceBranch, headCommitID, sourceCommitID string) error {
+	ourCommit, err := objects.GetCommitRepo(repo, headCommitID)
+	if err != nil {
+		return fmt.Errorf("failed to load our commit: %w", err)
+	}
+	theirCommit, err := objects.GetCommitRepo(repo, sourceCommitID)
+	if err != nil {
+		return fmt.Errorf("failed to load their commit: %w", err)
+	}
+
+	if err := CheckoutCommit(repo, sourceCommitID); err != nil {
+		return fmt.Errorf("failed to checkout source commit: %w", err)
+	}
+
+	committer := ourCommit.Committer
+	if committer == "" {
+		committer = ourCommit.Author
+	}
+	message, err := MergeMessageRepo(repo, sourceBranch, currentBranch, headCommitID, sourceCommitID)
+	if err != nil {
+		return err
+	}
+	commitHash, err := objects.CreateCommitRepo(repo, theirCommit.Tree, []string{headCommitID, sourceCommitID},
+		ourCommit.Author, committer, message, 0)
+	if err != nil {
+		return fmt.Errorf("failed to create merge commit: %w", err)
+	}
+
+	if err := repo.WriteRef("refs/heads/"+currentBranch, commitHash); err != nil {
+		return fmt.Errorf("failed to update branch pointer: %w", err)
+	}
+	if err := recordMergeRepo(repo, currentBranch, headCommitID, commitHash,
+		fmt.Sprintf("merge %s: Merge made without fast-forward (--no-ff).", sourceBranch)); err != nil {
+		return err
+	}
+
+	fmt.Println("Merge completed successfully (no fast-forward).")
+	return nil
+}
+
+// recordMergeRepo logs a merge that moved branch from oldCommit to newCommit:
+// ORIG_HEAD keeps the pre-merge commit, and the reflog and undo journal get
+// an entry so vec undo can take the merge back
+func recordMergeRepo(repo *core.Repository, branch, oldCommit, newCommit, message string) error {
+	if err := repo.WriteOrigHead(oldCommit); err != nil {
+		return err
+	}
+	if err := repo.AppendReflog(branch, oldCommit, newCommit, message); err != nil {
+		return err
+	}
+	return repo.RecordRefMove("refs/heads/"+branch, oldCommit, newCommit, message)
+}
@@ -0,0 +1,135 @@
+package merge
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/staging"
+	"github.com/NahomAnteneh/vec/utils"
+)
+
+// TreeFile is one file of a tree merged in memory
+type TreeFile struct {
+	Hash    string
+	Mode    int32
+	content []byte // Merge result not stored as a blob; nil to read Hash
+}
+
+// TreeFiles is a tree as its files by path
+type TreeFiles map[string]TreeFile
+
+// TreeFilesRepo reads the files of treeID; an empty treeID has none
+func TreeFilesRepo(repo *core.Repository, treeID string) (TreeFiles, error) {
+	index, err := staging.IndexFromTreeRepo(repo, treeID)
+	if err != nil {
+		return nil, core.ObjectError("failed to read tree", err)
+	}
+	files := make(TreeFiles, len(index.Entries))
+	for _, entry := range index.Entries {
+		files[entry.FilePath] = TreeFile{Hash: entry.SHA256, Mode: entry.Mode}
+	}
+	return files, nil
+}
+
+// Equal reports whether both trees hold the same files
+func (t TreeFiles) Equal(other TreeFiles) bool {
+	if len(t) != len(other) {
+		return false
+	}
+	for path, file := range t {
+		if o, ok := other[path]; !ok || o.Hash != file.Hash || o.Mode != file.Mode {
+			return false
+		}
+	}
+	return true
+}
+
+// MergeTreeRepo merges the changes from base to theirs into ours in memory,
+// writing nothing, and returns the result with the paths that would
+// conflict. Paths changed on both sides are merged line by line; one that
+// can't be, including any binary file, takes their version in the result,
+// as if resolved in its favour, so merges on top of it see the change.
+func MergeTreeRepo(repo *core.Repository, base, ours, theirs TreeFiles) (TreeFiles, []string, error) {
+	same := func(a TreeFile, inA bool, b TreeFile, inB bool) bool {
+		return inA == inB && (!inA || a.Hash == b.Hash && a.Mode == b.Mode)
+	}
+	paths := make(map[string]bool)
+	for _, files := range []TreeFiles{base, ours, theirs} {
+		for path := range files {
+			paths[path] = true
+		}
+	}
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	result := make(TreeFiles, len(ours))
+	var conflicts []string
+	for _, path := range sorted {
+		baseFile, inBase := base[path]
+		ourFile, inOurs := ours[path]
+		theirFile, inTheirs := theirs[path]
+
+		switch {
+		case same(baseFile, inBase, theirFile, inTheirs), same(ourFile, inOurs, theirFile, inTheirs):
+			// Unchanged on their side, or already as they made it
+			if inOurs {
+				result[path] = ourFile
+			}
+			continue
+		case same(baseFile, inBase, ourFile, inOurs):
+			// Only changed on their side
+			if inTheirs {
+				result[path] = theirFile
+			}
+			continue
+		}
+
+		merged, clean, err := mergeTreeFileRepo(repo, baseFile, inBase, ourFile, inOurs, theirFile, inTheirs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to merge '%s': %w", path, err)
+		}
+		if clean {
+			mode := theirFile.Mode
+			if mode == baseFile.Mode {
+				mode = ourFile.Mode
+			}
+			result[path] = TreeFile{Hash: utils.HashBytes("blob", merged), Mode: mode, content: merged}
+			continue
+		}
+		conflicts = append(conflicts, path)
+		if inTheirs {
+			result[path] = theirFile
+		}
+	}
+	return result, conflicts, nil
+}
+
+// mergeTreeFileRepo merges the three versions of a text file present on
+// every side; anything else doesn't merge cleanly
+func mergeTreeFileRepo(repo *core.Repository, base TreeFile, inBase bool, ours TreeFile, inOurs bool, theirs TreeFile, inTheirs bool) ([]byte, bool, error) {
+	if !inBase || !inOurs || !inTheirs {
+		return nil, false, nil
+	}
+	var contents [3][]byte
+	for i, file := range []TreeFile{base, ours, theirs} {
+		content := file.content
+		if content == nil {
+			var err error
+			if content, err = objects.GetBlobRepo(repo, file.Hash); err != nil {
+				return nil, false, err
+			}
+		}
+		if bytes.IndexByte(content, 0) >= 0 {
+			return nil, false, nil
+		}
+		contents[i] = content
+	}
+	merged, conflicts := MergeText(string(contents[0]), string(contents[1]), string(contents[2]))
+	return []byte(merged), !conflicts, nil
+}
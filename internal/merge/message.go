@@ -0,0 +1,71 @@
+package merge
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+)
+
+// DefaultMergeLogCount is how many merged commits merge.log=true lists
+const DefaultMergeLogCount = 20
+
+// mergeLogCountRepo reads merge.log: false or unset disables the shortlog,
+// true lists DefaultMergeLogCount commits, and a number sets the limit.
+func mergeLogCountRepo(repo *core.Repository) (int, error) {
+	value, err := repo.GetConfig("merge.log")
+	if err != nil {
+		return 0, core.ConfigError("failed to read merge.log", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "false", "no", "off":
+		return 0, nil
+	case "true", "yes", "on":
+		return DefaultMergeLogCount, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 0 {
+		return 0, core.ConfigError(fmt.Sprintf("invalid value '%s' for merge.log", value), nil)
+	}
+	return n, nil
+}
+
+// MergeMessageRepo builds the default message for merging sourceBranch into
+// currentBranch. It carries the source branch description, if any, and with
+// merge.log a shortlog of the commits the merge brings in.
+func MergeMessageRepo(repo *core.Repository, sourceBranch, currentBranch, headCommitID, sourceCommitID string) (string, error) {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "Merge branch '%s' into %s", sourceBranch, currentBranch)
+
+	description, err := repo.GetBranchDescription(sourceBranch)
+	if err != nil {
+		return "", err
+	}
+	if description != "" {
+		fmt.Fprintf(&msg, "\n\n%s", description)
+	}
+
+	limit, err := mergeLogCountRepo(repo)
+	if err != nil || limit == 0 {
+		return msg.String(), err
+	}
+	commits, err := objects.CommitsBetweenRepo(repo, headCommitID, sourceCommitID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list merged commits: %w", err)
+	}
+	if len(commits) == 0 {
+		return msg.String(), nil
+	}
+
+	fmt.Fprintf(&msg, "\n\n* %s:", sourceBranch)
+	for i, commit := range commits {
+		if i == limit {
+			fmt.Fprintf(&msg, "\n  ...")
+			break
+		}
+		fmt.Fprintf(&msg, "\n  %s", commit.Subject())
+	}
+	return msg.String(), nil
+}
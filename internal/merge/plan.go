@@ -0,0 +1,139 @@
+package merge
+
+import (
+	"fmt"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+)
+
+// Outcomes of a Plan
+const (
+	PlanUpToDate    = "up-to-date"
+	PlanFastForward = "fast-forward"
+	PlanMerge       = "merge"   // A merge commit is made
+	PlanSquash      = "squash"  // The result is staged without committing
+	PlanRebase      = "rebase"  // The commits are replayed
+	PlanRefused     = "refused" // See Reason
+)
+
+// Plan is what a merge or rebase would do, worked out without changing
+// anything. Conflicts are predicted with MergeTreeRepo, so merge drivers
+// and attributes aren't taken into account.
+type Plan struct {
+	Operation  string          `json:"operation"` // merge or rebase
+	Outcome    string          `json:"outcome"`
+	Reason     string          `json:"reason,omitempty"`
+	Head       string          `json:"head"`
+	Target     string          `json:"target"`         // Commit merged, or rebased onto
+	Base       string          `json:"base,omitempty"` // Merge base of a merge
+	Steps      []PlanStep      `json:"steps"`
+	Conflicts  []string        `json:"conflicts,omitempty"` // Paths a merge would conflict in
+	RefUpdates []PlanRefUpdate `json:"refUpdates"`
+}
+
+// PlanStep is a commit merged or replayed, oldest first
+type PlanStep struct {
+	Action    string   `json:"action"` // merge, or the rebase todo action
+	Commit    string   `json:"commit"`
+	Subject   string   `json:"subject"`
+	Conflicts []string `json:"conflicts,omitempty"` // Paths replaying it would conflict in
+	Empty     bool     `json:"empty,omitempty"`     // Replaying it would change nothing, so it is dropped
+}
+
+// PlanRefUpdate is a ref the operation would move
+type PlanRefUpdate struct {
+	Ref string `json:"ref"`
+	Old string `json:"old"`
+	New string `json:"new,omitempty"` // Empty when it is a commit not made yet
+}
+
+// PlanRepo works out what MergeRepo would do with sourceBranch and config
+func PlanRepo(repo *core.Repository, sourceBranch string, config *MergeConfig) (*Plan, error) {
+	if config == nil {
+		config = &MergeConfig{Strategy: MergeStrategyRecursive}
+	}
+	ffMode, err := resolveFastForwardMode(repo, config.FastForward)
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.ReadHead()
+	if err != nil {
+		return nil, core.RefError("failed to read HEAD", err)
+	}
+	if head == "" {
+		return nil, fmt.Errorf("HEAD is not set")
+	}
+	source, err := resolveMergeSource(repo, sourceBranch)
+	if err != nil {
+		// Remote-tracking branches and other revisions
+		if source, err = repo.ResolveRevision(sourceBranch); err != nil {
+			return nil, core.RefError(fmt.Sprintf("unknown revision '%s'", sourceBranch), err)
+		}
+	}
+	bases, err := objects.MergeBasesManyRepo(repo, head, []string{source})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find merge base: %w", err)
+	}
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("refusing to merge unrelated histories")
+	}
+
+	plan := &Plan{Operation: "merge", Head: head, Target: source, Base: bases[0], Steps: []PlanStep{}, RefUpdates: []PlanRefUpdate{}}
+	merged, err := objects.RevListRepo(repo, []string{source}, []string{head}, objects.RevListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := len(merged) - 1; i >= 0; i-- {
+		commit, err := objects.GetCommitRepo(repo, merged[i].Hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load commit %s: %w", merged[i].Hash, err)
+		}
+		plan.Steps = append(plan.Steps, PlanStep{Action: "merge", Commit: commit.CommitID, Subject: commit.Subject()})
+	}
+
+	ref := core.HeadFile
+	if branch, err := GetCurrentBranchRepo(repo); err == nil {
+		ref = "refs/heads/" + branch
+	}
+	switch {
+	case plan.Base == source:
+		plan.Outcome = PlanUpToDate
+		return plan, nil
+	case plan.Base == head && config.Squash:
+		// Squashing onto HEAD stages the source tree as it is
+		plan.Outcome = PlanSquash
+		return plan, nil
+	case plan.Base == head && ffMode == FastForwardNever:
+		plan.Outcome = PlanMerge
+		plan.RefUpdates = append(plan.RefUpdates, PlanRefUpdate{Ref: ref, Old: head})
+		return plan, nil
+	case plan.Base == head:
+		plan.Outcome = PlanFastForward
+		plan.RefUpdates = append(plan.RefUpdates, PlanRefUpdate{Ref: ref, Old: head, New: source})
+		return plan, nil
+	case ffMode == FastForwardOnly:
+		plan.Outcome, plan.Reason = PlanRefused, ErrNotFastForward.Error()
+		return plan, nil
+	case config.Squash:
+		plan.Outcome = PlanSquash
+	default:
+		plan.Outcome = PlanMerge
+		plan.RefUpdates = append(plan.RefUpdates, PlanRefUpdate{Ref: ref, Old: head})
+	}
+
+	var trees [3]TreeFiles
+	for i, commitID := range []string{plan.Base, head, source} {
+		commit, err := objects.GetCommitRepo(repo, commitID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load commit %s: %w", commitID, err)
+		}
+		if trees[i], err = TreeFilesRepo(repo, commit.Tree); err != nil {
+			return nil, err
+		}
+	}
+	if _, plan.Conflicts, err = MergeTreeRepo(repo, trees[0], trees[1], trees[2]); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
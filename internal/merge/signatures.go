@@ -0,0 +1,71 @@
+package merge
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+)
+
+// VerifySignaturesKey makes merge and pull refuse commits that aren't signed
+// by an allowed signer of their committer
+const VerifySignaturesKey = "merge.verifySignatures"
+
+// verifySignaturesEnabled reports whether merge.verifySignatures is set
+func verifySignaturesEnabled(repo *core.Repository) (bool, error) {
+	value, err := repo.GetConfig(VerifySignaturesKey)
+	if err != nil {
+		return false, core.ConfigError("failed to read "+VerifySignaturesKey, err)
+	}
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "false", "no", "off", "0":
+		return false, nil
+	case "true", "yes", "on", "1":
+		return true, nil
+	}
+	return false, core.ConfigError(fmt.Sprintf("invalid boolean value '%s' for %s", value, VerifySignaturesKey), nil)
+}
+
+// VerifyIncomingSignaturesRepo checks, when merge.verifySignatures is set,
+// that every commit reachable from tip but not from head carries a good
+// signature. The first commit failing the check is reported.
+func VerifyIncomingSignaturesRepo(repo *core.Repository, head, tip string) error {
+	enabled, err := verifySignaturesEnabled(repo)
+	if err != nil || !enabled {
+		return err
+	}
+	commits, err := objects.CommitsBetweenRepo(repo, head, tip)
+	if err != nil {
+		return fmt.Errorf("failed to list commits to verify: %w", err)
+	}
+
+	for _, commit := range commits {
+		check, err := objects.VerifyCommitSignatureRepo(repo, commit)
+		if err != nil {
+			return fmt.Errorf("failed to verify signature of commit %s: %w", shortID(commit.CommitID), err)
+		}
+		var reason string
+		switch check.Status {
+		case objects.SignatureGood:
+			continue
+		case objects.SignatureUnsigned:
+			reason = "does not have a signature"
+		case objects.SignatureUntrusted:
+			reason = fmt.Sprintf("is not signed by an allowed signer for %s", check.Principal)
+		default:
+			reason = "has a bad signature"
+		}
+		return fmt.Errorf("commit %s %s (%s is set; use --no-verify-signatures to override)",
+			shortID(commit.CommitID), reason, VerifySignaturesKey)
+	}
+	return nil
+}
+
+// shortID abbreviates a commit hash for messages
+func shortID(id string) string {
+	if len(id) > 7 {
+		return id[:7]
+	}
+	return id
+}
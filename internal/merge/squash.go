@@ -0,0 +1,68 @@
+package merge
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+)
+
+// SquashMsgFile holds the message prepared by merge --squash, or a revert
+// left uncommitted, for the next commit
+const SquashMsgFile = "SQUASH_MSG"
+
+// SquashMessagePath returns the location of SQUASH_MSG
+func SquashMessagePath(repo *core.Repository) string {
+	return filepath.Join(repo.VecDir, SquashMsgFile)
+}
+
+// ReadSquashMessage returns the message left by merge --squash, or "" if none
+func ReadSquashMessage(repo *core.Repository) (string, error) {
+	data, err := os.ReadFile(SquashMessagePath(repo))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read %s: %w", SquashMsgFile, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// PrepareCommitMessage leaves message in SQUASH_MSG as the default message
+// of the next commit
+func PrepareCommitMessage(repo *core.Repository, message string) error {
+	if err := os.WriteFile(SquashMessagePath(repo), []byte(message+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", SquashMsgFile, err)
+	}
+	return nil
+}
+
+// ClearSquashMessage removes SQUASH_MSG once the squashed changes are committed
+func ClearSquashMessage(repo *core.Repository) error {
+	if err := os.Remove(SquashMessagePath(repo)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", SquashMsgFile, err)
+	}
+	return nil
+}
+
+// writeSquashMessageRepo summarises the commits being squashed, those
+// reachable from sourceCommitID but not headCommitID, in SQUASH_MSG
+func writeSquashMessageRepo(repo *core.Repository, sourceBranch, headCommitID, sourceCommitID string) error {
+	commits, err := objects.CommitsBetweenRepo(repo, headCommitID, sourceCommitID)
+	if err != nil {
+		return fmt.Errorf("failed to list squashed commits: %w", err)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "Squashed commit of branch '%s'\n\n", sourceBranch)
+	for _, commit := range commits {
+		fmt.Fprintf(&msg, "* %s\n", commit.Subject())
+	}
+	if err := os.WriteFile(SquashMessagePath(repo), []byte(msg.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", SquashMsgFile, err)
+	}
+	return nil
+}
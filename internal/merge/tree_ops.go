@@ -214,13 +214,32 @@ func applyChangesToWorkingDirectory(repoRoot string, mergeResults map[string]Mer
 
 // CheckoutCommit updates the working directory and index to match a commit using Repository context.
 func CheckoutCommit(repo *core.Repository, commitID string) error {
-	commit, err := objects.GetCommit(repo.Root, commitID)
+	commit, err := objects.GetCommitRepo(repo, commitID)
 	if err != nil {
 		return fmt.Errorf("failed to load commit %s: %w", commitID, err)
 	}
-	tree, err := objects.GetTree(repo.Root, commit.Tree)
+	if err := checkoutTreeRepo(repo, commit.Tree); err != nil {
+		return err
+	}
+	headFile := filepath.Join(repo.Root, ".vec", "HEAD")
+	content, err := os.ReadFile(headFile)
+	if err != nil {
+		return fmt.Errorf("failed to read HEAD file: %w", err)
+	}
+	if !strings.HasPrefix(string(content), "ref: ") {
+		if err := repo.UpdateHead(commitID, false); err != nil {
+			return fmt.Errorf("failed to update HEAD: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkoutTreeRepo makes the working directory and index match a tree
+// without touching HEAD or any ref.
+func checkoutTreeRepo(repo *core.Repository, treeID string) error {
+	tree, err := objects.GetTree(repo.Root, treeID)
 	if err != nil {
-		return fmt.Errorf("failed to load tree %s: %w", commit.Tree, err)
+		return fmt.Errorf("failed to load tree %s: %w", treeID, err)
 	}
 	if err := updateWorkingDirectory(repo, tree, ""); err != nil {
 		return fmt.Errorf("failed to update working directory: %w", err)
@@ -229,19 +248,16 @@ func CheckoutCommit(repo *core.Repository, commitID string) error {
 	if err != nil {
 		return fmt.Errorf("failed to create index from tree: %w", err)
 	}
+	if repo.IgnoreCase() {
+		paths := make([]string, len(index.Entries))
+		for i, entry := range index.Entries {
+			paths[i] = entry.FilePath
+		}
+		core.WarnCaseCollisions(os.Stderr, paths)
+	}
 	if err := index.Write(); err != nil {
 		return fmt.Errorf("failed to write index: %w", err)
 	}
-	headFile := filepath.Join(repo.Root, ".vec", "HEAD")
-	content, err := os.ReadFile(headFile)
-	if err != nil {
-		return fmt.Errorf("failed to read HEAD file: %w", err)
-	}
-	if !strings.HasPrefix(string(content), "ref: ") {
-		if err := os.WriteFile(headFile, []byte(commitID), 0644); err != nil {
-			return fmt.Errorf("failed to update HEAD: %w", err)
-		}
-	}
 	return nil
 }
 
@@ -0,0 +1,516 @@
+package objects
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// The reachability bitmap index lists the objects reachable from the refs
+// when gc last ran and, for a selection of commits, every object each one
+// reaches as a bitset over that list. What one set of tips has and another
+// lacks is then a few bitset operations instead of a walk of both
+// histories; only objects added since the index was written are walked.
+const (
+	bitmapIndexFile  = "pack/reachability.bitmap" // Below .vec/objects
+	bitmapIndexMagic = "VBMP"
+
+	// Commits this far apart along each first-parent history are given a
+	// bitmap, besides the tips
+	bitmapInterval = 100
+)
+
+// bitmapTypes are the object types, by their code in the index
+var bitmapTypes = []string{"commit", "tree", "blob", "tag"}
+
+// bitset is a set of object positions in a BitmapIndex
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (s bitset) set(i int) {
+	s[i/64] |= 1 << (i % 64)
+}
+
+func (s bitset) has(i int) bool {
+	return s[i/64]&(1<<(i%64)) != 0
+}
+
+func (s bitset) or(other bitset) {
+	for i := range other {
+		s[i] |= other[i]
+	}
+}
+
+// BitmapIndex is a reachability bitmap index loaded from disk
+type BitmapIndex struct {
+	ids       []string // Objects, sorted; bit i of a bitset stands for ids[i]
+	types     []byte   // Type code of each object
+	positions map[string]int
+	bitmaps   map[string][]byte // Commit -> compressed bitset
+}
+
+// Len returns the number of objects the index holds
+func (b *BitmapIndex) Len() int {
+	return len(b.ids)
+}
+
+// Bitmaps returns the number of commits with a bitmap
+func (b *BitmapIndex) Bitmaps() int {
+	return len(b.bitmaps)
+}
+
+func bitmapIndexPath(repo *core.Repository) string {
+	return filepath.Join(repo.ObjectsDir, filepath.FromSlash(bitmapIndexFile))
+}
+
+// LoadBitmapIndexRepo reads the bitmap index; nil if gc hasn't written one
+func LoadBitmapIndexRepo(repo *core.Repository) (*BitmapIndex, error) {
+	data, err := os.ReadFile(bitmapIndexPath(repo))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read bitmap index: %w", err)
+	}
+	if len(data) < sha256.Size {
+		return nil, fmt.Errorf("bitmap index is truncated")
+	}
+	body, sum := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	if expected := sha256.Sum256(body); !bytes.Equal(expected[:], sum) {
+		return nil, fmt.Errorf("bitmap index is corrupt: checksum mismatch")
+	}
+	index, err := decodeBitmapIndex(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bitmap index: %w", err)
+	}
+	return index, nil
+}
+
+// encodeBitmapIndex serializes the index: magic, version, hash length and
+// object count, then the object ids and their type codes, then the bitmap
+// count and per bitmap the position of its commit, its length and the
+// zlib-compressed bitset
+func encodeBitmapIndex(b *BitmapIndex) ([]byte, error) {
+	hashLen := 0
+	if len(b.ids) > 0 {
+		hashLen = len(b.ids[0]) / 2
+	}
+	var buf bytes.Buffer
+	buf.WriteString(bitmapIndexMagic)
+	buf.WriteByte(1)
+	buf.WriteByte(byte(hashLen))
+	binary.Write(&buf, binary.BigEndian, uint32(len(b.ids)))
+	for _, id := range b.ids {
+		raw, err := hex.DecodeString(id)
+		if err != nil || len(raw) != hashLen {
+			return nil, fmt.Errorf("invalid object ID '%s'", id)
+		}
+		buf.Write(raw)
+	}
+	buf.Write(b.types)
+
+	commits := make([]int, 0, len(b.bitmaps))
+	for id := range b.bitmaps {
+		commits = append(commits, b.positions[id])
+	}
+	sort.Ints(commits)
+	binary.Write(&buf, binary.BigEndian, uint32(len(commits)))
+	for _, pos := range commits {
+		data := b.bitmaps[b.ids[pos]]
+		binary.Write(&buf, binary.BigEndian, uint32(pos))
+		binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeBitmapIndex parses the body of the index file
+func decodeBitmapIndex(data []byte) (*BitmapIndex, error) {
+	r := bytes.NewReader(data)
+	header := make([]byte, 6)
+	var count uint32
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:4]) != bitmapIndexMagic {
+		return nil, fmt.Errorf("bad signature")
+	}
+	if header[4] != 1 {
+		return nil, fmt.Errorf("unsupported version %d", header[4])
+	}
+	hashLen := int(header[5])
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil || int64(count)*int64(hashLen+1) > int64(r.Len()) {
+		return nil, fmt.Errorf("truncated header")
+	}
+
+	b := &BitmapIndex{
+		ids:       make([]string, count),
+		types:     make([]byte, count),
+		positions: make(map[string]int, count),
+		bitmaps:   make(map[string][]byte),
+	}
+	raw := make([]byte, hashLen)
+	for i := range b.ids {
+		io.ReadFull(r, raw)
+		b.ids[i] = hex.EncodeToString(raw)
+		b.positions[b.ids[i]] = i
+	}
+	io.ReadFull(r, b.types)
+	for i, t := range b.types {
+		if int(t) >= len(bitmapTypes) {
+			return nil, fmt.Errorf("object %s has unknown type %d", b.ids[i], t)
+		}
+	}
+
+	var bitmapCount uint32
+	if err := binary.Read(r, binary.BigEndian, &bitmapCount); err != nil {
+		return nil, fmt.Errorf("truncated bitmap table")
+	}
+	for i := uint32(0); i < bitmapCount; i++ {
+		var pos, length uint32
+		if binary.Read(r, binary.BigEndian, &pos) != nil || binary.Read(r, binary.BigEndian, &length) != nil ||
+			int(length) > r.Len() || pos >= count {
+			return nil, fmt.Errorf("truncated bitmap %d", i)
+		}
+		if bitmapTypes[b.types[pos]] != "commit" {
+			return nil, fmt.Errorf("bitmap %d is for %s, not a commit", i, b.ids[pos])
+		}
+		bitmap := make([]byte, length)
+		io.ReadFull(r, bitmap)
+		b.bitmaps[b.ids[pos]] = bitmap
+	}
+	return b, nil
+}
+
+// compressBitset packs s as little-endian words and deflates it
+func compressBitset(s bitset) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if err := binary.Write(w, binary.LittleEndian, []uint64(s)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// bitmap returns the bitset stored for commit
+func (b *BitmapIndex) bitmap(commit string) (bitset, error) {
+	r, err := zlib.NewReader(bytes.NewReader(b.bitmaps[commit]))
+	if err != nil {
+		return nil, fmt.Errorf("bitmap of %s is corrupt: %w", commit, err)
+	}
+	defer r.Close()
+	s := newBitset(len(b.ids))
+	if err := binary.Read(r, binary.LittleEndian, []uint64(s)); err != nil {
+		return nil, fmt.Errorf("bitmap of %s is corrupt: %w", commit, err)
+	}
+	return s, nil
+}
+
+// reaches reports whether commit reaches target, known only when commit has
+// a bitmap. An object the index doesn't hold, as target is when it is newer
+// than the index, is in no bitmap.
+func (b *BitmapIndex) reaches(commit, target string) (reached, known bool, err error) {
+	if _, ok := b.bitmaps[commit]; !ok {
+		return false, false, nil
+	}
+	pos, ok := b.positions[target]
+	if !ok {
+		return false, true, nil
+	}
+	s, err := b.bitmap(commit)
+	if err != nil {
+		return false, false, err
+	}
+	return s.has(pos), true, nil
+}
+
+// reachSet is the set of objects reachable from some tips: those the index
+// holds as bits, the others by id with their type
+type reachSet struct {
+	index *BitmapIndex
+	bits  bitset
+	extra map[string]string
+}
+
+func (b *BitmapIndex) newReachSet() *reachSet {
+	return &reachSet{index: b, bits: newBitset(len(b.ids)), extra: make(map[string]string)}
+}
+
+func (s *reachSet) has(id string) bool {
+	if pos, ok := s.index.positions[id]; ok {
+		return s.bits.has(pos)
+	}
+	_, ok := s.extra[id]
+	return ok
+}
+
+func (s *reachSet) add(id, objType string) {
+	if pos, ok := s.index.positions[id]; ok {
+		s.bits.set(pos)
+	} else {
+		s.extra[id] = objType
+	}
+}
+
+// reachRepo returns the objects reachable from tips. Objects in stop are
+// not followed; being a reachable set itself, it holds everything below
+// them too. The stored bitmap of a commit is taken whole instead of walking
+// it, so what a bitmap adds is not limited by stop.
+func (b *BitmapIndex) reachRepo(repo *core.Repository, tips []string, stop *reachSet) (*reachSet, error) {
+	type pending struct{ id, objType string }
+	reached := b.newReachSet()
+	stack := make([]pending, 0, len(tips))
+	for _, tip := range tips {
+		stack = append(stack, pending{id: tip})
+	}
+
+	for len(stack) > 0 {
+		obj := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if reached.has(obj.id) || (stop != nil && stop.has(obj.id)) {
+			continue
+		}
+		if _, ok := b.bitmaps[obj.id]; ok {
+			s, err := b.bitmap(obj.id)
+			if err != nil {
+				return nil, err
+			}
+			reached.bits.or(s)
+			continue
+		}
+		if obj.objType == "" {
+			if pos, ok := b.positions[obj.id]; ok {
+				obj.objType = bitmapTypes[b.types[pos]]
+			} else {
+				objType, err := ObjectTypeRepo(repo, obj.id)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read object %s: %w", obj.id, err)
+				}
+				obj.objType = objType
+			}
+		}
+		reached.add(obj.id, obj.objType)
+
+		switch obj.objType {
+		case "commit":
+			c, err := GetCommitRepo(repo, obj.id)
+			if err != nil {
+				return nil, fmt.Errorf("%w: commit %s is unreadable: %v", ErrCorruptGraph, obj.id, err)
+			}
+			stack = append(stack, pending{c.Tree, "tree"})
+			for _, parent := range c.Parents {
+				stack = append(stack, pending{parent, "commit"})
+			}
+		case "tree":
+			tree, err := GetTreeRepo(repo, obj.id)
+			if err != nil {
+				return nil, fmt.Errorf("%w: tree %s is unreadable: %v", ErrCorruptGraph, obj.id, err)
+			}
+			for _, entry := range tree.Entries {
+				switch {
+				case entry.IsGitlink():
+				case entry.Type == "tree":
+					stack = append(stack, pending{entry.Hash, "tree"})
+				default:
+					stack = append(stack, pending{entry.Hash, "blob"})
+				}
+			}
+		case "tag":
+			tag, err := GetTagRepo(repo, obj.id)
+			if err != nil {
+				return nil, fmt.Errorf("%w: tag %s is unreadable: %v", ErrCorruptGraph, obj.id, err)
+			}
+			stack = append(stack, pending{tag.Object, tag.Type})
+		}
+	}
+	return reached, nil
+}
+
+// ObjectsRepo lists the objects reachable from include but not from
+// exclude, as RevListRepo does with Objects: commits, then tags, trees and
+// blobs, without paths. Blobs are left out with omitBlobs.
+func (b *BitmapIndex) ObjectsRepo(repo *core.Repository, include, exclude []string, omitBlobs bool) ([]ListedObject, error) {
+	excluded, err := b.reachRepo(repo, exclude, nil)
+	if err != nil {
+		return nil, err
+	}
+	included, err := b.reachRepo(repo, include, excluded)
+	if err != nil {
+		return nil, err
+	}
+
+	byType := make(map[string][]string)
+	for i, word := range included.bits {
+		word &^= excluded.bits[i]
+		for word != 0 {
+			pos := i*64 + bits.TrailingZeros64(word)
+			word &= word - 1
+			objType := bitmapTypes[b.types[pos]]
+			byType[objType] = append(byType[objType], b.ids[pos])
+		}
+	}
+	extra := make([]string, 0, len(included.extra))
+	for id := range included.extra {
+		if !excluded.has(id) {
+			extra = append(extra, id)
+		}
+	}
+	sort.Strings(extra)
+	for _, id := range extra {
+		objType := included.extra[id]
+		byType[objType] = append(byType[objType], id)
+	}
+
+	var listed []ListedObject
+	for _, objType := range []string{"commit", "tag", "tree", "blob"} {
+		if objType == "blob" && omitBlobs {
+			continue
+		}
+		for _, id := range byType[objType] {
+			listed = append(listed, ListedObject{Hash: id, Type: objType})
+		}
+	}
+	return listed, nil
+}
+
+// ListObjectsRepo lists the objects reachable from include but not from
+// exclude through the bitmap index when gc has written one, and through
+// RevListRepo otherwise or if the index can't be used
+func ListObjectsRepo(repo *core.Repository, include, exclude []string, omitBlobs bool) ([]ListedObject, error) {
+	if index, err := LoadBitmapIndexRepo(repo); err == nil && index != nil {
+		if listed, err := index.ObjectsRepo(repo, include, exclude, omitBlobs); err == nil {
+			return listed, nil
+		}
+	}
+	return RevListRepo(repo, include, exclude, RevListOptions{Objects: true, OmitBlobs: omitBlobs})
+}
+
+// WriteBitmapIndexRepo replaces the bitmap index with one of the objects
+// reachable from tips, with bitmaps for the tip commits and for commits
+// bitmapInterval apart along their first-parent histories, and returns how
+// many bitmaps were written. Without tips the index is removed.
+func WriteBitmapIndexRepo(repo *core.Repository, tips []string) (int, error) {
+	path := bitmapIndexPath(repo)
+	if len(tips) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return 0, fmt.Errorf("failed to remove bitmap index: %w", err)
+		}
+		return 0, nil
+	}
+
+	// An index without objects walks everything, which gives the table
+	all, err := (&BitmapIndex{}).reachRepo(repo, tips, nil)
+	if err != nil {
+		return 0, err
+	}
+	index := &BitmapIndex{
+		ids:       make([]string, 0, len(all.extra)),
+		positions: make(map[string]int, len(all.extra)),
+		bitmaps:   make(map[string][]byte),
+	}
+	for id := range all.extra {
+		index.ids = append(index.ids, id)
+	}
+	sort.Strings(index.ids)
+	index.types = make([]byte, len(index.ids))
+	for i, id := range index.ids {
+		index.positions[id] = i
+		for code, name := range bitmapTypes {
+			if name == all.extra[id] {
+				index.types[i] = byte(code)
+			}
+		}
+	}
+
+	selected, err := selectBitmapCommitsRepo(repo, tips, all.extra)
+	if err != nil {
+		return 0, err
+	}
+	// Oldest first, so the walk for each commit stops at the bitmaps of
+	// those below it
+	for _, commit := range selected {
+		reached, err := index.reachRepo(repo, []string{commit}, nil)
+		if err != nil {
+			return 0, err
+		}
+		if index.bitmaps[commit], err = compressBitset(reached.bits); err != nil {
+			return 0, fmt.Errorf("failed to compress bitmap of %s: %w", commit, err)
+		}
+	}
+
+	data, err := encodeBitmapIndex(index)
+	if err != nil {
+		return 0, err
+	}
+	sum := sha256.Sum256(data)
+	perms, err := repo.Permissions()
+	if err != nil {
+		return 0, err
+	}
+	if err := perms.MkdirAll(filepath.Dir(path)); err != nil {
+		return 0, err
+	}
+	if err := perms.WriteFile(path+".tmp", append(data, sum[:]...)); err != nil {
+		os.Remove(path + ".tmp")
+		return 0, fmt.Errorf("failed to write bitmap index: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		return 0, fmt.Errorf("failed to write bitmap index: %w", err)
+	}
+	return len(index.bitmaps), nil
+}
+
+// selectBitmapCommitsRepo returns the commits given a bitmap, oldest first:
+// the commits tips peel to and every bitmapInterval-th first parent below
+// them. types gives the type of every reachable object.
+func selectBitmapCommitsRepo(repo *core.Repository, tips []string, types map[string]string) ([]string, error) {
+	times := make(map[string]int64)
+	var selected []string
+	for _, tip := range tips {
+		for types[tip] == "tag" {
+			tag, err := GetTagRepo(repo, tip)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read tag %s: %w", tip, err)
+			}
+			tip = tag.Object
+		}
+		if types[tip] != "commit" {
+			continue
+		}
+		for depth, hash := 0, tip; hash != ""; depth++ {
+			if _, seen := times[hash]; seen {
+				break
+			}
+			c, err := GetCommitRepo(repo, hash)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load commit %s: %w", hash, err)
+			}
+			times[hash] = c.CommitterTimestamp
+			if depth%bitmapInterval == 0 {
+				selected = append(selected, hash)
+			}
+			hash = ""
+			if len(c.Parents) > 0 {
+				hash = c.Parents[0]
+			}
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return times[selected[i]] < times[selected[j]]
+	})
+	return selected, nil
+}
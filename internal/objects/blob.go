@@ -1,13 +1,17 @@
 package objects
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/packfile"
 	"github.com/NahomAnteneh/vec/utils"
 )
 
@@ -25,42 +29,20 @@ func CreateBlobRepo(repo *core.Repository, content []byte) (string, error) {
 	
 	// Determine file path
 	objectPath := GetObjectPathRepo(repo, hash)
-	objectDir := filepath.Dir(objectPath)
-
-	// Ensure the object directory exists (two-letter subdirectory)
-	if err := utils.EnsureDirExists(objectDir); err != nil {
-		return "", err
-	}
 
 	// Skip writing if the object already exists (deduplication)
 	if utils.FileExists(objectPath) {
 		return hash, nil
 	}
 
-	// Create temporary file to ensure atomic write
-	tempFile := objectPath + ".tmp"
-	file, err := os.Create(tempFile)
+	stored, err := core.EncodeObjectFile(repo.Root, fullContent)
 	if err != nil {
-		return "", fmt.Errorf("failed to create blob file: %w", err)
-	}
-	
-	// Write content and handle any errors
-	if _, err := file.Write(fullContent); err != nil {
-		file.Close()
-		os.Remove(tempFile)
-		return "", fmt.Errorf("failed to write to blob file: %w", err)
-	}
-	
-	// Close file before renaming
-	if err := file.Close(); err != nil {
-		os.Remove(tempFile)
-		return "", fmt.Errorf("failed to close blob file: %w", err)
+		return "", err
 	}
-	
-	// Atomic rename
-	if err := os.Rename(tempFile, objectPath); err != nil {
-		os.Remove(tempFile)
-		return "", fmt.Errorf("failed to finalize blob file: %w", err)
+
+	// Write through a temporary file to ensure atomic write
+	if err := writeObjectFileRepo(repo, objectPath, stored); err != nil {
+		return "", fmt.Errorf("failed to write blob: %w", err)
 	}
 
 	return hash, nil
@@ -68,23 +50,11 @@ func CreateBlobRepo(repo *core.Repository, content []byte) (string, error) {
 
 // GetBlobRepo retrieves a blob object by its hash using Repository context.
 func GetBlobRepo(repo *core.Repository, hash string) ([]byte, error) {
-	objectPath := GetObjectPathRepo(repo, hash)
-
-	// Verify object exists
-	if !utils.FileExists(objectPath) {
+	// Read all content, loose or packed
+	content, err := readObjectRepo(repo, hash)
+	if errors.Is(err, packfile.ErrObjectNotFound) {
 		return nil, fmt.Errorf("blob %s not found", hash)
-	}
-
-	// Open and read the file
-	file, err := os.Open(objectPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open blob file: %w", err)
-	}
-	defer file.Close()
-
-	// Read all content
-	content, err := io.ReadAll(file)
-	if err != nil {
+	} else if err != nil {
 		return nil, fmt.Errorf("failed to read blob file: %w", err)
 	}
 
@@ -103,3 +73,98 @@ func GetBlobRepo(repo *core.Repository, hash string) ([]byte, error) {
 	// Return only the file content
 	return content[headerEnd+1:], nil
 }
+
+// blobReader streams the content of a blob, failing if the object ends
+// before the size its header gives
+type blobReader struct {
+	r         *bufio.Reader
+	file      io.Closer
+	remaining int64
+}
+
+func (b *blobReader) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.r.Read(p)
+	b.remaining -= int64(n)
+	if err == io.EOF && b.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (b *blobReader) Close() error {
+	return b.file.Close()
+}
+
+// GetBlobReaderRepo opens a blob for streaming its content, which is not
+// held in memory unless the object is encrypted or packed. It returns the
+// content size from the object header; the caller closes the reader.
+func GetBlobReaderRepo(repo *core.Repository, hash string) (io.ReadCloser, int64, error) {
+	objectPath := GetObjectPathRepo(repo, hash)
+	file, err := core.OpenObjectFile(repo.Root, objectPath)
+	if os.IsNotExist(err) {
+		content, err := readObjectRepo(repo, hash)
+		if errors.Is(err, packfile.ErrObjectNotFound) {
+			return nil, 0, fmt.Errorf("blob %s not found", hash)
+		} else if err != nil {
+			return nil, 0, fmt.Errorf("failed to read blob: %w", err)
+		}
+		file = io.NopCloser(bytes.NewReader(content))
+	} else if err != nil {
+		return nil, 0, fmt.Errorf("failed to read blob file: %w", err)
+	}
+
+	r := bufio.NewReaderSize(file, 64<<10)
+	header, err := r.ReadString('\x00')
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("invalid blob format: missing header")
+	}
+	header = strings.TrimSuffix(header, "\x00")
+	sizeField, ok := strings.CutPrefix(header, "blob ")
+	size, err := strconv.ParseInt(sizeField, 10, 64)
+	if !ok || err != nil || size < 0 {
+		file.Close()
+		return nil, 0, fmt.Errorf("invalid blob header: %s", header)
+	}
+	return &blobReader{r: r, file: file, remaining: size}, size, nil
+}
+
+// WriteBlobFileRepo writes the content of a blob to path, executable if
+// asked and core.fileMode allows it, streaming it so memory use stays flat
+// for large files
+func WriteBlobFileRepo(repo *core.Repository, hash, path string, executable bool) error {
+	perms, err := repo.Permissions()
+	if err != nil {
+		return err
+	}
+	perm := perms.ExecutableFile(executable)
+	blob, _, err := GetBlobReaderRepo(repo, hash)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(file, 64<<10)
+	if _, err := io.Copy(w, blob); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return perms.Apply(path, perm)
+}
@@ -4,8 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"os"
-	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/NahomAnteneh/vec/core"
@@ -20,9 +19,29 @@ type Commit struct {
 	Author    string   // Author name and email (e.g., "Author Name <author@example.com>")
 	Committer string   // Committer name and email (e.g., "Committer Name <committer@example.com>")
 	Message   string   // Commit message
-	Timestamp int64    // Commit timestamp (Unix time)
+	Timestamp int64    // Author timestamp (Unix time)
+
+	AuthorTZ           int   // Author UTC offset in seconds east
+	CommitterTimestamp int64 // Committer timestamp (Unix time)
+	CommitterTZ        int   // Committer UTC offset in seconds east
+
+	// Signature is an SSH signature over the commit serialized without it;
+	// empty for unsigned commits
+	Signature string
+
+	legacyDates bool // Stored without committer date and zones; serialized the same way
+
+	// shallowParents are the stored parents of a shallow commit, whose
+	// Parents are left empty
+	shallowParents []string
 }
 
+// Blocks that follow the message: commit dates, then an optional signature
+const (
+	commitDatesVersion     byte = 1
+	commitSignatureVersion byte = 2
+)
+
 // serialize serializes the commit object into a byte slice, excluding CommitID.
 func (c *Commit) serialize() ([]byte, error) {
 	var buf bytes.Buffer
@@ -33,11 +52,12 @@ func (c *Commit) serialize() ([]byte, error) {
 	}
 
 	// Parents (count + length-prefixed strings)
-	parentCount := uint32(len(c.Parents))
+	parents := c.StoredParents()
+	parentCount := uint32(len(parents))
 	if err := binary.Write(&buf, binary.LittleEndian, parentCount); err != nil {
 		return nil, fmt.Errorf("failed to write parent count: %w", err)
 	}
-	for _, parent := range c.Parents {
+	for _, parent := range parents {
 		if err := writeLengthPrefixedString(&buf, parent); err != nil {
 			return nil, fmt.Errorf("failed to write parent: %w", err)
 		}
@@ -63,6 +83,23 @@ func (c *Commit) serialize() ([]byte, error) {
 		return nil, fmt.Errorf("failed to write message: %w", err)
 	}
 
+	// Dates block: version, author zone, committer timestamp and zone. Commits
+	// written before it existed end at the message.
+	if !c.legacyDates {
+		buf.WriteByte(commitDatesVersion)
+		for _, v := range []interface{}{int32(c.AuthorTZ), c.CommitterTimestamp, int32(c.CommitterTZ)} {
+			if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+				return nil, fmt.Errorf("failed to write commit dates: %w", err)
+			}
+		}
+		if c.Signature != "" {
+			buf.WriteByte(commitSignatureVersion)
+			if err := writeLengthPrefixedString(&buf, c.Signature); err != nil {
+				return nil, fmt.Errorf("failed to write signature: %w", err)
+			}
+		}
+	}
+
 	return buf.Bytes(), nil
 }
 
@@ -114,11 +151,90 @@ func deserializeCommit(data []byte) (*Commit, error) {
 		return nil, fmt.Errorf("failed to read message: %w", err)
 	}
 
+	// Dates block
+	if buf.Len() == 0 {
+		commit.legacyDates = true
+		commit.CommitterTimestamp = commit.Timestamp
+		return commit, nil
+	}
+	version, err := buf.ReadByte()
+	if err != nil || version != commitDatesVersion {
+		return nil, fmt.Errorf("unsupported commit dates version %d", version)
+	}
+	var authorTZ, committerTZ int32
+	if err := binary.Read(buf, binary.LittleEndian, &authorTZ); err != nil {
+		return nil, fmt.Errorf("failed to read author zone: %w", err)
+	}
+	if err := binary.Read(buf, binary.LittleEndian, &commit.CommitterTimestamp); err != nil {
+		return nil, fmt.Errorf("failed to read committer timestamp: %w", err)
+	}
+	if err := binary.Read(buf, binary.LittleEndian, &committerTZ); err != nil {
+		return nil, fmt.Errorf("failed to read committer zone: %w", err)
+	}
+	commit.AuthorTZ, commit.CommitterTZ = int(authorTZ), int(committerTZ)
+
+	// Signature block
+	if buf.Len() == 0 {
+		return commit, nil
+	}
+	if version, err := buf.ReadByte(); err != nil || version != commitSignatureVersion {
+		return nil, fmt.Errorf("unsupported commit block %d after dates", version)
+	}
+	if commit.Signature, err = readLengthPrefixedString(buf); err != nil {
+		return nil, fmt.Errorf("failed to read signature: %w", err)
+	}
+
 	return commit, nil
 }
 
 // CreateCommitRepo creates a new commit object using Repository context.
+// A zero timestamp means now. VEC_AUTHOR_DATE and VEC_COMMITTER_DATE, when
+// set, take precedence.
 func CreateCommitRepo(repo *core.Repository, treeHash string, parentHashes []string, author, committer, message string, timestamp int64) (string, error) {
+	authorDate, committerDate, err := commitDates(timestamp)
+	if err != nil {
+		return "", err
+	}
+	return CreateCommitWithDatesRepo(repo, treeHash, parentHashes, author, committer, message, authorDate, committerDate)
+}
+
+// commitDates returns the author and committer dates of a new commit: the
+// timestamp (zero meaning now) unless VEC_AUTHOR_DATE or VEC_COMMITTER_DATE
+// is set
+func commitDates(timestamp int64) (time.Time, time.Time, error) {
+	date := time.Now()
+	if timestamp != 0 {
+		date = time.Unix(timestamp, 0)
+	}
+	authorDate, err := DateFromEnv(AuthorDateEnv, date)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	committerDate, err := DateFromEnv(CommitterDateEnv, date)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return authorDate, committerDate, nil
+}
+
+// CreateCommitWithDatesRepo creates a new commit object with explicit author
+// and committer dates, keeping the UTC offset of each.
+func CreateCommitWithDatesRepo(repo *core.Repository, treeHash string, parentHashes []string, author, committer, message string, authorDate, committerDate time.Time) (string, error) {
+	return createCommitRepo(repo, treeHash, parentHashes, author, committer, message, authorDate, committerDate, false)
+}
+
+// CreateSignedCommitRepo creates a commit like CreateCommitRepo, signed with
+// user.signingKey
+func CreateSignedCommitRepo(repo *core.Repository, treeHash string, parentHashes []string, author, committer, message string, timestamp int64) (string, error) {
+	authorDate, committerDate, err := commitDates(timestamp)
+	if err != nil {
+		return "", err
+	}
+	return createCommitRepo(repo, treeHash, parentHashes, author, committer, message, authorDate, committerDate, true)
+}
+
+// createCommitRepo builds, optionally signs, and stores a commit object
+func createCommitRepo(repo *core.Repository, treeHash string, parentHashes []string, author, committer, message string, authorDate, committerDate time.Time, sign bool) (string, error) {
 	// Validate inputs
 	if treeHash == "" {
 		return "", fmt.Errorf("tree hash cannot be empty")
@@ -127,18 +243,29 @@ func CreateCommitRepo(repo *core.Repository, treeHash string, parentHashes []str
 	if author == "" || committer == "" {
 		return "", fmt.Errorf("author and committer cannot be empty")
 	}
-	
-	if timestamp == 0 {
-		timestamp = time.Now().Unix()
-	}
 
+	_, authorTZ := authorDate.Zone()
+	_, committerTZ := committerDate.Zone()
 	commit := &Commit{
-		Tree:      treeHash,
-		Parents:   parentHashes,
-		Author:    author,
-		Committer: committer,
-		Message:   message,
-		Timestamp: timestamp,
+		Tree:               treeHash,
+		Parents:            parentHashes,
+		Author:             author,
+		Committer:          committer,
+		Message:            message,
+		Timestamp:          authorDate.Unix(),
+		AuthorTZ:           authorTZ,
+		CommitterTimestamp: committerDate.Unix(),
+		CommitterTZ:        committerTZ,
+	}
+
+	if sign {
+		payload, err := commit.SignedPayload()
+		if err != nil {
+			return "", err
+		}
+		if commit.Signature, err = SignPayloadRepo(repo, payload); err != nil {
+			return "", err
+		}
 	}
 
 	// Serialize the commit data
@@ -165,22 +292,12 @@ func CreateCommitRepo(repo *core.Repository, treeHash string, parentHashes []str
 	}
 
 	// Store the commit object on disk
-	objectDir := filepath.Dir(objectPath)
-	if err := utils.EnsureDirExists(objectDir); err != nil {
-		return "", fmt.Errorf("failed to create directory for commit: %w", err)
-	}
-	
-	// Create a temporary file for atomic write
-	tempPath := objectPath + ".tmp"
-	if err := os.WriteFile(tempPath, content, 0644); err != nil {
-		os.Remove(tempPath)
-		return "", fmt.Errorf("failed to write commit file: %w", err)
+	stored, err := core.EncodeObjectFile(repo.Root, content)
+	if err != nil {
+		return "", err
 	}
-	
-	// Atomic rename
-	if err := os.Rename(tempPath, objectPath); err != nil {
-		os.Remove(tempPath)
-		return "", fmt.Errorf("failed to finalize commit file: %w", err)
+	if err := writeObjectFileRepo(repo, objectPath, stored); err != nil {
+		return "", fmt.Errorf("failed to write commit: %w", err)
 	}
 
 	return hash, nil
@@ -188,8 +305,7 @@ func CreateCommitRepo(repo *core.Repository, treeHash string, parentHashes []str
 
 // GetCommitRepo reads a commit object from disk using Repository context.
 func GetCommitRepo(repo *core.Repository, hash string) (*Commit, error) {
-	objectPath := GetObjectPathRepo(repo, hash)
-	content, err := os.ReadFile(objectPath)
+	content, err := readObjectRepo(repo, hash)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read commit file: %w", err)
 	}
@@ -215,12 +331,85 @@ func GetCommitRepo(repo *core.Repository, hash string) (*Commit, error) {
 		return nil, fmt.Errorf("failed to deserialize commit: %w", err)
 	}
 	commit.CommitID = hash
+
+	// History stops at the commits a shallow fetch cut off
+	shallow, err := shallowSetRepo(repo)
+	if err != nil {
+		return nil, err
+	}
+	if shallow[hash] {
+		commit.shallowParents, commit.Parents = commit.Parents, nil
+	}
 	return commit, nil
 }
 
+// StoredParents returns the parents recorded in the commit. They differ from
+// Parents only for a shallow commit, whose parents aren't in the repository.
+func (c *Commit) StoredParents() []string {
+	if c.shallowParents != nil {
+		return c.shallowParents
+	}
+	return c.Parents
+}
+
 // GetCommitTime returns the commit time as a time.Time object.
 func (c *Commit) GetCommitTime() time.Time {
-	return time.Unix(c.Timestamp, 0)
+	return c.CommitterTime()
+}
+
+// AuthorTime returns the author date in the author's time zone
+func (c *Commit) AuthorTime() time.Time {
+	return time.Unix(c.Timestamp, 0).In(zoneForOffset(c.AuthorTZ))
+}
+
+// CommitterTime returns the committer date in the committer's time zone
+func (c *Commit) CommitterTime() time.Time {
+	return time.Unix(c.CommitterTimestamp, 0).In(zoneForOffset(c.CommitterTZ))
+}
+
+// AuthorName returns the name of the author
+func (c *Commit) AuthorName() string {
+	name, _ := SplitIdentity(c.Author)
+	return name
+}
+
+// AuthorEmail returns the address of the author
+func (c *Commit) AuthorEmail() string {
+	_, email := SplitIdentity(c.Author)
+	return email
+}
+
+// CommitterName returns the name of the committer
+func (c *Commit) CommitterName() string {
+	name, _ := SplitIdentity(c.Committer)
+	return name
+}
+
+// CommitterEmail returns the address of the committer
+func (c *Commit) CommitterEmail() string {
+	_, email := SplitIdentity(c.Committer)
+	return email
+}
+
+// SplitIdentity returns the name and email of a "Name <email>" identity; an
+// identity without an address is all name
+func SplitIdentity(identity string) (name, email string) {
+	start, end := strings.LastIndex(identity, "<"), strings.LastIndex(identity, ">")
+	if start < 0 || end < start {
+		return strings.TrimSpace(identity), ""
+	}
+	return strings.TrimSpace(identity[:start]), identity[start+1 : end]
+}
+
+// RewriteCommitRepo stores a copy of original with a new tree, parents and
+// message, as amend and rebase make: the author and author date are kept,
+// committer is recorded as committing it now, or at VEC_COMMITTER_DATE
+func RewriteCommitRepo(repo *core.Repository, original *Commit, treeHash string, parentHashes []string, committer, message string, sign bool) (string, error) {
+	committerDate, err := DateFromEnv(CommitterDateEnv, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return createCommitRepo(repo, treeHash, parentHashes, original.Author, committer, message, original.AuthorTime(), committerDate, sign)
 }
 
 // writeLengthPrefixedString writes a length-prefixed string to the buffer.
@@ -0,0 +1,180 @@
+package objects
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables overriding the dates of new commits
+const (
+	AuthorDateEnv    = "VEC_AUTHOR_DATE"
+	CommitterDateEnv = "VEC_COMMITTER_DATE"
+)
+
+// Date formats accepted by --date
+const (
+	DateDefault   = "default"    // Mon Jan 2 15:04:05 2006 -0700
+	DateISO       = "iso"        // 2006-01-02 15:04:05 -0700
+	DateISOStrict = "iso-strict" // 2006-01-02T15:04:05-07:00
+	DateRFC       = "rfc"        // Mon, 2 Jan 2006 15:04:05 -0700
+	DateShort     = "short"      // 2006-01-02
+	DateUnix      = "unix"       // Seconds since the epoch
+	DateRaw       = "raw"        // Seconds since the epoch and UTC offset
+	DateRelative  = "relative"   // 3 days ago
+	DateLocal     = "local"      // Default format in the local time zone
+)
+
+// DateModes lists the accepted --date values
+var DateModes = []string{DateDefault, DateISO, DateISOStrict, DateRFC, DateShort, DateUnix, DateRaw, DateRelative, DateLocal}
+
+// Layouts tried by ParseDate after the "<unix> <offset>" forms
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	time.RFC1123Z,
+	"Mon Jan 2 15:04:05 2006 -0700",
+	"2006-01-02",
+}
+
+// zoneForOffset returns a fixed zone for a UTC offset in seconds
+func zoneForOffset(offset int) *time.Location {
+	if offset == 0 {
+		return time.UTC
+	}
+	return time.FixedZone(FormatZoneOffset(offset), offset)
+}
+
+// FormatZoneOffset renders a UTC offset in seconds as +hhmm
+func FormatZoneOffset(offset int) string {
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	return fmt.Sprintf("%c%02d%02d", sign, offset/3600, offset/60%60)
+}
+
+// parseZoneOffset parses +hhmm into seconds east of UTC
+func parseZoneOffset(value string) (int, bool) {
+	if len(value) != 5 || (value[0] != '+' && value[0] != '-') {
+		return 0, false
+	}
+	hours, err1 := strconv.Atoi(value[1:3])
+	minutes, err2 := strconv.Atoi(value[3:])
+	if err1 != nil || err2 != nil || minutes >= 60 {
+		return 0, false
+	}
+	offset := hours*3600 + minutes*60
+	if value[0] == '-' {
+		offset = -offset
+	}
+	return offset, true
+}
+
+// ParseDate parses a date given in VEC_AUTHOR_DATE or VEC_COMMITTER_DATE:
+// "<unix timestamp> <+hhmm>", "@<unix timestamp>", RFC 3339, RFC 2822 or
+// "YYYY-MM-DD hh:mm:ss [+hhmm]". Dates without a zone are local time.
+func ParseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	raw := strings.TrimPrefix(value, "@")
+	fields := strings.Fields(raw)
+	if len(fields) == 1 || len(fields) == 2 {
+		if seconds, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+			if len(fields) == 1 {
+				return time.Unix(seconds, 0), nil
+			}
+			if offset, ok := parseZoneOffset(fields[1]); ok {
+				return time.Unix(seconds, 0).In(zoneForOffset(offset)), nil
+			}
+		}
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date '%s'", value)
+}
+
+// DateFromEnv returns the date in environment variable name, or fallback if
+// it is unset
+func DateFromEnv(name string, fallback time.Time) (time.Time, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	t, err := ParseDate(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", name, err)
+	}
+	return t, nil
+}
+
+// IsDateMode reports whether mode is an accepted --date value
+func IsDateMode(mode string) bool {
+	for _, m := range DateModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatDate renders t, which carries its original zone, in the given mode
+func FormatDate(t time.Time, mode string) string {
+	switch mode {
+	case DateISO:
+		return t.Format("2006-01-02 15:04:05 -0700")
+	case DateISOStrict:
+		return t.Format(time.RFC3339)
+	case DateRFC:
+		return t.Format(time.RFC1123Z)
+	case DateShort:
+		return t.Format("2006-01-02")
+	case DateUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	case DateRaw:
+		_, offset := t.Zone()
+		return fmt.Sprintf("%d %s", t.Unix(), FormatZoneOffset(offset))
+	case DateRelative:
+		return relativeDate(t, time.Now())
+	case DateLocal:
+		return t.Local().Format("Mon Jan 2 15:04:05 2006")
+	}
+	return t.Format("Mon Jan 2 15:04:05 2006 -0700")
+}
+
+// relativeDate describes how long before now t was
+func relativeDate(t, now time.Time) string {
+	d := now.Sub(t)
+	if d < 0 {
+		return "in the future"
+	}
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"week", 7 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+		{"second", time.Second},
+	}
+	for _, unit := range units {
+		if n := int(d / unit.size); n >= 1 {
+			if n == 1 {
+				return fmt.Sprintf("1 %s ago", unit.name)
+			}
+			return fmt.Sprintf("%d %ss ago", n, unit.name)
+		}
+	}
+	return "just now"
+}
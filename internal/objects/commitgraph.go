@@ -0,0 +1,411 @@
+package objects
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// The commit-graph is a chain of layer files under
+// .vec/objects/info/commit-graphs, listed oldest first in the chain file. Each
+// write adds a layer with the commits not yet in the graph, and layers are
+// merged when a newer one grows close to the size of the one below it.
+const (
+	commitGraphDir   = "info/commit-graphs" // Below .vec/objects
+	commitGraphChain = "commit-graph-chain"
+	commitGraphMagic = "VCGR"
+
+	// A layer is merged into the one below it once that one has fewer than
+	// this many times its commits
+	layerSizeMultiple = 2
+)
+
+// GraphCommit is a commit as stored in the commit-graph
+type GraphCommit struct {
+	Tree       string
+	Parents    []string
+	Time       int64  // Committer timestamp
+	Generation uint32 // One more than the highest generation of the parents
+}
+
+// graphLayer is one file of the commit-graph chain
+type graphLayer struct {
+	name    string // Hex checksum naming the file
+	commits map[string]GraphCommit
+}
+
+// CommitGraph answers commit lookups without reading commit objects
+type CommitGraph struct {
+	layers []*graphLayer
+}
+
+// Lookup returns the commit id from the graph
+func (g *CommitGraph) Lookup(id string) (GraphCommit, bool) {
+	for i := len(g.layers) - 1; i >= 0; i-- {
+		if c, ok := g.layers[i].commits[id]; ok {
+			return c, true
+		}
+	}
+	return GraphCommit{}, false
+}
+
+// Len returns the number of commits in the graph
+func (g *CommitGraph) Len() int {
+	n := 0
+	for _, layer := range g.layers {
+		n += len(layer.commits)
+	}
+	return n
+}
+
+// Layers returns the number of files in the chain
+func (g *CommitGraph) Layers() int {
+	return len(g.layers)
+}
+
+func commitGraphPath(repo *core.Repository, name string) string {
+	return filepath.Join(repo.ObjectsDir, filepath.FromSlash(commitGraphDir), name)
+}
+
+// commitGraphState is a commit-graph as loaded for the chain file last seen
+type commitGraphState struct {
+	modTime time.Time
+	size    int64
+	graph   *CommitGraph
+}
+
+// History walks load the commit-graph once per change of its chain file
+var (
+	commitGraphMu    sync.Mutex
+	commitGraphCache = make(map[string]commitGraphState)
+)
+
+// cachedCommitGraphRepo returns the commit-graph, or nil when none was
+// written or it can't be read; a damaged graph only costs walks their speed
+func cachedCommitGraphRepo(repo *core.Repository) *CommitGraph {
+	path := commitGraphPath(repo, commitGraphChain)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	commitGraphMu.Lock()
+	defer commitGraphMu.Unlock()
+	if state, ok := commitGraphCache[path]; ok && state.modTime.Equal(info.ModTime()) && state.size == info.Size() {
+		return state.graph
+	}
+	graph, err := LoadCommitGraphRepo(repo)
+	if err != nil || graph.Len() == 0 {
+		graph = nil
+	}
+	commitGraphCache[path] = commitGraphState{modTime: info.ModTime(), size: info.Size(), graph: graph}
+	return graph
+}
+
+// parentLoaderRepo returns the commit reader of walks that only follow
+// parent links. Commits in the commit-graph come from it with just their
+// ID, tree, parents and committer date set; the others are read from the
+// object store, as all of them are in a shallow repository, whose cut off
+// parents the graph knows nothing about.
+func parentLoaderRepo(repo *core.Repository) func(id string) (*Commit, error) {
+	read := func(id string) (*Commit, error) {
+		return GetCommitRepo(repo, id)
+	}
+	graph := cachedCommitGraphRepo(repo)
+	if graph == nil || IsShallowRepo(repo) {
+		return read
+	}
+	return func(id string) (*Commit, error) {
+		if c, ok := graph.Lookup(id); ok {
+			return &Commit{CommitID: id, Tree: c.Tree, Parents: c.Parents, CommitterTimestamp: c.Time}, nil
+		}
+		return read(id)
+	}
+}
+
+// generationRepo returns a function giving the generation of a commit in the
+// commit-graph, 0 for one it doesn't hold or when there is none
+func generationRepo(repo *core.Repository) func(id string) uint32 {
+	graph := cachedCommitGraphRepo(repo)
+	if graph == nil || IsShallowRepo(repo) {
+		return func(string) uint32 { return 0 }
+	}
+	return func(id string) uint32 {
+		c, _ := graph.Lookup(id)
+		return c.Generation
+	}
+}
+
+// LoadCommitGraphRepo reads the commit-graph chain; an empty graph if none
+// was written
+func LoadCommitGraphRepo(repo *core.Repository) (*CommitGraph, error) {
+	names, err := core.ReadLayerChain(commitGraphPath(repo, commitGraphChain))
+	if err != nil {
+		return nil, err
+	}
+	graph := &CommitGraph{}
+	for _, name := range names {
+		data, err := core.ReadLayerFile(commitGraphPath(repo, "graph-"+name+".graph"))
+		if err != nil {
+			return nil, err
+		}
+		commits, err := decodeGraphLayer(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid commit-graph layer %s: %w", name, err)
+		}
+		graph.layers = append(graph.layers, &graphLayer{name: name, commits: commits})
+	}
+	return graph, nil
+}
+
+// encodeGraphLayer serializes commits, sorted by id: magic, version, hash
+// length and count, then per commit its id, tree, time, generation, parent
+// count and parents
+func encodeGraphLayer(commits map[string]GraphCommit) ([]byte, error) {
+	ids := make([]string, 0, len(commits))
+	for id := range commits {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	hashLen := 0
+	if len(ids) > 0 {
+		hashLen = len(ids[0]) / 2
+	}
+	var buf bytes.Buffer
+	buf.WriteString(commitGraphMagic)
+	buf.WriteByte(1)
+	buf.WriteByte(byte(hashLen))
+	binary.Write(&buf, binary.BigEndian, uint32(len(ids)))
+
+	writeHash := func(h string) error {
+		raw, err := hex.DecodeString(h)
+		if err != nil || len(raw) != hashLen {
+			return fmt.Errorf("invalid object ID '%s'", h)
+		}
+		buf.Write(raw)
+		return nil
+	}
+	for _, id := range ids {
+		c := commits[id]
+		if err := writeHash(id); err != nil {
+			return nil, err
+		}
+		if err := writeHash(c.Tree); err != nil {
+			return nil, err
+		}
+		binary.Write(&buf, binary.BigEndian, c.Time)
+		binary.Write(&buf, binary.BigEndian, c.Generation)
+		binary.Write(&buf, binary.BigEndian, uint32(len(c.Parents)))
+		for _, p := range c.Parents {
+			if err := writeHash(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeGraphLayer parses the body of a layer file
+func decodeGraphLayer(data []byte) (map[string]GraphCommit, error) {
+	r := bytes.NewReader(data)
+	header := make([]byte, 6)
+	var count uint32
+	if _, err := r.Read(header); err != nil || string(header[:4]) != commitGraphMagic {
+		return nil, fmt.Errorf("bad signature")
+	}
+	if header[4] != 1 {
+		return nil, fmt.Errorf("unsupported version %d", header[4])
+	}
+	hashLen := int(header[5])
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, fmt.Errorf("truncated header")
+	}
+
+	readHash := func() (string, error) {
+		raw := make([]byte, hashLen)
+		if _, err := r.Read(raw); err != nil && hashLen > 0 {
+			return "", err
+		}
+		return hex.EncodeToString(raw), nil
+	}
+	commits := make(map[string]GraphCommit, count)
+	for i := uint32(0); i < count; i++ {
+		id, err := readHash()
+		if err != nil {
+			return nil, fmt.Errorf("truncated entry %d", i)
+		}
+		var c GraphCommit
+		var parents uint32
+		if c.Tree, err = readHash(); err != nil {
+			return nil, fmt.Errorf("truncated entry %d", i)
+		}
+		if err := binary.Read(r, binary.BigEndian, &c.Time); err != nil {
+			return nil, fmt.Errorf("truncated entry %d", i)
+		}
+		if err := binary.Read(r, binary.BigEndian, &c.Generation); err != nil {
+			return nil, fmt.Errorf("truncated entry %d", i)
+		}
+		if err := binary.Read(r, binary.BigEndian, &parents); err != nil || int(parents)*hashLen > r.Len() {
+			return nil, fmt.Errorf("truncated entry %d", i)
+		}
+		for j := uint32(0); j < parents; j++ {
+			p, err := readHash()
+			if err != nil {
+				return nil, fmt.Errorf("truncated entry %d", i)
+			}
+			c.Parents = append(c.Parents, p)
+		}
+		commits[id] = c
+	}
+	return commits, nil
+}
+
+// GraphTipsRepo returns the commits HEAD and the refs point to; refs to
+// other objects, such as annotated tags, are peeled or skipped
+func GraphTipsRepo(repo *core.Repository) ([]string, error) {
+	refs, err := repo.ListRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+	var tips []string
+	if head, err := repo.ReadHead(); err == nil && head != "" {
+		tips = append(tips, head)
+	}
+	for _, ref := range refs {
+		hash := ref.Hash
+		if tag, err := GetTagRepo(repo, hash); err == nil {
+			hash = tag.Object
+		}
+		tips = append(tips, hash)
+	}
+	return tips, nil
+}
+
+// WriteCommitGraphRepo adds the commits reachable from the refs that the
+// graph doesn't hold yet as a new layer, merging layers as needed, and
+// returns how many commits were added
+func WriteCommitGraphRepo(repo *core.Repository) (int, error) {
+	// Shallow commits are read without their parents, which a later deepen
+	// brings in, so what a graph says about them wouldn't stay true
+	if IsShallowRepo(repo) {
+		return 0, nil
+	}
+	graph, err := LoadCommitGraphRepo(repo)
+	if err != nil {
+		return 0, err
+	}
+	tips, err := GraphTipsRepo(repo)
+	if err != nil {
+		return 0, err
+	}
+
+	// Walk back from the tips until reaching commits the graph holds
+	found := make(map[string]*Commit)
+	stack := append([]string{}, tips...)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, ok := graph.Lookup(id); ok || found[id] != nil {
+			continue
+		}
+		commit, err := GetCommitRepo(repo, id)
+		if err != nil {
+			if slices.Contains(tips, id) {
+				continue // A ref to something other than a commit
+			}
+			return 0, fmt.Errorf("failed to read commit %s: %w", id, err)
+		}
+		found[id] = commit
+		stack = append(stack, commit.Parents...)
+	}
+	if len(found) == 0 {
+		return 0, nil
+	}
+
+	// Generations need the parents' first, which may be new as well
+	layer := make(map[string]GraphCommit, len(found))
+	var generation func(id string) uint32
+	generation = func(id string) uint32 {
+		if c, ok := layer[id]; ok {
+			return c.Generation
+		}
+		if c, ok := graph.Lookup(id); ok {
+			return c.Generation
+		}
+		commit := found[id]
+		if commit == nil {
+			return 0
+		}
+		gen := uint32(0)
+		for _, p := range commit.Parents {
+			gen = max(gen, generation(p))
+		}
+		layer[id] = GraphCommit{Tree: commit.Tree, Parents: commit.Parents, Time: commit.CommitterTimestamp, Generation: gen + 1}
+		return gen + 1
+	}
+	ids := make([]string, 0, len(found))
+	for id := range found {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		generation(id)
+	}
+
+	graph.layers = append(graph.layers, &graphLayer{commits: layer})
+	if err := saveCommitGraphRepo(repo, graph); err != nil {
+		return 0, err
+	}
+	return len(layer), nil
+}
+
+// saveCommitGraphRepo merges the top layers while a layer is not much
+// larger than the one above it, writes the layers not yet on disk and
+// replaces the chain, removing files no longer in it
+func saveCommitGraphRepo(repo *core.Repository, graph *CommitGraph) error {
+	layers := graph.layers
+	for len(layers) > 1 {
+		below, top := layers[len(layers)-2], layers[len(layers)-1]
+		if len(below.commits) >= layerSizeMultiple*len(top.commits) {
+			break
+		}
+		merged := &graphLayer{commits: make(map[string]GraphCommit, len(below.commits)+len(top.commits))}
+		for id, c := range below.commits {
+			merged.commits[id] = c
+		}
+		for id, c := range top.commits {
+			merged.commits[id] = c
+		}
+		layers = append(layers[:len(layers)-2], merged)
+	}
+
+	dir := commitGraphPath(repo, "")
+	names := make([]string, 0, len(layers))
+	for _, layer := range layers {
+		if layer.name == "" {
+			data, err := encodeGraphLayer(layer.commits)
+			if err != nil {
+				return err
+			}
+			if layer.name, err = repo.WriteLayerFile(dir, "graph-", ".graph", data); err != nil {
+				return err
+			}
+		}
+		names = append(names, layer.name)
+	}
+	if err := repo.WriteLayerChain(commitGraphPath(repo, commitGraphChain), names); err != nil {
+		return err
+	}
+	graph.layers = layers
+	core.RemoveStaleLayerFiles(dir, "graph-", ".graph", names)
+	return nil
+}
@@ -0,0 +1,120 @@
+package objects
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// ContainsQuery answers whether commits have target in their history. The
+// answer for every commit visited is remembered, so asking about many refs
+// (branch --contains, tag --contains) walks each commit at most once in total.
+// Commits with a bitmap are answered from the bitmap index, and the walk
+// stops at commits whose commit-graph generation is too low to reach target.
+type ContainsQuery struct {
+	repo       *core.Repository
+	target     string
+	memo       map[string]bool
+	load       func(id string) (*Commit, error) // Reads parents from the commit-graph when it can
+	bitmaps    *BitmapIndex                     // nil without one
+	generation func(id string) uint32
+	targetGen  uint32 // 0 when the commit-graph doesn't hold target
+}
+
+// NewContainsQueryRepo prepares a query for commits containing target
+func NewContainsQueryRepo(repo *core.Repository, target string) *ContainsQuery {
+	q := &ContainsQuery{repo: repo, target: target, memo: map[string]bool{target: true},
+		load: parentLoaderRepo(repo), generation: generationRepo(repo)}
+	// A damaged bitmap index only costs the query its speed
+	if bitmaps, err := LoadBitmapIndexRepo(repo); err == nil {
+		q.bitmaps = bitmaps
+	}
+	q.targetGen = q.generation(target)
+	return q
+}
+
+// decide answers for commit without walking its history when it can: a
+// commit with a bitmap contains target exactly when the bitmap has it, and
+// one whose generation isn't above target's can't have target as ancestor
+func (q *ContainsQuery) decide(commit string) (result, known bool) {
+	if q.bitmaps != nil {
+		if reached, known, err := q.bitmaps.reaches(commit, q.target); err == nil && known {
+			return reached, true
+		}
+	}
+	if q.targetGen > 0 {
+		if gen := q.generation(commit); gen > 0 && gen <= q.targetGen {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// containsFrame is a DFS stack frame used by Contains
+type containsFrame struct {
+	commit *Commit
+	next   int
+}
+
+// Contains reports whether target is commit or one of its ancestors.
+// Corruption is reported as ErrCorruptGraph, like WalkAncestorsRepo.
+func (q *ContainsQuery) Contains(commit string) (bool, error) {
+	if result, ok := q.memo[commit]; ok {
+		return result, nil
+	}
+	if result, ok := q.decide(commit); ok {
+		q.memo[commit] = result
+		return result, nil
+	}
+
+	// A commit is decided once all its parents are, or as soon as one of
+	// them contains target
+	inProgress := make(map[string]bool)
+	root, err := q.load(commit)
+	if err != nil {
+		return false, fmt.Errorf("failed to load commit %s: %w", commit, err)
+	}
+	stack := []containsFrame{{commit: root}}
+	inProgress[commit] = true
+
+	found := false
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if found || top.next >= len(top.commit.Parents) {
+			q.memo[top.commit.CommitID] = found
+			delete(inProgress, top.commit.CommitID)
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		parent := top.commit.Parents[top.next]
+		top.next++
+		if result, ok := q.memo[parent]; ok {
+			found = found || result
+			continue
+		}
+		if result, ok := q.decide(parent); ok {
+			q.memo[parent] = result
+			found = found || result
+			continue
+		}
+		if inProgress[parent] {
+			return false, fmt.Errorf("%w: cycle detected at %s", ErrCorruptGraph, shortHash(parent))
+		}
+		if !isValidObjectHash(parent) {
+			return false, fmt.Errorf("%w: commit %s has malformed parent '%s'", ErrCorruptGraph, top.commit.CommitID, parent)
+		}
+		next, err := q.load(parent)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return false, fmt.Errorf("%w: parent %s of commit %s is missing", ErrCorruptGraph, parent, top.commit.CommitID)
+			}
+			return false, fmt.Errorf("%w: parent %s of commit %s is unreadable: %v", ErrCorruptGraph, parent, top.commit.CommitID, err)
+		}
+		inProgress[parent] = true
+		stack = append(stack, containsFrame{commit: next})
+	}
+	return q.memo[commit], nil
+}
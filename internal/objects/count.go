@@ -0,0 +1,96 @@
+package objects
+
+import (
+	"fmt"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// ObjectCount is the number of objects of each type a transfer will include
+type ObjectCount struct {
+	Commits int
+	Trees   int
+	Blobs   int
+}
+
+// Total returns the number of objects of all types
+func (c ObjectCount) Total() int {
+	return c.Commits + c.Trees + c.Blobs
+}
+
+// CountObjectsRepo estimates how many objects are reachable from wants but
+// not from haves, so progress can show totals before any object is packed.
+// Only commits and trees are read: blobs are counted from tree entries, and
+// each tree is expanded once however many commits share it. Trees of the
+// have tips are treated as already present, so the count can be slightly
+// higher than the exact set when older have history contains the same trees.
+// Haves missing from the repository are ignored.
+func CountObjectsRepo(repo *core.Repository, wants, haves []string) (ObjectCount, error) {
+	var count ObjectCount
+	known := make([]string, 0, len(haves))
+	for _, have := range haves {
+		if have != "" && core.ObjectExists(repo.Root, have) {
+			known = append(known, have)
+		}
+	}
+	haves = known
+	seenTrees := make(map[string]bool)
+	seenBlobs := make(map[string]bool)
+
+	haveCommits := make(map[string]bool)
+	err := walkParentsRepo(repo, haves, func(c *Commit) (bool, error) {
+		haveCommits[c.CommitID] = true
+		return false, nil
+	})
+	if err != nil {
+		return count, err
+	}
+	for _, have := range haves {
+		commit, err := GetCommitRepo(repo, have)
+		if err != nil {
+			return count, fmt.Errorf("failed to load commit %s: %w", have, err)
+		}
+		var ignored ObjectCount
+		if err := countTreeRepo(repo, commit.Tree, seenTrees, seenBlobs, &ignored); err != nil {
+			return count, err
+		}
+	}
+
+	err = walkParentsRepo(repo, wants, func(c *Commit) (bool, error) {
+		if haveCommits[c.CommitID] {
+			return false, nil
+		}
+		count.Commits++
+		return false, countTreeRepo(repo, c.Tree, seenTrees, seenBlobs, &count)
+	})
+	return count, err
+}
+
+// countTreeRepo adds treeID and the trees and blobs below it that are not yet
+// in seenTrees or seenBlobs to count
+func countTreeRepo(repo *core.Repository, treeID string, seenTrees, seenBlobs map[string]bool, count *ObjectCount) error {
+	queue := []string{treeID}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if seenTrees[hash] {
+			continue
+		}
+		seenTrees[hash] = true
+		count.Trees++
+
+		tree, err := GetTreeRepo(repo, hash)
+		if err != nil {
+			return fmt.Errorf("failed to read tree %s: %w", hash, err)
+		}
+		for _, entry := range tree.Entries {
+			if entry.Type == "tree" {
+				queue = append(queue, entry.Hash)
+			} else if !entry.IsGitlink() && !seenBlobs[entry.Hash] {
+				seenBlobs[entry.Hash] = true
+				count.Blobs++
+			}
+		}
+	}
+	return nil
+}
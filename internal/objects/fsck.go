@@ -0,0 +1,272 @@
+package objects
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/packfile"
+)
+
+// ErrMalformedObject reports an object that fails structural validation
+var ErrMalformedObject = errors.New("malformed object")
+
+// Tree entry modes. Files use the decimal spelling the index writes; trees
+// use the octal constant. A gitlink records the commit a submodule is at;
+// that commit lives in the submodule's repository, not this one.
+const (
+	ModeFile       int32 = 100644
+	ModeExecutable int32 = 100755
+	ModeSymlink    int32 = 120000
+	ModeGitlink    int32 = 160000
+	ModeTree       int32 = 040000
+)
+
+// identityPattern matches "Name <email>"
+var identityPattern = regexp.MustCompile(`^[^<>\n]+ <[^<>\n]*>$`)
+
+// IsValidTreeMode reports whether mode may appear in a tree entry
+func IsValidTreeMode(mode int32) bool {
+	switch mode {
+	case ModeFile, ModeExecutable, ModeSymlink, ModeGitlink, ModeTree:
+		return true
+	}
+	return false
+}
+
+// isCanonicalObjectID reports whether hash is a full lowercase SHA-256 object ID
+func isCanonicalObjectID(hash string) bool {
+	return len(hash) == 64 && isValidObjectHash(hash) && hash == strings.ToLower(hash)
+}
+
+// malformed wraps a validation failure of the object hash in ErrMalformedObject
+func malformed(hash, format string, args ...interface{}) error {
+	return fmt.Errorf("%w %s: %s", ErrMalformedObject, hash, fmt.Sprintf(format, args...))
+}
+
+// CheckObject validates the structure of an object of type objType before it
+// is written to the store: commit headers and UTF-8 text, tree entry names,
+// modes and ordering, and the format of every object ID involved.
+func CheckObject(hash, objType string, data []byte) error {
+	if !isCanonicalObjectID(hash) {
+		return malformed(hash, "invalid object ID")
+	}
+	switch objType {
+	case "blob":
+		return nil
+	case "commit":
+		return checkCommit(hash, data)
+	case "tree":
+		return checkTree(hash, data)
+	case "tag":
+		return checkTag(hash, data)
+	}
+	return malformed(hash, "unknown object type '%s'", objType)
+}
+
+// CheckPackObjects runs CheckObject on every object of an incoming pack,
+// stopping at the first malformed one
+func CheckPackObjects(objs []packfile.Object) error {
+	for i := range objs {
+		obj := &objs[i]
+		objType := obj.TypeName()
+		if objType == "blob" {
+			continue
+		}
+		data, err := packfile.ObjectData(obj)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(append([]byte(fmt.Sprintf("%s %d\x00", objType, len(data))), data...))
+		if err := CheckObject(hex.EncodeToString(sum[:]), objType, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCommit validates a serialized commit
+func checkCommit(hash string, data []byte) error {
+	commit, err := deserializeCommit(data)
+	if err != nil {
+		return malformed(hash, "%v", err)
+	}
+	if canonical, err := commit.serialize(); err != nil || !bytes.Equal(canonical, data) {
+		return malformed(hash, "trailing or non-canonical commit data")
+	}
+
+	if !isCanonicalObjectID(commit.Tree) {
+		return malformed(hash, "invalid tree ID '%s'", commit.Tree)
+	}
+	for _, parent := range commit.Parents {
+		if !isCanonicalObjectID(parent) {
+			return malformed(hash, "invalid parent ID '%s'", parent)
+		}
+	}
+	for field, identity := range map[string]string{"author": commit.Author, "committer": commit.Committer} {
+		if !utf8.ValidString(identity) {
+			return malformed(hash, "%s is not valid UTF-8", field)
+		}
+		if !identityPattern.MatchString(identity) {
+			return malformed(hash, "invalid %s '%s' (expected 'Name <email>')", field, identity)
+		}
+	}
+	if commit.Timestamp <= 0 || commit.CommitterTimestamp <= 0 {
+		return malformed(hash, "invalid timestamp")
+	}
+	for _, offset := range []int{commit.AuthorTZ, commit.CommitterTZ} {
+		if offset <= -24*3600 || offset >= 24*3600 {
+			return malformed(hash, "invalid time zone offset %d", offset)
+		}
+	}
+	if !utf8.ValidString(commit.Message) {
+		return malformed(hash, "message is not valid UTF-8")
+	}
+	return nil
+}
+
+// checkTree validates a serialized tree
+func checkTree(hash string, data []byte) error {
+	tree, err := DeserializeTreeObject(data)
+	if err != nil {
+		return malformed(hash, "%v", err)
+	}
+	for i, entry := range tree.Entries {
+		if err := checkTreeEntryName(entry.Name); err != nil {
+			return malformed(hash, "%v", err)
+		}
+		if !IsValidTreeMode(entry.Mode) {
+			return malformed(hash, "entry '%s' has invalid mode %06d", entry.Name, entry.Mode)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := tree.Entries[i-1]
+		switch {
+		case prev.Name == entry.Name:
+			return malformed(hash, "duplicate entry '%s'", entry.Name)
+		case treeEntrySortKey(prev) > treeEntrySortKey(entry):
+			return malformed(hash, "entries '%s' and '%s' are out of order", prev.Name, entry.Name)
+		}
+	}
+	return nil
+}
+
+// checkTag validates a serialized tag
+func checkTag(hash string, data []byte) error {
+	tag, err := deserializeTag(data)
+	if err != nil {
+		return malformed(hash, "%v", err)
+	}
+	if !bytes.Equal(tag.serialize(), data) {
+		return malformed(hash, "non-canonical tag data")
+	}
+	if !isCanonicalObjectID(tag.Object) {
+		return malformed(hash, "invalid object ID '%s'", tag.Object)
+	}
+	switch tag.Type {
+	case "commit", "tree", "blob", "tag":
+	default:
+		return malformed(hash, "invalid tagged object type '%s'", tag.Type)
+	}
+	if strings.ContainsAny(tag.Name, " \n") || tag.Name == "" {
+		return malformed(hash, "invalid tag name '%s'", tag.Name)
+	}
+	if !identityPattern.MatchString(tag.Tagger) {
+		return malformed(hash, "invalid tagger '%s' (expected 'Name <email>')", tag.Tagger)
+	}
+	if !utf8.ValidString(tag.Message) {
+		return malformed(hash, "message is not valid UTF-8")
+	}
+	return nil
+}
+
+// checkTreeEntryName rejects names that can't be a single path component
+func checkTreeEntryName(name string) error {
+	switch {
+	case name == "" || name == "." || name == "..":
+		return fmt.Errorf("invalid entry name '%s'", name)
+	case name == core.VecDirName:
+		return fmt.Errorf("entry name '%s' is reserved", name)
+	case strings.ContainsAny(name, "/\x00"):
+		return fmt.Errorf("entry name '%s' contains a path separator", name)
+	case !utf8.ValidString(name):
+		return fmt.Errorf("entry name is not valid UTF-8")
+	}
+	return nil
+}
+
+// FsckObjectsEnabledRepo reports whether incoming objects are validated: key
+// (receive.fsckObjects or fetch.fsckObjects) wins, transfer.fsckObjects is
+// the fallback for both directions.
+func FsckObjectsEnabledRepo(repo *core.Repository, key string) (bool, error) {
+	for _, k := range []string{key, "transfer.fsckObjects"} {
+		value, err := repo.GetConfig(k)
+		if err != nil {
+			return false, core.ConfigError(fmt.Sprintf("failed to read %s", k), err)
+		}
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "":
+			continue
+		case "true", "yes", "on", "1":
+			return true, nil
+		case "false", "no", "off", "0":
+			return false, nil
+		}
+		return false, core.ConfigError(fmt.Sprintf("invalid boolean value '%s' for %s", value, k), nil)
+	}
+	return false, nil
+}
+
+// ObjectLink is a reference from an object to another
+type ObjectLink struct {
+	Hash string
+	Type string // Type the target must have; empty when any will do
+	Name string // What refers to it, such as "parent" or "entry 'main.go'"
+}
+
+// ObjectLinks returns the objects a serialized object of type objType
+// refers to. Gitlinks are left out: their commits live in another
+// repository.
+func ObjectLinks(objType string, data []byte) ([]ObjectLink, error) {
+	var links []ObjectLink
+	switch objType {
+	case "commit":
+		commit, err := deserializeCommit(data)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, ObjectLink{Hash: commit.Tree, Type: "tree", Name: "tree"})
+		for _, parent := range commit.Parents {
+			links = append(links, ObjectLink{Hash: parent, Type: "commit", Name: "parent"})
+		}
+	case "tree":
+		tree, err := DeserializeTreeObject(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range tree.Entries {
+			if entry.IsGitlink() {
+				continue
+			}
+			entryType := "blob"
+			if isTreeEntryDir(entry) {
+				entryType = "tree"
+			}
+			links = append(links, ObjectLink{Hash: entry.Hash, Type: entryType, Name: fmt.Sprintf("entry '%s'", entry.Name)})
+		}
+	case "tag":
+		tag, err := deserializeTag(data)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, ObjectLink{Hash: tag.Object, Type: tag.Type, Name: "object"})
+	}
+	return links, nil
+}
@@ -0,0 +1,259 @@
+package objects
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// ErrCorruptGraph is returned by history walks when the commit graph cannot be
+// valid: a parent is missing or unreadable, a parent hash is malformed, or the
+// parent links form a cycle. Use errors.Is to detect it.
+var ErrCorruptGraph = errors.New("corrupt commit graph")
+
+// MaxGraphWalk caps the number of commits a single walk will visit. Histories
+// this large are almost certainly the result of corruption rather than real work.
+const MaxGraphWalk = 1 << 22
+
+// walkFrame is a DFS stack frame used by WalkAncestorsRepo.
+type walkFrame struct {
+	commit *Commit
+	next   int // index of the next parent to descend into
+}
+
+// WalkAncestorsRepo visits every commit reachable from starts exactly once,
+// depth first, calling visit for each commit before its parents. If visit
+// returns true the walk stops early without error.
+//
+// Parent links are validated as they are followed: malformed hashes, missing
+// parents and cycles are reported as ErrCorruptGraph with the offending
+// commits named in the message. Shallow commits have no parents to follow.
+func WalkAncestorsRepo(repo *core.Repository, starts []string, visit func(*Commit) (bool, error)) error {
+	return walkAncestors(starts, func(id string) (*Commit, error) {
+		return GetCommitRepo(repo, id)
+	}, visit)
+}
+
+// walkParentsRepo is WalkAncestorsRepo for walks that only need the IDs,
+// trees, parents and committer dates of commits, which it takes from the
+// commit-graph when it holds them
+func walkParentsRepo(repo *core.Repository, starts []string, visit func(*Commit) (bool, error)) error {
+	return walkAncestors(starts, parentLoaderRepo(repo), visit)
+}
+
+// walkAncestors is WalkAncestorsRepo reading commits with load
+func walkAncestors(starts []string, load func(id string) (*Commit, error), visit func(*Commit) (bool, error)) error {
+	const (
+		inProgress = 1
+		done       = 2
+	)
+	state := make(map[string]int)
+	visited := 0
+
+	for _, start := range starts {
+		if start == "" || state[start] == done {
+			continue
+		}
+		if !isValidObjectHash(start) {
+			return fmt.Errorf("invalid commit hash '%s'", start)
+		}
+
+		root, err := load(start)
+		if err != nil {
+			return fmt.Errorf("failed to load commit %s: %w", start, err)
+		}
+
+		stack := []walkFrame{{commit: root}}
+		state[start] = inProgress
+		visited++
+		if stop, err := visit(root); err != nil || stop {
+			return err
+		}
+
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			if top.next >= len(top.commit.Parents) {
+				state[top.commit.CommitID] = done
+				stack = stack[:len(stack)-1]
+				continue
+			}
+
+			parent := top.commit.Parents[top.next]
+			top.next++
+
+			switch state[parent] {
+			case done:
+				continue
+			case inProgress:
+				return fmt.Errorf("%w: cycle detected: %s", ErrCorruptGraph, describeCycle(stack, parent))
+			}
+
+			if !isValidObjectHash(parent) {
+				return fmt.Errorf("%w: commit %s has malformed parent '%s'", ErrCorruptGraph, top.commit.CommitID, parent)
+			}
+
+			commit, err := load(parent)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return fmt.Errorf("%w: parent %s of commit %s is missing", ErrCorruptGraph, parent, top.commit.CommitID)
+				}
+				return fmt.Errorf("%w: parent %s of commit %s is unreadable: %v", ErrCorruptGraph, parent, top.commit.CommitID, err)
+			}
+
+			visited++
+			if visited > MaxGraphWalk {
+				return fmt.Errorf("%w: walked more than %d commits from %s without reaching a root (last visited %s)",
+					ErrCorruptGraph, MaxGraphWalk, start, parent)
+			}
+
+			state[parent] = inProgress
+			stack = append(stack, walkFrame{commit: commit})
+			if stop, err := visit(commit); err != nil || stop {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// IsAncestorRepo reports whether ancestor is reachable from descendant by
+// following parent links. A commit is considered its own ancestor. Corruption
+// found along the way is returned as ErrCorruptGraph rather than a false result.
+func IsAncestorRepo(repo *core.Repository, ancestor, descendant string) (bool, error) {
+	if ancestor == "" || descendant == "" {
+		return false, nil
+	}
+	if ancestor == descendant {
+		return true, nil
+	}
+
+	found := false
+	err := walkParentsRepo(repo, []string{descendant}, func(c *Commit) (bool, error) {
+		if c.CommitID == ancestor {
+			found = true
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return found, nil
+}
+
+// AheadBehindRepo counts the commits reachable from local but not upstream
+// (ahead) and from upstream but not local (behind).
+func AheadBehindRepo(repo *core.Repository, local, upstream string) (ahead, behind int, err error) {
+	if local == upstream {
+		return 0, 0, nil
+	}
+
+	reachable := func(start string) (map[string]bool, error) {
+		seen := make(map[string]bool)
+		if start == "" {
+			return seen, nil
+		}
+		err := walkParentsRepo(repo, []string{start}, func(c *Commit) (bool, error) {
+			seen[c.CommitID] = true
+			return false, nil
+		})
+		return seen, err
+	}
+
+	fromLocal, err := reachable(local)
+	if err != nil {
+		return 0, 0, err
+	}
+	fromUpstream, err := reachable(upstream)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for id := range fromLocal {
+		if !fromUpstream[id] {
+			ahead++
+		}
+	}
+	for id := range fromUpstream {
+		if !fromLocal[id] {
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
+
+// CommitsBetweenRepo lists the commits reachable from include but not from
+// exclude, newest first by committer date. An empty exclude lists the whole
+// history of include.
+func CommitsBetweenRepo(repo *core.Repository, exclude, include string) ([]*Commit, error) {
+	excluded := make(map[string]bool)
+	if exclude != "" {
+		err := walkParentsRepo(repo, []string{exclude}, func(c *Commit) (bool, error) {
+			excluded[c.CommitID] = true
+			return false, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var commits []*Commit
+	err := WalkAncestorsRepo(repo, []string{include}, func(c *Commit) (bool, error) {
+		if !excluded[c.CommitID] {
+			commits = append(commits, c)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].CommitterTimestamp > commits[j].CommitterTimestamp
+	})
+	return commits, nil
+}
+
+// Subject returns the first line of the commit message
+func (c *Commit) Subject() string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(c.Message), "\n")
+	return strings.TrimSpace(subject)
+}
+
+// describeCycle renders the portion of the DFS stack that loops back to target.
+func describeCycle(stack []walkFrame, target string) string {
+	var path []string
+	for i := len(stack) - 1; i >= 0; i-- {
+		path = append(path, shortHash(stack[i].commit.CommitID))
+		if stack[i].commit.CommitID == target {
+			break
+		}
+	}
+	// Reverse so the cycle reads from the oldest frame to the newest
+	for l, r := 0, len(path)-1; l < r; l, r = l+1, r-1 {
+		path[l], path[r] = path[r], path[l]
+	}
+	return strings.Join(path, " -> ") + " -> " + shortHash(target)
+}
+
+// isValidObjectHash reports whether hash looks like a full SHA-1 or SHA-256 hex digest.
+func isValidObjectHash(hash string) bool {
+	if len(hash) != 40 && len(hash) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// shortHash abbreviates a hash for diagnostics.
+func shortHash(hash string) string {
+	if len(hash) > 8 {
+		return hash[:8]
+	}
+	return hash
+}
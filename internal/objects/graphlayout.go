@@ -0,0 +1,195 @@
+package objects
+
+import (
+	"container/heap"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// GraphEdge is a line of a commit graph from lane From of one row to lane To
+// of the next, on the way to Parent
+type GraphEdge struct {
+	From   int    `json:"from"`
+	To     int    `json:"to"`
+	Parent string `json:"parent"`
+}
+
+// GraphRow is one commit of a laid out graph
+type GraphRow struct {
+	Hash    string   `json:"hash"`
+	Lane    int      `json:"lane"`
+	Parents []string `json:"parents"`
+	Subject string   `json:"subject"`
+	Author  string   `json:"author"`
+	Time    int64    `json:"time"` // Committer timestamp (Unix time)
+
+	Merge bool `json:"merge"` // More than one parent
+	Fork  bool `json:"fork"`  // More than one child in the graph
+
+	// Edges are the lines drawn between this row and the next: lanes passing
+	// by the commit and the lines from the commit to its parents
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphLayout is a commit graph ordered newest first, children always
+// before their parents, with each commit placed in a lane
+type GraphLayout struct {
+	Lanes int        `json:"lanes"` // Width of the graph
+	Rows  []GraphRow `json:"rows"`
+}
+
+// commitHeap orders commits newest first by committer date
+type commitHeap []*Commit
+
+func (h commitHeap) Len() int { return len(h) }
+func (h commitHeap) Less(i, j int) bool {
+	if h[i].CommitterTimestamp != h[j].CommitterTimestamp {
+		return h[i].CommitterTimestamp > h[j].CommitterTimestamp
+	}
+	return h[i].CommitID < h[j].CommitID
+}
+func (h commitHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *commitHeap) Push(x any)   { *h = append(*h, x.(*Commit)) }
+func (h *commitHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// TopoSortRepo returns the commits reachable from starts with every commit
+// before its parents, breaking ties by newest committer date
+func TopoSortRepo(repo *core.Repository, starts []string) ([]*Commit, error) {
+	commits := make(map[string]*Commit)
+	err := WalkAncestorsRepo(repo, starts, func(c *Commit) (bool, error) {
+		commits[c.CommitID] = c
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[string]int, len(commits))
+	for _, c := range commits {
+		for _, p := range c.Parents {
+			children[p]++
+		}
+	}
+	ready := &commitHeap{}
+	for id, c := range commits {
+		if children[id] == 0 {
+			*ready = append(*ready, c)
+		}
+	}
+	heap.Init(ready)
+
+	sorted := make([]*Commit, 0, len(commits))
+	for ready.Len() > 0 {
+		c := heap.Pop(ready).(*Commit)
+		sorted = append(sorted, c)
+		for _, p := range c.Parents {
+			children[p]--
+			if children[p] == 0 {
+				heap.Push(ready, commits[p])
+			}
+		}
+	}
+	return sorted, nil
+}
+
+// LayoutGraphRepo lays out the history reachable from starts, at most limit
+// rows when limit is positive. Edges to parents beyond the limit are kept so
+// the lines can be drawn leaving the graph.
+func LayoutGraphRepo(repo *core.Repository, starts []string, limit int) (*GraphLayout, error) {
+	commits, err := TopoSortRepo(repo, starts)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(commits) > limit {
+		commits = commits[:limit]
+	}
+	return LayoutGraph(commits), nil
+}
+
+// LayoutGraph places commits, ordered children first, in lanes. A commit
+// continues the lane of its first child; merges open lanes for their other
+// parents and each commit expected by several lanes joins them in one.
+func LayoutGraph(commits []*Commit) *GraphLayout {
+	children := make(map[string]int)
+	for _, c := range commits {
+		for _, p := range c.Parents {
+			children[p]++
+		}
+	}
+
+	layout := &GraphLayout{Rows: make([]GraphRow, 0, len(commits))}
+	var lanes []string // Commit each lane is heading to, "" for a free lane
+	laneOf := func(lanes []string, hash string) int {
+		for i, h := range lanes {
+			if h == hash {
+				return i
+			}
+		}
+		return -1
+	}
+	freeLane := func(lanes []string) int {
+		if i := laneOf(lanes, ""); i >= 0 {
+			return i
+		}
+		return len(lanes)
+	}
+
+	for _, c := range commits {
+		col := laneOf(lanes, c.CommitID)
+		if col < 0 {
+			col = freeLane(lanes)
+		}
+		if col == len(lanes) {
+			lanes = append(lanes, "")
+		}
+		lanes[col] = c.CommitID
+
+		row := GraphRow{
+			Hash:    c.CommitID,
+			Lane:    col,
+			Parents: append([]string{}, c.Parents...),
+			Subject: c.Subject(),
+			Author:  c.Author,
+			Time:    c.CommitterTimestamp,
+			Merge:   len(c.Parents) > 1,
+			Fork:    children[c.CommitID] > 1,
+			Edges:   []GraphEdge{},
+		}
+
+		next := append([]string{}, lanes...)
+		next[col] = ""
+		for j, h := range lanes {
+			if h != "" && j != col {
+				row.Edges = append(row.Edges, GraphEdge{j, j, h})
+			}
+		}
+		for i, p := range c.Parents {
+			to := laneOf(next, p)
+			if to < 0 {
+				if i == 0 {
+					to = col
+				} else {
+					to = freeLane(next)
+				}
+				if to == len(next) {
+					next = append(next, "")
+				}
+				next[to] = p
+			}
+			row.Edges = append(row.Edges, GraphEdge{col, to, p})
+		}
+		for len(next) > 0 && next[len(next)-1] == "" {
+			next = next[:len(next)-1]
+		}
+
+		layout.Lanes = max(layout.Lanes, len(lanes), len(next))
+		layout.Rows = append(layout.Rows, row)
+		lanes = next
+	}
+	return layout
+}
@@ -0,0 +1,116 @@
+package objects
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// ancestorSetRepo returns start and every commit reachable from it, with
+// only their IDs, trees, parents and committer dates certain to be set
+func ancestorSetRepo(repo *core.Repository, start string) (map[string]*Commit, error) {
+	seen := make(map[string]*Commit)
+	err := walkParentsRepo(repo, []string{start}, func(c *Commit) (bool, error) {
+		seen[c.CommitID] = c
+		return false, nil
+	})
+	return seen, err
+}
+
+// MergeBasesRepo returns the best common ancestors of a and b: the common
+// ancestors that aren't an ancestor of another common ancestor. There is
+// more than one after criss-cross merges. The result is sorted newest first
+// by committer date and is empty for unrelated histories.
+func MergeBasesRepo(repo *core.Repository, a, b string) ([]string, error) {
+	return MergeBasesManyRepo(repo, a, []string{b})
+}
+
+// MergeBasesManyRepo returns the best common ancestors of one and a
+// hypothetical merge of all of others, like MergeBasesRepo
+func MergeBasesManyRepo(repo *core.Repository, one string, others []string) ([]string, error) {
+	if len(others) == 1 && others[0] == one {
+		return []string{one}, nil
+	}
+	fromOne, err := ancestorSetRepo(repo, one)
+	if err != nil {
+		return nil, err
+	}
+	fromOthers := make(map[string]bool)
+	if len(others) > 0 {
+		err = walkParentsRepo(repo, others, func(c *Commit) (bool, error) {
+			fromOthers[c.CommitID] = true
+			return false, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	common := make(map[string]*Commit)
+	for id, commit := range fromOne {
+		if fromOthers[id] {
+			common[id] = commit
+		}
+	}
+	return bestCommits(common), nil
+}
+
+// bestCommits returns the commits of set that aren't a parent of another
+// commit in it. set must be closed under ancestry, so being no commit's
+// parent is the same as being no commit's ancestor.
+func bestCommits(set map[string]*Commit) []string {
+	redundant := make(map[string]bool)
+	for _, commit := range set {
+		for _, parent := range commit.Parents {
+			redundant[parent] = true
+		}
+	}
+	var best []*Commit
+	for id, commit := range set {
+		if !redundant[id] {
+			best = append(best, commit)
+		}
+	}
+	return sortNewestFirst(best)
+}
+
+// sortNewestFirst orders commits by committer date, newest first, with the
+// ID as tie breaker so the output is stable
+func sortNewestFirst(commits []*Commit) []string {
+	sort.Slice(commits, func(i, j int) bool {
+		if commits[i].CommitterTimestamp != commits[j].CommitterTimestamp {
+			return commits[i].CommitterTimestamp > commits[j].CommitterTimestamp
+		}
+		return commits[i].CommitID < commits[j].CommitID
+	})
+	ids := make([]string, len(commits))
+	for i, commit := range commits {
+		ids[i] = commit.CommitID
+	}
+	return ids
+}
+
+// OctopusMergeBasesRepo returns the best common ancestors of all commits,
+// as needed for a merge of more than two heads
+func OctopusMergeBasesRepo(repo *core.Repository, commits []string) ([]string, error) {
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("no commits given")
+	}
+	common, err := ancestorSetRepo(repo, commits[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, commit := range commits[1:] {
+		ancestors, err := ancestorSetRepo(repo, commit)
+		if err != nil {
+			return nil, err
+		}
+		for id := range common {
+			if _, ok := ancestors[id]; !ok {
+				delete(common, id)
+			}
+		}
+	}
+	return bestCommits(common), nil
+}
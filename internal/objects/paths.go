@@ -1,9 +1,12 @@
 package objects
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
 
 	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/packfile"
 )
 
 // GetObjectPathRepo returns the path to an object using Repository context.
@@ -11,3 +14,36 @@ import (
 func GetObjectPathRepo(repo *core.Repository, hash string) string {
 	return filepath.Join(repo.ObjectsDir, hash[:2], hash[2:])
 }
+
+// readObjectRepo returns the stored content of an object, header included,
+// from its loose file or from the pack holding it
+func readObjectRepo(repo *core.Repository, hash string) ([]byte, error) {
+	return packfile.ReadObjectRepo(repo, hash)
+}
+
+// HasObjectRepo reports whether the object is in the store, loose or packed
+func HasObjectRepo(repo *core.Repository, hash string) bool {
+	return packfile.HasObjectRepo(repo, hash)
+}
+
+// writeObjectFileRepo stores the encoded object at objectPath through a
+// temporary file, with the modes core.sharedRepository gives
+func writeObjectFileRepo(repo *core.Repository, objectPath string, stored []byte) error {
+	perms, err := repo.Permissions()
+	if err != nil {
+		return err
+	}
+	if err := perms.MkdirAll(filepath.Dir(objectPath)); err != nil {
+		return err
+	}
+	tempPath := objectPath + ".tmp"
+	if err := perms.WriteFile(tempPath, stored); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write object file: %w", err)
+	}
+	if err := os.Rename(tempPath, objectPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to finalize object file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package objects
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// RevListOptions controls what RevListRepo lists
+type RevListOptions struct {
+	FirstParent bool // Follow only the first parent of each commit
+	MaxCount    int  // List at most this many commits; 0 for all
+	Objects     bool // Also list the tags, trees and blobs the listed commits need
+	OmitBlobs   bool // With Objects, leave blobs out
+}
+
+// ListedObject is one object listed by RevListRepo
+type ListedObject struct {
+	Hash string
+	Type string // commit, tag, tree or blob
+	Path string // Where a tree or blob was first found below its commit's tree
+}
+
+// RevListRepo lists the commits reachable from include but not from
+// exclude, children before parents and otherwise newest first, followed
+// with Objects by the tags, trees and blobs they need that aren't reachable
+// from exclude. Tips may be tags, which are peeled. This is the traversal
+// packs are built from.
+func RevListRepo(repo *core.Repository, include, exclude []string, options RevListOptions) ([]ListedObject, error) {
+	excludedObjects := make(map[string]bool)
+	excludeCommits, _, err := peelTipsRepo(repo, exclude, excludedObjects)
+	if err != nil {
+		return nil, err
+	}
+	includedObjects := make(map[string]bool)
+	includeCommits, roots, err := peelTipsRepo(repo, include, includedObjects)
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := make(map[string]*Commit)
+	err = WalkAncestorsRepo(repo, excludeCommits, func(c *Commit) (bool, error) {
+		excluded[c.CommitID] = c
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := walkIncludedRepo(repo, includeCommits, excluded, options.FirstParent)
+	if err != nil {
+		return nil, err
+	}
+	if options.MaxCount > 0 && len(commits) > options.MaxCount {
+		commits = commits[:options.MaxCount]
+	}
+
+	listed := make([]ListedObject, 0, len(commits))
+	for _, c := range commits {
+		listed = append(listed, ListedObject{Hash: c.CommitID, Type: "commit"})
+	}
+	if !options.Objects {
+		return listed, nil
+	}
+
+	// Trees and blobs of excluded commits are already there
+	for _, c := range excluded {
+		if err := walkTreeObjectsRepo(repo, c.Tree, "", excludedObjects, options.OmitBlobs, nil); err != nil {
+			return nil, err
+		}
+	}
+	for hash := range includedObjects {
+		if !excludedObjects[hash] {
+			listed = append(listed, ListedObject{Hash: hash, Type: "tag"})
+		}
+	}
+	add := func(obj ListedObject) {
+		listed = append(listed, obj)
+	}
+	for _, root := range roots {
+		if excludedObjects[root.Hash] {
+			continue
+		}
+		if root.Type == "tree" {
+			if err := walkTreeObjectsRepo(repo, root.Hash, root.Path, excludedObjects, options.OmitBlobs, add); err != nil {
+				return nil, err
+			}
+		} else if !options.OmitBlobs {
+			excludedObjects[root.Hash] = true
+			add(root)
+		}
+	}
+	for _, c := range commits {
+		if err := walkTreeObjectsRepo(repo, c.Tree, "", excludedObjects, options.OmitBlobs, add); err != nil {
+			return nil, err
+		}
+	}
+	return listed, nil
+}
+
+// peelTipsRepo resolves tips to commits, adding the tags peeled on the way
+// to tags. Tags of trees or blobs are returned as roots to list.
+func peelTipsRepo(repo *core.Repository, tips []string, tags map[string]bool) ([]string, []ListedObject, error) {
+	var commits []string
+	var roots []ListedObject
+	for _, tip := range tips {
+		hash, objType := tip, "commit"
+		for {
+			t, err := ObjectTypeRepo(repo, hash)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read object %s: %w", hash, err)
+			}
+			if objType = t; objType != "tag" {
+				break
+			}
+			tag, err := GetTagRepo(repo, hash)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read tag %s: %w", hash, err)
+			}
+			tags[hash] = true
+			hash = tag.Object
+		}
+		if objType == "commit" {
+			commits = append(commits, hash)
+		} else {
+			roots = append(roots, ListedObject{Hash: hash, Type: objType})
+		}
+	}
+	return commits, roots, nil
+}
+
+// walkIncludedRepo returns the commits reachable from starts that aren't in
+// excluded, children before parents; with firstParent only first parents
+// are followed
+func walkIncludedRepo(repo *core.Repository, starts []string, excluded map[string]*Commit, firstParent bool) ([]*Commit, error) {
+	if !firstParent {
+		all, err := TopoSortRepo(repo, starts)
+		if err != nil {
+			return nil, err
+		}
+		commits := all[:0]
+		for _, c := range all {
+			if excluded[c.CommitID] == nil {
+				commits = append(commits, c)
+			}
+		}
+		return commits, nil
+	}
+
+	// First-parent chains are already in order; merge them by date
+	seen := make(map[string]bool)
+	var commits []*Commit
+	for _, start := range starts {
+		for hash := start; hash != "" && !seen[hash] && excluded[hash] == nil; {
+			seen[hash] = true
+			c, err := GetCommitRepo(repo, hash)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load commit %s: %w", hash, err)
+			}
+			commits = append(commits, c)
+			hash = ""
+			if len(c.Parents) > 0 {
+				hash = c.Parents[0]
+			}
+		}
+	}
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].CommitterTimestamp > commits[j].CommitterTimestamp
+	})
+	return commits, nil
+}
+
+// walkTreeObjectsRepo marks treeID and the trees and blobs below it as seen,
+// passing those not seen before to add, if set, with their path. Trees
+// already seen are not expanded again; gitlinks are skipped. Missing trees
+// are reported as ErrCorruptGraph.
+func walkTreeObjectsRepo(repo *core.Repository, treeID, treePath string, seen map[string]bool, omitBlobs bool, add func(ListedObject)) error {
+	if seen[treeID] {
+		return nil
+	}
+	seen[treeID] = true
+	if add != nil {
+		add(ListedObject{Hash: treeID, Type: "tree", Path: treePath})
+	}
+	tree, err := GetTreeRepo(repo, treeID)
+	if err != nil {
+		return fmt.Errorf("%w: tree %s is unreadable: %v", ErrCorruptGraph, treeID, err)
+	}
+	for _, entry := range tree.Entries {
+		entryPath := path.Join(treePath, entry.Name)
+		switch {
+		case entry.Type == "tree":
+			if err := walkTreeObjectsRepo(repo, entry.Hash, entryPath, seen, omitBlobs, add); err != nil {
+				return err
+			}
+		case entry.IsGitlink(), omitBlobs, seen[entry.Hash]:
+		default:
+			seen[entry.Hash] = true
+			if add != nil {
+				add(ListedObject{Hash: entry.Hash, Type: "blob", Path: entryPath})
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+package objects
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// ShallowFile, in .vec, lists one per line the commits whose parents a
+// shallow fetch left out. GetCommitRepo reads them as having no parents, so
+// every history walk stops at them.
+const ShallowFile = "shallow"
+
+// UnshallowDepth deepens a shallow repository all the way, as --unshallow does
+const UnshallowDepth = 1<<31 - 1
+
+// shallowFileState is the content of a shallow file as last read
+type shallowFileState struct {
+	modTime time.Time
+	size    int64
+	commits map[string]bool
+}
+
+// The shallow file is consulted for every commit read; it is only read
+// again when it changes
+var (
+	shallowMu    sync.Mutex
+	shallowFiles = make(map[string]shallowFileState)
+)
+
+func shallowPath(repo *core.Repository) string {
+	return filepath.Join(repo.VecDir, ShallowFile)
+}
+
+// shallowSetRepo returns the shallow commits; none for a complete repository
+func shallowSetRepo(repo *core.Repository) (map[string]bool, error) {
+	path := shallowPath(repo)
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read shallow file: %w", err)
+	}
+
+	shallowMu.Lock()
+	defer shallowMu.Unlock()
+	if state, ok := shallowFiles[path]; ok && state.modTime.Equal(info.ModTime()) && state.size == info.Size() {
+		return state.commits, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shallow file: %w", err)
+	}
+	commits := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if !isValidObjectHash(line) {
+			return nil, fmt.Errorf("invalid commit '%s' in shallow file", line)
+		}
+		commits[line] = true
+	}
+	shallowFiles[path] = shallowFileState{modTime: info.ModTime(), size: info.Size(), commits: commits}
+	return commits, nil
+}
+
+// ReadShallowRepo returns the shallow commits, sorted; none for a complete
+// repository
+func ReadShallowRepo(repo *core.Repository) ([]string, error) {
+	set, err := shallowSetRepo(repo)
+	if err != nil {
+		return nil, err
+	}
+	commits := make([]string, 0, len(set))
+	for commit := range set {
+		commits = append(commits, commit)
+	}
+	sort.Strings(commits)
+	return commits, nil
+}
+
+// IsShallowRepo reports whether a shallow fetch cut off the history
+func IsShallowRepo(repo *core.Repository) bool {
+	set, err := shallowSetRepo(repo)
+	return err == nil && len(set) > 0
+}
+
+// WriteShallowRepo replaces the shallow file with commits; without any the
+// file is removed and the repository is complete again
+func WriteShallowRepo(repo *core.Repository, commits []string) error {
+	path := shallowPath(repo)
+	shallowMu.Lock()
+	delete(shallowFiles, path)
+	shallowMu.Unlock()
+
+	if len(commits) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove shallow file: %w", err)
+		}
+		return nil
+	}
+	sorted := append([]string(nil), commits...)
+	sort.Strings(sorted)
+	var content strings.Builder
+	for i, commit := range sorted {
+		if i == 0 || commit != sorted[i-1] {
+			content.WriteString(commit + "\n")
+		}
+	}
+
+	perms, err := repo.Permissions()
+	if err != nil {
+		return err
+	}
+	if err := perms.WriteFile(path+".lock", []byte(content.String())); err != nil {
+		os.Remove(path + ".lock")
+		return fmt.Errorf("failed to write shallow file: %w", err)
+	}
+	if err := os.Rename(path+".lock", path); err != nil {
+		os.Remove(path + ".lock")
+		return fmt.Errorf("failed to write shallow file: %w", err)
+	}
+	return nil
+}
+
+// UpdateShallowRepo records as shallow, after a fetch, the commits below tips
+// or below the current shallow commits that lack a parent in the store, and
+// returns them. Commits a deepening fetch completed are no longer shallow.
+func UpdateShallowRepo(repo *core.Repository, tips []string) ([]string, error) {
+	current, err := ReadShallowRepo(repo)
+	if err != nil {
+		return nil, err
+	}
+	var stack []string
+	for _, tip := range append(append([]string(nil), tips...), current...) {
+		for {
+			objType, err := ObjectTypeRepo(repo, tip)
+			if err != nil || objType != "tag" {
+				if err == nil && objType == "commit" {
+					stack = append(stack, tip)
+				}
+				break
+			}
+			tag, err := GetTagRepo(repo, tip)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read tag %s: %w", tip, err)
+			}
+			tip = tag.Object
+		}
+	}
+
+	seen := make(map[string]bool)
+	var shallow []string
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		c, err := GetCommitRepo(repo, hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load commit %s: %w", hash, err)
+		}
+		complete := true
+		for _, parent := range c.StoredParents() {
+			if HasObjectRepo(repo, parent) {
+				stack = append(stack, parent)
+			} else {
+				complete = false
+			}
+		}
+		if !complete {
+			shallow = append(shallow, hash)
+		}
+	}
+	if err := WriteShallowRepo(repo, shallow); err != nil {
+		return nil, err
+	}
+	sort.Strings(shallow)
+	return shallow, nil
+}
+
+// ShallowOptions cuts off the history a fetch sends
+type ShallowOptions struct {
+	Depth    int      // Commits to send below each want, the want included; 0 for no limit
+	Relative bool     // Count Depth below the client's shallow commits instead of from the wants
+	Shallow  []string // The client's shallow commits, whose parents it lacks
+}
+
+// shallowDepth is how far below the cut-off point a commit is; zero when
+// there's no limit
+type shallowDepth int
+
+// below returns the depth of the parents of a commit at d
+func (d shallowDepth) below() shallowDepth {
+	if d == 0 {
+		return 0
+	}
+	return d + 1
+}
+
+// better reports whether reaching a commit at d leaves more history below it
+// than at other
+func (d shallowDepth) better(other shallowDepth) bool {
+	return other != 0 && (d == 0 || d < other)
+}
+
+// ShallowObjectsRepo lists the objects reachable from include that a client
+// with haves and the shallow commits of options lacks, as RevListRepo does
+// with Objects, leaving out the history below Depth. The client's shallow
+// commits are taken to have nothing below them, so deepening sends their
+// ancestors.
+func ShallowObjectsRepo(repo *core.Repository, include, haves []string, options ShallowOptions, omitBlobs bool) ([]ListedObject, error) {
+	clientShallow := make(map[string]bool, len(options.Shallow))
+	for _, commit := range options.Shallow {
+		clientShallow[commit] = true
+	}
+
+	// What the client has, without parents of its shallow commits
+	excludedObjects := make(map[string]bool)
+	haveCommits, _, err := peelTipsRepo(repo, haves, excludedObjects)
+	if err != nil {
+		return nil, err
+	}
+	clientHas := make(map[string]*Commit)
+	for stack := haveCommits; len(stack) > 0; {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if clientHas[hash] != nil {
+			continue
+		}
+		c, err := GetCommitRepo(repo, hash)
+		if err != nil {
+			return nil, fmt.Errorf("%w: commit %s is unreadable: %v", ErrCorruptGraph, hash, err)
+		}
+		clientHas[hash] = c
+		if !clientShallow[hash] {
+			stack = append(stack, c.Parents...)
+		}
+	}
+
+	includedObjects := make(map[string]bool)
+	wantCommits, roots, err := peelTipsRepo(repo, include, includedObjects)
+	if err != nil {
+		return nil, err
+	}
+	type pending struct {
+		hash  string
+		depth shallowDepth
+	}
+	start := shallowDepth(0)
+	if options.Depth > 0 && !options.Relative {
+		start = 1
+	}
+	var stack []pending
+	for _, want := range wantCommits {
+		stack = append(stack, pending{want, start})
+	}
+	best := make(map[string]shallowDepth)
+	sent := make(map[string]*Commit)
+	for len(stack) > 0 {
+		next := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if d, seen := best[next.hash]; seen && !next.depth.better(d) {
+			continue
+		}
+		best[next.hash] = next.depth
+
+		c := clientHas[next.hash]
+		below := next.depth.below()
+		if c != nil {
+			// Only the history below the client's shallow commits is
+			// missing, and only a deepening fetch goes down to it
+			if options.Depth == 0 || len(clientShallow) == 0 {
+				continue
+			}
+			if clientShallow[next.hash] && options.Relative {
+				below = 1
+			}
+		} else {
+			if c, err = GetCommitRepo(repo, next.hash); err != nil {
+				return nil, fmt.Errorf("%w: commit %s is unreadable: %v", ErrCorruptGraph, next.hash, err)
+			}
+			sent[next.hash] = c
+		}
+		if below != 0 && int(below) > options.Depth {
+			continue
+		}
+		for _, parent := range c.Parents {
+			stack = append(stack, pending{parent, below})
+		}
+	}
+
+	commits := make([]*Commit, 0, len(sent))
+	for _, c := range sent {
+		commits = append(commits, c)
+	}
+	sort.Slice(commits, func(i, j int) bool {
+		if commits[i].CommitterTimestamp != commits[j].CommitterTimestamp {
+			return commits[i].CommitterTimestamp > commits[j].CommitterTimestamp
+		}
+		return commits[i].CommitID < commits[j].CommitID
+	})
+
+	listed := make([]ListedObject, 0, len(commits))
+	for _, c := range commits {
+		listed = append(listed, ListedObject{Hash: c.CommitID, Type: "commit"})
+	}
+	for _, c := range clientHas {
+		if err := walkTreeObjectsRepo(repo, c.Tree, "", excludedObjects, omitBlobs, nil); err != nil {
+			return nil, err
+		}
+	}
+	for hash := range includedObjects {
+		if !excludedObjects[hash] {
+			listed = append(listed, ListedObject{Hash: hash, Type: "tag"})
+		}
+	}
+	add := func(obj ListedObject) {
+		listed = append(listed, obj)
+	}
+	for _, root := range roots {
+		if excludedObjects[root.Hash] {
+			continue
+		}
+		if root.Type == "tree" {
+			if err := walkTreeObjectsRepo(repo, root.Hash, root.Path, excludedObjects, omitBlobs, add); err != nil {
+				return nil, err
+			}
+		} else if !omitBlobs {
+			excludedObjects[root.Hash] = true
+			add(root)
+		}
+	}
+	for _, c := range commits {
+		if err := walkTreeObjectsRepo(repo, c.Tree, "", excludedObjects, omitBlobs, add); err != nil {
+			return nil, err
+		}
+	}
+	return listed, nil
+}
@@ -0,0 +1,159 @@
+package objects
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// Commit signatures are made and checked with ssh-keygen -Y in this namespace
+const SignatureNamespace = "vec"
+
+// Keys configuring commit signatures
+const (
+	SigningKeyKey     = "user.signingKey"            // Private key, or public key held by an agent
+	AllowedSignersKey = "gpg.ssh.allowedSignersFile" // ssh-keygen allowed signers list
+)
+
+// Outcomes of VerifyCommitSignatureRepo
+const (
+	SignatureGood      = "good"      // Valid and made by an allowed signer for the committer
+	SignatureBad       = "bad"       // Doesn't verify against the commit
+	SignatureUntrusted = "untrusted" // Valid, but the key isn't allowed for the committer
+	SignatureUnsigned  = "unsigned"
+)
+
+// ErrNoAllowedSigners is returned when signatures are checked without an
+// allowed signers file
+var ErrNoAllowedSigners = errors.New(AllowedSignersKey + " is not configured")
+
+// SignatureCheck is the result of verifying a commit's signature
+type SignatureCheck struct {
+	Status    string
+	Principal string // Identity the signature was checked against (the committer's email)
+}
+
+// SignedPayload returns the bytes a signature of c covers: its serialization
+// without the signature
+func (c *Commit) SignedPayload() ([]byte, error) {
+	unsigned := *c
+	unsigned.Signature = ""
+	data, err := unsigned.serialize()
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize commit: %w", err)
+	}
+	return data, nil
+}
+
+// configPathRepo reads a path setting, expanding ~/ and resolving relative
+// paths against the working tree
+func configPathRepo(repo *core.Repository, key string) (string, error) {
+	path, err := repo.GetConfig(key)
+	if err != nil {
+		return "", core.ConfigError("failed to read "+key, err)
+	}
+	if path == "" {
+		return "", nil
+	}
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(repo.Root, path)
+	}
+	return path, nil
+}
+
+// SignPayloadRepo signs payload with user.signingKey using ssh-keygen
+func SignPayloadRepo(repo *core.Repository, payload []byte) (string, error) {
+	key, err := configPathRepo(repo, SigningKeyKey)
+	if err != nil {
+		return "", err
+	}
+	if key == "" {
+		return "", core.ConfigError(SigningKeyKey+" is not configured", nil)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("ssh-keygen", "-Y", "sign", "-n", SignatureNamespace, "-f", key)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to sign commit: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// committerEmail returns the address in "Name <email>"
+func committerEmail(identity string) string {
+	start, end := strings.LastIndex(identity, "<"), strings.LastIndex(identity, ">")
+	if start < 0 || end < start {
+		return identity
+	}
+	return identity[start+1 : end]
+}
+
+// VerifyCommitSignatureRepo checks the signature of commit against
+// gpg.ssh.allowedSignersFile, with the committer's email as the principal
+func VerifyCommitSignatureRepo(repo *core.Repository, commit *Commit) (*SignatureCheck, error) {
+	check := &SignatureCheck{Status: SignatureUnsigned, Principal: committerEmail(commit.Committer)}
+	if commit.Signature == "" {
+		return check, nil
+	}
+	allowedSigners, err := configPathRepo(repo, AllowedSignersKey)
+	if err != nil {
+		return nil, err
+	}
+	if allowedSigners == "" {
+		return nil, ErrNoAllowedSigners
+	}
+
+	payload, err := commit.SignedPayload()
+	if err != nil {
+		return nil, err
+	}
+	sigFile, err := core.CreateTempFile(repo.Root, "vec-signature", ".sig")
+	if err != nil {
+		return nil, err
+	}
+	defer core.RemoveTempFile(sigFile.Name())
+	_, err = sigFile.WriteString(commit.Signature)
+	if closeErr := sigFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write signature: %w", err)
+	}
+
+	runKeygen := func(args ...string) error {
+		cmd := exec.Command("ssh-keygen", args...)
+		cmd.Stdin = bytes.NewReader(payload)
+		return cmd.Run()
+	}
+	err = runKeygen("-Y", "verify", "-f", allowedSigners, "-I", check.Principal,
+		"-n", SignatureNamespace, "-s", sigFile.Name())
+	if err == nil {
+		check.Status = SignatureGood
+		return check, nil
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("failed to run ssh-keygen: %w", err)
+	}
+
+	// Tell a valid signature by a key that isn't allowed from a bad one
+	if runKeygen("-Y", "check-novalidate", "-n", SignatureNamespace, "-s", sigFile.Name()) == nil {
+		check.Status = SignatureUntrusted
+	} else {
+		check.Status = SignatureBad
+	}
+	return check, nil
+}
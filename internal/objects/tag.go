@@ -0,0 +1,238 @@
+package objects
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/packfile"
+	"github.com/NahomAnteneh/vec/utils"
+)
+
+// Tag is an annotated tag object: a named pointer to another object with a
+// tagger and message of its own
+type Tag struct {
+	TagID     string
+	Object    string // Hash of the tagged object
+	Type      string // Type of the tagged object: commit, tree, blob or tag
+	Name      string
+	Tagger    string // "Name <email>"
+	Timestamp int64  // Tagger date, Unix seconds
+	TaggerTZ  int    // Tagger UTC offset in seconds
+	Message   string
+
+	// Signature is an SSH signature over the tag serialized without it,
+	// stored after the message; empty for unsigned tags
+	Signature string
+}
+
+// tagSignatureBegin starts the armored signature following a signed tag's
+// message
+const tagSignatureBegin = "-----BEGIN SSH SIGNATURE-----"
+
+// serialize renders t as text headers followed by a blank line and the
+// message:
+//
+//	object <hash>
+//	type <type>
+//	tag <name>
+//	tagger <identity> <unix time> <+hhmm>
+//
+// A signature follows the message.
+func (t *Tag) serialize() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "object %s\n", t.Object)
+	fmt.Fprintf(&buf, "type %s\n", t.Type)
+	fmt.Fprintf(&buf, "tag %s\n", t.Name)
+	fmt.Fprintf(&buf, "tagger %s %d %s\n", t.Tagger, t.Timestamp, FormatZoneOffset(t.TaggerTZ))
+	buf.WriteString("\n")
+	buf.WriteString(t.Message)
+	buf.WriteString(t.Signature)
+	return buf.Bytes()
+}
+
+// SignedPayload returns the bytes a signature of t covers: its
+// serialization without the signature
+func (t *Tag) SignedPayload() []byte {
+	unsigned := *t
+	unsigned.Signature = ""
+	return unsigned.serialize()
+}
+
+// deserializeTag parses the content of a tag object
+func deserializeTag(data []byte) (*Tag, error) {
+	headers, message, ok := strings.Cut(string(data), "\n\n")
+	if !ok {
+		return nil, fmt.Errorf("missing blank line after tag headers")
+	}
+	tag := &Tag{Message: message}
+	if i := strings.Index(message, tagSignatureBegin); i >= 0 && (i == 0 || message[i-1] == '\n') {
+		tag.Message, tag.Signature = message[:i], message[i:]
+	}
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(headers, "\n") {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid tag header '%s'", line)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate tag header '%s'", key)
+		}
+		seen[key] = true
+		switch key {
+		case "object":
+			tag.Object = value
+		case "type":
+			tag.Type = value
+		case "tag":
+			tag.Name = value
+		case "tagger":
+			fields := strings.Fields(value)
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("invalid tagger '%s'", value)
+			}
+			timestamp, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tagger date in '%s'", value)
+			}
+			offset, ok := parseZoneOffset(fields[len(fields)-1])
+			if !ok {
+				return nil, fmt.Errorf("invalid tagger time zone in '%s'", value)
+			}
+			tag.Tagger = strings.Join(fields[:len(fields)-2], " ")
+			tag.Timestamp, tag.TaggerTZ = timestamp, offset
+		default:
+			return nil, fmt.Errorf("unknown tag header '%s'", key)
+		}
+	}
+	for _, key := range []string{"object", "type", "tag", "tagger"} {
+		if !seen[key] {
+			return nil, fmt.Errorf("missing tag header '%s'", key)
+		}
+	}
+	return tag, nil
+}
+
+// TaggerTime returns the tagger date in the tagger's time zone
+func (t *Tag) TaggerTime() time.Time {
+	return time.Unix(t.Timestamp, 0).In(zoneForOffset(t.TaggerTZ))
+}
+
+// CreateTagRepo writes tag as a tag object and returns its hash. With sign
+// the tag is first signed with user.signingKey.
+func CreateTagRepo(repo *core.Repository, tag *Tag, sign bool) (string, error) {
+	if tag.Object == "" || tag.Type == "" || tag.Name == "" || tag.Tagger == "" {
+		return "", fmt.Errorf("tag object, type, name and tagger cannot be empty")
+	}
+	if sign {
+		signature, err := SignPayloadRepo(repo, tag.SignedPayload())
+		if err != nil {
+			return "", err
+		}
+		tag.Signature = signature
+	}
+
+	data := tag.serialize()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "tag %d\x00", len(data))
+	buf.Write(data)
+	content := buf.Bytes()
+
+	hash := utils.HashBytes("tag", content)
+	tag.TagID = hash
+
+	objectPath := GetObjectPathRepo(repo, hash)
+	if utils.FileExists(objectPath) {
+		return hash, nil
+	}
+	stored, err := core.EncodeObjectFile(repo.Root, content)
+	if err != nil {
+		return "", err
+	}
+	if err := writeObjectFileRepo(repo, objectPath, stored); err != nil {
+		return "", fmt.Errorf("failed to write tag: %w", err)
+	}
+	return hash, nil
+}
+
+// GetTagRepo reads a tag object from disk
+func GetTagRepo(repo *core.Repository, hash string) (*Tag, error) {
+	content, err := readObjectRepo(repo, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tag file: %w", err)
+	}
+	headerEnd := bytes.IndexByte(content, '\x00')
+	if headerEnd == -1 {
+		return nil, fmt.Errorf("invalid tag format: missing header")
+	}
+	header := string(content[:headerEnd])
+	if expected := fmt.Sprintf("tag %d", len(content)-headerEnd-1); header != expected {
+		return nil, fmt.Errorf("invalid tag header: got '%s', expected '%s'", header, expected)
+	}
+
+	tag, err := deserializeTag(content[headerEnd+1:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize tag: %w", err)
+	}
+	tag.TagID = hash
+	return tag, nil
+}
+
+// ObjectTypeRepo returns the type in the header of a loose object, or that
+// of the object in a pack
+func ObjectTypeRepo(repo *core.Repository, hash string) (string, error) {
+	file, err := os.Open(GetObjectPathRepo(repo, hash))
+	if os.IsNotExist(err) {
+		objType, err := packfile.PackStoreRepo(repo).ObjectType(hash)
+		if err != nil {
+			return "", fmt.Errorf("failed to open object %s: %w", hash, err)
+		}
+		return objType, nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to open object %s: %w", hash, err)
+	}
+	defer file.Close()
+
+	header := make([]byte, 16)
+	n, err := file.Read(header)
+	if err != nil {
+		return "", fmt.Errorf("failed to read object %s: %w", hash, err)
+	}
+	header = header[:n]
+	if core.IsEncryptedObject(header) || (len(header) > 0 && header[0] == 0x78) {
+		// The header is only readable once the whole file is decrypted, or
+		// inflated when it was stored compressed
+		if header, err = readObjectRepo(repo, hash); err != nil {
+			return "", fmt.Errorf("failed to read object %s: %w", hash, err)
+		}
+	}
+	objType, _, ok := strings.Cut(string(header), " ")
+	if !ok {
+		return "", fmt.Errorf("invalid header for object %s", hash)
+	}
+	return objType, nil
+}
+
+// PeelTagRepo follows tag objects from hash until a non-tag object and
+// returns its hash and type
+func PeelTagRepo(repo *core.Repository, hash string) (string, string, error) {
+	for depth := 0; depth < 16; depth++ {
+		objType, err := ObjectTypeRepo(repo, hash)
+		if err != nil {
+			return "", "", err
+		}
+		if objType != "tag" {
+			return hash, objType, nil
+		}
+		tag, err := GetTagRepo(repo, hash)
+		if err != nil {
+			return "", "", err
+		}
+		hash = tag.Object
+	}
+	return "", "", fmt.Errorf("tag %s is nested too deeply", hash)
+}
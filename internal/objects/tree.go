@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/hex"
 	"fmt"
-	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -45,10 +44,8 @@ func (t *TreeObject) Serialize() ([]byte, error) {
 
 	var buf bytes.Buffer
 
-	// Sort entries by name to ensure consistent serialization (Git standard)
-	sort.Slice(t.Entries, func(i, j int) bool {
-		return t.Entries[i].Name < t.Entries[j].Name
-	})
+	// Sort entries canonically to ensure consistent serialization
+	SortTreeEntries(t.Entries)
 
 	// Serialize each entry
 	for _, entry := range t.Entries {
@@ -121,8 +118,11 @@ func DeserializeTreeObject(data []byte) (*TreeObject, error) {
 			return nil, fmt.Errorf("invalid mode '%s' for entry '%s': %w", modeStr, name, err)
 		}
 		entryType := "blob"
-		if mode == 040000 {
+		switch int32(mode) {
+		case ModeTree:
 			entryType = "tree"
+		case ModeGitlink:
+			entryType = "commit"
 		}
 
 		tree.Entries = append(tree.Entries, TreeEntry{
@@ -158,6 +158,57 @@ func (t *TreeObject) SetTreeID() (string, error) {
 	return hash, nil
 }
 
+// isTreeEntryDir reports whether entry is a subtree
+func isTreeEntryDir(entry TreeEntry) bool {
+	return entry.Type == "tree" || entry.Mode == ModeTree
+}
+
+// IsGitlink reports whether entry records a submodule commit. Its hash
+// names an object of another repository, so walks of this repository's
+// objects skip it.
+func (e TreeEntry) IsGitlink() bool {
+	return e.Mode == ModeGitlink
+}
+
+// treeEntrySortKey is the name entries are ordered by: subtrees sort as if
+// their name ended in "/", so "a.txt" comes before the directory "a".
+func treeEntrySortKey(entry TreeEntry) string {
+	if isTreeEntryDir(entry) {
+		return entry.Name + "/"
+	}
+	return entry.Name
+}
+
+// SortTreeEntries puts entries in canonical tree order
+func SortTreeEntries(entries []TreeEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return treeEntrySortKey(entries[i]) < treeEntrySortKey(entries[j])
+	})
+}
+
+// ValidateTreeEntries checks that entries can form a tree: every name is a
+// single path component used once, every mode is known and every hash is a
+// full object ID.
+func ValidateTreeEntries(entries []TreeEntry) error {
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if err := checkTreeEntryName(entry.Name); err != nil {
+			return fmt.Errorf("entry with hash '%s': %w", entry.Hash, err)
+		}
+		if seen[entry.Name] {
+			return fmt.Errorf("duplicate tree entry '%s'", entry.Name)
+		}
+		seen[entry.Name] = true
+		if !IsValidTreeMode(entry.Mode) {
+			return fmt.Errorf("invalid mode %06d for entry '%s'", entry.Mode, entry.Name)
+		}
+		if len(entry.Hash) != 64 {
+			return fmt.Errorf("invalid hash length for entry '%s': expected 64, got %d", entry.Name, len(entry.Hash))
+		}
+	}
+	return nil
+}
+
 // CreateTreeObject serializes entries into a tree object, stores it on disk, and returns its hash (legacy function).
 func CreateTreeObject(entries []TreeEntry) (string, error) {
 	repoRoot, err := utils.GetVecRoot()
@@ -170,15 +221,17 @@ func CreateTreeObject(entries []TreeEntry) (string, error) {
 }
 
 // CreateTreeObjectRepo serializes entries into a tree object using Repository context.
+// Entries are validated and written in canonical order, so the same content
+// always produces the same hash.
 func CreateTreeObjectRepo(repo *core.Repository, entries []TreeEntry) (string, error) {
+	if err := ValidateTreeEntries(entries); err != nil {
+		return "", err
+	}
+	entries = append([]TreeEntry(nil), entries...)
+	SortTreeEntries(entries)
+
 	var content bytes.Buffer
 	for _, entry := range entries {
-		if entry.Name == "" {
-			return "", fmt.Errorf("entry with hash '%s' has empty name", entry.Hash)
-		}
-		if len(entry.Hash) != 64 {
-			return "", fmt.Errorf("invalid hash length for entry '%s': expected 64, got %d", entry.Name, len(entry.Hash))
-		}
 		modeStr := fmt.Sprintf("%06d", entry.Mode)
 
 		hashBytes, err := hex.DecodeString(entry.Hash)
@@ -196,13 +249,12 @@ func CreateTreeObjectRepo(repo *core.Repository, entries []TreeEntry) (string, e
 	hash := utils.HashBytes("tree", fullContent)
 	objectPath := GetObjectPathRepo(repo, hash)
 
-	// Ensure the directory exists.
-	if err := utils.EnsureDirExists(filepath.Dir(objectPath)); err != nil {
-		return "", fmt.Errorf("failed to create directory for object '%s': %w", hash, err)
-	}
-
 	// Write the object to disk.
-	if err := os.WriteFile(objectPath, fullContent, 0644); err != nil {
+	stored, err := core.EncodeObjectFile(repo.Root, fullContent)
+	if err != nil {
+		return "", err
+	}
+	if err := writeObjectFileRepo(repo, objectPath, stored); err != nil {
 		return "", fmt.Errorf("failed to write tree object '%s': %w", hash, err)
 	}
 
@@ -238,10 +290,9 @@ func GetTreeRepo(repo *core.Repository, hash string) (*TreeObject, error) {
 		return nil, fmt.Errorf("invalid hash length: expected 64, got %d", len(hash))
 	}
 
-	objectPath := GetObjectPathRepo(repo, hash)
-	content, err := os.ReadFile(objectPath)
+	content, err := readObjectRepo(repo, hash)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read tree file '%s': %w", objectPath, err)
+		return nil, fmt.Errorf("failed to read tree '%s': %w", hash, err)
 	}
 
 	// Extract content after the header.
@@ -271,6 +322,36 @@ func GetTreeRepo(repo *core.Repository, hash string) (*TreeObject, error) {
 	return tree, nil
 }
 
+// FindTreeEntryRepo returns the entry at the slash separated path below
+// treeID, or nil when there is none
+func FindTreeEntryRepo(repo *core.Repository, treeID, path string) (*TreeEntry, error) {
+	names := strings.Split(strings.Trim(path, "/"), "/")
+	hash := treeID
+	for i, name := range names {
+		if hash == "" {
+			return nil, nil
+		}
+		tree, err := GetTreeRepo(repo, hash)
+		if err != nil {
+			return nil, err
+		}
+		hash = ""
+		for _, entry := range tree.Entries {
+			if entry.Name != name {
+				continue
+			}
+			if i == len(names)-1 {
+				return &entry, nil
+			}
+			if entry.Type == "tree" {
+				hash = entry.Hash
+			}
+			break
+		}
+	}
+	return nil, nil
+}
+
 // BuildTreeRecursively constructs tree entries for a given directory key in the map (legacy function).
 func BuildTreeRecursively(dirPath string, treeMap map[string][]TreeEntry, repoRoot string) ([]TreeEntry, error) {
 	repo := core.NewRepository(repoRoot)
@@ -342,10 +423,11 @@ func BuildTreeRecursivelyRepo(dirPath string, treeMap map[string][]TreeEntry, re
 		})
 	}
 
-	// Sort entries by name for consistency.
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].Name < entries[j].Name
-	})
+	// A file and a directory of the same name can't share a tree
+	if err := ValidateTreeEntries(entries); err != nil {
+		return nil, fmt.Errorf("invalid tree for '%s': %w", dirPath, err)
+	}
+	SortTreeEntries(entries)
 
 	return entries, nil
 }
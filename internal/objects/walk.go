@@ -0,0 +1,309 @@
+package objects
+
+import (
+	"container/heap"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// WalkOptions selects the commits a CommitWalker yields
+type WalkOptions struct {
+	Include     []string // Commits to start from
+	Exclude     []string // Commits reachable from these are left out
+	FirstParent bool     // Follow only first parents
+	Topo        bool     // Children before parents, as drawn in a graph; otherwise newest first
+
+	Since, Until time.Time // Committer date bounds; zero when unset
+	Author       string    // Regexp the author must match, ignoring case
+	Paths        []string  // Only commits changing a file at or below one of these paths
+
+	// RewriteParents, with Topo, gives yielded commits the nearest yielded
+	// ancestors as parents, so a graph of a filtered history stays connected
+	RewriteParents bool
+
+	// OnSkew is called for a parent committed after its child: newest first
+	// walks stop at the first commit older than Since, and may miss commits
+	OnSkew func(child, parent *Commit)
+}
+
+// CommitWalker iterates over history, see WalkOptions
+type CommitWalker struct {
+	repo     *core.Repository
+	options  WalkOptions
+	author   *regexp.Regexp
+	excluded map[string]bool
+
+	queue *commitHeap     // Newest first walks: commits waiting to be yielded
+	seen  map[string]bool // Newest first walks: commits queued once
+	list  []*Commit       // Topo walks: the commits to yield, filtered
+}
+
+// NewCommitWalkerRepo prepares a walk of the history selected by options
+func NewCommitWalkerRepo(repo *core.Repository, options WalkOptions) (*CommitWalker, error) {
+	w := &CommitWalker{repo: repo, options: options, excluded: make(map[string]bool)}
+	if options.Author != "" {
+		author, err := regexp.Compile("(?i)" + options.Author)
+		if err != nil {
+			return nil, fmt.Errorf("invalid author pattern: %w", err)
+		}
+		w.author = author
+	}
+	w.options.Paths = make([]string, len(options.Paths))
+	for i, p := range options.Paths {
+		w.options.Paths[i] = strings.Trim(p, "/")
+	}
+	err := WalkAncestorsRepo(repo, options.Exclude, func(c *Commit) (bool, error) {
+		w.excluded[c.CommitID] = true
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Topo {
+		return w, w.sortRepo()
+	}
+	w.queue, w.seen = &commitHeap{}, make(map[string]bool)
+	for _, hash := range options.Include {
+		if err := w.enqueue(hash); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Next returns the next commit, or nil when there are no more
+func (w *CommitWalker) Next() (*Commit, error) {
+	if w.options.Topo {
+		if len(w.list) == 0 {
+			return nil, nil
+		}
+		c := w.list[0]
+		w.list = w.list[1:]
+		return c, nil
+	}
+
+	for w.queue.Len() > 0 {
+		c := heap.Pop(w.queue).(*Commit)
+		if !w.options.Since.IsZero() && c.CommitterTime().Before(w.options.Since) {
+			return nil, nil // Older commits are assumed to be older still
+		}
+		w.checkSkew(c)
+		for _, parent := range w.parents(c) {
+			if err := w.enqueue(parent); err != nil {
+				return nil, err
+			}
+		}
+		if ok, err := w.matchRepo(c); err != nil {
+			return nil, err
+		} else if ok {
+			return c, nil
+		}
+	}
+	return nil, nil
+}
+
+// enqueue loads hash for a newest first walk unless queued before or excluded
+func (w *CommitWalker) enqueue(hash string) error {
+	if w.seen[hash] || w.excluded[hash] {
+		return nil
+	}
+	w.seen[hash] = true
+	c, err := GetCommitRepo(w.repo, hash)
+	if err != nil {
+		return fmt.Errorf("failed to load commit %s: %w", hash, err)
+	}
+	heap.Push(w.queue, c)
+	return nil
+}
+
+// parents returns the parents of c the walk follows
+func (w *CommitWalker) parents(c *Commit) []string {
+	if w.options.FirstParent && len(c.Parents) > 1 {
+		return c.Parents[:1]
+	}
+	return c.Parents
+}
+
+// checkSkew reports the parents of c committed after it to OnSkew
+func (w *CommitWalker) checkSkew(c *Commit) {
+	if w.options.OnSkew == nil {
+		return
+	}
+	for _, hash := range w.parents(c) {
+		if parent, err := GetCommitRepo(w.repo, hash); err == nil && parent.CommitterTime().After(c.CommitterTime()) {
+			w.options.OnSkew(c, parent)
+		}
+	}
+}
+
+// sortRepo lists the commits of a Topo walk, filtered, with parents
+// rewritten when asked
+func (w *CommitWalker) sortRepo() error {
+	var all []*Commit
+	if w.options.FirstParent {
+		for _, start := range w.options.Include {
+			for hash := start; hash != "" && !w.excluded[hash]; {
+				c, err := GetCommitRepo(w.repo, hash)
+				if err != nil {
+					return fmt.Errorf("failed to load commit %s: %w", hash, err)
+				}
+				all = append(all, c)
+				hash = ""
+				if len(c.Parents) > 0 {
+					hash = c.Parents[0]
+				}
+			}
+		}
+	} else {
+		sorted, err := TopoSortRepo(w.repo, w.options.Include)
+		if err != nil {
+			return err
+		}
+		for _, c := range sorted {
+			if !w.excluded[c.CommitID] {
+				all = append(all, c)
+			}
+		}
+	}
+
+	byID := make(map[string]*Commit, len(all))
+	for _, c := range all {
+		byID[c.CommitID] = c
+	}
+	kept := make(map[string]bool)
+	for _, c := range all {
+		w.checkSkew(c)
+		if !w.options.Since.IsZero() && c.CommitterTime().Before(w.options.Since) {
+			continue
+		}
+		ok, err := w.matchRepo(c)
+		if err != nil {
+			return err
+		}
+		if ok {
+			kept[c.CommitID] = true
+			w.list = append(w.list, c)
+		}
+	}
+	if !w.options.RewriteParents || len(kept) == len(all) {
+		return nil
+	}
+
+	// Each parent is replaced by its nearest kept ancestors
+	nearest := make(map[string][]string)
+	var resolve func(hash string) []string
+	resolve = func(hash string) []string {
+		if kept[hash] {
+			return []string{hash}
+		}
+		if found, ok := nearest[hash]; ok {
+			return found
+		}
+		nearest[hash] = nil // Guards against cycles
+		var found []string
+		if c := byID[hash]; c != nil {
+			for _, parent := range w.parents(c) {
+				found = appendUnique(found, resolve(parent)...)
+			}
+		}
+		nearest[hash] = found
+		return found
+	}
+	for i, c := range w.list {
+		rewritten := *c
+		rewritten.Parents = nil
+		for _, parent := range w.parents(c) {
+			rewritten.Parents = appendUnique(rewritten.Parents, resolve(parent)...)
+		}
+		w.list[i] = &rewritten
+	}
+	return nil
+}
+
+// matchRepo reports whether c passes the date, author and path filters
+func (w *CommitWalker) matchRepo(c *Commit) (bool, error) {
+	if !w.options.Until.IsZero() && c.CommitterTime().After(w.options.Until) {
+		return false, nil
+	}
+	if w.author != nil && !w.author.MatchString(c.Author) {
+		return false, nil
+	}
+	if len(w.options.Paths) == 0 {
+		return true, nil
+	}
+	return w.touchesPathsRepo(c)
+}
+
+// touchesPathsRepo reports whether c changes a file under the walk's paths.
+// A merge only does when it differs from every parent there: whatever
+// matches one parent came from that side of the merge.
+func (w *CommitWalker) touchesPathsRepo(c *Commit) (bool, error) {
+	var parentTrees []string
+	for _, hash := range c.Parents {
+		parent, err := GetCommitRepo(w.repo, hash)
+		if err != nil {
+			return false, fmt.Errorf("failed to load commit %s: %w", hash, err)
+		}
+		parentTrees = append(parentTrees, parent.Tree)
+	}
+	if len(parentTrees) == 0 {
+		parentTrees = []string{""}
+	}
+
+	for _, parentTree := range parentTrees {
+		same := true
+		for _, p := range w.options.Paths {
+			ours, err := treePathHashRepo(w.repo, c.Tree, p)
+			if err != nil {
+				return false, err
+			}
+			theirs, err := treePathHashRepo(w.repo, parentTree, p)
+			if err != nil {
+				return false, err
+			}
+			if ours != theirs {
+				same = false
+				break
+			}
+		}
+		if same {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// treePathHashRepo returns the hash and mode of the tree or file at path in
+// treeID, "" when there is none; an empty path is the tree itself
+func treePathHashRepo(repo *core.Repository, treeID, path string) (string, error) {
+	if path == "" || treeID == "" {
+		return treeID, nil
+	}
+	entry, err := FindTreeEntryRepo(repo, treeID, path)
+	if err != nil || entry == nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %o", entry.Hash, entry.Mode), nil // Mode changes count too
+}
+
+// appendUnique appends the values not in list yet
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, have := range list {
+			if have == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -1,6 +1,7 @@
 package packfile
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/sha1"
 	"encoding/binary"
@@ -9,7 +10,6 @@ import (
 	"io"
 	"os"
 	"sort"
-	"compress/zlib"
 )
 
 // CreatePackfileFromObjects creates a binary packfile from a list of objects
@@ -54,132 +54,24 @@ func CreatePackfileFromObjects(objects []Object) ([]byte, error) {
 	return packfile, nil
 }
 
-// CreateModernPackfile creates a modern packfile with deltas and compression
+// CreateModernPackfile writes objects as a packfile to outputPath, with its
+// index next to it. Objects are written whole; use WritePackFile to have
+// deltas made, or to stream objects instead of holding them all.
 func CreateModernPackfile(objects []Object, outputPath string) error {
-	file, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create packfile: %w", err)
-	}
-	defer file.Close()
-
-	// Track object offsets for the index
-	offsets := make(map[string]uint64)
-	
-	// Write header (signature, version, number of objects)
-	header := PackFileHeader{
-		Signature:  [4]byte{'P', 'A', 'C', 'K'},
-		Version:    2,
-		NumObjects: uint32(len(objects)),
-	}
-	
-	// Write header
-	if err := binary.Write(file, binary.BigEndian, &header); err != nil {
-		return fmt.Errorf("failed to write packfile header: %w", err)
-	}
-
-	// Write each object and record its offset
-	for _, obj := range objects {
-		// Get current position for object offset
-		pos, err := file.Seek(0, os.SEEK_CUR)
-		if err != nil {
-			return fmt.Errorf("failed to get file position: %w", err)
-		}
-		
-		// Record the offset for this object
-		offsets[obj.Hash] = uint64(pos)
-		
-		// Determine the correct object type for the header
-		headerType := obj.Type
-		var baseHash string
-		
-		// Special handling for delta objects
-		if obj.Type == OBJ_DELTA {
-			// For delta objects, the header uses OBJ_REF_DELTA type
-			headerType = OBJ_REF_DELTA
-			
-			// Extract base hash from delta object if available
-			if len(obj.Data) >= 20 { // Delta should have base hash at beginning
-				baseHash = fmt.Sprintf("%x", obj.Data[:20])
-				// The actual delta instructions follow the base hash
-				obj.Data = obj.Data[20:]
-			} else {
-				// This is an invalid delta, but we'll try to proceed
-				fmt.Printf("Warning: Invalid delta object %s, missing base hash\n", obj.Hash)
-			}
-		}
-		
-		// Write object header (type and size)
-		if err := writeObjectHeader(file, headerType, uint64(len(obj.Data))); err != nil {
-			return fmt.Errorf("failed to write object header: %w", err)
-		}
-		
-		// For delta objects, write the base object hash reference
-		if headerType == OBJ_REF_DELTA {
-			baseHashBytes, err := hex.DecodeString(baseHash)
-			if err != nil || len(baseHashBytes) != 20 {
-				return fmt.Errorf("invalid base hash for delta object: %s", baseHash)
-			}
-			
-			if _, err := file.Write(baseHashBytes); err != nil {
-				return fmt.Errorf("failed to write base hash: %w", err)
-			}
-		}
-
-		// Compress and write object data
-		compressedWriter := zlib.NewWriter(file)
-		if _, err := compressedWriter.Write(obj.Data); err != nil {
-			compressedWriter.Close()
-			return fmt.Errorf("failed to write compressed data: %w", err)
-		}
-		if err := compressedWriter.Close(); err != nil {
-			return fmt.Errorf("failed to close compressed writer: %w", err)
+	i := 0
+	next := func() (*Object, error) {
+		if i == len(objects) {
+			return nil, io.EOF
 		}
+		i++
+		return &objects[i-1], nil
 	}
-
-	// Calculate and write packfile checksum
-	endPos, err := file.Seek(0, os.SEEK_CUR)
-	if err != nil {
-		return fmt.Errorf("failed to get current file position: %w", err)
-	}
-
-	// Move back to the beginning of the file to calculate checksum
-	if _, err := file.Seek(0, os.SEEK_SET); err != nil {
-		return fmt.Errorf("failed to seek to beginning of file: %w", err)
-	}
-
-	// Read the entire file content for checksum calculation
-	content := make([]byte, endPos)
-	if _, err := io.ReadFull(file, content); err != nil {
-		return fmt.Errorf("failed to read file content for checksum: %w", err)
-	}
-
-	// Calculate SHA-1 checksum
-	h := sha1.New()
-	h.Write(content)
-	checksum := h.Sum(nil)
-
-	// Move back to the end to write checksum
-	if _, err := file.Seek(endPos, os.SEEK_SET); err != nil {
-		return fmt.Errorf("failed to seek to end of file: %w", err)
-	}
-
-	// Write the SHA-1 checksum (20 bytes)
-	if _, err := file.Write(checksum); err != nil {
-		return fmt.Errorf("failed to write packfile checksum: %w", err)
-	}
-
-	// Create index file
-	indexPath := outputPath + ".idx"
-	if err := createPackIndex(indexPath, offsets, objects); err != nil {
-		return fmt.Errorf("failed to create index file: %w", err)
-	}
-
-	return nil
+	return WritePackFile(outputPath, uint32(len(objects)), next, PackOptions{})
 }
 
 // writeObjectHeader writes the packfile object header in Git format
 // Uses a variable-length encoding for the size and includes type in the first byte
-func writeObjectHeader(file *os.File, objType ObjectType, size uint64) error {
+func writeObjectHeader(file io.Writer, objType ObjectType, size uint64) error {
 	// First byte: high 3 bits are type, low 4 bits are first chunk of size, bit 7 is continuation bit
 	firstByte := byte((uint8(objType) << 4) & 0x70) // Type in bits 4-6
 	
@@ -218,159 +110,79 @@ func writeObjectHeader(file *os.File, objType ObjectType, size uint64) error {
 	return nil
 }
 
-// createPackIndex creates a Git-compatible index file for a packfile
-// Following the v2 index format specification
-func createPackIndex(indexPath string, offsets map[string]uint64, objects []Object) error {
+// createPackIndex writes index as a v2 index file, with the CRCs and large
+// offsets PackWriter records, and the checksum of the index at the end
+func createPackIndex(indexPath string, index *PackfileIndex) error {
 	file, err := os.Create(indexPath)
 	if err != nil {
 		return fmt.Errorf("failed to create index file: %w", err)
 	}
 	defer file.Close()
 
-	// Convert objects to sorted entries for the index
 	type indexEntry struct {
-		hash      []byte    // Binary hash
-		offset    uint64    // Offset in pack file
-		objType   ObjectType // Object type
-		crc32     uint32    // CRC32 checksum (optional)
-	}
-	
-	entries := make([]indexEntry, 0, len(objects))
-	for _, obj := range objects {
-		offset, ok := offsets[obj.Hash]
-		if !ok {
-			continue // Skip objects not in packfile
+		hash  []byte
+		entry PackIndexEntry
+	}
+	entries := make([]indexEntry, 0, len(index.Entries))
+	for id, entry := range index.Entries {
+		hashBytes, err := hex.DecodeString(id)
+		if err != nil || (len(hashBytes) != 20 && len(hashBytes) != 32) {
+			return fmt.Errorf("invalid hash %s", id)
 		}
-		
-		// Convert hex hash to binary
-		hashBytes, err := hex.DecodeString(obj.Hash)
-		if err != nil || len(hashBytes) != 20 {
-			return fmt.Errorf("invalid hash %s: %w", obj.Hash, err)
-		}
-		
-		entries = append(entries, indexEntry{
-			hash:     hashBytes,
-			offset:   offset,
-			objType:  obj.Type,
-			crc32:    0, // We're not tracking CRC32 for now
-		})
+		entries = append(entries, indexEntry{hash: hashBytes, entry: entry})
 	}
-	
-	// Sort entries by hash
 	sort.Slice(entries, func(i, j int) bool {
 		return bytes.Compare(entries[i].hash, entries[j].hash) < 0
 	})
 
-	// Write index header: signature + version
-	header := [8]byte{'\377', 't', 'O', 'c', 0, 0, 0, 2} // "\377tOc" + version 2
-	if _, err := file.Write(header[:]); err != nil {
-		return fmt.Errorf("failed to write index header: %w", err)
-	}
+	sum := sha1.New()
+	w := bufio.NewWriter(io.MultiWriter(file, sum))
 
-	// Build fanout table (256 entries)
-	fanout := make([]uint32, 256)
-	
-	// Count objects with each first byte
-	for _, entry := range entries {
-		firstByte := entry.hash[0]
-		fanout[firstByte]++
+	// Header: "\377tOc" and version 2
+	w.Write([]byte{'\377', 't', 'O', 'c', 0, 0, 0, 2})
+
+	// Fanout table: objects whose first byte is at most i
+	var fanout [256]uint32
+	for _, e := range entries {
+		fanout[e.hash[0]]++
 	}
-	
-	// Convert to cumulative counts
 	for i := 1; i < 256; i++ {
 		fanout[i] += fanout[i-1]
 	}
-	
-	// Write fanout table (256 uint32 values)
-	for _, count := range fanout {
-		if err := binary.Write(file, binary.BigEndian, count); err != nil {
-			return fmt.Errorf("failed to write fanout table: %w", err)
-		}
-	}
-	
-	// Write object names (sorted by hash)
-	for _, entry := range entries {
-		if _, err := file.Write(entry.hash); err != nil {
-			return fmt.Errorf("failed to write object hash: %w", err)
-		}
+	binary.Write(w, binary.BigEndian, fanout)
+
+	for _, e := range entries {
+		w.Write(e.hash)
 	}
-	
-	// Write CRC32 values (4 bytes per object)
-	for _, entry := range entries {
-		if err := binary.Write(file, binary.BigEndian, entry.crc32); err != nil {
-			return fmt.Errorf("failed to write CRC32: %w", err)
-		}
+	for _, e := range entries {
+		binary.Write(w, binary.BigEndian, e.entry.CRC32)
 	}
-	
-	// Write offsets (4 or 8 bytes per object)
-	largeOffsets := make([]uint64, 0)
-	
-	for _, entry := range entries {
-		if entry.offset < (1 << 31) {
-			// Regular offset (31 bits)
-			if err := binary.Write(file, binary.BigEndian, uint32(entry.offset)); err != nil {
-				return fmt.Errorf("failed to write offset: %w", err)
-			}
-		} else {
-			// Large offset - mark with MSB set and index into large offset table
-			largeOffsetIndex := uint32(len(largeOffsets) | (1 << 31))
-			if err := binary.Write(file, binary.BigEndian, largeOffsetIndex); err != nil {
-				return fmt.Errorf("failed to write large offset index: %w", err)
-			}
-			largeOffsets = append(largeOffsets, entry.offset)
+
+	// Offsets past 2 GiB go to the large offset table, marked with the MSB
+	var largeOffsets []uint64
+	for _, e := range entries {
+		if e.entry.Offset < 1<<31 {
+			binary.Write(w, binary.BigEndian, uint32(e.entry.Offset))
+			continue
 		}
+		binary.Write(w, binary.BigEndian, uint32(len(largeOffsets))|1<<31)
+		largeOffsets = append(largeOffsets, e.entry.Offset)
 	}
-	
-	// Write large offsets table if needed
 	for _, offset := range largeOffsets {
-		if err := binary.Write(file, binary.BigEndian, offset); err != nil {
-			return fmt.Errorf("failed to write large offset: %w", err)
-		}
-	}
-	
-	// Calculate and write packfile checksum (copy from the packfile)
-	packfilePath := indexPath[:len(indexPath)-4] // Remove .idx
-	packfileChecksum, err := getPackfileChecksum(packfilePath)
-	if err != nil {
-		return fmt.Errorf("failed to get packfile checksum: %w", err)
-	}
-	
-	if _, err := file.Write(packfileChecksum); err != nil {
-		return fmt.Errorf("failed to write packfile checksum: %w", err)
-	}
-	
-	// Calculate and write index checksum
-	currentPos, err := file.Seek(0, os.SEEK_CUR)
-	if err != nil {
-		return fmt.Errorf("failed to get file position: %w", err)
-	}
-	
-	// Go back to start to calculate the checksum of the index
-	if _, err := file.Seek(0, os.SEEK_SET); err != nil {
-		return fmt.Errorf("failed to seek to file start: %w", err)
-	}
-	
-	content := make([]byte, currentPos)
-	if _, err := file.Read(content); err != nil {
-		return fmt.Errorf("failed to read file content: %w", err)
+		binary.Write(w, binary.BigEndian, offset)
 	}
-	
-	// Calculate checksum
-	h := sha1.New()
-	h.Write(content)
-	indexChecksum := h.Sum(nil)
-	
-	// Move back to end to write checksum
-	if _, err := file.Seek(currentPos, os.SEEK_SET); err != nil {
-		return fmt.Errorf("failed to seek to file end: %w", err)
+
+	packChecksum := make([]byte, 20)
+	copy(packChecksum, index.Checksum)
+	w.Write(packChecksum)
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write index file: %w", err)
 	}
-	
-	// Write index checksum
-	if _, err := file.Write(indexChecksum); err != nil {
+
+	if _, err := file.Write(sum.Sum(nil)); err != nil {
 		return fmt.Errorf("failed to write index checksum: %w", err)
 	}
-	
-	return nil
+	return file.Close()
 }
 
 // getPackfileChecksum reads the SHA-1 checksum from the end of a packfile
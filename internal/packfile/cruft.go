@@ -0,0 +1,136 @@
+package packfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A cruft pack holds unreachable objects gc keeps until they expire. Each
+// object is stored as its loose file, byte for byte, together with the
+// modification time it had when it was still loose, so a later gc can both
+// expire it and put it back unchanged once something refers to it again.
+//
+// Layout: the magic, a big-endian uint32 object count, then per object a
+// uint8 hash length, the hex hash, an int64 Unix mtime and a uint64 size, the
+// object data in the same order, and a SHA-256 trailer over everything
+// before it.
+const (
+	CruftPackPrefix = "cruft-"
+	CruftPackSuffix = ".cruft"
+	cruftPackMagic  = "VECCRUFT1\n"
+)
+
+// ErrCorruptCruftPack is returned for a cruft pack that fails to parse or
+// whose trailer doesn't match its contents
+var ErrCorruptCruftPack = errors.New("corrupt cruft pack")
+
+// CruftObject is an unreachable object in a cruft pack
+type CruftObject struct {
+	Hash  string
+	Mtime time.Time // When the object was last written or found unreachable
+	Data  []byte    // The loose object file
+}
+
+// CruftPackPaths returns the cruft packs in packDir
+func CruftPackPaths(packDir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(packDir, CruftPackPrefix+"*"+CruftPackSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cruft packs: %w", err)
+	}
+	return paths, nil
+}
+
+// WriteCruftPack writes objects to a new cruft pack in packDir named after
+// now and returns its path. The pack appears only once fully written.
+func WriteCruftPack(packDir string, objects []CruftObject, now time.Time) (string, error) {
+	var buf bytes.Buffer
+	buf.WriteString(cruftPackMagic)
+	binary.Write(&buf, binary.BigEndian, uint32(len(objects)))
+	for _, obj := range objects {
+		if len(obj.Hash) == 0 || len(obj.Hash) > 255 {
+			return "", fmt.Errorf("invalid object hash '%s'", obj.Hash)
+		}
+		buf.WriteByte(byte(len(obj.Hash)))
+		buf.WriteString(obj.Hash)
+		binary.Write(&buf, binary.BigEndian, obj.Mtime.Unix())
+		binary.Write(&buf, binary.BigEndian, uint64(len(obj.Data)))
+	}
+	for _, obj := range objects {
+		buf.Write(obj.Data)
+	}
+	trailer := sha256.Sum256(buf.Bytes())
+	buf.Write(trailer[:])
+
+	if err := os.MkdirAll(packDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create pack directory: %w", err)
+	}
+	path := filepath.Join(packDir, fmt.Sprintf("%s%d-%x%s", CruftPackPrefix, now.Unix(), trailer[:4], CruftPackSuffix))
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, buf.Bytes(), 0444); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to write cruft pack: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to write cruft pack: %w", err)
+	}
+	return path, nil
+}
+
+// ReadCruftPack returns the objects of the cruft pack at path
+func ReadCruftPack(path string) ([]CruftObject, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cruft pack: %w", err)
+	}
+	if len(content) < len(cruftPackMagic)+4+sha256.Size || !bytes.HasPrefix(content, []byte(cruftPackMagic)) {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), ErrCorruptCruftPack)
+	}
+	body := content[:len(content)-sha256.Size]
+	if trailer := sha256.Sum256(body); !bytes.Equal(trailer[:], content[len(body):]) {
+		return nil, fmt.Errorf("%s: %w: checksum mismatch", filepath.Base(path), ErrCorruptCruftPack)
+	}
+
+	r := bytes.NewReader(body[len(cruftPackMagic):])
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), ErrCorruptCruftPack)
+	}
+	objects := make([]CruftObject, 0, count)
+	sizes := make([]uint64, 0, count)
+	for i := uint32(0); i < count; i++ {
+		hashLen, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), ErrCorruptCruftPack)
+		}
+		hash := make([]byte, hashLen)
+		var mtime int64
+		var size uint64
+		if _, err := io.ReadFull(r, hash); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), ErrCorruptCruftPack)
+		}
+		if binary.Read(r, binary.BigEndian, &mtime) != nil || binary.Read(r, binary.BigEndian, &size) != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), ErrCorruptCruftPack)
+		}
+		objects = append(objects, CruftObject{Hash: string(hash), Mtime: time.Unix(mtime, 0)})
+		sizes = append(sizes, size)
+	}
+	for i := range objects {
+		if sizes[i] > uint64(r.Len()) {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), ErrCorruptCruftPack)
+		}
+		objects[i].Data = make([]byte, sizes[i])
+		io.ReadFull(r, objects[i].Data)
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%s: %w: trailing data", filepath.Base(path), ErrCorruptCruftPack)
+	}
+	return objects, nil
+}
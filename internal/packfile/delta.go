@@ -198,12 +198,7 @@ func createDelta(base, target []byte) ([]byte, error) {
 		return buffer.Bytes(), nil
 	}
 
-	// Create indices for efficient substring matching
-	matchCache := buildMatchCache(base, target)
-	
-	// Compute delta operations using match cache
-	err := computeDeltaWithCache(&buffer, base, target, matchCache)
-	if err != nil {
+	if err := computeDelta(&buffer, base, target); err != nil {
 		return nil, err
 	}
 
@@ -223,171 +218,76 @@ func encodeSize(buffer *bytes.Buffer, size uint64) {
 	}
 }
 
-// computeDelta computes the delta operations between base and target
-// using a sliding window approach for optimal instruction selection
-func computeDelta(buffer *bytes.Buffer, base, target []byte) error {
-	// Early return if target is empty
-	if len(target) == 0 {
-		return nil
-	}
+// Block matching used by computeDelta
+const (
+	deltaBlockSize     = 16       // Length of the base blocks indexed to find copies
+	maxBlockCandidates = 64       // Base offsets kept per block hash, so repetitive content stays linear
+	maxCopySize        = 0xFFFFFF // Longest copy one instruction encodes
+)
 
-	// Minimum match size worth encoding as a copy
-	const MIN_COPY_SIZE = 4
+// computeDelta computes the delta operations between base and target. Base
+// is indexed once in blocks of deltaBlockSize; target is walked a byte at a
+// time, and where a block of base starts, the longest copy found is taken.
+// Time and memory stay linear in the size of the objects.
+func computeDelta(buffer *bytes.Buffer, base, target []byte) error {
+	const maxInsertSize = 127 // Maximum size for a single insert instruction
 
-	// Maximum size for a single insert instruction
-	const MAX_INSERT_SIZE = 127
+	index := make(map[uint64][]int, len(base)/deltaBlockSize+1)
+	for i := 0; i+deltaBlockSize <= len(base); i += deltaBlockSize {
+		h := blockHash(base[i : i+deltaBlockSize])
+		if len(index[h]) < maxBlockCandidates {
+			index[h] = append(index[h], i)
+		}
+	}
 
-	// Current position in target
-	pos := 0
-	
-	// Buffer for collecting insert data
-	insertBuf := make([]byte, 0, MAX_INSERT_SIZE)
-	
-	// Flush any pending insert data
+	insertBuf := make([]byte, 0, maxInsertSize)
 	flushInsert := func() {
 		if len(insertBuf) > 0 {
 			encodeInsertCommand(buffer, insertBuf)
 			insertBuf = insertBuf[:0]
 		}
 	}
-	
-	// Process the target until we've consumed it all
+
+	pos := 0
 	for pos < len(target) {
-		// Look for matches at current position
-		matchOffset, matchLength := findLongestMatch(base, target[pos:])
-		
-		// If we found a match that's worth encoding as a copy
-		if matchLength >= MIN_COPY_SIZE {
-			// Flush any pending insert data
-			flushInsert()
-			
-			// Encode the copy instruction
-			encodeCopyCommand(buffer, matchOffset, matchLength)
-			
-			// Advance position
-			pos += int(matchLength)
-		} else {
-			// Add current byte to insert buffer
-			insertBuf = append(insertBuf, target[pos])
-			pos++
-			
-			// If insert buffer is full, flush it
-			if len(insertBuf) >= MAX_INSERT_SIZE {
-				flushInsert()
+		bestOffset, bestLength := 0, 0
+		if pos+deltaBlockSize <= len(target) {
+			for _, offset := range index[blockHash(target[pos:pos+deltaBlockSize])] {
+				length := 0
+				for offset+length < len(base) && pos+length < len(target) &&
+					length < maxCopySize && base[offset+length] == target[pos+length] {
+					length++
+				}
+				if length > bestLength {
+					bestOffset, bestLength = offset, length
+				}
 			}
 		}
-	}
-	
-	// Flush any remaining insert data
-	flushInsert()
-	
-	return nil
-}
 
-// findLongestMatch finds the longest matching substring in base for the start of target
-// using a rolling hash algorithm (Rabin-Karp) for efficient matching
-func findLongestMatch(base, target []byte) (offset, length uint32) {
-	if len(target) < 4 {
-		return 0, 0 // Need at least 4 bytes for meaningful matching
-	}
-
-	const (
-		prime        = 16777619 // FNV prime
-		windowSize   = 4        // Initial window size for hash comparison
-		maxMatchSize = 64 * 1024 // Max match size (64KB)
-	)
-
-	// Create a hash map for the base content
-	baseHashes := make(map[uint32][]uint32)
-	
-	// Helper function to compute hash of a small window
-	computeHash := func(data []byte, start, end int) uint32 {
-		h := uint32(2166136261) // FNV offset basis
-		for i := start; i < end && i < len(data); i++ {
-			h = (h ^ uint32(data[i])) * prime
+		if bestLength >= deltaBlockSize {
+			flushInsert()
+			encodeCopyCommand(buffer, uint32(bestOffset), uint32(bestLength))
+			pos += bestLength
+			continue
+		}
+		insertBuf = append(insertBuf, target[pos])
+		pos++
+		if len(insertBuf) >= maxInsertSize {
+			flushInsert()
 		}
-		return h
 	}
+	flushInsert()
 
-	// Compute hashes for all windowSize-byte segments in base
-	for i := 0; i <= len(base)-windowSize; i++ {
-		h := computeHash(base, i, i+windowSize)
-		baseHashes[h] = append(baseHashes[h], uint32(i))
-	}
+	return nil
+}
 
-	// Compute hash of the first windowSize bytes of target
-	targetHash := computeHash(target, 0, windowSize)
-	
-	// Track best match
-	bestLength := uint32(0)
-	bestOffset := uint32(0)
-	
-	// Check candidate matches using hash
-	if candidates, ok := baseHashes[targetHash]; ok {
-		for _, pos := range candidates {
-			// Verify and extend match
-			matchLen := uint32(0)
-			maxLen := uint32(min(len(base)-int(pos), len(target)))
-			if maxLen > maxMatchSize {
-				maxLen = maxMatchSize
-			}
-			
-			for matchLen < maxLen && base[pos+matchLen] == target[matchLen] {
-				matchLen++
-			}
-			
-			if matchLen > bestLength {
-				bestLength = matchLen
-				bestOffset = pos
-			}
-		}
+// blockHash hashes a block of content with 64-bit FNV-1a
+func blockHash(block []byte) uint64 {
+	h := uint64(14695981039346656037)
+	for _, b := range block {
+		h = (h ^ uint64(b)) * 1099511628211
 	}
-	
-	// If we didn't find a good match with the initial window, try with longer windows
-	if bestLength < 12 && len(target) >= 8 {
-		// Try with 8-byte window for larger matches
-		largeWindowSize := 8
-		
-		largeBaseHashes := make(map[uint64][]uint32)
-		
-		// Compute 64-bit hashes for larger segments
-		computeLargeHash := func(data []byte, start, end int) uint64 {
-			h := uint64(14695981039346656037) // FNV-1a 64-bit offset
-			for i := start; i < end && i < len(data); i++ {
-				h = (h ^ uint64(data[i])) * 1099511628211 // FNV-1a 64-bit prime
-			}
-			return h
-		}
-		
-		// Compute hashes for largeWindowSize-byte segments
-		for i := 0; i <= len(base)-largeWindowSize; i++ {
-			h := computeLargeHash(base, i, i+largeWindowSize)
-			largeBaseHashes[h] = append(largeBaseHashes[h], uint32(i))
-		}
-		
-		targetLargeHash := computeLargeHash(target, 0, largeWindowSize)
-		
-		if candidates, ok := largeBaseHashes[targetLargeHash]; ok {
-			for _, pos := range candidates {
-				matchLen := uint32(0)
-				maxLen := uint32(min(len(base)-int(pos), len(target)))
-				if maxLen > maxMatchSize {
-					maxLen = maxMatchSize
-				}
-				
-				for matchLen < maxLen && base[pos+matchLen] == target[matchLen] {
-					matchLen++
-				}
-				
-				if matchLen > bestLength {
-					bestLength = matchLen
-					bestOffset = pos
-				}
-			}
-		}
-	}
-
-	return bestOffset, bestLength
+	return h
 }
 
 // encodeCopyCommand encodes a copy command in the delta format
@@ -1029,128 +929,3 @@ func max(a, b int) int {
 	}
 	return b
 }
-
-// buildMatchCache builds a cache of potential matches between base and target
-// for efficient delta computation
-func buildMatchCache(base, target []byte) map[int][]Match {
-	const (
-		minMatchSize = 4       // Minimum match size worth considering
-		hashWindow   = 4       // Size of window for initial hash matching
-	)
-
-	// Type to represent a match between base and target
-	type Match struct {
-		BaseOffset  int
-		MatchLength int
-	}
-	
-	// Create map from position in target to potential matches in base
-	matches := make(map[int][]Match)
-	
-	// Create hash table for quick lookup of base sequences
-	baseHashes := make(map[uint32][]int)
-	
-	// Helper function to compute hash of a small window
-	computeHash := func(data []byte, start int) uint32 {
-		h := uint32(2166136261) // FNV offset basis
-		for i := 0; i < hashWindow && start+i < len(data); i++ {
-			h = (h ^ uint32(data[start+i])) * 16777619 // FNV prime
-		}
-		return h
-	}
-	
-	// Build hash table for base content
-	for i := 0; i <= len(base)-hashWindow; i++ {
-		h := computeHash(base, i)
-		baseHashes[h] = append(baseHashes[h], i)
-	}
-	
-	// Find potential matches for each position in target
-	for i := 0; i <= len(target)-hashWindow; i++ {
-		h := computeHash(target, i)
-		
-		// Get base positions with matching hash
-		basePositions, ok := baseHashes[h]
-		if !ok {
-			continue
-		}
-		
-		// Check each potential match and extend it as far as possible
-		for _, basePos := range basePositions {
-			// Extend match forward
-			matchLen := 0
-			for basePos+matchLen < len(base) && 
-				i+matchLen < len(target) && 
-				base[basePos+matchLen] == target[i+matchLen] {
-				matchLen++
-			}
-			
-			// Only keep matches that are long enough
-			if matchLen >= minMatchSize {
-				matches[i] = append(matches[i], Match{
-					BaseOffset:  basePos, 
-					MatchLength: matchLen,
-				})
-			}
-		}
-	}
-	
-	return matches
-}
-
-// computeDeltaWithCache computes delta operations using pre-computed match cache
-func computeDeltaWithCache(buffer *bytes.Buffer, base, target []byte, matchCache map[int][]Match) error {
-	const maxInsertSize = 127 // Maximum size for a single insert instruction
-	
-	pos := 0
-	insertBuf := make([]byte, 0, maxInsertSize)
-	
-	// Flush any pending insert data
-	flushInsert := func() {
-		if len(insertBuf) > 0 {
-			encodeInsertCommand(buffer, insertBuf)
-			insertBuf = insertBuf[:0]
-		}
-	}
-	
-	for pos < len(target) {
-		// Find the best match at current position
-		var bestMatch *struct{ BaseOffset, Length int }
-		
-		if matches, ok := matchCache[pos]; ok && len(matches) > 0 {
-			// Find the longest match
-			longest := matches[0]
-			for _, m := range matches {
-				if m.MatchLength > longest.MatchLength {
-					longest = m
-				}
-			}
-			
-			bestMatch = &struct{ BaseOffset, Length int }{
-				BaseOffset: longest.BaseOffset,
-				Length:     longest.MatchLength,
-			}
-		}
-		
-		if bestMatch != nil && bestMatch.Length >= 4 {
-			// We found a good match - flush any pending insert and encode copy
-			flushInsert()
-			encodeCopyCommand(buffer, uint32(bestMatch.BaseOffset), uint32(bestMatch.Length))
-			pos += bestMatch.Length
-		} else {
-			// No good match - add byte to insert buffer
-			insertBuf = append(insertBuf, target[pos])
-			pos++
-			
-			// If insert buffer is full, flush it
-			if len(insertBuf) >= maxInsertSize {
-				flushInsert()
-			}
-		}
-	}
-	
-	// Flush any remaining insert data
-	flushInsert()
-	
-	return nil
-}
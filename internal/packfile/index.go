@@ -45,21 +45,29 @@ func ReadPackIndex(indexPath string) (*PackfileIndex, error) {
 
 	// Total number of objects is the last entry in the fanout table
 	numObjects := fanout[255]
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat index file: %w", err)
+	}
+	width, err := indexNameWidth(info.Size(), numObjects)
+	if err != nil {
+		return nil, err
+	}
 
 	// Read object entries
 	index := &PackfileIndex{
 		Entries: make(map[string]PackIndexEntry, numObjects),
 	}
 
-	// Skip past the SHA-1 table to the offset table
-	// SHA-1 table is numObjects entries of 20 bytes each
-	_, err = file.Seek(int64(numObjects*20), io.SeekCurrent)
+	// Skip past the name table to the offset table
+	// The name table is numObjects entries of width bytes each
+	_, err = file.Seek(int64(numObjects)*int64(width), io.SeekCurrent)
 	if err != nil {
 		return nil, fmt.Errorf("failed to seek to offset table: %w", err)
 	}
 
 	// Create a buffer for reading the SHA-1 values
-	sha1Buffer := make([]byte, 20)
+	sha1Buffer := make([]byte, width)
 
 	// Return to the beginning of the SHA-1 table
 	_, err = file.Seek(1032, io.SeekStart) // 8 (header) + 256*4 (fanout table)
@@ -81,8 +89,8 @@ func ReadPackIndex(indexPath string) (*PackfileIndex, error) {
 			return nil, fmt.Errorf("failed to get current position: %w", err)
 		}
 
-		// Seek to the offset table for this object
-		_, err = file.Seek(1032+int64(numObjects*20)+int64(i*4), io.SeekStart)
+		// Seek to the offset table for this object, past the CRC32 table
+		_, err = file.Seek(1032+int64(numObjects)*int64(width+4)+int64(i)*4, io.SeekStart)
 		if err != nil {
 			return nil, fmt.Errorf("failed to seek to offset: %w", err)
 		}
@@ -101,7 +109,7 @@ func ReadPackIndex(indexPath string) (*PackfileIndex, error) {
 			largeOffsetIndex := offset & 0x7FFFFFFF
 
 			// Seek to the large offset table
-			_, err = file.Seek(1032+int64(numObjects*20)+int64(numObjects*4)+int64(largeOffsetIndex*8), io.SeekStart)
+			_, err = file.Seek(1032+int64(numObjects)*int64(width+8)+int64(largeOffsetIndex)*8, io.SeekStart)
 			if err != nil {
 				return nil, fmt.Errorf("failed to seek to large offset: %w", err)
 			}
@@ -131,6 +139,21 @@ func ReadPackIndex(indexPath string) (*PackfileIndex, error) {
 	return index, nil
 }
 
+// indexNameWidth works out from the size of an index whether it names
+// objects by 32-byte object IDs or by 20-byte SHA-1 names. After the names
+// come a CRC and an offset for each object, up to one large offset each,
+// and two checksums, so only one width can fit.
+func indexNameWidth(size int64, numObjects uint32) (int, error) {
+	n := int64(numObjects)
+	for _, width := range []int64{32, 20} {
+		rest := size - 1032 - n*(width+8) - 40
+		if rest >= 0 && rest%8 == 0 && rest/8 <= n {
+			return int(width), nil
+		}
+	}
+	return 0, errors.New("invalid index file: size doesn't match its object count")
+}
+
 // WritePackIndex writes a packfile index to the given path
 func WritePackIndex(index *PackfileIndex, indexPath string) error {
 	file, err := os.Create(indexPath)
@@ -216,8 +239,9 @@ func WritePackIndex(index *PackfileIndex, indexPath string) error {
 		}
 	}
 
-	// Write pack checksum (all zeros for simplicity)
+	// Write pack checksum, all zeros when the index doesn't carry it
 	packChecksum := make([]byte, 20)
+	copy(packChecksum, index.Checksum)
 	if _, err := file.Write(packChecksum); err != nil {
 		return fmt.Errorf("failed to write pack checksum: %w", err)
 	}
@@ -0,0 +1,178 @@
+package packfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// Errors returned when a packfile exceeds the configured unpack limits.
+var (
+	ErrObjectTooLarge = errors.New("object exceeds maximum allowed size")
+	ErrPackTooLarge   = errors.New("packfile exceeds maximum allowed size")
+)
+
+// Default unpack limits. They are generous enough for real repositories while
+// keeping a hostile header from requesting an arbitrary allocation.
+const (
+	DefaultMaxObjectSize  int64 = 512 << 20 // receive.maxObjectSize
+	DefaultMaxPackSize    int64 = 4 << 30   // transfer.maxPackSize
+	DefaultSpillThreshold int64 = 32 << 20  // objects larger than this are kept on disk
+)
+
+// UnpackLimits bounds the resources a packfile may consume while it is parsed.
+// A zero value for any size disables that particular check.
+type UnpackLimits struct {
+	MaxObjectSize  int64  // Largest single inflated object
+	MaxPackSize    int64  // Largest packfile on the wire and total inflated bytes
+	SpillThreshold int64  // Inflated objects above this size are streamed to TempDir
+	TempDir        string // Directory for spilled objects (os.TempDir() when empty, .vec/tmp for a repository)
+}
+
+// DefaultUnpackLimits returns the limits used when no configuration is present.
+func DefaultUnpackLimits() UnpackLimits {
+	return UnpackLimits{
+		MaxObjectSize:  DefaultMaxObjectSize,
+		MaxPackSize:    DefaultMaxPackSize,
+		SpillThreshold: DefaultSpillThreshold,
+	}
+}
+
+// LoadUnpackLimitsRepo reads receive.maxObjectSize and transfer.maxPackSize from
+// the repository configuration, falling back to the defaults for unset keys.
+func LoadUnpackLimitsRepo(repo *core.Repository) (UnpackLimits, error) {
+	limits := DefaultUnpackLimits()
+
+	for key, dst := range map[string]*int64{
+		"receive.maxObjectSize": &limits.MaxObjectSize,
+		"transfer.maxPackSize":  &limits.MaxPackSize,
+	} {
+		value, err := repo.GetConfig(key)
+		if err != nil {
+			return limits, core.ConfigError(fmt.Sprintf("failed to read %s", key), err)
+		}
+		if value == "" {
+			continue
+		}
+		size, err := ParseSize(value)
+		if err != nil {
+			return limits, core.ConfigError(fmt.Sprintf("invalid value for %s", key), err)
+		}
+		*dst = size
+	}
+
+	// Spilled objects of a crashed unpack are swept with the other temp files
+	if err := core.EnsureDirExists(repo.TempDir()); err != nil {
+		return limits, err
+	}
+	limits.TempDir = repo.TempDir()
+
+	return limits, nil
+}
+
+// ParseSize parses a byte count with an optional k, m or g suffix (powers of 1024).
+func ParseSize(value string) (int64, error) {
+	value = strings.TrimSpace(strings.ToLower(value))
+	if value == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+
+	multiplier := int64(1)
+	switch value[len(value)-1] {
+	case 'k':
+		multiplier = 1 << 10
+	case 'm':
+		multiplier = 1 << 20
+	case 'g':
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size '%s'", value)
+	}
+	return n * multiplier, nil
+}
+
+// unpackBudget tracks inflated bytes across a single parse.
+type unpackBudget struct {
+	limits   UnpackLimits
+	inflated int64
+	spilled  []string
+}
+
+// checkDeclared rejects objects whose header size is over the per-object limit
+// before any memory is allocated for them.
+func (b *unpackBudget) checkDeclared(size uint64) error {
+	if b.limits.MaxObjectSize > 0 && size > uint64(b.limits.MaxObjectSize) {
+		return fmt.Errorf("%w: header declares %d bytes (limit %d)", ErrObjectTooLarge, size, b.limits.MaxObjectSize)
+	}
+	return nil
+}
+
+// consume charges n inflated bytes against the total limit.
+func (b *unpackBudget) consume(n int64) error {
+	b.inflated += n
+	if b.limits.MaxPackSize > 0 && b.inflated > b.limits.MaxPackSize {
+		return fmt.Errorf("%w: inflated content exceeds %d bytes", ErrPackTooLarge, b.limits.MaxPackSize)
+	}
+	return nil
+}
+
+// shouldSpill reports whether an object of the given size goes to disk.
+func (b *unpackBudget) shouldSpill(size uint64) bool {
+	return b.limits.SpillThreshold > 0 && size > uint64(b.limits.SpillThreshold)
+}
+
+// cleanup removes any spill files created during a failed parse.
+func (b *unpackBudget) cleanup() {
+	for _, path := range b.spilled {
+		os.Remove(path)
+	}
+	b.spilled = nil
+}
+
+// ObjectData returns the content of obj, reading it from disk if the object
+// was spilled during parsing.
+func ObjectData(obj *Object) ([]byte, error) {
+	if obj.SpillPath == "" {
+		return obj.Data, nil
+	}
+	data, err := os.ReadFile(obj.SpillPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spilled object: %w", err)
+	}
+	return data, nil
+}
+
+// OpenObjectData returns a reader over the content of obj without loading
+// spilled objects into memory.
+func OpenObjectData(obj *Object) (io.ReadCloser, error) {
+	if obj.SpillPath == "" {
+		return io.NopCloser(bytes.NewReader(obj.Data)), nil
+	}
+	f, err := os.Open(obj.SpillPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spilled object: %w", err)
+	}
+	return f, nil
+}
+
+// ReleaseObjects removes the spill files backing any of the given objects.
+func ReleaseObjects(objects []Object) {
+	for i := range objects {
+		if objects[i].SpillPath != "" {
+			os.Remove(objects[i].SpillPath)
+			objects[i].SpillPath = ""
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package packfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// The multi-pack-index is a chain of layer files in .vec/objects/pack, each
+// indexing the objects of packs the layers below it don't cover, so a fetch
+// only indexes the packs it brought in
+const (
+	midxChain = "multi-pack-index-chain"
+	midxMagic = "VMIX"
+)
+
+// MidxEntry locates an object in a pack
+type MidxEntry struct {
+	Pack   string // Pack file name, e.g. pack-<hash>.pack
+	Offset uint64
+}
+
+// midxLayer is one file of the multi-pack-index chain
+type midxLayer struct {
+	name    string
+	packs   []string // Pack file names, in the order entries refer to them
+	objects map[string]MidxEntry
+}
+
+// MultiPackIndex finds objects across all indexed packs with one lookup
+type MultiPackIndex struct {
+	layers []*midxLayer
+}
+
+// Find returns where the object hash is stored; the newest pack wins when
+// several hold it
+func (m *MultiPackIndex) Find(hash string) (MidxEntry, bool) {
+	for i := len(m.layers) - 1; i >= 0; i-- {
+		if e, ok := m.layers[i].objects[hash]; ok {
+			return e, true
+		}
+	}
+	return MidxEntry{}, false
+}
+
+// Packs returns the names of the indexed packs
+func (m *MultiPackIndex) Packs() []string {
+	var packs []string
+	for _, layer := range m.layers {
+		packs = append(packs, layer.packs...)
+	}
+	return packs
+}
+
+// Len returns the number of objects indexed
+func (m *MultiPackIndex) Len() int {
+	n := 0
+	for _, layer := range m.layers {
+		n += len(layer.objects)
+	}
+	return n
+}
+
+func midxDir(repo *core.Repository) string {
+	return filepath.Join(repo.ObjectsDir, "pack")
+}
+
+// LoadMultiPackIndexRepo reads the multi-pack-index chain; an empty index if
+// none was written
+func LoadMultiPackIndexRepo(repo *core.Repository) (*MultiPackIndex, error) {
+	return loadMultiPackIndex(midxDir(repo))
+}
+
+// loadMultiPackIndex reads the multi-pack-index chain of the pack directory
+// dir
+func loadMultiPackIndex(dir string) (*MultiPackIndex, error) {
+	names, err := core.ReadLayerChain(filepath.Join(dir, midxChain))
+	if err != nil {
+		return nil, err
+	}
+	midx := &MultiPackIndex{}
+	for _, name := range names {
+		data, err := core.ReadLayerFile(filepath.Join(dir, "multi-pack-index-"+name+".midx"))
+		if err != nil {
+			return nil, err
+		}
+		layer, err := decodeMidxLayer(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multi-pack-index layer %s: %w", name, err)
+		}
+		layer.name = name
+		midx.layers = append(midx.layers, layer)
+	}
+	return midx, nil
+}
+
+// encodeMidxLayer serializes a layer: magic, version, hash length, the
+// pack count and names, then the objects sorted by ID with the position of
+// their pack and their offset
+func encodeMidxLayer(layer *midxLayer) ([]byte, error) {
+	packIndex := make(map[string]uint32, len(layer.packs))
+	for i, pack := range layer.packs {
+		packIndex[pack] = uint32(i)
+	}
+	hashes := make([]string, 0, len(layer.objects))
+	for hash := range layer.objects {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	hashLen := 0
+	if len(hashes) > 0 {
+		hashLen = len(hashes[0]) / 2
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(midxMagic)
+	buf.WriteByte(1)
+	buf.WriteByte(byte(hashLen))
+	binary.Write(&buf, binary.BigEndian, uint32(len(layer.packs)))
+	for _, pack := range layer.packs {
+		binary.Write(&buf, binary.BigEndian, uint16(len(pack)))
+		buf.WriteString(pack)
+	}
+	binary.Write(&buf, binary.BigEndian, uint32(len(hashes)))
+	for _, hash := range hashes {
+		raw, err := hex.DecodeString(hash)
+		if err != nil || len(raw) != hashLen {
+			return nil, fmt.Errorf("invalid object ID '%s'", hash)
+		}
+		e := layer.objects[hash]
+		buf.Write(raw)
+		binary.Write(&buf, binary.BigEndian, packIndex[e.Pack])
+		binary.Write(&buf, binary.BigEndian, e.Offset)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeMidxLayer parses the body of a layer file
+func decodeMidxLayer(data []byte) (*midxLayer, error) {
+	r := bytes.NewReader(data)
+	header := make([]byte, 6)
+	if _, err := r.Read(header); err != nil || string(header[:4]) != midxMagic {
+		return nil, fmt.Errorf("bad signature")
+	}
+	if header[4] != 1 {
+		return nil, fmt.Errorf("unsupported version %d", header[4])
+	}
+	hashLen := int(header[5])
+
+	layer := &midxLayer{objects: make(map[string]MidxEntry)}
+	var packs uint32
+	if err := binary.Read(r, binary.BigEndian, &packs); err != nil {
+		return nil, fmt.Errorf("truncated header")
+	}
+	for i := uint32(0); i < packs; i++ {
+		var n uint16
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil || int(n) > r.Len() {
+			return nil, fmt.Errorf("truncated pack list")
+		}
+		name := make([]byte, n)
+		r.Read(name)
+		layer.packs = append(layer.packs, string(name))
+	}
+
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, fmt.Errorf("truncated header")
+	}
+	for i := uint32(0); i < count; i++ {
+		raw := make([]byte, hashLen)
+		var pack uint32
+		var offset uint64
+		if _, err := r.Read(raw); err != nil && hashLen > 0 {
+			return nil, fmt.Errorf("truncated entry %d", i)
+		}
+		if err := binary.Read(r, binary.BigEndian, &pack); err != nil || pack >= packs {
+			return nil, fmt.Errorf("invalid entry %d", i)
+		}
+		if err := binary.Read(r, binary.BigEndian, &offset); err != nil {
+			return nil, fmt.Errorf("truncated entry %d", i)
+		}
+		layer.objects[hex.EncodeToString(raw)] = MidxEntry{Pack: layer.packs[pack], Offset: offset}
+	}
+	return layer, nil
+}
+
+// WriteMultiPackIndexRepo indexes the packs no layer covers yet in a new
+// layer and returns how many packs it added. Layers listing a pack that was
+// since removed are dropped along with every layer above them, and their
+// remaining packs indexed again.
+func WriteMultiPackIndexRepo(repo *core.Repository) (int, error) {
+	dir := midxDir(repo)
+	midx, err := LoadMultiPackIndexRepo(repo)
+	if err != nil {
+		return 0, err
+	}
+	indexes, err := filepath.Glob(filepath.Join(dir, "*.idx"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list pack indexes: %w", err)
+	}
+	present := make(map[string]bool, len(indexes))
+	for _, indexPath := range indexes {
+		pack := strings.TrimSuffix(filepath.Base(indexPath), ".idx") + ".pack"
+		if core.FileExists(filepath.Join(dir, pack)) {
+			present[pack] = true
+		}
+	}
+
+	keep := 0
+	covered := make(map[string]bool)
+	for _, layer := range midx.layers {
+		valid := true
+		for _, pack := range layer.packs {
+			valid = valid && present[pack]
+		}
+		if !valid {
+			break
+		}
+		for _, pack := range layer.packs {
+			covered[pack] = true
+		}
+		keep++
+	}
+	dropped := len(midx.layers) - keep
+	midx.layers = midx.layers[:keep]
+
+	var added []string
+	for pack := range present {
+		if !covered[pack] {
+			added = append(added, pack)
+		}
+	}
+	sort.Strings(added)
+	if len(added) == 0 && dropped == 0 {
+		return 0, nil
+	}
+
+	if len(added) > 0 {
+		layer := &midxLayer{objects: make(map[string]MidxEntry)}
+		for _, pack := range added {
+			indexPath := filepath.Join(dir, strings.TrimSuffix(pack, ".pack")+".idx")
+			if err := VerifyPackIndex(indexPath, filepath.Join(dir, pack)); err != nil {
+				continue // Never index objects of a damaged pack
+			}
+			index, err := ReadPackIndex(indexPath)
+			if err != nil {
+				continue
+			}
+			layer.packs = append(layer.packs, pack)
+			for hash, entry := range index.Entries {
+				if _, ok := layer.objects[hash]; !ok {
+					layer.objects[hash] = MidxEntry{Pack: pack, Offset: entry.Offset}
+				}
+			}
+		}
+		if len(layer.packs) > 0 {
+			data, err := encodeMidxLayer(layer)
+			if err != nil {
+				return 0, err
+			}
+			if layer.name, err = repo.WriteLayerFile(dir, "multi-pack-index-", ".midx", data); err != nil {
+				return 0, err
+			}
+			midx.layers = append(midx.layers, layer)
+		}
+		added = layer.packs
+	}
+
+	names := make([]string, 0, len(midx.layers))
+	for _, layer := range midx.layers {
+		names = append(names, layer.name)
+	}
+	if err := repo.WriteLayerChain(filepath.Join(dir, midxChain), names); err != nil {
+		return 0, err
+	}
+	core.RemoveStaleLayerFiles(dir, "multi-pack-index-", ".midx", names)
+	return len(added), nil
+}
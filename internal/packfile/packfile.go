@@ -3,14 +3,18 @@
 package packfile
 
 import (
+	"bufio"
 	"bytes"
 	"compress/zlib"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/NahomAnteneh/vec/core"
 )
@@ -38,6 +42,62 @@ func CalculatePackfileChecksum(packfile []byte) []byte {
 	return h.Sum(nil)
 }
 
+// ErrPackChecksum is returned for a packfile whose trailer doesn't match its content
+var ErrPackChecksum = errors.New("packfile checksum mismatch")
+
+// VerifyPackChecksum checks the trailer of the packfile at path against its
+// content: either a SHA-256 or, as PackWriter writes, a SHA-1 of everything
+// before it. Truncated and corrupted downloads fail with ErrPackChecksum.
+func VerifyPackChecksum(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open packfile: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat packfile: %w", err)
+	}
+	// The 12-byte header comes before either trailer
+	size := info.Size()
+	if size < 12+sha1.Size {
+		return fmt.Errorf("%w: %d bytes is too short", ErrPackChecksum, size)
+	}
+
+	// Both digests are computed in one pass: the content before a SHA-256
+	// trailer is the content before a SHA-1 one minus its last 12 bytes
+	sum1 := sha1.New()
+	var sum256 []byte
+	body := io.NewSectionReader(file, 0, size-sha1.Size)
+	if size >= 12+sha256.Size {
+		h := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(sum1, h), io.LimitReader(body, size-sha256.Size)); err != nil {
+			return fmt.Errorf("failed to read packfile: %w", err)
+		}
+		sum256 = h.Sum(nil)
+	}
+	if _, err := io.Copy(sum1, body); err != nil {
+		return fmt.Errorf("failed to read packfile: %w", err)
+	}
+
+	trailer := make([]byte, sha256.Size)
+	if sum256 != nil {
+		if _, err := file.ReadAt(trailer, size-sha256.Size); err != nil {
+			return fmt.Errorf("failed to read packfile checksum: %w", err)
+		}
+		if bytes.Equal(sum256, trailer) {
+			return nil
+		}
+	}
+	if _, err := file.ReadAt(trailer[:sha1.Size], size-sha1.Size); err != nil {
+		return fmt.Errorf("failed to read packfile checksum: %w", err)
+	}
+	if bytes.Equal(sum1.Sum(nil), trailer[:sha1.Size]) {
+		return nil
+	}
+	return ErrPackChecksum
+}
+
 // FormatHash formats a binary hash as a hex string
 func FormatHash(hash []byte) string {
 	return hex.EncodeToString(hash)
@@ -74,30 +134,119 @@ func PrintPackfileStats(objects []Object) {
 // CreatePackfile creates a packfile from a list of object hashes in a repository
 // and returns the binary packfile data for remote operations
 func CreatePackfile(repoRoot string, objectHashes []string) ([]byte, error) {
-	// Create a temporary file to store the packfile
-	tempDir := os.TempDir()
-	tempFile, err := os.CreateTemp(tempDir, "vec-packfile-*.pack")
+	return CreatePackfileWithProgress(repoRoot, objectHashes, nil)
+}
+
+// CreatePackfileWithProgress is CreatePackfile reporting the compressing
+// phase to progress, whose total is known before any object is loaded
+func CreatePackfileWithProgress(repoRoot string, objectHashes []string, progress ProgressFunc) ([]byte, error) {
+	pack, err := CreateTempPack(repoRoot, objectHashes, progress)
+	if err != nil {
+		return nil, err
+	}
+	defer pack.Remove()
+
+	// Read the packfile contents
+	packfileData, err := os.ReadFile(pack.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read packfile: %w", err)
+	}
+
+	return packfileData, nil
+}
+
+// TempPack is a packfile built in .vec/tmp, so it can be sent without being
+// held in memory
+type TempPack struct {
+	Path string
+	Size int64
+}
+
+// CreateTempPack builds a packfile of objectHashes in .vec/tmp, reporting the
+// compressing phase to progress. Callers remove it with Remove.
+func CreateTempPack(repoRoot string, objectHashes []string, progress ProgressFunc) (*TempPack, error) {
+	tempFile, err := core.CreateTempFile(repoRoot, "vec-packfile", ".pack")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temporary packfile: %w", err)
 	}
 	tempFilePath := tempFile.Name()
-	tempFile.Close() // Close immediately as we'll reopen it later
-
-	// Clean up the temporary file when done
-	defer os.Remove(tempFilePath)
+	tempFile.Close() // Close immediately as CreateModernPackfile reopens it
 
-	// Create the packfile using the repository objects
-	if err := CreatePackfileFromHashes(repoRoot, objectHashes, tempFilePath, true); err != nil {
+	if err := createPackfileFromHashesRepo(core.NewRepository(repoRoot), objectHashes, tempFilePath, true, progress); err != nil {
+		core.RemoveTempFile(tempFilePath)
 		return nil, fmt.Errorf("failed to create packfile: %w", err)
 	}
+	info, err := os.Stat(tempFilePath)
+	if err != nil {
+		core.RemoveTempFile(tempFilePath)
+		return nil, fmt.Errorf("failed to stat packfile: %w", err)
+	}
+	return &TempPack{Path: tempFilePath, Size: info.Size()}, nil
+}
 
-	// Read the packfile contents
-	packfileData, err := os.ReadFile(tempFilePath)
+// Send copies the pack to w, reporting PhaseWriting in bytes to progress
+func (p *TempPack) Send(w io.Writer, progress ProgressFunc) (int64, error) {
+	file, err := os.Open(p.Path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read packfile: %w", err)
+		return 0, fmt.Errorf("failed to open packfile: %w", err)
 	}
+	defer file.Close()
 
-	return packfileData, nil
+	var written int64
+	buf := make([]byte, 64<<10)
+	progress.report(PhaseWriting, 0, int(p.Size))
+	for {
+		n, err := file.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return written, werr
+			}
+			written += int64(n)
+			progress.report(PhaseWriting, int(written), int(p.Size))
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, fmt.Errorf("failed to read packfile: %w", err)
+		}
+	}
+}
+
+// Remove deletes the pack and the index written next to it
+func (p *TempPack) Remove() error {
+	core.RemoveTempFile(p.Path + ".idx")
+	return core.RemoveTempFile(p.Path)
+}
+
+// ReadObjectHeaderRepo returns the type and inflated size of a loose object
+// as the packer reads it, without inflating its content
+func ReadObjectHeaderRepo(repo *core.Repository, hash string) (string, int64, error) {
+	if len(hash) < 3 {
+		return "", 0, fmt.Errorf("invalid object hash '%s'", hash)
+	}
+	file, err := core.OpenObjectFile(repo.Root, filepath.Join(repo.VecDir, "objects", hash[:2], hash[2:]))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open object %s: %w", hash, err)
+	}
+	defer file.Close()
+
+	zr, err := zlib.NewReader(file)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to decompress object %s: %w", hash, err)
+	}
+	defer zr.Close()
+
+	header, err := bufio.NewReader(zr).ReadString(0)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid object format for %s: missing header", hash)
+	}
+	var objType string
+	var size int64
+	if _, err := fmt.Sscanf(header[:len(header)-1], "%s %d", &objType, &size); err != nil {
+		return "", 0, fmt.Errorf("invalid object header for %s: %w", hash, err)
+	}
+	return objType, size, nil
 }
 
 // CreatePackfileFromHashes creates a packfile from a list of object hashes in a repository (legacy function).
@@ -110,83 +259,72 @@ func CreatePackfileFromHashes(repoPath string, objectHashes []string, outputPath
 // CreatePackfileFromHashesRepo creates a packfile from a list of object hashes in a repository using Repository context.
 // This function is used by the maintenance code.
 func CreatePackfileFromHashesRepo(repo *core.Repository, objectHashes []string, outputPath string, withDeltaCompression bool) error {
-	// Load objects from the repository
-	objects := make([]Object, 0, len(objectHashes))
-	for _, hash := range objectHashes {
-		// Get object file path
-		prefix := hash[:2]
-		suffix := hash[2:]
-		objectPath := filepath.Join(repo.VecDir, "objects", prefix, suffix)
-
-		// Read the compressed object data
-		compressedData, err := os.ReadFile(objectPath)
-		if err != nil {
-			// Skip objects that can't be read
-			fmt.Printf("Warning: Couldn't read object %s: %v\n", hash, err)
-			continue
-		}
-
-		// Create a reader for decompression
-		zr, err := zlib.NewReader(bytes.NewReader(compressedData))
-		if err != nil {
-			fmt.Printf("Warning: Couldn't decompress object %s: %v\n", hash, err)
-			continue
-		}
+	return createPackfileFromHashesRepo(repo, objectHashes, outputPath, withDeltaCompression, nil)
+}
 
-		// Read the decompressed content
-		var buf bytes.Buffer
-		if _, err := io.Copy(&buf, zr); err != nil {
-			zr.Close()
-			fmt.Printf("Warning: Error reading decompressed data for %s: %v\n", hash, err)
+// createPackfileFromHashesRepo streams objectHashes into a pack at
+// outputPath: objects are read one at a time as they are written, so only
+// the delta window is held in memory, not the whole pack
+func createPackfileFromHashesRepo(repo *core.Repository, objectHashes []string, outputPath string, withDeltaCompression bool, progress ProgressFunc) error {
+	// The header announces the object count before any object is written,
+	// so objects that can't be found are left out first
+	present := make([]string, 0, len(objectHashes))
+	seen := make(map[string]bool, len(objectHashes))
+	for _, hash := range objectHashes {
+		if seen[hash] {
 			continue
 		}
-		zr.Close()
-
-		// Parse the header to get the object type
-		content := buf.Bytes()
-		nullIndex := bytes.IndexByte(content, 0)
-		if nullIndex == -1 {
-			fmt.Printf("Warning: Invalid object format for %s\n", hash)
+		seen[hash] = true
+		if !HasObjectRepo(repo, hash) {
+			fmt.Printf("Warning: Couldn't read object %s: not found\n", hash)
 			continue
 		}
+		present = append(present, hash)
+	}
 
-		header := string(content[:nullIndex])
-		parts := bytes.SplitN(content[:nullIndex], []byte(" "), 2)
-		if len(parts) != 2 {
-			fmt.Printf("Warning: Invalid object header format for %s\n", hash)
-			continue
+	i := 0
+	next := func() (*Object, error) {
+		if i == len(present) {
+			return nil, io.EOF
 		}
-
-		// Determine object type
-		objType := OBJ_BLOB // Default to blob
-		switch string(parts[0]) {
-		case "commit":
-			objType = OBJ_COMMIT
-		case "tree":
-			objType = OBJ_TREE
-		case "blob":
-			objType = OBJ_BLOB
-		default:
-			fmt.Printf("Warning: Unknown object type '%s' for %s\n", string(parts[0]), hash)
+		// The last step is reported once the pack is written
+		progress.report(PhaseCompressing, i, len(present))
+		hash := present[i]
+		i++
+		content, err := ReadObjectRepo(repo, hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read object %s: %w", hash, err)
 		}
-
-		// Add the object to our collection
-		objects = append(objects, Object{
-			Hash: hash,
-			Type: objType, 
-			Data: content[nullIndex+1:],
-		})
+		return objectFromContent(hash, content)
 	}
-
-	// Apply delta compression if requested
-	if withDeltaCompression && len(objects) > 1 {
+	opts := PackOptions{}
+	if withDeltaCompression {
 		var err error
-		objects, err = OptimizeObjects(objects)
-		if err != nil {
-			return fmt.Errorf("failed to optimize objects: %w", err)
+		if opts, err = LoadPackOptionsRepo(repo); err != nil {
+			return err
 		}
 	}
+	if err := WritePackFile(outputPath, uint32(len(present)), next, opts); err != nil {
+		return err
+	}
+	progress.report(PhaseCompressing, len(present), len(present))
+	return nil
+}
 
-	// Create the packfile
-	return CreateModernPackfile(objects, outputPath)
+// objectFromContent makes a pack object of an object as ReadObjectRepo
+// returns it
+func objectFromContent(hash string, content []byte) (*Object, error) {
+	nullIndex := bytes.IndexByte(content, 0)
+	if nullIndex == -1 {
+		return nil, fmt.Errorf("invalid object format for %s", hash)
+	}
+	objType, _, ok := strings.Cut(string(content[:nullIndex]), " ")
+	if !ok {
+		return nil, fmt.Errorf("invalid object header format for %s", hash)
+	}
+	packType := stringToType(objType)
+	if packType == OBJ_NONE || packType == OBJ_DELTA {
+		return nil, fmt.Errorf("unknown object type '%s' for %s", objType, hash)
+	}
+	return &Object{Hash: hash, Type: packType, Data: content[nullIndex+1:]}, nil
 }
@@ -1,6 +1,8 @@
 package packfile
 
 import (
+	"bufio"
+	"bytes"
 	"compress/zlib"
 	"encoding/binary"
 	"errors"
@@ -9,7 +11,6 @@ import (
 	"os"
 	"crypto/sha1"
 	"encoding/hex"
-	"sort"
 )
 
 // ParsePackfile parses the binary packfile and returns a slice of objects.
@@ -66,6 +67,13 @@ func ParsePackfile(packfile []byte) ([]Object, error) {
 
 // ParseModernPackfile parses a modern packfile (with compression and deltas) and returns objects
 func ParseModernPackfile(packfilePath string, useIndex bool) ([]Object, error) {
+	return ParseModernPackfileWithLimits(packfilePath, useIndex, DefaultUnpackLimits())
+}
+
+// ParseModernPackfileWithLimits parses a modern packfile while enforcing the given
+// size limits. Objects above limits.SpillThreshold are inflated to temporary files
+// (see Object.SpillPath); callers should pass the result to ReleaseObjects when done.
+func ParseModernPackfileWithLimits(packfilePath string, useIndex bool, limits UnpackLimits) (objects []Object, err error) {
 	// Open the packfile
 	file, err := os.Open(packfilePath)
 	if err != nil {
@@ -73,6 +81,23 @@ func ParseModernPackfile(packfilePath string, useIndex bool) ([]Object, error) {
 	}
 	defer file.Close()
 
+	if limits.MaxPackSize > 0 {
+		stat, err := file.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat packfile: %w", err)
+		}
+		if stat.Size() > limits.MaxPackSize {
+			return nil, fmt.Errorf("%w: %d bytes (limit %d)", ErrPackTooLarge, stat.Size(), limits.MaxPackSize)
+		}
+	}
+
+	budget := &unpackBudget{limits: limits}
+	defer func() {
+		if err != nil {
+			budget.cleanup()
+		}
+	}()
+
 	// Read and verify header
 	header := PackFileHeader{}
 	if err := binary.Read(file, binary.BigEndian, &header); err != nil {
@@ -87,235 +112,153 @@ func ParseModernPackfile(packfilePath string, useIndex bool) ([]Object, error) {
 		return nil, fmt.Errorf("unsupported packfile version: %d", header.Version)
 	}
 
-	// Store object locations and information
+	// Where each object is, and for deltas where their base is
 	type objectInfo struct {
-		offset   int64      // File offset of object
-		isDelta  bool       // Whether this is a delta object
-		baseHash string     // Base object hash (for REF_DELTA)
-		basePos  int64      // Base object position (for OFS_DELTA)
-	}
-	
-	// Store information about each object
-	objectInfos := make(map[uint64]objectInfo, header.NumObjects)
-	objectsByOffset := make(map[int64]*Object) // For resolving offset deltas
-	
-	// First pass: scan the packfile and collect object metadata
-	_, err = file.Seek(12, 0) // Skip header (12 bytes)
-	if err != nil {
-		return nil, fmt.Errorf("failed to seek in packfile: %w", err)
+		offset   int64  // File offset of object
+		isDelta  bool   // Whether this is a delta object
+		baseHash string // Base object name (for REF_DELTA)
+		basePos  int64  // Base object position (for OFS_DELTA)
 	}
+	infos := make([]objectInfo, 0, header.NumObjects)
 
-	// Track positions of all objects for delta resolution
+	// First pass: scan the packfile and collect object metadata. zlib reads
+	// the counting reader a byte at a time, so it stops at the end of each
+	// entry's data and the offset of the next one is known.
+	reader := &countingReader{r: bufio.NewReader(file), pos: 12}
 	for i := uint32(0); i < header.NumObjects; i++ {
-		// Record current position
-		pos, err := file.Seek(0, io.SeekCurrent)
+		pos := reader.pos
+		entry, err := readEntryHeader(reader, pos)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get position for object %d: %w", i, err)
+			return nil, fmt.Errorf("object %d: %w", i, err)
 		}
-		
-		// Read object type and size from header
-		headerByte, err := readByte(file)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read header for object %d: %w", i, err)
+		if err := budget.checkDeclared(entry.size); err != nil {
+			return nil, fmt.Errorf("object %d: %w", i, err)
 		}
-		
-		// Extract type and size
-		objType := ObjectType((headerByte >> 4) & 0x7)
-		size := uint64(headerByte & 0x0F)
-		shift := uint(4)
-		
-		// Read variable-length size
-		for headerByte&0x80 != 0 {
-			headerByte, err = readByte(file)
-			if err != nil {
-				return nil, fmt.Errorf("failed to read size for object %d: %w", i, err)
-			}
-			size |= uint64(headerByte&0x7F) << shift
-			shift += 7
-		}
-		
-		// Determine if this is a delta and record base information
 		info := objectInfo{offset: pos}
-		
-		if objType == OBJ_REF_DELTA {
-			info.isDelta = true
-			
-			// Read base hash for reference delta
-			baseHashBytes := make([]byte, 20)
-			if _, err := io.ReadFull(file, baseHashBytes); err != nil {
-				return nil, fmt.Errorf("failed to read base hash for object %d: %w", i, err)
-			}
-			info.baseHash = fmt.Sprintf("%x", baseHashBytes)
-		} else if objType == OBJ_OFS_DELTA {
-			info.isDelta = true
-			
-			// Read offset delta encoding
-			var baseOffset uint64
-			var b byte = 0x80
-			var j uint = 0
-			
-			for (b & 0x80) != 0 {
-				b, err = readByte(file)
-				if err != nil {
-					return nil, fmt.Errorf("failed to read delta offset for object %d: %w", i, err)
-				}
-				
-				baseOffset |= uint64(b&0x7F) << (j * 7)
-				j++
-				
-				// Break if no more bytes (MSB not set)
-				if (b & 0x80) == 0 {
-					break
-				}
-			}
-			
-			// Calculate base position
-			info.basePos = pos - int64(baseOffset)
+		switch entry.rawType {
+		case OBJ_REF_DELTA:
+			info.isDelta, info.baseHash = true, entry.baseName
+		case OBJ_OFS_DELTA:
+			info.isDelta, info.basePos = true, entry.baseOffset
 		}
-		
-		// Record this object
-		objectInfos[uint64(i)] = info
-		
-		// Skip compressed data - we'll read it in the second pass
-		// Create zlib reader
-		zlibReader, err := zlib.NewReader(file)
+		infos = append(infos, info)
+
+		// Skip the compressed data, refusing to inflate past the declared size
+		zlibReader, err := zlib.NewReader(reader)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create zlib reader for object %d: %w", i, err)
 		}
-		
-		// Skip the compressed data
-		_, err = io.Copy(io.Discard, zlibReader)
+		skipped, err := io.Copy(io.Discard, io.LimitReader(zlibReader, int64(entry.size)+1))
+		if err == nil {
+			// Read to the end of the stream and its checksum
+			_, err = io.Copy(io.Discard, zlibReader)
+		}
+		zlibReader.Close()
 		if err != nil {
-			zlibReader.Close()
 			return nil, fmt.Errorf("failed to skip data for object %d: %w", i, err)
 		}
-		zlibReader.Close()
+		if uint64(skipped) > entry.size {
+			return nil, fmt.Errorf("object %d inflates beyond its declared size of %d bytes", i, entry.size)
+		}
 	}
 
 	// Second pass: read non-delta objects
-	var objects []Object
-	var deltaObjects []struct {
-		objIndex uint64
-		info     objectInfo
-	}
-	
-	// Process non-delta objects first
-	for objIndex, info := range objectInfos {
-		if !info.isDelta {
-			// Seek to the object
-			_, err = file.Seek(info.offset, 0)
-			if err != nil {
-				return nil, fmt.Errorf("failed to seek to object at offset %d: %w", info.offset, err)
-			}
-			
-			// Read the object
-			obj, _, _, err := readPackObject(file)
-			if err != nil {
-				return nil, fmt.Errorf("failed to read object at offset %d: %w", info.offset, err)
-			}
-			
-			// Calculate hash for non-delta objects
-			obj.Hash = calculateObjectHash(obj.Type, obj.Data)
-			
-			// Store the object
-			objects = append(objects, *obj)
-			objectsByOffset[info.offset] = obj
-		} else {
-			// Collect delta objects for third pass
-			deltaObjects = append(deltaObjects, struct {
-				objIndex uint64
-				info     objectInfo
-			}{objIndex, info})
+	objectsByOffset := make(map[int64]*Object, len(infos)) // Resolved objects, for OFS_DELTA bases
+	offsetsByName := make(map[string]int64, len(infos))   // Offsets of resolved objects, for REF_DELTA bases
+	depths := make(map[int64]int)                          // Delta chain length of resolved deltas
+	var deltas []objectInfo
+	for _, info := range infos {
+		if info.isDelta {
+			deltas = append(deltas, info)
+			continue
 		}
-	}
-	
-	// Sort delta objects to ensure base objects are processed before dependent deltas
-	sort.Slice(deltaObjects, func(i, j int) bool {
-		infoI, infoJ := deltaObjects[i].info, deltaObjects[j].info
-		
-		// Process REF_DELTA before OFS_DELTA
-		if infoI.baseHash != "" && infoJ.baseHash == "" {
-			return true
-		}
-		if infoI.baseHash == "" && infoJ.baseHash != "" {
-			return false
+		if _, err := file.Seek(info.offset, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to seek to object at offset %d: %w", info.offset, err)
 		}
-		
-		// For OFS_DELTA, process in order of base offset (lowest first)
-		if infoI.baseHash == "" {
-			return infoI.basePos < infoJ.basePos
-		}
-		
-		// Default to lower index first
-		return deltaObjects[i].objIndex < deltaObjects[j].objIndex
-	})
-	
-	// Third pass: resolve and apply deltas
-	for _, d := range deltaObjects {
-		info := d.info
-		
-		// Seek to the object
-		_, err = file.Seek(info.offset, 0)
+		obj, _, _, err := readPackObject(file, budget)
 		if err != nil {
-			return nil, fmt.Errorf("failed to seek to delta at offset %d: %w", info.offset, err)
+			return nil, fmt.Errorf("failed to read object at offset %d: %w", info.offset, err)
 		}
-		
-		// Read the delta object
-		deltaObj, isDelta, baseHash, err := readPackObject(file)
+		obj.Hash, err = hashPackObject(obj)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read delta at offset %d: %w", info.offset, err)
-		}
-		
-		if !isDelta {
-			return nil, fmt.Errorf("expected delta at offset %d", info.offset)
+			return nil, fmt.Errorf("failed to hash object at offset %d: %w", info.offset, err)
 		}
-		
-		// Find the base object
-		var baseObj *Object
-		
-		if info.baseHash != "" {
-			// REF_DELTA - find the base by hash
-			for i := range objects {
-				if objects[i].Hash == info.baseHash {
-					baseObj = &objects[i]
-					break
-				}
+		objectsByOffset[info.offset] = obj
+		offsetsByName[obj.Hash] = info.offset
+	}
+
+	// Third pass: resolve deltas. A delta's base may be a delta itself, so
+	// each round resolves those whose base is known, until all are or a
+	// round makes no progress: then the bases left are missing from the
+	// pack, or the deltas form a cycle.
+	for len(deltas) > 0 {
+		var pending []objectInfo
+		for _, info := range deltas {
+			basePos, ok := info.basePos, true
+			if info.baseHash != "" {
+				basePos, ok = offsetsByName[info.baseHash]
 			}
-		} else {
-			// OFS_DELTA - find the base by offset
-			baseObj = objectsByOffset[info.basePos]
-		}
-		
-		if baseObj == nil {
-			return nil, fmt.Errorf("base object not found for delta at offset %d", info.offset)
-		}
-		
-		// Apply the delta
-		resultData, err := applyDelta(baseObj.Data, deltaObj.Data)
-		if err != nil {
-			return nil, fmt.Errorf("failed to apply delta at offset %d: %w", info.offset, err)
+			baseObj := objectsByOffset[basePos]
+			if !ok || baseObj == nil {
+				pending = append(pending, info)
+				continue
+			}
+			depth := depths[basePos] + 1
+			if depth > maxDeltaChain {
+				return nil, fmt.Errorf("delta chain at offset %d is longer than %d", info.offset, maxDeltaChain)
+			}
+
+			if _, err := file.Seek(info.offset, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("failed to seek to delta at offset %d: %w", info.offset, err)
+			}
+			deltaObj, isDelta, _, err := readPackObject(file, budget)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read delta at offset %d: %w", info.offset, err)
+			}
+			if !isDelta {
+				return nil, fmt.Errorf("expected delta at offset %d", info.offset)
+			}
+			baseData, err := ObjectData(baseObj)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load delta base at offset %d: %w", info.offset, err)
+			}
+			resultData, err := applyDelta(baseData, deltaObj.Data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to apply delta at offset %d: %w", info.offset, err)
+			}
+			if err := budget.checkDeclared(uint64(len(resultData))); err != nil {
+				return nil, fmt.Errorf("delta at offset %d: %w", info.offset, err)
+			}
+			if err := budget.consume(int64(len(resultData))); err != nil {
+				return nil, err
+			}
+
+			// The resolved object takes the type of the chain's base
+			resultObj := &Object{Type: baseObj.Type, Data: resultData}
+			resultObj.Hash = calculateObjectHash(resultObj.Type, resultObj.Data)
+			objectsByOffset[info.offset] = resultObj
+			offsetsByName[resultObj.Hash] = info.offset
+			depths[info.offset] = depth
 		}
-		
-		// Create the resulting object
-		resultObj := Object{
-			Type:     baseObj.Type, // Inherit type from base
-			Data:     resultData,
-			IsDelta:  false,        // Once resolved, it's no longer a delta
+		if len(pending) == len(deltas) {
+			return nil, fmt.Errorf("base object not found for delta at offset %d: missing from the pack, or in a delta cycle (%d deltas unresolved)",
+				pending[0].offset, len(pending))
 		}
-		
-		// Calculate the hash
-		resultObj.Hash = calculateObjectHash(resultObj.Type, resultObj.Data)
-		
-		// Store the resolved object
-		objects = append(objects, resultObj)
-		objectsByOffset[info.offset] = &objects[len(objects)-1]
+		deltas = pending
 	}
 
+	// Objects come out in pack order
+	objects = make([]Object, 0, len(infos))
+	for _, info := range infos {
+		objects = append(objects, *objectsByOffset[info.offset])
+	}
 	return objects, nil
 }
 
-// readPackObject reads a single object from a packfile
-func readPackObject(file *os.File) (*Object, bool, string, error) {
+// readPackObject reads a single object from a packfile. The size declared in the
+// object header is checked against budget before anything is allocated, and the
+// inflated stream is cut off if it produces more than that.
+func readPackObject(file *os.File, budget *unpackBudget) (*Object, bool, string, error) {
 	// Start position for this object
 	startPos, err := file.Seek(0, io.SeekCurrent)
 	if err != nil {
@@ -343,6 +286,9 @@ func readPackObject(file *os.File) (*Object, bool, string, error) {
 		size |= uint64(headerByte&0x7F) << shift
 		shift += 7
 	}
+	if err := budget.checkDeclared(size); err != nil {
+		return nil, false, "", err
+	}
 
 	// Check if this is a delta object
 	isDelta := false
@@ -398,40 +344,58 @@ func readPackObject(file *os.File) (*Object, bool, string, error) {
 	}
 	defer zlibReader.Close()
 
-	// Read the decompressed object data
-	data := make([]byte, 0, size)
-	buf := make([]byte, 4096) // Read in chunks
-	
-	var totalRead uint64
-	for totalRead < size {
-		n, err := zlibReader.Read(buf)
-		if err != nil && err != io.EOF {
+	// Never read more than one byte past the declared size; anything beyond that
+	// means the header lied and the stream is rejected.
+	limited := io.LimitReader(zlibReader, int64(size)+1)
+
+	obj := &Object{
+		// Hash will be filled in later when we know what it is
+		Type:     objectType,
+		IsDelta:  isDelta,
+		BaseHash: baseHash,
+	}
+
+	var totalRead int64
+	if budget.shouldSpill(size) && !isDelta {
+		spill, err := os.CreateTemp(budget.limits.TempDir, "vec-unpack-*")
+		if err != nil {
+			return nil, false, "", fmt.Errorf("failed to create spill file: %w", err)
+		}
+		budget.spilled = append(budget.spilled, spill.Name())
+		totalRead, err = io.Copy(spill, limited)
+		if closeErr := spill.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
 			return nil, false, "", fmt.Errorf("failed to read object data: %w", err)
 		}
-		
-		if n > 0 {
-			data = append(data, buf[:n]...)
-			totalRead += uint64(n)
+		obj.SpillPath = spill.Name()
+		obj.Size = totalRead
+	} else {
+		// Cap the initial allocation; the header is untrusted until the data arrives
+		capacity := size
+		if capacity > 64<<10 {
+			capacity = 64 << 10
 		}
-		
-		if err == io.EOF {
-			break
+		buf := bytes.NewBuffer(make([]byte, 0, capacity))
+		totalRead, err = io.Copy(buf, limited)
+		if err != nil {
+			return nil, false, "", fmt.Errorf("failed to read object data: %w", err)
 		}
+		obj.Data = buf.Bytes()
 	}
-	
-	// Verify size
-	if totalRead != size {
-		fmt.Printf("Warning: Object size mismatch - expected %d, got %d bytes\n", size, totalRead)
+
+	if uint64(totalRead) > size {
+		return nil, false, "", fmt.Errorf("object inflates beyond its declared size of %d bytes", size)
+	}
+	if uint64(totalRead) != size {
+		return nil, false, "", fmt.Errorf("object size mismatch: expected %d, got %d bytes", size, totalRead)
+	}
+	if err := budget.consume(totalRead); err != nil {
+		return nil, false, "", err
 	}
 
-	// Create and return the object
-	return &Object{
-		// Hash will be filled in later when we know what it is
-		Type:     objectType,
-		Data:     data,
-		IsDelta:  isDelta,
-		BaseHash: baseHash,
-	}, isDelta, baseHash, nil
+	return obj, isDelta, baseHash, nil
 }
 
 // readByte reads a single byte from the file
@@ -459,6 +423,8 @@ func calculateObjectHash(objType ObjectType, data []byte) string {
 		typeStr = "tree"
 	case OBJ_BLOB:
 		typeStr = "blob"
+	case OBJ_TAG:
+		typeStr = "tag"
 	default:
 		typeStr = "blob" // Default to blob for unknown types
 	}
@@ -472,3 +438,28 @@ func calculateObjectHash(objType ObjectType, data []byte) string {
 	
 	return hex.EncodeToString(h.Sum(nil))
 }
+
+// hashPackObject hashes obj like calculateObjectHash, streaming spilled content from disk.
+func hashPackObject(obj *Object) (string, error) {
+	if obj.SpillPath == "" {
+		return calculateObjectHash(obj.Type, obj.Data), nil
+	}
+
+	f, err := os.Open(obj.SpillPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open spilled object: %w", err)
+	}
+	defer f.Close()
+
+	typeStr := typeToString(obj.Type)
+	if obj.Type != OBJ_COMMIT && obj.Type != OBJ_TREE && obj.Type != OBJ_TAG {
+		typeStr = "blob" // Matches calculateObjectHash
+	}
+
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %d\x00", typeStr, obj.Size)
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash spilled object: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,64 @@
+package packfile
+
+import (
+	"fmt"
+	"io"
+)
+
+// Progress phases reported while building a pack
+const (
+	PhaseCounting    = "Counting objects"
+	PhaseCompressing = "Compressing objects"
+	PhaseWriting     = "Writing objects" // Counted in bytes of pack data
+)
+
+// ProgressFunc receives the number of objects done out of total in a phase
+type ProgressFunc func(phase string, done, total int)
+
+// NewProgressPrinter returns a ProgressFunc drawing a percentage line on w,
+// redrawn in place and finished with ", done." once done reaches total
+func NewProgressPrinter(w io.Writer) ProgressFunc {
+	lastPercent := -1
+	lastPhase := ""
+	return func(phase string, done, total int) {
+		if phase != lastPhase {
+			lastPhase, lastPercent = phase, -1
+		}
+		percent := 100
+		if total > 0 {
+			percent = done * 100 / total
+		}
+		if percent == lastPercent && done < total {
+			return
+		}
+		lastPercent = percent
+		if phase == PhaseWriting {
+			fmt.Fprintf(w, "\r%s: %3d%% (%s/%s)", phase, percent, FormatBytes(int64(done)), FormatBytes(int64(total)))
+		} else {
+			fmt.Fprintf(w, "\r%s: %3d%% (%d/%d)", phase, percent, done, total)
+		}
+		if done >= total {
+			fmt.Fprintln(w, ", done.")
+		}
+	}
+}
+
+// report calls progress if it is set
+func (p ProgressFunc) report(phase string, done, total int) {
+	if p != nil {
+		p(phase, done, total)
+	}
+}
+
+// FormatBytes renders a byte count with a binary unit
+func FormatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.2f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.2f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.2f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
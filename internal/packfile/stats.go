@@ -0,0 +1,197 @@
+package packfile
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// PackEntry describes how one object is stored in a pack
+type PackEntry struct {
+	Hash       string     // From the pack index; empty if the index doesn't list it
+	Offset     int64      // Position of the entry in the pack
+	Type       ObjectType // Type of the object, for deltas that of the chain's base
+	Size       uint64     // Size of the object itself, for deltas after applying them
+	StoredSize int64      // Bytes the entry takes in the pack, header included
+	Depth      int        // Delta chain length; 0 for whole objects
+	BaseOffset int64      // Offset of the delta base, -1 for whole objects or unknown bases
+}
+
+// PackLayout lists the entries of a pack in the order they are stored
+type PackLayout struct {
+	Entries []PackEntry
+}
+
+// countingReader tracks the position in the pack of a buffered reader; it
+// is a ByteReader, so zlib reads no further than the end of each stream
+type countingReader struct {
+	r   *bufio.Reader
+	pos int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.pos += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.pos++
+	}
+	return b, err
+}
+
+// InspectPack reads the layout of the pack at packPath without resolving
+// deltas: each entry's stored size, type, size and delta chain, named by the
+// pack index at indexPath
+func InspectPack(packPath, indexPath string) (*PackLayout, error) {
+	index, err := ReadPackIndex(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	hashAt := make(map[int64]string, len(index.Entries))
+	offsetOf := make(map[string]int64, len(index.Entries))
+	for hash, entry := range index.Entries {
+		hashAt[int64(entry.Offset)] = hash
+		offsetOf[hash] = int64(entry.Offset)
+	}
+
+	file, err := os.Open(packPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open packfile: %w", err)
+	}
+	defer file.Close()
+	r := &countingReader{r: bufio.NewReader(file)}
+
+	header := PackFileHeader{}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("failed to read packfile header: %w", err)
+	}
+	if string(header.Signature[:]) != "PACK" {
+		return nil, errors.New("invalid packfile: bad signature")
+	}
+	if header.Version != 2 {
+		return nil, fmt.Errorf("unsupported packfile version: %d", header.Version)
+	}
+
+	type rawEntry struct {
+		rawType    ObjectType
+		baseHash   string // REF_DELTA base
+		baseOffset int64  // OFS_DELTA base
+		size       uint64 // Target size for deltas
+	}
+	layout := &PackLayout{Entries: make([]PackEntry, 0, header.NumObjects)}
+	raws := make([]rawEntry, 0, header.NumObjects)
+	for i := uint32(0); i < header.NumObjects; i++ {
+		pos := r.pos
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read header for object %d: %w", i, err)
+		}
+		raw := rawEntry{rawType: ObjectType((b >> 4) & 0x7), baseOffset: -1}
+		size := uint64(b & 0x0F)
+		for shift := uint(4); b&0x80 != 0; shift += 7 {
+			if b, err = r.ReadByte(); err != nil {
+				return nil, fmt.Errorf("failed to read size for object %d: %w", i, err)
+			}
+			size |= uint64(b&0x7F) << shift
+		}
+
+		switch raw.rawType {
+		case OBJ_REF_DELTA:
+			base := make([]byte, 20)
+			if _, err := io.ReadFull(r, base); err != nil {
+				return nil, fmt.Errorf("failed to read base hash for object %d: %w", i, err)
+			}
+			raw.baseHash = fmt.Sprintf("%x", base)
+		case OBJ_OFS_DELTA:
+			// Same encoding the parser reads
+			var offset uint64
+			for j := uint(0); ; j++ {
+				if b, err = r.ReadByte(); err != nil {
+					return nil, fmt.Errorf("failed to read delta offset for object %d: %w", i, err)
+				}
+				offset |= uint64(b&0x7F) << (j * 7)
+				if b&0x80 == 0 {
+					break
+				}
+			}
+			raw.baseOffset = pos - int64(offset)
+		}
+
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read data of object %d: %w", i, err)
+		}
+		// A delta starts with the sizes of its base and target
+		var prefix [20]byte
+		n, _ := io.ReadFull(zr, prefix[:])
+		skipped, err := io.Copy(io.Discard, io.LimitReader(zr, int64(size)+1))
+		zr.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read data of object %d: %w", i, err)
+		}
+		if uint64(n)+uint64(skipped) > size {
+			return nil, fmt.Errorf("object %d inflates beyond its declared size of %d bytes", i, size)
+		}
+		raw.size = size
+		if raw.rawType == OBJ_REF_DELTA || raw.rawType == OBJ_OFS_DELTA {
+			_, read := decodeSize(prefix[:n])
+			raw.size, _ = decodeSize(prefix[read:n])
+		}
+
+		layout.Entries = append(layout.Entries, PackEntry{
+			Hash:       hashAt[pos],
+			Offset:     pos,
+			Size:       raw.size,
+			StoredSize: r.pos - pos,
+			BaseOffset: -1,
+		})
+		raws = append(raws, raw)
+	}
+
+	// Follow each delta to the whole object at the end of its chain
+	position := make(map[int64]int, len(layout.Entries))
+	for i, entry := range layout.Entries {
+		position[entry.Offset] = i
+	}
+	resolved := make([]bool, len(layout.Entries))
+	var resolve func(i int, seen int) (ObjectType, int)
+	resolve = func(i int, seen int) (ObjectType, int) {
+		entry := &layout.Entries[i]
+		if resolved[i] || seen > len(layout.Entries) {
+			return entry.Type, entry.Depth
+		}
+		raw := raws[i]
+		if raw.rawType != OBJ_REF_DELTA && raw.rawType != OBJ_OFS_DELTA {
+			entry.Type, resolved[i] = raw.rawType, true
+			return entry.Type, 0
+		}
+		base := raw.baseOffset
+		if raw.baseHash != "" {
+			if offset, ok := offsetOf[raw.baseHash]; ok {
+				base = offset
+			}
+		}
+		entry.BaseOffset = base
+		j, ok := position[base]
+		if !ok {
+			// Thin pack: the base lives outside the pack
+			entry.Type, entry.Depth, resolved[i] = OBJ_DELTA, 1, true
+			return entry.Type, entry.Depth
+		}
+		baseType, baseDepth := resolve(j, seen+1)
+		entry.Type, entry.Depth, resolved[i] = baseType, baseDepth+1, true
+		return entry.Type, entry.Depth
+	}
+	for i := range layout.Entries {
+		resolve(i, 0)
+	}
+	return layout, nil
+}
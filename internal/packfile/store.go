@@ -0,0 +1,733 @@
+package packfile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// ErrObjectNotFound reports an object that is neither loose nor in a pack
+var ErrObjectNotFound = errors.New("object not found")
+
+const (
+	// maxDeltaChain bounds the delta chains followed to read an object, so a
+	// pack whose deltas loop fails instead of recursing forever
+	maxDeltaChain = 4096
+	// deltaBaseCacheSize is the memory each pack keeps of objects read as
+	// delta bases, since neighbouring objects tend to share them
+	deltaBaseCacheSize = 32 << 20
+)
+
+// PackStore reads objects out of the packs in a pack directory. Packs are
+// found when an object is looked up; one added later is picked up by the
+// first lookup it can answer, and one removed is dropped. Objects of the
+// packs the multi-pack-index covers are found through it, so their own
+// indexes are never read.
+type PackStore struct {
+	dir    string
+	mu     sync.Mutex
+	packs  map[string]*packReader // By pack file name
+	names  []string               // Pack file names, newest first
+	failed map[string]int64       // Modification time of packs that couldn't be read, by name
+
+	midx        *MultiPackIndex // nil without a usable one
+	midxModTime time.Time       // Of the chain file midx was read from
+	midxSize    int64
+}
+
+// packStores shares the store of each pack directory between the readers
+// of a process, so packs are only indexed once
+var packStores sync.Map
+
+// PackStoreRepo returns the store reading the packs in .vec/objects/pack
+func PackStoreRepo(repo *core.Repository) *PackStore {
+	dir := filepath.Join(repo.ObjectsDir, "pack")
+	store, _ := packStores.LoadOrStore(dir, &PackStore{dir: dir, packs: make(map[string]*packReader), failed: make(map[string]int64)})
+	return store.(*PackStore)
+}
+
+// packReader reads the objects of one pack
+type packReader struct {
+	path    string
+	mu      sync.Mutex
+	offsets map[string]int64 // Object ID -> offset of its entry; nil when the multi-pack-index has them
+	names   map[string]int64 // Name a REF_DELTA gives its base -> offset; nil until needed
+	cache   map[int64]cachedObject
+	cached  int
+}
+
+type cachedObject struct {
+	objType ObjectType
+	data    []byte
+}
+
+// ReadObject returns the type and content of the object id
+func (s *PackStore) ReadObject(id string) (string, []byte, error) {
+	pack, offset, err := s.find(id)
+	if err != nil {
+		return "", nil, err
+	}
+	objType, data, err := pack.readAt(offset, 0)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read object %s from %s: %w", id, filepath.Base(pack.path), err)
+	}
+	return typeToString(objType), data, nil
+}
+
+// ObjectType returns the type of the object id without inflating it
+func (s *PackStore) ObjectType(id string) (string, error) {
+	pack, offset, err := s.find(id)
+	if err != nil {
+		return "", err
+	}
+	objType, err := pack.typeAt(offset, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to read object %s from %s: %w", id, filepath.Base(pack.path), err)
+	}
+	return typeToString(objType), nil
+}
+
+// Has reports whether a pack holds the object id
+func (s *PackStore) Has(id string) bool {
+	_, _, err := s.find(id)
+	return err == nil
+}
+
+// find returns the pack holding id and the offset of its entry, looking
+// for new packs when none of the known ones has it
+func (s *PackStore) find(id string) (*packReader, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for rescanned := false; ; rescanned = true {
+		if s.midx != nil {
+			if e, ok := s.midx.Find(id); ok {
+				if pack := s.packs[e.Pack]; pack != nil {
+					if _, err := os.Stat(pack.path); err == nil {
+						return pack, int64(e.Offset), nil
+					}
+				}
+			}
+		}
+		for _, name := range s.names {
+			pack := s.packs[name]
+			if offset, ok := pack.offsets[id]; ok {
+				if _, err := os.Stat(pack.path); err == nil {
+					return pack, offset, nil
+				}
+			}
+		}
+		if rescanned {
+			return nil, 0, fmt.Errorf("%w: %s", ErrObjectNotFound, id)
+		}
+		if err := s.refresh(); err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// refresh loads the packs added to the directory since the last look and
+// forgets those removed
+func (s *PackStore) refresh() error {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.pack"))
+	if err != nil {
+		return fmt.Errorf("failed to list packs: %w", err)
+	}
+	present := make(map[string]bool, len(paths))
+	modTimes := make(map[string]int64, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		name := filepath.Base(path)
+		present[name] = true
+		modTimes[name] = info.ModTime().UnixNano()
+	}
+	covered := s.loadMultiPackIndex(present)
+
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if !present[name] {
+			continue
+		}
+		if pack, ok := s.packs[name]; ok && (pack.offsets != nil || covered[name]) {
+			continue
+		}
+		if covered[name] {
+			s.packs[name] = &packReader{path: path, cache: make(map[int64]cachedObject)}
+			continue
+		}
+		if mtime, ok := s.failed[name]; ok && mtime == modTimes[name] {
+			continue
+		}
+		pack, err := openPackReader(path)
+		if err != nil {
+			s.failed[name] = modTimes[name] // A damaged or half written pack answers nothing until it changes
+			continue
+		}
+		delete(s.failed, name)
+		s.packs[name] = pack
+	}
+	s.names = s.names[:0]
+	for name := range s.packs {
+		if !present[name] {
+			delete(s.packs, name)
+			continue
+		}
+		s.names = append(s.names, name)
+	}
+	sort.Slice(s.names, func(i, j int) bool {
+		if modTimes[s.names[i]] != modTimes[s.names[j]] {
+			return modTimes[s.names[i]] > modTimes[s.names[j]]
+		}
+		return s.names[i] < s.names[j]
+	})
+	return nil
+}
+
+// loadMultiPackIndex reads the multi-pack-index again when its chain file
+// has changed and returns the packs it covers. One that can't be read, or
+// that names a pack no longer present, is stale until the next write and
+// isn't used.
+func (s *PackStore) loadMultiPackIndex(present map[string]bool) map[string]bool {
+	info, err := os.Stat(filepath.Join(s.dir, midxChain))
+	if err != nil {
+		s.midx, s.midxModTime, s.midxSize = nil, time.Time{}, 0
+		return nil
+	}
+	if !info.ModTime().Equal(s.midxModTime) || info.Size() != s.midxSize {
+		midx, err := loadMultiPackIndex(s.dir)
+		if err != nil || midx.Len() == 0 {
+			midx = nil
+		}
+		s.midx, s.midxModTime, s.midxSize = midx, info.ModTime(), info.Size()
+	}
+	if s.midx == nil {
+		return nil
+	}
+	covered := make(map[string]bool)
+	for _, name := range s.midx.Packs() {
+		if !present[name] {
+			return nil
+		}
+		covered[name] = true
+	}
+	return covered
+}
+
+// openPackReader loads where the objects of the pack at path are, from its
+// index when that names objects by their IDs, or else by reading the pack
+func openPackReader(path string) (*packReader, error) {
+	pack := &packReader{path: path, cache: make(map[int64]cachedObject)}
+	index, err := ReadPackIndex(path[:len(path)-len(".pack")] + ".idx")
+	if err == nil && indexNamesObjectIDs(index) {
+		pack.offsets = make(map[string]int64, len(index.Entries))
+		for id, entry := range index.Entries {
+			pack.offsets[id] = int64(entry.Offset)
+		}
+		return pack, nil
+	}
+	if err := pack.scan(nil, nil); err != nil {
+		return nil, err
+	}
+	return pack, nil
+}
+
+// PackObjectIDs returns the IDs of the objects in the pack at packPath,
+// sorted
+func PackObjectIDs(packPath string) ([]string, error) {
+	pack, err := openPackReader(packPath)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(pack.offsets))
+	for id := range pack.offsets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// indexNamesObjectIDs reports whether an index is keyed by object IDs, as
+// those vec writes are, rather than by the SHA-1 names within the pack
+func indexNamesObjectIDs(index *PackfileIndex) bool {
+	for id := range index.Entries {
+		return len(id) == 2*sha256.Size
+	}
+	return true
+}
+
+// ObjectCheck validates an object of a pack as it is indexed; an error
+// stops the indexing
+type ObjectCheck func(id, objType string, data []byte) error
+
+// IndexPack reads every object of the pack at packPath and returns an index
+// of them by object ID, with the pack's checksum
+func IndexPack(packPath string) (*PackfileIndex, error) {
+	return IndexPackWithLimits(packPath, UnpackLimits{}, nil)
+}
+
+// IndexPackWithLimits is IndexPack rejecting packs and objects over limits
+// and handing each object to check, when given. Objects are read one at a
+// time and only their offsets kept, so memory doesn't grow with the pack.
+func IndexPackWithLimits(packPath string, limits UnpackLimits, check ObjectCheck) (*PackfileIndex, error) {
+	if limits.MaxPackSize > 0 {
+		stat, err := os.Stat(packPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat packfile: %w", err)
+		}
+		if stat.Size() > limits.MaxPackSize {
+			return nil, fmt.Errorf("%w: %d bytes (limit %d)", ErrPackTooLarge, stat.Size(), limits.MaxPackSize)
+		}
+	}
+	pack := &packReader{path: packPath, cache: make(map[int64]cachedObject)}
+	if err := pack.scan(&unpackBudget{limits: limits}, check); err != nil {
+		return nil, err
+	}
+	index := &PackfileIndex{Version: 2, Entries: make(map[string]PackIndexEntry, len(pack.offsets))}
+	for id, offset := range pack.offsets {
+		index.Entries[id] = PackIndexEntry{Offset: uint64(offset)}
+	}
+	trailer, err := getPackfileChecksum(packPath)
+	if err != nil {
+		return nil, err
+	}
+	index.Checksum = trailer
+	return index, nil
+}
+
+// InstallPackRepo copies the pack at packPath into .vec/objects/pack as
+// pack-<checksum>.pack, next to an index of its objects by ID, and returns
+// the installed pack's path. packPath itself is left in place.
+func InstallPackRepo(repo *core.Repository, packPath string) (string, error) {
+	return InstallPackWithLimitsRepo(repo, packPath, UnpackLimits{}, nil)
+}
+
+// InstallPackWithLimitsRepo is InstallPackRepo indexing the pack with
+// IndexPackWithLimits, so nothing is installed when it breaks limits or
+// check rejects one of its objects
+func InstallPackWithLimitsRepo(repo *core.Repository, packPath string, limits UnpackLimits, check ObjectCheck) (string, error) {
+	index, err := IndexPackWithLimits(packPath, limits, check)
+	if err != nil {
+		return "", err
+	}
+	perms, err := repo.Permissions()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(repo.ObjectsDir, "pack")
+	if err := perms.MkdirAll(dir); err != nil {
+		return "", fmt.Errorf("failed to create pack directory: %w", err)
+	}
+	base := filepath.Join(dir, "pack-"+hex.EncodeToString(index.Checksum))
+	if core.FileExists(base+".pack") && core.FileExists(base+".idx") {
+		return base + ".pack", nil
+	}
+
+	// The pack goes first: an index is what makes readers trust a pack
+	if err := copyFile(packPath, base+".pack.tmp"); err != nil {
+		return "", err
+	}
+	if err := perms.Apply(base+".pack.tmp", perms.File); err != nil {
+		os.Remove(base + ".pack.tmp")
+		return "", err
+	}
+	if err := os.Rename(base+".pack.tmp", base+".pack"); err != nil {
+		os.Remove(base + ".pack.tmp")
+		return "", fmt.Errorf("failed to install pack: %w", err)
+	}
+	if err := WritePackIndex(index, base+".idx.tmp"); err != nil {
+		os.Remove(base + ".idx.tmp")
+		return "", err
+	}
+	if err := os.Rename(base+".idx.tmp", base+".idx"); err != nil {
+		os.Remove(base + ".idx.tmp")
+		return "", fmt.Errorf("failed to install pack index: %w", err)
+	}
+	return base + ".pack", nil
+}
+
+// copyFile copies src to dst, replacing it
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open packfile: %w", err)
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create packfile: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return fmt.Errorf("failed to copy packfile: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("failed to copy packfile: %w", err)
+	}
+	return nil
+}
+
+// scan reads every object of the pack to find its ID and its name,
+// charging what it inflates to budget and passing each object to check
+// when they are given
+func (p *packReader) scan(budget *unpackBudget, check ObjectCheck) error {
+	offsets, err := entryOffsets(p.path)
+	if err != nil {
+		return err
+	}
+	p.offsets = make(map[string]int64, len(offsets))
+	p.names = make(map[string]int64, len(offsets))
+	for _, offset := range offsets {
+		if budget != nil {
+			if err := p.checkDeclaredAt(offset, budget); err != nil {
+				return err
+			}
+		}
+		objType, data, err := p.readAt(offset, 0)
+		if err != nil {
+			return fmt.Errorf("failed to read object at offset %d: %w", offset, err)
+		}
+		if budget != nil {
+			if err := budget.checkDeclared(uint64(len(data))); err != nil {
+				return err
+			}
+			if err := budget.consume(int64(len(data))); err != nil {
+				return err
+			}
+		}
+		typeName := typeToString(objType)
+		sum := sha256.Sum256(append([]byte(fmt.Sprintf("%s %d\x00", typeName, len(data))), data...))
+		id := hex.EncodeToString(sum[:])
+		if check != nil {
+			if err := check(id, typeName, data); err != nil {
+				return err
+			}
+		}
+		p.offsets[id] = offset
+		p.names[calculateObjectHash(objType, data)] = offset
+	}
+	return nil
+}
+
+// checkDeclaredAt rejects the entry at offset when its header declares more
+// than the per-object limit, before any of it is inflated
+func (p *packReader) checkDeclaredAt(offset int64, budget *unpackBudget) error {
+	file, r, err := p.open(offset)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	h, err := readEntryHeader(r, offset)
+	if err != nil {
+		return fmt.Errorf("failed to read object at offset %d: %w", offset, err)
+	}
+	return budget.checkDeclared(h.size)
+}
+
+// entryOffsets lists where each entry of a pack starts
+func entryOffsets(path string) ([]int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open packfile: %w", err)
+	}
+	defer file.Close()
+	r := &countingReader{r: bufio.NewReader(file)}
+
+	header := PackFileHeader{}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("failed to read packfile header: %w", err)
+	}
+	if string(header.Signature[:]) != "PACK" {
+		return nil, errors.New("invalid packfile: bad signature")
+	}
+	if header.Version != 2 {
+		return nil, fmt.Errorf("unsupported packfile version: %d", header.Version)
+	}
+	offsets := make([]int64, 0, header.NumObjects)
+	for i := uint32(0); i < header.NumObjects; i++ {
+		offsets = append(offsets, r.pos)
+		if _, err := readEntryHeader(r, r.pos); err != nil {
+			return nil, fmt.Errorf("object %d: %w", i, err)
+		}
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read data of object %d: %w", i, err)
+		}
+		_, err = io.Copy(io.Discard, zr)
+		zr.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read data of object %d: %w", i, err)
+		}
+	}
+	return offsets, nil
+}
+
+// entryHeader is what precedes the compressed data of a pack entry
+type entryHeader struct {
+	rawType    ObjectType
+	size       uint64 // Inflated size of the data; for deltas, of the delta
+	baseOffset int64  // OFS_DELTA base
+	baseName   string // REF_DELTA base
+}
+
+// readEntryHeader reads the header of the entry at offset from r, which is
+// left at the start of the compressed data
+func readEntryHeader(r io.ByteReader, offset int64) (*entryHeader, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object header: %w", err)
+	}
+	h := &entryHeader{rawType: ObjectType((b >> 4) & 0x7), size: uint64(b & 0x0F)}
+	for shift := uint(4); b&0x80 != 0; shift += 7 {
+		if b, err = r.ReadByte(); err != nil {
+			return nil, fmt.Errorf("failed to read object size: %w", err)
+		}
+		h.size |= uint64(b&0x7F) << shift
+	}
+	switch h.rawType {
+	case OBJ_REF_DELTA:
+		base := make([]byte, 20)
+		for i := range base {
+			if base[i], err = r.ReadByte(); err != nil {
+				return nil, fmt.Errorf("failed to read base hash: %w", err)
+			}
+		}
+		h.baseName = hex.EncodeToString(base)
+	case OBJ_OFS_DELTA:
+		// Same encoding the parser reads
+		var distance uint64
+		for j := uint(0); ; j++ {
+			if b, err = r.ReadByte(); err != nil {
+				return nil, fmt.Errorf("failed to read delta offset: %w", err)
+			}
+			distance |= uint64(b&0x7F) << (j * 7)
+			if b&0x80 == 0 {
+				break
+			}
+		}
+		h.baseOffset = offset - int64(distance)
+		if h.baseOffset < 12 || h.baseOffset >= offset {
+			return nil, fmt.Errorf("invalid delta base offset %d", h.baseOffset)
+		}
+	case OBJ_COMMIT, OBJ_TREE, OBJ_BLOB, OBJ_TAG:
+	default:
+		return nil, fmt.Errorf("invalid object type %d", h.rawType)
+	}
+	return h, nil
+}
+
+// open returns a reader of the pack positioned at offset
+func (p *packReader) open(offset int64) (*os.File, *bufio.Reader, error) {
+	file, err := os.Open(p.path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open packfile: %w", err)
+	}
+	return file, bufio.NewReader(io.NewSectionReader(file, offset, math.MaxInt64-offset)), nil
+}
+
+// readAt reads the object whose entry is at offset, applying the deltas
+// down to the whole object at the end of its chain
+func (p *packReader) readAt(offset int64, depth int) (ObjectType, []byte, error) {
+	if depth > maxDeltaChain {
+		return OBJ_NONE, nil, errors.New("delta chain too long")
+	}
+	p.mu.Lock()
+	cached, ok := p.cache[offset]
+	p.mu.Unlock()
+	if ok {
+		return cached.objType, cached.data, nil
+	}
+
+	file, r, err := p.open(offset)
+	if err != nil {
+		return OBJ_NONE, nil, err
+	}
+	h, err := readEntryHeader(r, offset)
+	var data []byte
+	if err == nil {
+		data, err = inflateEntry(r, h.size)
+	}
+	// Closed before reading the base so a chain holds one file at a time
+	file.Close()
+	if err != nil {
+		return OBJ_NONE, nil, err
+	}
+	if h.rawType != OBJ_OFS_DELTA && h.rawType != OBJ_REF_DELTA {
+		return h.rawType, data, nil
+	}
+
+	baseOffset, err := p.baseOffset(h)
+	if err != nil {
+		return OBJ_NONE, nil, err
+	}
+	baseType, base, err := p.readAt(baseOffset, depth+1)
+	if err != nil {
+		return OBJ_NONE, nil, err
+	}
+	p.remember(baseOffset, baseType, base)
+	result, err := applyDelta(base, data)
+	if err != nil {
+		return OBJ_NONE, nil, fmt.Errorf("failed to apply delta at offset %d: %w", offset, err)
+	}
+	return baseType, result, nil
+}
+
+// typeAt returns the type of the object whose entry is at offset, following
+// deltas to their base without inflating anything
+func (p *packReader) typeAt(offset int64, depth int) (ObjectType, error) {
+	if depth > maxDeltaChain {
+		return OBJ_NONE, errors.New("delta chain too long")
+	}
+	file, r, err := p.open(offset)
+	if err != nil {
+		return OBJ_NONE, err
+	}
+	h, err := readEntryHeader(r, offset)
+	file.Close()
+	if err != nil {
+		return OBJ_NONE, err
+	}
+	if h.rawType != OBJ_OFS_DELTA && h.rawType != OBJ_REF_DELTA {
+		return h.rawType, nil
+	}
+	baseOffset, err := p.baseOffset(h)
+	if err != nil {
+		return OBJ_NONE, err
+	}
+	return p.typeAt(baseOffset, depth+1)
+}
+
+// baseOffset locates the base of a delta in the pack. A REF_DELTA base is
+// looked up by name, which needs the pack read once.
+func (p *packReader) baseOffset(h *entryHeader) (int64, error) {
+	if h.rawType == OBJ_OFS_DELTA {
+		return h.baseOffset, nil
+	}
+	p.mu.Lock()
+	names := p.names
+	p.mu.Unlock()
+	if names == nil {
+		scanned := &packReader{path: p.path, cache: make(map[int64]cachedObject)}
+		if err := scanned.scan(nil, nil); err != nil {
+			return 0, err
+		}
+		p.mu.Lock()
+		p.names, names = scanned.names, scanned.names
+		p.mu.Unlock()
+	}
+	offset, ok := names[h.baseName]
+	if !ok {
+		return 0, fmt.Errorf("delta base %s is not in the pack", h.baseName)
+	}
+	return offset, nil
+}
+
+// remember keeps a delta base for the next delta against it, emptying the
+// cache when it is full
+func (p *packReader) remember(offset int64, objType ObjectType, data []byte) {
+	if len(data) > deltaBaseCacheSize/4 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.cache[offset]; ok {
+		return
+	}
+	if p.cached+len(data) > deltaBaseCacheSize {
+		p.cache = make(map[int64]cachedObject)
+		p.cached = 0
+	}
+	p.cache[offset] = cachedObject{objType: objType, data: data}
+	p.cached += len(data)
+}
+
+// inflateEntry reads the compressed data of an entry, which must inflate to
+// exactly size bytes
+func inflateEntry(r io.Reader, size uint64) ([]byte, error) {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object data: %w", err)
+	}
+	defer zr.Close()
+	capacity := size
+	if capacity > 64<<10 {
+		capacity = 64 << 10 // The header is untrusted until the data arrives
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, capacity))
+	n, err := io.Copy(buf, io.LimitReader(zr, int64(size)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object data: %w", err)
+	}
+	if uint64(n) != size {
+		return nil, fmt.Errorf("object size mismatch: expected %d, got %d bytes", size, n)
+	}
+	return buf.Bytes(), nil
+}
+
+// ReadObjectRepo returns an object as a loose object file holds it, its
+// "<type> <size>\x00" header then its content, reading the loose file or,
+// when there is none, the packs
+func ReadObjectRepo(repo *core.Repository, hash string) ([]byte, error) {
+	if len(hash) < 3 {
+		return nil, fmt.Errorf("invalid object hash '%s'", hash)
+	}
+	content, err := core.ReadObjectFile(repo.Root, filepath.Join(repo.ObjectsDir, hash[:2], hash[2:]))
+	if err == nil {
+		return inflateLoose(content)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	objType, data, err := PackStoreRepo(repo).ReadObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(fmt.Sprintf("%s %d\x00", objType, len(data))), data...), nil
+}
+
+// HasObjectRepo reports whether the object is stored, loose or packed
+func HasObjectRepo(repo *core.Repository, hash string) bool {
+	if len(hash) < 3 {
+		return false
+	}
+	if core.FileExists(filepath.Join(repo.ObjectsDir, hash[:2], hash[2:])) {
+		return true
+	}
+	return PackStoreRepo(repo).Has(hash)
+}
+
+// inflateLoose returns the content of a loose object as stored, inflating
+// it first when it was written zlib compressed, as objects unpacked from a
+// fetch are. No object header starts with the zlib header's 'x'.
+func inflateLoose(content []byte) ([]byte, error) {
+	if len(content) < 2 || content[0] != 0x78 || (uint16(content[0])<<8|uint16(content[1]))%31 != 0 {
+		return content, nil
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress object: %w", err)
+	}
+	defer zr.Close()
+	inflated, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress object: %w", err)
+	}
+	return inflated, nil
+}
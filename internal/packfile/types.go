@@ -39,6 +39,10 @@ type Object struct {
 	// For delta objects
 	BaseHash string  // Hash of base object (if this is a delta)
 	IsDelta  bool    // Whether this object is a delta
+
+	// For objects too large to hold in memory
+	SpillPath string // Inflated content on disk; Data is nil when set
+	Size      int64  // Inflated size of a spilled object
 }
 
 // DeltaObject represents a delta object with a base object hash and delta instructions
@@ -71,6 +75,11 @@ type PackFileHeader struct {
 	NumObjects uint32  // Number of objects in the pack
 }
 
+// TypeName returns the object's type as stored in loose object headers
+func (o *Object) TypeName() string {
+	return typeToString(o.Type)
+}
+
 // typeToString converts an ObjectType to its string representation
 func typeToString(objType ObjectType) string {
 	switch objType {
@@ -0,0 +1,368 @@
+package packfile
+
+import (
+	"bufio"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// Delta search done by WritePack
+const (
+	packWindow       = 10       // Objects of each type tried as delta bases
+	packWindowMemory = 64 << 20 // Bytes of content the window may hold
+)
+
+// PackOptions control how WritePack writes a pack
+type PackOptions struct {
+	Depth        int  // Longest delta chain made, pack.depth; 0 writes every object whole
+	OffsetDeltas bool // Deltas give their base's offset rather than its name, pack.offsetDeltas
+}
+
+// DefaultPackOptions returns the options used when no configuration is present
+func DefaultPackOptions() PackOptions {
+	return PackOptions{Depth: maxChainDepth, OffsetDeltas: true}
+}
+
+// LoadPackOptionsRepo reads pack.depth and pack.offsetDeltas from the
+// repository configuration, falling back to the defaults for unset keys
+func LoadPackOptionsRepo(repo *core.Repository) (PackOptions, error) {
+	opts := DefaultPackOptions()
+	value, err := repo.GetConfig("pack.depth")
+	if err != nil {
+		return opts, core.ConfigError("failed to read pack.depth", err)
+	}
+	if value != "" {
+		depth, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || depth < 0 {
+			return opts, core.ConfigError(fmt.Sprintf("invalid value '%s' for pack.depth", value), err)
+		}
+		// Readers refuse longer chains
+		opts.Depth = min(depth, maxDeltaChain)
+	}
+
+	value, err = repo.GetConfig("pack.offsetDeltas")
+	if err != nil {
+		return opts, core.ConfigError("failed to read pack.offsetDeltas", err)
+	}
+	if value != "" {
+		normalized, err := core.NormalizeConfigValue(core.ConfigBool, value)
+		if err != nil {
+			return opts, core.ConfigError(fmt.Sprintf("invalid value '%s' for pack.offsetDeltas", value), err)
+		}
+		opts.OffsetDeltas = normalized == "true"
+	}
+	return opts, nil
+}
+
+// ObjectIterator returns the next object to write to a pack, or io.EOF
+// once there are none left
+type ObjectIterator func() (*Object, error)
+
+// PackWriter writes a packfile one object at a time, so no more than the
+// object being written has to be in memory. The pack checksum is computed
+// as the pack is written, and the offsets of the objects are kept for its
+// index.
+type PackWriter struct {
+	out     *hashingWriter
+	count   uint32            // Objects announced in the header
+	written uint32            // Objects written so far
+	names   map[string][]byte // Pack names of the objects written, by ID
+	index   *PackfileIndex
+	offsets bool // Write OFS_DELTA rather than REF_DELTA entries
+}
+
+// hashingWriter passes writes on to w, counting them into the pack
+// checksum, the CRC of the current entry and the offset
+type hashingWriter struct {
+	w      io.Writer
+	sum    hash.Hash
+	crc    hash.Hash32
+	offset uint64
+}
+
+func (h *hashingWriter) Write(p []byte) (int, error) {
+	n, err := h.w.Write(p)
+	h.sum.Write(p[:n])
+	h.crc.Write(p[:n])
+	h.offset += uint64(n)
+	return n, err
+}
+
+// NewPackWriter starts a pack of count objects on w by writing its header.
+// opts.OffsetDeltas decides how the deltas written refer to their base.
+func NewPackWriter(w io.Writer, count uint32, opts PackOptions) (*PackWriter, error) {
+	pw := &PackWriter{
+		out:     &hashingWriter{w: w, sum: sha1.New(), crc: crc32.NewIEEE()},
+		count:   count,
+		names:   make(map[string][]byte, count),
+		index:   &PackfileIndex{Version: 2, Entries: make(map[string]PackIndexEntry, count)},
+		offsets: opts.OffsetDeltas,
+	}
+	header := PackFileHeader{
+		Signature:  [4]byte{'P', 'A', 'C', 'K'},
+		Version:    2,
+		NumObjects: count,
+	}
+	if err := binary.Write(pw.out, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("failed to write packfile header: %w", err)
+	}
+	return pw, nil
+}
+
+// WriteObject writes the object id, of objType with content data, whole
+func (pw *PackWriter) WriteObject(id string, objType ObjectType, data []byte) error {
+	if err := pw.begin(id); err != nil {
+		return err
+	}
+	start := pw.out.offset
+	if err := writeObjectHeader(pw.out, objType, uint64(len(data))); err != nil {
+		return err
+	}
+	if err := pw.deflate(data); err != nil {
+		return err
+	}
+	pw.finish(id, objType, data, start)
+	return nil
+}
+
+// WriteDelta writes the object id, of objType with content data, as delta
+// against baseID, which must already be in the pack: an offset delta, or
+// with opts.OffsetDeltas off, one naming the base
+func (pw *PackWriter) WriteDelta(id string, objType ObjectType, data []byte, baseID string, delta []byte) error {
+	baseName, ok := pw.names[baseID]
+	if !ok {
+		return fmt.Errorf("delta base %s of %s is not in the pack", baseID, id)
+	}
+	if err := pw.begin(id); err != nil {
+		return err
+	}
+	start := pw.out.offset
+	if pw.offsets {
+		if err := writeObjectHeader(pw.out, OBJ_OFS_DELTA, uint64(len(delta))); err != nil {
+			return err
+		}
+		if _, err := pw.out.Write(encodeBaseDistance(start - pw.index.Entries[baseID].Offset)); err != nil {
+			return fmt.Errorf("failed to write base offset: %w", err)
+		}
+	} else {
+		if err := writeObjectHeader(pw.out, OBJ_REF_DELTA, uint64(len(delta))); err != nil {
+			return err
+		}
+		if _, err := pw.out.Write(baseName); err != nil {
+			return fmt.Errorf("failed to write base hash: %w", err)
+		}
+	}
+	if err := pw.deflate(delta); err != nil {
+		return err
+	}
+	pw.finish(id, objType, data, start)
+	return nil
+}
+
+// encodeBaseDistance encodes how far before an OFS_DELTA entry its base
+// is, in groups of 7 bits from the lowest, each byte but the last with its
+// high bit set, as the pack readers decode it
+func encodeBaseDistance(distance uint64) []byte {
+	var buf []byte
+	for {
+		b := byte(distance & 0x7F)
+		distance >>= 7
+		if distance == 0 {
+			return append(buf, b)
+		}
+		buf = append(buf, b|0x80)
+	}
+}
+
+// begin checks that id may be written next
+func (pw *PackWriter) begin(id string) error {
+	if pw.written == pw.count {
+		return fmt.Errorf("pack of %d objects is already full", pw.count)
+	}
+	if _, ok := pw.names[id]; ok {
+		return fmt.Errorf("object %s is already in the pack", id)
+	}
+	pw.out.crc.Reset()
+	return nil
+}
+
+// deflate writes data zlib-compressed
+func (pw *PackWriter) deflate(data []byte) error {
+	zw := zlib.NewWriter(pw.out)
+	if _, err := zw.Write(data); err != nil {
+		zw.Close()
+		return fmt.Errorf("failed to write compressed data: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to close compressed writer: %w", err)
+	}
+	return nil
+}
+
+// finish records the entry of id written from start
+func (pw *PackWriter) finish(id string, objType ObjectType, data []byte, start uint64) {
+	name, _ := hex.DecodeString(calculateObjectHash(objType, data))
+	pw.names[id] = name
+	pw.index.Entries[id] = PackIndexEntry{
+		Offset: start,
+		Type:   objType,
+		Size:   uint64(len(data)),
+		CRC32:  pw.out.crc.Sum32(),
+	}
+	pw.written++
+}
+
+// Close ends the pack with its checksum, which it returns. It fails when
+// fewer objects were written than the header announced.
+func (pw *PackWriter) Close() ([]byte, error) {
+	if pw.written != pw.count {
+		return nil, fmt.Errorf("pack announced %d objects, %d were written", pw.count, pw.written)
+	}
+	checksum := pw.out.sum.Sum(nil)
+	if _, err := pw.out.w.Write(checksum); err != nil {
+		return nil, fmt.Errorf("failed to write packfile checksum: %w", err)
+	}
+	pw.index.Checksum = checksum
+	return checksum, nil
+}
+
+// Index returns the entries of the objects written, keyed by ID. Its
+// checksum is set once the pack is closed.
+func (pw *PackWriter) Index() *PackfileIndex {
+	return pw.index
+}
+
+// WritePack writes the count objects next returns as a pack on w and
+// returns its index. Each object is tried as a delta against the last
+// packWindow objects of its type, deltas included as long as the chain
+// stays within opts.Depth, and written as the smallest delta found when it
+// saves at least minDeltaSavings bytes.
+func WritePack(w io.Writer, count uint32, next ObjectIterator, opts PackOptions) (*PackfileIndex, error) {
+	pw, err := NewPackWriter(w, count, opts)
+	if err != nil {
+		return nil, err
+	}
+	window := &deltaWindow{bases: make(map[ObjectType][]windowEntry)}
+	for {
+		obj, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if obj.Type == OBJ_DELTA {
+			return nil, fmt.Errorf("object %s is a delta; deltas are made while writing", obj.Hash)
+		}
+
+		if opts.Depth == 0 {
+			if err := pw.WriteObject(obj.Hash, obj.Type, obj.Data); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		baseID, delta, depth := window.find(obj, opts.Depth)
+		if delta != nil {
+			err = pw.WriteDelta(obj.Hash, obj.Type, obj.Data, baseID, delta)
+		} else {
+			err = pw.WriteObject(obj.Hash, obj.Type, obj.Data)
+		}
+		if err != nil {
+			return nil, err
+		}
+		window.add(obj, depth)
+	}
+	if _, err := pw.Close(); err != nil {
+		return nil, err
+	}
+	return pw.Index(), nil
+}
+
+// WritePackFile writes the pack WritePack makes to path, with its index
+// next to it as path + ".idx"
+func WritePackFile(path string, count uint32, next ObjectIterator, opts PackOptions) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create packfile: %w", err)
+	}
+	buffered := bufio.NewWriterSize(file, 64<<10)
+	index, err := WritePack(buffered, count, next, opts)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to close packfile: %w", closeErr)
+	}
+	if err != nil {
+		return err
+	}
+	if err := createPackIndex(path+".idx", index); err != nil {
+		return fmt.Errorf("failed to create index file: %w", err)
+	}
+	return nil
+}
+
+// deltaWindow holds the objects last written, by type, as candidate delta
+// bases
+type deltaWindow struct {
+	bases map[ObjectType][]windowEntry
+	size  int // Bytes of content held
+}
+
+type windowEntry struct {
+	obj   *Object
+	depth int // Length of the delta chain obj was written with
+}
+
+// find returns the base and delta obj is best written as, and the length
+// of the chain it makes, or a nil delta when no base within maxDepth saves
+// enough
+func (w *deltaWindow) find(obj *Object, maxDepth int) (string, []byte, int) {
+	if len(obj.Data) < minDeltaSavings {
+		return "", nil, 0
+	}
+	var baseID string
+	var best []byte
+	depth := 0
+	for _, base := range w.bases[obj.Type] {
+		if base.depth >= maxDepth {
+			continue
+		}
+		delta, err := createDelta(base.obj.Data, obj.Data)
+		if err != nil || len(obj.Data)-len(delta) < minDeltaSavings {
+			continue
+		}
+		// Of two deltas as small, the shorter chain is cheaper to read
+		if best == nil || len(delta) < len(best) || (len(delta) == len(best) && base.depth+1 < depth) {
+			baseID, best, depth = base.obj.Hash, delta, base.depth+1
+		}
+	}
+	return baseID, best, depth
+}
+
+// add makes obj, written with a chain of depth deltas, a candidate base,
+// dropping the oldest of its type to stay within packWindow objects and
+// packWindowMemory bytes
+func (w *deltaWindow) add(obj *Object, depth int) {
+	if len(obj.Data) < minDeltaSavings || len(obj.Data) > packWindowMemory {
+		return
+	}
+	bases := append(w.bases[obj.Type], windowEntry{obj: obj, depth: depth})
+	w.size += len(obj.Data)
+	for len(bases) > packWindow || (w.size > packWindowMemory && len(bases) > 1) {
+		w.size -= len(bases[0].obj.Data)
+		bases = bases[1:]
+	}
+	w.bases[obj.Type] = bases
+}
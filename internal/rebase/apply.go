@@ -0,0 +1,266 @@
+package rebase
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/merge"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/staging"
+	"github.com/NahomAnteneh/vec/utils"
+)
+
+// filesRepo returns the files of treeID by path; an empty treeID has none
+func filesRepo(repo *core.Repository, treeID string) (map[string]staging.IndexEntry, error) {
+	index, err := staging.IndexFromTreeRepo(repo, treeID)
+	if err != nil {
+		return nil, core.ObjectError("failed to read tree", err)
+	}
+	files := make(map[string]staging.IndexEntry, len(index.Entries))
+	for _, entry := range index.Entries {
+		files[entry.FilePath] = entry
+	}
+	return files, nil
+}
+
+// sortedPaths returns the paths of the given file sets in order
+func sortedPaths(sets ...map[string]staging.IndexEntry) []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, set := range sets {
+		for p := range set {
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// sameFile reports whether two sides hold the same file, or both none
+func sameFile(a staging.IndexEntry, inA bool, b staging.IndexEntry, inB bool) bool {
+	return inA == inB && (!inA || a.SHA256 == b.SHA256 && a.Mode == b.Mode)
+}
+
+// pickRepo applies the changes commit made to its first parent on top of
+// the index and working tree, which match HEAD, returning the conflicting
+// paths
+func pickRepo(repo *core.Repository, commit *objects.Commit) ([]string, error) {
+	baseTree := ""
+	if len(commit.Parents) > 0 {
+		parent, err := objects.GetCommitRepo(repo, commit.Parents[0])
+		if err != nil {
+			return nil, core.ObjectError("failed to load parent commit", err)
+		}
+		baseTree = parent.Tree
+	}
+	return ApplyRepo(repo, baseTree, commit.Tree)
+}
+
+// ApplyRepo applies the changes from baseTree to theirTree on top of the
+// index and working tree, which match HEAD. Paths changed on both sides are
+// merged line by line; those that can't be are left with conflict markers
+// and their base, HEAD and theirTree versions at stages 1, 2 and 3. The
+// conflicting paths are returned.
+func ApplyRepo(repo *core.Repository, baseTree, theirTree string) ([]string, error) {
+	head, err := repo.ReadHead()
+	if err != nil {
+		return nil, core.RefError("failed to read HEAD", err)
+	}
+	headCommit, err := objects.GetCommitRepo(repo, head)
+	if err != nil {
+		return nil, core.ObjectError("failed to load HEAD commit", err)
+	}
+
+	base, err := filesRepo(repo, baseTree)
+	if err != nil {
+		return nil, err
+	}
+	ours, err := filesRepo(repo, headCommit.Tree)
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := filesRepo(repo, theirTree)
+	if err != nil {
+		return nil, err
+	}
+	index, err := staging.LoadIndex(repo)
+	if err != nil {
+		return nil, core.IndexError("failed to load index", err)
+	}
+	perms, err := repo.Permissions()
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []string
+	for _, relPath := range sortedPaths(base, ours, theirs) {
+		baseEntry, inBase := base[relPath]
+		ourEntry, inOurs := ours[relPath]
+		theirEntry, inTheirs := theirs[relPath]
+		absPath := filepath.Join(repo.Root, relPath)
+
+		switch {
+		case sameFile(baseEntry, inBase, theirEntry, inTheirs), sameFile(ourEntry, inOurs, theirEntry, inTheirs):
+			// Unchanged on their side, or already as they made it
+		case sameFile(baseEntry, inBase, ourEntry, inOurs):
+			// Only changed on their side
+			if !inTheirs {
+				if err := os.Remove(absPath); err != nil && !os.IsNotExist(err) {
+					return nil, core.FSError(fmt.Sprintf("failed to remove '%s'", relPath), err)
+				}
+				index.RemoveEntry(relPath, 0)
+				continue
+			}
+			if err := perms.MkdirAll(filepath.Dir(absPath)); err != nil {
+				return nil, err
+			}
+			if err := objects.WriteBlobFileRepo(repo, theirEntry.SHA256, absPath, theirEntry.Mode == objects.ModeExecutable); err != nil {
+				return nil, core.FSError(fmt.Sprintf("failed to write '%s'", relPath), err)
+			}
+			if err := stageRepo(repo, index, theirEntry); err != nil {
+				return nil, err
+			}
+		default:
+			merged, clean, err := mergeFileRepo(repo, baseEntry, inBase, ourEntry, inOurs, theirEntry, inTheirs)
+			if err != nil {
+				return nil, err
+			}
+			if clean {
+				hash, err := objects.CreateBlobRepo(repo, merged)
+				if err != nil {
+					return nil, core.ObjectError(fmt.Sprintf("failed to store '%s'", relPath), err)
+				}
+				if err := perms.WriteFile(absPath, merged); err != nil {
+					return nil, core.FSError(fmt.Sprintf("failed to write '%s'", relPath), err)
+				}
+				mode := theirEntry.Mode
+				if mode == baseEntry.Mode {
+					mode = ourEntry.Mode
+				}
+				if err := stageRepo(repo, index, staging.IndexEntry{Mode: mode, FilePath: relPath, SHA256: hash}); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if merged != nil {
+				if err := perms.WriteFile(absPath, merged); err != nil {
+					return nil, core.FSError(fmt.Sprintf("failed to write '%s'", relPath), err)
+				}
+			} else if !inOurs {
+				// Deleted in HEAD: leave their version to resolve against
+				if err := perms.MkdirAll(filepath.Dir(absPath)); err != nil {
+					return nil, err
+				}
+				if err := objects.WriteBlobFileRepo(repo, theirEntry.SHA256, absPath, theirEntry.Mode == objects.ModeExecutable); err != nil {
+					return nil, core.FSError(fmt.Sprintf("failed to write '%s'", relPath), err)
+				}
+			}
+			index.RemoveEntry(relPath, 0)
+			sides := []struct {
+				entry staging.IndexEntry
+				ok    bool
+			}{{baseEntry, inBase}, {ourEntry, inOurs}, {theirEntry, inTheirs}}
+			for i, side := range sides {
+				if side.ok {
+					if err := index.AddConflictEntry(relPath, side.entry.SHA256, side.entry.Mode, i+1); err != nil {
+						return nil, core.IndexError(fmt.Sprintf("failed to record conflict in '%s'", relPath), err)
+					}
+				}
+			}
+			conflicts = append(conflicts, relPath)
+		}
+	}
+
+	if err := index.Write(); err != nil {
+		return nil, core.IndexError("failed to write index", err)
+	}
+	return conflicts, nil
+}
+
+// mergeFileRepo merges a path changed both in HEAD and on their side. Only
+// text present on all three sides is merged; otherwise, as for binary
+// files, the result is nil and a conflict.
+func mergeFileRepo(repo *core.Repository, base staging.IndexEntry, inBase bool, ours staging.IndexEntry, inOurs bool, theirs staging.IndexEntry, inTheirs bool) ([]byte, bool, error) {
+	if !inBase || !inOurs || !inTheirs {
+		return nil, false, nil
+	}
+	var contents [3][]byte
+	for i, entry := range []staging.IndexEntry{base, ours, theirs} {
+		content, err := objects.GetBlobRepo(repo, entry.SHA256)
+		if err != nil {
+			return nil, false, core.ObjectError(fmt.Sprintf("failed to read '%s'", entry.FilePath), err)
+		}
+		if bytes.IndexByte(content, 0) >= 0 {
+			return nil, false, nil
+		}
+		contents[i] = content
+	}
+	merged, conflicts := merge.MergeText(string(contents[0]), string(contents[1]), string(contents[2]))
+	return []byte(merged), !conflicts, nil
+}
+
+// stageRepo records entry at stage 0 with the size and time of its file,
+// so the working tree reads as unmodified
+func stageRepo(repo *core.Repository, index *staging.Index, entry staging.IndexEntry) error {
+	info, err := os.Stat(filepath.Join(repo.Root, entry.FilePath))
+	if err != nil {
+		return core.FSError(fmt.Sprintf("failed to stat '%s'", entry.FilePath), err)
+	}
+	entry.Stage = 0
+	entry.Size, entry.Mtime = info.Size(), info.ModTime()
+	index.AddEntry(entry)
+	return nil
+}
+
+// resetRepo makes the index and the tracked files match treeID, removing
+// files tracked now but not in it; untracked files are left alone
+func resetRepo(repo *core.Repository, treeID string) error {
+	index, err := staging.LoadIndex(repo)
+	if err != nil {
+		return core.IndexError("failed to load index", err)
+	}
+	target, err := filesRepo(repo, treeID)
+	if err != nil {
+		return err
+	}
+	for _, entry := range index.Entries {
+		if _, ok := target[entry.FilePath]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(repo.Root, entry.FilePath)); err != nil && !os.IsNotExist(err) {
+			return core.FSError(fmt.Sprintf("failed to remove '%s'", entry.FilePath), err)
+		}
+	}
+
+	perms, err := repo.Permissions()
+	if err != nil {
+		return err
+	}
+	reset := staging.NewIndex(repo)
+	for _, relPath := range sortedPaths(target) {
+		entry := target[relPath]
+		absPath := filepath.Join(repo.Root, relPath)
+		if content, err := os.ReadFile(absPath); err != nil || utils.HashBytes("blob", content) != entry.SHA256 {
+			if err := perms.MkdirAll(filepath.Dir(absPath)); err != nil {
+				return err
+			}
+			if err := objects.WriteBlobFileRepo(repo, entry.SHA256, absPath, entry.Mode == objects.ModeExecutable); err != nil {
+				return core.FSError(fmt.Sprintf("failed to write '%s'", relPath), err)
+			}
+		}
+		if err := stageRepo(repo, reset, entry); err != nil {
+			return err
+		}
+	}
+	if err := reset.Write(); err != nil {
+		return core.IndexError("failed to write index", err)
+	}
+	return nil
+}
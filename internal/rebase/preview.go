@@ -0,0 +1,90 @@
+package rebase
+
+import (
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/merge"
+	"github.com/NahomAnteneh/vec/internal/objects"
+)
+
+// PreviewRepo works out what StartRepo would do with options, replaying the
+// todo list in memory. A step predicted to conflict is assumed resolved in
+// favour of the commit for the steps after it.
+func PreviewRepo(repo *core.Repository, options Options) (*merge.Plan, error) {
+	head, err := repo.ReadHead()
+	if err != nil {
+		return nil, core.RefError("failed to read HEAD", err)
+	}
+	if head == "" {
+		return nil, core.RepositoryError("cannot rebase before the first commit", nil)
+	}
+	onto := options.Onto
+	if onto == "" {
+		onto = options.Upstream
+	}
+	plan := &merge.Plan{Operation: "rebase", Outcome: merge.PlanRebase, Head: head, Target: onto, Steps: []merge.PlanStep{}, RefUpdates: []merge.PlanRefUpdate{}}
+
+	steps := options.Todo
+	if steps == nil {
+		if steps, err = PlanRepo(repo, head, options.Upstream); err != nil {
+			return nil, err
+		}
+		if upToDate, err := objects.IsAncestorRepo(repo, onto, head); err != nil {
+			return nil, core.ObjectError("failed to compare histories", err)
+		} else if upToDate && (len(steps) == 0 || firstParent(repo, steps[0].Commit) == onto) {
+			plan.Outcome = merge.PlanUpToDate
+			return plan, nil
+		}
+	}
+
+	ontoCommit, err := objects.GetCommitRepo(repo, onto)
+	if err != nil {
+		return nil, core.ObjectError("failed to load commit to rebase onto", err)
+	}
+	state, err := merge.TreeFilesRepo(repo, ontoCommit.Tree)
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range steps {
+		planned := merge.PlanStep{Action: string(step.Action), Commit: step.Commit, Subject: step.Subject}
+		if step.Action == ActionDrop {
+			plan.Steps = append(plan.Steps, planned)
+			continue
+		}
+		commit, err := objects.GetCommitRepo(repo, step.Commit)
+		if err != nil {
+			return nil, core.ObjectError("failed to load commit to replay", err)
+		}
+		planned.Subject = commit.Subject()
+		baseTree := ""
+		if len(commit.Parents) > 0 {
+			parent, err := objects.GetCommitRepo(repo, commit.Parents[0])
+			if err != nil {
+				return nil, core.ObjectError("failed to load parent commit", err)
+			}
+			baseTree = parent.Tree
+		}
+		base, err := merge.TreeFilesRepo(repo, baseTree)
+		if err != nil {
+			return nil, err
+		}
+		theirs, err := merge.TreeFilesRepo(repo, commit.Tree)
+		if err != nil {
+			return nil, err
+		}
+		result, conflicts, err := merge.MergeTreeRepo(repo, base, state, theirs)
+		if err != nil {
+			return nil, err
+		}
+		planned.Conflicts = conflicts
+		planned.Empty = step.Action != ActionSquash && len(conflicts) == 0 && result.Equal(state)
+		state = result
+		plan.Steps = append(plan.Steps, planned)
+	}
+
+	ref := core.HeadFile
+	if branch, err := repo.GetCurrentBranch(); err == nil && branch != "(HEAD detached)" {
+		ref = "refs/heads/" + branch
+	}
+	plan.RefUpdates = append(plan.RefUpdates, merge.PlanRefUpdate{Ref: ref, Old: head})
+	return plan, nil
+}
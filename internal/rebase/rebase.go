@@ -0,0 +1,386 @@
+// Package rebase replays commits onto another base.
+//
+// The commits to replay form a todo list of steps, each picking, rewording,
+// squashing or dropping one commit. Steps run in order on a detached HEAD;
+// one whose changes conflict stops the rebase, with the conflicts recorded
+// in the index at stages 1, 2 and 3, until they are resolved and staged. The
+// state lives in .vec/rebase-merge, and the rebased branch only moves once
+// every step has run.
+package rebase
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/staging"
+)
+
+// Editor edits the message of a reworded or squashed commit; a nil Editor
+// keeps messages as they are
+type Editor func(message string) (string, error)
+
+// Options controls a new rebase
+type Options struct {
+	Upstream string // Commits reachable from it are not replayed
+	Onto     string // Commit to replay onto; Upstream when empty
+	Todo     []Step // Steps to run instead of picking every commit, as edited in interactive mode
+}
+
+// Result reports where a run of the todo list ended
+type Result struct {
+	Head      string   // HEAD after the run
+	Finished  bool     // Every step ran and the branch was moved
+	UpToDate  bool     // Nothing needed replaying
+	Stopped   *Step    // Step waiting for its conflicts to be resolved
+	Conflicts []string // Conflicting paths of the stopped step
+	Empty     []Step   // Steps left out because HEAD already had their changes
+}
+
+// PlanRepo returns steps picking, oldest first, the commits reachable from
+// head but not from upstream. Merge commits are left out: the replayed
+// history is linear.
+func PlanRepo(repo *core.Repository, head, upstream string) ([]Step, error) {
+	excluded := make(map[string]bool)
+	err := objects.WalkAncestorsRepo(repo, []string{upstream}, func(c *objects.Commit) (bool, error) {
+		excluded[c.CommitID] = true
+		return false, nil
+	})
+	if err != nil {
+		return nil, core.ObjectError("failed to walk upstream history", err)
+	}
+	commits, err := objects.TopoSortRepo(repo, []string{head})
+	if err != nil {
+		return nil, core.ObjectError("failed to walk history", err)
+	}
+
+	var steps []Step
+	for i := len(commits) - 1; i >= 0; i-- {
+		c := commits[i]
+		if excluded[c.CommitID] || len(c.Parents) > 1 {
+			continue
+		}
+		steps = append(steps, Step{Action: ActionPick, Commit: c.CommitID, Subject: c.Subject()})
+	}
+	return steps, nil
+}
+
+// StartRepo begins rebasing HEAD and runs the todo list until it finishes
+// or a step conflicts
+func StartRepo(repo *core.Repository, options Options, edit Editor) (*Result, error) {
+	if InProgress(repo) {
+		return nil, core.RepositoryError("a rebase is already in progress; use --continue, --skip or --abort", nil)
+	}
+	head, err := repo.ReadHead()
+	if err != nil {
+		return nil, core.RefError("failed to read HEAD", err)
+	}
+	if head == "" {
+		return nil, core.RepositoryError("cannot rebase before the first commit", nil)
+	}
+	index, err := staging.LoadIndex(repo)
+	if err != nil {
+		return nil, core.IndexError("failed to load index", err)
+	}
+	if index.HasConflicts() || index.HasUncommittedChanges(repo) {
+		return nil, core.RepositoryError("cannot rebase: you have uncommitted changes; commit or stash them", nil)
+	}
+
+	onto := options.Onto
+	if onto == "" {
+		onto = options.Upstream
+	}
+	steps := options.Todo
+	if steps == nil {
+		if steps, err = PlanRepo(repo, head, options.Upstream); err != nil {
+			return nil, err
+		}
+		// Already on top of onto: replaying would change nothing
+		if upToDate, err := objects.IsAncestorRepo(repo, onto, head); err != nil {
+			return nil, core.ObjectError("failed to compare histories", err)
+		} else if upToDate && (len(steps) == 0 || firstParent(repo, steps[0].Commit) == onto) {
+			return &Result{Head: head, Finished: true, UpToDate: true}, nil
+		}
+	}
+
+	branch, err := repo.GetCurrentBranch()
+	if err != nil {
+		return nil, core.RefError("failed to determine current branch", err)
+	}
+	state := &State{OrigHead: head, Onto: onto, Todo: steps}
+	if branch != "(HEAD detached)" {
+		state.HeadName = "refs/heads/" + branch
+	}
+
+	ontoCommit, err := objects.GetCommitRepo(repo, onto)
+	if err != nil {
+		return nil, core.ObjectError("failed to load commit to rebase onto", err)
+	}
+	if err := state.save(repo); err != nil {
+		return nil, err
+	}
+	if err := repo.WriteOrigHead(head); err != nil {
+		return nil, err
+	}
+	if err := resetRepo(repo, ontoCommit.Tree); err != nil {
+		return nil, err
+	}
+	if err := moveHeadRepo(repo, head, onto, "rebase (start): checkout "+shortID(onto)); err != nil {
+		return nil, err
+	}
+	return runRepo(repo, state, edit)
+}
+
+// ContinueRepo commits the resolved changes of the stopped step and runs
+// the rest of the todo list
+func ContinueRepo(repo *core.Repository, edit Editor) (*Result, error) {
+	state, err := LoadState(repo)
+	if err != nil {
+		return nil, err
+	}
+	index, err := staging.LoadIndex(repo)
+	if err != nil {
+		return nil, core.IndexError("failed to load index", err)
+	}
+	if index.HasConflicts() {
+		return nil, core.IndexError("you must resolve the conflicts and stage them with 'vec add' before continuing", nil)
+	}
+
+	result := &Result{}
+	if state.Stopped != "" && len(state.Todo) > 0 {
+		step := state.Todo[0]
+		commit, err := objects.GetCommitRepo(repo, state.Stopped)
+		if err != nil {
+			return nil, core.ObjectError(fmt.Sprintf("failed to load commit %s", state.Stopped), err)
+		}
+		empty, err := commitStepRepo(repo, step, commit, edit)
+		if err != nil {
+			return nil, err
+		}
+		if empty {
+			result.Empty = append(result.Empty, step)
+		}
+		state.advance()
+		if err := state.save(repo); err != nil {
+			return nil, err
+		}
+	}
+	return runStepsRepo(repo, state, edit, result)
+}
+
+// SkipRepo drops the changes of the stopped step and runs the rest of the
+// todo list
+func SkipRepo(repo *core.Repository, edit Editor) (*Result, error) {
+	state, err := LoadState(repo)
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.ReadHead()
+	if err != nil {
+		return nil, core.RefError("failed to read HEAD", err)
+	}
+	headCommit, err := objects.GetCommitRepo(repo, head)
+	if err != nil {
+		return nil, core.ObjectError("failed to load HEAD commit", err)
+	}
+	if err := resetRepo(repo, headCommit.Tree); err != nil {
+		return nil, err
+	}
+	if len(state.Todo) > 0 {
+		state.advance()
+	}
+	if err := state.save(repo); err != nil {
+		return nil, err
+	}
+	return runRepo(repo, state, edit)
+}
+
+// AbortRepo stops the rebase and puts HEAD, the index and the working tree
+// back as they were before it started
+func AbortRepo(repo *core.Repository) error {
+	state, err := LoadState(repo)
+	if err != nil {
+		return err
+	}
+	orig, err := objects.GetCommitRepo(repo, state.OrigHead)
+	if err != nil {
+		return core.ObjectError("failed to load original HEAD", err)
+	}
+	head, err := repo.ReadHead()
+	if err != nil {
+		return core.RefError("failed to read HEAD", err)
+	}
+	if err := resetRepo(repo, orig.Tree); err != nil {
+		return err
+	}
+	if state.HeadName != "" {
+		if err := repo.UpdateHead(state.HeadName, true); err != nil {
+			return err
+		}
+	} else if err := repo.UpdateHead(state.OrigHead, false); err != nil {
+		return err
+	}
+	if err := core.AppendRefReflog(repo.Root, core.HeadFile, head, state.OrigHead, "rebase (abort): returning to "+headLabel(state)); err != nil {
+		return err
+	}
+	return state.remove(repo)
+}
+
+// runRepo runs the todo list from its current step
+func runRepo(repo *core.Repository, state *State, edit Editor) (*Result, error) {
+	return runStepsRepo(repo, state, edit, &Result{})
+}
+
+// runStepsRepo runs the remaining steps into result, saving the state after
+// each, and finishes the rebase once none are left
+func runStepsRepo(repo *core.Repository, state *State, edit Editor, result *Result) (*Result, error) {
+	for len(state.Todo) > 0 {
+		step := state.Todo[0]
+		if step.Action != ActionDrop {
+			head, err := repo.ReadHead()
+			if err != nil {
+				return nil, core.RefError("failed to read HEAD", err)
+			}
+			if step.Action == ActionSquash && head == state.Onto {
+				return nil, core.RepositoryError(fmt.Sprintf("cannot squash %s without a previous commit", shortID(step.Commit)), nil)
+			}
+			commit, err := objects.GetCommitRepo(repo, step.Commit)
+			if err != nil {
+				return nil, core.ObjectError(fmt.Sprintf("failed to load commit %s", step.Commit), err)
+			}
+			conflicts, err := pickRepo(repo, commit)
+			if err != nil {
+				return nil, err
+			}
+			state.Stopped = step.Commit
+			if err := state.save(repo); err != nil {
+				return nil, err
+			}
+			if len(conflicts) > 0 {
+				result.Head, result.Stopped, result.Conflicts = head, &step, conflicts
+				return result, nil
+			}
+			empty, err := commitStepRepo(repo, step, commit, edit)
+			if err != nil {
+				return nil, err
+			}
+			if empty {
+				result.Empty = append(result.Empty, step)
+			}
+		}
+		state.advance()
+		if err := state.save(repo); err != nil {
+			return nil, err
+		}
+	}
+	return finishRepo(repo, state, result)
+}
+
+// commitStepRepo commits the index as the result of step, which replays
+// commit, and reports true instead when a pick would change nothing
+func commitStepRepo(repo *core.Repository, step Step, commit *objects.Commit, edit Editor) (bool, error) {
+	index, err := staging.LoadIndex(repo)
+	if err != nil {
+		return false, core.IndexError("failed to load index", err)
+	}
+	tree, err := staging.CreateTreeFromIndex(repo, index)
+	if err != nil {
+		return false, core.ObjectError("failed to write tree", err)
+	}
+	head, err := repo.ReadHead()
+	if err != nil {
+		return false, core.RefError("failed to read HEAD", err)
+	}
+	headCommit, err := objects.GetCommitRepo(repo, head)
+	if err != nil {
+		return false, core.ObjectError("failed to load HEAD commit", err)
+	}
+	committerName, committerEmail, err := core.ResolveIdentity(repo.Root, core.IdentityCommitter)
+	if err != nil {
+		return false, err
+	}
+	committer := fmt.Sprintf("%s <%s>", committerName.Value, committerEmail.Value)
+
+	var replayed string
+	switch step.Action {
+	case ActionSquash:
+		// The squashed commit keeps the author of the one it is folded into
+		message := strings.TrimSpace(headCommit.Message) + "\n\n" + strings.TrimSpace(commit.Message)
+		if edit != nil {
+			if message, err = edit(message); err != nil {
+				return false, err
+			}
+		}
+		replayed, err = objects.RewriteCommitRepo(repo, headCommit, tree, headCommit.StoredParents(), committer, message, false)
+	default:
+		if tree == headCommit.Tree {
+			return true, nil
+		}
+		message := commit.Message
+		if step.Action == ActionReword && edit != nil {
+			if message, err = edit(message); err != nil {
+				return false, err
+			}
+		}
+		replayed, err = objects.RewriteCommitRepo(repo, commit, tree, []string{head}, committer, message, false)
+	}
+	if err != nil {
+		return false, core.ObjectError(fmt.Sprintf("failed to replay %s", shortID(commit.CommitID)), err)
+	}
+	return false, moveHeadRepo(repo, head, replayed, fmt.Sprintf("rebase (%s): %s", step.Action, commit.Subject()))
+}
+
+// finishRepo moves the rebased branch to HEAD, attaches HEAD to it again and
+// removes the state
+func finishRepo(repo *core.Repository, state *State, result *Result) (*Result, error) {
+	head, err := repo.ReadHead()
+	if err != nil {
+		return nil, core.RefError("failed to read HEAD", err)
+	}
+	if state.HeadName != "" {
+		if err := repo.UpdateRefCAS(state.HeadName, state.OrigHead, head); err != nil {
+			return nil, core.RefError(fmt.Sprintf("failed to update %s; it moved during the rebase", state.HeadName), err)
+		}
+		if err := repo.UpdateHead(state.HeadName, true); err != nil {
+			return nil, err
+		}
+		message := fmt.Sprintf("rebase (finish): %s onto %s", state.HeadName, state.Onto)
+		if err := repo.AppendReflog(strings.TrimPrefix(state.HeadName, "refs/heads/"), state.OrigHead, head, message); err != nil {
+			return nil, err
+		}
+		if err := repo.RecordRefMove(state.HeadName, state.OrigHead, head, message); err != nil {
+			return nil, err
+		}
+	}
+	if err := state.remove(repo); err != nil {
+		return nil, err
+	}
+	result.Head, result.Finished = head, true
+	return result, nil
+}
+
+// moveHeadRepo points the detached HEAD at commit and logs the move
+func moveHeadRepo(repo *core.Repository, old, commit, message string) error {
+	if err := repo.UpdateHead(commit, false); err != nil {
+		return err
+	}
+	return core.AppendRefReflog(repo.Root, core.HeadFile, old, commit, message)
+}
+
+// firstParent returns the first parent of commit, or "" when it can't be read
+func firstParent(repo *core.Repository, commit string) string {
+	c, err := objects.GetCommitRepo(repo, commit)
+	if err != nil || len(c.Parents) == 0 {
+		return ""
+	}
+	return c.Parents[0]
+}
+
+// headLabel names what HEAD was on before the rebase
+func headLabel(state *State) string {
+	if state.HeadName != "" {
+		return state.HeadName
+	}
+	return shortID(state.OrigHead)
+}
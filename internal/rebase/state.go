@@ -0,0 +1,221 @@
+package rebase
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// StateDir holds the state of a rebase in progress, below .vec
+const StateDir = "rebase-merge"
+
+// Action is what a todo line does with its commit
+type Action string
+
+const (
+	ActionPick   Action = "pick"   // Replay the commit
+	ActionReword Action = "reword" // Replay the commit and edit its message
+	ActionSquash Action = "squash" // Fold the commit into the one before, joining the messages
+	ActionDrop   Action = "drop"   // Leave the commit out
+)
+
+// actionNames maps the names and abbreviations accepted in a todo list to
+// their action
+var actionNames = map[string]Action{
+	"pick": ActionPick, "p": ActionPick,
+	"reword": ActionReword, "r": ActionReword,
+	"squash": ActionSquash, "s": ActionSquash,
+	"drop": ActionDrop, "d": ActionDrop,
+}
+
+// Step is one line of the todo list
+type Step struct {
+	Action  Action
+	Commit  string
+	Subject string // Only for display
+}
+
+// String renders the step as a todo line
+func (s Step) String() string {
+	return strings.TrimSpace(fmt.Sprintf("%s %s %s", s.Action, s.Commit, s.Subject))
+}
+
+// State is a rebase in progress
+type State struct {
+	HeadName string // Branch being rebased, as refs/heads/<name>; empty on a detached HEAD
+	OrigHead string // Commit HEAD was at before the rebase
+	Onto     string // Commit the steps are replayed onto
+	Todo     []Step // Steps still to run, the first being the current one
+	Done     []Step // Steps already run
+	Stopped  string // Commit of the current step once applied, waiting for --continue
+}
+
+// statePath returns the path of name in the state directory
+func statePath(repo *core.Repository, name string) string {
+	return filepath.Join(repo.VecDir, StateDir, name)
+}
+
+// InProgress reports whether a rebase is in progress
+func InProgress(repo *core.Repository) bool {
+	return core.FileExists(statePath(repo, "onto"))
+}
+
+// LoadState reads the rebase in progress
+func LoadState(repo *core.Repository) (*State, error) {
+	if !InProgress(repo) {
+		return nil, core.RepositoryError("no rebase in progress", nil)
+	}
+	read := func(name string) (string, error) {
+		data, err := os.ReadFile(statePath(repo, name))
+		if os.IsNotExist(err) {
+			return "", nil
+		} else if err != nil {
+			return "", core.FSError("failed to read rebase state", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	state := &State{}
+	fields := map[string]*string{"head-name": &state.HeadName, "orig-head": &state.OrigHead, "onto": &state.Onto, "stopped-sha": &state.Stopped}
+	for name, field := range fields {
+		value, err := read(name)
+		if err != nil {
+			return nil, err
+		}
+		*field = value
+	}
+	for name, steps := range map[string]*[]Step{"todo": &state.Todo, "done": &state.Done} {
+		text, err := read(name)
+		if err != nil {
+			return nil, err
+		}
+		if *steps, err = parseSteps(text); err != nil {
+			return nil, core.RepositoryError(fmt.Sprintf("corrupt rebase state in %s", name), err)
+		}
+	}
+	return state, nil
+}
+
+// save writes the state to .vec/rebase-merge
+func (s *State) save(repo *core.Repository) error {
+	perms, err := repo.Permissions()
+	if err != nil {
+		return err
+	}
+	if err := perms.MkdirAll(filepath.Join(repo.VecDir, StateDir)); err != nil {
+		return core.FSError("failed to create rebase state", err)
+	}
+	files := map[string]string{
+		"head-name":   s.HeadName,
+		"orig-head":   s.OrigHead,
+		"onto":        s.Onto,
+		"stopped-sha": s.Stopped,
+		"todo":        formatSteps(s.Todo),
+		"done":        formatSteps(s.Done),
+	}
+	for name, content := range files {
+		if err := perms.WriteFile(statePath(repo, name), []byte(content)); err != nil {
+			return core.FSError("failed to write rebase state", err)
+		}
+	}
+	return nil
+}
+
+// remove deletes the rebase state
+func (s *State) remove(repo *core.Repository) error {
+	if err := os.RemoveAll(filepath.Join(repo.VecDir, StateDir)); err != nil {
+		return core.FSError("failed to remove rebase state", err)
+	}
+	return nil
+}
+
+// advance moves the current step to the done list
+func (s *State) advance() {
+	s.Done = append(s.Done, s.Todo[0])
+	s.Todo = s.Todo[1:]
+	s.Stopped = ""
+}
+
+// formatSteps renders steps as todo lines
+func formatSteps(steps []Step) string {
+	var b strings.Builder
+	for _, step := range steps {
+		b.WriteString(step.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// parseSteps reads todo lines as written by formatSteps
+func parseSteps(text string) ([]Step, error) {
+	var steps []Step
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		action, ok := actionNames[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown action '%s'", n+1, fields[0])
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: missing commit", n+1)
+		}
+		step := Step{Action: action, Commit: fields[1]}
+		if len(fields) == 3 {
+			step.Subject = strings.TrimSpace(fields[2])
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// FormatTodo renders steps as the todo list interactive mode opens in the
+// editor, with a summary of the actions
+func FormatTodo(steps []Step, onto string) string {
+	var b strings.Builder
+	b.WriteString(formatSteps(steps))
+	plural := "s"
+	if len(steps) == 1 {
+		plural = ""
+	}
+	fmt.Fprintf(&b, "\n# Rebase onto %s (%d command%s)\n", shortID(onto), len(steps), plural)
+	b.WriteString(`#
+# Commands:
+# p, pick <commit> = use commit
+# r, reword <commit> = use commit, but edit the commit message
+# s, squash <commit> = use commit, but meld into previous commit
+# d, drop <commit> = remove commit
+#
+# These lines can be re-ordered; they are executed from top to bottom.
+# Removing a line drops its commit; removing every line aborts the rebase.
+`)
+	return b.String()
+}
+
+// ParseTodo reads a todo list edited by the user, resolving each commit
+func ParseTodo(repo *core.Repository, text string) ([]Step, error) {
+	steps, err := parseSteps(text)
+	if err != nil {
+		return nil, core.RepositoryError("invalid todo list", err)
+	}
+	for i := range steps {
+		hash, err := repo.ResolveRevision(steps[i].Commit)
+		if err != nil {
+			return nil, core.RefError(fmt.Sprintf("invalid todo list: unknown commit '%s'", steps[i].Commit), err)
+		}
+		steps[i].Commit = hash
+	}
+	return steps, nil
+}
+
+func shortID(id string) string {
+	if len(id) > 7 {
+		return id[:7]
+	}
+	return id
+}
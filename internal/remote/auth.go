@@ -1,108 +1,45 @@
 package remote
 
 import (
-	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
+	"github.com/NahomAnteneh/vec/internal/config"
+	vechttp "github.com/NahomAnteneh/vec/internal/remote/http"
+	"github.com/NahomAnteneh/vec/utils"
 )
 
-// StoreCredentials saves credentials for a remote in the credentials file
-func StoreCredentials(remoteName, username, password string) error {
-	homeDir, err := os.UserHomeDir()
+// StoreCredentials saves credentials for a remote with the credential.helper
+// of cfg; by default in the credentials file, keyed by the host of its URL so
+// remotes of the same name in other repositories don't share them.
+func StoreCredentials(cfg *config.Config, remoteName, remoteURL, username, password string) error {
+	helper, err := vechttp.OpenCredentialHelper(cfg, remoteName)
 	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
-	}
-
-	vecDir := filepath.Join(homeDir, ".vec")
-	if err := os.MkdirAll(vecDir, 0755); err != nil {
-		return fmt.Errorf("failed to create .vec directory: %w", err)
-	}
-
-	credsPath := filepath.Join(vecDir, "credentials")
-
-	// Read existing credentials file
-	var lines []string
-	if _, err := os.Stat(credsPath); err == nil {
-		credsData, err := os.ReadFile(credsPath)
-		if err != nil {
-			return fmt.Errorf("failed to read credentials file: %w", err)
-		}
-		lines = strings.Split(string(credsData), "\n")
-	} else {
-		// Create a new file with header
-		lines = []string{
-			"# Vec credentials file - DO NOT SHARE",
-			"# Format: remote.{name}.username=value",
-			"# Format: remote.{name}.password=value",
-			"",
-		}
+		return err
 	}
+	return helper.Store(remoteURL, vechttp.Credential{Username: username, Password: password})
+}
 
-	// Update or add credentials
-	userFound, passFound := false, false
-	for i, line := range lines {
-		if strings.HasPrefix(line, fmt.Sprintf("remote.%s.username=", remoteName)) {
-			lines[i] = fmt.Sprintf("remote.%s.username=%s", remoteName, username)
-			userFound = true
-		}
-		if strings.HasPrefix(line, fmt.Sprintf("remote.%s.password=", remoteName)) {
-			lines[i] = fmt.Sprintf("remote.%s.password=%s", remoteName, password)
-			passFound = true
+// StoreAuthToken saves a bearer token for a remote of the current repository
+// with its credential helper. An empty token removes the stored credentials.
+func StoreAuthToken(remoteName, token string) error {
+	remoteURL := ""
+	var cfg *config.Config
+	if repoRoot, err := utils.GetVecRoot(); err == nil {
+		if cfg, err = config.LoadConfig(repoRoot); err == nil {
+			remoteURL, _ = cfg.GetRemoteURL(remoteName)
 		}
 	}
 
-	// Add new entries if not found
-	if !userFound {
-		lines = append(lines, fmt.Sprintf("remote.%s.username=%s", remoteName, username))
-	}
-	if !passFound {
-		lines = append(lines, fmt.Sprintf("remote.%s.password=%s", remoteName, password))
+	helper, err := vechttp.OpenCredentialHelper(cfg, remoteName)
+	if err != nil {
+		return err
 	}
-
-	// Write back to file
-	content := strings.Join(lines, "\n")
-	if err := os.WriteFile(credsPath, []byte(content), 0600); err != nil {
-		return fmt.Errorf("failed to write credentials file: %w", err)
+	if token == "" {
+		return helper.Erase(remoteURL)
 	}
-
-	return nil
+	return helper.Store(remoteURL, vechttp.Credential{Token: token})
 }
 
-// ClearCredentials removes credentials for a remote
+// ClearCredentials removes credentials stored under a remote's name. Host
+// scoped credentials may be shared with other remotes and are kept.
 func ClearCredentials(remoteName string) error {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
-	}
-
-	credsPath := filepath.Join(homeDir, ".vec", "credentials")
-	if _, err := os.Stat(credsPath); os.IsNotExist(err) {
-		// No credentials file, nothing to clear
-		return nil
-	}
-
-	credsData, err := os.ReadFile(credsPath)
-	if err != nil {
-		return fmt.Errorf("failed to read credentials file: %w", err)
-	}
-
-	lines := strings.Split(string(credsData), "\n")
-	var newLines []string
-	
-	// Filter out lines for the specified remote
-	for _, line := range lines {
-		if !strings.HasPrefix(line, fmt.Sprintf("remote.%s.username=", remoteName)) && 
-		   !strings.HasPrefix(line, fmt.Sprintf("remote.%s.password=", remoteName)) {
-			newLines = append(newLines, line)
-		}
-	}
-
-	// Write back to file
-	content := strings.Join(newLines, "\n")
-	if err := os.WriteFile(credsPath, []byte(content), 0600); err != nil {
-		return fmt.Errorf("failed to write credentials file: %w", err)
-	}
-
-	return nil
+	return vechttp.ClearCredential(vechttp.RemoteCredentialScope(remoteName))
 }
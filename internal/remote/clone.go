@@ -2,15 +2,17 @@
 package remote
 
 import (
-	"encoding/json"
 	"fmt"
-	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
-	"time"
 
+	"github.com/NahomAnteneh/vec/core"
 	"github.com/NahomAnteneh/vec/internal/config"
+	"github.com/NahomAnteneh/vec/internal/merge"
+	vechttp "github.com/NahomAnteneh/vec/internal/remote/http"
+	"github.com/NahomAnteneh/vec/internal/repository"
 )
 
 // CloneOptions contains all options for cloning a repository
@@ -25,11 +27,12 @@ type CloneOptions struct {
 	// Clone options
 	Branch     string // Specific branch to checkout (optional)
 	Depth      int    // Depth limit for shallow clones (0 means full clone)
-	Recursive  bool   // Whether to clone submodules recursively
+	Recursive  bool   // Whether to clone submodules recursively (not supported yet)
 	NoCheckout bool   // Skip checkout of HEAD after clone
 	Bare       bool   // Create a bare repository
 	Quiet      bool   // Suppress progress output
 	Progress   bool   // Show progress during clone
+	DryRun     bool   // Only report what would be cloned; nothing is written
 }
 
 // Clone initializes a new repository from a remote URL (original function for backward compatibility)
@@ -42,16 +45,22 @@ func Clone(url, destPath string, auth string) error {
 	})
 }
 
-// CloneWithOptions initializes a new repository from a remote URL with extended options
-func CloneWithOptions(opts CloneOptions) error {
-	// For backward compatibility
+// CloneWithOptions creates a repository in opts.DestPath with opts.URL as
+// its origin, fetches the branches and tags of origin and checks out its
+// default branch, or opts.Branch, set to track origin. A bare clone has the
+// branches of origin as its own and no working tree. A failed clone leaves
+// nothing behind.
+func CloneWithOptions(opts CloneOptions) (err error) {
 	if strings.TrimSpace(opts.URL) == "" || strings.TrimSpace(opts.DestPath) == "" {
 		return fmt.Errorf("URL and destination path are required")
 	}
-
-	url := opts.URL
-	destPath := opts.DestPath
-	auth := opts.Auth
+	if opts.DryRun {
+		return cloneDryRun(opts)
+	}
+	// Fail before creating anything when offline mode forbids the fetch
+	if err := checkRemoteOnline(config.NewConfig(opts.DestPath).RewriteURL(opts.URL)); err != nil {
+		return err
+	}
 
 	// Print progress if requested
 	logProgress := func(format string, args ...interface{}) {
@@ -60,326 +69,281 @@ func CloneWithOptions(opts CloneOptions) error {
 		}
 	}
 
-	// Create destination directory if it doesn't exist
-	if err := os.MkdirAll(destPath, 0755); err != nil {
-		return fmt.Errorf("failed to create destination directory: %w", err)
-	}
-
-	// Check if destination is empty
-	entries, err := os.ReadDir(destPath)
+	destPath, err := filepath.Abs(opts.DestPath)
 	if err != nil {
-		return fmt.Errorf("failed to read destination directory: %w", err)
-	}
-	if len(entries) > 0 {
-		return fmt.Errorf("destination directory is not empty")
+		return fmt.Errorf("invalid destination path: %w", err)
 	}
-
-	// Initialize repository
-	repoPath := filepath.Join(destPath, ".vec")
-	if err := os.MkdirAll(repoPath, 0755); err != nil {
-		return fmt.Errorf("failed to create repository directory: %w", err)
+	created, err := prepareCloneDest(destPath)
+	if err != nil {
+		return err
 	}
-
-	// Create required directories
-	logProgress("Creating repository structure...\n")
-	dirs := []string{"objects", "refs/heads", "refs/tags"}
-	if !opts.Bare {
-		dirs = append(dirs, "refs/remotes")
-	}
-	for _, dir := range dirs {
-		if err := os.MkdirAll(filepath.Join(repoPath, dir), 0755); err != nil {
-			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	defer func() {
+		if err != nil {
+			removeClone(destPath, created)
 		}
-	}
+	}()
 
-	// Set up default branch (main), unless specific branch is requested
-	defaultBranchName := "main"
-	if opts.Branch != "" {
-		defaultBranchName = opts.Branch
+	repo := core.NewRepository(destPath)
+	if err := repository.InitRepo(repo); err != nil {
+		return err
 	}
-
-	// Write HEAD file
-	headPath := filepath.Join(repoPath, "HEAD")
-	headRef := fmt.Sprintf("ref: refs/heads/%s\n", defaultBranchName)
 	if opts.Bare {
-		// In bare repos, we don't point HEAD to a branch
-		headRef = "" // Will be set later once we know the actual default branch
-	}
-	if err := os.WriteFile(headPath, []byte(headRef), 0644); err != nil {
-		return fmt.Errorf("failed to create HEAD file: %w", err)
+		if err := repo.SetConfig(core.BareKey, "true", false); err != nil {
+			return fmt.Errorf("failed to write %s: %w", core.BareKey, err)
+		}
 	}
 
 	// Set up config
 	logProgress("Configuring remote...\n")
-	cfg := config.NewConfig(destPath)
-
-	// Add remote as origin
-	remoteName := "origin"
-	err = cfg.AddRemote(remoteName, url)
+	cfg, err := config.LoadConfigRepo(repo)
 	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	remoteName := "origin"
+	if err := cfg.AddRemote(remoteName, opts.URL); err != nil {
 		return fmt.Errorf("failed to add remote: %w", err)
 	}
-
-	// Set authentication if provided
-	if auth != "" {
-		err = cfg.SetRemoteAuth(remoteName, auth)
-		if err != nil {
+	if opts.Auth != "" {
+		if err := cfg.SetRemoteAuth(remoteName, opts.Auth); err != nil {
 			return fmt.Errorf("failed to set authentication: %w", err)
 		}
 	}
-
-	// Save config
 	if err := cfg.Write(); err != nil {
 		return fmt.Errorf("failed to write config: %w", err)
 	}
 
-	// Fetch from remote
-	logProgress("Fetching remote repository...\n")
-	refs, err := fetchRemoteRefsForClone(url, remoteName, cfg)
+	transport, err := openTransport(cfg.RewriteURL(opts.URL), remoteName, cfg)
+	if err != nil {
+		return err
+	}
+	refs, err := transport.GetRefs()
 	if err != nil {
 		return fmt.Errorf("failed to fetch remote refs: %w", err)
 	}
-
-	if len(refs) == 0 {
-		logProgress("Remote repository is empty\n")
-		return nil
+	branch, err := cloneBranch(transport, refs, opts.Branch)
+	if err != nil {
+		return err
 	}
-
-	// Find main branch or another default branch
-	var defaultBranch string
-	var defaultCommit string
-
-	// If branch specified in options, try that first
-	if opts.Branch != "" {
-		branchRef := "refs/heads/" + opts.Branch
-		if commit, exists := refs[branchRef]; exists {
-			defaultBranch = opts.Branch
-			defaultCommit = commit
-		} else {
-			return fmt.Errorf("specified branch '%s' does not exist in the remote repository", opts.Branch)
-		}
-	} else {
-		// Otherwise try to find a default branch
-		// First try main
-		for ref, commit := range refs {
-			if ref == "refs/heads/main" {
-				defaultBranch = "main"
-				defaultCommit = commit
-				break
-			}
-		}
-
-		// If main not found, try master
-		if defaultBranch == "" {
-			for ref, commit := range refs {
-				if ref == "refs/heads/master" {
-					defaultBranch = "master"
-					defaultCommit = commit
-					break
-				}
-			}
-		}
-
-		// If neither main nor master, use first branch found
-		if defaultBranch == "" {
-			for ref, commit := range refs {
-				if strings.HasPrefix(ref, "refs/heads/") {
-					defaultBranch = strings.TrimPrefix(ref, "refs/heads/")
-					defaultCommit = commit
-					break
-				}
-			}
+	if branch == "" {
+		if !opts.Quiet {
+			fmt.Println("warning: You appear to have cloned an empty repository.")
 		}
+		return nil
 	}
 
-	if defaultBranch == "" {
-		return fmt.Errorf("no branches found in remote repository")
+	logProgress("Fetching objects...\n")
+	if err := FetchWithOptionsRepo(repo, remoteName, FetchOptions{
+		Quiet:    opts.Quiet,
+		Depth:    opts.Depth,
+		Progress: opts.Progress,
+	}); err != nil {
+		return err
 	}
 
-	// Set HEAD to point to default branch if it differs from our initial guess
-	if defaultBranch != defaultBranchName || opts.Bare {
-		headRef := fmt.Sprintf("ref: refs/heads/%s\n", defaultBranch)
-		if opts.Bare {
-			// For bare repos, head points directly to the commit
-			headRef = defaultCommit
-		}
-		if err := os.WriteFile(headPath, []byte(headRef), 0644); err != nil {
-			return fmt.Errorf("failed to update HEAD: %w", err)
+	if opts.Bare {
+		if err := adoptTrackingRefsRepo(repo, remoteName); err != nil {
+			return err
 		}
+		return repo.UpdateHead("refs/heads/"+branch, true)
 	}
 
-	// Fetch objects from remote
-	logProgress("Fetching objects...\n")
-
-	// Limit fetch depth if shallow clone requested
-	if opts.Depth > 0 {
-		logProgress("Creating shallow clone with depth %d...\n", opts.Depth)
-		// Here you would implement depth-limited fetching
-		// For now we'll just continue with normal fetching
+	commit, err := core.ReadRefValue(repo.Root, fmt.Sprintf("refs/remotes/%s/%s", remoteName, branch))
+	if err != nil {
+		return core.RefError(fmt.Sprintf("remote branch '%s' was not fetched", branch), err)
 	}
-
-	if err := fetchAndProcessPackfile(destPath, url, defaultCommit, refs, remoteName, cfg); err != nil {
-		return fmt.Errorf("failed to fetch objects: %w", err)
+	if err := repo.WriteRef("refs/heads/"+branch, commit); err != nil {
+		return fmt.Errorf("failed to create branch %s: %w", branch, err)
 	}
-
-	// Update local refs
-	logProgress("Setting up branch references...\n")
-	for ref, commit := range refs {
-		if strings.HasPrefix(ref, "refs/heads/") {
-			branchName := strings.TrimPrefix(ref, "refs/heads/")
-
-			// Create local branch ref
-			branchPath := filepath.Join(repoPath, "refs", "heads", branchName)
-			if err := os.WriteFile(branchPath, []byte(commit), 0644); err != nil {
-				return fmt.Errorf("failed to create branch %s: %w", branchName, err)
-			}
-
-			// Create remote tracking ref if not a bare repo
-			if !opts.Bare {
-				remoteBranchPath := filepath.Join(repoPath, "refs", "remotes", "origin", branchName)
-				if err := os.MkdirAll(filepath.Dir(remoteBranchPath), 0755); err != nil {
-					return fmt.Errorf("failed to create remote branch directory: %w", err)
-				}
-				if err := os.WriteFile(remoteBranchPath, []byte(commit), 0644); err != nil {
-					return fmt.Errorf("failed to create remote branch %s: %w", branchName, err)
-				}
-			}
-		}
+	if err := repo.SetBranchUpstream(branch, remoteName); err != nil {
+		return err
 	}
-
-	// Only checkout if we're not doing a bare repo and checkout is not disabled
-	if !opts.Bare && !opts.NoCheckout {
+	if err := repo.UpdateHead("refs/heads/"+branch, true); err != nil {
+		return err
+	}
+	if !opts.NoCheckout {
 		logProgress("Checking out files...\n")
-
-		// In a real implementation, you would use the proper checkout function
-		// For now we'll just create an empty checkout function
-		if err := checkoutWorkingTree(destPath, defaultCommit); err != nil {
+		if err := merge.CheckoutCommit(repo, commit); err != nil {
 			return fmt.Errorf("failed to checkout working tree: %w", err)
 		}
 	}
-
-	// Clone submodules if requested
-	if opts.Recursive {
-		logProgress("Initializing submodules...\n")
-		// Here you would implement submodule cloning
-		// We'll skip this for now as it's not yet implemented
+	if opts.Recursive && !opts.Quiet {
+		fmt.Println("warning: submodules are not supported; --recursive has no effect")
 	}
-
 	return nil
 }
 
-// checkoutWorkingTree checks out files to working directory
-func checkoutWorkingTree(repoPath, commitHash string) error {
-	// This is a simplified version - in a real implementation,
-	// you would properly extract files from the commit tree
-
-	// For now, just create a placeholder README.md
-	readmePath := filepath.Join(repoPath, "README.md")
-	content := fmt.Sprintf("# Repository\n\nThis repository was cloned with Vec.\nCommit: %s\n", commitHash)
-
-	return os.WriteFile(readmePath, []byte(content), 0644)
+// prepareCloneDest creates dest unless it is an empty directory already, and
+// reports whether it did
+func prepareCloneDest(dest string) (bool, error) {
+	entries, err := os.ReadDir(dest)
+	if err == nil {
+		if len(entries) > 0 {
+			return false, fmt.Errorf("destination path '%s' already exists and is not an empty directory", dest)
+		}
+		return false, nil
+	}
+	if !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read destination directory: %w", err)
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return false, fmt.Errorf("failed to create destination directory: %w", err)
+	}
+	return true, nil
 }
 
-// fetchAndProcessPackfile fetches objects from the remote
-func fetchAndProcessPackfile(repoPath, url, commit string, refs map[string]string, remoteName string, cfg *config.Config) error {
-	client := &http.Client{Timeout: 30 * time.Second}
-	packURL := fmt.Sprintf("%s/fetch", url)
-
-	// Create request with required objects
-	requestData := map[string]interface{}{
-		"want": []string{commit},
-		"have": []string{},
+// removeClone removes what a failed clone wrote into dest, and dest itself
+// when the clone created it
+func removeClone(dest string, created bool) {
+	if created {
+		os.RemoveAll(dest)
+		return
 	}
-
-	requestJSON, err := json.Marshal(requestData)
+	entries, err := os.ReadDir(dest)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return
 	}
-
-	req, err := http.NewRequest("POST", packURL, strings.NewReader(string(requestJSON)))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	for _, entry := range entries {
+		os.RemoveAll(filepath.Join(dest, entry.Name()))
 	}
-	req.Header.Set("Content-Type", "application/json")
-
-	// Add authentication headers if provided (but not required)
-	// applyAuthHeadersToRequest(req, remoteName, cfg)
+}
 
-	resp, err := client.Do(req)
+// adoptTrackingRefsRepo makes the remote-tracking branches of remoteName the
+// branches of a bare repository, which has no use for remote-tracking refs
+func adoptTrackingRefsRepo(repo *core.Repository, remoteName string) error {
+	prefix := fmt.Sprintf("refs/remotes/%s/", remoteName)
+	tracking, err := core.ListRefs(repo.Root, prefix)
 	if err != nil {
-		return fmt.Errorf("failed to fetch objects: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned status %d", resp.StatusCode)
+	for _, ref := range tracking {
+		name := strings.TrimPrefix(ref.Name, prefix)
+		// Only branches: HEAD and fetch bookkeeping aren't
+		if name == "HEAD" || name == core.FetchHeadFile || !core.IsValidHex(ref.Hash) {
+			continue
+		}
+		branch := "refs/heads/" + name
+		if err := repo.WriteRef(branch, ref.Hash); err != nil {
+			return fmt.Errorf("failed to create branch %s: %w", branch, err)
+		}
 	}
-
-	// Process the packfile
-	// In a real implementation, this would unpack the Git packfile format
-	var packfile map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&packfile); err != nil {
-		return fmt.Errorf("failed to decode packfile: %w", err)
-	}
-
-	// Extract and write objects
-	objectsData, ok := packfile["objects"].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("invalid packfile format")
+	if err := os.RemoveAll(filepath.Join(repo.VecDir, "refs", "remotes", remoteName)); err != nil {
+		return core.RefError("failed to remove remote-tracking refs", err)
 	}
+	return nil
+}
 
-	for hash, data := range objectsData {
-		objectData, ok := data.(string)
-		if !ok {
-			continue
+// cloneBranch returns the branch a clone checks out: requested, which refs
+// must have, or else the remote's default branch, else main, master or the
+// first branch by name. It is empty when the remote has no branches.
+func cloneBranch(t remoteTransport, refs map[string]string, requested string) (string, error) {
+	if requested != "" {
+		if _, ok := refs["refs/heads/"+requested]; !ok {
+			return "", core.RemoteError(fmt.Sprintf("specified branch '%s' does not exist in the remote repository", requested), nil)
 		}
+		return requested, nil
+	}
 
-		objectPath := filepath.Join(repoPath, ".vec", "objects", hash[:2], hash[2:])
-		if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
-			return fmt.Errorf("failed to create object directory: %w", err)
+	var branches []string
+	for ref := range refs {
+		if strings.HasPrefix(ref, "refs/heads/") {
+			branches = append(branches, strings.TrimPrefix(ref, "refs/heads/"))
 		}
+	}
+	if len(branches) == 0 {
+		return "", nil
+	}
+	sort.Strings(branches)
 
-		if err := os.WriteFile(objectPath, []byte(objectData), 0644); err != nil {
-			return fmt.Errorf("failed to write object %s: %w", hash, err)
+	candidates := []string{"main", "master"}
+	// Servers too old to describe the repository leave the guess to us
+	if info, err := t.GetInfo(); err == nil && info.DefaultBranch != "" {
+		candidates = append([]string{info.DefaultBranch}, candidates...)
+	}
+	for _, candidate := range candidates {
+		if _, ok := refs["refs/heads/"+candidate]; ok {
+			return candidate, nil
 		}
 	}
-
-	return nil
+	return branches[0], nil
 }
 
-// fetchRemoteRefsForClone retrieves the branch refs for cloning (no auth required)
-func fetchRemoteRefsForClone(remoteURL, remoteName string, cfg *config.Config) (map[string]string, error) {
-	url := fmt.Sprintf("%s/refs/heads", remoteURL)
-	client := &http.Client{Timeout: 10 * time.Second}
+// checkRemoteOnline returns an error wrapping vechttp.ErrOffline when offline
+// mode is on and remoteURL isn't a repository on this machine
+func checkRemoteOnline(remoteURL string) error {
+	if _, local := localRemotePath(remoteURL); local {
+		return nil
+	}
+	return vechttp.CheckOnline(remoteURL)
+}
 
-	for attempt := 1; attempt <= 3; attempt++ {
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create request: %w", err)
-		}
+// cloneDryRun reports what CloneWithOptions would do without creating
+// anything or touching the network. The refs of a remote on this machine are
+// read so the branch can be resolved; for other remotes the plan is reported
+// from the options alone.
+func cloneDryRun(opts CloneOptions) error {
+	cfg := config.NewConfig(opts.DestPath)
+	fetchURL := cfg.RewriteURL(opts.URL)
 
-		// Add authentication headers if provided (but not required)
-		// applyAuthHeadersToRequest(req, remoteName, cfg)
+	fmt.Printf("Would create repository in '%s'", opts.DestPath)
+	if opts.Bare {
+		fmt.Print(" (bare)")
+	}
+	fmt.Println()
+	fmt.Printf("Would add remote 'origin' -> %s\n", opts.URL)
+	if fetchURL != opts.URL {
+		fmt.Printf("Would fetch from %s (rewritten by insteadOf)\n", fetchURL)
+	}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			if attempt == 3 {
-				return nil, fmt.Errorf("cannot contact remote after %d attempts: %w", attempt, err)
-			}
-			time.Sleep(time.Duration(attempt) * time.Second)
-			continue
+	if _, local := localRemotePath(fetchURL); !local {
+		fmt.Println("Would fetch the branches and tags of origin")
+		if opts.Depth > 0 {
+			fmt.Printf("Would limit history to depth %d\n", opts.Depth)
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("refs fetch failed with status %d", resp.StatusCode)
+		branch := "the remote's default branch"
+		if opts.Branch != "" {
+			branch = fmt.Sprintf("'%s'", opts.Branch)
 		}
+		if !opts.Bare && !opts.NoCheckout {
+			fmt.Printf("Would check out %s\n", branch)
+		} else {
+			fmt.Printf("Would set HEAD to %s\n", branch)
+		}
+		return nil
+	}
 
-		var refs map[string]string
-		if err := json.NewDecoder(resp.Body).Decode(&refs); err != nil {
-			return nil, fmt.Errorf("failed to decode refs: %w", err)
+	transport, err := openTransport(fetchURL, "origin", cfg)
+	if err != nil {
+		return err
+	}
+	refs, err := transport.GetRefs()
+	if err != nil {
+		return fmt.Errorf("failed to read remote refs: %w", err)
+	}
+
+	branch, err := cloneBranch(transport, refs, opts.Branch)
+	if err != nil {
+		return err
+	}
+	if branch == "" {
+		fmt.Println("Remote repository is empty; nothing would be fetched")
+		return nil
+	}
+
+	var branches []string
+	for ref := range refs {
+		if strings.HasPrefix(ref, "refs/heads/") {
+			branches = append(branches, strings.TrimPrefix(ref, "refs/heads/"))
 		}
-		return refs, nil
 	}
-	return nil, fmt.Errorf("unexpected error in fetchRemoteRefsForClone")
+	sort.Strings(branches)
+	fmt.Printf("Would fetch %d branch(es): %s\n", len(branches), strings.Join(branches, ", "))
+	if opts.Depth > 0 {
+		fmt.Printf("Would limit history to depth %d\n", opts.Depth)
+	}
+	if !opts.Bare && !opts.NoCheckout {
+		fmt.Printf("Would check out '%s' at %s\n", branch, shortCommitID(refs["refs/heads/"+branch]))
+	} else {
+		fmt.Printf("Would set HEAD to '%s'\n", branch)
+	}
+	return nil
 }
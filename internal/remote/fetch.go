@@ -3,12 +3,15 @@ package remote
 
 import (
 	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httputil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"compress/zlib"
@@ -17,6 +20,7 @@ import (
 
 	"github.com/NahomAnteneh/vec/core"
 	"github.com/NahomAnteneh/vec/internal/config"
+	"github.com/NahomAnteneh/vec/internal/objects"
 	"github.com/NahomAnteneh/vec/internal/packfile"
 	vechttp "github.com/NahomAnteneh/vec/internal/remote/http"
 	"github.com/NahomAnteneh/vec/utils"
@@ -29,11 +33,16 @@ type FetchOptions struct {
 	Verbose   bool   // Be verbose
 	Force     bool   // Force update of local branches
 	Depth     int    // Create a shallow fetch with limited history
+	Deepen    int    // Fetch this many more commits below the shallow commits
+	Unshallow bool   // Fetch all the history a shallow fetch left out
 	FetchTags bool   // Fetch all tags
+	NoTags    bool   // Fetch no tags, not even those pointing into fetched history
 	Branch    string // Specific branch to fetch (used only in FetchWithOptions)
 	DryRun    bool   // Don't actually fetch, just show what would be done
 	Progress  bool   // Show progress output
 	Prune     bool   // Remove remote refs that don't exist locally
+
+	NegotiationTips []string // Patterns of the local refs offered as haves; overrides fetch.negotiationTip
 }
 
 // logRequest logs the details of an HTTP request
@@ -96,13 +105,31 @@ func FetchWithOptionsRepo(repo *core.Repository, remoteName string, opts FetchOp
 	}
 
 	// Fetch remote refs
-	refs, err := fetchRemoteRefs(remoteURL, remoteName, cfg)
+	advertised, unchanged, err := fetchRemoteRefsRepo(repo, remoteURL, remoteName, cfg)
 	if err != nil {
 		return fmt.Errorf("failed to fetch remote refs: %w", err)
 	}
 
 	if !opts.Quiet && opts.Verbose {
-		log.Printf("[Fetch] Retrieved %d refs from remote", len(refs))
+		log.Printf("[Fetch] Retrieved %d refs from remote", len(advertised))
+	}
+
+	tagMode, err := fetchTagModeRepo(repo, remoteName, opts)
+	if err != nil {
+		return err
+	}
+	refs, tags, peeled := splitFetchRefs(advertised)
+
+	// With --tags every tag is transferred along with the branches
+	wanted := refs
+	if tagMode == TagsAll {
+		wanted = make(map[string]string, len(refs)+len(tags))
+		for name, hash := range refs {
+			wanted[name] = hash
+		}
+		for name, hash := range tags {
+			wanted[name] = hash
+		}
 	}
 
 	// Handle specific branch filter if provided in options
@@ -112,9 +139,13 @@ func FetchWithOptionsRepo(repo *core.Repository, remoteName string, opts FetchOp
 	}
 
 	// Get local refs for negotiation
-	localRefs, err := getLocalRefsRepo(repo)
+	localRefs, err := negotiationRefsRepo(repo, opts)
+	if err != nil {
+		return err
+	}
+	shallow, err := shallowFetchRepo(repo, opts)
 	if err != nil {
-		return fmt.Errorf("failed to get local refs: %w", err)
+		return err
 	}
 
 	if !opts.Quiet && opts.Verbose {
@@ -142,21 +173,48 @@ func FetchWithOptionsRepo(repo *core.Repository, remoteName string, opts FetchOp
 		}
 	}
 
-	// Negotiate with the server to determine missing objects
-	missingObjects, err := negotiateFetch(remoteURL, remoteName, refs, localRefs, cfg)
-	if err != nil {
-		return fmt.Errorf("failed to negotiate fetch: %w", err)
-	}
+	// An advertisement the server reports unchanged since a completed fetch
+	// has nothing new to offer, so negotiation can be skipped, unless more
+	// history is asked for
+	var missingObjects []string
+	if unchanged && !deepensHistory(shallow) && trackingRefsCurrentRepo(repo, remoteName, refs) {
+		if !opts.Quiet && opts.Verbose {
+			log.Printf("[Fetch] Refs not modified since the last fetch, skipping negotiation")
+		}
+	} else {
+		missingObjects, err = negotiateShallowFetch(remoteURL, remoteName, wanted, localRefs, shallow, cfg)
+		if err != nil {
+			return fmt.Errorf("failed to negotiate fetch: %w", err)
+		}
 
-	if !opts.Quiet && opts.Verbose {
-		log.Printf("[Fetch] Negotiation complete, %d objects missing", len(missingObjects))
+		if !opts.Quiet && opts.Verbose {
+			log.Printf("[Fetch] Negotiation complete, %d objects missing", len(missingObjects))
+		}
 	}
 
+	// With every object present, as after a prefetch, only the
+	// remote-tracking refs may still have to move
 	if len(missingObjects) == 0 {
-		if !opts.Quiet {
+		if opts.DryRun {
+			if !opts.Quiet {
+				fmt.Println("Already up to date.")
+			}
+			return nil
+		}
+		updatedRefs, err := updateTrackingRefsRepo(repo, remoteName, refs, opts)
+		if err != nil {
+			return err
+		}
+		if !opts.Quiet && updatedRefs == 0 {
 			fmt.Println("Already up to date.")
+		} else if !opts.Quiet && !opts.Verbose {
+			fmt.Printf("Updated %d reference(s)\n", updatedRefs)
 		}
-		return nil
+		fetchedTags, err := fetchTagsRepo(repo, remoteURL, remoteName, cfg, tagMode, tags, peeled, opts)
+		if err != nil {
+			return err
+		}
+		return recordFetchHeadRepo(repo, remoteName, remoteURL, mergeFetchedRefs(refs, fetchedTags), defaultMergeRefRepo(repo, remoteName))
 	}
 
 	// In dry-run mode, just report what would be done
@@ -164,29 +222,26 @@ func FetchWithOptionsRepo(repo *core.Repository, remoteName string, opts FetchOp
 		if !opts.Quiet {
 			fmt.Printf("Would fetch %d objects from remote '%s'\n", len(missingObjects), remoteName)
 			fmt.Printf("Would update %d remote-tracking references\n", len(refs))
+			if tagMode == TagsAll {
+				fmt.Printf("Would update %d tags\n", len(tags))
+			}
 		}
 		return nil
 	}
 
-	// Apply depth limit if specified
-	if opts.Depth > 0 && !opts.Quiet && opts.Verbose {
-		log.Printf("[Fetch] Limiting history to depth %d", opts.Depth)
-		// Note: Actual depth limitation would be implemented here
-		// This would involve modifying the packfile request to include depth information
-	}
-
 	// Fetch the packfile containing missing objects
 	if !opts.Quiet && opts.Progress {
 		fmt.Printf("Downloading objects: %d object(s)\n", len(missingObjects))
 	}
 
-	packfile, err := fetchPackfile(remoteURL, remoteName, missingObjects, cfg)
+	packPath, packSize, err := fetchPackfileRepo(repo, remoteURL, remoteName, missingObjects, cfg, opts.Quiet)
 	if err != nil {
 		return fmt.Errorf("failed to fetch packfile: %w", err)
 	}
+	defer core.RemoveTempFile(packPath)
 
 	if !opts.Quiet && opts.Verbose {
-		log.Printf("[Fetch] Received packfile of size %d bytes", len(packfile))
+		log.Printf("[Fetch] Received packfile of size %d bytes", packSize)
 	}
 
 	// Unpack the packfile
@@ -194,11 +249,32 @@ func FetchWithOptionsRepo(repo *core.Repository, remoteName string, opts FetchOp
 		fmt.Printf("Unpacking objects: 100%% (%d/%d)\n", len(missingObjects), len(missingObjects))
 	}
 
-	if err := unpackPackfileRepo(repo, packfile); err != nil {
+	if err := UnpackPackfileRepo(repo, packPath); err != nil {
 		return fmt.Errorf("failed to unpack packfile: %w", err)
 	}
+	if err := updateShallowRepo(repo, shallow, wanted, opts); err != nil {
+		return err
+	}
+
+	updatedRefs, err := updateTrackingRefsRepo(repo, remoteName, refs, opts)
+	if err != nil {
+		return err
+	}
+	if !opts.Quiet && !opts.Verbose {
+		fmt.Printf("Updated %d reference(s)\n", updatedRefs)
+	}
+
+	fetchedTags, err := fetchTagsRepo(repo, remoteURL, remoteName, cfg, tagMode, tags, peeled, opts)
+	if err != nil {
+		return err
+	}
+
+	return recordFetchHeadRepo(repo, remoteName, remoteURL, mergeFetchedRefs(refs, fetchedTags), defaultMergeRefRepo(repo, remoteName))
+}
 
-	// Update local tracking refs
+// updateTrackingRefsRepo points the remote-tracking refs of remoteName at
+// the fetched branches and returns how many moved
+func updateTrackingRefsRepo(repo *core.Repository, remoteName string, refs map[string]string, opts FetchOptions) (int, error) {
 	updatedRefs := 0
 	for refName, hash := range refs {
 		// Skip HEAD ref
@@ -224,15 +300,9 @@ func FetchWithOptionsRepo(repo *core.Repository, remoteName string, opts FetchOp
 			continue
 		}
 
-		// Ensure directory exists
-		refDir := filepath.Dir(localRefPath)
-		if err := os.MkdirAll(refDir, 0755); err != nil {
-			return fmt.Errorf("failed to create ref directory: %w", err)
-		}
-
 		// Write new ref
-		if err := os.WriteFile(localRefPath, []byte(hash+"\n"), 0644); err != nil {
-			return fmt.Errorf("failed to update local ref %s: %w", localRef, err)
+		if err := repo.WriteRef(localRef, hash); err != nil {
+			return updatedRefs, fmt.Errorf("failed to update local ref %s: %w", localRef, err)
 		}
 
 		if !opts.Quiet && opts.Verbose {
@@ -245,12 +315,19 @@ func FetchWithOptionsRepo(repo *core.Repository, remoteName string, opts FetchOp
 
 		updatedRefs++
 	}
+	return updatedRefs, nil
+}
 
-	if !opts.Quiet && !opts.Verbose {
-		fmt.Printf("Updated %d reference(s)\n", updatedRefs)
+// mergeFetchedRefs combines fetched branch and tag refs for FETCH_HEAD
+func mergeFetchedRefs(branches, tags map[string]string) map[string]string {
+	merged := make(map[string]string, len(branches)+len(tags))
+	for name, hash := range branches {
+		merged[name] = hash
 	}
-
-	return nil
+	for name, hash := range tags {
+		merged[name] = hash
+	}
+	return merged
 }
 
 // FetchBranchWithOptionsRepo fetches a specific branch from a remote using Repository context
@@ -275,37 +352,67 @@ func FetchBranchWithOptionsRepo(repo *core.Repository, remoteName, branch string
 	branchRef := "refs/heads/" + branch
 
 	// Fetch remote refs
-	refs, err := fetchRemoteRefs(remoteURL, remoteName, cfg)
+	refs, unchanged, err := fetchRemoteRefsRepo(repo, remoteURL, remoteName, cfg)
 	if err != nil {
 		return fmt.Errorf("failed to fetch remote refs: %w", err)
 	}
 
+	tagMode, err := fetchTagModeRepo(repo, remoteName, opts)
+	if err != nil {
+		return err
+	}
+	_, tags, peeled := splitFetchRefs(refs)
+
 	// Check if the branch exists on the remote
 	if _, exists := refs[branchRef]; !exists {
 		return fmt.Errorf("branch '%s' not found on remote '%s'", branch, remoteName)
 	}
 
 	// Get local refs for negotiation
-	localRefs, err := getLocalRefsRepo(repo)
+	localRefs, err := negotiationRefsRepo(repo, opts)
 	if err != nil {
-		return fmt.Errorf("failed to get local refs: %w", err)
+		return err
+	}
+	shallow, err := shallowFetchRepo(repo, opts)
+	if err != nil {
+		return err
 	}
 
 	// Filter remote refs to only include the requested branch
 	filteredRefs := make(map[string]string)
 	filteredRefs[branchRef] = refs[branchRef]
 
-	// Negotiate with the server to determine missing objects
-	missingObjects, err := negotiateFetch(remoteURL, remoteName, filteredRefs, localRefs, cfg)
-	if err != nil {
-		return fmt.Errorf("failed to negotiate fetch: %w", err)
+	// Negotiate with the server to determine missing objects, unless the
+	// advertisement is unchanged since the branch was last fetched
+	var missingObjects []string
+	if !unchanged || deepensHistory(shallow) || !trackingRefsCurrentRepo(repo, remoteName, filteredRefs) {
+		missingObjects, err = negotiateShallowFetch(remoteURL, remoteName, filteredRefs, localRefs, shallow, cfg)
+		if err != nil {
+			return fmt.Errorf("failed to negotiate fetch: %w", err)
+		}
 	}
 
 	if len(missingObjects) == 0 {
-		if !opts.Quiet {
+		if opts.DryRun {
+			if !opts.Quiet {
+				fmt.Println("Already up to date.")
+			}
+			return nil
+		}
+		updatedRefs, err := updateTrackingRefsRepo(repo, remoteName, filteredRefs, opts)
+		if err != nil {
+			return err
+		}
+		if !opts.Quiet && updatedRefs == 0 {
 			fmt.Println("Already up to date.")
+		} else if !opts.Quiet {
+			fmt.Printf("Updated branch '%s' from remote '%s'\n", branch, remoteName)
 		}
-		return nil
+		fetchedTags, err := fetchTagsRepo(repo, remoteURL, remoteName, cfg, tagMode, tags, peeled, opts)
+		if err != nil {
+			return err
+		}
+		return recordFetchHeadRepo(repo, remoteName, remoteURL, mergeFetchedRefs(filteredRefs, fetchedTags), branchRef)
 	}
 
 	// In dry-run mode, just report what would be done
@@ -321,32 +428,29 @@ func FetchBranchWithOptionsRepo(repo *core.Repository, remoteName, branch string
 		fmt.Printf("Downloading objects: %d object(s) for branch '%s'\n", len(missingObjects), branch)
 	}
 
-	packfileData, err := fetchPackfile(remoteURL, remoteName, missingObjects, cfg)
+	packPath, _, err := fetchPackfileRepo(repo, remoteURL, remoteName, missingObjects, cfg, opts.Quiet)
 	if err != nil {
 		return fmt.Errorf("failed to fetch packfile: %w", err)
 	}
+	defer core.RemoveTempFile(packPath)
 
 	// Unpack the packfile
 	if !opts.Quiet && opts.Progress {
 		fmt.Printf("Unpacking objects: 100%% (%d/%d)\n", len(missingObjects), len(missingObjects))
 	}
 
-	if err := unpackPackfileRepo(repo, packfileData); err != nil {
+	if err := UnpackPackfileRepo(repo, packPath); err != nil {
 		return fmt.Errorf("failed to unpack packfile: %w", err)
 	}
+	if err := updateShallowRepo(repo, shallow, filteredRefs, opts); err != nil {
+		return err
+	}
 
 	// Update the local tracking ref for this branch
 	localRef := fmt.Sprintf("refs/remotes/%s/%s", remoteName, branch)
-	localRefPath := filepath.Join(repo.VecDir, localRef)
-
-	// Ensure directory exists
-	refDir := filepath.Dir(localRefPath)
-	if err := os.MkdirAll(refDir, 0755); err != nil {
-		return fmt.Errorf("failed to create ref directory: %w", err)
-	}
 
 	// Write new ref
-	if err := os.WriteFile(localRefPath, []byte(refs[branchRef]+"\n"), 0644); err != nil {
+	if err := repo.WriteRef(localRef, refs[branchRef]); err != nil {
 		return fmt.Errorf("failed to update local ref %s: %w", localRef, err)
 	}
 
@@ -354,9 +458,59 @@ func FetchBranchWithOptionsRepo(repo *core.Repository, remoteName, branch string
 		fmt.Printf("Updated branch '%s' from remote '%s'\n", branch, remoteName)
 	}
 
+	fetchedTags, err := fetchTagsRepo(repo, remoteURL, remoteName, cfg, tagMode, tags, peeled, opts)
+	if err != nil {
+		return err
+	}
+
+	return recordFetchHeadRepo(repo, remoteName, remoteURL, mergeFetchedRefs(filteredRefs, fetchedTags), branchRef)
+}
+
+// recordFetchHeadRepo writes FETCH_HEAD for the refs just fetched from remoteName,
+// marking mergeRef (if present) as the candidate for a following merge.
+func recordFetchHeadRepo(repo *core.Repository, remoteName, remoteURL string, refs map[string]string, mergeRef string) error {
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		if name != "HEAD" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	entries := make([]core.FetchHeadEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, core.FetchHeadEntry{
+			Hash:     refs[name],
+			Ref:      name,
+			URL:      remoteURL,
+			ForMerge: name == mergeRef,
+		})
+	}
+
+	if err := repo.WriteFetchHead(remoteName, entries); err != nil {
+		return fmt.Errorf("failed to record FETCH_HEAD: %w", err)
+	}
 	return nil
 }
 
+// defaultMergeRefRepo returns the remote ref the current branch would merge after
+// a fetch from remoteName: its configured upstream if that lives on remoteName,
+// otherwise the remote branch of the same name. Empty when HEAD is detached.
+func defaultMergeRefRepo(repo *core.Repository, remoteName string) string {
+	branch, err := repo.GetCurrentBranch()
+	if err != nil || branch == "(HEAD detached)" {
+		return ""
+	}
+
+	upstreamRemote, _ := repo.GetConfig(fmt.Sprintf("branch.%s.remote", branch))
+	if upstreamRemote == remoteName {
+		if mergeRef, _ := repo.GetConfig(fmt.Sprintf("branch.%s.merge", branch)); mergeRef != "" {
+			return mergeRef
+		}
+	}
+	return "refs/heads/" + branch
+}
+
 // Legacy functions for backward compatibility
 
 func FetchWithOptions(repoRoot, remoteName string, opts FetchOptions) error {
@@ -410,6 +564,9 @@ func getLocalRefsRepo(repo *core.Repository) (map[string]string, error) {
 			if info.IsDir() {
 				return nil
 			}
+			if info.Name() == core.FetchHeadFile {
+				return nil
+			}
 			rel, err := filepath.Rel(remotesDir, path)
 			if err != nil {
 				return err
@@ -426,6 +583,16 @@ func getLocalRefsRepo(repo *core.Repository) (map[string]string, error) {
 		}
 	}
 
+	// Prefetched branches are haves too, which is what makes the fetch
+	// after a prefetch small
+	prefetched, err := repo.ListRefs(PrefetchRefPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prefetch refs: %w", err)
+	}
+	for _, ref := range prefetched {
+		refs[ref.Name] = ref.Hash
+	}
+
 	return refs, nil
 }
 
@@ -443,8 +610,8 @@ func identifyRefsToRemoveRepo(repo *core.Repository, remoteName string, currentR
 		if err != nil {
 			return nil // Skip errors
 		}
-		if info.IsDir() {
-			return nil // Skip directories
+		if info.IsDir() || info.Name() == core.FetchHeadFile {
+			return nil // Skip directories and fetch bookkeeping
 		}
 
 		// Get the relative path
@@ -478,33 +645,64 @@ func pruneRemoteRefsRepo(repo *core.Repository, remoteName string, refsToRemove
 	return nil
 }
 
-func unpackPackfileRepo(repo *core.Repository, packfileData []byte) error {
-	// Create a temporary file for the packfile
-	tmpFile, err := os.CreateTemp("", "vec-packfile-*.pack")
+// UnpackPackfileRepo stores the objects of the packfile at packPath, as
+// written by fetchPackfileRepo or a backup: the pack is kept
+// whole in .vec/objects/pack, and only exploded into loose objects when it
+// can't be indexed, or when objects are encrypted, which packs aren't
+func UnpackPackfileRepo(repo *core.Repository, packPath string) error {
+	return unpackPackfileRepo(repo, packPath, "fetch.fsckObjects")
+}
+
+// unpackPackfileRepo is UnpackPackfileRepo validating the objects when
+// fsckKey, fetch.fsckObjects or receive.fsckObjects, asks for it
+func unpackPackfileRepo(repo *core.Repository, packPath, fsckKey string) error {
+	limits, err := packfile.LoadUnpackLimitsRepo(repo)
 	if err != nil {
-		return fmt.Errorf("failed to create temporary packfile: %w", err)
+		return err
 	}
-	defer os.Remove(tmpFile.Name())
-
-	// Write packfile data to temporary file
-	if _, err := tmpFile.Write(packfileData); err != nil {
-		tmpFile.Close()
-		return fmt.Errorf("failed to write packfile data: %w", err)
+	check, err := fsckIncomingCheckRepo(repo, fsckKey)
+	if err != nil {
+		return err
 	}
 
-	if err := tmpFile.Close(); err != nil {
-		return fmt.Errorf("failed to close temporary packfile: %w", err)
+	// The pack is indexed and checked one object at a time as it is
+	// installed, so memory doesn't grow with its size. Only a pack the
+	// store can't index, or one to explode into encrypted loose objects,
+	// is parsed whole.
+	if !core.ObjectEncryptionEnabled(repo.Root) {
+		_, err := packfile.InstallPackWithLimitsRepo(repo, packPath, limits, check)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, packfile.ErrObjectTooLarge) || errors.Is(err, packfile.ErrPackTooLarge) ||
+			errors.Is(err, objects.ErrMalformedObject) {
+			return fmt.Errorf("rejecting packfile: %w", err)
+		}
 	}
 
 	// Extract objects from packfile
-	objects, err := packfile.ParseModernPackfile(tmpFile.Name(), true)
+	objects, err := packfile.ParseModernPackfileWithLimits(packPath, true, limits)
 	if err != nil {
+		// A pack that breaks the size limits is rejected outright, never re-parsed
+		if errors.Is(err, packfile.ErrObjectTooLarge) || errors.Is(err, packfile.ErrPackTooLarge) {
+			return fmt.Errorf("rejecting packfile: %w", err)
+		}
 		// If modern parsing fails, try falling back to the original parser
+		packfileData, readErr := os.ReadFile(packPath)
+		if readErr != nil {
+			return fmt.Errorf("failed to read packfile: %w", readErr)
+		}
 		objects, err = packfile.ParsePackfile(packfileData)
 		if err != nil {
 			return fmt.Errorf("failed to parse packfile: %w", err)
 		}
 	}
+	defer packfile.ReleaseObjects(objects)
+
+	// With transfer.fsckObjects malformed objects never reach the store
+	if err := fsckIncomingObjectsRepo(repo, objects, fsckKey); err != nil {
+		return err
+	}
 
 	// Save extracted objects
 	if err := saveObjectsRepo(repo, objects); err != nil {
@@ -514,7 +712,40 @@ func unpackPackfileRepo(repo *core.Repository, packfileData []byte) error {
 	return nil
 }
 
+// fsckIncomingObjectsRepo validates incoming objects when fsckKey or
+// transfer.fsckObjects is set
+func fsckIncomingObjectsRepo(repo *core.Repository, objectsList []packfile.Object, fsckKey string) error {
+	enabled, err := objects.FsckObjectsEnabledRepo(repo, fsckKey)
+	if err != nil || !enabled {
+		return err
+	}
+	if err := objects.CheckPackObjects(objectsList); err != nil {
+		return fmt.Errorf("rejecting packfile: %w", err)
+	}
+	return nil
+}
+
+// fsckIncomingCheckRepo returns the check of each incoming object when
+// fsckKey or transfer.fsckObjects is set, nil otherwise
+func fsckIncomingCheckRepo(repo *core.Repository, fsckKey string) (packfile.ObjectCheck, error) {
+	enabled, err := objects.FsckObjectsEnabledRepo(repo, fsckKey)
+	if err != nil || !enabled {
+		return nil, err
+	}
+	return func(id, objType string, data []byte) error {
+		if objType == "blob" {
+			return nil
+		}
+		return objects.CheckObject(id, objType, data)
+	}, nil
+}
+
 func saveObjectsRepo(repo *core.Repository, objectsList []packfile.Object) error {
+	// A locked store fails every object, so fail before writing any
+	if err := core.CheckObjectStoreUnlocked(repo.Root); err != nil {
+		return err
+	}
+
 	// Create a channel to limit concurrency
 	semaphore := make(chan struct{}, 10)
 	var wg sync.WaitGroup
@@ -531,6 +762,14 @@ func saveObjectsRepo(repo *core.Repository, objectsList []packfile.Object) error
 			defer wg.Done()
 			defer func() { <-semaphore }()
 
+			// Large objects stay on disk and are streamed into the object store
+			if object.SpillPath != "" {
+				if err := saveSpilledObjectRepo(repo, &object); err != nil {
+					errorCh <- err
+				}
+				return
+			}
+
 			// Calculate hash (using object's data and header)
 			hash := sha256.Sum256(append([]byte(fmt.Sprintf("%s %d\x00", object.Type, len(object.Data))), object.Data...))
 			hashStr := fmt.Sprintf("%x", hash)
@@ -550,25 +789,27 @@ func saveObjectsRepo(repo *core.Repository, objectsList []packfile.Object) error
 				return
 			}
 
-			// Create object file
-			file, err := os.Create(objPath)
+			// Compress object data into the object file
+			err := writeLooseObjectRepo(repo, objPath, func(file io.Writer) error {
+				ew, err := core.NewObjectFileWriter(repo.Root, file)
+				if err != nil {
+					return err
+				}
+				zw := zlib.NewWriter(ew)
+				header := []byte(fmt.Sprintf("%s %d\x00", object.Type, len(object.Data)))
+				if _, err := zw.Write(append(header, object.Data...)); err != nil {
+					return fmt.Errorf("failed to compress object data: %w", err)
+				}
+				if err := zw.Close(); err != nil {
+					return fmt.Errorf("failed to finalize compressed data: %w", err)
+				}
+				if err := ew.Close(); err != nil {
+					return fmt.Errorf("failed to encrypt object: %w", err)
+				}
+				return nil
+			})
 			if err != nil {
-				errorCh <- fmt.Errorf("failed to create object file: %w", err)
-				return
-			}
-			defer file.Close()
-
-			// Compress object data
-			zw := zlib.NewWriter(file)
-			header := []byte(fmt.Sprintf("%s %d\x00", object.Type, len(object.Data)))
-			if _, err := zw.Write(append(header, object.Data...)); err != nil {
-				errorCh <- fmt.Errorf("failed to compress object data: %w", err)
-				return
-			}
-
-			if err := zw.Close(); err != nil {
-				errorCh <- fmt.Errorf("failed to finalize compressed data: %w", err)
-				return
+				errorCh <- err
 			}
 		}(obj)
 	}
@@ -587,24 +828,179 @@ func saveObjectsRepo(repo *core.Repository, objectsList []packfile.Object) error
 	return nil
 }
 
-// fetchRemoteRefs retrieves the branch refs from the remote with retry logic
-func fetchRemoteRefs(remoteURL, remoteName string, cfg *config.Config) (map[string]string, error) {
-	log.Printf("[fetchRemoteRefs] Fetching refs from endpoint: %s", vechttp.EndpointRefs)
+// saveSpilledObjectRepo writes an object whose content was spilled to disk during
+// parsing, hashing and compressing it in a streaming fashion.
+func saveSpilledObjectRepo(repo *core.Repository, object *packfile.Object) error {
+	if err := core.CheckObjectStoreUnlocked(repo.Root); err != nil {
+		return err
+	}
+	header := fmt.Sprintf("%s %d\x00", object.Type, object.Size)
+
+	// First pass: hash the content
+	r, err := packfile.OpenObjectData(object)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	h.Write([]byte(header))
+	_, err = io.Copy(h, r)
+	r.Close()
+	if err != nil {
+		return fmt.Errorf("failed to hash object data: %w", err)
+	}
+	hashStr := fmt.Sprintf("%x", h.Sum(nil))
+
+	objDir := filepath.Join(repo.VecDir, "objects", hashStr[:2])
+	objPath := filepath.Join(objDir, hashStr[2:])
+	if utils.FileExists(objPath) {
+		return nil
+	}
+	if err := os.MkdirAll(objDir, 0755); err != nil {
+		return fmt.Errorf("failed to create object directory: %w", err)
+	}
+
+	// Second pass: compress the content into the object store
+	r, err = packfile.OpenObjectData(object)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
 
-	return vechttp.FetchRemoteRefs(remoteURL, remoteName, cfg)
+	return writeLooseObjectRepo(repo, objPath, func(file io.Writer) error {
+		ew, err := core.NewObjectFileWriter(repo.Root, file)
+		if err != nil {
+			return err
+		}
+		zw := zlib.NewWriter(ew)
+		if _, err := zw.Write([]byte(header)); err != nil {
+			return fmt.Errorf("failed to compress object data: %w", err)
+		}
+		if _, err := io.Copy(zw, r); err != nil {
+			return fmt.Errorf("failed to compress object data: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("failed to finalize compressed data: %w", err)
+		}
+		if err := ew.Close(); err != nil {
+			return fmt.Errorf("failed to encrypt object: %w", err)
+		}
+		return nil
+	})
+}
+
+// writeLooseObjectRepo stores the loose object write produces at objPath. It
+// is written to a tmp_ file in the object directory and renamed into place,
+// so a failed or interrupted write never leaves a truncated object that
+// existence checks would take for a complete one.
+func writeLooseObjectRepo(repo *core.Repository, objPath string, write func(io.Writer) error) error {
+	file, err := os.CreateTemp(filepath.Dir(objPath), "tmp_"+filepath.Base(objPath)+"_")
+	if err != nil {
+		return fmt.Errorf("failed to create object file: %w", err)
+	}
+	tmpPath := file.Name()
+	err = file.Chmod(0644)
+	if err == nil {
+		err = write(file)
+	}
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write object file: %w", closeErr)
+	}
+	if err == nil {
+		if renameErr := os.Rename(tmpPath, objPath); renameErr != nil {
+			err = fmt.Errorf("failed to move object file into place: %w", renameErr)
+		}
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
 }
 
 // negotiateFetch determines which objects are missing by negotiating with the server
 func negotiateFetch(remoteURL, remoteName string, remoteRefs, localRefs map[string]string, cfg *config.Config) ([]string, error) {
+	return negotiateShallowFetch(remoteURL, remoteName, remoteRefs, localRefs, vechttp.ShallowFetch{}, cfg)
+}
+
+// negotiateShallowFetch is negotiateFetch with the history cut off as shallow asks
+func negotiateShallowFetch(remoteURL, remoteName string, remoteRefs, localRefs map[string]string, shallow vechttp.ShallowFetch, cfg *config.Config) ([]string, error) {
 	log.Printf("[negotiateFetch] Starting negotiation for %d remote refs against %d local refs",
 		len(remoteRefs), len(localRefs))
 
-	return vechttp.NegotiateFetch(remoteURL, remoteName, remoteRefs, localRefs, cfg)
+	if local, err := localTransportFor(remoteURL); local != nil || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return local.negotiate(remoteRefs, localRefs, shallow)
+	}
+	missing, err := vechttp.NegotiateShallowFetch(remoteURL, remoteName, remoteRefs, localRefs, shallow, cfg)
+	return missing, describeTransportError(remoteName, err)
 }
 
-// fetchPackfile retrieves a packfile containing the specified objects
-func fetchPackfile(remoteURL, remoteName string, objectsList []string, cfg *config.Config) ([]byte, error) {
+// fetchPackfileRepo streams the packfile holding objectsList from the remote
+// into .vec/tmp, or packs them there from a local remote, rejecting it as soon as it exceeds transfer.maxPackSize, and
+// checks its trailing checksum. A failed download is kept there, and the next
+// fetch of the same objects resumes it, telling the user unless quiet.
+// Callers remove the returned file with core.RemoveTempFile.
+func fetchPackfileRepo(repo *core.Repository, remoteURL, remoteName string, objectsList []string, cfg *config.Config, quiet bool) (string, int64, error) {
 	log.Printf("[fetchPackfile] Fetching packfile for %d objects", len(objectsList))
 
-	return vechttp.FetchPackfile(remoteURL, remoteName, objectsList, cfg)
+	if local, err := localTransportFor(remoteURL); local != nil || err != nil {
+		if err != nil {
+			return "", 0, err
+		}
+		return local.writePack(repo, objectsList)
+	}
+
+	limits, err := packfile.LoadUnpackLimitsRepo(repo)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := core.EnsureDirExists(repo.TempDir()); err != nil {
+		return "", 0, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	download := vechttp.PackDownload{
+		Path: filepath.Join(repo.TempDir(), vechttp.PartialPackName(objectsList)),
+		Wrap: func(offset int64, w io.Writer) io.Writer {
+			return &packLimitWriter{w: w, written: offset, limit: limits.MaxPackSize}
+		},
+		OnResume: func(offset int64) {
+			if !quiet {
+				fmt.Printf("Resuming packfile download at %s\n", packfile.FormatBytes(offset))
+			}
+		},
+	}
+
+	client := vechttp.NewClient(remoteURL, remoteName, cfg)
+	size, err := client.DownloadPackfile(objectsList, download)
+	if err != nil {
+		// Only an oversized pack is not worth resuming
+		if errors.Is(err, packfile.ErrPackTooLarge) {
+			core.RemoveTempFile(download.Path)
+		}
+		return "", 0, describeTransportError(remoteName, err)
+	}
+	if err := packfile.VerifyPackChecksum(download.Path); err != nil {
+		core.RemoveTempFile(download.Path)
+		return "", 0, fmt.Errorf("downloaded packfile is corrupt: %w", err)
+	}
+	return download.Path, size, nil
+}
+
+// packLimitWriter fails a download once more than limit bytes arrive; zero
+// means no limit
+type packLimitWriter struct {
+	w       io.Writer
+	written int64
+	limit   int64
+}
+
+func (p *packLimitWriter) Write(b []byte) (int, error) {
+	if p.limit > 0 && p.written+int64(len(b)) > p.limit {
+		return 0, fmt.Errorf("%w: received more than %d bytes (transfer.maxPackSize)",
+			packfile.ErrPackTooLarge, p.limit)
+	}
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	return n, err
 }
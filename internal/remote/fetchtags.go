@@ -0,0 +1,161 @@
+package remote
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/config"
+)
+
+// TagMode controls which tags a fetch brings in
+type TagMode int
+
+const (
+	TagsAutoFollow TagMode = iota // Tags pointing into fetched history (default)
+	TagsAll                       // Every tag on the remote (--tags, tagOpt=--tags)
+	TagsNone                      // No tags (--no-tags, tagOpt=--no-tags)
+)
+
+// peeledSuffix marks an advertised ref that gives the commit an annotated tag points at
+const peeledSuffix = "^{}"
+
+// fetchTagModeRepo resolves the tag mode from the options, falling back to
+// remote.<name>.tagOpt and then to auto-following.
+func fetchTagModeRepo(repo *core.Repository, remoteName string, opts FetchOptions) (TagMode, error) {
+	switch {
+	case opts.FetchTags:
+		return TagsAll, nil
+	case opts.NoTags:
+		return TagsNone, nil
+	}
+
+	tagOpt, err := repo.GetConfig(fmt.Sprintf("remote.%s.tagOpt", remoteName))
+	if err != nil {
+		return TagsAutoFollow, core.ConfigError("failed to read tagOpt", err)
+	}
+	switch strings.TrimSpace(tagOpt) {
+	case "":
+		return TagsAutoFollow, nil
+	case "--tags":
+		return TagsAll, nil
+	case "--no-tags":
+		return TagsNone, nil
+	}
+	return TagsAutoFollow, core.ConfigError(fmt.Sprintf("invalid remote.%s.tagOpt '%s' (expected --tags or --no-tags)", remoteName, tagOpt), nil)
+}
+
+// splitFetchRefs separates advertised refs into branches and tags. peeled maps
+// an annotated tag's ref to the commit it points at, when the remote says so.
+func splitFetchRefs(refs map[string]string) (branches, tags, peeled map[string]string) {
+	branches = make(map[string]string)
+	tags = make(map[string]string)
+	peeled = make(map[string]string)
+	for name, hash := range refs {
+		switch {
+		case strings.HasPrefix(name, "refs/tags/") && strings.HasSuffix(name, peeledSuffix):
+			peeled[strings.TrimSuffix(name, peeledSuffix)] = hash
+		case strings.HasPrefix(name, "refs/tags/"):
+			tags[name] = hash
+		case strings.HasPrefix(name, "refs/heads/"):
+			branches[name] = hash
+		}
+	}
+	return branches, tags, peeled
+}
+
+// fetchTagsRepo brings in the tags selected by mode: all of them, or under
+// auto-following those whose target commit is now present locally. Tag objects
+// still missing are fetched in a second round before the refs/tags/ refs are
+// written. Returns the tag refs that were selected.
+func fetchTagsRepo(repo *core.Repository, remoteURL, remoteName string, cfg *config.Config,
+	mode TagMode, tags, peeled map[string]string, opts FetchOptions) (map[string]string, error) {
+	selected := make(map[string]string)
+	if mode == TagsNone {
+		return selected, nil
+	}
+	for name, hash := range tags {
+		target := hash
+		if commit, ok := peeled[name]; ok {
+			target = commit
+		}
+		if mode == TagsAll || core.ObjectExists(repo.Root, target) {
+			selected[name] = hash
+		}
+	}
+	if len(selected) == 0 {
+		return selected, nil
+	}
+
+	// Annotated tags followed into history still need their tag objects
+	missingTags := make(map[string]string)
+	for name, hash := range selected {
+		if !core.ObjectExists(repo.Root, hash) {
+			missingTags[name] = hash
+		}
+	}
+	if len(missingTags) > 0 {
+		localRefs, err := negotiationRefsRepo(repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		missing, err := negotiateFetch(remoteURL, remoteName, missingTags, localRefs, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to negotiate tag fetch: %w", err)
+		}
+		if len(missing) > 0 {
+			packPath, _, err := fetchPackfileRepo(repo, remoteURL, remoteName, missing, cfg, opts.Quiet)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch tag objects: %w", err)
+			}
+			err = UnpackPackfileRepo(repo, packPath)
+			core.RemoveTempFile(packPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unpack tag objects: %w", err)
+			}
+		}
+	}
+
+	return selected, updateLocalTagsRepo(repo, selected, opts)
+}
+
+// updateLocalTagsRepo writes fetched tags to refs/tags/. An existing tag that
+// points elsewhere is only replaced with opts.Force.
+func updateLocalTagsRepo(repo *core.Repository, tags map[string]string, opts FetchOptions) error {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		hash := tags[name]
+		short := strings.TrimPrefix(name, "refs/tags/")
+		current, err := repo.ReadRefValue(name)
+		if err != nil {
+			return err
+		}
+		switch {
+		case current == hash:
+			continue
+		case current != "" && !opts.Force:
+			if !opts.Quiet {
+				fmt.Printf(" ! [rejected]        %s -> %s (would clobber existing tag)\n", short, short)
+			}
+			continue
+		}
+
+		if err := repo.WriteRef(name, hash); err != nil {
+			return fmt.Errorf("failed to update tag %s: %w", short, err)
+		}
+		if !opts.Quiet && (opts.Verbose || current == "") {
+			label := "[new tag]"
+			if current != "" {
+				label = "[tag update]"
+			}
+			fmt.Printf(" * %-17s %s -> %s\n", label, short, short)
+		}
+	}
+	return nil
+}
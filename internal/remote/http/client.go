@@ -3,13 +3,12 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -18,18 +17,20 @@ import (
 
 // Common constants
 const (
-	// Default timeout for HTTP requests
+	// Default overall deadline for HTTP requests
 	DefaultTimeout = 60 * time.Second
 	
 	// Standard content type
 	ContentTypeJSON = "application/json"
 	ContentTypeGit = "application/x-git"
+	ContentTypeBinary = "application/octet-stream"
 )
 
 // Common error types
 var (
 	ErrNetworkError    = errors.New("network error occurred")
 	ErrNotFound        = errors.New("resource not found")
+	ErrUnauthorized    = errors.New("authentication failed")
 )
 
 // Auth handles authentication for HTTP requests
@@ -37,6 +38,12 @@ type Auth interface {
 	ApplyAuth(req *http.Request) error
 }
 
+// reauthenticator is an Auth that can replace credentials a server rejected.
+// Reauthenticate reports whether a retry would send different ones.
+type reauthenticator interface {
+	Reauthenticate() bool
+}
+
 // BasicAuth implements basic username/password authentication
 type BasicAuth struct {
 	Username string
@@ -55,6 +62,7 @@ func (a *BasicAuth) ApplyAuth(req *http.Request) error {
 type ConfigAuth struct {
 	Config     *config.Config
 	RemoteName string
+	RemoteURL  string // Used to find host-scoped credentials
 }
 
 // ApplyAuth applies authentication from config to the request
@@ -73,104 +81,112 @@ func (a *ConfigAuth) ApplyAuth(req *http.Request) error {
 		}
 	}
 
-	// Try credentials file as fallback
-	creds, err := getCredentials(a.RemoteName)
-	if err == nil && creds.Username != "" {
+	// Then the credential helper, by default the credentials file
+	creds, err := FillCredential(a.Config, a.RemoteURL, a.RemoteName)
+	if errors.Is(err, ErrCredentialHelper) {
+		return err
+	} else if err != nil {
+		return nil
+	}
+	if creds.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+creds.Token)
+	} else if creds.RefreshToken != "" {
+		token, err := a.accessToken(creds.RefreshToken)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if creds.Username != "" {
 		req.SetBasicAuth(creds.Username, creds.Password)
 	}
 
 	return nil
 }
 
-// Credential holds user authentication information
-type Credential struct {
-	Username string
-	Password string
-}
-
-// getCredentials retrieves credentials from the credentials file
-func getCredentials(remoteName string) (*Credential, error) {
-	homeDir, err := os.UserHomeDir()
+// accessToken returns an access token for the remote, refreshing it with
+// refreshToken when none is cached or the cached one is about to expire. A
+// refresh token the server rotates is stored in place of the old one.
+func (a *ConfigAuth) accessToken(refreshToken string) (string, error) {
+	scope := a.tokenScope()
+	if token, ok := cachedAccessToken(scope); ok {
+		return token, nil
+	}
+	authURL, clientID, err := OAuthSettings(a.Config, a.RemoteName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
+		return "", err
 	}
-
-	// Look for credentials in ~/.vec/credentials
-	credsPath := filepath.Join(homeDir, ".vec", "credentials")
-	if _, err := os.Stat(credsPath); os.IsNotExist(err) {
-		return &Credential{}, nil
+	endpoints, err := DiscoverOAuthEndpoints(authURL)
+	if err != nil {
+		return "", err
 	}
-
-	credsData, err := os.ReadFile(credsPath)
+	token, err := RefreshOAuthToken(endpoints, clientID, refreshToken)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read credentials file: %w", err)
+		return "", fmt.Errorf("%w: refreshing the access token failed, run 'vec auth login %s': %w", ErrUnauthorized, a.RemoteName, err)
 	}
-
-	// Parse the credentials file
-	lines := strings.Split(string(credsData), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+	if token.RefreshToken != "" && token.RefreshToken != refreshToken {
+		helper, err := OpenCredentialHelper(a.Config, a.RemoteName)
+		if err == nil {
+			err = helper.Store(a.RemoteURL, Credential{RefreshToken: token.RefreshToken})
 		}
-
-		// Look for remote.{name}.username and remote.{name}.password
-		if strings.HasPrefix(line, fmt.Sprintf("remote.%s.username=", remoteName)) {
-			parts := strings.SplitN(line, "=", 2)
-			if len(parts) == 2 {
-				username := strings.TrimSpace(parts[1])
-				
-				// Look for corresponding password
-				for _, passwordLine := range lines {
-					passwordLine = strings.TrimSpace(passwordLine)
-					if strings.HasPrefix(passwordLine, fmt.Sprintf("remote.%s.password=", remoteName)) {
-						passParts := strings.SplitN(passwordLine, "=", 2)
-						if len(passParts) == 2 {
-							return &Credential{
-								Username: username,
-								Password: strings.TrimSpace(passParts[1]),
-							}, nil
-						}
-					}
-				}
-				
-				// Username found but no password
-				return &Credential{
-					Username: username,
-				}, nil
-			}
+		if err != nil {
+			return "", fmt.Errorf("failed to store the new refresh token: %w", err)
 		}
 	}
+	cacheAccessToken(scope, token)
+	return token.AccessToken, nil
+}
 
-	return &Credential{}, nil
+// Reauthenticate drops the cached access token so the next request refreshes
+// it, reporting whether there was one to drop
+func (a *ConfigAuth) Reauthenticate() bool {
+	return dropAccessToken(a.tokenScope())
+}
+
+// tokenScope keys the remote's access tokens: the host of its URL, or the
+// remote name if it has none
+func (a *ConfigAuth) tokenScope() string {
+	if scope := CredentialScope(a.RemoteURL, false); scope != "" {
+		return scope
+	}
+	return RemoteCredentialScope(a.RemoteName)
 }
 
 // Client represents a simple HTTP client for Vec remote operations
 type Client struct {
-	httpClient *http.Client
-	remoteURL  string
-	remoteName string
-	config     *config.Config
-	auth       Auth
-	verbose    bool
+	httpClient       *http.Client
+	remoteURL        string
+	remoteName       string
+	config           *config.Config
+	auth             Auth
+	verbose          bool
+	deadline         time.Duration    // Overall limit per request, including the body
+	idleTimeout      time.Duration    // Limit on time without receiving data
+	maxResponseSizes map[string]int64 // Per-endpoint overrides of the response limits
 }
 
-// NewClient creates a new HTTP client
+// RemoteURL returns the URL the client talks to
+func (c *Client) RemoteURL() string {
+	return c.remoteURL
+}
+
+// NewClient creates a new HTTP client. Clients for the same remote share
+// their connections, tuned by the http.* config keys (see transport.go).
 func NewClient(remoteURL, remoteName string, cfg *config.Config) *Client {
 	client := &Client{
-		httpClient: &http.Client{
-			Timeout: DefaultTimeout,
-		},
-		remoteURL:  remoteURL,
-		remoteName: remoteName,
-		config:     cfg,
-		verbose:    false,
+		httpClient:  sharedHTTPClient(remoteURL, ReadTransportSettings(cfg)),
+		remoteURL:   remoteURL,
+		remoteName:  remoteName,
+		config:      cfg,
+		verbose:     false,
+		deadline:    DefaultTimeout,
+		idleTimeout: DefaultIdleTimeout,
 	}
 	
 	// Set default auth from config
 	client.auth = &ConfigAuth{
 		Config:     cfg,
 		RemoteName: remoteName,
+		RemoteURL:  remoteURL,
 	}
 	
 	return client
@@ -181,9 +197,10 @@ func (c *Client) SetAuth(auth Auth) {
 	c.auth = auth
 }
 
-// SetTimeout sets the timeout for HTTP requests
+// SetTimeout sets the overall deadline for HTTP requests, covering connection,
+// upload and the full response body. A zero timeout disables the deadline.
 func (c *Client) SetTimeout(timeout time.Duration) {
-	c.httpClient.Timeout = timeout
+	c.deadline = timeout
 }
 
 // SetVerbose enables or disables verbose output
@@ -193,118 +210,238 @@ func (c *Client) SetVerbose(verbose bool) {
 
 // Get performs a GET request to the remote server
 func (c *Client) Get(path string) ([]byte, error) {
-	url := c.buildURL(path)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-	
-	// Add authentication
-	if c.auth != nil {
-		if err := c.auth.ApplyAuth(req); err != nil {
-			return nil, fmt.Errorf("failed to apply auth: %w", err)
-		}
-	}
-	
-	// Add standard headers
-	req.Header.Set("User-Agent", "Vec-Client/1.0")
-	req.Header.Set("Accept", ContentTypeJSON)
-	
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrNetworkError, err)
-	}
-	defer resp.Body.Close()
-	
-	// Check for error responses
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, ErrNotFound
-	}
-	
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("server returned error: %d %s", resp.StatusCode, resp.Status)
-	}
-	
-	return io.ReadAll(resp.Body)
+	return c.get(path, ContentTypeJSON)
+}
+
+// get performs a GET request, accepting only responses of the given content types
+func (c *Client) get(path string, accept ...string) ([]byte, error) {
+	return c.do("GET", path, nil, "", accept)
 }
 
 // Post performs a POST request to the remote server
 func (c *Client) Post(path string, data interface{}) ([]byte, error) {
-	url := c.buildURL(path)
-	
-	var body io.Reader
+	var body []byte
 	if data != nil {
 		jsonData, err := json.Marshal(data)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal data: %w", err)
 		}
-		body = bytes.NewBuffer(jsonData)
+		body = jsonData
 	}
 	
-	req, err := http.NewRequest("POST", url, body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	return c.do("POST", path, body, ContentTypeJSON, []string{ContentTypeJSON})
+}
+
+// PostBinary posts binary data (like packfiles) to the remote server
+func (c *Client) PostBinary(path string, data []byte) ([]byte, error) {
+	return c.do("POST", path, data, ContentTypeGit, []string{ContentTypeJSON})
+}
+
+// PackWriter writes a packfile to w as the body of a streamed upload
+type PackWriter func(w io.Writer) error
+
+// PostStream posts the packfile produced by write without buffering it. The
+// body is sent with chunked transfer encoding as write produces it; an error
+// from write aborts the request and is returned.
+func (c *Client) PostStream(path string, write PackWriter) ([]byte, error) {
+	pr, pw := io.Pipe()
+	writeErr := make(chan error, 1)
+	go func() {
+		err := write(pw)
+		pw.CloseWithError(err)
+		writeErr <- err
+	}()
+
+	data, err := c.doReader("POST", path, pr, -1, ContentTypeGit, []string{ContentTypeJSON}, nil)
+	// Unblock the writer if the request ended before reading the whole body
+	pr.CloseWithError(io.ErrClosedPipe)
+	if werr := <-writeErr; werr != nil && werr != io.ErrClosedPipe {
+		return nil, fmt.Errorf("failed to write packfile: %w", werr)
+	}
+	return data, err
+}
+
+// do sends a request with an in-memory body, see doReader
+func (c *Client) do(method, path string, body []byte, contentType string, accept []string) ([]byte, error) {
+	if body == nil {
+		return c.doReader(method, path, nil, 0, contentType, accept, nil)
 	}
-	
-	// Add authentication
-	if c.auth != nil {
-		if err := c.auth.ApplyAuth(req); err != nil {
-			return nil, fmt.Errorf("failed to apply auth: %w", err)
+	return c.doReader(method, path, bytes.NewReader(body), int64(len(body)), contentType, accept, nil)
+}
+
+// doReader sends a request and reads its response, enforcing the overall
+// deadline, the idle timeout, the endpoint's response size limit and the
+// expected content types. Violations are returned as *ProtocolError. A
+// length of -1 sends body with chunked transfer encoding. With out set the
+// response body is copied to it as it arrives and no data is returned.
+func (c *Client) doReader(method, path string, body io.Reader, length int64, contentType string, accept []string, out io.Writer) ([]byte, error) {
+	data, _, err := c.doRequest(method, path, body, length, contentType, accept, nil, out)
+	return data, err
+}
+
+// doRequest is doReader with extra request headers. It also returns the
+// response, whose body is already closed, so callers can read its status and
+// headers. A 304 Not Modified response is returned without a body. A request
+// rejected as unauthorized is sent once more if the auth has fresh
+// credentials, such as a refreshed access token, and the body can be replayed.
+func (c *Client) doRequest(method, path string, body io.Reader, length int64, contentType string, accept []string, header http.Header, out io.Writer) ([]byte, *http.Response, error) {
+	data, resp, err := c.sendRequest(method, path, body, length, contentType, accept, header, out)
+	if errors.Is(err, ErrUnauthorized) && c.reauthenticate(body) {
+		data, resp, err = c.sendRequest(method, path, body, length, contentType, accept, header, out)
+	}
+	return data, resp, err
+}
+
+// reauthenticate prepares the retry of a request rejected as unauthorized,
+// rewinding body, and reports whether to retry
+func (c *Client) reauthenticate(body io.Reader) bool {
+	reauth, ok := c.auth.(reauthenticator)
+	if !ok {
+		return false
+	}
+	if body != nil {
+		seeker, ok := body.(io.Seeker)
+		if !ok {
+			return false
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return false
 		}
 	}
-	
-	// Add standard headers
-	req.Header.Set("User-Agent", "Vec-Client/1.0")
-	req.Header.Set("Content-Type", ContentTypeJSON)
-	req.Header.Set("Accept", ContentTypeJSON)
-	
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrNetworkError, err)
+	return reauth.Reauthenticate()
+}
+
+// sendRequest sends a single request for doRequest
+func (c *Client) sendRequest(method, path string, body io.Reader, length int64, contentType string, accept []string, header http.Header, out io.Writer) ([]byte, *http.Response, error) {
+	url := c.buildURL(path)
+	if err := CheckOnline(url); err != nil {
+		return nil, nil, err
 	}
-	defer resp.Body.Close()
 	
-	// Check for error responses
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("server returned error: %d %s", resp.StatusCode, resp.Status)
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if c.deadline > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.deadline)
 	}
+	defer cancel()
+	ctx, cancelIdle := context.WithCancel(ctx)
+	defer cancelIdle()
 	
-	return io.ReadAll(resp.Body)
-}
-
-// PostBinary posts binary data (like packfiles) to the remote server
-func (c *Client) PostBinary(path string, data []byte) ([]byte, error) {
-	url := c.buildURL(path)
+	// Uploading counts as progress, so a slow push is not mistaken for an idle one
+	watchdog := newIdleWatchdog(c.idleTimeout, cancelIdle)
+	defer watchdog.stop()
 	
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = &watchedReader{r: body, w: watchdog}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	req.ContentLength = length
 	
 	// Add authentication
 	if c.auth != nil {
 		if err := c.auth.ApplyAuth(req); err != nil {
-			return nil, fmt.Errorf("failed to apply auth: %w", err)
+			return nil, nil, fmt.Errorf("failed to apply auth: %w", err)
 		}
 	}
 	
 	// Add standard headers
 	req.Header.Set("User-Agent", "Vec-Client/1.0")
-	req.Header.Set("Content-Type", ContentTypeGit)
-	req.Header.Set("Accept", ContentTypeJSON)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", strings.Join(accept, ", "))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	
+	// timeoutErr classifies a failed request as an idle or deadline violation
+	timeoutErr := func() error {
+		if watchdog.expired() {
+			return &ProtocolError{Method: method, Endpoint: path, Err: ErrIdleTimeout,
+				Detail: fmt.Sprintf("no data for %s", c.idleTimeout)}
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return &ProtocolError{Method: method, Endpoint: path, Err: ErrDeadlineExceeded,
+				Detail: fmt.Sprintf("limit %s", c.deadline)}
+		}
+		return nil
+	}
 	
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.httpClient.Do(withConnTrace(req))
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrNetworkError, err)
+		if perr := timeoutErr(); perr != nil {
+			return nil, nil, perr
+		}
+		return nil, nil, fmt.Errorf("%w: %v", ErrNetworkError, err)
 	}
 	defer resp.Body.Close()
+	watchdog.kick()
 	
 	// Check for error responses
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil, ErrNotFound
+	}
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return nil, nil, ErrRangeNotSatisfiable
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnauthorized, resp.Status)
+	}
+	
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("server returned error: %d %s", resp.StatusCode, resp.Status)
+		return nil, nil, fmt.Errorf("server returned error: %d %s", resp.StatusCode, resp.Status)
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, resp, nil
+	}
+	
+	if err := checkContentType(resp.Header.Get("Content-Type"), resp.ContentLength, accept); err != nil {
+		return nil, nil, &ProtocolError{Method: method, Endpoint: path, Err: ErrUnexpectedContentType, Detail: err.Error()}
+	}
+	
+	limit := c.maxResponseSize(path)
+	if limit > 0 && resp.ContentLength > limit {
+		return nil, nil, &ProtocolError{Method: method, Endpoint: path, Err: ErrResponseTooLarge,
+			Detail: fmt.Sprintf("server announced %d bytes, limit %d", resp.ContentLength, limit)}
+	}
+	
+	var data []byte
+	if sink, ok := out.(responseSink); ok {
+		if err := sink.begin(resp); err != nil {
+			return nil, nil, err
+		}
+	}
+	if out != nil {
+		err = copyLimited(out, &watchedReader{r: resp.Body, w: watchdog}, limit)
+	} else {
+		data, err = readLimited(&watchedReader{r: resp.Body, w: watchdog}, limit)
+	}
+	if err != nil {
+		var werr *writeError
+		if errors.As(err, &werr) {
+			return nil, nil, werr.err
+		}
+		if err == errResponseTooLarge {
+			return nil, nil, &ProtocolError{Method: method, Endpoint: path, Err: ErrResponseTooLarge,
+				Detail: fmt.Sprintf("limit %d bytes", limit)}
+		}
+		if perr := timeoutErr(); perr != nil {
+			return nil, nil, perr
+		}
+		return nil, nil, fmt.Errorf("%w: failed to read response: %v", ErrNetworkError, err)
 	}
 	
-	return io.ReadAll(resp.Body)
+	return data, resp, nil
+}
+
+// responseSink is an out writer of doRequest that is shown the response
+// before its body is copied
+type responseSink interface {
+	io.Writer
+	begin(resp *http.Response) error
 }
 
 // buildURL creates the full URL for a request
@@ -330,49 +467,252 @@ func (c *Client) GetRefs() (map[string]string, error) {
 	return refs, nil
 }
 
+// RefsValidator identifies a ref advertisement the client has seen before,
+// by the validators the server sent with it
+type RefsValidator struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// GetRefsIfModified retrieves the references unless they are unchanged since
+// the advertisement identified by since. The server answering 304 Not
+// Modified yields notModified and no refs; otherwise the refs are returned
+// with the validators of the new advertisement.
+func (c *Client) GetRefsIfModified(since RefsValidator) (refs map[string]string, validator RefsValidator, notModified bool, err error) {
+	header := make(http.Header)
+	if since.ETag != "" {
+		header.Set("If-None-Match", since.ETag)
+	}
+	if since.LastModified != "" {
+		header.Set("If-Modified-Since", since.LastModified)
+	}
+
+	data, resp, err := c.doRequest("GET", "info/refs", nil, 0, "", []string{ContentTypeJSON}, header, nil)
+	if err != nil {
+		return nil, RefsValidator{}, false, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, since, true, nil
+	}
+
+	refs = make(map[string]string)
+	if err := json.Unmarshal(data, &refs); err != nil {
+		return nil, RefsValidator{}, false, fmt.Errorf("failed to parse refs data: %w", err)
+	}
+	validator = RefsValidator{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	return refs, validator, false, nil
+}
+
 // GetObject retrieves an object from the remote repository
 func (c *Client) GetObject(hash string) ([]byte, error) {
-	return c.Get(fmt.Sprintf("objects/%s", hash))
+	return c.get(fmt.Sprintf("objects/%s", hash), ContentTypeGit, ContentTypeBinary)
+}
+
+// FetchPackfileTo asks the server for a packfile holding objects and copies
+// it to w as it arrives, so the pack is never held in memory. It returns the
+// number of bytes written.
+func (c *Client) FetchPackfileTo(objects []string, w io.Writer) (int64, error) {
+	body, err := json.Marshal(map[string]interface{}{"objects": objects})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal data: %w", err)
+	}
+	counter := &countingWriter{w: w}
+	_, err = c.doReader("POST", "packfile", bytes.NewReader(body), int64(len(body)), ContentTypeJSON,
+		[]string{ContentTypeGit, ContentTypeBinary}, counter)
+	return counter.n, err
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ObjectsExistBatchSize is the most hashes sent in one objects/exists request
+const ObjectsExistBatchSize = 1000
+
+// ObjectsExist asks the server which of hashes it already has, in batches of
+// ObjectsExistBatchSize. Servers without the endpoint return ErrNotFound.
+func (c *Client) ObjectsExist(hashes []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	for start := 0; start < len(hashes); start += ObjectsExistBatchSize {
+		end := start + ObjectsExistBatchSize
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+
+		data, err := c.Post("objects/exists", map[string]interface{}{"objects": hashes[start:end]})
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Exists []string `json:"exists"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, fmt.Errorf("failed to parse objects/exists response: %w", err)
+		}
+		for _, hash := range result.Exists {
+			existing[hash] = true
+		}
+	}
+	return existing, nil
+}
+
+// Per-ref statuses reported by the server for a push
+const (
+	RefStatusOK             = "ok"
+	RefStatusNonFastForward = "rejected-non-fast-forward"
+	RefStatusHook           = "rejected-hook"
+	RefStatusProtected      = "protected-branch"
+	RefStatusRejected       = "rejected"           // Declined for another reason, see Message
+	RefStatusAtomic         = "atomic-push-failed" // Left undone as another update of an atomic push failed
+)
+
+// RefStatus is the outcome of one ref update in a push
+type RefStatus struct {
+	Ref     string `json:"ref"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
 }
 
 // PushResult contains the result of a push operation
 type PushResult struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
+	Success bool        `json:"success"`
+	Message string      `json:"message"`
+	Refs    []RefStatus `json:"refs,omitempty"`
+}
+
+// RefStatus returns the status reported for ref, or nil if the server sent none
+func (r *PushResult) RefStatus(ref string) *RefStatus {
+	for i := range r.Refs {
+		if r.Refs[i].Ref == ref {
+			return &r.Refs[i]
+		}
+	}
+	return nil
 }
 
-// Push sends a packfile to the remote repository
+// Push sends a packfile to the remote repository. branchName may also be a
+// full ref name such as refs/tags/v1.0.
 func (c *Client) Push(branchName, oldCommit, newCommit string, packfile []byte) (*PushResult, error) {
-	// First send the push info
-	pushInfo := map[string]string{
-		"branch":    branchName,
+	return c.push(branchName, oldCommit, newCommit, false, packfile)
+}
+
+// PushWithLease sends a packfile like Push, but asks the server to update the
+// branch only if it still points at expectedCommit (empty: does not exist).
+func (c *Client) PushWithLease(branchName, expectedCommit, newCommit string, packfile []byte) (*PushResult, error) {
+	return c.push(branchName, expectedCommit, newCommit, true, packfile)
+}
+
+// PushStream is Push with the packfile streamed from pack instead of held in memory
+func (c *Client) PushStream(branchName, oldCommit, newCommit string, pack PackWriter) (*PushResult, error) {
+	return c.pushStream(branchName, oldCommit, newCommit, false, pack)
+}
+
+// PushStreamWithLease is PushWithLease with the packfile streamed from pack
+func (c *Client) PushStreamWithLease(branchName, expectedCommit, newCommit string, pack PackWriter) (*PushResult, error) {
+	return c.pushStream(branchName, expectedCommit, newCommit, true, pack)
+}
+
+// DeleteRef asks the server to remove ref, provided it still points at oldCommit
+func (c *Client) DeleteRef(ref, oldCommit string) (*PushResult, error) {
+	data, err := c.Post("push/info", pushInfo(ref, oldCommit, "", false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send ref deletion: %w", err)
+	}
+
+	var result struct {
+		PushResult
+		Continue bool `json:"continue"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse push info response: %w", err)
+	}
+	return &result.PushResult, nil
+}
+
+// ZeroHash is sent as the new value of a ref that is being deleted
+const ZeroHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// pushInfo builds the push/info request for one ref update; an empty
+// newCommit requests deletion of the ref.
+func pushInfo(ref, oldCommit, newCommit string, lease bool) map[string]interface{} {
+	deleting := newCommit == ""
+	if deleting {
+		newCommit = ZeroHash
+	}
+	info := map[string]interface{}{
+		"branch":    strings.TrimPrefix(ref, "refs/heads/"),
 		"oldCommit": oldCommit,
 		"newCommit": newCommit,
 	}
-	
-	infoData, err := c.Post("push/info", pushInfo)
+	if strings.HasPrefix(ref, "refs/") {
+		info["ref"] = ref
+	}
+	if lease {
+		info["lease"] = true
+	}
+	if deleting {
+		info["delete"] = true
+	}
+	return info
+}
+
+func (c *Client) push(branchName, oldCommit, newCommit string, lease bool, packfile []byte) (*PushResult, error) {
+	return c.sendPush(pushInfo(branchName, oldCommit, newCommit, lease), func() ([]byte, error) {
+		return c.PostBinary("push/packfile", packfile)
+	})
+}
+
+func (c *Client) pushStream(branchName, oldCommit, newCommit string, lease bool, pack PackWriter) (*PushResult, error) {
+	return c.sendPush(pushInfo(branchName, oldCommit, newCommit, lease), func() ([]byte, error) {
+		return c.PostStream("push/packfile", pack)
+	})
+}
+
+// sendPush announces the ref updates in info and, if the server accepts
+// them, uploads the packfile with send. Without send the server's answer
+// to the announcement is the result.
+func (c *Client) sendPush(info map[string]interface{}, send func() ([]byte, error)) (*PushResult, error) {
+	// First send the push info
+	infoData, err := c.Post("push/info", info)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send push info: %w", err)
 	}
 	
 	// Parse response to check if we should continue
 	var infoResult struct {
-		Continue bool   `json:"continue"`
-		Message  string `json:"message"`
+		Continue bool        `json:"continue"`
+		Success  bool        `json:"success"`
+		Message  string      `json:"message"`
+		Refs     []RefStatus `json:"refs,omitempty"`
 	}
 	if err := json.Unmarshal(infoData, &infoResult); err != nil {
 		return nil, fmt.Errorf("failed to parse push info response: %w", err)
 	}
+	if send == nil {
+		return &PushResult{Success: infoResult.Success, Message: infoResult.Message, Refs: infoResult.Refs}, nil
+	}
 	
 	if !infoResult.Continue {
 		return &PushResult{
 			Success: false,
 			Message: infoResult.Message,
+			Refs:    infoResult.Refs,
 		}, nil
 	}
 	
 	// Send the packfile
-	resultData, err := c.PostBinary("push/packfile", packfile)
+	resultData, err := send()
 	if err != nil {
 		return nil, fmt.Errorf("failed to send packfile: %w", err)
 	}
@@ -0,0 +1,238 @@
+package http
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Credentials file entries are keyed by scope:
+//
+//	host.<host>[/<path>].username=value
+//	host.<host>[/<path>].password=value
+//	host.<host>[/<path>].token=value
+//	host.<host>[/<path>].refreshToken=value
+//
+// Older files key entries by remote name (remote.<name>.*). Those are still
+// read as a fallback and migrated to the host scope of the remote using them.
+const (
+	credentialsFileName = "credentials"
+	hostScopePrefix     = "host."
+	remoteScopePrefix   = "remote."
+)
+
+var credentialFields = []string{"username", "password", "token", "refreshToken"}
+
+// Credential holds user authentication information
+type Credential struct {
+	Username     string
+	Password     string
+	Token        string
+	RefreshToken string // OAuth2 refresh token from vec auth login; access tokens are obtained with it
+}
+
+// empty reports whether no field of the credential is set
+func (c *Credential) empty() bool {
+	return c.Username == "" && c.Password == "" && c.Token == "" && c.RefreshToken == ""
+}
+
+// CredentialsPath returns the location of the user's credentials file
+func CredentialsPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".vec", credentialsFileName), nil
+}
+
+// CredentialScope returns the host scope credentials for rawURL are stored
+// under: the host, plus the path when withPath is set.
+func CredentialScope(rawURL string, withPath bool) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	scope := strings.ToLower(u.Host)
+	if path := strings.Trim(u.Path, "/"); withPath && path != "" {
+		scope += "/" + path
+	}
+	return scope
+}
+
+// credentialsFile is the parsed credentials file, keeping unrelated lines intact
+type credentialsFile struct {
+	path   string
+	lines  []string
+	exists bool
+}
+
+// loadCredentialsFile reads the credentials file; a missing file is empty
+func loadCredentialsFile() (*credentialsFile, error) {
+	path, err := CredentialsPath()
+	if err != nil {
+		return nil, err
+	}
+	f := &credentialsFile{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			f.lines = []string{
+				"# Vec credentials file - DO NOT SHARE",
+				"# Format: host.{host}[/{path}].{username|password|token|refreshToken}=value",
+				"",
+			}
+			return f, nil
+		}
+		return nil, fmt.Errorf("failed to read credentials file: %w", err)
+	}
+	f.lines = strings.Split(string(data), "\n")
+	f.exists = true
+	return f, nil
+}
+
+// get returns the credential stored under a full key prefix such as host.example.com
+func (f *credentialsFile) get(prefix string) *Credential {
+	cred := &Credential{}
+	for _, line := range f.lines {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || !strings.HasPrefix(key, prefix+".") {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimPrefix(key, prefix+".") {
+		case "username":
+			cred.Username = value
+		case "password":
+			cred.Password = value
+		case "token":
+			cred.Token = value
+		case "refreshToken":
+			cred.RefreshToken = value
+		}
+	}
+	return cred
+}
+
+// remove drops every entry under prefix
+func (f *credentialsFile) remove(prefix string) {
+	kept := f.lines[:0]
+	for _, line := range f.lines {
+		key, _, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok && isCredentialKey(key, prefix) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	f.lines = kept
+}
+
+// set replaces the entries under prefix with the non-empty fields of cred
+func (f *credentialsFile) set(prefix string, cred *Credential) {
+	f.remove(prefix)
+	for _, field := range credentialFields {
+		var value string
+		switch field {
+		case "username":
+			value = cred.Username
+		case "password":
+			value = cred.Password
+		case "token":
+			value = cred.Token
+		case "refreshToken":
+			value = cred.RefreshToken
+		}
+		if value != "" {
+			f.lines = append(f.lines, fmt.Sprintf("%s.%s=%s", prefix, field, value))
+		}
+	}
+}
+
+// save writes the file back with owner-only permissions
+func (f *credentialsFile) save() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return fmt.Errorf("failed to create .vec directory: %w", err)
+	}
+	if err := os.WriteFile(f.path, []byte(strings.Join(f.lines, "\n")), 0600); err != nil {
+		return fmt.Errorf("failed to write credentials file: %w", err)
+	}
+	return nil
+}
+
+// isCredentialKey reports whether key is prefix followed by a credential field
+func isCredentialKey(key, prefix string) bool {
+	for _, field := range credentialFields {
+		if key == prefix+"."+field {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupCredential finds the credential for a remote. Host entries win, the
+// one including the URL path first; a remote-name entry is the fallback and
+// is migrated to the host scope when found.
+func LookupCredential(remoteURL, remoteName string) (*Credential, error) {
+	f, err := loadCredentialsFile()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, scope := range []string{CredentialScope(remoteURL, true), CredentialScope(remoteURL, false)} {
+		if scope == "" {
+			continue
+		}
+		if cred := f.get(hostScopePrefix + scope); !cred.empty() {
+			return cred, nil
+		}
+	}
+
+	if remoteName == "" {
+		return &Credential{}, nil
+	}
+	cred := f.get(remoteScopePrefix + remoteName)
+	if !cred.empty() {
+		if scope := CredentialScope(remoteURL, false); scope != "" {
+			// Best effort: a failed migration leaves the legacy entry usable
+			f.set(hostScopePrefix+scope, cred)
+			f.remove(remoteScopePrefix + remoteName)
+			_ = f.save()
+		}
+	}
+	return cred, nil
+}
+
+// StoreCredential saves cred under a host scope from CredentialScope, or under
+// the remote name when the scope is "remote.<name>".
+func StoreCredential(scope string, cred Credential) error {
+	f, err := loadCredentialsFile()
+	if err != nil {
+		return err
+	}
+	prefix := scope
+	if !strings.HasPrefix(scope, remoteScopePrefix) {
+		prefix = hostScopePrefix + scope
+	}
+	f.set(prefix, &cred)
+	return f.save()
+}
+
+// ClearCredential removes the entries stored under scope, as for StoreCredential
+func ClearCredential(scope string) error {
+	f, err := loadCredentialsFile()
+	if err != nil || !f.exists {
+		return err
+	}
+	prefix := scope
+	if !strings.HasPrefix(scope, remoteScopePrefix) {
+		prefix = hostScopePrefix + scope
+	}
+	f.remove(prefix)
+	return f.save()
+}
+
+// RemoteCredentialScope returns the legacy scope for credentials keyed by remote name
+func RemoteCredentialScope(remoteName string) string {
+	return remoteScopePrefix + remoteName
+}
@@ -0,0 +1,248 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/config"
+)
+
+// CredentialHelperKey selects where credentials are kept: "store" for the
+// credentials file (the default), "osxkeychain", "wincred" or "libsecret" for
+// the OS keychains, or an external helper. An external helper is run as
+// vec-credential-<name>, as an absolute path, or as a shell command after a
+// '!', with the operation (get, store or erase) as its last argument. It
+// speaks git's credential protocol: key=value lines describing the remote
+// (protocol, host, path) and the credential (username, password) on stdin,
+// and for get the credential found on stdout.
+const CredentialHelperKey = "credential.helper"
+
+// tokenUsername and refreshTokenUsername are the usernames a bearer token and
+// an OAuth2 refresh token are kept under by helpers that only know usernames
+// and passwords
+const (
+	tokenUsername        = "vec-token"
+	refreshTokenUsername = "vec-refresh-token"
+)
+
+// ErrCredentialHelper is returned when a credential helper fails
+var ErrCredentialHelper = errors.New("credential helper failed")
+
+// CredentialHelper keeps credentials for remote URLs
+type CredentialHelper interface {
+	// Get returns the credential for remoteURL, empty when there is none
+	Get(remoteURL string) (*Credential, error)
+	Store(remoteURL string, cred Credential) error
+	Erase(remoteURL string) error
+}
+
+// OpenCredentialHelper returns the credential.helper of cfg, or of the
+// global config when cfg doesn't set one. remoteName locates credentials the
+// credentials file keys by remote name.
+func OpenCredentialHelper(cfg *config.Config, remoteName string) (CredentialHelper, error) {
+	name := credentialHelperName(cfg)
+	switch name {
+	case "", "store":
+		return &fileCredentialHelper{remoteName: remoteName}, nil
+	case "osxkeychain":
+		return keychainCredentialHelper{}, nil
+	case "libsecret":
+		return secretServiceCredentialHelper{}, nil
+	case "wincred", "manager":
+		return winCredentialHelper{}, nil
+	}
+	return newProcessCredentialHelper(name)
+}
+
+// credentialHelperName reads credential.helper, local config first
+func credentialHelperName(cfg *config.Config) string {
+	if cfg != nil {
+		if name := strings.TrimSpace(cfg.Settings["credential"]["helper"]); name != "" {
+			return name
+		}
+	}
+	global, err := core.ReadGlobalConfig()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(global[CredentialHelperKey])
+}
+
+// FillCredential returns the credential for remoteURL from the configured
+// helper. Credentials stored in the credentials file before a helper was
+// configured are still used when the helper has none.
+func FillCredential(cfg *config.Config, remoteURL, remoteName string) (*Credential, error) {
+	helper, err := OpenCredentialHelper(cfg, remoteName)
+	if err != nil {
+		return nil, err
+	}
+	cred, err := helper.Get(remoteURL)
+	if err != nil {
+		return nil, err
+	}
+	if _, isFile := helper.(*fileCredentialHelper); cred.empty() && !isFile {
+		return LookupCredential(remoteURL, remoteName)
+	}
+	return cred, nil
+}
+
+// fileCredentialHelper keeps credentials in the credentials file
+type fileCredentialHelper struct {
+	remoteName string
+}
+
+func (h *fileCredentialHelper) Get(remoteURL string) (*Credential, error) {
+	return LookupCredential(remoteURL, h.remoteName)
+}
+
+func (h *fileCredentialHelper) Store(remoteURL string, cred Credential) error {
+	return StoreCredential(h.scope(remoteURL), cred)
+}
+
+func (h *fileCredentialHelper) Erase(remoteURL string) error {
+	return ClearCredential(h.scope(remoteURL))
+}
+
+// scope is the host of remoteURL, or the remote name if it has none
+func (h *fileCredentialHelper) scope(remoteURL string) string {
+	if scope := CredentialScope(remoteURL, false); scope != "" {
+		return scope
+	}
+	return RemoteCredentialScope(h.remoteName)
+}
+
+// credentialSecret returns the account and secret cred is kept as by helpers
+// holding a single secret per account
+func credentialSecret(cred Credential) (account, secret string) {
+	switch {
+	case cred.RefreshToken != "":
+		return refreshTokenUsername, cred.RefreshToken
+	case cred.Token != "":
+		return tokenUsername, cred.Token
+	}
+	return cred.Username, cred.Password
+}
+
+// credentialFromSecret reverses credentialSecret
+func credentialFromSecret(account, secret string) *Credential {
+	switch account {
+	case refreshTokenUsername:
+		return &Credential{RefreshToken: secret}
+	case tokenUsername:
+		return &Credential{Token: secret}
+	}
+	return &Credential{Username: account, Password: secret}
+}
+
+// keychainService names the keychain entry of remoteURL's host
+func keychainService(remoteURL string) (string, error) {
+	scope := CredentialScope(remoteURL, false)
+	if scope == "" {
+		return "", fmt.Errorf("%w: '%s' has no host to key the credential by", ErrCredentialHelper, remoteURL)
+	}
+	return "vec:" + scope, nil
+}
+
+// processCredentialHelper runs an external helper
+type processCredentialHelper struct {
+	command []string // Without the operation
+	shell   bool     // command is a shell command line
+}
+
+// newProcessCredentialHelper parses a credential.helper naming an external
+// helper
+func newProcessCredentialHelper(spec string) (*processCredentialHelper, error) {
+	if command, ok := strings.CutPrefix(spec, "!"); ok {
+		return &processCredentialHelper{command: []string{command}, shell: true}, nil
+	}
+	fields := strings.Fields(spec)
+	if !filepath.IsAbs(fields[0]) {
+		fields[0] = "vec-credential-" + fields[0]
+	}
+	return &processCredentialHelper{command: fields}, nil
+}
+
+func (h *processCredentialHelper) Get(remoteURL string) (*Credential, error) {
+	out, err := h.run("get", remoteURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	cred := &Credential{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "username":
+			cred.Username = value
+		case "password":
+			cred.Password = value
+		case "token":
+			cred.Token = value
+		}
+	}
+	if cred.Username == tokenUsername || cred.Username == refreshTokenUsername {
+		cred = credentialFromSecret(cred.Username, cred.Password)
+	}
+	return cred, nil
+}
+
+func (h *processCredentialHelper) Store(remoteURL string, cred Credential) error {
+	_, err := h.run("store", remoteURL, &cred)
+	return err
+}
+
+func (h *processCredentialHelper) Erase(remoteURL string) error {
+	_, err := h.run("erase", remoteURL, nil)
+	return err
+}
+
+// run runs the helper for operation, describing remoteURL and cred on stdin
+func (h *processCredentialHelper) run(operation, remoteURL string, cred *Credential) ([]byte, error) {
+	u, err := url.Parse(remoteURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid remote URL '%s': %v", ErrCredentialHelper, remoteURL, err)
+	}
+	fields := [][2]string{{"protocol", u.Scheme}, {"host", u.Host}}
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		fields = append(fields, [2]string{"path", path})
+	}
+	if cred != nil {
+		account, secret := credentialSecret(*cred)
+		fields = append(fields, [2]string{"username", account}, [2]string{"password", secret})
+	}
+	var input strings.Builder
+	for _, field := range fields {
+		// A line break would end the value and inject further keys
+		if strings.ContainsAny(field[1], "\n\x00") {
+			return nil, fmt.Errorf("%w: %s contains a newline or NUL, which the credential protocol can't carry", ErrCredentialHelper, field[0])
+		}
+		fmt.Fprintf(&input, "%s=%s\n", field[0], field[1])
+	}
+	input.WriteString("\n")
+
+	var cmd *exec.Cmd
+	if h.shell {
+		// As git does, the operation becomes "$1" of the command line
+		cmd = exec.Command("sh", "-c", h.command[0]+` "$@"`, h.command[0], operation)
+	} else {
+		cmd = exec.Command(h.command[0], append(h.command[1:], operation)...)
+	}
+	cmd.Stdin = strings.NewReader(input.String())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s %s: %v: %s", ErrCredentialHelper, h.command[0], operation, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
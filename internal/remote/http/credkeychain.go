@@ -0,0 +1,145 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// keychainAccountPattern finds the account in security's listing of an entry
+var keychainAccountPattern = regexp.MustCompile(`"acct"<blob>="([^"]*)"`)
+
+// keychainCredentialHelper keeps credentials in the macOS login keychain
+// through the security tool
+type keychainCredentialHelper struct{}
+
+func (keychainCredentialHelper) Get(remoteURL string) (*Credential, error) {
+	service, err := keychainService(remoteURL)
+	if err != nil {
+		return nil, err
+	}
+	listing, err := runKeychainTool("security", nil, "find-generic-password", "-s", service)
+	if entryMissing(err) {
+		return &Credential{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	match := keychainAccountPattern.FindSubmatch(listing)
+	if match == nil {
+		return &Credential{}, nil
+	}
+	account := string(match[1])
+	secret, err := runKeychainTool("security", nil, "find-generic-password", "-s", service, "-a", account, "-w")
+	if entryMissing(err) {
+		return &Credential{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return credentialFromSecret(account, strings.TrimRight(string(secret), "\r\n")), nil
+}
+
+func (keychainCredentialHelper) Store(remoteURL string, cred Credential) error {
+	service, err := keychainService(remoteURL)
+	if err != nil {
+		return err
+	}
+	account, secret := credentialSecret(cred)
+	if err := core.StoreMacKeychainPassword(service, account, secret); err != nil {
+		return fmt.Errorf("%w: %w", ErrCredentialHelper, err)
+	}
+	return nil
+}
+
+func (keychainCredentialHelper) Erase(remoteURL string) error {
+	service, err := keychainService(remoteURL)
+	if err != nil {
+		return err
+	}
+	if _, err := runKeychainTool("security", nil, "delete-generic-password", "-s", service); err != nil && !entryMissing(err) {
+		return err
+	}
+	return nil
+}
+
+// secretServiceService is the service attribute of vec's Secret Service items
+const secretServiceService = "vec-credentials"
+
+// secretServiceCredentialHelper keeps credentials in the Secret Service
+// (GNOME Keyring, KWallet) through libsecret's secret-tool
+type secretServiceCredentialHelper struct{}
+
+func (secretServiceCredentialHelper) Get(remoteURL string) (*Credential, error) {
+	host, err := keychainService(remoteURL)
+	if err != nil {
+		return nil, err
+	}
+	out, err := runKeychainTool("secret-tool", nil, "search", "--unlock", "service", secretServiceService, "host", host)
+	if entryMissing(err) {
+		return &Credential{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var account, secret string
+	found := false
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), " = ")
+		switch {
+		case !ok:
+		case key == "attribute.user":
+			account = value
+		case key == "secret":
+			secret, found = value, true
+		}
+	}
+	if !found {
+		return &Credential{}, nil
+	}
+	return credentialFromSecret(account, secret), nil
+}
+
+func (secretServiceCredentialHelper) Store(remoteURL string, cred Credential) error {
+	host, err := keychainService(remoteURL)
+	if err != nil {
+		return err
+	}
+	// One item per host: replace whatever account was stored before
+	if err := (secretServiceCredentialHelper{}).Erase(remoteURL); err != nil {
+		return err
+	}
+	account, secret := credentialSecret(cred)
+	_, err = runKeychainTool("secret-tool", strings.NewReader(secret),
+		"store", "--label", "vec credential for "+strings.TrimPrefix(host, "vec:"),
+		"service", secretServiceService, "host", host, "user", account)
+	return err
+}
+
+func (secretServiceCredentialHelper) Erase(remoteURL string) error {
+	host, err := keychainService(remoteURL)
+	if err != nil {
+		return err
+	}
+	if _, err := runKeychainTool("secret-tool", nil, "clear", "service", secretServiceService, "host", host); err != nil && !entryMissing(err) {
+		return err
+	}
+	return nil
+}
+
+// runKeychainTool is core.RunKeychainTool failing with ErrCredentialHelper
+func runKeychainTool(tool string, stdin io.Reader, args ...string) ([]byte, error) {
+	out, err := core.RunKeychainTool(tool, stdin, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCredentialHelper, err)
+	}
+	return out, nil
+}
+
+// entryMissing is core.KeychainEntryMissing
+func entryMissing(err error) bool {
+	return core.KeychainEntryMissing(err)
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+
+package http
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// winCredentialHelper stands in for the Windows Credential Manager elsewhere
+type winCredentialHelper struct{}
+
+func (winCredentialHelper) Get(remoteURL string) (*Credential, error) {
+	return nil, errWinCredUnsupported()
+}
+
+func (winCredentialHelper) Store(remoteURL string, cred Credential) error {
+	return errWinCredUnsupported()
+}
+
+func (winCredentialHelper) Erase(remoteURL string) error {
+	return errWinCredUnsupported()
+}
+
+func errWinCredUnsupported() error {
+	return fmt.Errorf("%w: the Windows Credential Manager is not available on %s", ErrCredentialHelper, runtime.GOOS)
+}
@@ -0,0 +1,126 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// Credential Manager constants from wincred.h
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errorNotFound           = syscall.Errno(1168)
+)
+
+var (
+	advapi32       = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW  = advapi32.NewProc("CredReadW")
+	procCredWriteW = advapi32.NewProc("CredWriteW")
+	procCredDelete = advapi32.NewProc("CredDeleteW")
+	procCredFree   = advapi32.NewProc("CredFree")
+)
+
+// winCredential is the CREDENTIALW structure
+type winCredential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// winCredentialHelper keeps credentials in the Windows Credential Manager as
+// generic credentials
+type winCredentialHelper struct{}
+
+func (winCredentialHelper) Get(remoteURL string) (*Credential, error) {
+	target, err := winCredentialTarget(remoteURL)
+	if err != nil {
+		return nil, err
+	}
+	var cred *winCredential
+	r, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if r == 0 {
+		if errors.Is(err, errorNotFound) {
+			return &Credential{}, nil
+		}
+		return nil, fmt.Errorf("%w: CredRead: %v", ErrCredentialHelper, err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	secret := string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize))
+	return credentialFromSecret(utf16PtrToString(cred.UserName), secret), nil
+}
+
+func (winCredentialHelper) Store(remoteURL string, cred Credential) error {
+	target, err := winCredentialTarget(remoteURL)
+	if err != nil {
+		return err
+	}
+	account, secret := credentialSecret(cred)
+	user, err := syscall.UTF16PtrFromString(account)
+	if err != nil {
+		return fmt.Errorf("%w: invalid username: %v", ErrCredentialHelper, err)
+	}
+	blob := []byte(secret)
+	entry := winCredential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(blob)),
+		Persist:            credPersistLocalMachine,
+		UserName:           user,
+	}
+	if len(blob) > 0 {
+		entry.CredentialBlob = &blob[0]
+	}
+	if r, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&entry)), 0); r == 0 {
+		return fmt.Errorf("%w: CredWrite: %v", ErrCredentialHelper, err)
+	}
+	return nil
+}
+
+func (winCredentialHelper) Erase(remoteURL string) error {
+	target, err := winCredentialTarget(remoteURL)
+	if err != nil {
+		return err
+	}
+	r, _, err := procCredDelete.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0)
+	if r == 0 && !errors.Is(err, errorNotFound) {
+		return fmt.Errorf("%w: CredDelete: %v", ErrCredentialHelper, err)
+	}
+	return nil
+}
+
+// winCredentialTarget is the target name of remoteURL's credential
+func winCredentialTarget(remoteURL string) (*uint16, error) {
+	service, err := keychainService(remoteURL)
+	if err != nil {
+		return nil, err
+	}
+	target, err := syscall.UTF16PtrFromString(service)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid target name: %v", ErrCredentialHelper, err)
+	}
+	return target, nil
+}
+
+// utf16PtrToString copies the NUL-terminated UTF-16 string at p
+func utf16PtrToString(p *uint16) string {
+	if p == nil {
+		return ""
+	}
+	n := 0
+	for ptr := unsafe.Pointer(p); *(*uint16)(ptr) != 0; n++ {
+		ptr = unsafe.Add(ptr, 2)
+	}
+	return syscall.UTF16ToString(unsafe.Slice(p, n))
+}
@@ -0,0 +1,50 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Capabilities a server may advertise in RepoInfo
+const (
+	CapabilityObjectsExist = "objects-exist" // objects/exists lookups before a push
+	CapabilityPushLease    = "push-lease"    // --force-with-lease compare-and-swap updates
+	CapabilityDeleteRefs   = "delete-refs"   // Ref deletion through push
+	CapabilityFilter       = "filter"        // Partial fetches with blob:none
+	CapabilityShallow      = "shallow"       // Fetches cut off below a depth, see ShallowFetch
+)
+
+// RepoInfo describes a remote repository, as returned by the optional info
+// endpoint
+type RepoInfo struct {
+	DefaultBranch string   `json:"defaultBranch"`
+	Branches      int      `json:"branches"`
+	Tags          int      `json:"tags"`
+	Size          int64    `json:"size"` // Bytes stored by the repository
+	Archived      bool     `json:"archived,omitempty"`
+	Capabilities  []string `json:"capabilities,omitempty"`
+}
+
+// HasCapability reports whether the server advertised capability
+func (i *RepoInfo) HasCapability(capability string) bool {
+	for _, c := range i.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// GetInfo retrieves repository statistics and server capabilities. Servers
+// without the endpoint return ErrNotFound.
+func (c *Client) GetInfo() (*RepoInfo, error) {
+	data, err := c.Get("info")
+	if err != nil {
+		return nil, err
+	}
+	var info RepoInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse info response: %w", err)
+	}
+	return &info, nil
+}
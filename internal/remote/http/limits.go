@@ -0,0 +1,224 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocol errors. Every ProtocolError unwraps to one of these, and all of them
+// wrap ErrProtocol, so callers can match either the specific violation or any.
+var (
+	ErrProtocol              = errors.New("protocol error")
+	ErrResponseTooLarge      = fmt.Errorf("%w: response body too large", ErrProtocol)
+	ErrUnexpectedContentType = fmt.Errorf("%w: unexpected content type", ErrProtocol)
+	ErrDeadlineExceeded      = fmt.Errorf("%w: request deadline exceeded", ErrProtocol)
+	ErrIdleTimeout           = fmt.Errorf("%w: connection idle for too long", ErrProtocol)
+)
+
+// Default response limits.
+const (
+	// DefaultIdleTimeout is how long a request may go without receiving any data
+	DefaultIdleTimeout = 30 * time.Second
+
+	// DefaultMaxResponseSize bounds JSON responses from endpoints without a specific limit
+	DefaultMaxResponseSize int64 = 16 << 20
+
+	// DefaultMaxPackResponseSize bounds binary responses carrying objects or packfiles
+	DefaultMaxPackResponseSize int64 = 4 << 30
+)
+
+// defaultMaxResponseSizes maps endpoint prefixes to their response size limits.
+// The longest matching prefix wins; anything else uses DefaultMaxResponseSize.
+var defaultMaxResponseSizes = map[string]int64{
+	"info/refs":     4 << 20,
+	"push/info":     1 << 20,
+	"push/packfile": 1 << 20,
+	"objects/":      DefaultMaxPackResponseSize,
+	"packfile":      DefaultMaxPackResponseSize,
+}
+
+// ProtocolError describes a server response that broke the client's
+// expectations: it was too large, had the wrong content type, or took too long.
+type ProtocolError struct {
+	Method   string // HTTP method of the request
+	Endpoint string // Endpoint path relative to the remote URL
+	Err      error  // One of the ErrXxx protocol sentinels
+	Detail   string // Human readable specifics
+}
+
+func (e *ProtocolError) Error() string {
+	msg := fmt.Sprintf("%s %s: %v", e.Method, e.Endpoint, e.Err)
+	if e.Detail != "" {
+		msg += " (" + e.Detail + ")"
+	}
+	return msg
+}
+
+func (e *ProtocolError) Unwrap() error {
+	return e.Err
+}
+
+// SetMaxResponseSize sets the largest response body accepted from endpoints
+// starting with prefix. A size of zero removes the limit for that prefix.
+func (c *Client) SetMaxResponseSize(prefix string, size int64) {
+	if c.maxResponseSizes == nil {
+		c.maxResponseSizes = make(map[string]int64)
+	}
+	c.maxResponseSizes[strings.TrimLeft(prefix, "/")] = size
+}
+
+// SetIdleTimeout sets how long a request may go without receiving data before
+// it is aborted. Unlike SetTimeout this does not bound the total request time.
+func (c *Client) SetIdleTimeout(timeout time.Duration) {
+	c.idleTimeout = timeout
+}
+
+// maxResponseSize returns the response limit for path.
+func (c *Client) maxResponseSize(path string) int64 {
+	path = strings.TrimLeft(path, "/")
+	best, limit := -1, DefaultMaxResponseSize
+	for _, sizes := range []map[string]int64{defaultMaxResponseSizes, c.maxResponseSizes} {
+		for prefix, size := range sizes {
+			if strings.HasPrefix(path, prefix) && len(prefix) >= best {
+				best, limit = len(prefix), size
+			}
+		}
+	}
+	return limit
+}
+
+// checkContentType verifies the response media type is one of accepted.
+// An empty body with no content type is allowed.
+func checkContentType(header string, contentLength int64, accepted []string) error {
+	if header == "" {
+		if contentLength == 0 {
+			return nil
+		}
+		return fmt.Errorf("missing Content-Type, expected %s", strings.Join(accepted, " or "))
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return fmt.Errorf("malformed Content-Type '%s'", header)
+	}
+	for _, want := range accepted {
+		if mediaType == want {
+			return nil
+		}
+	}
+	return fmt.Errorf("got '%s', expected %s", mediaType, strings.Join(accepted, " or "))
+}
+
+// writeError is a failure of the destination of copyLimited. It is returned
+// to the caller unchanged rather than reported as a network error.
+type writeError struct{ err error }
+
+func (e *writeError) Error() string { return e.err.Error() }
+
+// copyLimited copies at most limit bytes from r to w, failing if there is more.
+func copyLimited(w io.Writer, r io.Reader, limit int64) error {
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	var copied int64
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			copied += int64(n)
+			if limit > 0 && copied > limit {
+				return errResponseTooLarge
+			}
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return &writeError{err: werr}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readLimited reads at most limit bytes from r, failing if there is more.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, errResponseTooLarge
+	}
+	return data, nil
+}
+
+// errResponseTooLarge is an internal marker converted to a ProtocolError by the caller.
+var errResponseTooLarge = errors.New("response exceeds limit")
+
+// idleWatchdog cancels a request when no progress is reported for the idle timeout.
+type idleWatchdog struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	timeout time.Duration
+	fired   bool
+}
+
+// newIdleWatchdog starts a watchdog that calls cancel after timeout without a kick.
+// A zero timeout returns a watchdog that never fires.
+func newIdleWatchdog(timeout time.Duration, cancel context.CancelFunc) *idleWatchdog {
+	w := &idleWatchdog{timeout: timeout}
+	if timeout > 0 {
+		w.timer = time.AfterFunc(timeout, func() {
+			w.mu.Lock()
+			w.fired = true
+			w.mu.Unlock()
+			cancel()
+		})
+	}
+	return w
+}
+
+// kick records progress and pushes the idle deadline back.
+func (w *idleWatchdog) kick() {
+	if w.timer != nil {
+		w.timer.Reset(w.timeout)
+	}
+}
+
+// stop disarms the watchdog.
+func (w *idleWatchdog) stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+// expired reports whether the watchdog cancelled the request.
+func (w *idleWatchdog) expired() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.fired
+}
+
+// watchedReader kicks its watchdog on every successful read.
+type watchedReader struct {
+	r io.Reader
+	w *idleWatchdog
+}
+
+func (r *watchedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.w.kick()
+	}
+	return n, err
+}
@@ -0,0 +1,60 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/NahomAnteneh/vec/internal/config"
+)
+
+// ShallowFetch cuts off the history a fetch negotiates
+type ShallowFetch struct {
+	Depth          int      `json:"depth,omitempty"`          // Commits wanted below each remote ref, the ref included
+	DeepenRelative bool     `json:"deepenRelative,omitempty"` // Count Depth below Shallow instead of from the refs
+	Shallow        []string `json:"shallow,omitempty"`        // Commits the client has without their parents
+}
+
+// fetchNegotiation is the body of a fetch/negotiate request
+type fetchNegotiation struct {
+	Wants []string `json:"wants"`
+	Haves []string `json:"haves"`
+	ShallowFetch
+}
+
+// NegotiateFetch asks the server for the objects reachable from remoteRefs,
+// as advertised, that aren't reachable from localRefs
+func NegotiateFetch(remoteURL, remoteName string, remoteRefs, localRefs map[string]string, cfg *config.Config) ([]string, error) {
+	return NegotiateShallowFetch(remoteURL, remoteName, remoteRefs, localRefs, ShallowFetch{}, cfg)
+}
+
+// NegotiateShallowFetch is NegotiateFetch with the history cut off as
+// shallow asks. Servers without CapabilityShallow ignore the cut-off.
+func NegotiateShallowFetch(remoteURL, remoteName string, remoteRefs, localRefs map[string]string, shallow ShallowFetch, cfg *config.Config) ([]string, error) {
+	request := fetchNegotiation{Wants: refHashes(remoteRefs), Haves: refHashes(localRefs), ShallowFetch: shallow}
+	data, err := NewClient(remoteURL, remoteName, cfg).Post("fetch/negotiate", request)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Objects []string `json:"objects"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse fetch/negotiate response: %w", err)
+	}
+	return result.Objects, nil
+}
+
+// refHashes returns the distinct hashes refs point to, sorted
+func refHashes(refs map[string]string) []string {
+	seen := make(map[string]bool, len(refs))
+	hashes := make([]string, 0, len(refs))
+	for _, hash := range refs {
+		if hash != "" && !seen[hash] {
+			seen[hash] = true
+			hashes = append(hashes, hash)
+		}
+	}
+	sort.Strings(hashes)
+	return hashes
+}
@@ -0,0 +1,278 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NahomAnteneh/vec/internal/config"
+)
+
+// DefaultOAuthClientID is the client vec identifies as to an authorization
+// server when remote.<name>.authclientid is not set
+const DefaultOAuthClientID = "vec"
+
+// deviceCodeGrant is the grant type of the device authorization flow (RFC 8628)
+const deviceCodeGrant = "urn:ietf:params:oauth:grant-type:device_code"
+
+// tokenExpiryLeeway is how long before it expires an access token is refreshed
+const tokenExpiryLeeway = 30 * time.Second
+
+// OAuth2 errors
+var (
+	ErrOAuth             = errors.New("oauth2 request failed")
+	ErrNoAuthURL         = errors.New("no authorization server configured")
+	ErrAccessDenied      = errors.New("authorization denied")
+	ErrDeviceCodeExpired = errors.New("device code expired before it was authorized")
+)
+
+// OAuthEndpoints are the endpoints of an authorization server
+type OAuthEndpoints struct {
+	DeviceAuthorization string `json:"device_authorization_endpoint"`
+	Token               string `json:"token_endpoint"`
+}
+
+// DeviceAuthorization is the response to a device authorization request
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"` // Seconds
+	Interval                int    `json:"interval"`   // Seconds between polls
+}
+
+// OAuthToken is a token endpoint response
+type OAuthToken struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` // Seconds, 0 when unknown
+}
+
+// oauthError is the error response of an OAuth2 endpoint
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *oauthError) Error() string {
+	if e.Description != "" {
+		return e.Code + ": " + e.Description
+	}
+	return e.Code
+}
+
+// OAuthSettings returns the authorization server and client ID configured
+// for a remote
+func OAuthSettings(cfg *config.Config, remoteName string) (authURL, clientID string, err error) {
+	if cfg != nil {
+		if remote, ok := cfg.Remotes[remoteName]; ok {
+			authURL, clientID = remote.AuthURL, remote.AuthClientID
+		}
+	}
+	if authURL == "" {
+		return "", "", fmt.Errorf("%w for remote '%s' (set remote.%s.authurl)", ErrNoAuthURL, remoteName, remoteName)
+	}
+	if clientID == "" {
+		clientID = DefaultOAuthClientID
+	}
+	return authURL, clientID, nil
+}
+
+// DiscoverOAuthEndpoints reads the endpoints of the authorization server at
+// authURL from its RFC 8414 metadata. Servers without metadata are expected
+// to serve <authURL>/device/code and <authURL>/token.
+func DiscoverOAuthEndpoints(authURL string) (*OAuthEndpoints, error) {
+	authURL = strings.TrimSuffix(authURL, "/")
+	u, err := url.Parse(authURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("%w: invalid authorization server URL '%s'", ErrOAuth, authURL)
+	}
+	// The well-known path goes between the host and the issuer's path
+	metadataURL := *u
+	metadataURL.Path = "/.well-known/oauth-authorization-server" + u.Path
+
+	endpoints := &OAuthEndpoints{}
+	if err := oauthRequest(http.MethodGet, metadataURL.String(), nil, endpoints); err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if endpoints.DeviceAuthorization == "" {
+		endpoints.DeviceAuthorization = authURL + "/device/code"
+	}
+	if endpoints.Token == "" {
+		endpoints.Token = authURL + "/token"
+	}
+	return endpoints, nil
+}
+
+// RequestDeviceAuthorization starts a device authorization flow, returning
+// the code the user enters at the verification URI
+func RequestDeviceAuthorization(endpoints *OAuthEndpoints, clientID, scope string) (*DeviceAuthorization, error) {
+	form := url.Values{"client_id": {clientID}}
+	if scope != "" {
+		form.Set("scope", scope)
+	}
+	auth := &DeviceAuthorization{}
+	if err := oauthRequest(http.MethodPost, endpoints.DeviceAuthorization, form, auth); err != nil {
+		return nil, err
+	}
+	if auth.DeviceCode == "" || auth.UserCode == "" || auth.VerificationURI == "" {
+		return nil, fmt.Errorf("%w: incomplete device authorization response", ErrOAuth)
+	}
+	return auth, nil
+}
+
+// PollDeviceToken polls the token endpoint until the user authorizes the
+// device, denies it, or the device code expires
+func PollDeviceToken(endpoints *OAuthEndpoints, clientID string, auth *DeviceAuthorization) (*OAuthToken, error) {
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	var deadline time.Time
+	if auth.ExpiresIn > 0 {
+		deadline = time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second)
+	}
+	form := url.Values{"grant_type": {deviceCodeGrant}, "device_code": {auth.DeviceCode}, "client_id": {clientID}}
+	for {
+		if !deadline.IsZero() && time.Now().Add(interval).After(deadline) {
+			return nil, ErrDeviceCodeExpired
+		}
+		time.Sleep(interval)
+
+		token := &OAuthToken{}
+		err := oauthRequest(http.MethodPost, endpoints.Token, form, token)
+		var oerr *oauthError
+		if errors.As(err, &oerr) {
+			switch oerr.Code {
+			case "authorization_pending":
+				continue
+			case "slow_down":
+				interval += 5 * time.Second
+				continue
+			case "access_denied":
+				return nil, ErrAccessDenied
+			case "expired_token":
+				return nil, ErrDeviceCodeExpired
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if token.AccessToken == "" {
+			return nil, fmt.Errorf("%w: token response has no access token", ErrOAuth)
+		}
+		return token, nil
+	}
+}
+
+// RefreshOAuthToken exchanges a refresh token for a new access token. The
+// response may carry a new refresh token replacing the old one.
+func RefreshOAuthToken(endpoints *OAuthEndpoints, clientID, refreshToken string) (*OAuthToken, error) {
+	form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}, "client_id": {clientID}}
+	token := &OAuthToken{}
+	if err := oauthRequest(http.MethodPost, endpoints.Token, form, token); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("%w: token response has no access token", ErrOAuth)
+	}
+	return token, nil
+}
+
+// oauthRequest sends form, or nothing when it is nil, to endpoint and decodes
+// the JSON response into out. OAuth2 error responses are returned as
+// *oauthError wrapped in ErrOAuth.
+func oauthRequest(method, endpoint string, form url.Values, out interface{}) error {
+	if err := CheckOnline(endpoint); err != nil {
+		return err
+	}
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOAuth, err)
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.Header.Set("Accept", ContentTypeJSON)
+	req.Header.Set("User-Agent", "Vec-Client/1.0")
+
+	resp, err := (&http.Client{Timeout: DefaultTimeout}).Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNetworkError, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%w: failed to read response: %v", ErrNetworkError, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode >= 400 {
+		oerr := &oauthError{}
+		if json.Unmarshal(data, oerr) == nil && oerr.Code != "" {
+			return fmt.Errorf("%w: %w", ErrOAuth, oerr)
+		}
+		return fmt.Errorf("%w: %s returned %s", ErrOAuth, endpoint, resp.Status)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%w: invalid response from %s: %v", ErrOAuth, endpoint, err)
+	}
+	return nil
+}
+
+// accessTokens caches the access tokens obtained with refresh tokens for the
+// life of the process, keyed by credential scope
+var accessTokens = struct {
+	sync.Mutex
+	tokens map[string]cachedToken
+}{tokens: make(map[string]cachedToken)}
+
+type cachedToken struct {
+	token   string
+	expires time.Time // Zero when the server didn't say
+}
+
+// cachedAccessToken returns the cached access token of scope unless it is
+// about to expire
+func cachedAccessToken(scope string) (string, bool) {
+	accessTokens.Lock()
+	defer accessTokens.Unlock()
+	cached, ok := accessTokens.tokens[scope]
+	if !ok || (!cached.expires.IsZero() && time.Now().Add(tokenExpiryLeeway).After(cached.expires)) {
+		return "", false
+	}
+	return cached.token, true
+}
+
+func cacheAccessToken(scope string, token *OAuthToken) {
+	cached := cachedToken{token: token.AccessToken}
+	if token.ExpiresIn > 0 {
+		cached.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	accessTokens.Lock()
+	accessTokens.tokens[scope] = cached
+	accessTokens.Unlock()
+}
+
+// dropAccessToken forgets the cached access token of scope, reporting
+// whether there was one
+func dropAccessToken(scope string) bool {
+	accessTokens.Lock()
+	defer accessTokens.Unlock()
+	_, ok := accessTokens.tokens[scope]
+	delete(accessTokens.tokens, scope)
+	return ok
+}
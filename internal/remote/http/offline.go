@@ -0,0 +1,45 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// OfflineEnv is the environment variable that enables offline mode when set to a true value.
+const OfflineEnv = "VEC_OFFLINE"
+
+// ErrOffline is returned instead of making a network request while offline mode is on.
+var ErrOffline = errors.New("network access is disabled (offline mode)")
+
+var offline atomic.Bool
+
+// SetOffline turns offline mode on or off for the whole process, in addition to
+// whatever VEC_OFFLINE says.
+func SetOffline(enabled bool) {
+	offline.Store(enabled)
+}
+
+// Offline reports whether network access is disabled, either by SetOffline or
+// by VEC_OFFLINE being set to 1, true, yes or on.
+func Offline() bool {
+	if offline.Load() {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(OfflineEnv))) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// CheckOnline returns an error wrapping ErrOffline if offline mode is on.
+// Code that talks to the network without a Client must call it first.
+func CheckOnline(url string) error {
+	if Offline() {
+		return fmt.Errorf("%w: refusing to contact %s (unset %s or drop --offline)", ErrOffline, url, OfflineEnv)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package http
+
+import "github.com/NahomAnteneh/vec/internal/config"
+
+// RefCommand is one ref update of a batched push
+type RefCommand struct {
+	Ref       string // Full ref name
+	OldCommit string // Where the ref is expected to be; empty for a new ref
+	NewCommit string // Where the ref moves to; empty deletes it
+	Lease     bool   // OldCommit is a force-with-lease expectation
+}
+
+// PushRefs announces commands in a single push/info request, as
+// {"updates": [...], "packfile": true|false, "atomic": true}, and uploads the
+// packfile pack writes once the server accepts them. Without a pack, as when
+// every command deletes a ref or the server has every object, the server
+// applies the updates on the announcement. An atomic push asks the server to
+// apply all of them or none. The result holds a status for each ref.
+func (c *Client) PushRefs(commands []RefCommand, atomic bool, pack PackWriter) (*PushResult, error) {
+	updates := make([]map[string]interface{}, len(commands))
+	for i, cmd := range commands {
+		updates[i] = pushInfo(cmd.Ref, cmd.OldCommit, cmd.NewCommit, cmd.Lease)
+	}
+	info := map[string]interface{}{"updates": updates, "packfile": pack != nil}
+	if atomic {
+		info["atomic"] = true
+	}
+	if pack == nil {
+		return c.sendPush(info, nil)
+	}
+	return c.sendPush(info, func() ([]byte, error) {
+		return c.PostStream("push/packfile", pack)
+	})
+}
+
+// PerformPush sends pushData, a push/info request such as the one PushRefs
+// builds, to remoteURL, followed by packfile unless it is empty. An "atomic"
+// entry set to true asks the server to apply every update or none.
+func PerformPush(remoteURL, remoteName string, pushData map[string]interface{}, packfile []byte, cfg *config.Config) (*PushResult, error) {
+	c := NewClient(remoteURL, remoteName, cfg)
+	if len(packfile) == 0 {
+		return c.sendPush(pushData, nil)
+	}
+	return c.sendPush(pushData, func() ([]byte, error) {
+		return c.PostBinary("push/packfile", packfile)
+	})
+}
@@ -0,0 +1,210 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ResumeAttemptsKey is the config key for how many requests a pack download
+// makes before giving up, each continuing where the last one stopped
+const ResumeAttemptsKey = "transfer.resumeAttempts"
+
+// DefaultResumeAttempts is used when transfer.resumeAttempts is unset or invalid
+const DefaultResumeAttempts = 3
+
+// ErrRangeNotSatisfiable is returned when the server can't continue a
+// download at the offset asked for
+var ErrRangeNotSatisfiable = errors.New("requested range not satisfiable")
+
+// PartialPackName names the file a download of the pack holding objects is
+// kept in until it completes. The same objects always get the same name, so
+// a fetch picks up the download an earlier one left.
+func PartialPackName(objects []string) string {
+	sorted := append([]string(nil), objects...)
+	sort.Strings(sorted)
+	h := sha256.New()
+	for _, hash := range sorted {
+		h.Write([]byte(hash + "\n"))
+	}
+	return fmt.Sprintf("partial-pack-%x.pack", h.Sum(nil)[:16])
+}
+
+// PackDownload is a pack download kept in a partial file
+type PackDownload struct {
+	Path     string                                    // Partial file, kept when the download fails
+	Wrap     func(offset int64, w io.Writer) io.Writer // Optional filter over writes to the file, told the offset they start at
+	OnResume func(offset int64)                        // Optional, called when the server continues the download at offset
+}
+
+// DownloadPackfile fetches the packfile holding objects into d.Path. When the
+// file already holds the start of the pack the request asks, with a Range
+// header, for the rest only; a server that ignores it sends the whole pack
+// and the file starts over. Network failures and timeouts are retried, each
+// retry resuming, up to transfer.resumeAttempts requests in all. It returns
+// the size of the file.
+func (c *Client) DownloadPackfile(objects []string, d PackDownload) (int64, error) {
+	body, err := json.Marshal(map[string]interface{}{"objects": objects})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal data: %w", err)
+	}
+	attempts := c.resumeAttempts()
+	for attempt := 1; ; attempt++ {
+		size, err := c.downloadPackfile(body, d)
+		if err == nil || attempt >= attempts || !retryable(err) {
+			return size, err
+		}
+	}
+}
+
+// resumeAttempts reads transfer.resumeAttempts
+func (c *Client) resumeAttempts() int {
+	if c.config != nil {
+		section, name, _ := strings.Cut(ResumeAttemptsKey, ".")
+		if n, err := strconv.Atoi(strings.TrimSpace(c.config.Settings[section][name])); err == nil && n > 0 {
+			return n
+		}
+	}
+	return DefaultResumeAttempts
+}
+
+// retryable reports whether a download that failed with err is worth
+// another request
+func retryable(err error) bool {
+	return errors.Is(err, ErrNetworkError) || errors.Is(err, ErrIdleTimeout) ||
+		errors.Is(err, ErrDeadlineExceeded) || errors.Is(err, ErrRangeNotSatisfiable)
+}
+
+// downloadPackfile makes one request of DownloadPackfile
+func (c *Client) downloadPackfile(body []byte, d PackDownload) (int64, error) {
+	file, err := os.OpenFile(d.Path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open partial packfile: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return 0, fmt.Errorf("failed to stat partial packfile: %w", err)
+	}
+
+	header := http.Header{}
+	etag := readPartialETag(d.Path)
+	if info.Size() > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", info.Size()))
+		if etag != "" {
+			header.Set("If-Range", etag)
+		}
+	}
+	sink := &rangeSink{file: file, path: d.Path, offset: info.Size(), download: d}
+	_, _, err = c.doRequest("POST", "packfile", bytes.NewReader(body), int64(len(body)), ContentTypeJSON,
+		[]string{ContentTypeGit, ContentTypeBinary}, header, sink)
+	if errors.Is(err, ErrRangeNotSatisfiable) {
+		// What is on disk isn't the start of the pack the server has now
+		file.Truncate(0)
+		os.Remove(partialETagPath(d.Path))
+	}
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to close partial packfile: %w", closeErr)
+	}
+	if err != nil {
+		return 0, err
+	}
+	// A complete download won't be resumed
+	os.Remove(partialETagPath(d.Path))
+	return sink.offset + sink.written, nil
+}
+
+// rangeSink writes a pack download into its partial file, appending when the
+// server continues at the end of the file and starting over otherwise
+type rangeSink struct {
+	file     *os.File
+	path     string
+	offset   int64 // Where the response body starts in the file
+	written  int64 // Bytes of the response body written
+	download PackDownload
+	out      io.Writer
+}
+
+func (s *rangeSink) begin(resp *http.Response) error {
+	if resp.StatusCode == http.StatusPartialContent {
+		start, err := contentRangeStart(resp.Header.Get("Content-Range"))
+		if err != nil || start != s.offset {
+			return &ProtocolError{Method: resp.Request.Method, Endpoint: "packfile", Err: ErrProtocol,
+				Detail: fmt.Sprintf("asked for bytes from %d, got Content-Range '%s'", s.offset, resp.Header.Get("Content-Range"))}
+		}
+		if s.download.OnResume != nil {
+			s.download.OnResume(s.offset)
+		}
+	} else {
+		s.offset = 0
+		if err := s.file.Truncate(0); err != nil {
+			return fmt.Errorf("failed to truncate partial packfile: %w", err)
+		}
+		if err := writePartialETag(s.path, resp.Header.Get("ETag")); err != nil {
+			return err
+		}
+	}
+	if _, err := s.file.Seek(s.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek in partial packfile: %w", err)
+	}
+	s.out = s.file
+	if s.download.Wrap != nil {
+		s.out = s.download.Wrap(s.offset, s.out)
+	}
+	return nil
+}
+
+func (s *rangeSink) Write(p []byte) (int, error) {
+	n, err := s.out.Write(p)
+	s.written += int64(n)
+	return n, err
+}
+
+// contentRangeStart parses the first byte of a "bytes start-end/size"
+// Content-Range header
+func contentRangeStart(value string) (int64, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(value), "bytes ")
+	if !ok {
+		return 0, fmt.Errorf("unsupported range unit")
+	}
+	start, _, ok := strings.Cut(rest, "-")
+	if !ok {
+		return 0, fmt.Errorf("malformed range")
+	}
+	return strconv.ParseInt(start, 10, 64)
+}
+
+// The ETag of the pack a partial file holds the start of sits next to it, so
+// a resumed request only continues the same pack
+func partialETagPath(path string) string {
+	return path + ".etag"
+}
+
+func readPartialETag(path string) string {
+	data, err := os.ReadFile(partialETagPath(path))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func writePartialETag(path, etag string) error {
+	if etag == "" {
+		if err := os.Remove(partialETagPath(path)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove partial packfile ETag: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(partialETagPath(path), []byte(etag+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to record partial packfile ETag: %w", err)
+	}
+	return nil
+}
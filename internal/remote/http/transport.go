@@ -0,0 +1,201 @@
+package http
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NahomAnteneh/vec/internal/config"
+)
+
+// Config keys tuning the connections to remotes. Invalid values fall back
+// to the defaults.
+const (
+	MaxIdleConnsKey        = "http.maxIdleConns"        // Idle connections kept open in total
+	MaxIdleConnsPerHostKey = "http.maxIdleConnsPerHost" // Idle connections kept open per host
+	MaxConnsPerHostKey     = "http.maxConnsPerHost"     // Connections per host, 0 for no limit
+	IdleConnTimeoutKey     = "http.idleConnTimeout"     // How long an idle connection is kept, as a duration
+	KeepAliveKey           = "http.keepAlive"           // TCP keepalive interval, as a duration; 0 disables it
+	VersionKey             = "http.version"             // HTTP/2, the default, or HTTP/1.1
+)
+
+// Transport defaults
+const (
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 16 // Fetches issue many requests to one host
+	DefaultIdleConnTimeout     = 90 * time.Second
+	DefaultKeepAlive           = 30 * time.Second
+)
+
+// TraceEnv is the environment variable that, set to a true value, logs the
+// connection each request used to stderr
+const TraceEnv = "VEC_TRACE_HTTP"
+
+// TransportSettings are the connection settings read from config
+type TransportSettings struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	KeepAlive           time.Duration
+	HTTP2               bool
+}
+
+// ReadTransportSettings reads the http.* connection keys from cfg, which may be nil
+func ReadTransportSettings(cfg *config.Config) TransportSettings {
+	settings := TransportSettings{
+		MaxIdleConns:        DefaultMaxIdleConns,
+		MaxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     DefaultIdleConnTimeout,
+		KeepAlive:           DefaultKeepAlive,
+		HTTP2:               true,
+	}
+	if cfg == nil {
+		return settings
+	}
+	value := func(key string) string {
+		section, name, _ := strings.Cut(key, ".")
+		return strings.TrimSpace(cfg.Settings[section][name])
+	}
+	count := func(key string, into *int) {
+		if n, err := strconv.Atoi(value(key)); err == nil && n >= 0 {
+			*into = n
+		}
+	}
+	duration := func(key string, into *time.Duration) {
+		if d, err := time.ParseDuration(value(key)); err == nil && d >= 0 {
+			*into = d
+		}
+	}
+	count(MaxIdleConnsKey, &settings.MaxIdleConns)
+	count(MaxIdleConnsPerHostKey, &settings.MaxIdleConnsPerHost)
+	count(MaxConnsPerHostKey, &settings.MaxConnsPerHost)
+	duration(IdleConnTimeoutKey, &settings.IdleConnTimeout)
+	duration(KeepAliveKey, &settings.KeepAlive)
+	switch strings.ToUpper(value(VersionKey)) {
+	case "HTTP/1.1", "HTTP/1":
+		settings.HTTP2 = false
+	}
+	return settings
+}
+
+// newTransport builds the transport for settings
+func newTransport(settings TransportSettings) *http.Transport {
+	keepAlive := settings.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = -1 // net.Dialer disables keepalive for negative values
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: keepAlive}).DialContext,
+		ForceAttemptHTTP2:     settings.HTTP2,
+		MaxIdleConns:          settings.MaxIdleConns,
+		MaxIdleConnsPerHost:   settings.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       settings.MaxConnsPerHost,
+		IdleConnTimeout:       settings.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	if !settings.HTTP2 {
+		// A non-nil empty map turns HTTP/2 off
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport
+}
+
+type sharedClientKey struct {
+	remoteURL string
+	settings  TransportSettings
+}
+
+var (
+	sharedClientsMu sync.Mutex
+	sharedClients   = make(map[sharedClientKey]*http.Client)
+)
+
+// sharedHTTPClient returns the HTTP client for remoteURL, so every Client
+// made for a remote during a command reuses the same connections
+func sharedHTTPClient(remoteURL string, settings TransportSettings) *http.Client {
+	key := sharedClientKey{remoteURL: remoteURL, settings: settings}
+	sharedClientsMu.Lock()
+	defer sharedClientsMu.Unlock()
+	client, ok := sharedClients[key]
+	if !ok {
+		client = &http.Client{Transport: newTransport(settings)}
+		sharedClients[key] = client
+	}
+	return client
+}
+
+// ConnStats counts the connections requests used, for the whole process
+type ConnStats struct {
+	Requests    int64 // Requests that got a connection
+	NewConns    int64 // Connections dialled
+	ReusedConns int64 // Requests sent on a kept-alive connection
+}
+
+var connStats struct {
+	requests, newConns, reusedConns atomic.Int64
+}
+
+// Stats returns the connection counts so far
+func Stats() ConnStats {
+	return ConnStats{
+		Requests:    connStats.requests.Load(),
+		NewConns:    connStats.newConns.Load(),
+		ReusedConns: connStats.reusedConns.Load(),
+	}
+}
+
+// Tracing reports whether TraceEnv is set to 1, true, yes or on
+func Tracing() bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(TraceEnv))) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// withConnTrace adds connection tracing to req: the counts behind Stats,
+// and with Tracing a line on stderr saying how the connection was obtained
+func withConnTrace(req *http.Request) *http.Request {
+	tracing := Tracing()
+	start := time.Now()
+	var dnsStart, connectStart, tlsStart time.Time
+	var dns, connect, handshake time.Duration
+
+	trace := &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:           func(httptrace.DNSDoneInfo) { dns = time.Since(dnsStart) },
+		ConnectStart:      func(string, string) { connectStart = time.Now() },
+		ConnectDone:       func(string, string, error) { connect = time.Since(connectStart) },
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { handshake = time.Since(tlsStart) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			connStats.requests.Add(1)
+			if info.Reused {
+				connStats.reusedConns.Add(1)
+			} else {
+				connStats.newConns.Add(1)
+			}
+			if !tracing {
+				return
+			}
+			how := fmt.Sprintf("new connection (dns %s, connect %s, tls %s)", dns, connect, handshake)
+			if info.Reused {
+				how = fmt.Sprintf("reused connection (idle %s)", info.IdleTime)
+			}
+			fmt.Fprintf(os.Stderr, "trace: http %s %s: %s to %s after %s\n",
+				req.Method, req.URL.Redacted(), how, info.Conn.RemoteAddr(), time.Since(start).Round(time.Microsecond))
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
@@ -0,0 +1,72 @@
+package remote
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// PushLease is a --force-with-lease expectation: the remote ref must still be
+// at Expected for a forced update to go through.
+type PushLease struct {
+	Ref         string // Remote branch, tag or full ref the lease applies to; empty means every pushed branch
+	Expected    string // Expected commit; empty with HasExpected means the ref must not exist
+	HasExpected bool   // Expected was given explicitly rather than taken from the tracking ref
+}
+
+// ParsePushLease parses a --force-with-lease value: "", "<ref>" or "<ref>:<expected>".
+func ParsePushLease(spec string) (PushLease, error) {
+	if spec == "" {
+		return PushLease{}, nil
+	}
+	ref, expected, hasExpected := strings.Cut(spec, ":")
+	ref = strings.TrimPrefix(ref, "refs/heads/")
+	if ref == "" {
+		return PushLease{}, fmt.Errorf("invalid --force-with-lease value '%s': missing ref", spec)
+	}
+	if expected != "" && !core.IsValidHex(expected) {
+		return PushLease{}, fmt.Errorf("invalid --force-with-lease value '%s': '%s' is not a commit hash", spec, expected)
+	}
+	return PushLease{Ref: ref, Expected: expected, HasExpected: hasExpected}, nil
+}
+
+// appliesTo reports whether the lease covers remoteRef, a full ref name. A
+// lease without a ref covers branches only, as other refs have no
+// remote-tracking ref to lease against.
+func (l PushLease) appliesTo(remoteRef string) bool {
+	if l.Ref == "" {
+		return strings.HasPrefix(remoteRef, "refs/heads/")
+	}
+	return remoteRef == l.Ref || remoteRef == "refs/heads/"+l.Ref || remoteRef == "refs/tags/"+l.Ref
+}
+
+// leaseExpectationRepo returns the commit remoteRef is expected to be at
+// under opts.Lease. Without an explicit value the remote-tracking ref from the
+// last fetch is used, which only branches have. ok is false when no lease
+// applies to the ref.
+func leaseExpectationRepo(repo *core.Repository, remoteName, remoteRef string, opts PushOptions) (expected string, ok bool, err error) {
+	if opts.Lease == nil || !opts.Lease.appliesTo(remoteRef) {
+		return "", false, nil
+	}
+	if opts.Lease.HasExpected {
+		return opts.Lease.Expected, true, nil
+	}
+	remoteBranch, isBranch := strings.CutPrefix(remoteRef, "refs/heads/")
+	if !isBranch {
+		return "", false, fmt.Errorf("no remote-tracking ref to lease '%s' against; use --force-with-lease=%s:<expected>",
+			shortRefName(remoteRef), opts.Lease.Ref)
+	}
+
+	trackingRef := filepath.Join("refs", "remotes", remoteName, remoteBranch)
+	expected, err = repo.ReadRefValue(trackingRef)
+	if err != nil {
+		return "", false, err
+	}
+	if expected == "" {
+		return "", false, fmt.Errorf("no remote-tracking ref '%s/%s' to lease against; fetch first or use --force-with-lease=%s:<expected>",
+			remoteName, remoteBranch, remoteBranch)
+	}
+	return expected, true, nil
+}
@@ -0,0 +1,300 @@
+package remote
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/packfile"
+	vechttp "github.com/NahomAnteneh/vec/internal/remote/http"
+	"github.com/NahomAnteneh/vec/internal/server"
+)
+
+// DenyCurrentBranchKey, true unless set otherwise, refuses pushes to a local
+// remote that would move or delete the branch checked out there, leaving its
+// working tree behind
+const DenyCurrentBranchKey = "receive.denyCurrentBranch"
+
+// localRemotePath returns the repository directory a file:// URL or a plain
+// path names; ok is false for URLs of any other scheme
+func localRemotePath(remoteURL string) (string, bool) {
+	if rest, ok := strings.CutPrefix(remoteURL, "file://"); ok {
+		u, err := url.Parse("file://" + rest)
+		if err != nil || (u.Host != "" && u.Host != "localhost") {
+			return "", false
+		}
+		return filepath.FromSlash(u.Path), true
+	}
+	if remoteURL == "" || strings.Contains(remoteURL, "://") {
+		return "", false
+	}
+	return remoteURL, true
+}
+
+// localTransport is the transport to a repository on the same machine. Refs
+// and objects are read and written in place, through the same request
+// handling a server applies to its repositories; ref updates are
+// compare-and-swaps under the ref's lock file, so concurrent pushes and
+// fetches of the repository don't interleave.
+type localTransport struct {
+	url    string
+	repo   *core.Repository
+	server *server.Server // Serves the repository's parent directory
+	name   string         // The repository's name for server
+}
+
+// openLocalTransport opens the repository at path, which may also name its
+// .vec directory
+func openLocalTransport(remoteURL, path string) (*localTransport, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, core.RemoteError(fmt.Sprintf("invalid local remote '%s'", remoteURL), err)
+	}
+	if filepath.Base(abs) == core.VecDirName {
+		abs = filepath.Dir(abs)
+	}
+	srv := server.NewServer()
+	// Packs are written once per fetch, so caching them would only cost memory
+	srv.Configure(server.ServerOptions{ReposDir: filepath.Dir(abs), PackCacheSize: -1})
+	t := &localTransport{url: remoteURL, repo: core.NewRepository(abs), server: srv, name: filepath.Base(abs)}
+	if !srv.RepoExists(t.name) {
+		return nil, core.RemoteError(fmt.Sprintf("'%s' does not appear to be a vec repository", path), nil)
+	}
+	return t, nil
+}
+
+// localTransportFor returns the local transport for remoteURL, or nil for a
+// URL handled over HTTP
+func localTransportFor(remoteURL string) (*localTransport, error) {
+	path, ok := localRemotePath(remoteURL)
+	if !ok {
+		return nil, nil
+	}
+	return openLocalTransport(remoteURL, path)
+}
+
+// RemoteURL returns the URL or path the remote was opened with
+func (t *localTransport) RemoteURL() string {
+	return t.url
+}
+
+// GetRefs advertises the branches and tags of the repository as a server
+// does, with the commit each annotated tag peels to under <tag>^{}
+func (t *localTransport) GetRefs() (map[string]string, error) {
+	refs := make(map[string]string)
+	for _, prefix := range []string{"refs/heads/", "refs/tags/"} {
+		list, err := core.ListRefs(t.repo.Root, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range list {
+			refs[ref.Name] = ref.Hash
+			if prefix != "refs/tags/" {
+				continue
+			}
+			if peeled, _, err := objects.PeelTagRepo(t.repo, ref.Hash); err == nil && peeled != ref.Hash {
+				refs[ref.Name+peeledSuffix] = peeled
+			}
+		}
+	}
+	return refs, nil
+}
+
+// GetInfo describes the repository as a server's info endpoint does
+func (t *localTransport) GetInfo() (*vechttp.RepoInfo, error) {
+	return t.server.RepoInfo(t.name)
+}
+
+// ObjectsExist reports which of hashes the repository stores
+func (t *localTransport) ObjectsExist(hashes []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	for _, hash := range hashes {
+		if objects.HasObjectRepo(t.repo, hash) {
+			existing[hash] = true
+		}
+	}
+	return existing, nil
+}
+
+// negotiate lists the objects reachable from remoteRefs, cut off as shallow
+// asks, that localRefs don't already reach
+func (t *localTransport) negotiate(remoteRefs, localRefs map[string]string, shallow vechttp.ShallowFetch) ([]string, error) {
+	req := server.FetchRequest{
+		Depth:          shallow.Depth,
+		DeepenRelative: shallow.DeepenRelative,
+		Shallow:        shallow.Shallow,
+	}
+	for _, hash := range remoteRefs {
+		req.Wants = append(req.Wants, hash)
+	}
+	for _, hash := range localRefs {
+		req.Haves = append(req.Haves, hash)
+	}
+	if len(req.Wants) == 0 {
+		return nil, nil
+	}
+	return t.server.NegotiateFetch(t.name, req)
+}
+
+// writePack writes a packfile of objectsList into .vec/tmp of repo. Callers
+// remove it with core.RemoveTempFile.
+func (t *localTransport) writePack(repo *core.Repository, objectsList []string) (string, int64, error) {
+	tmpFile, err := core.CreateTempFile(repo.Root, "vec-packfile", ".pack")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create temporary packfile: %w", err)
+	}
+	path := tmpFile.Name()
+	tmpFile.Close()
+
+	err = packfile.CreatePackfileFromHashesRepo(t.repo, objectsList, path, true)
+	// Only the pack is unpacked; the index is written again when it is installed
+	os.Remove(path + ".idx")
+	if err != nil {
+		core.RemoveTempFile(path)
+		return "", 0, fmt.Errorf("failed to pack objects of '%s': %w", t.url, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		core.RemoveTempFile(path)
+		return "", 0, fmt.Errorf("failed to stat packfile: %w", err)
+	}
+	return path, info.Size(), nil
+}
+
+// PushStream stores the objects pack writes and moves ref from oldCommit to newCommit
+func (t *localTransport) PushStream(ref, oldCommit, newCommit string, pack vechttp.PackWriter) (*vechttp.PushResult, error) {
+	return t.push([]server.PushInfo{pushInfoFor(ref, oldCommit, newCommit, false)}, false, pack)
+}
+
+// PushStreamWithLease is PushStream moving ref only while it is at expectedCommit
+func (t *localTransport) PushStreamWithLease(ref, expectedCommit, newCommit string, pack vechttp.PackWriter) (*vechttp.PushResult, error) {
+	return t.push([]server.PushInfo{pushInfoFor(ref, expectedCommit, newCommit, true)}, false, pack)
+}
+
+// DeleteRef removes ref, provided it still points at oldCommit
+func (t *localTransport) DeleteRef(ref, oldCommit string) (*vechttp.PushResult, error) {
+	return t.push([]server.PushInfo{pushInfoFor(ref, oldCommit, "", false)}, false, nil)
+}
+
+// PushRefs stores the objects pack writes, if any, and applies commands, all
+// or none of them when atomic
+func (t *localTransport) PushRefs(commands []vechttp.RefCommand, atomic bool, pack vechttp.PackWriter) (*vechttp.PushResult, error) {
+	infos := make([]server.PushInfo, len(commands))
+	for i, cmd := range commands {
+		infos[i] = pushInfoFor(cmd.Ref, cmd.OldCommit, cmd.NewCommit, cmd.Lease)
+	}
+	return t.push(infos, atomic, pack)
+}
+
+// pushInfoFor describes an update of ref, a full ref name or a branch; an
+// empty newCommit deletes it
+func pushInfoFor(ref, oldCommit, newCommit string, lease bool) server.PushInfo {
+	info := server.PushInfo{OldCommit: oldCommit, NewCommit: newCommit, Lease: lease}
+	if newCommit == "" {
+		info.NewCommit, info.Delete = vechttp.ZeroHash, true
+	}
+	if strings.HasPrefix(ref, "refs/") {
+		info.Ref = ref
+	} else {
+		info.Branch = ref
+	}
+	return info
+}
+
+// push stores the objects pack writes, if any, then applies infos, all or
+// none of them when atomic. Refused updates are reported in the result, as a
+// server reports them; the pack is only stored when some update may go ahead.
+func (t *localTransport) push(infos []server.PushInfo, atomic bool, pack vechttp.PackWriter) (*vechttp.PushResult, error) {
+	refused := make([]error, len(infos))
+	accepted := 0
+	for i, info := range infos {
+		if refused[i] = t.checkCurrentBranch(info.RefName()); refused[i] == nil {
+			accepted++
+		}
+	}
+	if atomic && accepted < len(infos) {
+		accepted = 0
+	}
+	if accepted > 0 && pack != nil {
+		if err := t.receivePack(pack); err != nil {
+			return nil, err
+		}
+	}
+
+	var statuses []vechttp.RefStatus
+	switch {
+	case atomic && accepted > 0:
+		statuses = t.server.UpdateRefsAtomic(t.name, infos)
+	default:
+		for i, info := range infos {
+			err := refused[i]
+			switch {
+			case err != nil:
+				statuses = append(statuses, server.RefStatusFor(info, err))
+			case atomic:
+				statuses = append(statuses, server.AtomicRefStatus(info))
+			default:
+				statuses = append(statuses, server.RefStatusFor(info, t.server.UpdateRef(t.name, info)))
+			}
+		}
+	}
+
+	result := &vechttp.PushResult{Success: true, Refs: statuses}
+	for _, status := range statuses {
+		if status.Status != vechttp.RefStatusOK {
+			result.Success, result.Message = false, status.Message
+			break
+		}
+	}
+	return result, nil
+}
+
+// checkCurrentBranch refuses to update the branch checked out in the
+// repository, unless receive.denyCurrentBranch is false or the repository is
+// bare
+func (t *localTransport) checkCurrentBranch(ref string) error {
+	if t.repo.IsBare() {
+		return nil
+	}
+	head, err := core.ReadHEADFile(t.repo.Root)
+	if err != nil || strings.TrimSpace(strings.TrimPrefix(head, "ref:")) != ref {
+		return nil
+	}
+	value, err := t.repo.GetConfig(DenyCurrentBranchKey)
+	if err != nil {
+		return core.ConfigError("failed to read "+DenyCurrentBranchKey, err)
+	}
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "false", "no", "off", "0":
+		return nil
+	}
+	return fmt.Errorf("refusing to update checked out branch '%s' of a non-bare repository (set %s to false to allow it)",
+		strings.TrimPrefix(ref, "refs/heads/"), DenyCurrentBranchKey)
+}
+
+// receivePack stages the pushed pack in the repository's .vec/tmp and stores
+// its objects, validated when receive.fsckObjects is set
+func (t *localTransport) receivePack(pack vechttp.PackWriter) error {
+	tmpFile, err := core.CreateTempFile(t.repo.Root, "vec-receive", ".pack")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary packfile: %w", err)
+	}
+	path := tmpFile.Name()
+	defer core.RemoveTempFile(path)
+
+	err = pack(tmpFile)
+	if closeErr := tmpFile.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write packfile: %w", err)
+	}
+	if err := unpackPackfileRepo(t.repo, path, "receive.fsckObjects"); err != nil {
+		return fmt.Errorf("failed to store pushed objects in '%s': %w", t.url, err)
+	}
+	return nil
+}
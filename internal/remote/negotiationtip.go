@@ -0,0 +1,78 @@
+package remote
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// NegotiationTipKey lists the local refs whose tips seed fetch negotiation
+const NegotiationTipKey = "fetch.negotiationTip"
+
+// negotiationTipsRepo returns the negotiation tip patterns: opts when given,
+// else the comma or space separated fetch.negotiationTip. None means every
+// local ref takes part.
+func negotiationTipsRepo(repo *core.Repository, opts FetchOptions) ([]string, error) {
+	patterns := opts.NegotiationTips
+	if len(patterns) == 0 {
+		value, err := repo.GetConfig(NegotiationTipKey)
+		if err != nil {
+			return nil, core.ConfigError("failed to read "+NegotiationTipKey, err)
+		}
+		patterns = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, core.ConfigError(fmt.Sprintf("invalid negotiation tip '%s'", pattern), err)
+		}
+	}
+	return patterns, nil
+}
+
+// matchesNegotiationTip reports whether refName matches one of patterns,
+// either in full or without its refs/heads/, refs/remotes/ or refs/tags/
+// prefix, so "origin/*" selects the remote-tracking refs of origin
+func matchesNegotiationTip(refName string, patterns []string) bool {
+	short := refName
+	for _, prefix := range []string{"refs/heads/", "refs/remotes/", "refs/tags/"} {
+		if strings.HasPrefix(refName, prefix) {
+			short = strings.TrimPrefix(refName, prefix)
+			break
+		}
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, refName); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, short); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiationRefsRepo returns the local refs sent as haves during
+// negotiation, restricted to the negotiation tips when any are set
+func negotiationRefsRepo(repo *core.Repository, opts FetchOptions) (map[string]string, error) {
+	localRefs, err := getLocalRefsRepo(repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local refs: %w", err)
+	}
+	patterns, err := negotiationTipsRepo(repo, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return localRefs, nil
+	}
+
+	tips := make(map[string]string)
+	for name, hash := range localRefs {
+		if matchesNegotiationTip(name, patterns) {
+			tips[name] = hash
+		}
+	}
+	return tips, nil
+}
@@ -0,0 +1,153 @@
+package remote
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/config"
+)
+
+// PrefetchRefPrefix holds the branches prefetched from each remote, as
+// refs/prefetch/<remote>/<branch>
+const PrefetchRefPrefix = "refs/prefetch/"
+
+// PrefetchResult reports what prefetching a remote did
+type PrefetchResult struct {
+	Remote  string
+	Objects int // Objects downloaded
+	Updated int // Prefetch refs written
+	Pruned  int // Prefetch refs of branches the remote no longer has
+}
+
+// PrefetchEnabledRepo reports whether remote.<name>.prefetch, true by
+// default, leaves remoteName in background prefetching
+func PrefetchEnabledRepo(repo *core.Repository, remoteName string) bool {
+	value, err := repo.GetConfig(fmt.Sprintf("remote.%s.prefetch", remoteName))
+	if err != nil {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "false", "no", "off", "0":
+		return false
+	}
+	return true
+}
+
+// PrefetchRepo downloads the branches of remoteName and points
+// refs/prefetch/<remoteName>/ at them, leaving its remote-tracking refs,
+// tags and FETCH_HEAD alone. A later fetch offers the prefetch refs as haves,
+// so it only transfers what changed since.
+func PrefetchRepo(repo *core.Repository, remoteName string) (*PrefetchResult, error) {
+	cfg, err := config.LoadConfigRepo(repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	remoteURL, err := cfg.GetRemoteURL(remoteName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get remote URL: %w", err)
+	}
+	advertised, _, err := fetchRemoteRefsRepo(repo, remoteURL, remoteName, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch remote refs: %w", err)
+	}
+	branches, _, _ := splitFetchRefs(advertised)
+
+	localRefs, err := negotiationRefsRepo(repo, FetchOptions{})
+	if err != nil {
+		return nil, err
+	}
+	missing, err := negotiateFetch(remoteURL, remoteName, branches, localRefs, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to negotiate fetch: %w", err)
+	}
+	result := &PrefetchResult{Remote: remoteName, Objects: len(missing)}
+	if len(missing) > 0 {
+		packPath, _, err := fetchPackfileRepo(repo, remoteURL, remoteName, missing, cfg, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch packfile: %w", err)
+		}
+		defer core.RemoveTempFile(packPath)
+		if err := UnpackPackfileRepo(repo, packPath); err != nil {
+			return nil, fmt.Errorf("failed to unpack packfile: %w", err)
+		}
+	}
+
+	prefix := PrefetchRefPrefix + remoteName + "/"
+	current, err := repo.ListRefs(prefix)
+	if err != nil {
+		return nil, core.RefError("failed to list prefetch refs", err)
+	}
+	for refName, hash := range branches {
+		localRef := prefix + strings.TrimPrefix(refName, "refs/heads/")
+		if value, _ := readLocalRef(repo, localRef); value == hash {
+			continue
+		}
+		if err := repo.WriteRef(localRef, hash); err != nil {
+			return nil, fmt.Errorf("failed to update prefetch ref %s: %w", localRef, err)
+		}
+		result.Updated++
+	}
+	for _, ref := range current {
+		if _, ok := branches["refs/heads/"+strings.TrimPrefix(ref.Name, prefix)]; ok {
+			continue
+		}
+		if err := removeRefFile(repo, ref.Name); err != nil {
+			return nil, err
+		}
+		result.Pruned++
+	}
+	return result, nil
+}
+
+// PrunePrefetchRefsRepo removes the prefetch refs of remotes that are no
+// longer configured and returns how many went
+func PrunePrefetchRefsRepo(repo *core.Repository) (int, error) {
+	cfg, err := config.LoadConfigRepo(repo)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load config: %w", err)
+	}
+	refs, err := repo.ListRefs(PrefetchRefPrefix)
+	if err != nil {
+		return 0, core.RefError("failed to list prefetch refs", err)
+	}
+	pruned := 0
+	for _, ref := range refs {
+		remoteName, _, _ := strings.Cut(strings.TrimPrefix(ref.Name, PrefetchRefPrefix), "/")
+		if _, ok := cfg.Remotes[remoteName]; ok {
+			continue
+		}
+		if err := removeRefFile(repo, ref.Name); err != nil {
+			return pruned, err
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+// readLocalRef returns the hash a ref file holds, "" when it doesn't exist
+func readLocalRef(repo *core.Repository, refName string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(repo.VecDir, filepath.FromSlash(refName)))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(content)), err
+}
+
+// removeRefFile deletes a loose ref and the directories it leaves empty
+// below refs/
+func removeRefFile(repo *core.Repository, refName string) error {
+	path := filepath.Join(repo.VecDir, filepath.FromSlash(refName))
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return core.RefError(fmt.Sprintf("failed to remove %s", refName), err)
+	}
+	refsDir := filepath.Join(repo.VecDir, "refs")
+	for dir := filepath.Dir(path); dir != refsDir && strings.HasPrefix(dir, refsDir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
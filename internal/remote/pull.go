@@ -3,16 +3,19 @@ package remote
 
 import (
 	"fmt"
-	"log"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/NahomAnteneh/vec/core"
 	"github.com/NahomAnteneh/vec/internal/config"
-	vechttp "github.com/NahomAnteneh/vec/internal/remote/http"
+	"github.com/NahomAnteneh/vec/internal/merge"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/rebase"
 )
 
+// PullRebaseKey, when true, makes pull rebase the current branch onto the
+// fetched one instead of merging it
+const PullRebaseKey = "pull.rebase"
+
 // Pull fetches changes from a remote repository and updates the current branch
 // Legacy function that uses the repository root path
 func Pull(repoRoot, remoteName, branchName string, verbose bool) error {
@@ -21,153 +24,191 @@ func Pull(repoRoot, remoteName, branchName string, verbose bool) error {
 	return PullRepo(repo, remoteName, branchName, verbose)
 }
 
+// PullOptions contains options for the pull operation
+type PullOptions struct {
+	Verbose  bool // Be verbose
+	DryRun   bool // Read the remote refs and report the update without fetching or writing
+	Rebase   bool // Rebase onto the fetched branch, whatever pull.rebase says
+	NoRebase bool // Merge the fetched branch, whatever pull.rebase says
+
+	NoVerifySignatures bool // Skip merge.verifySignatures for the pulled commits
+
+	// Rebased reports how a rebasing pull ended; without it a rebase stopped
+	// at a conflict is returned as an error
+	Rebased func(result *rebase.Result) error
+}
+
 // PullRepo fetches changes from a remote repository using the Repository context
 func PullRepo(repo *core.Repository, remoteName, branchName string, verbose bool) error {
-	// Load configuration
-	cfg, err := config.LoadConfig(repo.Root)
-	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
-	}
+	return PullWithOptionsRepo(repo, remoteName, branchName, PullOptions{Verbose: verbose})
+}
 
-	// Get remote URL
-	remoteURL, err := cfg.GetRemoteURL(remoteName)
+// PullWithOptionsRepo fetches a branch of a remote and integrates it into the
+// current branch: a fast-forward when the current branch is behind, otherwise
+// a merge, or a rebase with opts.Rebase or pull.rebase. An empty remoteName
+// or branchName is taken from the current branch's upstream, falling back to
+// origin and the current branch's own name.
+func PullWithOptionsRepo(repo *core.Repository, remoteName, branchName string, opts PullOptions) error {
+	if opts.Rebase && opts.NoRebase {
+		return fmt.Errorf("--rebase and --no-rebase cannot be used together")
+	}
+	currentBranch, err := repo.GetCurrentBranch()
 	if err != nil {
-		return fmt.Errorf("failed to get remote URL: %w", err)
+		return fmt.Errorf("failed to determine current branch: %w", err)
 	}
-
-	if remoteURL == "" {
-		return fmt.Errorf("remote '%s' not found or has no URL configured", remoteName)
+	if currentBranch == "(HEAD detached)" {
+		return fmt.Errorf("cannot pull in detached HEAD state; check out a branch first")
 	}
 
-	// Fetch the latest changes from remote
-	log.Printf("Fetching from %s/%s", remoteName, branchName)
-
-	// First check if we have authentication token
-	_, err = GetAuthToken(remoteName)
+	upstream, err := repo.GetBranchUpstream(currentBranch)
 	if err != nil {
-		// If no token, attempt to get user credentials
-		log.Printf("No auth token found. Please login first with 'vec login %s'", remoteName)
-		return fmt.Errorf("authentication required: %w", err)
+		return err
 	}
-
-	// Create HTTP client
-	client := vechttp.NewClient(remoteURL, remoteName, cfg)
-
-	// Fetch references to see what's available
-	refs, err := client.FetchRefs()
-	if err != nil {
-		// If unauthorized, try to refresh token
-		if strings.Contains(err.Error(), "401") || strings.Contains(err.Error(), "unauthorized") {
-			log.Printf("Token expired, attempting to refresh...")
-			_, err := RefreshAuthToken(remoteName)
-			if err != nil {
-				log.Printf("Token refresh failed: %v", err)
-				log.Printf("Please login again with 'vec login %s'", remoteName)
-				return fmt.Errorf("authentication failed: %w", err)
-			}
-
-			// Retry with new token
-			refs, err = client.FetchRefs()
-			if err != nil {
-				return fmt.Errorf("failed to fetch refs after token refresh: %w", err)
-			}
-		} else {
-			return fmt.Errorf("failed to fetch refs: %w", err)
+	if remoteName == "" {
+		remoteName = DefaultRemoteName
+		if upstream != nil {
+			remoteName = upstream.Remote
 		}
 	}
-
-	// Check if the target branch exists on the remote
-	targetRef := fmt.Sprintf("refs/heads/%s", branchName)
-	remoteCommitID := ""
-
-	// Refs is a map[string]string, not a slice of structs
-	for refName, commitID := range refs {
-		if refName == targetRef {
-			remoteCommitID = commitID
-			break
+	if branchName == "" {
+		branchName = currentBranch
+		if upstream != nil && upstream.Remote == remoteName {
+			branchName = upstream.Branch()
 		}
 	}
+	useRebase, err := pullRebasesRepo(repo, opts)
+	if err != nil {
+		return err
+	}
 
-	if remoteCommitID == "" {
-		return fmt.Errorf("branch '%s' not found on remote '%s'", branchName, remoteName)
+	if opts.DryRun {
+		return pullDryRunRepo(repo, remoteName, branchName, currentBranch, useRebase)
 	}
 
-	// Get the current commit ID for the branch
-	branchPath := filepath.Join(repo.Root, ".vec", "refs", "heads", branchName)
-	localCommitID := ""
+	if err := FetchBranchWithOptionsRepo(repo, remoteName, branchName, FetchOptions{Verbose: opts.Verbose}); err != nil {
+		return fmt.Errorf("failed to fetch '%s/%s': %w", remoteName, branchName, err)
+	}
+	remoteCommit, err := core.ReadRefValue(repo.Root, fmt.Sprintf("refs/remotes/%s/%s", remoteName, branchName))
+	if err != nil {
+		return core.RefError(fmt.Sprintf("failed to read '%s/%s'", remoteName, branchName), err)
+	}
+	localCommit, err := repo.ReadHead()
+	if err != nil {
+		return core.RefError("failed to read HEAD", err)
+	}
+	core.RecordAudit(repo.Root, core.AuditPull, remoteName+":refs/heads/"+branchName, localCommit, remoteCommit)
 
-	// Check if branch file exists
-	if fileInfo, err := os.Stat(branchPath); err == nil && !fileInfo.IsDir() {
-		// Read the commit ID from the branch file
-		data, err := os.ReadFile(branchPath)
-		if err != nil {
-			return fmt.Errorf("failed to read branch file: %w", err)
+	if localCommit == "" {
+		// No commits yet: the branch starts at the pulled commit
+		if !opts.NoVerifySignatures {
+			if err := merge.VerifyIncomingSignaturesRepo(repo, localCommit, remoteCommit); err != nil {
+				return err
+			}
+		}
+		if err := repo.WriteRef("refs/heads/"+currentBranch, remoteCommit); err != nil {
+			return fmt.Errorf("failed to update branch reference: %w", err)
+		}
+		if err := merge.CheckoutCommit(repo, remoteCommit); err != nil {
+			return fmt.Errorf("failed to checkout working tree: %w", err)
 		}
-		localCommitID = strings.TrimSpace(string(data))
+		fmt.Printf("Branch '%s' set to %s from '%s/%s'\n", currentBranch, shortCommitID(remoteCommit), remoteName, branchName)
+		return nil
 	}
-
-	// If already up to date, nothing to do
-	if localCommitID == remoteCommitID {
-		log.Printf("Branch '%s' is already up to date with '%s/%s'", branchName, remoteName, branchName)
+	if upToDate, err := objects.IsAncestorRepo(repo, remoteCommit, localCommit); err != nil {
+		return core.ObjectError("failed to compare histories", err)
+	} else if upToDate {
+		fmt.Println("Already up to date.")
 		return nil
 	}
 
-	// Fetch objects from remote
-	if err := fetchObjectsForPullRepo(repo, remoteURL, remoteName, localCommitID, remoteCommitID, cfg); err != nil {
-		return fmt.Errorf("failed to fetch objects: %w", err)
+	if useRebase {
+		return pullRebaseRepo(repo, localCommit, remoteCommit, opts)
 	}
+	return MergeRemoteBranchRepo(repo, remoteName, branchName, false, opts.NoVerifySignatures)
+}
 
-	// Update the branch reference
-	if err := os.MkdirAll(filepath.Dir(branchPath), 0755); err != nil {
-		return fmt.Errorf("failed to create branch directory: %w", err)
+// pullRebasesRepo reports whether a pull with opts rebases, --rebase and
+// --no-rebase taking precedence over pull.rebase
+func pullRebasesRepo(repo *core.Repository, opts PullOptions) (bool, error) {
+	if opts.Rebase || opts.NoRebase {
+		return opts.Rebase, nil
 	}
-
-	if err := os.WriteFile(branchPath, []byte(remoteCommitID), 0644); err != nil {
-		return fmt.Errorf("failed to update branch reference: %w", err)
+	value, err := repo.GetConfig(PullRebaseKey)
+	if err != nil {
+		return false, core.ConfigError("failed to read "+PullRebaseKey, err)
 	}
-
-	log.Printf("Successfully updated branch '%s' to commit %s", branchName, remoteCommitID)
-	return nil
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "false", "no", "off", "0":
+		return false, nil
+	case "true", "yes", "on", "1":
+		return true, nil
+	}
+	return false, core.ConfigError(fmt.Sprintf("invalid %s value '%s' (expected true or false)", PullRebaseKey, value), nil)
 }
 
-// Legacy function that uses the repository root path
-func fetchObjectsForPull(repoRoot, remoteURL, remoteName, localCommit, remoteCommit string, cfg *config.Config) error {
-	repo := core.NewRepository(repoRoot)
-	return fetchObjectsForPullRepo(repo, remoteURL, remoteName, localCommit, remoteCommit, cfg)
+// pullRebaseRepo replays the commits of HEAD that remoteCommit lacks on top
+// of it
+func pullRebaseRepo(repo *core.Repository, localCommit, remoteCommit string, opts PullOptions) error {
+	// The rebase doesn't check the commits it builds on, so check them here
+	if !opts.NoVerifySignatures {
+		if err := merge.VerifyIncomingSignaturesRepo(repo, localCommit, remoteCommit); err != nil {
+			return err
+		}
+	}
+	result, err := rebase.StartRepo(repo, rebase.Options{Upstream: remoteCommit}, nil)
+	if err != nil {
+		return err
+	}
+	if opts.Rebased != nil {
+		return opts.Rebased(result)
+	}
+	if result.Stopped != nil {
+		return fmt.Errorf("could not apply %s... %s; resolve the conflicts, then run 'vec rebase --continue'",
+			shortCommitID(result.Stopped.Commit), result.Stopped.Subject)
+	}
+	return nil
 }
 
-// fetchObjectsForPullRepo fetches objects from the remote using Repository context
-func fetchObjectsForPullRepo(repo *core.Repository, remoteURL, remoteName, localCommit, remoteCommit string, cfg *config.Config) error {
-	// Create a map for negotiation
-	remoteRefs := map[string]string{"want": remoteCommit}
-	localRefs := map[string]string{}
-
-	if localCommit != "" {
-		localRefs["have"] = localCommit
+// pullDryRunRepo reports what a pull of remoteName's branchName into
+// currentBranch would do, from the refs the remote advertises
+func pullDryRunRepo(repo *core.Repository, remoteName, branchName, currentBranch string, useRebase bool) error {
+	cfg, err := config.LoadConfigRepo(repo)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
 	}
-
-	// Negotiate which objects we need to fetch
-	objectsList, err := vechttp.NegotiateFetch(remoteURL, remoteName, remoteRefs, localRefs, cfg)
+	remoteURL, err := cfg.GetRemoteURL(remoteName)
 	if err != nil {
-		return fmt.Errorf("failed to negotiate objects: %w", err)
+		return fmt.Errorf("failed to get remote URL: %w", err)
 	}
-
-	// If no objects to fetch, we're done
-	if len(objectsList) == 0 {
-		fmt.Println("No new objects to fetch")
-		return nil
+	transport, err := openTransport(remoteURL, remoteName, cfg)
+	if err != nil {
+		return err
 	}
-
-	// Fetch packfile containing the objects
-	packfile, err := vechttp.FetchPackfile(remoteURL, remoteName, objectsList, cfg)
+	refs, err := transport.GetRefs()
 	if err != nil {
-		return fmt.Errorf("failed to fetch packfile: %w", err)
+		return fmt.Errorf("failed to fetch refs: %w", err)
 	}
-
-	// Process the packfile to extract objects
-	if err := unpackPackfileRepo(repo, packfile); err != nil {
-		return fmt.Errorf("failed to unpack packfile: %w", err)
+	remoteCommit, ok := refs["refs/heads/"+branchName]
+	if !ok {
+		return fmt.Errorf("branch '%s' not found on remote '%s'", branchName, remoteName)
+	}
+	localCommit, err := repo.ReadHead()
+	if err != nil {
+		return core.RefError("failed to read HEAD", err)
+	}
+
+	switch {
+	case localCommit == remoteCommit:
+		fmt.Printf("Branch '%s' is already up to date with '%s/%s'\n", currentBranch, remoteName, branchName)
+	case localCommit == "":
+		fmt.Printf("Would create branch '%s' at %s from '%s/%s'\n",
+			currentBranch, shortCommitID(remoteCommit), remoteName, branchName)
+	case useRebase:
+		fmt.Printf("Would fetch objects and rebase '%s' at %s onto '%s/%s' at %s\n",
+			currentBranch, shortCommitID(localCommit), remoteName, branchName, shortCommitID(remoteCommit))
+	default:
+		fmt.Printf("Would fetch objects and merge '%s/%s' at %s into '%s' at %s\n",
+			remoteName, branchName, shortCommitID(remoteCommit), currentBranch, shortCommitID(localCommit))
 	}
-
 	return nil
 }
@@ -2,9 +2,8 @@
 package remote
 
 import (
-	"bytes"
-	"compress/zlib"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -23,18 +22,30 @@ import (
 
 // PushResult contains the result of a push operation
 type PushResult struct {
-	Success bool     `json:"success"`
-	Message string   `json:"message"`
-	Errors  []string `json:"errors,omitempty"`
+	Success bool                `json:"success"`
+	Message string              `json:"message"`
+	Errors  []string            `json:"errors,omitempty"`
+	Refs    []vechttp.RefStatus `json:"refs,omitempty"`
 }
 
 // PushOptions configures the behavior of the push operation
 type PushOptions struct {
-	Force    bool
-	Verbose  bool
-	Timeout  time.Duration
-	DryRun   bool
-	Progress bool
+	Force       bool
+	Verbose     bool
+	Timeout     time.Duration
+	DryRun      bool
+	Progress    bool
+	SetUpstream bool // Record the pushed branch as upstream once the push succeeds
+	NoVerify    bool // Skip the pre-push hook
+	NoSizeCheck bool // Skip the push.maxObjectSize and push.maxPackSize checks
+	Atomic      bool // Update all refs of the push or none of them
+
+	// Lease, if set, allows a non-fast-forward update only while the remote
+	// branch is still where we last saw it (--force-with-lease)
+	Lease *PushLease
+
+	// RemoteBranch is the destination branch on the remote; defaults to the local name
+	RemoteBranch string
 }
 
 // DefaultPushOptions returns the default push options
@@ -63,139 +74,179 @@ func PushWithOptionsRepo(repo *core.Repository, remoteName, branchName string, o
 
 // PushRepo sends local commits to a remote repository
 func PushRepo(repo *core.Repository, remoteName, branchName string, opts PushOptions) error {
+	_, err := PushBranchRepo(repo, remoteName, branchName, opts)
+	return err
+}
+
+// PushBranchRepo pushes one branch and reports what happened to the remote
+// ref. The update is returned once the push got far enough to decide it, also
+// alongside the error when the update was rejected.
+func PushBranchRepo(repo *core.Repository, remoteName, branchName string, opts PushOptions) (*RefUpdate, error) {
 	// If no branch specified, use current branch
 	if branchName == "" {
 		var err error
 		branchName, err = repo.GetCurrentBranch()
 		if err != nil {
-			return fmt.Errorf("failed to get current branch: %w", err)
+			return nil, fmt.Errorf("failed to get current branch: %w", err)
 		}
 		if branchName == "(HEAD detached)" {
-			return fmt.Errorf("cannot push from detached HEAD state")
+			return nil, fmt.Errorf("cannot push from detached HEAD state")
 		}
 	}
-	
+	remoteBranch := opts.RemoteBranch
+	if remoteBranch == "" {
+		remoteBranch = branchName
+	}
+
+	client, remoteRefs, err := openPushRemoteRepo(repo, remoteName, opts)
+	if err != nil {
+		return nil, err
+	}
+	return pushRefRepo(repo, client, remoteRefs, remoteName, "refs/heads/"+branchName, "refs/heads/"+remoteBranch, opts)
+}
+
+// openPushRemoteRepo connects to remoteName and reads the refs it advertises.
+// A remote without refs yet yields an empty map.
+func openPushRemoteRepo(repo *core.Repository, remoteName string, opts PushOptions) (remoteTransport, map[string]string, error) {
 	// Load config
 	cfg, err := config.LoadConfig(repo.Root)
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
 	// Get remote URL
-	remoteURL, err := cfg.GetRemoteURL(remoteName)
+	remoteURL, err := cfg.GetRemotePushURL(remoteName)
 	if err != nil {
-		return fmt.Errorf("remote '%s' not found", remoteName)
+		return nil, nil, fmt.Errorf("remote '%s' not found", remoteName)
 	}
 
-	// Get local reference
-	refPath := filepath.Join("refs", "heads", branchName)
-	localCommit, err := utils.ReadRef(repo.Root, refPath)
+	client, err := openTransport(remoteURL, remoteName, cfg)
 	if err != nil {
-		return fmt.Errorf("failed to read local branch '%s': %w", branchName, err)
-	}
-	
-	// Create HTTP client
-	client := vechttp.NewClient(remoteURL, remoteName, cfg)
-	if opts.Verbose {
-		client.SetVerbose(true)
-	}
-	client.SetTimeout(opts.Timeout)
-	
-	// Get remote reference
-	var remoteCommit string
-	remoteRefs, err := client.GetRefs()
-	if err != nil {
-		if err != vechttp.ErrNotFound {
-			return fmt.Errorf("failed to get remote refs: %w", err)
-		}
-		// Remote ref not found - new branch
-	} else {
-		// Look for the branch in remote refs
-		remoteRefName := fmt.Sprintf("refs/heads/%s", branchName)
-		remoteCommit = remoteRefs[remoteRefName]
+		return nil, nil, err
 	}
-
-	// Check if update is needed
-	if localCommit == remoteCommit {
+	if httpClient, ok := client.(*vechttp.Client); ok {
 		if opts.Verbose {
-			fmt.Printf("Branch '%s' is already up to date on remote '%s'\n", branchName, remoteName)
+			httpClient.SetVerbose(true)
 		}
-		return nil
+		httpClient.SetTimeout(opts.Timeout)
 	}
 
-	// If not forcing, verify this is a fast-forward push
-	if !opts.Force && remoteCommit != "" {
-		isFastForward, err := isAncestor(repo.Root, remoteCommit, localCommit)
-		if err != nil {
-			return fmt.Errorf("failed to check if update is fast-forward: %w", err)
-		}
-		if !isFastForward {
-			return fmt.Errorf("non-fast-forward update - use --force to override")
+	remoteRefs, err := client.GetRefs()
+	if err != nil {
+		if !errors.Is(err, vechttp.ErrNotFound) {
+			return nil, nil, fmt.Errorf("failed to get remote refs: %w", describeTransportError(remoteName, err))
 		}
+		// Remote has no refs yet
+		remoteRefs = map[string]string{}
 	}
 
-	// Early return for dry run
-	if opts.DryRun {
-		if opts.Verbose {
-			if remoteCommit == "" {
-				fmt.Printf("Dry run: Would push new branch '%s' to remote '%s'\n", branchName, remoteName)
-			} else {
-				fmt.Printf("Dry run: Would update remote '%s' branch '%s' from %s to %s\n", 
-					remoteName, branchName, shortCommitID(remoteCommit), shortCommitID(localCommit))
-			}
-		}
-		return nil
-	}
-	
-	// Find all objects to send
-	if opts.Verbose {
-		fmt.Println("Determining objects to send...")
+	// The info endpoint is optional; it only lets us warn before packing
+	// objects for a push the server will refuse
+	if info, err := client.GetInfo(); err == nil && info.Archived {
+		fmt.Fprintf(os.Stderr, "warning: remote '%s' is archived and will likely refuse the push\n", remoteName)
+	} else if err != nil && opts.Verbose && !errors.Is(err, vechttp.ErrNotFound) {
+		fmt.Printf("Could not read repository info: %v\n", err)
 	}
+	return client, remoteRefs, nil
+}
 
-	objectsToSend, err := findObjectsToPush(repo.Root, localCommit, remoteCommit)
-	if err != nil {
-		return fmt.Errorf("failed to find objects to push: %w", err)
+// pushRefRepo updates remoteRef on the remote to the commit localRef points
+// at. Both are full ref names; branch-only behaviour (leases, remote-tracking
+// refs, upstream) applies when both are under refs/heads/.
+func pushRefRepo(repo *core.Repository, client remoteTransport, remoteRefs map[string]string,
+	remoteName, localRef, remoteRef string, opts PushOptions) (*RefUpdate, error) {
+	updates, err := pushRefsRepo(repo, client, remoteRefs, remoteName, []pushRef{{local: localRef, remote: remoteRef}}, opts)
+	if len(updates) == 0 {
+		return nil, err
 	}
+	return updates[0], err
+}
 
-	if len(objectsToSend) == 0 {
-		if opts.Verbose {
-			fmt.Println("No objects to send")
-		}
+// zeroObjectID stands for a missing ref in pre-push hook input
+var zeroObjectID = strings.Repeat("0", 64)
+
+// runPrePushHookRepo runs the pre-push hook once for the updates of a push,
+// passing the remote name and URL as arguments and a "<local ref> <local id>
+// <remote ref> <remote id>" line per update on stdin. An empty commit is
+// written as all zeros.
+func runPrePushHookRepo(repo *core.Repository, client remoteTransport, remoteName string, pushing []*pendingPush, opts PushOptions) error {
+	if opts.NoVerify {
 		return nil
 	}
-
-	// Create packfile
-	if opts.Progress || opts.Verbose {
-		fmt.Printf("Creating packfile with %d objects...\n", len(objectsToSend))
+	var stdin strings.Builder
+	for _, p := range pushing {
+		localRef, localCommit, remoteCommit := p.local, p.localCommit, p.remoteCommit
+		if localCommit == "" {
+			localRef, localCommit = "(delete)", zeroObjectID
+		}
+		if remoteCommit == "" {
+			remoteCommit = zeroObjectID
+		}
+		fmt.Fprintf(&stdin, "%s %s %s %s\n", localRef, localCommit, p.remote, remoteCommit)
 	}
+	return repo.RunHook(core.HookPrePush, core.HookOptions{
+		Args:  []string{remoteName, client.RemoteURL()},
+		Stdin: strings.NewReader(stdin.String()),
+		Env:   map[string]string{"VEC_PUSH_REMOTE": remoteName, "VEC_PUSH_URL": client.RemoteURL()},
+	})
+}
 
-	packData, err := packfile.CreatePackfile(repo.Root, objectsToSend)
-	if err != nil {
-		return fmt.Errorf("failed to create packfile: %w", err)
+// shortRefName strips the refs/heads/ or refs/tags/ prefix for display
+func shortRefName(ref string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/"} {
+		if strings.HasPrefix(ref, prefix) {
+			return strings.TrimPrefix(ref, prefix)
+		}
 	}
+	return ref
+}
 
-	// Send packfile and update refs
-	if opts.Progress || opts.Verbose {
-		fmt.Printf("Sending objects to remote '%s'...\n", remoteName)
+// finishPushRepo updates the remote-tracking ref after a successful push and
+// records the upstream when requested by --set-upstream or push.autoSetupRemote.
+func finishPushRepo(repo *core.Repository, remoteName, branchName, remoteBranch, commit string, opts PushOptions) error {
+	trackingRef := filepath.Join("refs", "remotes", remoteName, remoteBranch)
+	if err := repo.WriteRef(trackingRef, commit); err != nil {
+		return fmt.Errorf("failed to update remote-tracking ref: %w", err)
 	}
 
-	// Perform push
-	result, err := client.Push(branchName, remoteCommit, localCommit, packData)
-	if err != nil {
-		return fmt.Errorf("push failed: %w", err)
+	setUpstream := opts.SetUpstream
+	if !setUpstream {
+		auto, err := repo.GetConfig("push.autoSetupRemote")
+		if err != nil {
+			return fmt.Errorf("failed to read push.autoSetupRemote: %w", err)
+		}
+		if strings.EqualFold(auto, "true") {
+			upstream, err := repo.GetBranchUpstream(branchName)
+			if err != nil {
+				return err
+			}
+			setUpstream = upstream == nil
+		}
 	}
-
-	if !result.Success {
-		return fmt.Errorf("push rejected: %s", result.Message)
+	if !setUpstream {
+		return nil
 	}
 
+	if err := repo.SetConfig(fmt.Sprintf("branch.%s.remote", branchName), remoteName, false); err != nil {
+		return fmt.Errorf("failed to set upstream for '%s': %w", branchName, err)
+	}
+	if err := repo.SetConfig(fmt.Sprintf("branch.%s.merge", branchName), "refs/heads/"+remoteBranch, false); err != nil {
+		return fmt.Errorf("failed to set upstream for '%s': %w", branchName, err)
+	}
 	if opts.Verbose || opts.Progress {
-		fmt.Printf("Branch '%s' pushed to '%s'\n", branchName, remoteName)
+		fmt.Printf("Branch '%s' set up to track '%s/%s'.\n", branchName, remoteName, remoteBranch)
 	}
-
 	return nil
 }
 
+// describeLeaseValue renders a lease commit for messages
+func describeLeaseValue(commit string) string {
+	if commit == "" {
+		return "(none)"
+	}
+	return shortCommitID(commit)
+}
+
 // shortCommitID returns a shortened commit ID for display
 func shortCommitID(commit string) string {
 	if len(commit) <= 7 {
@@ -204,86 +255,54 @@ func shortCommitID(commit string) string {
 	return commit[:7]
 }
 
-// isAncestor checks if possibleAncestor is an ancestor of commit
+// isAncestor checks if possibleAncestor is an ancestor of commit.
+// Missing parents or cycles are reported as objects.ErrCorruptGraph.
 func isAncestor(repoRoot, possibleAncestor, commit string) (bool, error) {
-	if possibleAncestor == "" || commit == "" {
-		return false, nil
-	}
-	
-	// Quick check: if they're the same commit
-	if possibleAncestor == commit {
-		return true, nil
-	}
-	
-	// Get commit history
-	visited := make(map[string]bool)
-	stack := []string{commit}
-	
-	for len(stack) > 0 {
-		// Pop current commit
-		current := stack[len(stack)-1]
-		stack = stack[:len(stack)-1]
-		
-		// Skip if already visited
-		if visited[current] {
-			continue
-		}
-		visited[current] = true
-		
-		// Check if this is the ancestor we're looking for
-		if current == possibleAncestor {
-			return true, nil
-		}
-		
-		// Get parents of this commit
-		commitObj, err := objects.GetCommit(repoRoot, current)
-		if err != nil {
-			continue // Skip on error
-		}
-		
-		// Add parents to stack
-		stack = append(stack, commitObj.Parents...)
-	}
-	
-	return false, nil
+	return objects.IsAncestorRepo(core.NewRepository(repoRoot), possibleAncestor, commit)
 }
 
-// findObjectsToPush finds all objects that need to be sent to the remote
-func findObjectsToPush(repoRoot, localCommit, remoteCommit string) ([]string, error) {
-	// Get all objects reachable from local commit
-	localObjects, err := objects.FindReachableObjects(repoRoot, localCommit)
+// findObjectsToPush finds all objects that need to be sent to the remote:
+// those reachable from tips but not from haves, the remote commits known
+// locally. The bitmap index gc writes saves walking both histories.
+func findObjectsToPush(repo *core.Repository, tips, haves []string) ([]string, error) {
+	listed, err := objects.ListObjectsRepo(repo, tips, haves, false)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find local objects: %w", err)
 	}
-	
-	// If no remote commit, send all local objects
-	if remoteCommit == "" {
-		return localObjects, nil
+	objectsToSend := make([]string, 0, len(listed))
+	for _, obj := range listed {
+		objectsToSend = append(objectsToSend, obj.Hash)
 	}
-	
-	// Get all objects reachable from remote commit
-	remoteObjects, err := objects.FindReachableObjects(repoRoot, remoteCommit)
+	return objectsToSend, nil
+}
+
+// pruneRemoteObjects drops objects the server already has, e.g. through other
+// branches, so they are not packed again. The pushed commits themselves are
+// always kept. The check is an optimisation: if the server doesn't support it or it
+// fails, every object is sent.
+func pruneRemoteObjects(client remoteTransport, objectHashes, tips []string, opts PushOptions) []string {
+	existing, err := client.ObjectsExist(objectHashes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find remote objects: %w", err)
-	}
-	
-	// Find the difference (objects in local but not in remote)
-	objectsToSend := make([]string, 0)
-	
-	for _, obj := range localObjects {
-		found := false
-		for _, remote := range remoteObjects {
-			if obj == remote {
-				found = true
-				break
-			}
+		if opts.Verbose && !errors.Is(err, vechttp.ErrNotFound) {
+			fmt.Printf("Could not check which objects the remote has, sending all: %v\n", err)
 		}
-		if !found {
-			objectsToSend = append(objectsToSend, obj)
+		return objectHashes
+	}
+
+	keep := make(map[string]bool, len(tips))
+	for _, tip := range tips {
+		keep[tip] = true
+	}
+	pruned := make([]string, 0, len(objectHashes))
+	for _, hash := range objectHashes {
+		if keep[hash] || !existing[hash] {
+			pruned = append(pruned, hash)
 		}
 	}
-	
-	return objectsToSend, nil
+	if opts.Verbose && len(pruned) < len(objectHashes) {
+		fmt.Printf("Remote already has %d of %d objects\n", len(objectHashes)-len(pruned), len(objectHashes))
+	}
+	return pruned
 }
 
 // formatCommitHash formats a commit hash for display
@@ -410,10 +429,14 @@ func getTagsForPush(repoRoot string, objectHashes []string) ([]string, error) {
 			}
 
 			tagHash := strings.TrimSpace(string(tagContents))
+			target := tagHash
+			if peeled, _, err := objects.PeelTagRepo(core.NewRepository(repoRoot), tagHash); err == nil {
+				target = peeled
+			}
 
-			// Check if this tag points to any object we're sending
+			// Check if this tag, or the object an annotated tag points to, is being sent
 			for _, objHash := range objectHashes {
-				if tagHash == objHash {
+				if tagHash == objHash || target == objHash {
 					// Add tag object to the list
 					tagObjects = append(tagObjects, tagHash)
 					break
@@ -498,6 +521,9 @@ func getTreeObjectsRecursive(repoRoot, treeHash string) ([]string, error) {
 
 	// Process each entry in the tree
 	for _, entry := range tree.Entries {
+		if entry.IsGitlink() {
+			continue
+		}
 		objectsList = append(objectsList, entry.Hash)
 
 		// If entry is a subtree, process it recursively
@@ -520,8 +546,7 @@ func createPackfile(repoRoot string, objectHashes []string) ([]byte, error) {
 	}
 
 	// Create a temporary file to store the packfile
-	tempDir := os.TempDir()
-	tempFile, err := os.CreateTemp(tempDir, "vec-packfile-*.pack")
+	tempFile, err := core.CreateTempFile(repoRoot, "vec-packfile", ".pack")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temporary packfile: %w", err)
 	}
@@ -529,7 +554,7 @@ func createPackfile(repoRoot string, objectHashes []string) ([]byte, error) {
 	tempFile.Close() // Close immediately as CreatePackfile will open it
 
 	// Clean up the temporary file when done
-	defer os.Remove(tempFilePath)
+	defer core.RemoveTempFile(tempFilePath)
 
 	// Create index file alongside the packfile
 	createIndex := true
@@ -564,6 +589,7 @@ func convertPushResult(result *vechttp.PushResult) *PushResult {
 		Success: result.Success,
 		Message: result.Message,
 		Errors:  result.Errors,
+		Refs:    result.Refs,
 	}
 }
 
@@ -601,172 +627,19 @@ func isFastForwardUpdateRepo(repo *core.Repository, localCommitHash, remoteCommi
 
 // isCommitAncestorRepo checks if one commit is an ancestor of another using Repository context
 func isCommitAncestorRepo(repo *core.Repository, ancestorHash, descendantHash string) (bool, error) {
-	// Follow the commit chain to see if ancestorHash appears
-	visited := make(map[string]bool)
-	queue := []string{descendantHash}
-
-	for len(queue) > 0 {
-		hash := queue[0]
-		queue = queue[1:]
-
-		if hash == ancestorHash {
-			return true, nil
-		}
-
-		if visited[hash] {
-			continue
-		}
-		visited[hash] = true
-
-		commit, err := objects.GetCommitRepo(repo, hash)
-		if err != nil {
-			return false, fmt.Errorf("failed to get commit %s: %w", hash, err)
-		}
-
-		queue = append(queue, commit.Parents...)
-	}
-
-	return false, nil
-}
-
-// getObjectsToSendRepo gets objects that need to be sent to the remote using Repository context
-func getObjectsToSendRepo(repo *core.Repository, localCommitHash, remoteCommitHash string) ([]string, error) {
-	// Get all objects reachable from local commit
-	localObjects, err := findReachableObjectsRepo(repo, localCommitHash)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find local objects: %w", err)
-	}
-
-	// If remote has no commit yet, send all objects
-	if remoteCommitHash == "" {
-		return localObjects, nil
-	}
-
-	// Get all objects reachable from remote commit
-	remoteObjects, err := findReachableObjectsRepo(repo, remoteCommitHash)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find remote objects: %w", err)
-	}
-
-	// Filter out objects already on remote
-	var objectsToSend []string
-	for _, obj := range localObjects {
-		found := false
-		for _, remoteObj := range remoteObjects {
-			if obj == remoteObj {
-				found = true
-				break
-			}
-		}
-		if !found {
-			objectsToSend = append(objectsToSend, obj)
-		}
-	}
-
-	return objectsToSend, nil
-}
-
-// findReachableObjectsRepo finds all objects reachable from a commit using Repository context
-func findReachableObjectsRepo(repo *core.Repository, commitHash string) ([]string, error) {
-	if commitHash == "" {
-		return []string{}, nil
-	}
-
-	objectsMap := make(map[string]bool)
-	visited := make(map[string]bool)
-	queue := []string{commitHash}
-
-	for len(queue) > 0 {
-		hash := queue[0]
-		queue = queue[1:]
-
-		if visited[hash] {
-			continue
-		}
-		visited[hash] = true
-		objectsMap[hash] = true
-
-		// Get object type by reading the object header
-		objPath := filepath.Join(repo.VecDir, "objects", hash[:2], hash[2:])
-		if !utils.FileExists(objPath) {
-			return nil, fmt.Errorf("object %s not found", hash)
-		}
-
-		// Read and decompress the object file
-		file, err := os.Open(objPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open object file %s: %w", hash, err)
-		}
-		defer file.Close()
-
-		// Create zlib reader
-		zr, err := zlib.NewReader(file)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create zlib reader for %s: %w", hash, err)
-		}
-		defer zr.Close()
-
-		// Read decompressed content
-		content, err := io.ReadAll(zr)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read decompressed content for %s: %w", hash, err)
-		}
-
-		// Parse the object header (format: "type size\0content")
-		nullIndex := bytes.IndexByte(content, 0)
-		if nullIndex == -1 {
-			return nil, fmt.Errorf("invalid object format for %s", hash)
-		}
-
-		header := string(content[:nullIndex])
-		parts := strings.Split(header, " ")
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("invalid object header format for %s", hash)
-		}
-
-		objType := parts[0] // "commit", "tree", or "blob"
-
-		switch objType {
-		case "commit":
-			commit, err := objects.GetCommit(repo.Root, hash)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get commit: %w", err)
-			}
-			objectsMap[commit.Tree] = true
-			queue = append(queue, commit.Tree)
-			queue = append(queue, commit.Parents...)
-
-		case "tree":
-			tree, err := objects.GetTree(repo.Root, hash)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get tree: %w", err)
-			}
-			for _, entry := range tree.Entries {
-				objectsMap[entry.Hash] = true
-				queue = append(queue, entry.Hash)
-			}
-		}
-	}
-
-	// Convert map to slice
-	result := make([]string, 0, len(objectsMap))
-	for obj := range objectsMap {
-		result = append(result, obj)
-	}
-
-	return result, nil
+	return objects.IsAncestorRepo(repo, ancestorHash, descendantHash)
 }
 
 // createPackfileRepo creates a packfile containing the given objects using Repository context
 func createPackfileRepo(repo *core.Repository, objectHashes []string) ([]byte, error) {
 	// Create temporary packfile
-	tempFile, err := os.CreateTemp("", "vec-packfile-*.pack")
+	tempFile, err := core.CreateTempFile(repo.Root, "vec-packfile", ".pack")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temp file: %w", err)
 	}
 	tempPath := tempFile.Name()
 	tempFile.Close()
-	defer os.Remove(tempPath)
+	defer core.RemoveTempFile(tempPath)
 
 	// Create packfile
 	err = packfile.CreatePackfileFromHashesRepo(repo, objectHashes, tempPath, true)
@@ -0,0 +1,146 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/config"
+	vechttp "github.com/NahomAnteneh/vec/internal/remote/http"
+)
+
+// push.default values, controlling what `vec push` sends when no branch is named
+const (
+	PushDefaultNothing  = "nothing"  // Refuse to push without an explicit branch
+	PushDefaultCurrent  = "current"  // Push the current branch to a branch of the same name
+	PushDefaultUpstream = "upstream" // Push the current branch to its configured upstream
+	PushDefaultSimple   = "simple"   // Like current, but refuse if the upstream has another name
+	PushDefaultMatching = "matching" // Push every local branch that also exists on the remote
+)
+
+// PushTarget pairs a local branch with the remote branch it is pushed to
+type PushTarget struct {
+	Local  string
+	Remote string
+}
+
+// ResolvePushRemoteRepo returns remoteName if set, otherwise the remote the
+// current branch tracks, otherwise the default remote.
+func ResolvePushRemoteRepo(repo *core.Repository, remoteName string) (string, error) {
+	if remoteName != "" {
+		return remoteName, nil
+	}
+	branch, err := repo.GetCurrentBranch()
+	if err != nil || branch == "(HEAD detached)" {
+		return DefaultRemoteName, nil
+	}
+	upstream, err := repo.GetBranchUpstream(branch)
+	if err != nil {
+		return "", err
+	}
+	if upstream != nil {
+		return upstream.Remote, nil
+	}
+	return DefaultRemoteName, nil
+}
+
+// ResolvePushTargetsRepo decides which branches `vec push <remote>` pushes
+// when no branch is given, following the push.default configuration.
+func ResolvePushTargetsRepo(repo *core.Repository, remoteName string) ([]PushTarget, error) {
+	mode, err := repo.GetConfig("push.default")
+	if err != nil {
+		return nil, core.ConfigError("failed to read push.default", err)
+	}
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "" {
+		mode = PushDefaultSimple
+	}
+
+	if mode == PushDefaultMatching {
+		return matchingPushTargetsRepo(repo, remoteName)
+	}
+
+	branch, err := repo.GetCurrentBranch()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current branch: %w", err)
+	}
+	if branch == "(HEAD detached)" {
+		return nil, fmt.Errorf("cannot push from detached HEAD state without naming a branch")
+	}
+	upstream, err := repo.GetBranchUpstream(branch)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case PushDefaultNothing:
+		return nil, fmt.Errorf("push.default is 'nothing'; name the branch to push")
+
+	case PushDefaultCurrent:
+		return []PushTarget{{Local: branch, Remote: branch}}, nil
+
+	case PushDefaultUpstream:
+		if upstream == nil {
+			return nil, fmt.Errorf("branch '%s' has no upstream; use 'vec push -u %s %s' to set one",
+				branch, remoteName, branch)
+		}
+		if upstream.Remote != remoteName {
+			return nil, fmt.Errorf("branch '%s' tracks '%s', not a branch on '%s'",
+				branch, upstream.String(), remoteName)
+		}
+		return []PushTarget{{Local: branch, Remote: upstream.Branch()}}, nil
+
+	case PushDefaultSimple:
+		if upstream != nil && upstream.Remote == remoteName && upstream.Branch() != branch {
+			return nil, fmt.Errorf("the upstream of branch '%s' is '%s', which has a different name; "+
+				"push it explicitly with 'vec push %s %s' or set push.default to upstream",
+				branch, upstream.String(), remoteName, branch)
+		}
+		return []PushTarget{{Local: branch, Remote: branch}}, nil
+	}
+
+	return nil, core.ConfigError(fmt.Sprintf("invalid push.default '%s' (expected %s)", mode,
+		strings.Join([]string{PushDefaultSimple, PushDefaultCurrent, PushDefaultUpstream,
+			PushDefaultMatching, PushDefaultNothing}, ", ")), nil)
+}
+
+// matchingPushTargetsRepo returns every local branch that has a branch of the
+// same name on the remote.
+func matchingPushTargetsRepo(repo *core.Repository, remoteName string) ([]PushTarget, error) {
+	cfg, err := config.LoadConfigRepo(repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	remoteURL, err := cfg.GetRemotePushURL(remoteName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRemoteNotFound, remoteName)
+	}
+
+	client, err := openTransport(remoteURL, remoteName, cfg)
+	if err != nil {
+		return nil, err
+	}
+	remoteRefs, err := client.GetRefs()
+	if err != nil && !errors.Is(err, vechttp.ErrNotFound) {
+		return nil, fmt.Errorf("failed to get remote refs: %w", describeTransportError(remoteName, err))
+	}
+
+	localBranches, err := repo.GetAllBranches()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(localBranches)
+
+	var targets []PushTarget
+	for _, branch := range localBranches {
+		if _, ok := remoteRefs["refs/heads/"+branch]; ok {
+			targets = append(targets, PushTarget{Local: branch, Remote: branch})
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no matching branches on remote '%s'; name the branch to push", remoteName)
+	}
+	return targets, nil
+}
@@ -0,0 +1,134 @@
+package remote
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// mirrorRefPrefixes are the ref namespaces kept in sync by a mirror push
+var mirrorRefPrefixes = []string{"refs/heads/", "refs/tags/"}
+
+// MirrorPushRepo makes the remote an exact copy of the local branches and
+// tags: every local ref is force-pushed and remote refs that no longer exist
+// locally are deleted.
+func MirrorPushRepo(repo *core.Repository, remoteName string, opts PushOptions) ([]*RefUpdate, error) {
+	opts.Force = true
+	opts.SetUpstream = false
+	opts.RemoteBranch = ""
+	return pushAndPruneRepo(repo, remoteName, mirrorRefPrefixes, opts)
+}
+
+// PushPruneRepo pushes every local branch and deletes remote branches that no
+// longer exist locally.
+func PushPruneRepo(repo *core.Repository, remoteName string, opts PushOptions) ([]*RefUpdate, error) {
+	opts.RemoteBranch = ""
+	return pushAndPruneRepo(repo, remoteName, []string{"refs/heads/"}, opts)
+}
+
+// pushAndPruneRepo pushes all local refs under prefixes to the same names on
+// the remote and deletes remote refs under prefixes with no local
+// counterpart, in one request. Rejected updates don't stop the others; they
+// are reported in the returned updates and summarised in the error.
+func pushAndPruneRepo(repo *core.Repository, remoteName string, prefixes []string, opts PushOptions) ([]*RefUpdate, error) {
+	client, remoteRefs, err := openPushRemoteRepo(repo, remoteName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	localRefs, err := localRefsRepo(repo, prefixes)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]pushRef, 0, len(localRefs))
+	local := make(map[string]bool, len(localRefs))
+	for _, ref := range localRefs {
+		refs = append(refs, pushRef{local: ref, remote: ref})
+		local[ref] = true
+	}
+	var stale []string
+	for ref := range remoteRefs {
+		if !local[ref] && hasAnyPrefix(ref, prefixes) {
+			stale = append(stale, ref)
+		}
+	}
+	sort.Strings(stale)
+	for _, ref := range stale {
+		refs = append(refs, pushRef{remote: ref})
+	}
+	return pushRefsRepo(repo, client, remoteRefs, remoteName, refs, opts)
+}
+
+// DeleteRemoteRefsRepo deletes the named branches or tags on the remote. A
+// short name is looked up under refs/heads/ first, then refs/tags/. Each
+// deletion is reported separately; failures are summarised in the error.
+func DeleteRemoteRefsRepo(repo *core.Repository, remoteName string, names []string, opts PushOptions) ([]*RefUpdate, error) {
+	client, remoteRefs, err := openPushRemoteRepo(repo, remoteName, opts)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]pushRef, len(names))
+	for i, name := range names {
+		refs[i] = pushRef{remote: resolveRemoteRefName(remoteRefs, name)}
+	}
+	return pushRefsRepo(repo, client, remoteRefs, remoteName, refs, opts)
+}
+
+// resolveRemoteRefName expands a branch or tag name to the full ref the remote
+// advertises, preferring branches. Unknown names resolve under refs/heads/.
+func resolveRemoteRefName(remoteRefs map[string]string, name string) string {
+	if strings.HasPrefix(name, "refs/") {
+		return name
+	}
+	for _, prefix := range mirrorRefPrefixes {
+		if _, ok := remoteRefs[prefix+name]; ok {
+			return prefix + name
+		}
+	}
+	return "refs/heads/" + name
+}
+
+// localRefsRepo lists the full names of local refs under prefixes, sorted
+func localRefsRepo(repo *core.Repository, prefixes []string) ([]string, error) {
+	var refs []string
+	for _, prefix := range prefixes {
+		dir := filepath.Join(repo.VecDir, filepath.FromSlash(prefix))
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if info.IsDir() || strings.HasSuffix(path, ".lock") {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			refs = append(refs, prefix+filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list local refs: %w", err)
+		}
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// hasAnyPrefix reports whether s starts with one of prefixes
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/packfile"
+)
+
+// maxListedObjects caps the objects named when a push size check fails
+const maxListedObjects = 10
+
+// pushSizePolicy holds push.maxObjectSize and push.maxPackSize. A zero size
+// disables that check.
+type pushSizePolicy struct {
+	MaxObjectSize int64
+	MaxPackSize   int64
+}
+
+// enabled reports whether any limit is set
+func (p pushSizePolicy) enabled() bool {
+	return p.MaxObjectSize > 0 || p.MaxPackSize > 0
+}
+
+// loadPushSizePolicyRepo reads the push size limits from the configuration
+func loadPushSizePolicyRepo(repo *core.Repository) (pushSizePolicy, error) {
+	var policy pushSizePolicy
+	for key, dst := range map[string]*int64{
+		"push.maxObjectSize": &policy.MaxObjectSize,
+		"push.maxPackSize":   &policy.MaxPackSize,
+	} {
+		value, err := repo.GetConfig(key)
+		if err != nil {
+			return policy, core.ConfigError(fmt.Sprintf("failed to read %s", key), err)
+		}
+		if value == "" {
+			continue
+		}
+		size, err := packfile.ParseSize(value)
+		if err != nil {
+			return policy, core.ConfigError(fmt.Sprintf("invalid value for %s", key), err)
+		}
+		*dst = size
+	}
+	return policy, nil
+}
+
+// pushedObject is a blob of a push, located in the history being pushed
+type pushedObject struct {
+	Hash   string
+	Size   int64
+	Path   string // First path the blob appears at, empty if not found
+	Commit string // Oldest pushed commit containing it
+}
+
+// objectSizesRepo returns the inflated size of each blob among hashes
+func objectSizesRepo(repo *core.Repository, hashes []string) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	for _, hash := range hashes {
+		objType, size, err := packfile.ReadObjectHeaderRepo(repo, hash)
+		if err != nil {
+			return nil, err
+		}
+		if objType == "blob" {
+			sizes[hash] = size
+		}
+	}
+	return sizes, nil
+}
+
+// oversizedObjects returns the blobs above limit, largest first
+func oversizedObjects(sizes map[string]int64, limit int64) []*pushedObject {
+	var result []*pushedObject
+	for hash, size := range sizes {
+		if size > limit {
+			result = append(result, &pushedObject{Hash: hash, Size: size})
+		}
+	}
+	sortBySize(result)
+	return result
+}
+
+// largestObjects returns up to n of the largest blobs
+func largestObjects(sizes map[string]int64, n int) []*pushedObject {
+	result := oversizedObjects(sizes, -1)
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+func sortBySize(objs []*pushedObject) {
+	sort.Slice(objs, func(i, j int) bool {
+		if objs[i].Size != objs[j].Size {
+			return objs[i].Size > objs[j].Size
+		}
+		return objs[i].Hash < objs[j].Hash
+	})
+}
+
+// locateObjectsRepo fills in the path and commit of each of objs by walking
+// the commits reachable from localCommit but not from remoteCommit, oldest
+// first, so each blob is attributed to the commit that introduced it
+func locateObjectsRepo(repo *core.Repository, remoteCommit, localCommit string, objs []*pushedObject) error {
+	pending := make(map[string]*pushedObject, len(objs))
+	for _, obj := range objs {
+		pending[obj.Hash] = obj
+	}
+
+	commits, err := objects.CommitsBetweenRepo(repo, remoteCommit, localCommit)
+	if err != nil {
+		return err
+	}
+	seenTrees := make(map[string]bool)
+	for i := len(commits) - 1; i >= 0 && len(pending) > 0; i-- {
+		commit := commits[i]
+		var walk func(treeHash, dir string) error
+		walk = func(treeHash, dir string) error {
+			if seenTrees[treeHash] {
+				return nil
+			}
+			seenTrees[treeHash] = true
+			tree, err := objects.GetTreeRepo(repo, treeHash)
+			if err != nil {
+				return fmt.Errorf("failed to read tree %s: %w", treeHash, err)
+			}
+			for _, entry := range tree.Entries {
+				entryPath := path.Join(dir, entry.Name)
+				if entry.Type == "tree" {
+					if err := walk(entry.Hash, entryPath); err != nil {
+						return err
+					}
+					continue
+				}
+				if obj, ok := pending[entry.Hash]; ok {
+					obj.Path, obj.Commit = entryPath, commit.CommitID
+					delete(pending, entry.Hash)
+				}
+			}
+			return nil
+		}
+		if err := walk(commit.Tree, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printPushedObjects lists objs as "<size>  <path> (<commit>)"
+func printPushedObjects(w io.Writer, objs []*pushedObject) {
+	for i, obj := range objs {
+		if i == maxListedObjects {
+			fmt.Fprintf(w, "  ... and %d more\n", len(objs)-i)
+			return
+		}
+		where := "blob " + shortCommitID(obj.Hash)
+		if obj.Path != "" {
+			where = fmt.Sprintf("%s (commit %s)", obj.Path, shortCommitID(obj.Commit))
+		}
+		fmt.Fprintf(w, "  %10s  %s\n", packfile.FormatBytes(obj.Size), where)
+	}
+}
+
+// checkObjectSizesRepo enforces push.maxObjectSize on the blobs about to be
+// packed, listing the offenders on w. It returns a rejection reason, or ""
+// when every object fits; sizes is returned for the pack size check.
+func checkObjectSizesRepo(repo *core.Repository, policy pushSizePolicy, hashes []string,
+	remoteCommit, localCommit string, w io.Writer) (string, map[string]int64, error) {
+	sizes, err := objectSizesRepo(repo, hashes)
+	if err != nil {
+		return "", nil, err
+	}
+	if policy.MaxObjectSize <= 0 {
+		return "", sizes, nil
+	}
+	oversized := oversizedObjects(sizes, policy.MaxObjectSize)
+	if len(oversized) == 0 {
+		return "", sizes, nil
+	}
+
+	if err := locateObjectsRepo(repo, remoteCommit, localCommit, oversized); err != nil {
+		return "", nil, err
+	}
+	fmt.Fprintf(w, "error: %d object(s) exceed push.maxObjectSize (%s):\n",
+		len(oversized), packfile.FormatBytes(policy.MaxObjectSize))
+	printPushedObjects(w, oversized)
+	return "object exceeds push.maxObjectSize, use --no-size-check to override", sizes, nil
+}
+
+// checkPackSizeRepo enforces push.maxPackSize on a built pack of packSize
+// bytes, naming the largest blobs on w. It returns a rejection reason, or "".
+func checkPackSizeRepo(repo *core.Repository, policy pushSizePolicy, packSize int64, sizes map[string]int64,
+	remoteCommit, localCommit string, w io.Writer) (string, error) {
+	if policy.MaxPackSize <= 0 || packSize <= policy.MaxPackSize {
+		return "", nil
+	}
+
+	largest := largestObjects(sizes, maxListedObjects)
+	if err := locateObjectsRepo(repo, remoteCommit, localCommit, largest); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(w, "error: pack of %s exceeds push.maxPackSize (%s)\n",
+		packfile.FormatBytes(packSize), packfile.FormatBytes(policy.MaxPackSize))
+	if len(largest) > 0 {
+		fmt.Fprintln(w, "Largest objects in the push:")
+		printPushedObjects(w, largest)
+	}
+	return "pack exceeds push.maxPackSize, use --no-size-check to override", nil
+}
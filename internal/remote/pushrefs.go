@@ -0,0 +1,470 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/packfile"
+	vechttp "github.com/NahomAnteneh/vec/internal/remote/http"
+)
+
+// PushRefspec asks push to set the remote ref Dst to the local ref Src, or
+// to delete Dst when Src is empty
+type PushRefspec struct {
+	Src   string // Local branch, tag or full ref name
+	Dst   string // Remote branch, tag or full ref name; the ref Src names when empty
+	Force bool   // Allow a non-fast-forward update, as a leading '+' does
+}
+
+// ParsePushRefspec parses "[+]<src>[:<dst>]"; ":<dst>" deletes <dst>
+func ParsePushRefspec(spec string) (PushRefspec, error) {
+	var refspec PushRefspec
+	rest, force := strings.CutPrefix(spec, "+")
+	refspec.Src, refspec.Dst, _ = strings.Cut(rest, ":")
+	refspec.Force = force
+	if refspec.Src == "" && refspec.Dst == "" {
+		return PushRefspec{}, fmt.Errorf("invalid refspec '%s'", spec)
+	}
+	return refspec, nil
+}
+
+// BranchRefspecsRepo returns a refspec for every local branch, as --all pushes
+func BranchRefspecsRepo(repo *core.Repository) ([]PushRefspec, error) {
+	return sameNameRefspecsRepo(repo, "refs/heads/")
+}
+
+// TagRefspecsRepo returns a refspec for every local tag, as --tags pushes
+func TagRefspecsRepo(repo *core.Repository) ([]PushRefspec, error) {
+	return sameNameRefspecsRepo(repo, "refs/tags/")
+}
+
+func sameNameRefspecsRepo(repo *core.Repository, prefix string) ([]PushRefspec, error) {
+	refs, err := localRefsRepo(repo, []string{prefix})
+	if err != nil {
+		return nil, err
+	}
+	refspecs := make([]PushRefspec, len(refs))
+	for i, ref := range refs {
+		refspecs[i] = PushRefspec{Src: ref, Dst: ref}
+	}
+	return refspecs, nil
+}
+
+// PushRefspecsRepo updates the remote refs refspecs name in one request,
+// sending the objects they all need in a single pack. Every update is
+// reported; rejected ones don't stop the others, unless opts.Atomic, and are
+// summarised in the error. The updates are returned once the push got far
+// enough to decide them.
+func PushRefspecsRepo(repo *core.Repository, remoteName string, refspecs []PushRefspec, opts PushOptions) ([]*RefUpdate, error) {
+	client, remoteRefs, err := openPushRemoteRepo(repo, remoteName, opts)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]pushRef, 0, len(refspecs))
+	for _, refspec := range refspecs {
+		ref, err := resolvePushRefspecRepo(repo, remoteRefs, refspec)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return pushRefsRepo(repo, client, remoteRefs, remoteName, refs, opts)
+}
+
+// pushRef is a refspec resolved to full ref names
+type pushRef struct {
+	local  string // Empty to delete remote
+	remote string
+	force  bool
+}
+
+// resolvePushRefspecRepo expands the short names of refspec. A short
+// destination is a tag when the source is one, and otherwise whatever the
+// remote has under that name, preferring branches.
+func resolvePushRefspecRepo(repo *core.Repository, remoteRefs map[string]string, refspec PushRefspec) (pushRef, error) {
+	ref := pushRef{force: refspec.Force}
+	if refspec.Src == "" {
+		ref.remote = resolveRemoteRefName(remoteRefs, refspec.Dst)
+		return ref, nil
+	}
+
+	var err error
+	if ref.local, err = resolveLocalRefRepo(repo, refspec.Src); err != nil {
+		return pushRef{}, err
+	}
+	switch dst := refspec.Dst; {
+	case dst == "":
+		ref.remote = ref.local
+	case strings.HasPrefix(dst, "refs/"):
+		ref.remote = dst
+	case strings.HasPrefix(ref.local, "refs/tags/"):
+		ref.remote = "refs/tags/" + dst
+	default:
+		ref.remote = resolveRemoteRefName(remoteRefs, dst)
+	}
+	return ref, nil
+}
+
+// resolveLocalRefRepo expands a branch or tag name to the full name of the
+// local ref, preferring branches
+func resolveLocalRefRepo(repo *core.Repository, name string) (string, error) {
+	candidates := []string{name}
+	if !strings.HasPrefix(name, "refs/") {
+		candidates = []string{"refs/heads/" + name, "refs/tags/" + name}
+	}
+	for _, ref := range candidates {
+		if commit, err := core.ReadRefValue(repo.Root, ref); err == nil && commit != "" {
+			return ref, nil
+		}
+	}
+	return "", core.RefError(fmt.Sprintf("src refspec '%s' does not match any local branch or tag", name), nil)
+}
+
+// pendingPush is a ref update being pushed
+type pendingPush struct {
+	pushRef
+	update       *RefUpdate
+	localCommit  string // Empty for a deletion
+	remoteCommit string // Empty for a new ref
+	lease        string // Where --force-with-lease expects the remote ref
+	leased       bool
+	err          error // Rejection of the update
+}
+
+// branches returns the local and remote branch of a branch pushed to a
+// branch; ok is false for tags, other refs and deletions
+func (p *pendingPush) branches() (local, remote string, ok bool) {
+	local, localIsBranch := strings.CutPrefix(p.local, "refs/heads/")
+	remote, remoteIsBranch := strings.CutPrefix(p.remote, "refs/heads/")
+	return local, remote, localIsBranch && remoteIsBranch
+}
+
+// planPushRepo decides whether ref may be pushed over what the remote has:
+// the result is up to date, rejected, or to be sent
+func planPushRepo(repo *core.Repository, remoteRefs map[string]string, remoteName string, ref pushRef, opts PushOptions) (*pendingPush, error) {
+	p := &pendingPush{pushRef: ref, remoteCommit: remoteRefs[ref.remote]}
+	p.update = &RefUpdate{Remote: shortRefName(ref.remote), Old: p.remoteCommit}
+	if ref.local != "" {
+		commit, err := core.ReadRefValue(repo.Root, ref.local)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read local ref '%s': %w", shortRefName(ref.local), err)
+		}
+		p.localCommit = commit
+		p.update.Local, p.update.New = shortRefName(ref.local), commit
+	}
+
+	switch {
+	case p.local == "" && p.remoteCommit == "":
+		p.err = p.update.reject(vechttp.RefStatusRejected, "remote ref does not exist")
+		return p, nil
+	case p.localCommit == p.remoteCommit:
+		p.update.Status = RefStatusUpToDate
+		return p, nil
+	}
+
+	// A lease replaces the fast-forward check with "the remote has not moved"
+	var err error
+	if p.lease, p.leased, err = leaseExpectationRepo(repo, remoteName, p.remote, opts); err != nil {
+		return nil, err
+	}
+	force := opts.Force || p.force || p.leased
+	switch {
+	case p.leased && p.remoteCommit != p.lease:
+		p.err = p.update.reject(vechttp.RefStatusRejected,
+			fmt.Sprintf("stale info: remote is at %s but the lease expected %s - fetch and review before forcing",
+				describeLeaseValue(p.remoteCommit), describeLeaseValue(p.lease)))
+	case p.local == "" || p.remoteCommit == "":
+	case strings.HasPrefix(p.remote, "refs/tags/"):
+		// Tags don't move; replacing one is always forced
+		p.update.Forced = true
+		if !force {
+			p.err = p.update.reject(vechttp.RefStatusRejected, "already exists, use --force to replace it")
+		}
+	default:
+		isFastForward, err := isCommitAncestorRepo(repo, p.remoteCommit, p.localCommit)
+		if err != nil && !force {
+			return nil, fmt.Errorf("failed to check if update is fast-forward: %w", err)
+		}
+		p.update.Forced = err != nil || !isFastForward
+		if p.update.Forced && !force {
+			p.err = p.update.reject(vechttp.RefStatusNonFastForward, "use --force to override")
+		}
+	}
+	return p, nil
+}
+
+// pushRefsRepo pushes refs in one request, or reports what it would do with
+// opts.DryRun. Updates are returned unless the push failed before deciding
+// them.
+func pushRefsRepo(repo *core.Repository, client remoteTransport, remoteRefs map[string]string,
+	remoteName string, refs []pushRef, opts PushOptions) ([]*RefUpdate, error) {
+	var updates []*RefUpdate
+	var pending, pushing []*pendingPush
+	refused := false
+	for _, ref := range refs {
+		p, err := planPushRepo(repo, remoteRefs, remoteName, ref, opts)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, p.update)
+		pending = append(pending, p)
+		switch {
+		case p.err != nil:
+			refused = true
+		case p.update.Status == RefStatusUpToDate:
+			if opts.Verbose {
+				fmt.Printf("'%s' is already up to date on remote '%s'\n", p.update.Remote, remoteName)
+			}
+			if !opts.DryRun {
+				if err := p.finishRepo(repo, remoteName, opts); err != nil {
+					return updates, err
+				}
+			}
+		default:
+			pushing = append(pushing, p)
+		}
+	}
+
+	switch {
+	case len(pushing) == 0:
+	case opts.Atomic && refused:
+		// Nothing is sent when part of an atomic push is already refused
+		for _, p := range pushing {
+			p.err = p.update.reject(vechttp.RefStatusAtomic, "atomic push failed")
+		}
+	case opts.DryRun:
+		for _, p := range pushing {
+			p.update.Status = vechttp.RefStatusOK
+			switch {
+			case p.local == "":
+				fmt.Printf("Dry run: Would delete '%s' on remote '%s'\n", p.update.Remote, remoteName)
+			case p.remoteCommit == "":
+				fmt.Printf("Dry run: Would push new ref '%s' to remote '%s'\n", p.update.Remote, remoteName)
+			default:
+				fmt.Printf("Dry run: Would update remote '%s' ref '%s' from %s to %s\n",
+					remoteName, p.update.Remote, shortCommitID(p.remoteCommit), shortCommitID(p.localCommit))
+			}
+		}
+	default:
+		if err := sendPushRepo(repo, client, remoteRefs, remoteName, pushing, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	var rejections []error
+	for _, p := range pending {
+		if p.err != nil {
+			rejections = append(rejections, p.err)
+		}
+	}
+	switch {
+	case len(rejections) == 0:
+		return updates, nil
+	case len(updates) == 1:
+		return updates, rejections[0]
+	}
+	return updates, fmt.Errorf("%w: %d of %d refs", ErrPushRejected, len(rejections), len(updates))
+}
+
+// sendPushRepo sends the objects and ref updates of pushing, recording the
+// server's verdict on each. A lone update goes out as the single-ref request
+// servers have long understood; several share one batched request, which the
+// server applies all or none with opts.Atomic.
+func sendPushRepo(repo *core.Repository, client remoteTransport, remoteRefs map[string]string,
+	remoteName string, pushing []*pendingPush, opts PushOptions) error {
+	rejectAll := func(status, reason string) {
+		for _, p := range pushing {
+			p.err = p.update.reject(status, reason)
+		}
+	}
+	if err := runPrePushHookRepo(repo, client, remoteName, pushing, opts); err != nil {
+		rejectAll(vechttp.RefStatusHook, err.Error())
+		return nil
+	}
+
+	// Everything the remote advertises and we have is left out of the pack
+	var tips, haves []string
+	for _, p := range pushing {
+		if p.localCommit != "" {
+			tips = append(tips, p.localCommit)
+		}
+	}
+	for _, hash := range remoteRefs {
+		if objects.HasObjectRepo(repo, hash) {
+			haves = append(haves, hash)
+		}
+	}
+
+	var sendPack vechttp.PackWriter
+	if len(tips) > 0 {
+		pack, rejection, err := buildPushPackRepo(repo, client, tips, haves, pushing, opts)
+		if err != nil {
+			return err
+		}
+		if rejection != "" {
+			rejectAll(vechttp.RefStatusRejected, rejection)
+			return nil
+		}
+		if pack != nil {
+			defer pack.Remove()
+			var progress packfile.ProgressFunc
+			if opts.Progress {
+				progress = packfile.NewProgressPrinter(os.Stdout)
+			}
+			if opts.Verbose && !opts.Progress {
+				fmt.Printf("Sending %d bytes to remote '%s'...\n", pack.Size, remoteName)
+			}
+			sendPack = func(w io.Writer) error {
+				_, err := pack.Send(w, progress)
+				return err
+			}
+		}
+	}
+
+	var result *vechttp.PushResult
+	var err error
+	switch p := pushing[0]; {
+	case len(pushing) == 1 && p.local == "":
+		result, err = client.DeleteRef(p.remote, p.remoteCommit)
+	case len(pushing) == 1 && sendPack != nil && p.leased:
+		result, err = client.PushStreamWithLease(p.remote, p.lease, p.localCommit, sendPack)
+	case len(pushing) == 1 && sendPack != nil:
+		result, err = client.PushStream(p.remote, p.remoteCommit, p.localCommit, sendPack)
+	default:
+		commands := make([]vechttp.RefCommand, len(pushing))
+		for i, p := range pushing {
+			commands[i] = vechttp.RefCommand{Ref: p.remote, OldCommit: p.remoteCommit, NewCommit: p.localCommit}
+			if p.leased {
+				commands[i].OldCommit, commands[i].Lease = p.lease, true
+			}
+		}
+		result, err = client.PushRefs(commands, opts.Atomic, sendPack)
+	}
+	if err != nil {
+		return fmt.Errorf("push failed: %w", describeTransportError(remoteName, err))
+	}
+
+	// The server reports per-ref status; older servers only set Success
+	applied := 0
+	for _, p := range pushing {
+		if p.err = p.update.applyServerStatus(result, p.remote); p.err != nil {
+			continue
+		}
+		applied++
+		core.RecordAudit(repo.Root, core.AuditPush, remoteName+":"+p.remote, p.remoteCommit, p.localCommit)
+		if p.local != "" && (opts.Verbose || opts.Progress) {
+			fmt.Printf("'%s' pushed to '%s' as '%s'\n", p.update.Local, remoteName, p.update.Remote)
+		}
+		if err := p.finishRepo(repo, remoteName, opts); err != nil {
+			return err
+		}
+	}
+	if opts.Atomic && applied > 0 && applied < len(pushing) {
+		fmt.Fprintf(os.Stderr, "warning: remote '%s' applied only part of the atomic push; it may not support atomic pushes\n", remoteName)
+	}
+	return nil
+}
+
+// buildPushPackRepo packs the objects reachable from tips that the remote
+// lacks, staged in .vec/tmp so memory use doesn't grow with the upload. The
+// pack is nil when the remote has every object; a size limit the objects
+// break is returned as the rejection.
+func buildPushPackRepo(repo *core.Repository, client remoteTransport, tips, haves []string,
+	pushing []*pendingPush, opts PushOptions) (*packfile.TempPack, string, error) {
+	if opts.Verbose {
+		fmt.Println("Determining objects to send...")
+	}
+	if opts.Progress {
+		// A cheap pre-count over commits and trees gives the user a total
+		// before the exact object list is built
+		estimate, err := objects.CountObjectsRepo(repo, tips, haves)
+		if err == nil {
+			fmt.Printf("%s: %d, done.\n", packfile.PhaseCounting, estimate.Total())
+		} else if opts.Verbose {
+			fmt.Printf("Could not count objects: %v\n", err)
+		}
+	}
+
+	objectsToSend, err := findObjectsToPush(repo, tips, haves)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find objects to push: %w", err)
+	}
+	objectsToSend = pruneRemoteObjects(client, objectsToSend, tips, opts)
+	if len(objectsToSend) == 0 {
+		if opts.Verbose {
+			fmt.Println("No objects to send")
+		}
+		return nil, "", nil
+	}
+
+	// Size limits are checked before the pack is built, so an oversized
+	// blob is reported without compressing everything else first. Offending
+	// blobs are located in the history of the first update.
+	var policy pushSizePolicy
+	var sizes map[string]int64
+	if !opts.NoSizeCheck {
+		if policy, err = loadPushSizePolicyRepo(repo); err != nil {
+			return nil, "", err
+		}
+	}
+	first := pushing[0]
+	for _, p := range pushing {
+		if p.localCommit != "" {
+			first = p
+			break
+		}
+	}
+	if policy.enabled() {
+		var reason string
+		reason, sizes, err = checkObjectSizesRepo(repo, policy, objectsToSend, first.remoteCommit, first.localCommit, os.Stderr)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to check object sizes: %w", err)
+		}
+		if reason != "" {
+			return nil, reason, nil
+		}
+	}
+
+	var progress packfile.ProgressFunc
+	if opts.Progress {
+		progress = packfile.NewProgressPrinter(os.Stdout)
+	} else if opts.Verbose {
+		fmt.Printf("Creating packfile with %d objects...\n", len(objectsToSend))
+	}
+	pack, err := packfile.CreateTempPack(repo.Root, objectsToSend, progress)
+	if err != nil {
+		return nil, "", err
+	}
+	if policy.enabled() {
+		reason, err := checkPackSizeRepo(repo, policy, pack.Size, sizes, first.remoteCommit, first.localCommit, os.Stderr)
+		if err != nil || reason != "" {
+			pack.Remove()
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to check pack size: %w", err)
+			}
+			return nil, reason, nil
+		}
+	}
+	return pack, "", nil
+}
+
+// finishRepo updates the local view of the remote after the update went
+// through: the remote-tracking ref of a pushed branch follows it, with the
+// upstream recorded as finishPushRepo does, and that of a deleted branch goes
+func (p *pendingPush) finishRepo(repo *core.Repository, remoteName string, opts PushOptions) error {
+	if local, remote, ok := p.branches(); ok {
+		return finishPushRepo(repo, remoteName, local, remote, p.localCommit, opts)
+	}
+	if branch, ok := strings.CutPrefix(p.remote, "refs/heads/"); ok && p.local == "" {
+		trackingRef := filepath.Join(repo.VecDir, "refs", "remotes", remoteName, branch)
+		if err := os.Remove(trackingRef); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove remote-tracking ref: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+
+	vechttp "github.com/NahomAnteneh/vec/internal/remote/http"
+)
+
+// ErrPushRejected is returned when the client or the server refuses a ref update
+var ErrPushRejected = errors.New("push rejected")
+
+// RefStatusUpToDate marks a branch that needed no update; the other statuses
+// are the vechttp.RefStatus* values reported by the server.
+const RefStatusUpToDate = "up-to-date"
+
+// RefUpdate describes what a push did, or refused to do, to one remote branch
+type RefUpdate struct {
+	Local   string // Local branch name, empty when the remote ref is deleted
+	Remote  string // Remote branch name
+	Old     string // Remote commit before the push, empty for a new branch
+	New     string // Commit pushed, empty when the remote ref is deleted
+	Forced  bool   // The update was not a fast-forward
+	Status  string
+	Message string // Reason given with a rejection
+}
+
+// Rejected reports whether the update was refused
+func (u *RefUpdate) Rejected() bool {
+	return u.Status != vechttp.RefStatusOK && u.Status != RefStatusUpToDate
+}
+
+// reject marks the update as refused and returns the matching error
+func (u *RefUpdate) reject(status, message string) error {
+	u.Status, u.Message = status, message
+	return fmt.Errorf("%w: %s (%s)", ErrPushRejected, u.refs(), u.reason())
+}
+
+// refs renders the "local -> remote" part of a summary line
+func (u *RefUpdate) refs() string {
+	if u.Local == "" {
+		return u.Remote
+	}
+	return u.Local + " -> " + u.Remote
+}
+
+// reason returns the parenthesised reason shown for a rejected update
+func (u *RefUpdate) reason() string {
+	switch u.Status {
+	case vechttp.RefStatusNonFastForward:
+		return "non-fast-forward"
+	case vechttp.RefStatusProtected:
+		return "protected"
+	case vechttp.RefStatusHook:
+		if u.Message != "" {
+			return "hook declined: " + u.Message
+		}
+		return "hook declined"
+	}
+	if u.Message != "" {
+		return u.Message
+	}
+	return "rejected"
+}
+
+// Summary renders the update as one line of the push summary table, e.g.
+// " ! [rejected]          main -> main (protected)"
+func (u *RefUpdate) Summary() string {
+	flag, summary, suffix := " ", "", ""
+	switch {
+	case u.Status == RefStatusUpToDate:
+		flag, summary = "=", "[up to date]"
+	case u.Status == vechttp.RefStatusHook:
+		flag, summary, suffix = "!", "[remote rejected]", " ("+u.reason()+")"
+	case u.Rejected():
+		flag, summary, suffix = "!", "[rejected]", " ("+u.reason()+")"
+	case u.New == "":
+		flag, summary = "-", "[deleted]"
+	case u.Old == "":
+		flag, summary = "*", "[new branch]"
+	case u.Forced:
+		flag, summary, suffix = "+", shortCommitID(u.Old)+"..."+shortCommitID(u.New), " (forced update)"
+	default:
+		summary = shortCommitID(u.Old) + ".." + shortCommitID(u.New)
+	}
+	return fmt.Sprintf(" %s %-19s %s%s", flag, summary, u.refs(), suffix)
+}
+
+// applyServerStatus records the server's verdict on the update of ref from result
+func (u *RefUpdate) applyServerStatus(result *vechttp.PushResult, ref string) error {
+	if status := result.RefStatus(ref); status != nil {
+		if status.Status == vechttp.RefStatusOK {
+			u.Status = vechttp.RefStatusOK
+			return nil
+		}
+		return u.reject(status.Status, status.Message)
+	}
+	if !result.Success {
+		return u.reject(vechttp.RefStatusRejected, result.Message)
+	}
+	u.Status = vechttp.RefStatusOK
+	return nil
+}
@@ -0,0 +1,129 @@
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/config"
+	vechttp "github.com/NahomAnteneh/vec/internal/remote/http"
+)
+
+// refsCacheEntry is the last ref advertisement received from a remote,
+// kept with its validators so the next fetch can ask for it conditionally
+type refsCacheEntry struct {
+	URL       string                `json:"url"`
+	Validator vechttp.RefsValidator `json:"validator"`
+	Refs      map[string]string     `json:"refs"`
+}
+
+// refsCachePath returns where the ref advertisement of remoteName is cached
+func refsCachePath(repo *core.Repository, remoteName string) string {
+	return filepath.Join(repo.VecDir, "cache", "refs", url.PathEscape(remoteName)+".json")
+}
+
+// loadRefsCacheRepo returns the cached advertisement of remoteName, nil when
+// there is none or it was received from another URL
+func loadRefsCacheRepo(repo *core.Repository, remoteName, remoteURL string) *refsCacheEntry {
+	data, err := os.ReadFile(refsCachePath(repo, remoteName))
+	if err != nil {
+		return nil
+	}
+	var entry refsCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.URL != remoteURL || entry.Refs == nil {
+		return nil
+	}
+	return &entry
+}
+
+// saveRefsCacheRepo caches an advertisement that carries validators and
+// drops the cached one otherwise, as it could never be revalidated
+func saveRefsCacheRepo(repo *core.Repository, remoteName string, entry refsCacheEntry) error {
+	path := refsCachePath(repo, remoteName)
+	if entry.Validator.ETag == "" && entry.Validator.LastModified == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove refs cache: %w", err)
+		}
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode refs cache: %w", err)
+	}
+	if err := core.EnsureDirExists(filepath.Dir(path)); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write refs cache: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write refs cache: %w", err)
+	}
+	return nil
+}
+
+// fetchRemoteRefsRepo retrieves the refs of remoteName, revalidating the
+// cached advertisement with If-None-Match/If-Modified-Since. On 304 Not
+// Modified the cached refs are returned with unchanged set. Local remotes are
+// read directly and never cached.
+func fetchRemoteRefsRepo(repo *core.Repository, remoteURL, remoteName string, cfg *config.Config) (refs map[string]string, unchanged bool, err error) {
+	if local, err := localTransportFor(remoteURL); local != nil || err != nil {
+		if err != nil {
+			return nil, false, err
+		}
+		refs, err := local.GetRefs()
+		return refs, false, err
+	}
+
+	cached := loadRefsCacheRepo(repo, remoteName, remoteURL)
+	var since vechttp.RefsValidator
+	if cached != nil {
+		since = cached.Validator
+	}
+
+	client := vechttp.NewClient(remoteURL, remoteName, cfg)
+	refs, validator, notModified, err := client.GetRefsIfModified(since)
+	if err != nil {
+		return nil, false, describeTransportError(remoteName, err)
+	}
+	if notModified {
+		if cached == nil {
+			// Only possible from a server ignoring the absent validators
+			return nil, false, core.RemoteError(fmt.Sprintf("remote '%s' answered 304 to an unconditional refs request", remoteName), nil)
+		}
+		log.Printf("[fetchRemoteRefs] Ref advertisement of '%s' not modified", remoteName)
+		return cached.Refs, true, nil
+	}
+
+	entry := refsCacheEntry{URL: remoteURL, Validator: validator, Refs: refs}
+	if err := saveRefsCacheRepo(repo, remoteName, entry); err != nil {
+		// The cache only saves a round trip; the fetch goes on without it
+		log.Printf("[fetchRemoteRefs] Warning: %v", err)
+	}
+	return refs, false, nil
+}
+
+// trackingRefsCurrentRepo reports whether every branch in refs already has
+// a remote-tracking ref of remoteName at the advertised commit, i.e. the
+// previous fetch of this advertisement completed
+func trackingRefsCurrentRepo(repo *core.Repository, remoteName string, refs map[string]string) bool {
+	for name, hash := range refs {
+		if !strings.HasPrefix(name, "refs/heads/") {
+			continue
+		}
+		trackingRef := filepath.Join(repo.VecDir, "refs", "remotes", remoteName, strings.TrimPrefix(name, "refs/heads/"))
+		content, err := os.ReadFile(trackingRef)
+		if err != nil || strings.TrimSpace(string(content)) != hash {
+			return false
+		}
+	}
+	return true
+}
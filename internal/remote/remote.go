@@ -35,10 +35,22 @@ var (
 	ErrInvalidResponse      = errors.New("invalid response from server")
 )
 
+// describeTransportError reports a protocol violation from the HTTP client as an
+// invalid response from the named remote. Other errors, including nil, pass through.
+func describeTransportError(remoteName string, err error) error {
+	var perr *vechttp.ProtocolError
+	if errors.As(err, &perr) {
+		return core.RemoteError(fmt.Sprintf("%v from remote '%s'", ErrInvalidResponse, remoteName), perr)
+	}
+	return err
+}
+
 // RemoteInfo contains information about a remote repository
 type RemoteInfo struct {
 	Name          string
 	URL           string
+	FetchURL      string // URL after insteadOf rewriting
+	PushURL       string // URL pushes go to, after pushurl and pushInsteadOf
 	DefaultBranch string
 	Branches      []string
 	LastFetched   int64
@@ -87,13 +99,18 @@ func RemoveRemote(repoRoot, name string) error {
 		return fmt.Errorf("%w: %s", ErrRemoteNotFound, name)
 	}
 
-	// Remove remote refs directory
-	remoteRefsDir := filepath.Join(repoRoot, ".vec", "refs", "remotes", name)
-	if utils.FileExists(remoteRefsDir) {
-		if err := os.RemoveAll(remoteRefsDir); err != nil {
-			return fmt.Errorf("failed to remove remote refs directory: %w", err)
+	// Remove remote refs and prefetch refs directories
+	for _, kind := range []string{"remotes", "prefetch"} {
+		remoteRefsDir := filepath.Join(repoRoot, ".vec", "refs", kind, name)
+		if utils.FileExists(remoteRefsDir) {
+			if err := os.RemoveAll(remoteRefsDir); err != nil {
+				return fmt.Errorf("failed to remove remote refs directory: %w", err)
+			}
 		}
 	}
+	if err := os.Remove(core.RemoteFetchHeadPath(repoRoot, name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove the remote's FETCH_HEAD: %w", err)
+	}
 
 	// Remove credentials for this remote
 	ClearCredentials(name)
@@ -134,16 +151,18 @@ func RenameRemote(repoRoot, oldName, newName string) error {
 		return fmt.Errorf("failed to rename remote in config: %w", err)
 	}
 
-	// Rename refs directory if it exists
-	oldRefsDir := filepath.Join(repoRoot, ".vec", "refs", "remotes", oldName)
-	newRefsDir := filepath.Join(repoRoot, ".vec", "refs", "remotes", newName)
-	if utils.FileExists(oldRefsDir) {
-		// Ensure parent directory exists
-		if err := utils.EnsureDirExists(filepath.Dir(newRefsDir)); err != nil {
-			return fmt.Errorf("failed to create refs directory: %w", err)
-		}
-		if err := os.Rename(oldRefsDir, newRefsDir); err != nil {
-			return fmt.Errorf("failed to rename remote refs directory: %w", err)
+	// Rename refs and prefetch refs directories if they exist
+	for _, kind := range []string{"remotes", "prefetch"} {
+		oldRefsDir := filepath.Join(repoRoot, ".vec", "refs", kind, oldName)
+		newRefsDir := filepath.Join(repoRoot, ".vec", "refs", kind, newName)
+		if utils.FileExists(oldRefsDir) {
+			// Ensure parent directory exists
+			if err := utils.EnsureDirExists(filepath.Dir(newRefsDir)); err != nil {
+				return fmt.Errorf("failed to create refs directory: %w", err)
+			}
+			if err := os.Rename(oldRefsDir, newRefsDir); err != nil {
+				return fmt.Errorf("failed to rename remote refs directory: %w", err)
+			}
 		}
 	}
 
@@ -190,12 +209,13 @@ func SetRemoteAuth(repoRoot, name, username, password string) error {
 	}
 
 	// Check if remote exists
-	if _, exists := cfg.Remotes[name]; !exists {
+	remote, exists := cfg.Remotes[name]
+	if !exists {
 		return fmt.Errorf("%w: %s", ErrRemoteNotFound, name)
 	}
 
-	// Store credentials
-	if err := StoreCredentials(name, username, password); err != nil {
+	// Store credentials under the remote's host
+	if err := StoreCredentials(cfg, name, cfg.RewriteURL(remote.URL), username, password); err != nil {
 		return fmt.Errorf("failed to store credentials: %w", err)
 	}
 
@@ -240,9 +260,11 @@ func ListRemotes(repoRoot string) (map[string]RemoteInfo, error) {
 			URL:      remote.URL,
 			Branches: branches,
 		}
+		info.FetchURL, _ = cfg.GetRemoteURL(name)
+		info.PushURL, _ = cfg.GetRemotePushURL(name)
 		
 		// Try to read last fetched info
-		fetchInfoPath := filepath.Join(repoRoot, ".vec", "refs", "remotes", name, "FETCH_HEAD")
+		fetchInfoPath := core.RemoteFetchHeadPath(repoRoot, name)
 		if utils.FileExists(fetchInfoPath) {
 			fetchInfo, err := os.ReadFile(fetchInfoPath)
 			if err == nil {
@@ -285,7 +307,11 @@ func parseLastFetchedTime(fetchInfo string) int64 {
 		return 0
 	}
 	
-	timestampStr := strings.TrimSpace(fetchInfo[index+len("# last_fetched="):])
+	timestampStr := fetchInfo[index+len("# last_fetched="):]
+	if end := strings.IndexByte(timestampStr, '\n'); end != -1 {
+		timestampStr = timestampStr[:end]
+	}
+	timestampStr = strings.TrimSpace(timestampStr)
 	timestamp, _ := strconv.ParseInt(timestampStr, 10, 64)
 	return timestamp
 }
@@ -311,9 +337,11 @@ func GetRemoteInfo(repoRoot, name string) (*RemoteInfo, error) {
 		URL:      remote.URL,
 		Branches: branches,
 	}
+	info.FetchURL, _ = cfg.GetRemoteURL(name)
+	info.PushURL, _ = cfg.GetRemotePushURL(name)
 	
 	// Try to read last fetched info
-	fetchInfoPath := filepath.Join(repoRoot, ".vec", "refs", "remotes", name, "FETCH_HEAD")
+	fetchInfoPath := core.RemoteFetchHeadPath(repoRoot, name)
 	if utils.FileExists(fetchInfoPath) {
 		fetchInfo, err := os.ReadFile(fetchInfoPath)
 		if err == nil {
@@ -324,6 +352,24 @@ func GetRemoteInfo(repoRoot, name string) (*RemoteInfo, error) {
 	return info, nil
 }
 
+// GetRemoteServerInfo asks remote name for its repository statistics and
+// capabilities. Servers without the info endpoint return vechttp.ErrNotFound.
+func GetRemoteServerInfo(repoRoot, name string) (*vechttp.RepoInfo, error) {
+	cfg, err := config.LoadConfig(repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	remoteURL, err := cfg.GetRemoteURL(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRemoteNotFound, name)
+	}
+	client, err := openTransport(remoteURL, name, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetInfo()
+}
+
 // listRemoteBranches lists all branches for a remote
 func listRemoteBranches(repoRoot, remoteName string) ([]string, error) {
 	remoteBranchesDir := filepath.Join(repoRoot, ".vec", "refs", "remotes", remoteName)
@@ -380,7 +426,10 @@ func prune(repoRoot, remoteName string) error {
 		return fmt.Errorf("failed to get remote URL: %w", err)
 	}
 
-	client := vechttp.NewClient(remoteURL, remoteName, cfg)
+	client, err := openTransport(remoteURL, remoteName, cfg)
+	if err != nil {
+		return err
+	}
 	remoteRefs, err := client.GetRefs()
 	if err != nil {
 		return fmt.Errorf("failed to get remote refs: %w", err)
@@ -415,11 +464,12 @@ func prune(repoRoot, remoteName string) error {
 // MergeRemoteBranch merges a remote branch into the current branch
 func MergeRemoteBranch(repoRoot, remoteName, remoteBranch string, interactive bool) error {
 	repo := core.NewRepository(repoRoot)
-	return MergeRemoteBranchRepo(repo, remoteName, remoteBranch, interactive)
+	return MergeRemoteBranchRepo(repo, remoteName, remoteBranch, interactive, false)
 }
 
-// MergeRemoteBranchRepo merges a remote branch into the current branch using Repository context
-func MergeRemoteBranchRepo(repo *core.Repository, remoteName, remoteBranch string, interactive bool) error {
+// MergeRemoteBranchRepo merges a remote branch into the current branch using Repository context.
+// noVerifySignatures skips the merge.verifySignatures check of the merged commits.
+func MergeRemoteBranchRepo(repo *core.Repository, remoteName, remoteBranch string, interactive, noVerifySignatures bool) error {
 	// Get current branch
 	currentBranch, err := repo.GetCurrentBranch()
 	if err != nil {
@@ -436,42 +486,16 @@ func MergeRemoteBranchRepo(repo *core.Repository, remoteName, remoteBranch strin
 		return fmt.Errorf("remote branch '%s/%s' not found", remoteName, remoteBranch)
 	}
 
-	remoteBranchCommit, err := utils.ReadRef(repo.Root, filepath.Join("refs", "remotes", remoteName, remoteBranch))
-	if err != nil {
-		return fmt.Errorf("failed to read remote branch commit: %w", err)
-	}
-
-	// Get current branch commit
-	currentCommit, err := repo.GetHeadCommit()
-	if err != nil {
-		return fmt.Errorf("failed to get current commit: %w", err)
-	}
-
-	// Check if merge is needed
-	if currentCommit == remoteBranchCommit {
-		return fmt.Errorf("already up-to-date with '%s/%s'", remoteName, remoteBranch)
+	// Perform the merge; it fast-forwards when merge.ff allows and checks
+	// the signatures of the merged commits
+	mergeConfig := &merge.MergeConfig{
+		Strategy:           merge.MergeStrategyRecursive,
+		Interactive:        interactive,
+		NoVerifySignatures: noVerifySignatures,
 	}
-
-	// Perform the merge
-	mergeResult, err := merge.Merge(
-		repo.Root,
-		currentCommit,
-		remoteBranchCommit,
-		fmt.Sprintf("Merge remote branch '%s/%s' into %s", remoteName, remoteBranch, currentBranch),
-		interactive,
-	)
-	if err != nil {
+	if _, err := merge.MergeRepo(repo, remoteName+"/"+remoteBranch, mergeConfig); err != nil {
 		return fmt.Errorf("merge failed: %w", err)
 	}
-
-	if mergeResult.FastForward {
-		fmt.Printf("Fast-forward merge, updated %s to %s\n", currentBranch, mergeResult.MergeCommit[:7])
-	} else if mergeResult.Success {
-		fmt.Printf("Merge completed successfully, created commit %s\n", mergeResult.MergeCommit[:7])
-	} else {
-		return fmt.Errorf("merge resulted in conflicts, please resolve them manually")
-	}
-
 	return nil
 }
 
@@ -0,0 +1,55 @@
+package remote
+
+import (
+	"fmt"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	vechttp "github.com/NahomAnteneh/vec/internal/remote/http"
+)
+
+// shallowFetchRepo returns the cut-off a fetch with opts asks the server
+// for, along with the shallow commits of the repository
+func shallowFetchRepo(repo *core.Repository, opts FetchOptions) (vechttp.ShallowFetch, error) {
+	shallow, err := objects.ReadShallowRepo(repo)
+	if err != nil {
+		return vechttp.ShallowFetch{}, err
+	}
+	request := vechttp.ShallowFetch{Depth: opts.Depth, Shallow: shallow}
+	switch {
+	case opts.Unshallow:
+		if len(shallow) == 0 {
+			return vechttp.ShallowFetch{}, core.RemoteError("--unshallow on a complete repository does not make sense", nil)
+		}
+		request.Depth, request.DeepenRelative = objects.UnshallowDepth, true
+	case opts.Deepen > 0:
+		request.Depth, request.DeepenRelative = opts.Deepen, true
+	}
+	return request, nil
+}
+
+// deepensHistory reports whether a fetch may bring history below the
+// shallow commits, which unchanged refs don't rule out
+func deepensHistory(shallow vechttp.ShallowFetch) bool {
+	return shallow.Depth > 0 && len(shallow.Shallow) > 0
+}
+
+// updateShallowRepo records the new shallow commits after a fetch cut off as
+// shallow asked, below the fetched refs
+func updateShallowRepo(repo *core.Repository, shallow vechttp.ShallowFetch, refs map[string]string, opts FetchOptions) error {
+	if shallow.Depth == 0 && len(shallow.Shallow) == 0 {
+		return nil
+	}
+	tips := make([]string, 0, len(refs))
+	for _, hash := range refs {
+		tips = append(tips, hash)
+	}
+	commits, err := objects.UpdateShallowRepo(repo, tips)
+	if err != nil {
+		return fmt.Errorf("failed to update shallow commits: %w", err)
+	}
+	if !opts.Quiet && len(shallow.Shallow) > 0 && len(commits) == 0 {
+		fmt.Println("Repository is no longer shallow")
+	}
+	return nil
+}
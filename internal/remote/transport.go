@@ -0,0 +1,33 @@
+package remote
+
+import (
+	"github.com/NahomAnteneh/vec/internal/config"
+	vechttp "github.com/NahomAnteneh/vec/internal/remote/http"
+)
+
+// remoteTransport reads and updates the refs and objects of a remote: a
+// *vechttp.Client for servers, a *localTransport for repositories on the same
+// machine
+type remoteTransport interface {
+	RemoteURL() string
+	GetRefs() (map[string]string, error)
+	GetInfo() (*vechttp.RepoInfo, error)
+	ObjectsExist(hashes []string) (map[string]bool, error)
+	PushStream(ref, oldCommit, newCommit string, pack vechttp.PackWriter) (*vechttp.PushResult, error)
+	PushStreamWithLease(ref, expectedCommit, newCommit string, pack vechttp.PackWriter) (*vechttp.PushResult, error)
+	DeleteRef(ref, oldCommit string) (*vechttp.PushResult, error)
+	PushRefs(commands []vechttp.RefCommand, atomic bool, pack vechttp.PackWriter) (*vechttp.PushResult, error)
+}
+
+// openTransport returns the transport for remoteURL: the local one for
+// file:// URLs and paths, an HTTP client otherwise
+func openTransport(remoteURL, remoteName string, cfg *config.Config) (remoteTransport, error) {
+	if path, ok := localRemotePath(remoteURL); ok {
+		t, err := openLocalTransport(remoteURL, path)
+		if err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+	return vechttp.NewClient(remoteURL, remoteName, cfg), nil
+}
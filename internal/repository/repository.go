@@ -4,18 +4,26 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"github.com/NahomAnteneh/vec/core"
 	"github.com/NahomAnteneh/vec/utils"
 )
 
-// createCommonDirectories creates the standard directory structure for a Vec repository
-func createCommonDirectories(baseDir string) error {
+// infoExcludeTemplate is the initial .vec/info/exclude
+const infoExcludeTemplate = `# Patterns listed here are ignored like those in .vecignore, but only in
+# this repository: the file is not versioned.
+`
+
+// createCommonDirectories creates the standard directory structure for a Vec
+// repository with HEAD pointing at branch
+func createCommonDirectories(baseDir, branch string) error {
 	// Create subdirectories
 	subDirs := []string{
 		filepath.Join(baseDir, "objects"),
 		filepath.Join(baseDir, "objects", "pack"),
 		filepath.Join(baseDir, "objects", "info"),
+		filepath.Join(baseDir, "info"),
 		filepath.Join(baseDir, "refs", "heads"),
 		filepath.Join(baseDir, "refs", "remotes"),
 		filepath.Join(baseDir, "logs", "refs", "heads"),
@@ -32,7 +40,8 @@ func createCommonDirectories(baseDir string) error {
 	files := map[string]string{
 		filepath.Join(baseDir, "objects", "info", "packs"):      "",
 		filepath.Join(baseDir, "objects", "info", "alternates"): "",
-		filepath.Join(baseDir, "HEAD"):                          "ref: refs/heads/main\n",
+		filepath.Join(baseDir, "HEAD"):                          "ref: refs/heads/" + branch + "\n",
+		filepath.Join(baseDir, "info", "exclude"):               infoExcludeTemplate,
 		filepath.Join(baseDir, "logs", "HEAD"):                  "",
 	}
 	
@@ -47,6 +56,16 @@ func createCommonDirectories(baseDir string) error {
 
 // CreateRepo initializes a new Vec repository using Repository context
 func CreateRepo(repo *core.Repository) error {
+	if err := InitRepo(repo); err != nil {
+		return err
+	}
+	fmt.Printf("Initialized empty Vec repository in %s\n", repo.VecDir)
+	return nil
+}
+
+// InitRepo creates the .vec directory of an empty repository, as CreateRepo
+// does, without reporting it
+func InitRepo(repo *core.Repository) error {
 	vecDir := repo.VecDir
 
 	// Check if repository already exists.
@@ -60,11 +79,31 @@ func CreateRepo(repo *core.Repository) error {
 	}
 
 	// Create common directory structure
-	if err := createCommonDirectories(vecDir); err != nil {
+	branch, err := core.ResolveDefaultBranch(repo.Root)
+	if err != nil {
+		return err
+	}
+	if err := createCommonDirectories(vecDir, branch.Value); err != nil {
 		return err
 	}
 
-	fmt.Printf("Initialized empty Vec repository in %s\n", vecDir)
+	// Record whether README.md and readme.md are the same file here, and
+	// whether names come back decomposed, so the index and checkout can
+	// account for it
+	ignoreCase, err := core.ProbeIgnoreCase(vecDir)
+	if err != nil {
+		return err
+	}
+	if err := core.SetConfigValue(repo.Root, core.IgnoreCaseKey, strconv.FormatBool(ignoreCase), false); err != nil {
+		return fmt.Errorf("failed to write %s: %w", core.IgnoreCaseKey, err)
+	}
+	precompose, err := core.ProbeDecomposesUnicode(vecDir)
+	if err != nil {
+		return err
+	}
+	if err := core.SetConfigValue(repo.Root, core.PrecomposeUnicodeKey, strconv.FormatBool(precompose), false); err != nil {
+		return fmt.Errorf("failed to write %s: %w", core.PrecomposeUnicodeKey, err)
+	}
 	return nil
 }
 
@@ -91,7 +130,11 @@ func CreateBareRepo(repo *core.Repository) error {
 	}
 
 	// Create common directory structure
-	if err := createCommonDirectories(dir); err != nil {
+	branch, err := core.ResolveDefaultBranch(repo.Root)
+	if err != nil {
+		return err
+	}
+	if err := createCommonDirectories(dir, branch.Value); err != nil {
 		return err
 	}
 
@@ -0,0 +1,253 @@
+package secrets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// Configuration of the commit secret scan
+const (
+	ScanKey    = "secrets.scan"    // false turns the scan off
+	EntropyKey = "secrets.entropy" // Bits per character above which long tokens are reported; unset disables it
+	ScannerKey = "secrets.scanner" // External command run on the staged files
+	RulePrefix = "secrets.rule."   // secrets.rule.<name> holds the regexp of a custom rule
+
+	// AllowlistFile lists, in the working tree, the paths, rules and
+	// findings the scan lets through
+	AllowlistFile = ".vecsecrets"
+
+	// AllowMarker on a line lets it through
+	AllowMarker = "vec:allow-secret"
+)
+
+// EntropyRule is the name findings of the entropy check are reported under
+const EntropyRule = "high-entropy"
+
+// Tokens shorter than this are never checked for entropy
+const entropyMinLength = 20
+
+// Rule is a named pattern of a likely credential
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// builtinRules catch well known credential formats
+var builtinRules = []Rule{
+	{"aws-access-key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"github-token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{"gitlab-token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_\-]{20,}\b`)},
+	{"slack-token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`)},
+	{"google-api-key", regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+	{"stripe-secret-key", regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{24,}\b`)},
+	{"private-key", regexp.MustCompile(`-----BEGIN ([A-Z0-9]+ )*PRIVATE KEY( BLOCK)?-----`)},
+	{"password-assignment", regexp.MustCompile(`(?i)\b(password|passwd|secret|api_?key|access_?token|auth_?token)\b["']?\s*[:=]\s*["'][^"'\s]{8,}["']`)},
+}
+
+// entropyToken finds the candidates of the entropy check
+var entropyToken = regexp.MustCompile(`[A-Za-z0-9+/=_\-]{20,}`)
+
+// Scanner checks added lines against the rules
+type Scanner struct {
+	Rules     []Rule
+	Entropy   float64 // Zero disables the entropy check
+	allowlist *Allowlist
+}
+
+// NewScanner loads the built-in rules, the secrets.rule.* rules, which
+// replace a built-in rule of the same name, and the entropy threshold
+func NewScanner(repo *core.Repository, allowlist *Allowlist) (*Scanner, error) {
+	s := &Scanner{allowlist: allowlist}
+	custom, err := customRules(repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range builtinRules {
+		if _, replaced := custom[rule.Name]; !replaced {
+			s.Rules = append(s.Rules, rule)
+		}
+	}
+	names := make([]string, 0, len(custom))
+	for name := range custom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s.Rules = append(s.Rules, Rule{name, custom[name]})
+	}
+
+	value, err := repo.GetConfig(EntropyKey)
+	if err != nil {
+		return nil, core.ConfigError("failed to read "+EntropyKey, err)
+	}
+	if value != "" {
+		if s.Entropy, err = strconv.ParseFloat(value, 64); err != nil || s.Entropy <= 0 {
+			return nil, core.ConfigError(fmt.Sprintf("invalid %s '%s': expected bits per character, e.g. 4.5", EntropyKey, value), nil)
+		}
+	}
+	return s, nil
+}
+
+// customRules returns the secrets.rule.* patterns, local ones overriding
+// global ones
+func customRules(repo *core.Repository) (map[string]*regexp.Regexp, error) {
+	global, err := core.ReadGlobalConfig()
+	if err != nil {
+		global = nil // No global config
+	}
+	local, err := core.ReadConfig(filepath.Join(repo.VecDir, "config"))
+	if err != nil {
+		return nil, core.ConfigError("failed to read config", err)
+	}
+
+	rules := make(map[string]*regexp.Regexp)
+	for _, config := range []map[string]string{global, local} {
+		for key, value := range config {
+			name := strings.TrimPrefix(key, RulePrefix)
+			if name == key || name == "" {
+				continue
+			}
+			pattern, err := regexp.Compile(value)
+			if err != nil {
+				return nil, core.ConfigError(fmt.Sprintf("invalid pattern in %s", key), err)
+			}
+			rules[name] = pattern
+		}
+	}
+	return rules, nil
+}
+
+// Finding is a likely credential on an added line
+type Finding struct {
+	Path        string
+	Line        int
+	Rule        string
+	Match       string
+	Fingerprint string // Identifies the finding in the allowlist
+}
+
+// Redacted returns the match with all but its first characters hidden
+func (f Finding) Redacted() string {
+	if len(f.Match) <= 8 {
+		return strings.Repeat("*", len(f.Match))
+	}
+	return f.Match[:4] + strings.Repeat("*", 8)
+}
+
+// fingerprint identifies a match independently of where it is
+func fingerprint(rule, match string) string {
+	sum := sha256.Sum256([]byte(rule + ":" + match))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ScanLine returns the findings on one line of filePath
+func (s *Scanner) ScanLine(filePath string, lineNo int, line string) []Finding {
+	if strings.Contains(line, AllowMarker) {
+		return nil
+	}
+	var findings []Finding
+	add := func(rule, match string) {
+		f := Finding{Path: filePath, Line: lineNo, Rule: rule, Match: match, Fingerprint: fingerprint(rule, match)}
+		if !s.allowlist.allowsFinding(f) {
+			findings = append(findings, f)
+		}
+	}
+	for _, rule := range s.Rules {
+		for _, match := range rule.Pattern.FindAllString(line, -1) {
+			add(rule.Name, match)
+		}
+	}
+	if s.Entropy > 0 {
+		for _, token := range entropyToken.FindAllString(line, -1) {
+			if len(token) >= entropyMinLength && shannonEntropy(token) >= s.Entropy {
+				add(EntropyRule, token)
+			}
+		}
+	}
+	return findings
+}
+
+// shannonEntropy returns the entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	n := float64(len([]rune(s)))
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// Allowlist holds the entries of .vecsecrets: finding fingerprints,
+// rule:<name> to turn a rule off, and path globs, one per line
+type Allowlist struct {
+	fingerprints map[string]bool
+	rules        map[string]bool
+	paths        []string
+}
+
+// ParseAllowlist parses the content of an allowlist file
+func ParseAllowlist(content string) *Allowlist {
+	a := &Allowlist{fingerprints: make(map[string]bool), rules: make(map[string]bool)}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if rule, ok := strings.CutPrefix(line, "rule:"); ok {
+			a.rules[strings.TrimSpace(rule)] = true
+		} else if isFingerprint(line) {
+			a.fingerprints[line] = true
+		} else {
+			a.paths = append(a.paths, strings.TrimPrefix(line, "/"))
+		}
+	}
+	return a
+}
+
+func isFingerprint(s string) bool {
+	if len(s) != 16 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// AllowsPath reports whether filePath is never scanned
+func (a *Allowlist) AllowsPath(filePath string) bool {
+	if a == nil {
+		return false
+	}
+	for _, pattern := range a.paths {
+		if strings.HasSuffix(pattern, "/") && strings.HasPrefix(filePath, pattern) {
+			return true
+		}
+		if ok, _ := path.Match(pattern, filePath); ok {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(filePath)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a *Allowlist) allowsFinding(f Finding) bool {
+	return a != nil && (a.rules[f.Rule] || a.fingerprints[f.Fingerprint])
+}
@@ -0,0 +1,196 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/staging"
+)
+
+// Files larger than this are not scanned
+const maxScanSize = 1 << 20
+
+// ErrScannerFailed is returned when the secrets.scanner command rejects the
+// staged files
+var ErrScannerFailed = errors.New("secret scanner rejected the commit")
+
+// Enabled reports whether commits are scanned; on unless secrets.scan is false
+func Enabled(repo *core.Repository) bool {
+	value, err := repo.GetConfig(ScanKey)
+	if err != nil {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "false", "no", "off", "0":
+		return false
+	}
+	return true
+}
+
+// LoadAllowlistRepo reads .vecsecrets from the working tree; a missing file
+// allows nothing
+func LoadAllowlistRepo(repo *core.Repository) (*Allowlist, error) {
+	content, err := os.ReadFile(filepath.Join(repo.Root, AllowlistFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ParseAllowlist(""), nil
+		}
+		return nil, core.FSError("failed to read "+AllowlistFile, err)
+	}
+	return ParseAllowlist(string(content)), nil
+}
+
+// changedFile is a file of the new tree that differs from the old one
+type changedFile struct {
+	path    string
+	oldHash string // Empty for an added file
+	newHash string
+}
+
+// changedFilesRepo returns the files added or modified between two trees,
+// leaving out submodules and allowlisted paths
+func changedFilesRepo(repo *core.Repository, oldTree, newTree string, allowlist *Allowlist) ([]changedFile, error) {
+	oldIndex, err := staging.IndexFromTreeRepo(repo, oldTree)
+	if err != nil {
+		return nil, err
+	}
+	newIndex, err := staging.IndexFromTreeRepo(repo, newTree)
+	if err != nil {
+		return nil, err
+	}
+	old := make(map[string]string, len(oldIndex.Entries))
+	for _, entry := range oldIndex.Entries {
+		old[entry.FilePath] = entry.SHA256
+	}
+
+	var changed []changedFile
+	for _, entry := range newIndex.Entries {
+		relPath := filepath.ToSlash(entry.FilePath)
+		if entry.Mode == objects.ModeGitlink || old[entry.FilePath] == entry.SHA256 {
+			continue
+		}
+		if relPath == AllowlistFile || allowlist.AllowsPath(relPath) {
+			continue
+		}
+		changed = append(changed, changedFile{path: relPath, oldHash: old[entry.FilePath], newHash: entry.SHA256})
+	}
+	return changed, nil
+}
+
+// scanFileRepo returns the findings on the lines of file that are not in
+// its old version, so credentials committed before don't block every
+// later change to the file
+func scanFileRepo(repo *core.Repository, scanner *Scanner, file changedFile) ([]Finding, error) {
+	content, err := objects.GetBlobRepo(repo, file.newHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", file.path, err)
+	}
+	if len(content) > maxScanSize || bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0 {
+		return nil, nil // Large or binary
+	}
+
+	oldLines := make(map[string]bool)
+	if file.oldHash != "" {
+		if oldContent, err := objects.GetBlobRepo(repo, file.oldHash); err == nil {
+			for _, line := range strings.Split(string(oldContent), "\n") {
+				oldLines[line] = true
+			}
+		}
+	}
+
+	var findings []Finding
+	for i, line := range strings.Split(string(content), "\n") {
+		if !oldLines[line] {
+			findings = append(findings, scanner.ScanLine(file.path, i+1, line)...)
+		}
+	}
+	return findings, nil
+}
+
+// ScanCommitRepo checks the files newTree adds or changes relative to
+// oldTree for likely credentials, then runs secrets.scanner on them. It
+// returns the findings of the built-in scan; a rejection by the external
+// scanner is ErrScannerFailed.
+func ScanCommitRepo(repo *core.Repository, oldTree, newTree string) ([]Finding, error) {
+	allowlist, err := LoadAllowlistRepo(repo)
+	if err != nil {
+		return nil, err
+	}
+	scanner, err := NewScanner(repo, allowlist)
+	if err != nil {
+		return nil, err
+	}
+	changed, err := changedFilesRepo(repo, oldTree, newTree, allowlist)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, file := range changed {
+		fileFindings, err := scanFileRepo(repo, scanner, file)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, fileFindings...)
+	}
+
+	command, err := repo.GetConfig(ScannerKey)
+	if err != nil {
+		return findings, core.ConfigError("failed to read "+ScannerKey, err)
+	}
+	if command != "" && len(changed) > 0 {
+		if err := runExternalScannerRepo(repo, command, changed); err != nil {
+			return findings, err
+		}
+	}
+	return findings, nil
+}
+
+// runExternalScannerRepo writes the staged content of the changed files to a
+// temporary directory and runs command in it through the shell, with the
+// file paths as arguments. A non-zero exit rejects the commit.
+func runExternalScannerRepo(repo *core.Repository, command string, changed []changedFile) error {
+	dir, err := os.MkdirTemp("", "vec-secrets-")
+	if err != nil {
+		return core.FSError("failed to create scan directory", err)
+	}
+	defer os.RemoveAll(dir)
+
+	paths := make([]string, 0, len(changed))
+	for _, file := range changed {
+		content, err := objects.GetBlobRepo(repo, file.newHash)
+		if err != nil {
+			return fmt.Errorf("failed to read '%s': %w", file.path, err)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(file.path))
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return core.FSError("failed to create scan directory", err)
+		}
+		if err := os.WriteFile(target, content, 0600); err != nil {
+			return core.FSError("failed to write scan file", err)
+		}
+		paths = append(paths, file.path)
+	}
+
+	// "$@" passes the paths through unsplit
+	cmd := exec.Command("sh", append([]string{"-c", command + ` "$@"`, "vec-secrets"}, paths...)...)
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), core.HookEnvVecDir+"="+repo.VecDir, core.HookEnvWorkTree+"="+repo.Root)
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("%w: %s exited with status %d", ErrScannerFailed, ScannerKey, exitErr.ExitCode())
+		}
+		return fmt.Errorf("failed to run %s: %w", ScannerKey, err)
+	}
+	return nil
+}
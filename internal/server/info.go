@@ -0,0 +1,120 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	vechttp "github.com/NahomAnteneh/vec/internal/remote/http"
+)
+
+// ArchivedKey marks a repository as read-only: it can be fetched but refuses
+// pushes
+const ArchivedKey = "receive.archived"
+
+// ErrRepoArchived is returned for a ref update of an archived repository
+var ErrRepoArchived = errors.New("repository is archived")
+
+// serverCapabilities lists what this server supports, advertised in RepoInfo
+var serverCapabilities = []string{
+	vechttp.CapabilityObjectsExist,
+	vechttp.CapabilityPushLease,
+	vechttp.CapabilityDeleteRefs,
+	vechttp.CapabilityFilter,
+	vechttp.CapabilityShallow,
+}
+
+// RepoInfo answers an info request: the default branch, branch and tag
+// counts, bytes stored and server capabilities of repoName
+func (s *Server) RepoInfo(repoName string) (*vechttp.RepoInfo, error) {
+	s.repoLock.RLock()
+	defer s.repoLock.RUnlock()
+
+	if !s.RepoExists(repoName) {
+		return nil, ErrRepoNotFound
+	}
+	repo := core.NewRepository(s.GetRepoPath(repoName))
+
+	info := &vechttp.RepoInfo{Capabilities: serverCapabilities}
+	head, err := os.ReadFile(filepath.Join(repo.VecDir, core.HeadFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HEAD: %w", err)
+	}
+	if ref, ok := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: "); ok {
+		info.DefaultBranch = strings.TrimPrefix(ref, "refs/heads/")
+	}
+
+	if info.Branches, err = countRefs(filepath.Join(repo.VecDir, "refs", "heads")); err != nil {
+		return nil, err
+	}
+	if info.Tags, err = countRefs(filepath.Join(repo.VecDir, "refs", "tags")); err != nil {
+		return nil, err
+	}
+	if info.Size, err = dirSize(repo.VecDir); err != nil {
+		return nil, err
+	}
+	if info.Archived, err = isArchivedRepo(repo); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// isArchivedRepo reports whether receive.archived is set for repo
+func isArchivedRepo(repo *core.Repository) (bool, error) {
+	value, err := repo.GetConfig(ArchivedKey)
+	if err != nil {
+		return false, core.ConfigError("failed to read "+ArchivedKey, err)
+	}
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "false", "no", "off", "0":
+		return false, nil
+	case "true", "yes", "on", "1":
+		return true, nil
+	}
+	return false, core.ConfigError(fmt.Sprintf("invalid boolean value '%s' for %s", value, ArchivedKey), nil)
+}
+
+// countRefs counts the ref files under dir, including nested ones
+func countRefs(dir string) (int, error) {
+	count := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count refs in %s: %w", dir, err)
+	}
+	return count, nil
+}
+
+// dirSize sums the sizes of the files under dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure repository size: %w", err)
+	}
+	return size, nil
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/packfile"
+	vechttp "github.com/NahomAnteneh/vec/internal/remote/http"
+)
+
+// ExistingObjects answers an objects/exists request: it returns the hashes
+// from the request that repoName already stores. Requests larger than
+// vechttp.ObjectsExistBatchSize are refused so clients chunk their lists.
+func (s *Server) ExistingObjects(repoName string, hashes []string) ([]string, error) {
+	if !s.RepoExists(repoName) {
+		return nil, ErrRepoNotFound
+	}
+	if len(hashes) > vechttp.ObjectsExistBatchSize {
+		return nil, ErrInvalidRequest
+	}
+
+	repoPath := s.GetRepoPath(repoName)
+	existing := make([]string, 0, len(hashes))
+	for _, hash := range hashes {
+		if core.IsValidHex(hash) && core.ObjectExists(repoPath, hash) {
+			existing = append(existing, hash)
+		}
+	}
+	return existing, nil
+}
+
+// CheckIncomingObjects validates the objects of a pushed pack when the
+// repository sets receive.fsckObjects or transfer.fsckObjects, rejecting the
+// push before any object is stored.
+func (s *Server) CheckIncomingObjects(repoName string, objs []packfile.Object) error {
+	if !s.RepoExists(repoName) {
+		return ErrRepoNotFound
+	}
+	repo := core.NewRepository(s.GetRepoPath(repoName))
+	enabled, err := objects.FsckObjectsEnabledRepo(repo, "receive.fsckObjects")
+	if err != nil || !enabled {
+		return err
+	}
+	return objects.CheckPackObjects(objs)
+}
@@ -0,0 +1,283 @@
+package server
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/packfile"
+)
+
+// DefaultPackCacheSize is the memory used for cached fetch packs
+const DefaultPackCacheSize = 256 << 20
+
+// Fetch filters understood by FetchPack
+const (
+	FilterNone     = ""
+	FilterBlobNone = "blob:none" // Omit blobs; the client fetches them on demand
+)
+
+// FetchRequest is the set of objects a client asks for: everything reachable
+// from Wants that is not reachable from Haves, narrowed by Filter and cut off
+// below Depth. Shallow lists the client's commits whose parents it lacks.
+type FetchRequest struct {
+	Wants          []string `json:"wants"`
+	Haves          []string `json:"haves"`
+	Filter         string   `json:"filter,omitempty"`
+	Depth          int      `json:"depth,omitempty"`
+	DeepenRelative bool     `json:"deepenRelative,omitempty"` // Depth counts from Shallow instead of Wants
+	Shallow        []string `json:"shallow,omitempty"`
+}
+
+// normalize sorts and deduplicates the hash lists so equivalent requests
+// share a cache key
+func (r FetchRequest) normalize() FetchRequest {
+	return FetchRequest{
+		Wants:          sortedUnique(r.Wants),
+		Haves:          sortedUnique(r.Haves),
+		Filter:         strings.TrimSpace(r.Filter),
+		Depth:          r.Depth,
+		DeepenRelative: r.DeepenRelative,
+		Shallow:        sortedUnique(r.Shallow),
+	}
+}
+
+// valid reports whether a normalized request can be served
+func (r FetchRequest) valid() bool {
+	if len(r.Wants) == 0 || (r.Filter != FilterNone && r.Filter != FilterBlobNone) || r.Depth < 0 {
+		return false
+	}
+	for _, hash := range append(append(append([]string(nil), r.Wants...), r.Haves...), r.Shallow...) {
+		if !core.IsValidHex(hash) {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheKey identifies a normalized request against repoName. Objects are
+// content addressed, so the same wants and haves always produce the same pack.
+func (r FetchRequest) cacheKey(repoName string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "repo %s\nfilter %s\ndepth %d %t\n", repoName, r.Filter, r.Depth, r.DeepenRelative)
+	for _, want := range r.Wants {
+		fmt.Fprintf(h, "want %s\n", want)
+	}
+	for _, have := range r.Haves {
+		fmt.Fprintf(h, "have %s\n", have)
+	}
+	for _, shallow := range r.Shallow {
+		fmt.Fprintf(h, "shallow %s\n", shallow)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// sortedUnique returns the sorted distinct non-empty values of hashes
+func sortedUnique(hashes []string) []string {
+	seen := make(map[string]bool, len(hashes))
+	result := make([]string, 0, len(hashes))
+	for _, hash := range hashes {
+		hash = strings.TrimSpace(hash)
+		if hash != "" && !seen[hash] {
+			seen[hash] = true
+			result = append(result, hash)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// packCache keeps generated fetch packs, evicting the least recently used
+// once their total size exceeds maxBytes
+type packCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	used     int64
+	order    *list.List // Front is most recently used
+	entries  map[string]*list.Element
+}
+
+type packCacheEntry struct {
+	key  string
+	data []byte
+}
+
+// newPackCache creates a cache holding up to maxBytes; zero or less disables it
+func newPackCache(maxBytes int64) *packCache {
+	return &packCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached pack for key
+func (c *packCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*packCacheEntry).data, true
+}
+
+// put stores a pack, evicting older ones to make room. Packs larger than the
+// whole cache are not kept.
+func (c *packCache) put(key string, data []byte) {
+	size := int64(len(data))
+	if c.maxBytes <= 0 || size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+	for c.used+size > c.maxBytes {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*packCacheEntry)
+		c.order.Remove(oldest)
+		delete(c.entries, entry.key)
+		c.used -= int64(len(entry.data))
+	}
+	c.entries[key] = c.order.PushFront(&packCacheEntry{key: key, data: data})
+	c.used += size
+}
+
+// FetchPack returns a packfile with the objects req asks for from repoName.
+// Identical requests are served from the pack cache, and a request matching
+// exactly the contents of a pack already on disk is served from that pack.
+func (s *Server) FetchPack(repoName string, req FetchRequest) ([]byte, error) {
+	req = req.normalize()
+	if !req.valid() {
+		return nil, ErrInvalidRequest
+	}
+
+	s.repoLock.RLock()
+	defer s.repoLock.RUnlock()
+
+	if !s.RepoExists(repoName) {
+		return nil, ErrRepoNotFound
+	}
+
+	key := req.cacheKey(repoName)
+	if data, ok := s.packs.get(key); ok {
+		return data, nil
+	}
+
+	repo := core.NewRepository(s.GetRepoPath(repoName))
+	wanted, err := fetchObjectsRepo(repo, req)
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok, err := wholePackRepo(repo, wanted)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		data, err = packfile.CreatePackfile(repo.Root, wanted)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create packfile: %w", err)
+		}
+	}
+
+	s.packs.put(key, data)
+	return data, nil
+}
+
+// NegotiateFetch answers a fetch/negotiate request: the objects req asks
+// for from repoName, which the client then fetches as a pack
+func (s *Server) NegotiateFetch(repoName string, req FetchRequest) ([]string, error) {
+	req = req.normalize()
+	if !req.valid() {
+		return nil, ErrInvalidRequest
+	}
+
+	s.repoLock.RLock()
+	defer s.repoLock.RUnlock()
+
+	if !s.RepoExists(repoName) {
+		return nil, ErrRepoNotFound
+	}
+	return fetchObjectsRepo(core.NewRepository(s.GetRepoPath(repoName)), req)
+}
+
+// fetchObjectsRepo lists the objects reachable from req.Wants but not from
+// req.Haves, sorted. Haves the server doesn't know are ignored.
+func fetchObjectsRepo(repo *core.Repository, req FetchRequest) ([]string, error) {
+	var haves []string
+	for _, hash := range req.Haves {
+		if objects.HasObjectRepo(repo, hash) {
+			haves = append(haves, hash)
+		}
+	}
+
+	var listed []objects.ListedObject
+	var err error
+	if req.Depth > 0 || len(req.Shallow) > 0 {
+		listed, err = objects.ShallowObjectsRepo(repo, req.Wants, haves, objects.ShallowOptions{
+			Depth:    req.Depth,
+			Relative: req.DeepenRelative,
+			Shallow:  req.Shallow,
+		}, req.Filter == FilterBlobNone)
+	} else {
+		listed, err = objects.ListObjectsRepo(repo, req.Wants, haves, req.Filter == FilterBlobNone)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(listed))
+	for _, obj := range listed {
+		result = append(result, obj.Hash)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// wholePackRepo returns the contents of an on-disk pack holding exactly the
+// objects in hashes, if there is one
+func wholePackRepo(repo *core.Repository, hashes []string) ([]byte, bool, error) {
+	indexes, err := filepath.Glob(filepath.Join(repo.VecDir, "objects", "pack", "*.idx"))
+	if err != nil {
+		return nil, false, err
+	}
+	for _, indexPath := range indexes {
+		index, err := packfile.ReadPackIndex(indexPath)
+		if err != nil || len(index.Entries) != len(hashes) {
+			continue
+		}
+		matches := true
+		for _, hash := range hashes {
+			if _, ok := index.Entries[hash]; !ok {
+				matches = false
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+
+		data, err := os.ReadFile(strings.TrimSuffix(indexPath, ".idx") + ".pack")
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, false, fmt.Errorf("failed to read pack: %w", err)
+		}
+		return data, true, nil
+	}
+	return nil, false, nil
+}
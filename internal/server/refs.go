@@ -0,0 +1,183 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	vechttp "github.com/NahomAnteneh/vec/internal/remote/http"
+)
+
+// Ref update errors
+var (
+	ErrStaleRef        = errors.New("stale info: remote ref has moved")
+	ErrProtectedBranch = errors.New("branch is protected")
+	ErrNonFastForward  = errors.New("non-fast-forward update")
+	ErrHookDeclined    = errors.New("declined by hook")
+)
+
+// PushInfo is the ref update announced by a client before it sends a packfile
+type PushInfo struct {
+	Branch    string `json:"branch"`
+	Ref       string `json:"ref,omitempty"` // Full ref name; takes precedence over Branch
+	OldCommit string `json:"oldCommit"`
+	NewCommit string `json:"newCommit"`
+	Lease     bool   `json:"lease,omitempty"`  // OldCommit is a force-with-lease expectation
+	Delete    bool   `json:"delete,omitempty"` // Remove the ref; NewCommit is the zero hash
+}
+
+// PushRequest announces several ref updates sharing one packfile, which
+// follows when Packfile is set. Without one the updates are applied on the
+// announcement. Atomic updates are applied with UpdateRefsAtomic.
+type PushRequest struct {
+	Updates  []PushInfo `json:"updates"`
+	Packfile bool       `json:"packfile"`
+	Atomic   bool       `json:"atomic,omitempty"`
+}
+
+// RefName returns the full name of the ref being updated
+func (p PushInfo) RefName() string {
+	if p.Ref != "" {
+		return p.Ref
+	}
+	return "refs/heads/" + p.Branch
+}
+
+// UpdateRef moves a ref of repoName from info.OldCommit to info.NewCommit, or
+// deletes it. The update is a compare-and-swap: if another push moved the ref
+// since the client read it, the update is refused with ErrStaleRef.
+func (s *Server) UpdateRef(repoName string, info PushInfo) error {
+	s.repoLock.Lock()
+	defer s.repoLock.Unlock()
+	return s.updateRefLocked(repoName, info)
+}
+
+// UpdateRefsAtomic applies infos as UpdateRef does, all or none: once one is
+// refused, the updates already made are rolled back and the others are
+// reported as vechttp.RefStatusAtomic. No other push sees the refs midway.
+func (s *Server) UpdateRefsAtomic(repoName string, infos []PushInfo) []vechttp.RefStatus {
+	s.repoLock.Lock()
+	defer s.repoLock.Unlock()
+
+	statuses := make([]vechttp.RefStatus, len(infos))
+	failed := -1
+	for i, info := range infos {
+		err := s.updateRefLocked(repoName, info)
+		statuses[i] = RefStatusFor(info, err)
+		if err != nil {
+			failed = i
+			break
+		}
+	}
+	if failed < 0 {
+		return statuses
+	}
+
+	repoPath := s.GetRepoPath(repoName)
+	for i, info := range infos {
+		if i == failed {
+			continue
+		}
+		if i < failed {
+			// The compare-and-swap succeeded, so the ref was at OldCommit
+			newCommit := info.NewCommit
+			if info.Delete {
+				newCommit = ""
+			}
+			if err := core.UpdateRefCAS(repoPath, info.RefName(), newCommit, info.OldCommit); err != nil {
+				statuses[i].Message = fmt.Sprintf("applied, but rolling it back failed: %v", err)
+				continue
+			}
+		}
+		statuses[i] = AtomicRefStatus(info)
+	}
+	return statuses
+}
+
+// AtomicRefStatus is the status of an update of an atomic push left undone
+// because another update was refused
+func AtomicRefStatus(info PushInfo) vechttp.RefStatus {
+	return vechttp.RefStatus{Ref: info.RefName(), Status: vechttp.RefStatusAtomic, Message: "atomic push failed"}
+}
+
+// updateRefLocked is UpdateRef with s.repoLock held
+func (s *Server) updateRefLocked(repoName string, info PushInfo) error {
+	if !s.RepoExists(repoName) {
+		return ErrRepoNotFound
+	}
+	refName := info.RefName()
+	if !strings.HasPrefix(refName, "refs/") || strings.Contains(refName, "..") || refName == "refs/heads/" {
+		return ErrInvalidRequest
+	}
+	newCommit := info.NewCommit
+	if newCommit == vechttp.ZeroHash {
+		newCommit = ""
+	}
+	if info.Delete != (newCommit == "") || (!info.Delete && !core.IsValidHex(newCommit)) {
+		return ErrInvalidRequest
+	}
+
+	repoPath := s.GetRepoPath(repoName)
+	archived, err := isArchivedRepo(core.NewRepository(repoPath))
+	if err != nil {
+		return err
+	}
+	if archived {
+		return fmt.Errorf("%w: '%s' cannot be updated", ErrRepoArchived, refName)
+	}
+	branch := strings.TrimPrefix(refName, "refs/heads/")
+	if info.Delete && s.IsProtectedBranch(branch) {
+		return fmt.Errorf("%w: '%s' cannot be deleted", ErrProtectedBranch, branch)
+	}
+	if s.IsProtectedBranch(branch) && info.OldCommit != "" {
+		ff, err := objects.IsAncestorRepo(core.NewRepository(repoPath), info.OldCommit, info.NewCommit)
+		if err != nil {
+			return fmt.Errorf("failed to check update of protected branch '%s': %w", branch, err)
+		}
+		if !ff {
+			return fmt.Errorf("%w: '%s' only accepts fast-forward updates", ErrProtectedBranch, branch)
+		}
+	}
+
+	err = core.UpdateRefCAS(repoPath, refName, info.OldCommit, newCommit)
+	if errors.Is(err, core.ErrRefChanged) {
+		if info.Lease {
+			return fmt.Errorf("%w: lease for '%s' expired: %v", ErrStaleRef, refName, err)
+		}
+		return fmt.Errorf("%w: %v", ErrStaleRef, err)
+	}
+	return err
+}
+
+// IsProtectedBranch reports whether branch is listed in ServerOptions.ProtectedBranches
+func (s *Server) IsProtectedBranch(branch string) bool {
+	for _, protected := range s.Options.ProtectedBranches {
+		if protected == branch {
+			return true
+		}
+	}
+	return false
+}
+
+// RefStatusFor reports the outcome of an UpdateRef call in the form sent
+// back to clients in a push result.
+func RefStatusFor(info PushInfo, err error) vechttp.RefStatus {
+	status := vechttp.RefStatus{Ref: info.RefName(), Status: vechttp.RefStatusOK}
+	if err == nil {
+		return status
+	}
+	status.Message = err.Error()
+	switch {
+	case errors.Is(err, ErrProtectedBranch):
+		status.Status = vechttp.RefStatusProtected
+	case errors.Is(err, ErrNonFastForward):
+		status.Status = vechttp.RefStatusNonFastForward
+	case errors.Is(err, ErrHookDeclined):
+		status.Status = vechttp.RefStatusHook
+	default:
+		status.Status = vechttp.RefStatusRejected
+	}
+	return status
+}
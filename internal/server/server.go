@@ -51,6 +51,9 @@ type ServerOptions struct {
 	Verbose     bool
 	TLSCertFile string
 	TLSKeyFile  string
+
+	ProtectedBranches []string // Branches that refuse non-fast-forward updates
+	PackCacheSize     int64    // Bytes of generated fetch packs to keep; negative disables
 }
 
 // ServerStats contains server statistics
@@ -69,23 +72,26 @@ type Server struct {
 	router   *http.ServeMux
 	server   *http.Server
 	repoLock sync.RWMutex
+	packs    *packCache
 }
 
 // NewServer creates a new Vec server with default options
 func NewServer() *Server {
 	return &Server{
 		Options: ServerOptions{
-			Port:        DefaultPort,
-			Host:        DefaultHost,
-			ReposDir:    DefaultReposDir,
-			AuthEnabled: DefaultAuthEnabled,
-			Users:       make(map[string]string),
-			Verbose:     false,
+			Port:          DefaultPort,
+			Host:          DefaultHost,
+			ReposDir:      DefaultReposDir,
+			AuthEnabled:   DefaultAuthEnabled,
+			Users:         make(map[string]string),
+			Verbose:       false,
+			PackCacheSize: DefaultPackCacheSize,
 		},
 		Stats: ServerStats{
 			StartTime: time.Now(),
 		},
 		router: http.NewServeMux(),
+		packs:  newPackCache(DefaultPackCacheSize),
 	}
 }
 
@@ -110,6 +116,11 @@ func (s *Server) Configure(options ServerOptions) {
 	s.Options.Verbose = options.Verbose
 	s.Options.TLSCertFile = options.TLSCertFile
 	s.Options.TLSKeyFile = options.TLSKeyFile
+	s.Options.ProtectedBranches = options.ProtectedBranches
+	if options.PackCacheSize != 0 {
+		s.Options.PackCacheSize = options.PackCacheSize
+		s.packs = newPackCache(options.PackCacheSize)
+	}
 }
 
 // Init initializes the server
@@ -156,6 +167,13 @@ func (s *Server) Start() error {
 	return nil
 }
 
+// Handler returns the handler Start serves, for running the server on a
+// listener of the caller's, as tests do with net/http/httptest. Init must
+// have been called.
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
 // Stop gracefully stops the server
 func (s *Server) Stop(ctx context.Context) error {
 	log.Println("Shutting down server...")
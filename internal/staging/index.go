@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,9 +23,19 @@ import (
 
 // Index represents the staging area (index) in the repository.
 type Index struct {
-	Entries  []IndexEntry // List of entries in the index
-	Path     string       // Path to the index file (e.g., .vec/index)
-	entryMap map[string]*IndexEntry
+	Entries  []IndexEntry   // List of entries in the index
+	Path     string         // Path to the index file (e.g., .vec/index)
+	entryMap map[string]int // "path:stage" -> position in Entries
+	// duplicates counts the entries whose path and stage an earlier entry
+	// already has, as conflict entries may, which the map points past
+	duplicates int
+
+	// ignoreCase makes lookups case-insensitive (core.ignoreCase), so a path
+	// spelled differently on disk finds its entry
+	ignoreCase bool
+
+	// precompose stores and looks up paths in NFC (core.precomposeUnicode)
+	precompose bool
 }
 
 // IndexEntry represents a single entry in the index.
@@ -43,11 +54,128 @@ type IndexEntry struct {
 // NewIndex creates a new, empty Index using Repository context.
 func NewIndex(repo *core.Repository) *Index {
 	return &Index{
-		Entries: []IndexEntry{},
-		Path:    filepath.Join(repo.VecDir, "index"),
+		Entries:    []IndexEntry{},
+		Path:       filepath.Join(repo.VecDir, "index"),
+		entryMap:   make(map[string]int),
+		ignoreCase: repo.IgnoreCase(),
+		precompose: repo.PrecomposeUnicode(),
 	}
 }
 
+// entryKey returns the lookup key used by the entry map for a path and stage.
+func (i *Index) entryKey(filePath string, stage int) string {
+	return core.PathKey(core.NormalizePath(filePath, i.precompose), i.ignoreCase) + ":" + strconv.Itoa(stage)
+}
+
+// PrecomposePaths rewrites the paths of entries added before
+// core.precomposeUnicode was enabled to NFC. An entry whose normalized path
+// is already present is dropped in favour of the existing one. It returns
+// how many entries changed; the caller writes the index.
+func (i *Index) PrecomposePaths() int {
+	if !i.precompose {
+		return 0
+	}
+	changed := 0
+	seen := make(map[string]bool, len(i.Entries))
+	for _, entry := range i.Entries {
+		if core.IsNormalizedPath(entry.FilePath) {
+			seen[i.entryKey(entry.FilePath, entry.Stage)] = true
+		}
+	}
+	kept := i.Entries[:0]
+	for _, entry := range i.Entries {
+		if !core.IsNormalizedPath(entry.FilePath) {
+			changed++
+			key := i.entryKey(entry.FilePath, entry.Stage)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			entry.FilePath = core.NormalizePath(entry.FilePath, true)
+		}
+		kept = append(kept, entry)
+	}
+	i.Entries = kept
+	if changed > 0 {
+		i.rebuildMap()
+	}
+	return changed
+}
+
+// EnsureMap builds the path/stage lookup map if it is missing. Mutating methods
+// keep the map up to date, so this only does work after a load or after callers
+// have modified Entries directly.
+func (i *Index) EnsureMap() {
+	if i.entryMap != nil {
+		return
+	}
+	i.rebuildMap()
+}
+
+// rebuildMap recreates the lookup map from the current Entries slice.
+func (i *Index) rebuildMap() {
+	i.entryMap = make(map[string]int, len(i.Entries))
+	i.duplicates = 0
+	for j := range i.Entries {
+		key := i.entryKey(i.Entries[j].FilePath, i.Entries[j].Stage)
+		if _, ok := i.entryMap[key]; ok {
+			i.duplicates++
+		}
+		i.entryMap[key] = j
+	}
+}
+
+// reindexFrom refreshes map positions for all entries at or after start.
+// Used after a deletion shifts the tail of the slice.
+func (i *Index) reindexFrom(start int) {
+	for j := start; j < len(i.Entries); j++ {
+		i.entryMap[i.entryKey(i.Entries[j].FilePath, i.Entries[j].Stage)] = j
+	}
+}
+
+// lookup returns the position of the entry for a path and stage, or -1.
+// A stale map (Entries modified directly by a caller) is detected and rebuilt.
+func (i *Index) lookup(filePath string, stage int) int {
+	i.EnsureMap()
+	key := i.entryKey(filePath, stage)
+	j, ok := i.entryMap[key]
+	if ok && j < len(i.Entries) && i.entryKey(i.Entries[j].FilePath, i.Entries[j].Stage) == key {
+		return j
+	}
+	if len(i.entryMap)+i.duplicates == len(i.Entries) && !ok {
+		return -1
+	}
+	i.rebuildMap()
+	if j, ok := i.entryMap[key]; ok {
+		return j
+	}
+	return -1
+}
+
+// appendEntry appends an entry and records its position in the map.
+func (i *Index) appendEntry(entry IndexEntry) {
+	i.EnsureMap()
+	key := i.entryKey(entry.FilePath, entry.Stage)
+	if _, ok := i.entryMap[key]; ok {
+		i.duplicates++
+	}
+	i.Entries = append(i.Entries, entry)
+	i.entryMap[key] = len(i.Entries) - 1
+}
+
+// deleteAt removes the entry at position j and keeps the map consistent.
+// With duplicates another entry may share its key, so the map is rebuilt.
+func (i *Index) deleteAt(j int) {
+	if i.duplicates > 0 {
+		i.Entries = slices.Delete(i.Entries, j, j+1)
+		i.rebuildMap()
+		return
+	}
+	delete(i.entryMap, i.entryKey(i.Entries[j].FilePath, i.Entries[j].Stage))
+	i.Entries = slices.Delete(i.Entries, j, j+1)
+	i.reindexFrom(j)
+}
+
 // LoadIndex reads the index from disk or returns a new one if it doesn't exist using Repository context.
 func LoadIndex(repo *core.Repository) (*Index, error) {
 	indexPath := filepath.Join(repo.VecDir, "index")
@@ -84,40 +212,35 @@ func (i *Index) Add(repo *core.Repository, relPath, hash string) error {
 	}
 
 	// Check for existing entry
-	for j, entry := range i.Entries {
-		if entry.FilePath == relPath && entry.Stage == 0 {
-			// Update existing stage 0 entry
-			i.Entries[j].Mode = int32(100644)
-			i.Entries[j].SHA256 = hash
-			i.Entries[j].Size = fileInfo.Size()
-			i.Entries[j].Mtime = fileInfo.ModTime()
-			i.Entries[j].BaseSHA = ""
-			i.Entries[j].OurSHA = ""
-			i.Entries[j].TheirSHA = ""
-			return nil
-		}
+	if j := i.lookup(relPath, 0); j >= 0 {
+		// Update existing stage 0 entry
+		i.Entries[j].Mode = int32(100644)
+		i.Entries[j].SHA256 = hash
+		i.Entries[j].Size = fileInfo.Size()
+		i.Entries[j].Mtime = fileInfo.ModTime()
+		i.Entries[j].BaseSHA = ""
+		i.Entries[j].OurSHA = ""
+		i.Entries[j].TheirSHA = ""
+		return nil
 	}
 
 	// Add new stage 0 entry
 	newEntry := IndexEntry{
 		Mode:     int32(100644),
-		FilePath: relPath,
+		FilePath: core.NormalizePath(relPath, i.precompose),
 		SHA256:   hash,
 		Size:     fileInfo.Size(),
 		Mtime:    fileInfo.ModTime(),
 		Stage:    0,
 	}
-	i.Entries = append(i.Entries, newEntry)
+	i.appendEntry(newEntry)
 	return nil
 }
 
 // Remove removes a stage 0 entry from the index using Repository context.
 func (i *Index) Remove(repo *core.Repository, relPath string) error {
-	for j, entry := range i.Entries {
-		if entry.FilePath == relPath && entry.Stage == 0 {
-			i.Entries = slices.Delete(i.Entries, j, j+1)
-			return nil
-		}
+	if j := i.lookup(relPath, 0); j >= 0 {
+		i.deleteAt(j)
 	}
 	return nil // Idempotent: no error if not found
 }
@@ -133,7 +256,7 @@ func (i *Index) AddConflictEntry(relPath, hash string, mode int32, stage int) er
 		SHA256:   hash,
 		Stage:    stage,
 	}
-	i.Entries = append(i.Entries, entry)
+	i.appendEntry(entry)
 	return nil
 }
 
@@ -269,6 +392,8 @@ func (i *Index) Serialize() ([]byte, error) {
 		}
 		return i.Entries[a].Stage < i.Entries[b].Stage
 	})
+	// Sorting moves entries, so positions in the map must be refreshed
+	i.rebuildMap()
 
 	// Write the number of entries
 	numEntries := uint32(len(i.Entries))
@@ -414,6 +539,10 @@ func DeserializeIndex(repo *core.Repository, data []byte) (*Index, error) {
 		index.Entries = append(index.Entries, entry)
 	}
 
+	// Paths staged before core.precomposeUnicode was turned on are migrated
+	// as the index is read; the next write stores them in NFC
+	index.rebuildMap()
+	index.PrecomposePaths()
 	return index, nil
 }
 
@@ -564,48 +693,19 @@ func ensureParentDirectories(treeMap map[string][]objects.TreeEntry, path string
 	}
 }
 
-// sortTreeMapEntries sorts all entries in the tree map by name for consistent output.
-// This optimized version avoids unnecessary re-sorting of already sorted entries.
+// sortTreeMapEntries puts the entries of every directory in canonical tree order.
 func sortTreeMapEntries(treeMap map[string][]objects.TreeEntry) {
-	for dir, entries := range treeMap {
-		if len(entries) > 1 {
-			// Check if entries are already sorted to avoid unnecessary sort operations
-			needsSort := false
-			for i := 1; i < len(entries); i++ {
-				if entries[i-1].Name > entries[i].Name {
-					needsSort = true
-					break
-				}
-			}
-
-			if needsSort {
-				sort.Slice(entries, func(i, j int) bool {
-					return entries[i].Name < entries[j].Name
-				})
-				treeMap[dir] = entries
-			}
-		}
+	for _, entries := range treeMap {
+		objects.SortTreeEntries(entries)
 	}
 }
 
 // GetEntry returns the index entry for a given file path and stage.
 // If the entry doesn't exist, it returns nil and false.
-// This optimized version uses a map lookup when possible.
+// The returned pointer is only valid until the next mutation of the index.
 func (i *Index) GetEntry(filePath string, stage int) (*IndexEntry, bool) {
-	// First try to find the entry using the cached map if available
-	if i.entryMap != nil {
-		key := fmt.Sprintf("%s:%d", filePath, stage)
-		if entry, ok := i.entryMap[key]; ok {
-			return entry, true
-		}
-		return nil, false
-	}
-
-	// Fall back to linear search if no map is available
-	for j := range i.Entries {
-		if i.Entries[j].FilePath == filePath && i.Entries[j].Stage == stage {
-			return &i.Entries[j], true
-		}
+	if j := i.lookup(filePath, stage); j >= 0 {
+		return &i.Entries[j], true
 	}
 	return nil, false
 }
@@ -637,40 +737,23 @@ func (i *Index) GetConflicts() map[string]bool {
 // AddEntry adds or updates an entry in the index
 // This is a new function for more advanced index manipulation
 func (i *Index) AddEntry(entry IndexEntry) {
-	// Check if the entry already exists (same path and stage)
-	for j := range i.Entries {
-		if i.Entries[j].FilePath == entry.FilePath && i.Entries[j].Stage == entry.Stage {
-			// Update the existing entry
-			i.Entries[j] = entry
-
-			// Clear the entry map so it will be rebuilt on next access
-			i.entryMap = nil
-			return
-		}
+	entry.FilePath = core.NormalizePath(entry.FilePath, i.precompose)
+	// Update in place if the entry already exists (same path and stage)
+	if j := i.lookup(entry.FilePath, entry.Stage); j >= 0 {
+		i.Entries[j] = entry
+		return
 	}
 
 	// Add as a new entry
-	i.Entries = append(i.Entries, entry)
-
-	// Update the entry map if it exists
-	if i.entryMap != nil {
-		key := fmt.Sprintf("%s:%d", entry.FilePath, entry.Stage)
-		i.entryMap[key] = &i.Entries[len(i.Entries)-1]
-	}
+	i.appendEntry(entry)
 }
 
 // RemoveEntry removes an entry from the index by path and stage
 // This is a new function for more advanced index manipulation
 func (i *Index) RemoveEntry(filePath string, stage int) bool {
-	for j := range i.Entries {
-		if i.Entries[j].FilePath == filePath && i.Entries[j].Stage == stage {
-			// Remove the entry
-			i.Entries = append(i.Entries[:j], i.Entries[j+1:]...)
-
-			// Clear the entry map so it will be rebuilt on next access
-			i.entryMap = nil
-			return true
-		}
+	if j := i.lookup(filePath, stage); j >= 0 {
+		i.deleteAt(j)
+		return true
 	}
 	return false
 }
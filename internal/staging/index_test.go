@@ -0,0 +1,126 @@
+package staging
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/NahomAnteneh/vec/core"
+)
+
+// benchmarkFiles is the size of the working trees the benchmarks model
+const benchmarkFiles = 100000
+
+const (
+	testHash  = "1111111111111111111111111111111111111111111111111111111111111111"
+	otherHash = "2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+func testIndex(tb testing.TB, files int) *Index {
+	tb.Helper()
+	index := NewIndex(core.NewRepository(tb.TempDir()))
+	for n := 0; n < files; n++ {
+		index.AddEntry(IndexEntry{Mode: 100644, FilePath: testPath(n), SHA256: testHash})
+	}
+	return index
+}
+
+func testPath(n int) string {
+	return fmt.Sprintf("dir%03d/file%06d.txt", n%1000, n)
+}
+
+func TestLookupWithDuplicateConflictEntries(t *testing.T) {
+	index := testIndex(t, 10)
+	index.RemoveEntry(testPath(3), 0)
+	index.AddConflictEntry(testPath(3), testHash, 100644, 2)
+	index.AddConflictEntry(testPath(3), otherHash, 100644, 2) // Kept as is, a duplicate
+	index.AddConflictEntry(testPath(3), otherHash, 100644, 3)
+
+	if index.duplicates != 1 {
+		t.Fatalf("duplicates is %d, want 1", index.duplicates)
+	}
+	if _, ok := index.GetEntry(testPath(3), 0); ok {
+		t.Fatal("found the removed stage 0 entry")
+	}
+	if _, ok := index.GetEntry("missing.txt", 0); ok {
+		t.Fatal("found an entry that was never added")
+	}
+	for n := 0; n < 10; n++ {
+		if n == 3 {
+			continue
+		}
+		if entry, ok := index.GetEntry(testPath(n), 0); !ok || entry.FilePath != testPath(n) {
+			t.Fatalf("lost the entry of %s", testPath(n))
+		}
+	}
+	if entry, ok := index.GetEntry(testPath(3), 3); !ok || entry.SHA256 != otherHash {
+		t.Fatalf("stage 3 entry is %v, %v", entry, ok)
+	}
+
+	// Removing one duplicate leaves the other findable
+	if !index.RemoveEntry(testPath(3), 2) {
+		t.Fatal("failed to remove a stage 2 entry")
+	}
+	if _, ok := index.GetEntry(testPath(3), 2); !ok {
+		t.Fatal("removing one stage 2 entry lost the other")
+	}
+	if index.duplicates != 0 {
+		t.Fatalf("duplicates is %d after the removal, want 0", index.duplicates)
+	}
+}
+
+func TestLookupAfterDirectChange(t *testing.T) {
+	index := testIndex(t, 10)
+	index.Entries = append(index.Entries, IndexEntry{Mode: 100644, FilePath: "added.txt", SHA256: testHash})
+	if _, ok := index.GetEntry("added.txt", 0); !ok {
+		t.Fatal("entry appended to Entries directly was not found")
+	}
+}
+
+// BenchmarkConflictedMerge records conflicts for a tenth of a 100k-file
+// index the way a merge does, with one path conflicting twice, then looks
+// up every path at every stage as status does
+func BenchmarkConflictedMerge(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		index := testIndex(b, benchmarkFiles)
+		b.StartTimer()
+
+		for f := 0; f < benchmarkFiles; f += 10 {
+			path := testPath(f)
+			index.RemoveEntry(path, 0)
+			for stage := 1; stage <= 3; stage++ {
+				index.AddConflictEntry(path, testHash, 100644, stage)
+			}
+		}
+		index.AddConflictEntry(testPath(0), otherHash, 100644, 2)
+		for f := 0; f < benchmarkFiles; f++ {
+			for stage := 0; stage <= 3; stage++ {
+				index.GetEntry(testPath(f), stage)
+			}
+		}
+	}
+}
+
+// BenchmarkConflictedStatus looks up every path of a 100k-file index with
+// duplicate conflict entries at every stage, as status does
+func BenchmarkConflictedStatus(b *testing.B) {
+	index := testIndex(b, benchmarkFiles)
+	for f := 0; f < benchmarkFiles; f += 10 {
+		index.RemoveEntry(testPath(f), 0)
+		index.AddConflictEntry(testPath(f), testHash, 100644, 2)
+		index.AddConflictEntry(testPath(f), otherHash, 100644, 2)
+	}
+	paths := make([]string, benchmarkFiles)
+	for f := range paths {
+		paths[f] = testPath(f)
+	}
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		for _, path := range paths {
+			for stage := 0; stage <= 3; stage++ {
+				index.GetEntry(path, stage)
+			}
+		}
+	}
+}
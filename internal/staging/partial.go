@@ -0,0 +1,98 @@
+package staging
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+)
+
+// MatchesPathspec reports whether filePath is selected by one of pathspecs:
+// the path itself, a directory containing it, or a glob matching it
+func MatchesPathspec(filePath string, pathspecs []string) bool {
+	filePath = filepath.ToSlash(filePath)
+	for _, spec := range pathspecs {
+		spec = strings.TrimSuffix(filepath.ToSlash(filepath.Clean(spec)), "/")
+		if spec == "." || filePath == spec || strings.HasPrefix(filePath, spec+"/") {
+			return true
+		}
+		if matched, _ := path.Match(spec, filePath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// IndexFromTreeRepo builds an index holding the files of treeID at stage 0.
+// An empty treeID, as for the parent of a root commit, gives an empty index.
+func IndexFromTreeRepo(repo *core.Repository, treeID string) (*Index, error) {
+	index := NewIndex(repo)
+	if treeID == "" {
+		return index, nil
+	}
+	if err := addTreeEntriesRepo(repo, index, treeID, ""); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// addTreeEntriesRepo adds the files below treeID to index, prefixed by basePath
+func addTreeEntriesRepo(repo *core.Repository, index *Index, treeID, basePath string) error {
+	tree, err := objects.GetTreeRepo(repo, treeID)
+	if err != nil {
+		return fmt.Errorf("failed to get tree '%s': %w", treeID, err)
+	}
+	for _, entry := range tree.Entries {
+		currentPath := filepath.Join(basePath, entry.Name)
+		if entry.Type == "tree" {
+			if err := addTreeEntriesRepo(repo, index, entry.Hash, currentPath); err != nil {
+				return err
+			}
+			continue
+		}
+		index.appendEntry(IndexEntry{
+			Mode:     entry.Mode,
+			FilePath: currentPath,
+			SHA256:   entry.Hash,
+			Stage:    0,
+		})
+	}
+	return nil
+}
+
+// PartialCommitIndex returns the index to commit when only the paths matching
+// pathspecs are committed: the entries of headTreeID, with every matching
+// path taken from i instead (or dropped if i no longer has it). Other staged
+// changes stay in i for a later commit. The result is not written to disk.
+func (i *Index) PartialCommitIndex(repo *core.Repository, headTreeID string, pathspecs []string) (*Index, error) {
+	partial, err := IndexFromTreeRepo(repo, headTreeID)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := false
+	for j := len(partial.Entries) - 1; j >= 0; j-- {
+		if MatchesPathspec(partial.Entries[j].FilePath, pathspecs) {
+			matched = true
+			partial.deleteAt(j)
+		}
+	}
+	for _, entry := range i.Entries {
+		if !MatchesPathspec(entry.FilePath, pathspecs) {
+			continue
+		}
+		if entry.Stage != 0 {
+			return nil, core.IndexError(fmt.Sprintf("cannot commit '%s': it has unresolved conflicts", entry.FilePath), nil)
+		}
+		matched = true
+		partial.appendEntry(entry)
+	}
+	if !matched {
+		return nil, core.IndexError(fmt.Sprintf("pathspec '%s' did not match any file(s) known to vec",
+			strings.Join(pathspecs, " ")), nil)
+	}
+	return partial, nil
+}
@@ -0,0 +1,209 @@
+package stash
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/merge"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/staging"
+	"github.com/NahomAnteneh/vec/utils"
+)
+
+// ApplyResult reports the paths an apply touched
+type ApplyResult struct {
+	Updated   []string // Paths changed as stashed
+	Conflicts []string // Paths changed both in the stash and since; left with conflict markers when text
+}
+
+// TreesRepo returns the trees of the HEAD a stash entry was made on, of its
+// index and of its working tree
+func TreesRepo(repo *core.Repository, commit string) (base, index, worktree string, err error) {
+	stashCommit, err := objects.GetCommitRepo(repo, commit)
+	if err != nil {
+		return "", "", "", core.ObjectError("failed to load stash commit", err)
+	}
+	if len(stashCommit.Parents) < 2 {
+		return "", "", "", core.ObjectError(fmt.Sprintf("%s is not a stash commit", commit), nil)
+	}
+	baseCommit, err := objects.GetCommitRepo(repo, stashCommit.Parents[0])
+	if err != nil {
+		return "", "", "", core.ObjectError("failed to load stash base commit", err)
+	}
+	indexCommit, err := objects.GetCommitRepo(repo, stashCommit.Parents[1])
+	if err != nil {
+		return "", "", "", core.ObjectError("failed to load stash index commit", err)
+	}
+	return baseCommit.Tree, indexCommit.Tree, stashCommit.Tree, nil
+}
+
+// FilesRepo returns the files of treeID by path
+func FilesRepo(repo *core.Repository, treeID string) (map[string]staging.IndexEntry, error) {
+	index, err := staging.IndexFromTreeRepo(repo, treeID)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]staging.IndexEntry, len(index.Entries))
+	for _, entry := range index.Entries {
+		files[entry.FilePath] = entry
+	}
+	return files, nil
+}
+
+// ApplyRepo replays the changes of a stash entry on the working tree. A
+// file changed since the stash is merged with the stashed change; files
+// the stash added are staged. With restoreIndex the staged changes of the
+// stash are staged again too.
+func ApplyRepo(repo *core.Repository, entry Entry, restoreIndex bool) (*ApplyResult, error) {
+	baseTree, indexTree, worktreeTree, err := TreesRepo(repo, entry.Commit)
+	if err != nil {
+		return nil, err
+	}
+	base, err := FilesRepo(repo, baseTree)
+	if err != nil {
+		return nil, err
+	}
+	stashed, err := FilesRepo(repo, worktreeTree)
+	if err != nil {
+		return nil, err
+	}
+	staged, err := FilesRepo(repo, indexTree)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := staging.LoadIndex(repo)
+	if err != nil {
+		return nil, core.IndexError("failed to load index", err)
+	}
+	if index.HasConflicts() {
+		return nil, core.IndexError("cannot apply a stash: you have unresolved conflicts", nil)
+	}
+	perms, err := repo.Permissions()
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]bool)
+	for p := range base {
+		paths[p] = true
+	}
+	for p := range stashed {
+		paths[p] = true
+	}
+	for p := range staged {
+		paths[p] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	result := &ApplyResult{}
+	for _, relPath := range sorted {
+		baseEntry, inBase := base[relPath]
+		stashEntry, inStash := stashed[relPath]
+		if inBase == inStash && baseEntry.SHA256 == stashEntry.SHA256 {
+			continue
+		}
+
+		absPath := filepath.Join(repo.Root, relPath)
+		current, err := os.ReadFile(absPath)
+		exists := err == nil
+		if err != nil && !os.IsNotExist(err) {
+			return nil, core.FSError(fmt.Sprintf("failed to read '%s'", relPath), err)
+		}
+		currentHash := ""
+		if exists {
+			currentHash = utils.HashBytes("blob", current)
+		}
+
+		switch {
+		case exists == inStash && currentHash == stashEntry.SHA256:
+			// Already as stashed
+		case exists == inBase && currentHash == baseEntry.SHA256:
+			// Unchanged since the stash: take the stashed version
+			if !inStash {
+				if err := os.Remove(absPath); err != nil {
+					return nil, core.FSError(fmt.Sprintf("failed to remove '%s'", relPath), err)
+				}
+				index.RemoveEntry(relPath, 0)
+			} else {
+				if err := perms.MkdirAll(filepath.Dir(absPath)); err != nil {
+					return nil, err
+				}
+				if err := objects.WriteBlobFileRepo(repo, stashEntry.SHA256, absPath, stashEntry.Mode == objects.ModeExecutable); err != nil {
+					return nil, core.FSError(fmt.Sprintf("failed to write '%s'", relPath), err)
+				}
+				if !inBase {
+					if err := index.Add(repo, relPath, stashEntry.SHA256); err != nil {
+						return nil, core.IndexError(fmt.Sprintf("failed to stage '%s'", relPath), err)
+					}
+				}
+			}
+			result.Updated = append(result.Updated, relPath)
+		case exists && inBase && inStash:
+			merged, clean, err := mergeStashedRepo(repo, baseEntry.SHA256, current, stashEntry.SHA256)
+			if err != nil {
+				return nil, err
+			}
+			if merged != nil {
+				if err := perms.WriteFile(absPath, merged); err != nil {
+					return nil, core.FSError(fmt.Sprintf("failed to write '%s'", relPath), err)
+				}
+			}
+			if clean {
+				result.Updated = append(result.Updated, relPath)
+			} else {
+				result.Conflicts = append(result.Conflicts, relPath)
+			}
+		default:
+			result.Conflicts = append(result.Conflicts, relPath)
+		}
+	}
+
+	if restoreIndex && len(result.Conflicts) == 0 {
+		for _, relPath := range sorted {
+			baseEntry, inBase := base[relPath]
+			stagedEntry, inStaged := staged[relPath]
+			if inBase == inStaged && baseEntry.SHA256 == stagedEntry.SHA256 {
+				continue
+			}
+			if inStaged {
+				index.AddEntry(stagedEntry)
+			} else {
+				index.RemoveEntry(relPath, 0)
+			}
+		}
+	}
+	if err := index.Write(); err != nil {
+		return nil, core.IndexError("failed to write index", err)
+	}
+	return result, nil
+}
+
+// mergeStashedRepo merges the stashed version of a file with its content in
+// the working tree against the version the stash was made on. Binary files
+// are not merged: nil content and a conflict.
+func mergeStashedRepo(repo *core.Repository, baseHash string, current []byte, stashHash string) ([]byte, bool, error) {
+	baseContent, err := objects.GetBlobRepo(repo, baseHash)
+	if err != nil {
+		return nil, false, core.ObjectError("failed to read stash base", err)
+	}
+	stashContent, err := objects.GetBlobRepo(repo, stashHash)
+	if err != nil {
+		return nil, false, core.ObjectError("failed to read stashed file", err)
+	}
+	for _, content := range [][]byte{baseContent, current, stashContent} {
+		if bytes.IndexByte(content, 0) >= 0 {
+			return nil, false, nil
+		}
+	}
+	merged, conflicts := merge.MergeText(string(baseContent), string(current), string(stashContent))
+	return []byte(merged), !conflicts, nil
+}
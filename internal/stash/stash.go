@@ -0,0 +1,245 @@
+// Package stash shelves uncommitted changes as commits under refs/stash.
+//
+// A stash entry is a commit of the working tree whose first parent is the
+// HEAD it was made on and whose second parent is a commit of the index on
+// the same HEAD. refs/stash points to the newest entry and its reflog lists
+// all of them, stash@{0} being the newest.
+package stash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/staging"
+	"github.com/NahomAnteneh/vec/utils"
+)
+
+// Ref holds the newest stash entry
+const Ref = "refs/stash"
+
+// Entry is one stash entry
+type Entry struct {
+	Index   int    // n of stash@{n}
+	Commit  string // Commit of the stashed working tree
+	Message string
+}
+
+// Name returns the stash@{n} name of the entry
+func (e Entry) Name() string {
+	return fmt.Sprintf("stash@{%d}", e.Index)
+}
+
+// PushOptions controls what PushRepo stashes
+type PushOptions struct {
+	// Message replaces the "WIP on <branch>" description
+	Message string
+
+	// Worktree, when set, is the content to stash for the paths it holds,
+	// nil meaning deleted; every other path is stashed as in HEAD. stash -p
+	// uses it to stash only the selected hunks.
+	Worktree map[string][]byte
+}
+
+// ListRepo returns the stash entries, newest first
+func ListRepo(repo *core.Repository) ([]Entry, error) {
+	reflog, err := core.ReadReflog(repo.Root, Ref)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(reflog))
+	for i := len(reflog) - 1; i >= 0; i-- {
+		entries = append(entries, Entry{Index: len(entries), Commit: reflog[i].New, Message: reflog[i].Message})
+	}
+	return entries, nil
+}
+
+// ResolveRepo returns the entry name refers to: stash@{n}, n, or the newest
+// entry when name is empty
+func ResolveRepo(repo *core.Repository, name string) (Entry, error) {
+	entries, err := ListRepo(repo)
+	if err != nil {
+		return Entry{}, err
+	}
+	if len(entries) == 0 {
+		return Entry{}, core.RefError("no stash entries found", nil)
+	}
+	if name == "" {
+		return entries[0], nil
+	}
+	spec := strings.TrimSuffix(strings.TrimPrefix(name, "stash@{"), "}")
+	n, err := strconv.Atoi(spec)
+	if err != nil || n < 0 {
+		return Entry{}, core.RefError(fmt.Sprintf("'%s' is not a stash reference", name), nil)
+	}
+	if n >= len(entries) {
+		return Entry{}, core.RefError(fmt.Sprintf("%s does not exist: there are only %d stash entries", name, len(entries)), nil)
+	}
+	return entries[n], nil
+}
+
+// DropRepo removes entry from the stash, moving refs/stash to the next
+// newest entry or removing it with the last one
+func DropRepo(repo *core.Repository, entry Entry) error {
+	reflog, err := core.ReadReflog(repo.Root, Ref)
+	if err != nil {
+		return err
+	}
+	pos := len(reflog) - 1 - entry.Index
+	if pos < 0 || pos >= len(reflog) || reflog[pos].New != entry.Commit {
+		return core.RefError(fmt.Sprintf("%s changed since it was read", entry.Name()), nil)
+	}
+	reflog = append(reflog[:pos], reflog[pos+1:]...)
+
+	current, err := repo.ReadRefValue(Ref)
+	if err != nil {
+		return err
+	}
+	next := ""
+	if len(reflog) > 0 {
+		next = reflog[len(reflog)-1].New
+	}
+	if next != current {
+		if err := repo.UpdateRefCAS(Ref, current, next); err != nil {
+			return core.RefError("failed to update "+Ref, err)
+		}
+	}
+	return core.WriteReflog(repo.Root, Ref, reflog)
+}
+
+// PushRepo records the index and working tree of the tracked files as a new
+// stash entry and returns its commit, or "" when there is nothing to stash.
+// The working tree and index are left as they are.
+func PushRepo(repo *core.Repository, options PushOptions) (string, error) {
+	head, err := repo.ReadHead()
+	if err != nil {
+		return "", core.RefError("failed to read HEAD", err)
+	}
+	if head == "" {
+		return "", core.RepositoryError("cannot stash before the first commit", nil)
+	}
+	headCommit, err := objects.GetCommitRepo(repo, head)
+	if err != nil {
+		return "", core.ObjectError("failed to load HEAD commit", err)
+	}
+	index, err := staging.LoadIndex(repo)
+	if err != nil {
+		return "", core.IndexError("failed to load index", err)
+	}
+	if index.HasConflicts() {
+		return "", core.IndexError("cannot stash: you have unresolved conflicts", nil)
+	}
+
+	indexTree, err := staging.CreateTreeFromIndex(repo, index)
+	if err != nil {
+		return "", core.ObjectError("failed to write index tree", err)
+	}
+	var worktree *staging.Index
+	if options.Worktree != nil {
+		worktree, err = overrideTreeRepo(repo, headCommit.Tree, options.Worktree)
+	} else {
+		worktree, err = worktreeIndexRepo(repo, index)
+	}
+	if err != nil {
+		return "", err
+	}
+	worktreeTree, err := staging.CreateTreeFromIndex(repo, worktree)
+	if err != nil {
+		return "", core.ObjectError("failed to write working tree", err)
+	}
+	if worktreeTree == headCommit.Tree && (indexTree == headCommit.Tree || options.Worktree != nil) {
+		return "", nil
+	}
+
+	branch, err := repo.GetCurrentBranch()
+	if err != nil || branch == "(HEAD detached)" {
+		branch = "(no branch)"
+	}
+	description := fmt.Sprintf("%s: %s %s", branch, head[:7], headCommit.Subject())
+	message := "WIP on " + description
+	if options.Message != "" {
+		message = fmt.Sprintf("On %s: %s", branch, options.Message)
+	}
+
+	authorName, authorEmail, err := core.ResolveIdentity(repo.Root, core.IdentityAuthor)
+	if err != nil {
+		return "", err
+	}
+	committerName, committerEmail, err := core.ResolveIdentity(repo.Root, core.IdentityCommitter)
+	if err != nil {
+		return "", err
+	}
+	author := fmt.Sprintf("%s <%s>", authorName.Value, authorEmail.Value)
+	committer := fmt.Sprintf("%s <%s>", committerName.Value, committerEmail.Value)
+
+	indexCommit, err := objects.CreateCommitRepo(repo, indexTree, []string{head}, author, committer, "index on "+description, 0)
+	if err != nil {
+		return "", core.ObjectError("failed to record index", err)
+	}
+	stashCommit, err := objects.CreateCommitRepo(repo, worktreeTree, []string{head, indexCommit}, author, committer, message, 0)
+	if err != nil {
+		return "", core.ObjectError("failed to record working tree", err)
+	}
+
+	previous, err := repo.ReadRefValue(Ref)
+	if err != nil {
+		return "", err
+	}
+	if err := repo.UpdateRefCAS(Ref, previous, stashCommit); err != nil {
+		return "", core.RefError("failed to update "+Ref, err)
+	}
+	if err := core.AppendRefReflog(repo.Root, Ref, previous, stashCommit, message); err != nil {
+		return "", err
+	}
+	return stashCommit, nil
+}
+
+// worktreeIndexRepo returns the index with each tracked file as it is in
+// the working tree, storing the blobs of modified files
+func worktreeIndexRepo(repo *core.Repository, index *staging.Index) (*staging.Index, error) {
+	worktree := staging.NewIndex(repo)
+	for _, entry := range index.Entries {
+		content, err := os.ReadFile(filepath.Join(repo.Root, entry.FilePath))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, core.FSError(fmt.Sprintf("failed to read '%s'", entry.FilePath), err)
+		}
+		if hash := utils.HashBytes("blob", content); hash != entry.SHA256 {
+			if entry.SHA256, err = objects.CreateBlobRepo(repo, content); err != nil {
+				return nil, core.ObjectError(fmt.Sprintf("failed to store '%s'", entry.FilePath), err)
+			}
+		}
+		worktree.AddEntry(entry)
+	}
+	return worktree, nil
+}
+
+// overrideTreeRepo returns the files of treeID with the paths of files
+// replaced by their content, or removed where it is nil
+func overrideTreeRepo(repo *core.Repository, treeID string, files map[string][]byte) (*staging.Index, error) {
+	index, err := staging.IndexFromTreeRepo(repo, treeID)
+	if err != nil {
+		return nil, err
+	}
+	for relPath, content := range files {
+		if content == nil {
+			index.RemoveEntry(relPath, 0)
+			continue
+		}
+		hash, err := objects.CreateBlobRepo(repo, content)
+		if err != nil {
+			return nil, core.ObjectError(fmt.Sprintf("failed to store '%s'", relPath), err)
+		}
+		entry := staging.IndexEntry{Mode: objects.ModeFile, FilePath: relPath, SHA256: hash}
+		if existing, ok := index.GetEntry(relPath, 0); ok {
+			entry.Mode = existing.Mode
+		}
+		index.AddEntry(entry)
+	}
+	return index, nil
+}
@@ -0,0 +1,220 @@
+// Package vectest creates throwaway vec repositories for tests: initialized
+// repositories with an identity, commits of given files, branches, and a vec
+// server on a local port to push to and fetch from. Commits get fixed,
+// increasing dates, so a test that makes the same commits in the same order
+// always gets the same hashes.
+package vectest
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/remote"
+	"github.com/NahomAnteneh/vec/internal/repository"
+	"github.com/NahomAnteneh/vec/internal/server"
+	"github.com/NahomAnteneh/vec/internal/staging"
+)
+
+// Identity of the author and committer of fixture commits
+const (
+	UserName  = "Vec Test"
+	UserEmail = "test@example.com"
+)
+
+// Epoch is the date of the first fixture commit; each later one is a minute on
+var Epoch = time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+var (
+	clockMu sync.Mutex
+	clock   = make(map[string]time.Time) // Date of the last commit, per repository
+)
+
+// InitTempRepo initializes a repository in a temporary directory removed
+// when the test ends, with user.name and user.email set
+func InitTempRepo(t testing.TB) *core.Repository {
+	t.Helper()
+	repo := core.NewRepository(t.TempDir())
+	if err := repository.CreateRepo(repo); err != nil {
+		t.Fatalf("vectest: failed to initialize repository: %v", err)
+	}
+	for key, value := range map[string]string{"user.name": UserName, "user.email": UserEmail} {
+		if err := core.SetConfigValue(repo.Root, key, value, false); err != nil {
+			t.Fatalf("vectest: failed to set %s: %v", key, err)
+		}
+	}
+	return repo
+}
+
+// WriteFile writes content to path, relative to the repository root and
+// slash separated, creating its directories
+func WriteFile(t testing.TB, repo *core.Repository, path, content string) {
+	t.Helper()
+	absPath := filepath.Join(repo.Root, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+		t.Fatalf("vectest: failed to create directory for %s: %v", path, err)
+	}
+	if err := os.WriteFile(absPath, []byte(content), 0644); err != nil {
+		t.Fatalf("vectest: failed to write %s: %v", path, err)
+	}
+}
+
+// Stage writes content to path and adds it to the index
+func Stage(t testing.TB, repo *core.Repository, path, content string) {
+	t.Helper()
+	WriteFile(t, repo, path, content)
+	hash, err := objects.CreateBlobRepo(repo, []byte(content))
+	if err != nil {
+		t.Fatalf("vectest: failed to store %s: %v", path, err)
+	}
+	index, err := staging.LoadIndex(repo)
+	if err != nil {
+		t.Fatalf("vectest: failed to load index: %v", err)
+	}
+	if err := index.Add(repo, filepath.FromSlash(path), hash); err != nil {
+		t.Fatalf("vectest: failed to stage %s: %v", path, err)
+	}
+	if err := index.Write(); err != nil {
+		t.Fatalf("vectest: failed to write index: %v", err)
+	}
+}
+
+// CommitFile writes content to path, stages it and commits it on the
+// current branch, returning the commit hash
+func CommitFile(t testing.TB, repo *core.Repository, path, content, message string) string {
+	t.Helper()
+	Stage(t, repo, path, content)
+	return Commit(t, repo, message)
+}
+
+// Commit commits the index on the current branch, or on HEAD when it is
+// detached, and returns the commit hash
+func Commit(t testing.TB, repo *core.Repository, message string) string {
+	t.Helper()
+	index, err := staging.LoadIndex(repo)
+	if err != nil {
+		t.Fatalf("vectest: failed to load index: %v", err)
+	}
+	tree, err := staging.CreateTreeFromIndex(repo, index)
+	if err != nil {
+		t.Fatalf("vectest: failed to write tree: %v", err)
+	}
+	parent, err := repo.ReadHead()
+	if err != nil {
+		t.Fatalf("vectest: failed to read HEAD: %v", err)
+	}
+	var parents []string
+	if parent != "" {
+		parents = append(parents, parent)
+	}
+
+	identity := UserName + " <" + UserEmail + ">"
+	when := nextCommitDate(repo)
+	hash, err := objects.CreateCommitWithDatesRepo(repo, tree, parents, identity, identity, message, when, when)
+	if err != nil {
+		t.Fatalf("vectest: failed to create commit: %v", err)
+	}
+
+	branch, err := repo.GetCurrentBranch()
+	if err != nil {
+		t.Fatalf("vectest: failed to read HEAD: %v", err)
+	}
+	if branch == "(HEAD detached)" {
+		err = repo.UpdateHead(hash, false)
+	} else if err = repo.WriteRef("refs/heads/"+branch, hash); err == nil {
+		err = repo.AppendReflog(branch, parent, hash, "commit: "+message)
+	}
+	if err != nil {
+		t.Fatalf("vectest: failed to move HEAD to the new commit: %v", err)
+	}
+	return hash
+}
+
+// nextCommitDate returns the date of the next commit in repo
+func nextCommitDate(repo *core.Repository) time.Time {
+	clockMu.Lock()
+	defer clockMu.Unlock()
+	last, ok := clock[repo.Root]
+	next := Epoch
+	if ok {
+		next = last.Add(time.Minute)
+	}
+	clock[repo.Root] = next
+	return next
+}
+
+// CreateBranch creates a branch at HEAD without switching to it
+func CreateBranch(t testing.TB, repo *core.Repository, name string) {
+	t.Helper()
+	head, err := repo.ReadHead()
+	if err != nil || head == "" {
+		t.Fatalf("vectest: cannot create branch %s without a commit: %v", name, err)
+	}
+	if core.FileExists(filepath.Join(repo.VecDir, "refs", "heads", filepath.FromSlash(name))) {
+		t.Fatalf("vectest: branch %s already exists", name)
+	}
+	if err := repo.WriteRef("refs/heads/"+name, head); err != nil {
+		t.Fatalf("vectest: failed to create branch %s: %v", name, err)
+	}
+}
+
+// SwitchBranch points HEAD at an existing branch. The working tree and
+// index are left alone, which suits tests that only look at history.
+func SwitchBranch(t testing.TB, repo *core.Repository, name string) {
+	t.Helper()
+	if !core.FileExists(filepath.Join(repo.VecDir, "refs", "heads", filepath.FromSlash(name))) {
+		t.Fatalf("vectest: branch %s does not exist", name)
+	}
+	if err := repo.UpdateHead("refs/heads/"+name, true); err != nil {
+		t.Fatalf("vectest: failed to switch to %s: %v", name, err)
+	}
+}
+
+// HTTPServer is a vec server on a local port serving the repositories below
+// ReposDir, as vec serve does
+type HTTPServer struct {
+	URL      string // Base URL; a repository is served below it by name
+	ReposDir string
+	server   *server.Server
+}
+
+// ServeHTTP starts a vec server for the test, stopped when it ends
+func ServeHTTP(t testing.TB) *HTTPServer {
+	t.Helper()
+	reposDir := t.TempDir()
+	srv := server.NewServer()
+	srv.Configure(server.ServerOptions{ReposDir: reposDir, PackCacheSize: -1})
+	if err := srv.Init(); err != nil {
+		t.Fatalf("vectest: failed to start server: %v", err)
+	}
+	httpServer := httptest.NewServer(srv.Handler())
+	t.Cleanup(httpServer.Close)
+	return &HTTPServer{URL: httpServer.URL, ReposDir: reposDir, server: srv}
+}
+
+// CreateRepo creates a bare repository on the server and returns its URL
+func (s *HTTPServer) CreateRepo(t testing.TB, name string) string {
+	t.Helper()
+	if err := s.server.CreateRepo(name, true); err != nil {
+		t.Fatalf("vectest: failed to create server repository %s: %v", name, err)
+	}
+	return s.RepoURL(name)
+}
+
+// RepoURL returns the URL the repository name is served at
+func (s *HTTPServer) RepoURL(name string) string {
+	return s.URL + "/" + name
+}
+
+// AddRemote configures a remote of repo
+func AddRemote(t testing.TB, repo *core.Repository, name, url string) {
+	t.Helper()
+	if err := remote.AddRemote(repo.Root, name, url); err != nil {
+		t.Fatalf("vectest: failed to add remote %s: %v", name, err)
+	}
+}
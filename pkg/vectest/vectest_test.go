@@ -0,0 +1,94 @@
+package vectest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/NahomAnteneh/vec/core"
+	"github.com/NahomAnteneh/vec/internal/objects"
+	"github.com/NahomAnteneh/vec/internal/remote"
+)
+
+func TestCommitFile(t *testing.T) {
+	repo := InitTempRepo(t)
+	first := CommitFile(t, repo, "a.txt", "one\n", "first")
+	second := CommitFile(t, repo, "dir/b.txt", "two\n", "second")
+
+	head, err := repo.ReadHead()
+	if err != nil {
+		t.Fatalf("ReadHead: %v", err)
+	}
+	if head != second {
+		t.Fatalf("HEAD is %s, want %s", head, second)
+	}
+	commit, err := objects.GetCommitRepo(repo, second)
+	if err != nil {
+		t.Fatalf("GetCommitRepo: %v", err)
+	}
+	if len(commit.Parents) != 1 || commit.Parents[0] != first {
+		t.Fatalf("parents of the second commit are %v, want [%s]", commit.Parents, first)
+	}
+	if commit.Message != "second" {
+		t.Fatalf("message is %q, want %q", commit.Message, "second")
+	}
+
+	// The same commits in another repository get the same hashes
+	other := InitTempRepo(t)
+	if hash := CommitFile(t, other, "a.txt", "one\n", "first"); hash != first {
+		t.Fatalf("first commit is %s in another repository, want %s", hash, first)
+	}
+	if hash := CommitFile(t, other, "dir/b.txt", "two\n", "second"); hash != second {
+		t.Fatalf("second commit is %s in another repository, want %s", hash, second)
+	}
+}
+
+func TestCreateBranch(t *testing.T) {
+	repo := InitTempRepo(t)
+	base := CommitFile(t, repo, "a.txt", "one\n", "first")
+	CreateBranch(t, repo, "topic")
+	SwitchBranch(t, repo, "topic")
+
+	branch, err := repo.GetCurrentBranch()
+	if err != nil {
+		t.Fatalf("GetCurrentBranch: %v", err)
+	}
+	if branch != "topic" {
+		t.Fatalf("current branch is %s, want topic", branch)
+	}
+	tip := CommitFile(t, repo, "a.txt", "two\n", "on topic")
+	if tip == base {
+		t.Fatal("commit on topic did not create a new commit")
+	}
+	hash, err := repo.ReadRefValue("refs/heads/topic")
+	if err != nil || hash != tip {
+		t.Fatalf("topic is at %s (%v), want %s", hash, err, tip)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	srv := ServeHTTP(t)
+	url := srv.CreateRepo(t, "project")
+
+	repo := InitTempRepo(t)
+	head := CommitFile(t, repo, "README", "hello\n", "initial")
+	branch, err := repo.GetCurrentBranch()
+	if err != nil {
+		t.Fatalf("GetCurrentBranch: %v", err)
+	}
+	AddRemote(t, repo, "origin", url)
+	if err := remote.PushRepo(repo, "origin", branch, remote.PushOptions{}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "clone")
+	if err := remote.Clone(url, dest, ""); err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+	cloned, err := core.NewRepository(dest).ReadHead()
+	if err != nil {
+		t.Fatalf("ReadHead of clone: %v", err)
+	}
+	if cloned != head {
+		t.Fatalf("clone HEAD is %s, want %s", cloned, head)
+	}
+}
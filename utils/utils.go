@@ -10,7 +10,8 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
-	"sync"
+
+	"github.com/NahomAnteneh/vec/core"
 )
 
 // Common constants
@@ -19,12 +20,6 @@ const (
 	HeadFile   = "HEAD"
 )
 
-// Global cache for ignore patterns to avoid reloading and reparsing .vecignore
-var (
-	ignorePatternCache      = make(map[string][]string)
-	ignorePatternCacheMutex sync.RWMutex
-)
-
 // FileExists checks if a file exists.
 func FileExists(path string) bool {
 	_, err := os.Stat(path)
@@ -147,103 +142,10 @@ func IsValidHex(s string) bool {
 	return true
 }
 
-// IsIgnored checks if a given path should be ignored by Vec.
+// IsIgnored checks if a given path should be ignored by Vec, using every
+// ignore source of core.MatchIgnoreRule.
 func IsIgnored(repoRoot, path string) (bool, error) {
-	// First ensure we're working with absolute paths
-	absPath, err := filepath.Abs(path)
-	if err != nil {
-		return false, fmt.Errorf("failed to get absolute path: %w", err)
-	}
-
-	absRepoRoot, err := filepath.Abs(repoRoot)
-	if err != nil {
-		return false, fmt.Errorf("failed to get absolute repo root path: %w", err)
-	}
-
-	// Get path relative to repository root
-	relPath, err := filepath.Rel(absRepoRoot, absPath)
-	if err != nil {
-		return false, fmt.Errorf("failed to get relative path: %w", err)
-	}
-
-	// Ignore .vec directory and its contents
-	if strings.HasPrefix(relPath, VecDirName) {
-		return true, nil
-	}
-
-	// Check for cached patterns first
-	ignorePatternCacheMutex.RLock()
-	patterns, ok := ignorePatternCache[absRepoRoot]
-	ignorePatternCacheMutex.RUnlock()
-
-	// If not in cache, load patterns from .vecignore
-	if !ok {
-		patterns = loadIgnorePatterns(absRepoRoot)
-	}
-
-	// Match against patterns
-	return matchIgnorePatterns(patterns, relPath), nil
-}
-
-// loadIgnorePatterns loads and caches patterns from .vecignore file
-func loadIgnorePatterns(absRepoRoot string) []string {
-	vecignorePath := filepath.Join(absRepoRoot, ".vecignore")
-	patterns := []string{}
-
-	if FileExists(vecignorePath) {
-		vecignoreContent, err := ReadFileContent(vecignorePath)
-		if err == nil {
-			// Parse valid patterns
-			rawPatterns := strings.Split(string(vecignoreContent), "\n")
-			patterns = make([]string, 0, len(rawPatterns))
-
-			for _, pattern := range rawPatterns {
-				pattern = strings.TrimSpace(pattern)
-				if pattern == "" || strings.HasPrefix(pattern, "#") {
-					continue // Skip empty lines and comments
-				}
-
-				// Validate pattern before adding to cache
-				if _, err := filepath.Match(pattern, "test-filename"); err != nil {
-					// Log invalid pattern but don't fail
-					fmt.Fprintf(os.Stderr, "warning: invalid pattern in .vecignore: %s\n", pattern)
-					continue
-				}
-
-				patterns = append(patterns, filepath.Clean(pattern))
-			}
-		}
-	}
-
-	// Cache the parsed patterns
-	ignorePatternCacheMutex.Lock()
-	ignorePatternCache[absRepoRoot] = patterns
-	ignorePatternCacheMutex.Unlock()
-
-	return patterns
-}
-
-// matchIgnorePatterns checks if a path matches any ignore patterns
-func matchIgnorePatterns(patterns []string, relPath string) bool {
-	for _, pattern := range patterns {
-		// Check for direct match first
-		matched, _ := filepath.Match(pattern, relPath) // Error already checked during parsing
-		if matched {
-			return true
-		}
-
-		// Check if pattern matches any parent directory
-		// Split path only once and reuse for all patterns
-		relPathParts := strings.Split(relPath, string(filepath.Separator))
-		for i := range relPathParts {
-			partialPath := filepath.Join(relPathParts[:i+1]...)
-			if matched, _ := filepath.Match(pattern, partialPath); matched {
-				return true
-			}
-		}
-	}
-
-	return false
+	return core.IsIgnored(repoRoot, path)
 }
 
 // GetVecRoot returns the root directory of the Vec repository.